@@ -0,0 +1,161 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package arch describes the machine architectures of object files.
+package arch
+
+import (
+	"encoding/binary"
+	"strconv"
+	"strings"
+)
+
+// An Arch is a machine architecture. Each architecture has a single
+// Arch value, so Archs can be compared with ==.
+type Arch struct {
+	// GoArch is the GOARCH value for this architecture.
+	GoArch string
+
+	// PtrSize is the number of bytes in a pointer.
+	PtrSize int
+
+	// MinFrameSize is the number of bytes at the bottom of every
+	// stack frame except for empty leaf frames. This includes,
+	// for example, space for a saved LR (because that space is
+	// always reserved), but does not include the return PC pushed
+	// on x86 by CALL (because that is added only on a call).
+	MinFrameSize int
+
+	// ByteOrder is the byte order of this architecture.
+	ByteOrder binary.ByteOrder
+}
+
+var (
+	AMD64    = &Arch{"amd64", 8, 0, binary.LittleEndian}
+	ARM      = &Arch{"arm", 4, 4, binary.LittleEndian}
+	ARM64    = &Arch{"arm64", 8, 8, binary.LittleEndian}
+	I386     = &Arch{"386", 4, 0, binary.LittleEndian}
+	LOONG64  = &Arch{"loong64", 8, 8, binary.LittleEndian}
+	MIPS     = &Arch{"mips", 4, 4, binary.BigEndian}
+	MIPSLE   = &Arch{"mipsle", 4, 4, binary.LittleEndian}
+	MIPS64   = &Arch{"mips64", 8, 8, binary.BigEndian}
+	MIPS64LE = &Arch{"mips64le", 8, 8, binary.LittleEndian}
+	PPC64    = &Arch{"ppc64", 8, 32, binary.BigEndian}
+	PPC64LE  = &Arch{"ppc64le", 8, 32, binary.LittleEndian}
+	S390X    = &Arch{"s390x", 8, 8, binary.BigEndian}
+)
+
+// all lists the known architectures.
+var all = []*Arch{AMD64, ARM, ARM64, I386, LOONG64, MIPS, MIPSLE, MIPS64, MIPS64LE, PPC64, PPC64LE, S390X}
+
+// Lookup returns the architecture with GOARCH value goarch, or nil if
+// there is none.
+func Lookup(goarch string) *Arch {
+	for _, a := range all {
+		if a.GoArch == goarch {
+			return a
+		}
+	}
+	return nil
+}
+
+func (a *Arch) String() string {
+	if a == nil {
+		return "<nil>"
+	}
+	return a.GoArch
+}
+
+// DWARFRegName returns the name of DWARF register number n on a, or ""
+// if it's unknown.
+func (a *Arch) DWARFRegName(n uint64) string {
+	regs := dwarfRegs[a.GoArch]
+	if n < uint64(len(regs)) {
+		return regs[n]
+	}
+	return ""
+}
+
+// DWARFReg returns the DWARF register number of the register named
+// name on a. The name is case-insensitive.
+func (a *Arch) DWARFReg(name string) (uint64, bool) {
+	for i, reg := range dwarfRegs[a.GoArch] {
+		if reg != "" && strings.EqualFold(reg, name) {
+			return uint64(i), true
+		}
+	}
+	return 0, false
+}
+
+// IsDWARFStackReg reports whether DWARF register n on a is the stack
+// pointer or the frame pointer.
+func (a *Arch) IsDWARFStackReg(n uint64) bool {
+	for _, reg := range dwarfStackRegs[a.GoArch] {
+		if reg == n {
+			return true
+		}
+	}
+	return false
+}
+
+// dwarfStackRegs gives the DWARF register numbers of the stack and
+// frame pointers of each architecture.
+var dwarfStackRegs = map[string][]uint64{
+	"amd64":    {7, 6},
+	"arm":      {13, 11},
+	"arm64":    {31, 29},
+	"386":      {4, 5},
+	"loong64":  {3, 22},
+	"mips":     {29, 30},
+	"mipsle":   {29, 30},
+	"mips64":   {29, 30},
+	"mips64le": {29, 30},
+	"ppc64":    {1, 31},
+	"ppc64le":  {1, 31},
+	"s390x":    {15, 11},
+}
+
+// dwarfRegs gives the names of the DWARF register numbers of each
+// architecture, from the psABI supplements.
+var dwarfRegs = map[string][]string{
+	"amd64": {
+		"RAX", "RDX", "RCX", "RBX", "RSI", "RDI", "RBP", "RSP",
+		"R8", "R9", "R10", "R11", "R12", "R13", "R14", "R15",
+		"RIP",
+		"XMM0", "XMM1", "XMM2", "XMM3", "XMM4", "XMM5", "XMM6", "XMM7",
+		"XMM8", "XMM9", "XMM10", "XMM11", "XMM12", "XMM13", "XMM14", "XMM15",
+		"ST0", "ST1", "ST2", "ST3", "ST4", "ST5", "ST6", "ST7",
+		"MM0", "MM1", "MM2", "MM3", "MM4", "MM5", "MM6", "MM7",
+		"RFLAGS", "ES", "CS", "SS", "DS", "FS", "GS", "", "",
+		"FS.BASE", "GS.BASE",
+	},
+	"386": {
+		"EAX", "ECX", "EDX", "EBX", "ESP", "EBP", "ESI", "EDI",
+		"EIP", "EFLAGS", "",
+		"ST0", "ST1", "ST2", "ST3", "ST4", "ST5", "ST6", "ST7", "", "",
+		"XMM0", "XMM1", "XMM2", "XMM3", "XMM4", "XMM5", "XMM6", "XMM7",
+		"MM0", "MM1", "MM2", "MM3", "MM4", "MM5", "MM6", "MM7",
+	},
+	"arm":      gprs(16),
+	"arm64":    append(gprs(31), "RSP"),
+	"loong64":  gprs(32),
+	"mips":     gprs(32),
+	"mipsle":   gprs(32),
+	"mips64":   gprs(32),
+	"mips64le": gprs(32),
+	"ppc64":    gprs(32),
+	"ppc64le":  gprs(32),
+	"s390x":    gprs(16),
+}
+
+// gprs returns the names of general-purpose registers R0 through
+// R(n-1), which is how RISC psABIs number their first DWARF
+// registers.
+func gprs(n int) []string {
+	regs := make([]string, n)
+	for i := range regs {
+		regs[i] = "R" + strconv.Itoa(i)
+	}
+	return regs
+}
@@ -4,5 +4,6 @@ go 1.14
 
 require (
 	github.com/aclements/go-moremath v0.0.0-20190830160640-d16893ddf098
+	go.starlark.net v0.0.0-20200306205701-8dd3e2ee1dd5
 	golang.org/x/arch v0.0.0-20200511175325-f7c78586839d
 )
@@ -0,0 +1,33 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package asm
+
+// An AddrRef is an operand whose address is formed by earlier
+// instructions, such as a memory operand based on a register loaded
+// by a PC-relative LEA. Operands with a constant address in the
+// instruction itself aren't AddrRefs, since Consts and GoSyntax
+// already report them.
+type AddrRef struct {
+	// PC is the address of the instruction.
+	PC uint64
+	// Arg is the index of the operand in GoSyntax's output.
+	Arg int
+	// Addr is the operand's effective address.
+	Addr uint64
+}
+
+// AddrRefs folds the constants loaded into registers within each
+// basic block of seq to find operands whose addresses are constant.
+// The analysis follows moves of immediates and addresses, LEAs, and
+// additions of constants, so it finds addresses formed across several
+// instructions. tables are the jump tables of seq, whose targets
+// start basic blocks.
+func AddrRefs(seq Seq, tables []JumpTable) []AddrRef {
+	switch seq := seq.(type) {
+	case x86Seq:
+		return x86AddrRefs(seq, tables)
+	}
+	return nil
+}
@@ -7,8 +7,9 @@ package asm
 import (
 	"fmt"
 	"sort"
+	"strings"
 
-	"github.com/aclements/objbrowse/internal/arch"
+	"github.com/aclements/objbrowse/arch"
 )
 
 // TODO: Generalize to more than an index so we can support stack
@@ -26,6 +27,15 @@ func Disasm(arch *arch.Arch, text []byte, pc uint64) (Seq, error) {
 	return nil, fmt.Errorf("unsupported assembly architecture: %s", arch)
 }
 
+// Supported reports whether Disasm supports arch.
+func Supported(arch *arch.Arch) bool {
+	switch arch.String() {
+	case "amd64", "386":
+		return true
+	}
+	return false
+}
+
 // Seq is a sequence of instructions.
 type Seq interface {
 	Len() int
@@ -53,8 +63,58 @@ type Inst interface {
 	// Effects returns the read and write sets of this
 	// instruction.
 	Effects() (read, write LocSet)
+
+	// Consts returns the constant values that appear in this
+	// instruction's operands: immediates, memory displacements,
+	// and the absolute targets of PC-relative operands.
+	Consts() []uint64
+
+	// Class returns the broad kinds of work this instruction
+	// does.
+	Class() InstClass
+
+	// Cycles returns a rough estimate of this instruction's
+	// reciprocal throughput in cycles, from the architecture's
+	// throughput table.
+	Cycles() float64
+
+	// ISA returns the instruction set extension this instruction
+	// needs beyond the architecture's baseline, such as "AVX2",
+	// or "" if it needs none. This is approximate for
+	// instructions the disassembler doesn't support.
+	ISA() string
+
+	// PCRel returns the PC-relative operand of this instruction,
+	// if any: its offset and size in bytes within the
+	// instruction's encoding and the absolute address it refers
+	// to. size is 0 if the instruction has no PC-relative
+	// operand.
+	PCRel() (off, size int, target uint64)
+}
+
+// IsData reports whether the Go syntax op of an instruction is a
+// pseudo-instruction for undecodable bytes, such as ".byte". These
+// have no effects.
+func IsData(op string) bool {
+	return strings.HasPrefix(op, ".")
 }
 
+// InstClass is a set of instruction classes.
+type InstClass uint8
+
+const (
+	// ClassLoad instructions read memory.
+	ClassLoad InstClass = 1 << iota
+	// ClassStore instructions write memory.
+	ClassStore
+	// ClassBranch instructions are jumps or returns.
+	ClassBranch
+	// ClassCall instructions are calls.
+	ClassCall
+	// ClassSIMD instructions operate on vector registers.
+	ClassSIMD
+)
+
 // Arg is an argument to an instruction.
 type Arg interface {
 }
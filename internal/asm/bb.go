@@ -34,7 +34,8 @@ type BasicBlock struct {
 	//
 	// Type        len(Succs)
 	// None        1
-	// Jump        1 or 2 depending on Control.Conditional
+	// Jump        1 or 2 depending on Control.Conditional, or one
+	//             per distinct target of a jump table
 	// Ret         0 or 1 depending on Control.Conditional
 	// JumpUnknown 0 or 1 depending on Control.Conditional
 	// Exit        0 or 1 depending on Control.Conditional
@@ -72,6 +73,15 @@ type Edge struct {
 // If the control-flow graph cannot be computed, this returns an
 // error. Currently, the only reason for this is computed jumps.
 func BasicBlocks(seq Seq) ([]*BasicBlock, error) {
+	return BasicBlocksTables(seq, nil)
+}
+
+// BasicBlocksTables is like BasicBlocks, but also follows the indirect
+// jumps through tables, as found by JumpTables. A block ending in such
+// a jump has a successor for each distinct target of its table.
+func BasicBlocksTables(seq Seq, tables []JumpTable) ([]*BasicBlock, error) {
+	targets := tableTargets(tables)
+
 	// Find the start of each basic block.
 	var startPCs []uint64
 	pcs := make(map[uint64]int, seq.Len())
@@ -90,6 +100,10 @@ func BasicBlocks(seq Seq) ([]*BasicBlock, error) {
 		switch c.Type {
 		case ControlJump:
 			newBlock = true
+			if c.TargetPC == 0 && targets[pc] != nil {
+				startPCs = append(startPCs, targets[pc]...)
+				break
+			}
 			if c.TargetPC == 0 {
 				// Unknown target.
 				//
@@ -129,6 +143,9 @@ func BasicBlocks(seq Seq) ([]*BasicBlock, error) {
 	// Construct the basic blocks.
 	bbs := make([]*BasicBlock, 0, 1+len(startPCs))
 	bbPCs := make(map[uint64]*BasicBlock, 1+len(startPCs))
+	// tableSuccs are the successors of blocks ending in jumps
+	// through tables.
+	tableSuccs := make(map[*BasicBlock][]uint64)
 	bbs = append(bbs, &BasicBlock{Control: Control{Type: ControlNone}})
 	bbs[0].Succs = bbs[0].succStore[:0]
 	bbs[0].Preds = bbs[0].predStore[:0]
@@ -150,6 +167,11 @@ func BasicBlocks(seq Seq) ([]*BasicBlock, error) {
 		bb.Succs = bb.succStore[:0]
 		bb.Preds = bb.predStore[:0]
 		bbs = append(bbs, bb)
+		if bb.Control.Type == ControlJump && bb.Control.TargetPC == 0 {
+			if t := targets[seq.Get(end-1).PC()]; t != nil {
+				tableSuccs[bb] = t
+			}
+		}
 
 		bbPCs[seq.Get(start).PC()] = bb
 	}
@@ -176,6 +198,14 @@ func BasicBlocks(seq Seq) ([]*BasicBlock, error) {
 			if bb.Control.Conditional {
 				next = true
 			}
+			if t := tableSuccs[bb]; t != nil {
+				for _, pc := range t {
+					if tbb, ok := bbPCs[pc]; ok {
+						addEdge(bb, tbb)
+					}
+				}
+				break
+			}
 			if bb.Control.TargetPC == 0 {
 				// Jump to unknown PC. Turn this into
 				// a ControlJumpUnknown, since it
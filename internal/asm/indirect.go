@@ -0,0 +1,30 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package asm
+
+// An IndirectCall is an indirect call whose target is loaded from a
+// known memory slot, such as a GOT entry, a Go func value, or a method
+// slot in an itab.
+type IndirectCall struct {
+	// PC is the address of the call instruction.
+	PC uint64
+	// Slot is the address of the pointer-sized word the call's
+	// target is loaded from.
+	Slot uint64
+}
+
+// IndirectCalls finds the indirect calls in seq whose target is loaded
+// from a slot at a constant address. Slot addresses may themselves be
+// loaded from memory, such as the code pointer of a func value stored
+// in a global, so read must return the size bytes at addr, or fewer
+// if they aren't available. Since read returns the initial contents
+// of memory, the slots found this way are only probable.
+func IndirectCalls(seq Seq, read func(addr, size uint64) []byte) []IndirectCall {
+	switch seq := seq.(type) {
+	case x86Seq:
+		return x86IndirectCalls(seq, read)
+	}
+	return nil
+}
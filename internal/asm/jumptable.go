@@ -0,0 +1,51 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package asm
+
+// A JumpTable is a table of jump targets used by an indirect jump,
+// such as a compiled switch statement.
+type JumpTable struct {
+	// PC is the address of the indirect jump instruction.
+	PC uint64
+	// Addr is the address of the table.
+	Addr uint64
+	// EntrySize is the size of each table entry in bytes.
+	EntrySize int
+	// Targets are the jump targets of the table entries, in
+	// order. Entries often share a target, such as the default
+	// case of a switch.
+	Targets []uint64
+}
+
+// JumpTables finds the jump tables of the indirect jumps in seq, which
+// is a function spanning addresses [lo, hi). read must return the
+// size bytes at addr, or fewer if they aren't available. JumpTables
+// recognizes only the patterns compilers generate for jump tables,
+// and only returns tables whose targets are all in the function.
+func JumpTables(seq Seq, lo, hi uint64, read func(addr, size uint64) []byte) []JumpTable {
+	switch seq := seq.(type) {
+	case x86Seq:
+		return x86JumpTables(seq, lo, hi, read)
+	}
+	return nil
+}
+
+// tableTargets returns the distinct targets of tables, indexed by the
+// PC of each table's jump.
+func tableTargets(tables []JumpTable) map[uint64][]uint64 {
+	out := make(map[uint64][]uint64, len(tables))
+	for _, t := range tables {
+		seen := make(map[uint64]bool)
+		var targets []uint64
+		for _, pc := range t.Targets {
+			if !seen[pc] {
+				seen[pc] = true
+				targets = append(targets, pc)
+			}
+		}
+		out[t.PC] = targets
+	}
+	return out
+}
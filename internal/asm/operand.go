@@ -0,0 +1,88 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package asm
+
+// An Operand describes an operand of an instruction. Registers are
+// named like the architecture's DWARF registers, using the
+// full-width register that contains them, so AL and EAX are both
+// "RAX".
+type Operand struct {
+	Kind OperandKind
+	// Reg is the register of an OperandReg, or the base register
+	// of an OperandMem, if any.
+	Reg string
+	// Index and Scale are the index register of an OperandMem and
+	// its multiplier.
+	Index string
+	Scale int
+	// Disp is the displacement of an OperandMem.
+	Disp int64
+	// PCRel indicates an OperandMem's address is relative to the
+	// next instruction.
+	PCRel bool
+	// Value is the value of an OperandImm, or the target of an
+	// OperandRel or of a PC-relative OperandMem.
+	Value uint64
+}
+
+// An OperandKind is the kind of an Operand.
+type OperandKind uint8
+
+const (
+	OperandOther OperandKind = iota
+	OperandReg
+	OperandMem
+	OperandImm
+	// OperandRel is a PC-relative branch target.
+	OperandRel
+)
+
+// Operands returns the operands of inst in the order GoSyntax prints
+// them, or nil if inst's architecture isn't supported.
+func Operands(inst Inst) []Operand {
+	switch inst := inst.(type) {
+	case *x86Inst:
+		return inst.operands()
+	}
+	return nil
+}
+
+// ArgAt returns the index in GoSyntax's output of the operand encoded
+// by the size bytes at offset off in inst's encoding, such as the
+// field of a relocation, or -1 if it isn't known.
+func ArgAt(inst Inst, off, size int) int {
+	switch inst := inst.(type) {
+	case *x86Inst:
+		return inst.argAt(off, size)
+	}
+	return -1
+}
+
+// StackDepths follows the control flow of function seq from its entry
+// to find how far the stack pointer is below its value on entry
+// before each instruction. It returns the depth at each instruction
+// PC where it's known. tables are the jump tables of seq.
+func StackDepths(seq Seq, tables []JumpTable) map[uint64]StackDepth {
+	switch seq := seq.(type) {
+	case x86Seq:
+		return x86StackDepths(seq, tables)
+	}
+	return nil
+}
+
+// A StackDepth is the state of the stack before an instruction,
+// relative to the stack pointer on function entry.
+type StackDepth struct {
+	// SP is how many bytes the stack pointer is below its value
+	// on entry, if HasSP is set. It's unknown after the function
+	// realigns the stack.
+	SP    int64
+	HasSP bool
+	// FP is how many bytes the frame pointer is below the entry
+	// stack pointer, if HasFP is set because the function has set
+	// the frame pointer from the stack pointer.
+	FP    int64
+	HasFP bool
+}
@@ -5,7 +5,9 @@
 package asm
 
 import (
+	"encoding/binary"
 	"fmt"
+	"strings"
 
 	"golang.org/x/arch/x86/x86asm"
 )
@@ -24,36 +26,117 @@ func (s x86Seq) Get(i int) Inst {
 
 func disasmX86(text []byte, pc uint64, bits int) Seq {
 	var out x86Seq
-	for len(text) > 0 {
-		inst, err := x86asm.Decode(text, bits)
-		size := inst.Len
-		if err != nil || size == 0 || inst.Op == 0 {
-			inst = x86asm.Inst{}
-		}
-		if size == 0 {
-			size = 1
+	// targets records the jump targets seen so far, which are
+	// likely instruction boundaries.
+	targets := make(map[uint64]bool)
+	for off := 0; off < len(text); {
+		inst, ok := x86Decode(text[off:], bits)
+		if ok {
+			if c := (&x86Inst{Inst: inst, pc: pc + uint64(off)}).Control(); c.Type == ControlJump || c.Type == ControlCall {
+				targets[c.TargetPC] = true
+			}
+			out = append(out, x86Inst{inst, pc + uint64(off), nil, nil})
+			off += inst.Len
+			continue
 		}
-		out = append(out, x86Inst{inst, pc})
 
-		text = text[size:]
-		pc += uint64(size)
+		// Represent the undecodable bytes up to the next
+		// plausible instruction boundary as data, in chunks
+		// of up to 8 bytes. If the code jumped over the bytes,
+		// the boundary is where it jumped to.
+		end := -1
+		if len(out) > 0 {
+			prev := &out[len(out)-1]
+			if c := prev.Control(); c.Type == ControlJump && !c.Conditional && c.TargetPC > pc+uint64(off) && c.TargetPC-pc <= uint64(len(text)) {
+				end = int(c.TargetPC - pc)
+			}
+		}
+		if end < 0 {
+			end = x86Resync(text, off+1, pc, bits, targets)
+		}
+		for off < end {
+			n := end - off
+			if n > 8 {
+				n = 8
+			}
+			raw := text[off:]
+			if len(raw) > 15 {
+				raw = raw[:15]
+			}
+			out = append(out, x86Inst{x86asm.Inst{Mode: bits, Len: n}, pc + uint64(off), raw, text[off : off+n]})
+			off += n
+		}
 	}
 	return out
+}
 
+// x86Decode decodes the instruction at the start of text, reporting
+// whether it's a valid instruction.
+func x86Decode(text []byte, bits int) (x86asm.Inst, bool) {
+	inst, err := x86asm.Decode(text, bits)
+	return inst, err == nil && inst.Len > 0 && inst.Op != 0
+}
+
+// x86Resync returns the offset of the first plausible instruction
+// boundary in text at or after off: a jump target, or the start of a
+// run of instructions that decode up to the end of text or for
+// x86ResyncRun instructions. It returns len(text) if there's none.
+func x86Resync(text []byte, off int, pc uint64, bits int, targets map[uint64]bool) int {
+	const x86ResyncRun = 3
+	for ; off < len(text); off++ {
+		if targets[pc+uint64(off)] {
+			return off
+		}
+		n, end := 0, off
+		for n < x86ResyncRun && end < len(text) {
+			inst, ok := x86Decode(text[end:], bits)
+			if !ok {
+				break
+			}
+			n, end = n+1, end+inst.Len
+		}
+		if n == x86ResyncRun || n > 0 && end >= len(text) {
+			return off
+		}
+	}
+	return len(text)
 }
 
 type x86Inst struct {
 	x86asm.Inst
 	pc uint64
+	// raw is the start of the undecoded bytes if decoding failed.
+	raw []byte
+	// data is the undecoded bytes this instruction represents if
+	// decoding failed.
+	data []byte
 }
 
 func (i *x86Inst) GoSyntax(symname func(uint64) (string, uint64)) string {
 	if i.Op == 0 {
-		return "?"
+		return x86DataSyntax(i.data, i.pc)
 	}
 	return x86asm.GoSyntax(i.Inst, i.pc, symname)
 }
 
+// x86DataSyntax returns the pseudo-instruction for undecodable bytes
+// data at pc: ".quad" for an aligned 8-byte word, and ".byte"
+// otherwise.
+func x86DataSyntax(data []byte, pc uint64) string {
+	if len(data) == 8 && pc%8 == 0 {
+		return fmt.Sprintf(".quad %#x", binary.LittleEndian.Uint64(data))
+	}
+	var buf strings.Builder
+	buf.WriteString(".byte ")
+	for i, b := range data {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		fmt.Fprintf(&buf, "0x%02x", b)
+	}
+	return buf.String()
+}
+
 func (i *x86Inst) PC() uint64 {
 	return i.pc
 }
@@ -62,6 +145,44 @@ func (i *x86Inst) Len() int {
 	return i.Inst.Len
 }
 
+func (i *x86Inst) Consts() []uint64 {
+	var out []uint64
+	next := i.pc + uint64(i.Inst.Len)
+	for _, arg := range i.Args {
+		switch arg := arg.(type) {
+		case x86asm.Imm:
+			out = append(out, uint64(arg))
+		case x86asm.Rel:
+			out = append(out, next+uint64(int64(arg)))
+		case x86asm.Mem:
+			if arg.Base == x86asm.RIP || arg.Base == x86asm.EIP {
+				out = append(out, next+uint64(arg.Disp))
+			} else if arg.Disp != 0 {
+				out = append(out, uint64(arg.Disp))
+			}
+		}
+	}
+	return out
+}
+
+func (i *x86Inst) PCRel() (off, size int, target uint64) {
+	if i.Inst.PCRel == 0 {
+		return 0, 0, 0
+	}
+	next := i.pc + uint64(i.Inst.Len)
+	for _, arg := range i.Args {
+		switch arg := arg.(type) {
+		case x86asm.Rel:
+			return i.PCRelOff, i.Inst.PCRel, next + uint64(int64(arg))
+		case x86asm.Mem:
+			if arg.Base == x86asm.RIP || arg.Base == x86asm.EIP {
+				return i.PCRelOff, i.Inst.PCRel, next + uint64(arg.Disp)
+			}
+		}
+	}
+	return 0, 0, 0
+}
+
 func (i *x86Inst) Control() Control {
 	var c Control
 
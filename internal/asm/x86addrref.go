@@ -0,0 +1,223 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package asm
+
+import "golang.org/x/arch/x86/x86asm"
+
+// x86RegState is the constant value of each general-purpose register,
+// by register family.
+type x86RegState struct {
+	known [16]bool
+	val   [16]uint64
+}
+
+func (s *x86RegState) get(r x86asm.Reg) (uint64, bool) {
+	fam := x86RegFamily(r)
+	if fam < 0 || !s.known[fam] {
+		return 0, false
+	}
+	return s.val[fam], true
+}
+
+// set records that register r holds v, or kills it if !ok. Writes to
+// 32-bit registers zero the upper half, while writes to 8- and 16-bit
+// registers merge with the rest, so those make the register unknown.
+func (s *x86RegState) set(r x86asm.Reg, v uint64, ok bool) {
+	fam := x86RegFamily(r)
+	switch {
+	case x86asm.AH <= r && r <= x86asm.BH:
+		fam, ok = int(r-x86asm.AH), false
+	case x86asm.AL <= r && r <= x86asm.BL:
+		fam, ok = int(r-x86asm.AL), false
+	case x86asm.SPB <= r && r <= x86asm.R15B:
+		fam, ok = int(r-x86asm.SPB)+4, false
+	case x86asm.AX <= r && r <= x86asm.R15W:
+		ok = false
+	case x86asm.EAX <= r && r <= x86asm.R15L:
+		v &= 1<<32 - 1
+	}
+	if fam < 0 {
+		// Not a general-purpose register.
+		return
+	}
+	s.known[fam], s.val[fam] = ok, v
+}
+
+// x86WritesDst lists the instructions whose only register effect is
+// to write their first (destination) operand.
+var x86WritesDst = map[x86asm.Op]bool{
+	x86asm.MOV: true, x86asm.MOVZX: true, x86asm.MOVSX: true, x86asm.MOVSXD: true, x86asm.LEA: true,
+	x86asm.ADD: true, x86asm.SUB: true, x86asm.AND: true, x86asm.OR: true, x86asm.XOR: true,
+	x86asm.ADC: true, x86asm.SBB: true, x86asm.INC: true, x86asm.DEC: true, x86asm.NEG: true, x86asm.NOT: true,
+	x86asm.SHL: true, x86asm.SHR: true, x86asm.SAR: true, x86asm.ROL: true, x86asm.ROR: true,
+	x86asm.POP: true, x86asm.BSF: true, x86asm.BSR: true, x86asm.TZCNT: true, x86asm.LZCNT: true, x86asm.POPCNT: true,
+	x86asm.MOVD: true, x86asm.MOVQ: true, x86asm.MOVUPS: true, x86asm.MOVAPS: true, x86asm.MOVUPD: true, x86asm.MOVAPD: true,
+	x86asm.MOVDQU: true, x86asm.MOVDQA: true, x86asm.MOVSD_XMM: true, x86asm.MOVSS: true,
+	x86asm.PXOR: true, x86asm.XORPS: true, x86asm.XORPD: true,
+	x86asm.SETA: true, x86asm.SETAE: true, x86asm.SETB: true, x86asm.SETBE: true, x86asm.SETE: true, x86asm.SETNE: true,
+	x86asm.SETG: true, x86asm.SETGE: true, x86asm.SETL: true, x86asm.SETLE: true,
+	x86asm.CMOVA: true, x86asm.CMOVAE: true, x86asm.CMOVB: true, x86asm.CMOVBE: true, x86asm.CMOVE: true, x86asm.CMOVNE: true,
+	x86asm.CMOVG: true, x86asm.CMOVGE: true, x86asm.CMOVL: true, x86asm.CMOVLE: true,
+}
+
+// x86NoRegWrites lists the instructions that don't write general
+// purpose registers other than the stack pointer.
+var x86NoRegWrites = map[x86asm.Op]bool{
+	x86asm.CMP: true, x86asm.TEST: true, x86asm.BT: true, x86asm.PUSH: true, x86asm.NOP: true,
+	x86asm.PREFETCHT0: true, x86asm.PREFETCHT1: true, x86asm.PREFETCHT2: true, x86asm.PREFETCHNTA: true,
+	x86asm.UCOMISD: true, x86asm.UCOMISS: true, x86asm.INT: true, x86asm.PAUSE: true,
+	x86asm.LFENCE: true, x86asm.MFENCE: true, x86asm.SFENCE: true,
+}
+
+func x86AddrRefs(seq x86Seq, tables []JumpTable) []AddrRef {
+	// Find the instructions that start basic blocks: jump
+	// targets and the instructions after control flow.
+	leaders := make(map[uint64]bool)
+	for i := range seq {
+		if c := seq[i].Control(); c.Type != ControlNone {
+			leaders[c.TargetPC] = true
+			leaders[seq[i].pc+uint64(seq[i].Inst.Len)] = true
+		}
+	}
+	for _, t := range tables {
+		for _, pc := range t.Targets {
+			leaders[pc] = true
+		}
+	}
+
+	var out []AddrRef
+	var s x86RegState
+	for i := range seq {
+		inst := &seq[i]
+		if leaders[inst.pc] || inst.Op == 0 {
+			s = x86RegState{}
+		}
+		if inst.Op == 0 {
+			continue
+		}
+		if inst.Op == x86asm.NOP {
+			// Multi-byte NOPs have memory operands that
+			// don't refer to anything.
+			continue
+		}
+
+		nargs := 0
+		for nargs < len(inst.Args) && inst.Args[nargs] != nil {
+			nargs++
+		}
+		for j := 0; j < nargs; j++ {
+			if m, ok := inst.Args[j].(x86asm.Mem); ok {
+				if addr, ok := s.memAddr(inst, m); ok {
+					// GoSyntax reverses the operands.
+					out = append(out, AddrRef{PC: inst.pc, Arg: nargs - 1 - j, Addr: addr})
+				}
+			}
+		}
+		s.step(inst, nargs)
+	}
+	return out
+}
+
+// memAddr returns the effective address of memory operand m of inst,
+// if it's constant because of the values of its registers.
+func (s *x86RegState) memAddr(inst *x86Inst, m x86asm.Mem) (uint64, bool) {
+	if m.Segment != 0 || m.Base == x86asm.RIP || m.Base == x86asm.EIP || (m.Base == 0 && m.Index == 0) {
+		return 0, false
+	}
+	addr := uint64(m.Disp)
+	if m.Base != 0 {
+		v, ok := s.get(m.Base)
+		if !ok {
+			return 0, false
+		}
+		addr += v
+	}
+	if m.Index != 0 {
+		v, ok := s.get(m.Index)
+		if !ok {
+			return 0, false
+		}
+		addr += v * uint64(m.Scale)
+	}
+	if inst.Mode == 32 {
+		addr &= 1<<32 - 1
+	}
+	return addr, true
+}
+
+// step updates s for the effects of inst, which has nargs operands.
+func (s *x86RegState) step(inst *x86Inst, nargs int) {
+	if c := inst.Control(); c.Type != ControlNone {
+		// Calls clobber most registers, and other control
+		// flow ends the block anyway.
+		*s = x86RegState{}
+		return
+	}
+	if inst.Op == x86asm.PUSH || inst.Op == x86asm.POP {
+		s.set(x86asm.RSP, 0, false)
+	}
+	if x86NoRegWrites[inst.Op] {
+		return
+	}
+	if !x86WritesDst[inst.Op] || nargs == 0 {
+		*s = x86RegState{}
+		return
+	}
+	dst, ok := inst.Args[0].(x86asm.Reg)
+	if !ok {
+		// A store or a write of a non-GP register.
+		return
+	}
+	var src x86asm.Arg
+	if nargs > 1 {
+		src = inst.Args[1]
+	}
+	// value returns the value of the source operand.
+	value := func() (uint64, bool) {
+		switch src := src.(type) {
+		case x86asm.Imm:
+			return uint64(src), true
+		case x86asm.Reg:
+			return s.get(src)
+		}
+		return 0, false
+	}
+	switch inst.Op {
+	case x86asm.MOV:
+		v, ok := value()
+		s.set(dst, v, ok)
+		return
+	case x86asm.LEA:
+		m := src.(x86asm.Mem)
+		if m.Base == x86asm.RIP || m.Base == x86asm.EIP {
+			if m.Index == 0 {
+				s.set(dst, inst.pc+uint64(inst.Inst.Len)+uint64(m.Disp), true)
+				return
+			}
+		} else if v, ok := s.memAddr(inst, m); ok {
+			s.set(dst, v, true)
+			return
+		} else if m.Base == 0 && m.Index == 0 {
+			s.set(dst, uint64(m.Disp), true)
+			return
+		}
+	case x86asm.ADD, x86asm.SUB:
+		if d, ok := s.get(dst); ok {
+			if v, ok := value(); ok {
+				if inst.Op == x86asm.SUB {
+					v = -v
+				}
+				s.set(dst, d+v, true)
+				return
+			}
+		}
+	case x86asm.XOR:
+		if src == x86asm.Arg(dst) {
+			s.set(dst, 0, true)
+			return
+		}
+	}
+	s.set(dst, 0, false)
+}
@@ -0,0 +1,141 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package asm
+
+import "golang.org/x/arch/x86/x86asm"
+
+func (i *x86Inst) Class() InstClass {
+	var c InstClass
+	switch i.Control().Type {
+	case ControlJump, ControlJumpUnknown, ControlRet:
+		c |= ClassBranch
+	case ControlCall, ControlExit:
+		c |= ClassCall
+	}
+	// Stack operations access memory implicitly.
+	switch i.Op {
+	case x86asm.PUSH, x86asm.CALL:
+		c |= ClassStore
+	case x86asm.POP, x86asm.RET:
+		c |= ClassLoad
+	case x86asm.MOVSB, x86asm.MOVSW, x86asm.MOVSD, x86asm.MOVSQ:
+		c |= ClassLoad | ClassStore
+	case x86asm.STOSB, x86asm.STOSW, x86asm.STOSD, x86asm.STOSQ:
+		c |= ClassStore
+	case x86asm.LODSB, x86asm.LODSW, x86asm.LODSD, x86asm.LODSQ,
+		x86asm.CMPSB, x86asm.CMPSW, x86asm.CMPSD, x86asm.CMPSQ,
+		x86asm.SCASB, x86asm.SCASW, x86asm.SCASD, x86asm.SCASQ:
+		c |= ClassLoad
+	}
+
+	narg := 0
+	for narg < len(i.Args) && i.Args[narg] != nil {
+		narg++
+	}
+	effects := x86Args[x86ArgsKey{i.Op, narg}]
+	for n, arg := range i.Args[:narg] {
+		switch arg := arg.(type) {
+		case x86asm.Reg:
+			if x86asm.M0 <= arg && arg <= x86asm.M7 || x86asm.X0 <= arg && arg <= x86asm.X15 {
+				c |= ClassSIMD
+			}
+		case x86asm.Mem:
+			switch i.Op {
+			case x86asm.LEA, x86asm.NOP,
+				x86asm.PREFETCHNTA, x86asm.PREFETCHT0, x86asm.PREFETCHT1, x86asm.PREFETCHT2, x86asm.PREFETCHW:
+				// These don't access memory.
+				continue
+			}
+			e := r
+			if n < len(effects) {
+				e = effects[n]
+			}
+			if e&r != 0 {
+				c |= ClassLoad
+			}
+			if e&w != 0 {
+				c |= ClassStore
+			}
+		}
+	}
+	return c
+}
+
+// Costs of memory accesses, added to the throughput of the operation
+// itself.
+const (
+	x86LoadCycles  = 0.5
+	x86StoreCycles = 1
+)
+
+// x86DefaultCycles is the reciprocal throughput of simple integer
+// operations, which can issue on four ports.
+const x86DefaultCycles = 0.25
+
+// x86Cycles gives the approximate reciprocal throughputs of
+// register-to-register forms of operations that differ from
+// x86DefaultCycles on a recent Intel core, after Agner Fog's
+// instruction tables. Memory operands add x86LoadCycles or
+// x86StoreCycles.
+var x86Cycles = map[x86asm.Op]float64{
+	x86asm.IMUL: 1, x86asm.MUL: 1,
+	x86asm.DIV: 24, x86asm.IDIV: 24,
+	x86asm.LEA: 0.5,
+	x86asm.JMP: 1, x86asm.CALL: 2, x86asm.RET: 1,
+	x86asm.BSF: 1, x86asm.BSR: 1, x86asm.POPCNT: 1, x86asm.LZCNT: 1, x86asm.TZCNT: 1,
+	x86asm.CMOVA: 0.5, x86asm.CMOVAE: 0.5, x86asm.CMOVB: 0.5, x86asm.CMOVBE: 0.5,
+	x86asm.CMOVE: 0.5, x86asm.CMOVG: 0.5, x86asm.CMOVGE: 0.5, x86asm.CMOVL: 0.5,
+	x86asm.CMOVLE: 0.5, x86asm.CMOVNE: 0.5, x86asm.CMOVNO: 0.5, x86asm.CMOVNP: 0.5,
+	x86asm.CMOVNS: 0.5, x86asm.CMOVO: 0.5, x86asm.CMOVP: 0.5, x86asm.CMOVS: 0.5,
+	x86asm.SHL: 0.5, x86asm.SHR: 0.5, x86asm.SAR: 0.5, x86asm.ROL: 0.5, x86asm.ROR: 0.5,
+	x86asm.SHLD: 1, x86asm.SHRD: 1, x86asm.RCL: 2, x86asm.RCR: 2,
+	x86asm.BSWAP: 0.5, x86asm.XCHG: 1, x86asm.CMPXCHG: 5, x86asm.XADD: 1,
+	x86asm.PUSH: 0, x86asm.POP: 0,
+
+	x86asm.ADDSD: 0.5, x86asm.ADDSS: 0.5, x86asm.ADDPD: 0.5, x86asm.ADDPS: 0.5,
+	x86asm.SUBSD: 0.5, x86asm.SUBSS: 0.5, x86asm.SUBPD: 0.5, x86asm.SUBPS: 0.5,
+	x86asm.MULSD: 0.5, x86asm.MULSS: 0.5, x86asm.MULPD: 0.5, x86asm.MULPS: 0.5,
+	x86asm.DIVSS: 3, x86asm.DIVSD: 4, x86asm.DIVPS: 3, x86asm.DIVPD: 4,
+	x86asm.SQRTSS: 3, x86asm.SQRTSD: 4.5, x86asm.SQRTPS: 3, x86asm.SQRTPD: 4.5,
+	x86asm.UCOMISD: 1, x86asm.UCOMISS: 1, x86asm.COMISD: 1, x86asm.COMISS: 1,
+	x86asm.CVTSI2SD: 1, x86asm.CVTSI2SS: 1, x86asm.CVTTSD2SI: 1, x86asm.CVTTSS2SI: 1,
+	x86asm.CVTSD2SS: 1, x86asm.CVTSS2SD: 1,
+	x86asm.PSHUFB: 1, x86asm.PSHUFD: 1, x86asm.PMOVMSKB: 1, x86asm.PCMPESTRI: 4, x86asm.PCMPISTRI: 3,
+	x86asm.AESENC: 1, x86asm.AESENCLAST: 1, x86asm.AESDEC: 1, x86asm.AESDECLAST: 1,
+	x86asm.PCLMULQDQ: 1,
+
+	x86asm.LFENCE: 4, x86asm.SFENCE: 6, x86asm.MFENCE: 33,
+	x86asm.PAUSE: 140, x86asm.CPUID: 100, x86asm.RDTSC: 25, x86asm.RDTSCP: 32,
+	x86asm.SYSCALL: 100, x86asm.INT: 100, x86asm.HLT: 100,
+	x86asm.UD1: 0, x86asm.UD2: 0,
+}
+
+func (i *x86Inst) Cycles() float64 {
+	if i.Op == 0 {
+		return 0
+	}
+	cycles, ok := x86Cycles[i.Op]
+	if !ok {
+		cycles = x86DefaultCycles
+	}
+	c := i.Class()
+	if c&ClassLoad != 0 {
+		cycles += x86LoadCycles
+	}
+	if c&ClassStore != 0 {
+		cycles += x86StoreCycles
+	}
+	// Locked instructions are full barriers.
+	for _, pfx := range i.Prefix {
+		if pfx == 0 {
+			break
+		}
+		if pfx&0xff == x86asm.PrefixLOCK {
+			cycles += 18
+			break
+		}
+	}
+	return cycles
+}
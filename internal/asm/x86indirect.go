@@ -0,0 +1,102 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package asm
+
+import (
+	"encoding/binary"
+
+	"golang.org/x/arch/x86/x86asm"
+)
+
+// x86MaxLoads is the most pointers to follow to compute the address of
+// an indirect call's slot.
+const x86MaxLoads = 3
+
+func x86IndirectCalls(seq x86Seq, read func(addr, size uint64) []byte) []IndirectCall {
+	var out []IndirectCall
+	for i := range seq {
+		if seq[i].Op != x86asm.CALL {
+			continue
+		}
+		if slot, ok := seq.callSlot(i, read); ok {
+			out = append(out, IndirectCall{PC: seq[i].pc, Slot: slot})
+		}
+	}
+	return out
+}
+
+// callSlot returns the address of the slot the indirect call seq[i]
+// loads its target from. It recognizes these patterns:
+//
+//	CALL [addr]
+//	MOV r, [addr]; CALL r
+//
+// where addr is a PC-relative or absolute address, or a displacement
+// from a register with a value known to addrValue.
+func (seq x86Seq) callSlot(i int, read func(addr, size uint64) []byte) (uint64, bool) {
+	switch arg := seq[i].Args[0].(type) {
+	case x86asm.Mem:
+		return seq.memAddr(i, arg, read, x86MaxLoads)
+
+	case x86asm.Reg:
+		def := seq.regDef(i, arg)
+		if def < 0 || seq[def].Op != x86asm.MOV {
+			return 0, false
+		}
+		if m, ok := seq[def].Args[1].(x86asm.Mem); ok {
+			return seq.memAddr(def, m, read, x86MaxLoads)
+		}
+	}
+	return 0, false
+}
+
+// memAddr returns the address of memory operand m of seq[i], if it's
+// constant. Registers in m may be loaded from memory through up to
+// loads pointers.
+func (seq x86Seq) memAddr(i int, m x86asm.Mem, read func(addr, size uint64) []byte, loads int) (uint64, bool) {
+	if m.Segment != 0 || m.Index != 0 {
+		return 0, false
+	}
+	if m.Base == x86asm.RIP || m.Base == x86asm.EIP {
+		return seq[i].pc + uint64(seq[i].Inst.Len) + uint64(m.Disp), true
+	}
+	base, ok := seq.addrValue(i, m.Base, read, loads)
+	if !ok {
+		return 0, false
+	}
+	return base + uint64(m.Disp), true
+}
+
+// addrValue is like regValue, but also follows up to loads pointer
+// loads into r, using the initial contents of memory from read.
+func (seq x86Seq) addrValue(i int, r x86asm.Reg, read func(addr, size uint64) []byte, loads int) (uint64, bool) {
+	if v, ok := seq.regValue(i, r); ok {
+		return v, true
+	}
+	if loads == 0 {
+		return 0, false
+	}
+	def := seq.regDef(i, r)
+	if def < 0 || seq[def].Op != x86asm.MOV {
+		return 0, false
+	}
+	m, ok := seq[def].Args[1].(x86asm.Mem)
+	if !ok {
+		return 0, false
+	}
+	addr, ok := seq.memAddr(def, m, read, loads-1)
+	if !ok {
+		return 0, false
+	}
+	ptrSize := seq[def].Mode / 8
+	data := read(addr, uint64(ptrSize))
+	switch {
+	case len(data) < ptrSize:
+		return 0, false
+	case ptrSize == 8:
+		return binary.LittleEndian.Uint64(data), true
+	}
+	return uint64(binary.LittleEndian.Uint32(data)), true
+}
@@ -0,0 +1,156 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package asm
+
+import "golang.org/x/arch/x86/x86asm"
+
+// x86ISA gives the extension needed by operations beyond the SSE2
+// baseline of amd64.
+var x86ISA = map[x86asm.Op]string{}
+
+func init() {
+	for ext, ops := range map[string][]x86asm.Op{
+		"SSE3": {x86asm.ADDSUBPD, x86asm.ADDSUBPS, x86asm.HADDPD, x86asm.HADDPS, x86asm.HSUBPD, x86asm.HSUBPS,
+			x86asm.LDDQU, x86asm.MOVDDUP, x86asm.MOVSHDUP, x86asm.MOVSLDUP, x86asm.MONITOR, x86asm.MWAIT, x86asm.FISTTP},
+		"SSSE3": {x86asm.PABSB, x86asm.PABSD, x86asm.PABSW, x86asm.PALIGNR, x86asm.PHADDD, x86asm.PHADDSW,
+			x86asm.PHADDW, x86asm.PHSUBD, x86asm.PHSUBSW, x86asm.PHSUBW, x86asm.PMADDUBSW, x86asm.PMULHRSW,
+			x86asm.PSHUFB, x86asm.PSIGNB, x86asm.PSIGND, x86asm.PSIGNW},
+		"SSE4.1": {x86asm.BLENDPD, x86asm.BLENDPS, x86asm.BLENDVPD, x86asm.BLENDVPS, x86asm.DPPD, x86asm.DPPS,
+			x86asm.EXTRACTPS, x86asm.INSERTPS, x86asm.MOVNTDQA, x86asm.MPSADBW, x86asm.PACKUSDW, x86asm.PBLENDVB,
+			x86asm.PBLENDW, x86asm.PCMPEQQ, x86asm.PEXTRB, x86asm.PEXTRD, x86asm.PEXTRQ, x86asm.PHMINPOSUW,
+			x86asm.PINSRB, x86asm.PINSRD, x86asm.PINSRQ, x86asm.PMAXSB, x86asm.PMAXSD, x86asm.PMAXUD,
+			x86asm.PMAXUW, x86asm.PMINSB, x86asm.PMINSD, x86asm.PMINUD, x86asm.PMINUW,
+			x86asm.PMOVSXBD, x86asm.PMOVSXBQ, x86asm.PMOVSXBW, x86asm.PMOVSXDQ, x86asm.PMOVSXWD, x86asm.PMOVSXWQ,
+			x86asm.PMOVZXBD, x86asm.PMOVZXBQ, x86asm.PMOVZXBW, x86asm.PMOVZXDQ, x86asm.PMOVZXWD, x86asm.PMOVZXWQ,
+			x86asm.PMULDQ, x86asm.PMULLD, x86asm.PTEST, x86asm.ROUNDPD, x86asm.ROUNDPS, x86asm.ROUNDSD, x86asm.ROUNDSS},
+		"SSE4.2":    {x86asm.CRC32, x86asm.PCMPESTRI, x86asm.PCMPESTRM, x86asm.PCMPGTQ, x86asm.PCMPISTRI, x86asm.PCMPISTRM},
+		"POPCNT":    {x86asm.POPCNT},
+		"LZCNT":     {x86asm.LZCNT},
+		"BMI1":      {x86asm.TZCNT},
+		"MOVBE":     {x86asm.MOVBE},
+		"CX16":      {x86asm.CMPXCHG16B},
+		"AES":       {x86asm.AESDEC, x86asm.AESDECLAST, x86asm.AESENC, x86asm.AESENCLAST, x86asm.AESIMC, x86asm.AESKEYGENASSIST},
+		"PCLMULQDQ": {x86asm.PCLMULQDQ},
+		"RDRAND":    {x86asm.RDRAND},
+		"FSGSBASE":  {x86asm.RDFSBASE, x86asm.RDGSBASE, x86asm.WRFSBASE, x86asm.WRGSBASE},
+		"RDTSCP":    {x86asm.RDTSCP},
+		"TSX":       {x86asm.XABORT, x86asm.XBEGIN, x86asm.XEND, x86asm.XTEST},
+		"XSAVE": {x86asm.XGETBV, x86asm.XSETBV, x86asm.XSAVE, x86asm.XSAVE64, x86asm.XRSTOR, x86asm.XRSTOR64,
+			x86asm.XSAVEOPT, x86asm.XSAVEOPT64, x86asm.XSAVEC, x86asm.XSAVEC64, x86asm.XSAVES, x86asm.XSAVES64,
+			x86asm.XRSTORS, x86asm.XRSTORS64},
+		"AVX": {x86asm.VMOVDQA, x86asm.VMOVDQU, x86asm.VMOVNTDQ, x86asm.VMOVNTDQA, x86asm.VZEROUPPER},
+	} {
+		for _, op := range ops {
+			x86ISA[op] = ext
+		}
+	}
+}
+
+// X86Level returns the x86-64 microarchitecture level (2, 3, or 4)
+// that includes extension ext, or 0 if ext is baseline or not part of
+// any level.
+func X86Level(ext string) int {
+	switch ext {
+	case "CX16", "LAHF-SAHF", "POPCNT", "SSE3", "SSE4.1", "SSE4.2", "SSSE3":
+		return 2
+	case "AVX", "AVX2", "BMI1", "BMI2", "F16C", "FMA", "LZCNT", "MOVBE", "XSAVE":
+		return 3
+	case "AVX-512":
+		return 4
+	}
+	return 0
+}
+
+func (i *x86Inst) ISA() string {
+	if i.Op == 0 {
+		return x86VEXISA(i.raw, i.Mode)
+	}
+	if (i.Op == x86asm.LAHF || i.Op == x86asm.SAHF) && i.Mode == 64 {
+		return "LAHF-SAHF"
+	}
+	return x86ISA[i.Op]
+}
+
+// x86VEXISA returns the extension needed by the VEX- or EVEX-encoded
+// instruction at the start of raw, or "" if it isn't one. x86asm
+// doesn't decode most of these, so this looks at just the encoding
+// and opcode, which is enough to tell apart the extensions that
+// matter for microarchitecture levels.
+func x86VEXISA(raw []byte, mode int) string {
+	p := raw
+	for len(p) > 0 {
+		switch p[0] {
+		case 0x26, 0x2e, 0x36, 0x3e, 0x64, 0x65, 0x66, 0x67, 0xf0, 0xf2, 0xf3:
+			p = p[1:]
+			continue
+		}
+		break
+	}
+	if len(p) < 4 {
+		return ""
+	}
+	// Outside 64-bit mode, these bytes are VEX and EVEX prefixes
+	// only if they'd otherwise have a register ModRM operand.
+	if mode != 64 && p[1] < 0xc0 {
+		return ""
+	}
+	var m, pp, l, op byte
+	switch p[0] {
+	case 0x62:
+		return "AVX-512"
+	case 0xc5:
+		m, pp, l, op = 1, p[1]&3, p[1]>>2&1, p[2]
+	case 0xc4:
+		m, pp, l, op = p[1]&0x1f, p[2]&3, p[2]>>2&1, p[3]
+	default:
+		return ""
+	}
+
+	// pp selects an implied 66, F3, or F2 prefix.
+	const (
+		pNone = 0
+		p66   = 1
+		pF3   = 2
+		pF2   = 3
+	)
+	switch {
+	case m == 2 && (op == 0xf2 || op == 0xf3 || op == 0xf7 && pp == pNone):
+		// ANDN, BLSR/BLSMSK/BLSI, BEXTR.
+		return "BMI1"
+	case m == 2 && (op == 0xf5 || op == 0xf6 || op == 0xf7), m == 3 && op == 0xf0:
+		// BZHI/PEXT/PDEP, MULX, SHLX/SARX/SHRX, RORX.
+		return "BMI2"
+	case m == 2 && pp == p66 && op >= 0x96 && op <= 0xbf:
+		return "FMA"
+	case m == 2 && pp == p66 && op == 0x13, m == 3 && pp == p66 && op == 0x1d:
+		return "F16C"
+	}
+	if l == 1 && pp == p66 {
+		// 256-bit integer operations are AVX2, while 256-bit
+		// floating-point operations are AVX.
+		switch m {
+		case 1:
+			if op >= 0x60 && op <= 0x76 && op != 0x6e || op >= 0xd1 && op <= 0xfe && op != 0xd6 && op != 0xe6 && op != 0xe7 {
+				return "AVX2"
+			}
+		case 2:
+			switch {
+			case op >= 0x0c && op <= 0x0f, op >= 0x18 && op <= 0x1a, op >= 0x2c && op <= 0x2f:
+				// VPERMILPS/PD, VTESTPS/PD,
+				// VBROADCASTSS/SD/F128,
+				// VMASKMOVPS/PD.
+			default:
+				return "AVX2"
+			}
+		case 3:
+			switch op {
+			case 0x04, 0x05, 0x06, 0x08, 0x09, 0x0c, 0x0d, 0x18, 0x19, 0x40, 0x4a, 0x4b:
+			default:
+				return "AVX2"
+			}
+		}
+	}
+	return "AVX"
+}
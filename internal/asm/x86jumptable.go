@@ -0,0 +1,226 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package asm
+
+import (
+	"encoding/binary"
+
+	"golang.org/x/arch/x86/x86asm"
+)
+
+const (
+	// x86JumpTableWindow is how many instructions before an
+	// indirect jump to search for the instructions computing its
+	// table and bound.
+	x86JumpTableWindow = 16
+
+	// x86MaxUnbounded is the most entries to read from a table
+	// whose bound isn't known. Such tables end at the first entry
+	// that doesn't point into the function.
+	x86MaxUnbounded = 1024
+)
+
+func x86JumpTables(seq x86Seq, lo, hi uint64, read func(addr, size uint64) []byte) []JumpTable {
+	var out []JumpTable
+	for i := range seq {
+		if seq[i].Op != x86asm.JMP {
+			continue
+		}
+		if t, ok := seq.jumpTable(i, lo, hi, read); ok {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// jumpTable recognizes the jump table used by the indirect jump
+// seq[i]. It recognizes these patterns, where the table base may also
+// be a constant:
+//
+//	JMP [base + index*ptr]                      // Table of addresses
+//	MOV r, [base + index*ptr]; JMP r            // Table of addresses
+//	MOVSXD r, [base + index*4]; ADD r, base; JMP r
+//	                                            // Table of offsets from base
+//
+// where base is loaded by a PC-relative LEA. The table's bound comes
+// from a preceding "CMP index, $n; JA" or JAE.
+func (seq x86Seq) jumpTable(i int, lo, hi uint64, read func(addr, size uint64) []byte) (JumpTable, bool) {
+	inst := &seq[i]
+	ptrSize := inst.Mode / 8
+	var mem x86asm.Mem
+	var memInst int
+	relative := false
+	switch arg := inst.Args[0].(type) {
+	default:
+		return JumpTable{}, false
+
+	case x86asm.Mem:
+		mem, memInst = arg, i
+
+	case x86asm.Reg:
+		def := seq.regDef(i, arg)
+		if def < 0 {
+			return JumpTable{}, false
+		}
+		switch d := &seq[def]; d.Op {
+		default:
+			return JumpTable{}, false
+
+		case x86asm.MOV:
+			m, ok := d.Args[1].(x86asm.Mem)
+			if !ok {
+				return JumpTable{}, false
+			}
+			mem, memInst = m, def
+
+		case x86asm.ADD:
+			base, ok := d.Args[1].(x86asm.Reg)
+			if !ok {
+				return JumpTable{}, false
+			}
+			load := seq.regDef(def, arg)
+			if load < 0 || seq[load].Op != x86asm.MOVSXD {
+				return JumpTable{}, false
+			}
+			m, ok := seq[load].Args[1].(x86asm.Mem)
+			if !ok || x86RegFamily(m.Base) != x86RegFamily(base) || m.Disp != 0 {
+				return JumpTable{}, false
+			}
+			mem, memInst, relative = m, load, true
+		}
+	}
+
+	entrySize := ptrSize
+	if relative {
+		entrySize = 4
+	}
+	if mem.Index == 0 || int(mem.Scale) != entrySize || mem.Segment != 0 {
+		return JumpTable{}, false
+	}
+	base, ok := seq.regValue(memInst, mem.Base)
+	if !ok {
+		return JumpTable{}, false
+	}
+	t := JumpTable{PC: inst.pc, Addr: base + uint64(mem.Disp), EntrySize: entrySize}
+
+	n, bounded := seq.tableBound(i, mem.Index)
+	if !bounded {
+		n = x86MaxUnbounded
+	}
+	data := read(t.Addr, uint64(n*entrySize))
+	for off := 0; off+entrySize <= len(data) && len(t.Targets) < n; off += entrySize {
+		var target uint64
+		switch {
+		case relative:
+			target = t.Addr + uint64(int32(binary.LittleEndian.Uint32(data[off:])))
+		case entrySize == 8:
+			target = binary.LittleEndian.Uint64(data[off:])
+		default:
+			target = uint64(binary.LittleEndian.Uint32(data[off:]))
+		}
+		if target < lo || target >= hi {
+			if bounded {
+				return JumpTable{}, false
+			}
+			break
+		}
+		t.Targets = append(t.Targets, target)
+	}
+	if bounded && len(t.Targets) != n || len(t.Targets) < 2 {
+		return JumpTable{}, false
+	}
+	return t, true
+}
+
+// regDef returns the index of the last instruction before seq[i] that
+// writes register r, or -1 if there's none nearby or a call
+// intervenes.
+func (seq x86Seq) regDef(i int, r x86asm.Reg) int {
+	fam := x86RegFamily(r)
+	if fam < 0 {
+		return -1
+	}
+	for j := i - 1; j >= 0 && j >= i-x86JumpTableWindow; j-- {
+		switch seq[j].Op {
+		case x86asm.CALL:
+			// Calls clobber most registers.
+			return -1
+		case x86asm.CMP, x86asm.TEST, x86asm.PUSH, x86asm.BT:
+			// These don't write their first operand.
+			continue
+		}
+		if dst, ok := seq[j].Args[0].(x86asm.Reg); ok && x86RegFamily(dst) == fam {
+			return j
+		}
+	}
+	return -1
+}
+
+// regValue returns the constant value of register r at seq[i], if
+// it's loaded by a nearby PC-relative LEA or a move of an immediate.
+// The value of register 0 (no register) is 0.
+func (seq x86Seq) regValue(i int, r x86asm.Reg) (uint64, bool) {
+	if r == 0 {
+		return 0, true
+	}
+	def := seq.regDef(i, r)
+	if def < 0 {
+		return 0, false
+	}
+	d := &seq[def]
+	switch d.Op {
+	case x86asm.LEA:
+		m, ok := d.Args[1].(x86asm.Mem)
+		if ok && (m.Base == x86asm.RIP || m.Base == x86asm.EIP) && m.Index == 0 {
+			return d.pc + uint64(d.Inst.Len) + uint64(m.Disp), true
+		}
+	case x86asm.MOV:
+		if imm, ok := d.Args[1].(x86asm.Imm); ok {
+			return uint64(imm), true
+		}
+	}
+	return 0, false
+}
+
+// tableBound returns the number of entries in the table indexed by
+// register index in the indirect jump seq[i], from a preceding
+// bounds check.
+func (seq x86Seq) tableBound(i int, index x86asm.Reg) (int, bool) {
+	fam := x86RegFamily(index)
+	for j := i - 1; j > 0 && j >= i-x86JumpTableWindow; j-- {
+		if seq[j].Op != x86asm.JA && seq[j].Op != x86asm.JAE {
+			continue
+		}
+		cmp := &seq[j-1]
+		if cmp.Op != x86asm.CMP {
+			return 0, false
+		}
+		r, ok1 := cmp.Args[0].(x86asm.Reg)
+		n, ok2 := cmp.Args[1].(x86asm.Imm)
+		if !ok1 || !ok2 || x86RegFamily(r) != fam || n < 0 || n >= x86MaxUnbounded {
+			return 0, false
+		}
+		if seq[j].Op == x86asm.JA {
+			n++
+		}
+		return int(n), true
+	}
+	return 0, false
+}
+
+// x86RegFamily returns the number of the general-purpose register r
+// regardless of its width, or -1 if r isn't a 16-, 32-, or 64-bit
+// general-purpose register.
+func x86RegFamily(r x86asm.Reg) int {
+	switch {
+	case x86asm.AX <= r && r <= x86asm.R15W:
+		return int(r - x86asm.AX)
+	case x86asm.EAX <= r && r <= x86asm.R15L:
+		return int(r - x86asm.EAX)
+	case x86asm.RAX <= r && r <= x86asm.R15:
+		return int(r - x86asm.RAX)
+	}
+	return -1
+}
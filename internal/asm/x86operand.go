@@ -0,0 +1,245 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package asm
+
+import "golang.org/x/arch/x86/x86asm"
+
+// nargs returns the number of operands of i.
+func (i *x86Inst) nargs() int {
+	n := 0
+	for n < len(i.Args) && i.Args[n] != nil {
+		n++
+	}
+	return n
+}
+
+func (i *x86Inst) operands() []Operand {
+	if i.Op == 0 {
+		return nil
+	}
+	n := i.nargs()
+	next := i.pc + uint64(i.Inst.Len)
+	out := make([]Operand, n)
+	for j, arg := range i.Args[:n] {
+		// GoSyntax reverses the operands.
+		o := &out[n-1-j]
+		switch arg := arg.(type) {
+		case x86asm.Reg:
+			o.Kind, o.Reg = OperandReg, i.regName(arg)
+		case x86asm.Mem:
+			o.Kind, o.Disp, o.Scale = OperandMem, arg.Disp, int(arg.Scale)
+			if arg.Base == x86asm.RIP || arg.Base == x86asm.EIP {
+				o.PCRel, o.Value = true, next+uint64(arg.Disp)
+			} else if arg.Base != 0 {
+				o.Reg = i.regName(arg.Base)
+			}
+			if arg.Index != 0 {
+				o.Index = i.regName(arg.Index)
+			}
+		case x86asm.Imm:
+			o.Kind, o.Value = OperandImm, uint64(arg)
+		case x86asm.Rel:
+			o.Kind, o.Value = OperandRel, next+uint64(int64(arg))
+		}
+	}
+	return out
+}
+
+// regName returns the name of the full-width register containing r,
+// or r's own name if it isn't a general-purpose register.
+func (i *x86Inst) regName(r x86asm.Reg) string {
+	fam := x86RegFamily(r)
+	switch {
+	case x86asm.AH <= r && r <= x86asm.BH:
+		fam = int(r - x86asm.AH)
+	case x86asm.AL <= r && r <= x86asm.BL:
+		fam = int(r - x86asm.AL)
+	case x86asm.SPB <= r && r <= x86asm.R15B:
+		fam = int(r-x86asm.SPB) + 4
+	}
+	if fam < 0 {
+		return r.String()
+	}
+	if i.Mode == 32 {
+		return (x86asm.EAX + x86asm.Reg(fam)).String()
+	}
+	return (x86asm.RAX + x86asm.Reg(fam)).String()
+}
+
+func (i *x86Inst) argAt(off, size int) int {
+	n := i.nargs()
+	find := func(match func(arg x86asm.Arg) bool) int {
+		for j, arg := range i.Args[:n] {
+			if match(arg) {
+				return n - 1 - j
+			}
+		}
+		return -1
+	}
+	isImm := func(arg x86asm.Arg) bool {
+		_, ok := arg.(x86asm.Imm)
+		return ok
+	}
+	if i.Inst.PCRel != 0 && off == i.PCRelOff {
+		return find(func(arg x86asm.Arg) bool {
+			switch arg := arg.(type) {
+			case x86asm.Rel:
+				return true
+			case x86asm.Mem:
+				return arg.Base == x86asm.RIP || arg.Base == x86asm.EIP
+			}
+			return false
+		})
+	}
+	// Immediates are encoded last, after any displacement.
+	if off+size == i.Inst.Len {
+		if j := find(isImm); j >= 0 {
+			return j
+		}
+	}
+	if j := find(func(arg x86asm.Arg) bool {
+		_, ok := arg.(x86asm.Mem)
+		return ok
+	}); j >= 0 {
+		return j
+	}
+	return find(isImm)
+}
+
+func x86StackDepths(seq x86Seq, tables []JumpTable) map[uint64]StackDepth {
+	index := make(map[uint64]int, len(seq))
+	for i := range seq {
+		index[seq[i].pc] = i
+	}
+	targets := tableTargets(tables)
+	out := make(map[uint64]StackDepth)
+	var work []int
+	// The first path to reach an instruction determines its
+	// depth. Compiled code reaches each instruction at a single
+	// depth.
+	visit := func(pc uint64, d StackDepth) {
+		if i, ok := index[pc]; ok {
+			if _, done := out[pc]; !done {
+				out[pc] = d
+				work = append(work, i)
+			}
+		}
+	}
+	if len(seq) > 0 {
+		visit(seq[0].pc, StackDepth{HasSP: true})
+	}
+	for len(work) > 0 {
+		inst := &seq[work[len(work)-1]]
+		work = work[:len(work)-1]
+		d, ok := inst.stackStep(out[inst.pc])
+		if !ok {
+			continue
+		}
+		next := inst.pc + uint64(inst.Inst.Len)
+		c := inst.Control()
+		switch c.Type {
+		case ControlNone, ControlCall:
+			visit(next, d)
+		case ControlJump, ControlJumpUnknown:
+			if c.Type == ControlJump {
+				visit(c.TargetPC, d)
+			}
+			for _, pc := range targets[inst.pc] {
+				visit(pc, d)
+			}
+			if c.Conditional {
+				visit(next, d)
+			}
+		}
+	}
+	return out
+}
+
+// stackStep returns the stack depth after inst given the depth d
+// before it, or false if neither the stack nor the frame pointer is
+// known after it.
+func (i *x86Inst) stackStep(d StackDepth) (StackDepth, bool) {
+	if i.Op == 0 {
+		return d, false
+	}
+	ptr := int64(i.Mode / 8)
+	size := ptr
+	if i.DataSize == 16 {
+		size = 2
+	}
+	n := i.nargs()
+	fam := func(j int) int {
+		if j < n {
+			if r, ok := i.Args[j].(x86asm.Reg); ok {
+				return x86RegFamily(r)
+			}
+		}
+		return -1
+	}
+	const sp, bp = 4, 5
+	switch i.Op {
+	case x86asm.PUSH:
+		d.SP += size
+		return d, d.HasSP || d.HasFP
+	case x86asm.PUSHF, x86asm.PUSHFD, x86asm.PUSHFQ:
+		d.SP += ptr
+		return d, d.HasSP || d.HasFP
+	case x86asm.POPF, x86asm.POPFD, x86asm.POPFQ:
+		d.SP -= ptr
+		return d, d.HasSP || d.HasFP
+	case x86asm.POP:
+		d.SP -= size
+		switch fam(0) {
+		case sp:
+			d.HasSP = false
+		case bp:
+			// Restoring the caller's frame pointer.
+			d.HasFP = false
+		}
+		return d, d.HasSP || d.HasFP
+	case x86asm.LEAVE:
+		d.SP, d.HasSP, d.HasFP = d.FP-ptr, d.HasFP, false
+		return d, d.HasSP
+	}
+	if x86NoRegWrites[i.Op] {
+		return d, true
+	}
+
+	var src x86asm.Arg
+	if n > 1 {
+		src = i.Args[1]
+	}
+	switch fam(0) {
+	case sp:
+		imm, isImm := src.(x86asm.Imm)
+		m, isMem := src.(x86asm.Mem)
+		switch {
+		case i.Op == x86asm.SUB && isImm:
+			d.SP += int64(imm)
+		case i.Op == x86asm.ADD && isImm:
+			d.SP -= int64(imm)
+		case i.Op == x86asm.LEA && isMem && m.Index == 0 && x86RegFamily(m.Base) == sp:
+			d.SP -= m.Disp
+		case i.Op == x86asm.LEA && isMem && m.Index == 0 && x86RegFamily(m.Base) == bp && d.HasFP:
+			d.SP, d.HasSP = d.FP-m.Disp, true
+		case i.Op == x86asm.MOV && fam(1) == bp && d.HasFP:
+			d.SP, d.HasSP = d.FP, true
+		default:
+			// Such as aligning the stack.
+			d.HasSP = false
+		}
+	case bp:
+		m, isMem := src.(x86asm.Mem)
+		switch {
+		case i.Op == x86asm.MOV && fam(1) == sp && d.HasSP:
+			d.FP, d.HasFP = d.SP, true
+		case i.Op == x86asm.LEA && isMem && m.Index == 0 && x86RegFamily(m.Base) == sp && d.HasSP:
+			d.FP, d.HasFP = d.SP-m.Disp, true
+		default:
+			d.HasFP = false
+		}
+	}
+	return d, d.HasSP || d.HasFP
+}
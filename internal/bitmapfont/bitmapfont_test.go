@@ -0,0 +1,77 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bitmapfont
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestGlyphs(t *testing.T) {
+	if len(glyphs) != '~'-' '+1 {
+		t.Fatalf("have %d glyphs, want %d", len(glyphs), '~'-' '+1)
+	}
+	seen := make(map[[GlyphWidth]byte]rune)
+	for r := ' '; r <= '~'; r++ {
+		g := Glyph(r)
+		if r == ' ' {
+			if g != ([GlyphWidth]byte{}) {
+				t.Errorf("space is not blank")
+			}
+			continue
+		}
+		if g == box {
+			t.Errorf("%q is drawn as a box", r)
+		}
+		// Letters that look identical can't be told apart.
+		if prev, ok := seen[g]; ok {
+			t.Errorf("%q has the same glyph as %q", r, prev)
+		}
+		seen[g] = r
+	}
+	for _, r := range []rune{'\t', 0x7f, 'é', '→'} {
+		if Glyph(r) != box {
+			t.Errorf("%q is not drawn as a box", r)
+		}
+	}
+}
+
+// render draws s and returns it as text art.
+func render(s string, scale int) string {
+	img := image.NewGray(image.Rect(0, 0, len(s)*Advance*scale, LineHeight*scale))
+	Draw(img, 0, 0, scale, s, color.White)
+	var buf strings.Builder
+	for y := 0; y < img.Bounds().Dy(); y++ {
+		for x := 0; x < img.Bounds().Dx(); x++ {
+			if img.GrayAt(x, y).Y != 0 {
+				buf.WriteByte('#')
+			} else {
+				buf.WriteByte('.')
+			}
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.String()
+}
+
+func TestDraw(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 100, LineHeight))
+	if x := Draw(img, 3, 0, 1, "ab", color.White); x != 3+2*Advance {
+		t.Errorf("Draw returned x=%d, want %d", x, 3+2*Advance)
+	}
+
+	// "I" is a vertical bar with serifs in columns 1 through 3,
+	// doubled by the scale.
+	got := render("I", 2)
+	lines := strings.Split(got, "\n")
+	if len(lines) != LineHeight*2+1 || len(lines[0]) != Advance*2 {
+		t.Fatalf("rendering of I has the wrong size:\n%s", got)
+	}
+	if lines[0] != "..######...." || lines[2] != "....##......" || lines[12] != "..######...." || lines[14] != "............" {
+		t.Errorf("bad rendering of I at scale 2:\n%s", got)
+	}
+}
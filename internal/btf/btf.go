@@ -0,0 +1,478 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package btf decodes the BPF Type Format, the compact type
+// information Linux kernels carry in their .BTF section and export at
+// /sys/kernel/btf/vmlinux.
+//
+// Types are returned as debug/dwarf types, so code that displays
+// DWARF types can display BTF types as well.
+package btf
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"encoding/binary"
+	"fmt"
+	"sync"
+)
+
+// A TypeID identifies a type in a Spec. ID 0 is void.
+type TypeID uint32
+
+// A Kind is the kind of a BTF type.
+type Kind uint8
+
+const (
+	KindVoid Kind = iota
+	KindInt
+	KindPtr
+	KindArray
+	KindStruct
+	KindUnion
+	KindEnum
+	KindFwd
+	KindTypedef
+	KindVolatile
+	KindConst
+	KindRestrict
+	KindFunc
+	KindFuncProto
+	KindVar
+	KindDatasec
+	KindFloat
+	KindDeclTag
+	KindTypeTag
+	KindEnum64
+)
+
+var kindNames = [...]string{
+	"void", "int", "ptr", "array", "struct", "union", "enum", "fwd",
+	"typedef", "volatile", "const", "restrict", "func", "func_proto",
+	"var", "datasec", "float", "decl_tag", "type_tag", "enum64",
+}
+
+func (k Kind) String() string {
+	if int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return fmt.Sprintf("kind%d", k)
+}
+
+// A Spec is a decoded set of BTF types.
+type Spec struct {
+	// PtrSize is the size of pointers. BTF doesn't record it, so
+	// Parse infers it from the size of "long".
+	PtrSize int
+
+	order  binary.ByteOrder
+	strs   []byte
+	types  []rawType // Indexed by TypeID
+	byName map[string][]TypeID
+
+	mu   sync.Mutex
+	conv map[TypeID]dwarf.Type
+}
+
+// rawType is a struct btf_type and the kind-specific data after it.
+type rawType struct {
+	name     uint32
+	info     uint32
+	sizeType uint32
+	data     []byte
+}
+
+func (t *rawType) kind() Kind     { return Kind(t.info >> 24 & 0x1f) }
+func (t *rawType) vlen() int      { return int(t.info & 0xffff) }
+func (t *rawType) kindFlag() bool { return t.info>>31 != 0 }
+
+const magic = 0xeb9f
+
+// A FormatError reports malformed BTF.
+type FormatError struct {
+	Off int
+	Msg string
+}
+
+func (e *FormatError) Error() string {
+	return fmt.Sprintf("btf: %s at offset %#x", e.Msg, e.Off)
+}
+
+// Parse decodes BTF data, such as the contents of a .BTF section.
+func Parse(data []byte) (*Spec, error) {
+	if len(data) < 24 {
+		return nil, &FormatError{0, "truncated header"}
+	}
+	var order binary.ByteOrder
+	switch {
+	case binary.LittleEndian.Uint16(data) == magic:
+		order = binary.LittleEndian
+	case binary.BigEndian.Uint16(data) == magic:
+		order = binary.BigEndian
+	default:
+		return nil, &FormatError{0, "bad magic"}
+	}
+	hdrLen := order.Uint32(data[4:])
+	typeOff, typeLen := order.Uint32(data[8:]), order.Uint32(data[12:])
+	strOff, strLen := order.Uint32(data[16:]), order.Uint32(data[20:])
+	section := func(off, n uint32, what string) ([]byte, error) {
+		start, end := uint64(hdrLen)+uint64(off), uint64(hdrLen)+uint64(off)+uint64(n)
+		if end > uint64(len(data)) {
+			return nil, &FormatError{int(start), what + " section out of bounds"}
+		}
+		return data[start:end], nil
+	}
+	tdata, err := section(typeOff, typeLen, "type")
+	if err != nil {
+		return nil, err
+	}
+	s := &Spec{order: order, types: []rawType{{}}, byName: make(map[string][]TypeID), conv: make(map[TypeID]dwarf.Type)}
+	if s.strs, err = section(strOff, strLen, "string"); err != nil {
+		return nil, err
+	}
+
+	for off := 0; off < len(tdata); {
+		if off+12 > len(tdata) {
+			return nil, &FormatError{off, "truncated type"}
+		}
+		t := rawType{name: order.Uint32(tdata[off:]), info: order.Uint32(tdata[off+4:]), sizeType: order.Uint32(tdata[off+8:])}
+		n, ok := t.dataSize()
+		if !ok {
+			return nil, &FormatError{off, fmt.Sprintf("unknown kind %d", t.kind())}
+		}
+		if off+12+n > len(tdata) {
+			return nil, &FormatError{off, "truncated type"}
+		}
+		t.data = tdata[off+12 : off+12+n]
+		id := TypeID(len(s.types))
+		s.types = append(s.types, t)
+		if name := s.str(t.name); name != "" {
+			s.byName[name] = append(s.byName[name], id)
+		}
+		off += 12 + n
+	}
+
+	s.PtrSize = 8
+	for _, id := range s.byName["long int"] {
+		if t := &s.types[id]; t.kind() == KindInt {
+			s.PtrSize = int(t.sizeType)
+		}
+	}
+	return s, nil
+}
+
+// dataSize returns the size of the kind-specific data following t.
+func (t *rawType) dataSize() (int, bool) {
+	switch t.kind() {
+	case KindInt, KindVar, KindDeclTag:
+		return 4, true
+	case KindPtr, KindFwd, KindTypedef, KindVolatile, KindConst, KindRestrict, KindFunc, KindFloat, KindTypeTag:
+		return 0, true
+	case KindArray:
+		return 12, true
+	case KindStruct, KindUnion, KindDatasec, KindEnum64:
+		return 12 * t.vlen(), true
+	case KindEnum, KindFuncProto:
+		return 8 * t.vlen(), true
+	}
+	return 0, false
+}
+
+// str returns the string at off in the string section.
+func (s *Spec) str(off uint32) string {
+	if int(off) >= len(s.strs) {
+		return ""
+	}
+	b := s.strs[off:]
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+func (s *Spec) u32(b []byte, i int) uint32 { return s.order.Uint32(b[4*i:]) }
+
+// NumTypes returns the number of type IDs, including void.
+func (s *Spec) NumTypes() int {
+	return len(s.types)
+}
+
+// Kind returns the kind of type id.
+func (s *Spec) Kind(id TypeID) Kind {
+	if int(id) >= len(s.types) {
+		return KindVoid
+	}
+	return s.types[id].kind()
+}
+
+// Name returns the name of type id, which doesn't include a "struct"
+// or similar prefix. Many types have no name.
+func (s *Spec) Name(id TypeID) string {
+	if int(id) >= len(s.types) {
+		return ""
+	}
+	return s.str(s.types[id].name)
+}
+
+// Lookup returns the types named name, of any kind.
+func (s *Spec) Lookup(name string) []TypeID {
+	return s.byName[name]
+}
+
+// A Var is a variable described by a DATASEC.
+type Var struct {
+	Name string
+	// Type is the variable's type.
+	Type TypeID
+	// Section is the name of the section containing the
+	// variable, and Offset is its offset in the section.
+	Section string
+	Offset  uint32
+	Size    uint32
+}
+
+// Vars returns the variables listed by the DATASECs.
+func (s *Spec) Vars() []Var {
+	var vars []Var
+	for _, t := range s.types {
+		if t.kind() != KindDatasec {
+			continue
+		}
+		for i := 0; i < t.vlen(); i++ {
+			vid := TypeID(s.u32(t.data, 3*i))
+			if int(vid) >= len(s.types) || s.types[vid].kind() != KindVar {
+				continue
+			}
+			v := &s.types[vid]
+			vars = append(vars, Var{s.str(v.name), TypeID(v.sizeType), s.str(t.name), s.u32(t.data, 3*i+1), s.u32(t.data, 3*i+2)})
+		}
+	}
+	return vars
+}
+
+// size returns the size in bytes of type id, or -1 if it has none.
+func (s *Spec) size(id TypeID) int64 {
+	// Bound the chain of references in case it loops.
+	for n := 0; n < len(s.types); n++ {
+		if int(id) >= len(s.types) {
+			return -1
+		}
+		t := &s.types[id]
+		switch t.kind() {
+		case KindInt, KindStruct, KindUnion, KindEnum, KindEnum64, KindFloat, KindDatasec:
+			return int64(t.sizeType)
+		case KindPtr:
+			return int64(s.PtrSize)
+		case KindArray:
+			elem := s.size(TypeID(s.u32(t.data, 0)))
+			if elem < 0 {
+				return -1
+			}
+			return elem * int64(s.u32(t.data, 2))
+		case KindTypedef, KindVolatile, KindConst, KindRestrict, KindTypeTag, KindVar:
+			id = TypeID(t.sizeType)
+		default:
+			return -1
+		}
+	}
+	return -1
+}
+
+// Type returns type id as a DWARF type. Struct, union, and enum types
+// are named like their DWARF counterparts. Variables return their
+// type.
+func (s *Spec) Type(id TypeID) (dwarf.Type, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.convert(id)
+}
+
+func (s *Spec) convert(id TypeID) (dwarf.Type, error) {
+	if t, ok := s.conv[id]; ok {
+		return t, nil
+	}
+	if int(id) >= len(s.types) {
+		return nil, fmt.Errorf("btf: type ID %d out of range", id)
+	}
+	if id == 0 {
+		t := &dwarf.VoidType{}
+		s.conv[id] = t
+		return t, nil
+	}
+	raw := &s.types[id]
+	name := s.str(raw.name)
+	common := dwarf.CommonType{ByteSize: s.size(id), Name: name}
+	ref := TypeID(raw.sizeType)
+
+	// Record composite types before converting their parts, so
+	// cycles through them terminate.
+	switch raw.kind() {
+	case KindInt:
+		enc := s.u32(raw.data, 0)
+		bits := enc & 0xff
+		basic := dwarf.BasicType{CommonType: common, BitOffset: int64(enc >> 16 & 0xff)}
+		if int64(bits) != 8*common.ByteSize {
+			basic.BitSize = int64(bits)
+		}
+		const signed, char, boolean = 1, 2, 4
+		var t dwarf.Type
+		switch e := enc >> 24 & 0xf; {
+		case e&boolean != 0:
+			t = &dwarf.BoolType{BasicType: basic}
+		case e&char != 0 && e&signed != 0:
+			t = &dwarf.CharType{BasicType: basic}
+		case e&char != 0:
+			t = &dwarf.UcharType{BasicType: basic}
+		case e&signed != 0:
+			t = &dwarf.IntType{BasicType: basic}
+		default:
+			t = &dwarf.UintType{BasicType: basic}
+		}
+		s.conv[id] = t
+
+	case KindFloat:
+		s.conv[id] = &dwarf.FloatType{BasicType: dwarf.BasicType{CommonType: common}}
+
+	case KindPtr:
+		t := &dwarf.PtrType{CommonType: common}
+		s.conv[id] = t
+		elem, err := s.convert(ref)
+		if err != nil {
+			return nil, err
+		}
+		t.Type = elem
+
+	case KindArray:
+		t := &dwarf.ArrayType{CommonType: common, Count: int64(s.u32(raw.data, 2))}
+		s.conv[id] = t
+		elem, err := s.convert(TypeID(s.u32(raw.data, 0)))
+		if err != nil {
+			return nil, err
+		}
+		t.Type = elem
+
+	case KindStruct, KindUnion:
+		t := &dwarf.StructType{CommonType: common, StructName: name, Kind: "struct"}
+		if raw.kind() == KindUnion {
+			t.Kind = "union"
+		}
+		s.conv[id] = t
+		for i := 0; i < raw.vlen(); i++ {
+			fid := TypeID(s.u32(raw.data, 3*i+1))
+			ftype, err := s.convert(fid)
+			if err != nil {
+				return nil, err
+			}
+			// ftype may be part of a cycle and incomplete,
+			// so get its size from the raw types.
+			fsize := s.size(fid)
+			off := s.u32(raw.data, 3*i+2)
+			f := &dwarf.StructField{Name: s.str(s.u32(raw.data, 3*i)), Type: ftype}
+			if raw.kindFlag() {
+				// The offset packs the bitfield size
+				// over the bit offset.
+				f.BitSize = int64(off >> 24)
+				off &= 0xffffff
+			}
+			f.ByteOffset = int64(off / 8)
+			if f.BitSize == 0 && off%8 != 0 {
+				f.BitSize = fsize * 8
+			}
+			f.ByteSize = fsize
+			t.Field = append(t.Field, f)
+		}
+
+	case KindDatasec:
+		// Show the variables of a section as its fields.
+		t := &dwarf.StructType{CommonType: common, StructName: name, Kind: "section"}
+		s.conv[id] = t
+		for i := 0; i < raw.vlen(); i++ {
+			vid := TypeID(s.u32(raw.data, 3*i))
+			vtype, err := s.convert(vid)
+			if err != nil {
+				return nil, err
+			}
+			t.Field = append(t.Field, &dwarf.StructField{Name: s.Name(vid), Type: vtype,
+				ByteOffset: int64(s.u32(raw.data, 3*i+1)), ByteSize: int64(s.u32(raw.data, 3*i+2))})
+		}
+
+	case KindEnum, KindEnum64:
+		t := &dwarf.EnumType{CommonType: common, EnumName: name}
+		for i := 0; i < raw.vlen(); i++ {
+			v := &dwarf.EnumValue{}
+			if raw.kind() == KindEnum {
+				v.Name = s.str(s.u32(raw.data, 2*i))
+				v.Val = int64(int32(s.u32(raw.data, 2*i+1)))
+			} else {
+				v.Name = s.str(s.u32(raw.data, 3*i))
+				v.Val = int64(uint64(s.u32(raw.data, 3*i+2))<<32 | uint64(s.u32(raw.data, 3*i+1)))
+			}
+			t.Val = append(t.Val, v)
+		}
+		s.conv[id] = t
+
+	case KindFwd:
+		t := &dwarf.StructType{CommonType: dwarf.CommonType{Name: name}, StructName: name, Kind: "struct", Incomplete: true}
+		if raw.kindFlag() {
+			t.Kind = "union"
+		}
+		s.conv[id] = t
+
+	case KindTypedef:
+		t := &dwarf.TypedefType{CommonType: common}
+		s.conv[id] = t
+		under, err := s.convert(ref)
+		if err != nil {
+			return nil, err
+		}
+		t.Type = under
+
+	case KindVolatile, KindConst, KindRestrict:
+		t := &dwarf.QualType{CommonType: common, Qual: raw.kind().String()}
+		s.conv[id] = t
+		under, err := s.convert(ref)
+		if err != nil {
+			return nil, err
+		}
+		t.Type = under
+
+	case KindFuncProto:
+		t := &dwarf.FuncType{CommonType: common}
+		s.conv[id] = t
+		ret, err := s.convert(ref)
+		if err != nil {
+			return nil, err
+		}
+		t.ReturnType = ret
+		for i := 0; i < raw.vlen(); i++ {
+			pid := TypeID(s.u32(raw.data, 2*i+1))
+			if pid == 0 {
+				// A trailing void parameter means
+				// variadic.
+				t.ParamType = append(t.ParamType, &dwarf.DotDotDotType{})
+				continue
+			}
+			pt, err := s.convert(pid)
+			if err != nil {
+				return nil, err
+			}
+			t.ParamType = append(t.ParamType, pt)
+		}
+
+	case KindFunc, KindVar, KindTypeTag, KindDeclTag:
+		// These aren't types of their own, so return the
+		// type they refer to. Mark id first in case it's part
+		// of a loop.
+		s.conv[id] = &dwarf.VoidType{}
+		t, err := s.convert(ref)
+		if err != nil {
+			return nil, err
+		}
+		s.conv[id] = t
+
+	default:
+		return nil, fmt.Errorf("btf: type %d has unknown kind %d", id, raw.kind())
+	}
+	return s.conv[id], nil
+}
@@ -0,0 +1,194 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package btf
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"encoding/binary"
+	"io/ioutil"
+	"testing"
+)
+
+// builder assembles BTF data for tests.
+type builder struct {
+	types bytes.Buffer
+	strs  bytes.Buffer
+}
+
+func newBuilder() *builder {
+	b := &builder{}
+	b.strs.WriteByte(0)
+	return b
+}
+
+func (b *builder) str(s string) uint32 {
+	if s == "" {
+		return 0
+	}
+	off := uint32(b.strs.Len())
+	b.strs.WriteString(s)
+	b.strs.WriteByte(0)
+	return off
+}
+
+func (b *builder) u32(xs ...uint32) {
+	for _, x := range xs {
+		binary.Write(&b.types, binary.LittleEndian, x)
+	}
+}
+
+func (b *builder) typ(name string, kind Kind, vlen int, kindFlag bool, sizeType uint32) {
+	info := uint32(kind)<<24 | uint32(vlen)
+	if kindFlag {
+		info |= 1 << 31
+	}
+	b.u32(b.str(name), info, sizeType)
+}
+
+func (b *builder) bytes() []byte {
+	var out bytes.Buffer
+	hdr := []interface{}{uint16(magic), uint8(1), uint8(0), uint32(24),
+		uint32(0), uint32(b.types.Len()), uint32(b.types.Len()), uint32(b.strs.Len())}
+	for _, x := range hdr {
+		binary.Write(&out, binary.LittleEndian, x)
+	}
+	out.Write(b.types.Bytes())
+	out.Write(b.strs.Bytes())
+	return out.Bytes()
+}
+
+func TestParse(t *testing.T) {
+	b := newBuilder()
+	// 1: long int
+	b.typ("long int", KindInt, 0, false, 8)
+	b.u32(1<<24 | 64)
+	// 2: struct node { long int val; struct node *next; u32 flags:3; }
+	b.typ("node", KindStruct, 3, true, 24)
+	b.u32(b.str("val"), 1, 0)
+	b.u32(b.str("next"), 3, 64)
+	b.u32(b.str("flags"), 6, 3<<24|128)
+	// 3: struct node *
+	b.typ("", KindPtr, 0, false, 2)
+	// 4: enum color { RED = 1, BLUE = -1 }
+	b.typ("color", KindEnum, 2, false, 4)
+	b.u32(b.str("RED"), 1, b.str("BLUE"), 0xffffffff)
+	// 5: typedef struct node node_t
+	b.typ("node_t", KindTypedef, 0, false, 2)
+	// 6: unsigned int
+	b.typ("unsigned int", KindInt, 0, false, 4)
+	b.u32(32)
+	// 7: var head
+	b.typ("head", KindVar, 0, false, 5)
+	b.u32(1)
+	// 8: datasec .data
+	b.typ(".data", KindDatasec, 1, false, 24)
+	b.u32(7, 16, 24)
+
+	s, err := Parse(b.bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.NumTypes() != 9 {
+		t.Errorf("want 9 types, got %d", s.NumTypes())
+	}
+	if s.PtrSize != 8 {
+		t.Errorf("want pointer size 8, got %d", s.PtrSize)
+	}
+	if ids := s.Lookup("node"); len(ids) != 1 || ids[0] != 2 || s.Kind(2) != KindStruct {
+		t.Errorf("Lookup(node) = %v", ids)
+	}
+
+	typ, err := s.Type(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := typ.String(); got != "node_t" {
+		t.Errorf("want node_t, got %s", got)
+	}
+	st, ok := typ.(*dwarf.TypedefType).Type.(*dwarf.StructType)
+	if !ok {
+		t.Fatalf("want struct, got %T", typ.(*dwarf.TypedefType).Type)
+	}
+	if st.Size() != 24 || len(st.Field) != 3 {
+		t.Fatalf("bad struct %s", st.Defn())
+	}
+	if next := st.Field[1]; next.ByteOffset != 8 || next.Type.(*dwarf.PtrType).Type != st {
+		t.Errorf("bad next field %+v", next)
+	}
+	if flags := st.Field[2]; flags.ByteOffset != 16 || flags.BitSize != 3 {
+		t.Errorf("bad bitfield %+v", flags)
+	}
+	if _, ok := st.Field[0].Type.(*dwarf.IntType); !ok {
+		t.Errorf("want int field, got %T", st.Field[0].Type)
+	}
+
+	enum, err := s.Type(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if et := enum.(*dwarf.EnumType); len(et.Val) != 2 || et.Val[1].Val != -1 {
+		t.Errorf("bad enum %s", et)
+	}
+
+	vars := s.Vars()
+	if len(vars) != 1 || vars[0] != (Var{"head", 5, ".data", 16, 24}) {
+		t.Errorf("bad vars %+v", vars)
+	}
+}
+
+func TestBadData(t *testing.T) {
+	good := func() *builder {
+		b := newBuilder()
+		b.typ("int", KindInt, 0, false, 4)
+		b.u32(1<<24 | 32)
+		return b
+	}
+	data := good().bytes()
+	if _, err := Parse(data); err != nil {
+		t.Fatal(err)
+	}
+	for i := range data {
+		// Parse must not panic on truncated data.
+		Parse(data[:i])
+	}
+	if _, err := Parse(data[:len(data)-1]); err == nil {
+		t.Errorf("want error for truncated strings")
+	}
+
+	b := good()
+	b.typ("bad", 31, 0, false, 0)
+	if _, err := Parse(b.bytes()); err == nil {
+		t.Errorf("want error for unknown kind")
+	}
+}
+
+func TestVmlinux(t *testing.T) {
+	data, err := ioutil.ReadFile("/sys/kernel/btf/vmlinux")
+	if err != nil {
+		t.Skip(err)
+	}
+	s, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, id := range s.Lookup("task_struct") {
+		if s.Kind(id) != KindStruct {
+			continue
+		}
+		found = true
+		typ, err := s.Type(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if typ.Size() <= 0 || len(typ.(*dwarf.StructType).Field) == 0 {
+			t.Errorf("bad task_struct: %s", typ)
+		}
+	}
+	if !found {
+		t.Errorf("no struct task_struct")
+	}
+}
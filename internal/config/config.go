@@ -0,0 +1,239 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package config parses objbrowse configuration files.
+//
+// Configuration files use a subset of TOML: "key = value" pairs,
+// "[table]" headers, and "#" comments. Values may be basic or literal
+// strings, booleans, integers, or arrays of these, and arrays may
+// span lines. Keys under a table are qualified with the table name,
+// as in "table.key".
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A Setting is a single key and its value from a configuration file.
+type Setting struct {
+	Key string
+	// Values is the value of the setting, formatted as strings.
+	// It has one element unless the value is an array.
+	Values []string
+	// IsArray indicates the value was an array.
+	IsArray bool
+	// Line is the line number of the key.
+	Line int
+}
+
+// An Error is a syntax error in a configuration file.
+type Error struct {
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// Parse parses a configuration file and returns its settings in
+// order.
+func Parse(data []byte) ([]Setting, error) {
+	var settings []Setting
+	seen := make(map[string]bool)
+	table := ""
+	lines := strings.Split(string(data), "\n")
+	for i := 0; i < len(lines); i++ {
+		lineNo := i + 1
+		line := strings.TrimSpace(stripComment(lines[i]))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") || strings.HasPrefix(line, "[[") {
+				return nil, &Error{lineNo, "malformed table header"}
+			}
+			table = strings.TrimSpace(line[1 : len(line)-1])
+			if !validKey(table) {
+				return nil, &Error{lineNo, fmt.Sprintf("bad table name %q", table)}
+			}
+			continue
+		}
+
+		eq := strings.IndexByte(line, '=')
+		if eq < 0 {
+			return nil, &Error{lineNo, "expected key = value"}
+		}
+		key := strings.TrimSpace(line[:eq])
+		if !validKey(key) {
+			return nil, &Error{lineNo, fmt.Sprintf("bad key %q", key)}
+		}
+		if table != "" {
+			key = table + "." + key
+		}
+		if seen[key] {
+			return nil, &Error{lineNo, fmt.Sprintf("duplicate key %q", key)}
+		}
+		seen[key] = true
+
+		val := strings.TrimSpace(line[eq+1:])
+		// Arrays may continue on following lines.
+		for strings.HasPrefix(val, "[") && !closedArray(val) && i+1 < len(lines) {
+			i++
+			val += " " + strings.TrimSpace(stripComment(lines[i]))
+		}
+		s := Setting{Key: key, Line: lineNo}
+		var err error
+		if strings.HasPrefix(val, "[") {
+			s.IsArray = true
+			s.Values, err = parseArray(val)
+		} else {
+			var v string
+			v, err = parseScalar(val)
+			s.Values = []string{v}
+		}
+		if err != nil {
+			return nil, &Error{lineNo, err.Error()}
+		}
+		settings = append(settings, s)
+	}
+	return settings, nil
+}
+
+func validKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, c := range key {
+		if !(c == '-' || c == '_' || c == '.' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// stripComment removes a trailing "#" comment from line, ignoring
+// "#" inside strings.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// closedArray reports whether val contains a complete array.
+func closedArray(val string) bool {
+	_, err := parseArray(val)
+	return err == nil || !strings.Contains(err.Error(), "unterminated")
+}
+
+func parseArray(val string) ([]string, error) {
+	rest := strings.TrimSpace(val[1:])
+	values := []string{}
+	for {
+		if rest == "" {
+			return nil, fmt.Errorf("unterminated array")
+		}
+		if rest[0] == ']' {
+			if strings.TrimSpace(rest[1:]) != "" {
+				return nil, fmt.Errorf("unexpected text after array")
+			}
+			return values, nil
+		}
+		elem, n, err := scanScalar(rest)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, elem)
+		rest = strings.TrimSpace(rest[n:])
+		if strings.HasPrefix(rest, ",") {
+			rest = strings.TrimSpace(rest[1:])
+		} else if !strings.HasPrefix(rest, "]") {
+			if rest == "" {
+				return nil, fmt.Errorf("unterminated array")
+			}
+			return nil, fmt.Errorf("expected , or ] in array")
+		}
+	}
+}
+
+func parseScalar(val string) (string, error) {
+	v, n, err := scanScalar(val)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(val[n:]) != "" {
+		return "", fmt.Errorf("unexpected text after value")
+	}
+	return v, nil
+}
+
+// scanScalar parses the string, boolean, or integer at the start of
+// s and returns its value and length.
+func scanScalar(s string) (string, int, error) {
+	if s == "" {
+		return "", 0, fmt.Errorf("missing value")
+	}
+	switch s[0] {
+	case '"':
+		var b strings.Builder
+		for i := 1; i < len(s); i++ {
+			switch c := s[i]; c {
+			case '"':
+				return b.String(), i + 1, nil
+			case '\\':
+				i++
+				if i == len(s) {
+					break
+				}
+				switch s[i] {
+				case 'n':
+					b.WriteByte('\n')
+				case 't':
+					b.WriteByte('\t')
+				case '"', '\\':
+					b.WriteByte(s[i])
+				default:
+					return "", 0, fmt.Errorf("unknown escape \\%c", s[i])
+				}
+			default:
+				b.WriteByte(c)
+			}
+		}
+		return "", 0, fmt.Errorf("unterminated string")
+	case '\'':
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return "", 0, fmt.Errorf("unterminated string")
+		}
+		return s[1 : 1+end], end + 2, nil
+	}
+	n := 0
+	for n < len(s) && s[n] != ',' && s[n] != ']' && s[n] != ' ' && s[n] != '\t' {
+		n++
+	}
+	word := s[:n]
+	if word == "true" || word == "false" {
+		return word, n, nil
+	}
+	if _, err := strconv.ParseInt(strings.Replace(word, "_", "", -1), 0, 64); err == nil && word != "" {
+		return strings.Replace(word, "_", "", -1), n, nil
+	}
+	return "", 0, fmt.Errorf("bad value %q", word)
+}
@@ -0,0 +1,67 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	const input = `
+# Defaults for objbrowse.
+http = "localhost:8080"   # trailing comment
+watch = true
+n = 1_000
+source-root = [
+	"/src/a",  # first
+	'/src/#b',
+]
+
+[view]
+syntax = "att"
+empty = []
+`
+	got, err := Parse([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Setting{
+		{Key: "http", Values: []string{"localhost:8080"}, Line: 3},
+		{Key: "watch", Values: []string{"true"}, Line: 4},
+		{Key: "n", Values: []string{"1000"}, Line: 5},
+		{Key: "source-root", Values: []string{"/src/a", "/src/#b"}, IsArray: true, Line: 6},
+		{Key: "view.syntax", Values: []string{"att"}, Line: 12},
+		{Key: "view.empty", Values: []string{}, IsArray: true, Line: 13},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, test := range []struct {
+		input string
+		line  int
+	}{
+		{"x", 1},
+		{"x = ", 1},
+		{"\nx = \"abc", 2},
+		{"x = 1\nx = 2", 2},
+		{"x = [1, 2", 1},
+		{"x = yes", 1},
+		{"[t", 1},
+		{"x = \"a\" b", 1},
+	} {
+		_, err := Parse([]byte(test.input))
+		if err == nil {
+			t.Errorf("%q: want error", test.input)
+			continue
+		}
+		if e, ok := err.(*Error); !ok || e.Line != test.line {
+			t.Errorf("%q: got %v, want error on line %d", test.input, err, test.line)
+		}
+	}
+}
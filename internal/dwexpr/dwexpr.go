@@ -0,0 +1,491 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package dwexpr decodes, formats, and evaluates DWARF expressions
+// (sequences of DW_OP operations) and reads DWARF location lists.
+package dwexpr
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// An Encoding describes how operands in an expression are encoded.
+type Encoding struct {
+	// PtrSize is the size of a target address.
+	PtrSize int
+	// OffSize is the size of a section offset: 4 for 32-bit DWARF
+	// or 8 for 64-bit DWARF.
+	OffSize int
+	Order   binary.ByteOrder
+}
+
+// An Opcode is a DW_OP operation code.
+type Opcode uint8
+
+// Operation codes. Operations without special handling appear only
+// in opInfo.
+const (
+	opAddr          Opcode = 0x03
+	opDeref         Opcode = 0x06
+	opConst1u       Opcode = 0x08
+	opConst8s       Opcode = 0x0f
+	opConstu        Opcode = 0x10
+	opConsts        Opcode = 0x11
+	opDup           Opcode = 0x12
+	opDrop          Opcode = 0x13
+	opOver          Opcode = 0x14
+	opPick          Opcode = 0x15
+	opSwap          Opcode = 0x16
+	opRot           Opcode = 0x17
+	opAbs           Opcode = 0x19
+	opAnd           Opcode = 0x1a
+	opDiv           Opcode = 0x1b
+	opMinus         Opcode = 0x1c
+	opMod           Opcode = 0x1d
+	opMul           Opcode = 0x1e
+	opNeg           Opcode = 0x1f
+	opNot           Opcode = 0x20
+	opOr            Opcode = 0x21
+	opPlus          Opcode = 0x22
+	opPlusUconst    Opcode = 0x23
+	opShl           Opcode = 0x24
+	opShr           Opcode = 0x25
+	opShra          Opcode = 0x26
+	opXor           Opcode = 0x27
+	opBra           Opcode = 0x28
+	opEq            Opcode = 0x29
+	opGe            Opcode = 0x2a
+	opGt            Opcode = 0x2b
+	opLe            Opcode = 0x2c
+	opLt            Opcode = 0x2d
+	opNe            Opcode = 0x2e
+	opSkip          Opcode = 0x2f
+	opLit0          Opcode = 0x30
+	opLit31         Opcode = 0x4f
+	opReg0          Opcode = 0x50
+	opReg31         Opcode = 0x6f
+	opBreg0         Opcode = 0x70
+	opBreg31        Opcode = 0x8f
+	opRegx          Opcode = 0x90
+	opFbreg         Opcode = 0x91
+	opBregx         Opcode = 0x92
+	opPiece         Opcode = 0x93
+	opDerefSize     Opcode = 0x94
+	opNop           Opcode = 0x96
+	opCallFrameCFA  Opcode = 0x9c
+	opBitPiece      Opcode = 0x9d
+	opImplicitValue Opcode = 0x9e
+	opStackValue    Opcode = 0x9f
+	opImplicitPtr   Opcode = 0xa0
+	opAddrx         Opcode = 0xa1
+	opConstx        Opcode = 0xa2
+	opEntryValue    Opcode = 0xa3
+	opConstType     Opcode = 0xa4
+	opRegvalType    Opcode = 0xa5
+	opDerefType     Opcode = 0xa6
+	opConvert       Opcode = 0xa8
+	opReinterpret   Opcode = 0xa9
+
+	opGNUImplicitPtr  Opcode = 0xf2
+	opGNUEntryValue   Opcode = 0xf3
+	opGNUConstType    Opcode = 0xf4
+	opGNURegvalType   Opcode = 0xf5
+	opGNUDerefType    Opcode = 0xf6
+	opGNUConvert      Opcode = 0xf7
+	opGNUReinterpret  Opcode = 0xf9
+	opGNUParameterRef Opcode = 0xfa
+	opGNUAddrIndex    Opcode = 0xfb
+	opGNUConstIndex   Opcode = 0xfc
+)
+
+// argKind is the encoding of an operand.
+type argKind uint8
+
+const (
+	argU8 argKind = iota
+	argS8
+	argU16
+	argS16
+	argU32
+	argS32
+	argU64
+	argS64
+	argULEB
+	argSLEB
+	argAddr
+	argRef   // section offset
+	argBlock // ULEB length followed by that many bytes
+	argBlock1
+)
+
+type opDesc struct {
+	name string
+	args []argKind
+}
+
+var opInfo = map[Opcode]opDesc{
+	opAddr:          {"addr", []argKind{argAddr}},
+	opDeref:         {"deref", nil},
+	0x08:            {"const1u", []argKind{argU8}},
+	0x09:            {"const1s", []argKind{argS8}},
+	0x0a:            {"const2u", []argKind{argU16}},
+	0x0b:            {"const2s", []argKind{argS16}},
+	0x0c:            {"const4u", []argKind{argU32}},
+	0x0d:            {"const4s", []argKind{argS32}},
+	0x0e:            {"const8u", []argKind{argU64}},
+	0x0f:            {"const8s", []argKind{argS64}},
+	opConstu:        {"constu", []argKind{argULEB}},
+	opConsts:        {"consts", []argKind{argSLEB}},
+	opDup:           {"dup", nil},
+	opDrop:          {"drop", nil},
+	opOver:          {"over", nil},
+	opPick:          {"pick", []argKind{argU8}},
+	opSwap:          {"swap", nil},
+	opRot:           {"rot", nil},
+	0x18:            {"xderef", nil},
+	opAbs:           {"abs", nil},
+	opAnd:           {"and", nil},
+	opDiv:           {"div", nil},
+	opMinus:         {"minus", nil},
+	opMod:           {"mod", nil},
+	opMul:           {"mul", nil},
+	opNeg:           {"neg", nil},
+	opNot:           {"not", nil},
+	opOr:            {"or", nil},
+	opPlus:          {"plus", nil},
+	opPlusUconst:    {"plus_uconst", []argKind{argULEB}},
+	opShl:           {"shl", nil},
+	opShr:           {"shr", nil},
+	opShra:          {"shra", nil},
+	opXor:           {"xor", nil},
+	opBra:           {"bra", []argKind{argS16}},
+	opEq:            {"eq", nil},
+	opGe:            {"ge", nil},
+	opGt:            {"gt", nil},
+	opLe:            {"le", nil},
+	opLt:            {"lt", nil},
+	opNe:            {"ne", nil},
+	opSkip:          {"skip", []argKind{argS16}},
+	opRegx:          {"regx", []argKind{argULEB}},
+	opFbreg:         {"fbreg", []argKind{argSLEB}},
+	opBregx:         {"bregx", []argKind{argULEB, argSLEB}},
+	opPiece:         {"piece", []argKind{argULEB}},
+	opDerefSize:     {"deref_size", []argKind{argU8}},
+	0x95:            {"xderef_size", []argKind{argU8}},
+	opNop:           {"nop", nil},
+	0x97:            {"push_object_address", nil},
+	0x98:            {"call2", []argKind{argU16}},
+	0x99:            {"call4", []argKind{argU32}},
+	0x9a:            {"call_ref", []argKind{argRef}},
+	0x9b:            {"form_tls_address", nil},
+	opCallFrameCFA:  {"call_frame_cfa", nil},
+	opBitPiece:      {"bit_piece", []argKind{argULEB, argULEB}},
+	opImplicitValue: {"implicit_value", []argKind{argBlock}},
+	opStackValue:    {"stack_value", nil},
+	opImplicitPtr:   {"implicit_pointer", []argKind{argRef, argSLEB}},
+	opAddrx:         {"addrx", []argKind{argULEB}},
+	opConstx:        {"constx", []argKind{argULEB}},
+	opEntryValue:    {"entry_value", []argKind{argBlock}},
+	opConstType:     {"const_type", []argKind{argULEB, argBlock1}},
+	opRegvalType:    {"regval_type", []argKind{argULEB, argULEB}},
+	opDerefType:     {"deref_type", []argKind{argU8, argULEB}},
+	0xa7:            {"xderef_type", []argKind{argU8, argULEB}},
+	opConvert:       {"convert", []argKind{argULEB}},
+	opReinterpret:   {"reinterpret", []argKind{argULEB}},
+
+	0xe0:              {"GNU_push_tls_address", nil},
+	0xf0:              {"GNU_uninit", nil},
+	opGNUImplicitPtr:  {"GNU_implicit_pointer", []argKind{argRef, argSLEB}},
+	opGNUEntryValue:   {"GNU_entry_value", []argKind{argBlock}},
+	opGNUConstType:    {"GNU_const_type", []argKind{argULEB, argBlock1}},
+	opGNURegvalType:   {"GNU_regval_type", []argKind{argULEB, argULEB}},
+	opGNUDerefType:    {"GNU_deref_type", []argKind{argU8, argULEB}},
+	opGNUConvert:      {"GNU_convert", []argKind{argULEB}},
+	opGNUReinterpret:  {"GNU_reinterpret", []argKind{argULEB}},
+	opGNUParameterRef: {"GNU_parameter_ref", []argKind{argU32}},
+	opGNUAddrIndex:    {"GNU_addr_index", []argKind{argULEB}},
+	opGNUConstIndex:   {"GNU_const_index", []argKind{argULEB}},
+	0xfd:              {"GNU_variable_value", []argKind{argRef}},
+}
+
+func init() {
+	for i := 0; i < 32; i++ {
+		opInfo[opLit0+Opcode(i)] = opDesc{fmt.Sprintf("lit%d", i), nil}
+		opInfo[opReg0+Opcode(i)] = opDesc{fmt.Sprintf("reg%d", i), nil}
+		opInfo[opBreg0+Opcode(i)] = opDesc{fmt.Sprintf("breg%d", i), []argKind{argSLEB}}
+	}
+}
+
+func (o Opcode) String() string {
+	if d, ok := opInfo[o]; ok {
+		return "DW_OP_" + d.name
+	}
+	return fmt.Sprintf("DW_OP_%#x", uint8(o))
+}
+
+// An Op is a decoded operation.
+type Op struct {
+	// Off and Len are the byte offset and encoded length of
+	// this operation in its expression.
+	Off, Len int
+	Code     Opcode
+	// Args are the operands, excluding block operands. Signed
+	// operands are sign-extended.
+	Args []uint64
+	// Block is the block operand of operations like
+	// DW_OP_implicit_value, DW_OP_entry_value (where it's a
+	// nested expression), and DW_OP_const_type.
+	Block []byte
+}
+
+// Decode decodes expression expr into its operations.
+func Decode(expr []byte, enc Encoding) ([]Op, error) {
+	b := &buf{order: enc.Order, data: expr}
+	var ops []Op
+	for len(b.data) > 0 {
+		op := Op{Off: len(expr) - len(b.data), Code: Opcode(b.u8())}
+		desc, ok := opInfo[op.Code]
+		if !ok {
+			return ops, fmt.Errorf("unknown operation %#x at offset %d", uint8(op.Code), op.Off)
+		}
+		for _, arg := range desc.args {
+			var v uint64
+			switch arg {
+			case argU8:
+				v = b.u8()
+			case argS8:
+				v = uint64(int8(b.u8()))
+			case argU16:
+				v = b.uint(2)
+			case argS16:
+				v = uint64(int16(b.uint(2)))
+			case argU32:
+				v = b.uint(4)
+			case argS32:
+				v = uint64(int32(b.uint(4)))
+			case argU64, argS64:
+				v = b.uint(8)
+			case argULEB:
+				v = b.uleb()
+			case argSLEB:
+				v = uint64(b.sleb())
+			case argAddr:
+				v = b.uint(enc.PtrSize)
+			case argRef:
+				v = b.uint(enc.OffSize)
+			case argBlock:
+				op.Block = b.need(int(b.uleb()))
+				continue
+			case argBlock1:
+				op.Block = b.need(int(b.u8()))
+				continue
+			}
+			op.Args = append(op.Args, v)
+		}
+		if b.err != nil {
+			return ops, fmt.Errorf("truncated %s at offset %d", op.Code, op.Off)
+		}
+		op.Len = len(expr) - len(b.data) - op.Off
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+// A Formatter formats expressions in a readable form, such as
+// "fbreg -24" or "breg RSP+8; deref; stack_value".
+type Formatter struct {
+	Enc Encoding
+	// RegName, if non-nil, returns the name of a DWARF register
+	// number, or "" if it doesn't know the name.
+	RegName func(reg uint64) string
+	// AddrName, if non-nil, returns a symbolic name for an
+	// address, or "".
+	AddrName func(addr uint64) string
+}
+
+// Format decodes and formats expression expr. If expr is malformed,
+// the result ends with a description of the problem.
+func (f *Formatter) Format(expr []byte) string {
+	if len(expr) == 0 {
+		return "<empty>"
+	}
+	ops, err := Decode(expr, f.Enc)
+	s := f.FormatOps(ops)
+	if err != nil {
+		if s != "" {
+			s += "; "
+		}
+		s += "<" + err.Error() + ">"
+	}
+	return s
+}
+
+// FormatOps formats a decoded expression.
+func (f *Formatter) FormatOps(ops []Op) string {
+	parts := make([]string, len(ops))
+	for i, op := range ops {
+		parts[i] = f.formatOp(op)
+	}
+	return strings.Join(parts, "; ")
+}
+
+func (f *Formatter) reg(n uint64) string {
+	if f.RegName != nil {
+		if name := f.RegName(n); name != "" {
+			return name
+		}
+	}
+	return fmt.Sprintf("r%d", n)
+}
+
+func (f *Formatter) formatOp(op Op) string {
+	sgn := func(v uint64) string {
+		if int64(v) >= 0 {
+			return fmt.Sprintf("+%d", int64(v))
+		}
+		return fmt.Sprint(int64(v))
+	}
+	switch c := op.Code; {
+	case opLit0 <= c && c <= opLit31:
+		return fmt.Sprintf("const %d", c-opLit0)
+	case opConst1u <= c && c <= opConsts:
+		if c == opConsts || (c-opConst1u)%2 == 1 {
+			return fmt.Sprintf("const %d", int64(op.Args[0]))
+		}
+		return fmt.Sprintf("const %d", op.Args[0])
+	case opReg0 <= c && c <= opReg31:
+		return "reg " + f.reg(uint64(c-opReg0))
+	case c == opRegx:
+		return "reg " + f.reg(op.Args[0])
+	case opBreg0 <= c && c <= opBreg31, c == opBregx:
+		reg, off := uint64(c-opBreg0), op.Args[0]
+		if c == opBregx {
+			reg, off = op.Args[0], op.Args[1]
+		}
+		if off == 0 {
+			return "breg " + f.reg(reg)
+		}
+		return "breg " + f.reg(reg) + sgn(off)
+	case c == opFbreg:
+		return fmt.Sprintf("fbreg %d", int64(op.Args[0]))
+	case c == opAddr:
+		s := fmt.Sprintf("addr %#x", op.Args[0])
+		if f.AddrName != nil {
+			if name := f.AddrName(op.Args[0]); name != "" {
+				s += " <" + name + ">"
+			}
+		}
+		return s
+	case c == opBra || c == opSkip:
+		return fmt.Sprintf("%s %s (to %d)", opInfo[c].name, sgn(op.Args[0]), op.Off+3+int(int64(op.Args[0])))
+	case c == opEntryValue || c == opGNUEntryValue:
+		sub := &Formatter{f.Enc, f.RegName, f.AddrName}
+		return opInfo[c].name + "(" + sub.Format(op.Block) + ")"
+	case c == opRegvalType || c == opGNURegvalType:
+		return fmt.Sprintf("%s %s <%#x>", opInfo[c].name, f.reg(op.Args[0]), op.Args[1])
+	case c == opConstType || c == opGNUConstType:
+		return fmt.Sprintf("%s <%#x> %#x", opInfo[c].name, op.Args[0], op.Block)
+	case c == opImplicitValue:
+		return fmt.Sprintf("implicit_value %#x", op.Block)
+	case c == opImplicitPtr || c == opGNUImplicitPtr:
+		return fmt.Sprintf("%s <%#x>%s", opInfo[c].name, op.Args[0], sgn(op.Args[1]))
+	case c == opConvert || c == opGNUConvert || c == opReinterpret || c == opGNUReinterpret:
+		return fmt.Sprintf("%s <%#x>", opInfo[c].name, op.Args[0])
+	}
+	s := opInfo[op.Code].name
+	for i, arg := range op.Args {
+		if i == 0 {
+			s += " "
+		} else {
+			s += ", "
+		}
+		s += fmt.Sprint(arg)
+	}
+	return s
+}
+
+// buf is a little cursor over a byte slice.
+type buf struct {
+	order binary.ByteOrder
+	data  []byte
+	err   error
+}
+
+func (b *buf) need(n int) []byte {
+	if b.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(b.data) {
+		b.err = fmt.Errorf("unexpected end of data")
+		b.data = nil
+		return nil
+	}
+	out := b.data[:n]
+	b.data = b.data[n:]
+	return out
+}
+
+func (b *buf) u8() uint64 {
+	if p := b.need(1); p != nil {
+		return uint64(p[0])
+	}
+	return 0
+}
+
+// uint reads an n-byte unsigned integer.
+func (b *buf) uint(n int) uint64 {
+	p := b.need(n)
+	if p == nil {
+		return 0
+	}
+	switch n {
+	case 1:
+		return uint64(p[0])
+	case 2:
+		return uint64(b.order.Uint16(p))
+	case 4:
+		return uint64(b.order.Uint32(p))
+	case 8:
+		return b.order.Uint64(p)
+	}
+	b.err = fmt.Errorf("bad integer size %d", n)
+	return 0
+}
+
+func (b *buf) uleb() uint64 {
+	var v uint64
+	for shift := uint(0); ; shift += 7 {
+		c := b.u8()
+		if b.err != nil {
+			return 0
+		}
+		if shift < 64 {
+			v |= (c & 0x7f) << shift
+		}
+		if c&0x80 == 0 {
+			return v
+		}
+	}
+}
+
+func (b *buf) sleb() int64 {
+	var v int64
+	for shift := uint(0); ; shift += 7 {
+		c := b.u8()
+		if b.err != nil {
+			return 0
+		}
+		if shift < 64 {
+			v |= int64(c&0x7f) << shift
+		}
+		if c&0x80 == 0 {
+			if shift+7 < 64 && c&0x40 != 0 {
+				v |= -1 << (shift + 7)
+			}
+			return v
+		}
+	}
+}
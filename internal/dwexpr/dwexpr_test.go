@@ -0,0 +1,207 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dwexpr
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+var enc = Encoding{PtrSize: 8, OffSize: 4, Order: binary.LittleEndian}
+
+func regName(n uint64) string {
+	return map[uint64]string{0: "RAX", 5: "RDI", 7: "RSP"}[n]
+}
+
+func TestFormat(t *testing.T) {
+	f := &Formatter{Enc: enc, RegName: regName}
+	for _, test := range []struct {
+		expr []byte
+		want string
+	}{
+		{[]byte{0x91, 0x68}, "fbreg -24"},
+		{[]byte{0x50}, "reg RAX"},
+		{[]byte{0x90, 0x11}, "reg r17"},
+		{[]byte{0x77, 0x08, 0x06, 0x9f}, "breg RSP+8; deref; stack_value"},
+		{[]byte{0xa3, 0x01, 0x55, 0x9f}, "entry_value(reg RDI); stack_value"},
+		{[]byte{0x35, 0x9f}, "const 5; stack_value"},
+		{[]byte{0x09, 0xfe}, "const -2"},
+		{[]byte{0x50, 0x93, 0x08, 0x93, 0x04}, "reg RAX; piece 8; piece 4"},
+		{[]byte{0x03, 0x10, 0x40, 0, 0, 0, 0, 0, 0}, "addr 0x4010"},
+		{[]byte{0x2f, 0x01, 0x00, 0x96}, "skip +1 (to 4); nop"},
+		{[]byte{0x91}, "<truncated DW_OP_fbreg at offset 0>"},
+		{[]byte{0x50, 0x02}, "reg RAX; <unknown operation 0x2 at offset 1>"},
+		{nil, "<empty>"},
+	} {
+		if got := f.Format(test.expr); got != test.want {
+			t.Errorf("Format(%x) = %q, want %q", test.expr, got, test.want)
+		}
+	}
+}
+
+func TestEval(t *testing.T) {
+	mem := map[uint64]byte{0x1000: 0x34, 0x1001: 0x12}
+	fr := &Frame{
+		Regs:      map[uint64]uint64{0: 42, 7: 0xff8},
+		CFA:       0x2000,
+		HasCFA:    true,
+		FrameBase: 0x2000,
+		ReadMem: func(addr uint64, size int) ([]byte, bool) {
+			p := make([]byte, size)
+			for i := range p {
+				p[i] = mem[addr+uint64(i)]
+			}
+			return p, true
+		},
+	}
+	fr.HasFrameBase = true
+	for _, test := range []struct {
+		expr []byte
+		want Location
+	}{
+		{[]byte{0x91, 0x68}, Location{Kind: LocMem, Addr: 0x2000 - 24}},
+		{[]byte{0x9c}, Location{Kind: LocMem, Addr: 0x2000}},
+		{[]byte{0x50}, Location{Kind: LocReg, Reg: 0}},
+		{[]byte{0x77, 0x08, 0x94, 0x02, 0x9f}, Location{Kind: LocValue, Value: 0x1234}},
+		{[]byte{0x70, 0x01, 0x9f}, Location{Kind: LocValue, Value: 43}},
+		{nil, Location{Kind: LocNone}},
+		{[]byte{0x50, 0x93, 0x08, 0x91, 0x00, 0x93, 0x04}, Location{Kind: LocPieces, Pieces: []Piece{
+			{Location{Kind: LocReg}, 64, 0},
+			{Location{Kind: LocMem, Addr: 0x2000}, 32, 0},
+		}}},
+		// 3 > 2 ? 7 : 9, using bra and skip.
+		{[]byte{0x33, 0x32, 0x2b, 0x28, 0x04, 0x00, 0x39, 0x2f, 0x01, 0x00, 0x37, 0x9f}, Location{Kind: LocValue, Value: 7}},
+		{[]byte{0x32, 0x33, 0x2b, 0x28, 0x04, 0x00, 0x39, 0x2f, 0x01, 0x00, 0x37, 0x9f}, Location{Kind: LocValue, Value: 9}},
+	} {
+		got, err := Eval(test.expr, enc, fr)
+		if err != nil {
+			t.Errorf("Eval(%x): %v", test.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Eval(%x) = %+v, want %+v", test.expr, got, test.want)
+		}
+	}
+
+	for _, test := range []struct {
+		expr []byte
+		want string
+	}{
+		{[]byte{0x75, 0x00}, "register 5 unavailable"},
+		{[]byte{0x22}, "DW_OP_plus at offset 0: stack underflow"},
+		{[]byte{0x2f, 0xfd, 0xff}, "expression too long"},
+		{[]byte{0xa3, 0x01, 0x55, 0x9f}, "entry value unavailable"},
+	} {
+		_, err := Eval(test.expr, enc, fr)
+		if err == nil || err.Error() != test.want {
+			t.Errorf("Eval(%x): got error %v, want %q", test.expr, err, test.want)
+		}
+	}
+}
+
+func TestLocList(t *testing.T) {
+	// DWARF 4 .debug_loc with a base address selection entry.
+	var loc []byte
+	u64 := func(vs ...uint64) {
+		for _, v := range vs {
+			loc = append(loc, make([]byte, 8)...)
+			binary.LittleEndian.PutUint64(loc[len(loc)-8:], v)
+		}
+	}
+	u64(0x10, 0x20)
+	loc = append(loc, 1, 0, 0x50)
+	u64(^uint64(0), 0x5000, 0, 8)
+	loc = append(loc, 2, 0, 0x91, 0x68)
+	u64(0, 0)
+
+	// DWARF 5 .debug_loclists, with an offset table for
+	// DW_FORM_loclistx.
+	loclists := []byte{
+		4, 0, 0, 0, // offset of list 0, relative to the base
+		0x04, 0x10, 0x20, 1, 0x50, // offset_pair
+		0x03, 0x00, 0x08, 1, 0x51, // startx_length
+		0x06, 0, 0x60, 0, 0, 0, 0, 0, 0, // base_address 0x6000
+		0x04, 0x00, 0x04, 1, 0x52, // offset_pair
+		0x05, 1, 0x53, // default_location
+		0x00,
+	}
+	addr := []byte{0, 0x70, 0, 0, 0, 0, 0, 0}
+
+	r := &LocReader{Enc: enc, Loc: loc, LocLists: loclists, Addr: addr}
+	got, err := r.Read(&Unit{Version: 4, Base: 0x1000}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []LocEntry{
+		{Low: 0x1010, High: 0x1020, Expr: []byte{0x50}},
+		{Low: 0x5000, High: 0x5008, Expr: []byte{0x91, 0x68}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DWARF 4: got %+v, want %+v", got, want)
+	}
+
+	u := &Unit{Version: 5, Base: 0x1000}
+	off, err := r.Offset(u, 0)
+	if err != nil || off != 4 {
+		t.Fatalf("Offset: got %d, %v; want 4", off, err)
+	}
+	got, err = r.Read(u, off)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []LocEntry{
+		{Low: 0x1010, High: 0x1020, Expr: []byte{0x50}},
+		{Low: 0x7000, High: 0x7008, Expr: []byte{0x51}},
+		{Low: 0x6000, High: 0x6004, Expr: []byte{0x52}},
+		{Default: true, Expr: []byte{0x53}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DWARF 5: got %+v, want %+v", got, want)
+	}
+}
+
+func TestUnitHeader(t *testing.T) {
+	info := []byte{
+		7, 0, 0, 0, 4, 0, 0, 0, 0, 0, 8, // DWARF 4 unit, no DIEs
+		8, 0, 0, 0, 5, 0, 1, 8, 0, 0, 0, 0, // DWARF 5 unit
+	}
+	for _, test := range []struct {
+		off  uint64
+		vers int
+	}{{5, 4}, {11, 5}, {19, 5}} {
+		vers, size, ok := UnitHeader(info, enc, test.off)
+		if !ok || vers != test.vers || size != 4 {
+			t.Errorf("UnitHeader(%d) = %d, %d, %v; want %d, 4, true", test.off, vers, size, ok, test.vers)
+		}
+	}
+	if _, _, ok := UnitHeader(info, enc, 30); ok {
+		t.Errorf("UnitHeader(30) succeeded past the end")
+	}
+}
+
+func TestShapeOf(t *testing.T) {
+	for _, test := range []struct {
+		expr []byte
+		want Shape
+	}{
+		{nil, Shape{Kind: LocNone}},
+		{[]byte{0x50}, Shape{Kind: LocReg, Reg: 0}},
+		{[]byte{0x90, 0x11}, Shape{Kind: LocReg, Reg: 17}},
+		{[]byte{0x91, 0x68}, Shape{Kind: LocMem, Frame: true}},
+		{[]byte{0x77, 0x08}, Shape{Kind: LocMem, Reg: 7, HasBase: true}},
+		{[]byte{0x77, 0x08, 0x06, 0x9f}, Shape{Kind: LocValue}},
+		{[]byte{0x03, 0x10, 0x40, 0, 0, 0, 0, 0, 0}, Shape{Kind: LocMem, Static: true}},
+		{[]byte{0x50, 0x93, 0x08, 0x93, 0x04}, Shape{Kind: LocPieces}},
+	} {
+		ops, err := Decode(test.expr, enc)
+		if err != nil {
+			t.Fatalf("Decode(%x): %v", test.expr, err)
+		}
+		if got := ShapeOf(ops); got != test.want {
+			t.Errorf("ShapeOf(%x) = %+v, want %+v", test.expr, got, test.want)
+		}
+	}
+}
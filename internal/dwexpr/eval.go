@@ -0,0 +1,408 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dwexpr
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// A Frame is a snapshot of the machine state of a stack frame, used
+// to evaluate expressions. Any part of it may be missing, in which
+// case evaluating an expression that needs it fails.
+type Frame struct {
+	// Regs maps DWARF register numbers to their values.
+	Regs map[uint64]uint64
+	// CFA is the canonical frame address, for
+	// DW_OP_call_frame_cfa.
+	CFA    uint64
+	HasCFA bool
+	// FrameBase is the function's frame base, for DW_OP_fbreg.
+	// See Frame.Addr to compute it from DW_AT_frame_base.
+	FrameBase    uint64
+	HasFrameBase bool
+	// ReadMem, if non-nil, reads size bytes of memory at addr.
+	ReadMem func(addr uint64, size int) ([]byte, bool)
+	// Addrx, if non-nil, returns entry i of the compilation
+	// unit's address table, for DW_OP_addrx and DW_OP_constx.
+	Addrx func(i uint64) (uint64, bool)
+}
+
+// A LocKind is the kind of a Location.
+type LocKind uint8
+
+const (
+	// LocNone means the value is optimized out.
+	LocNone LocKind = iota
+	// LocMem means the value is in memory at Location.Addr.
+	LocMem
+	// LocReg means the value is in register Location.Reg.
+	LocReg
+	// LocValue means the value is Location.Value
+	// (DW_OP_stack_value).
+	LocValue
+	// LocImplicit means the value is Location.Bytes
+	// (DW_OP_implicit_value).
+	LocImplicit
+	// LocImplicitPtr means the value is a pointer to the
+	// variable at DIE offset Location.Value, plus Location.Addr
+	// bytes, which has no address.
+	LocImplicitPtr
+	// LocPieces means the value is composed of Location.Pieces.
+	LocPieces
+)
+
+// A Location is the result of evaluating a location description.
+type Location struct {
+	Kind   LocKind
+	Addr   uint64
+	Reg    uint64
+	Value  uint64
+	Bytes  []byte
+	Pieces []Piece
+}
+
+// A Piece is part of a composite location.
+type Piece struct {
+	Location
+	// BitSize is the size of this piece in bits. BitOff is the
+	// offset of the piece within Location, for
+	// DW_OP_bit_piece.
+	BitSize, BitOff uint64
+}
+
+func (l Location) String() string {
+	switch l.Kind {
+	case LocNone:
+		return "optimized out"
+	case LocMem:
+		return fmt.Sprintf("memory %#x", l.Addr)
+	case LocReg:
+		return fmt.Sprintf("register %d", l.Reg)
+	case LocValue:
+		return fmt.Sprintf("value %#x", l.Value)
+	case LocImplicit:
+		return fmt.Sprintf("value %#x", l.Bytes)
+	case LocImplicitPtr:
+		return fmt.Sprintf("implicit pointer to <%#x>%+d", l.Value, int64(l.Addr))
+	}
+	s := "pieces ["
+	for i, p := range l.Pieces {
+		if i > 0 {
+			s += ", "
+		}
+		s += fmt.Sprintf("%d bits: %s", p.BitSize, p.Location)
+	}
+	return s + "]"
+}
+
+// Addr returns the address denoted by the frame base location l,
+// which is evaluated from a DW_AT_frame_base attribute. For a
+// register location, this is the register's contents.
+func (fr *Frame) Addr(l Location) (uint64, error) {
+	switch l.Kind {
+	case LocMem:
+		return l.Addr, nil
+	case LocValue:
+		return l.Value, nil
+	case LocReg:
+		v, ok := fr.Regs[l.Reg]
+		if !ok {
+			return 0, fmt.Errorf("register %d unavailable", l.Reg)
+		}
+		return v, nil
+	}
+	return 0, fmt.Errorf("frame base is %s", l)
+}
+
+// maxSteps limits the number of operations evaluated, since
+// DW_OP_bra and DW_OP_skip can loop.
+const maxSteps = 10000
+
+// Eval evaluates the location description expr in frame fr.
+func Eval(expr []byte, enc Encoding, fr *Frame) (Location, error) {
+	ops, err := Decode(expr, enc)
+	if err != nil {
+		return Location{}, err
+	}
+	return EvalOps(ops, enc, fr)
+}
+
+// EvalOps evaluates a decoded location description in frame fr.
+func EvalOps(ops []Op, enc Encoding, fr *Frame) (Location, error) {
+	var stack []uint64
+	push := func(v uint64) { stack = append(stack, v) }
+	pop := func() uint64 {
+		v := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		return v
+	}
+	// need checks that the stack has at least n entries.
+	need := func(op Op, n int) error {
+		if len(stack) < n {
+			return fmt.Errorf("%s at offset %d: stack underflow", op.Code, op.Off)
+		}
+		return nil
+	}
+	read := func(op Op, addr uint64, size int) (uint64, error) {
+		if size < 1 || size > 8 {
+			return 0, fmt.Errorf("%s at offset %d: bad size %d", op.Code, op.Off, size)
+		}
+		if fr.ReadMem == nil {
+			return 0, fmt.Errorf("memory unavailable")
+		}
+		p, ok := fr.ReadMem(addr, size)
+		if !ok || len(p) < size {
+			return 0, fmt.Errorf("memory at %#x unavailable", addr)
+		}
+		// Zero-extend to 8 bytes.
+		var b [8]byte
+		if enc.Order == binary.BigEndian {
+			copy(b[8-size:], p)
+		} else {
+			copy(b[:], p[:size])
+		}
+		return enc.Order.Uint64(b[:]), nil
+	}
+	reg := func(n uint64) (uint64, error) {
+		v, ok := fr.Regs[n]
+		if !ok {
+			return 0, fmt.Errorf("register %d unavailable", n)
+		}
+		return v, nil
+	}
+	b2u := func(b bool) uint64 {
+		if b {
+			return 1
+		}
+		return 0
+	}
+
+	// Map operation offsets to indexes for branches.
+	index := make(map[int]int)
+	for i, op := range ops {
+		index[op.Off] = i
+	}
+	end := 0
+	if len(ops) > 0 {
+		end = ops[len(ops)-1].Off + ops[len(ops)-1].Len
+	}
+
+	var pieces []Piece
+	var loc Location
+	haveLoc := false
+	steps := 0
+	for i := 0; i < len(ops); i++ {
+		if steps++; steps > maxSteps {
+			return Location{}, fmt.Errorf("expression too long")
+		}
+		op := ops[i]
+		c := op.Code
+		switch {
+		case opLit0 <= c && c <= opLit31:
+			push(uint64(c - opLit0))
+		case opConst1u <= c && c <= opConsts, c == opAddr:
+			push(op.Args[0])
+		case c == opAddrx || c == opConstx || c == opGNUAddrIndex || c == opGNUConstIndex:
+			if fr.Addrx == nil {
+				return Location{}, fmt.Errorf("%s: address table unavailable", c)
+			}
+			v, ok := fr.Addrx(op.Args[0])
+			if !ok {
+				return Location{}, fmt.Errorf("%s: bad address index %d", c, op.Args[0])
+			}
+			push(v)
+		case opReg0 <= c && c <= opReg31:
+			loc, haveLoc = Location{Kind: LocReg, Reg: uint64(c - opReg0)}, true
+		case c == opRegx:
+			loc, haveLoc = Location{Kind: LocReg, Reg: op.Args[0]}, true
+		case opBreg0 <= c && c <= opBreg31:
+			v, err := reg(uint64(c - opBreg0))
+			if err != nil {
+				return Location{}, err
+			}
+			push(v + op.Args[0])
+		case c == opBregx:
+			v, err := reg(op.Args[0])
+			if err != nil {
+				return Location{}, err
+			}
+			push(v + op.Args[1])
+		case c == opFbreg:
+			if !fr.HasFrameBase {
+				return Location{}, fmt.Errorf("frame base unavailable")
+			}
+			push(fr.FrameBase + op.Args[0])
+		case c == opCallFrameCFA:
+			if !fr.HasCFA {
+				return Location{}, fmt.Errorf("CFA unavailable")
+			}
+			push(fr.CFA)
+		case c == opDup || c == opDrop || c == opOver || c == opPick || c == opSwap || c == opRot:
+			n := map[Opcode]int{opDup: 1, opDrop: 1, opOver: 2, opSwap: 2, opRot: 3}[c]
+			if c == opPick {
+				n = int(op.Args[0]) + 1
+			}
+			if err := need(op, n); err != nil {
+				return Location{}, err
+			}
+			top := len(stack) - 1
+			switch c {
+			case opDup:
+				push(stack[top])
+			case opDrop:
+				pop()
+			case opOver:
+				push(stack[top-1])
+			case opPick:
+				push(stack[top-int(op.Args[0])])
+			case opSwap:
+				stack[top], stack[top-1] = stack[top-1], stack[top]
+			case opRot:
+				stack[top], stack[top-1], stack[top-2] = stack[top-1], stack[top-2], stack[top]
+			}
+		case c == opDeref || c == opDerefSize:
+			if err := need(op, 1); err != nil {
+				return Location{}, err
+			}
+			size := enc.PtrSize
+			if c == opDerefSize {
+				size = int(op.Args[0])
+			}
+			v, err := read(op, pop(), size)
+			if err != nil {
+				return Location{}, err
+			}
+			push(v)
+		case c == opAbs || c == opNeg || c == opNot:
+			if err := need(op, 1); err != nil {
+				return Location{}, err
+			}
+			v := pop()
+			switch c {
+			case opAbs:
+				if int64(v) < 0 {
+					v = -v
+				}
+			case opNeg:
+				v = -v
+			case opNot:
+				v = ^v
+			}
+			push(v)
+		case c == opPlusUconst:
+			if err := need(op, 1); err != nil {
+				return Location{}, err
+			}
+			push(pop() + op.Args[0])
+		case opAnd <= c && c <= opXor, opEq <= c && c <= opNe:
+			// Unary operations in this range are handled
+			// above.
+			if err := need(op, 2); err != nil {
+				return Location{}, err
+			}
+			b, a := pop(), pop()
+			var v uint64
+			switch c {
+			case opAnd:
+				v = a & b
+			case opDiv:
+				if b == 0 {
+					return Location{}, fmt.Errorf("division by zero")
+				}
+				v = uint64(int64(a) / int64(b))
+			case opMinus:
+				v = a - b
+			case opMod:
+				if b == 0 {
+					return Location{}, fmt.Errorf("division by zero")
+				}
+				v = a % b
+			case opMul:
+				v = a * b
+			case opOr:
+				v = a | b
+			case opPlus:
+				v = a + b
+			case opShl:
+				v = a << b
+			case opShr:
+				v = a >> b
+			case opShra:
+				v = uint64(int64(a) >> b)
+			case opXor:
+				v = a ^ b
+			case opEq:
+				v = b2u(int64(a) == int64(b))
+			case opGe:
+				v = b2u(int64(a) >= int64(b))
+			case opGt:
+				v = b2u(int64(a) > int64(b))
+			case opLe:
+				v = b2u(int64(a) <= int64(b))
+			case opLt:
+				v = b2u(int64(a) < int64(b))
+			case opNe:
+				v = b2u(int64(a) != int64(b))
+			}
+			push(v)
+		case c == opSkip || c == opBra:
+			if c == opBra {
+				if err := need(op, 1); err != nil {
+					return Location{}, err
+				}
+				if pop() == 0 {
+					continue
+				}
+			}
+			target := op.Off + 3 + int(int64(op.Args[0]))
+			if target == end {
+				i = len(ops) - 1
+				continue
+			}
+			j, ok := index[target]
+			if !ok {
+				return Location{}, fmt.Errorf("%s at offset %d: bad target %d", c, op.Off, target)
+			}
+			i = j - 1
+		case c == opNop:
+		case c == opStackValue:
+			if err := need(op, 1); err != nil {
+				return Location{}, err
+			}
+			loc, haveLoc = Location{Kind: LocValue, Value: pop()}, true
+		case c == opImplicitValue:
+			loc, haveLoc = Location{Kind: LocImplicit, Bytes: op.Block}, true
+		case c == opImplicitPtr || c == opGNUImplicitPtr:
+			loc, haveLoc = Location{Kind: LocImplicitPtr, Value: op.Args[0], Addr: op.Args[1]}, true
+		case c == opPiece || c == opBitPiece:
+			p := Piece{BitSize: op.Args[0] * 8}
+			if c == opBitPiece {
+				p.BitSize, p.BitOff = op.Args[0], op.Args[1]
+			}
+			if haveLoc {
+				p.Location = loc
+			} else if len(stack) > 0 {
+				p.Location = Location{Kind: LocMem, Addr: pop()}
+			}
+			pieces = append(pieces, p)
+			loc, haveLoc = Location{}, false
+		case c == opEntryValue || c == opGNUEntryValue:
+			return Location{}, fmt.Errorf("entry value unavailable")
+		default:
+			return Location{}, fmt.Errorf("%s unsupported", c)
+		}
+	}
+
+	switch {
+	case len(pieces) > 0:
+		return Location{Kind: LocPieces, Pieces: pieces}, nil
+	case haveLoc:
+		return loc, nil
+	case len(stack) == 0:
+		return Location{Kind: LocNone}, nil
+	}
+	return Location{Kind: LocMem, Addr: stack[len(stack)-1]}, nil
+}
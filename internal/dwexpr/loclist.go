@@ -0,0 +1,195 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dwexpr
+
+import (
+	"fmt"
+)
+
+// A LocEntry is an entry in a location list.
+type LocEntry struct {
+	// Low and High bound the PCs at which Expr gives the
+	// location. If Default is set, Expr applies at PCs covered by
+	// no other entry, and Low and High are 0.
+	Low, High uint64
+	Default   bool
+	Expr      []byte
+}
+
+// A Unit describes the compilation unit a location list belongs to.
+type Unit struct {
+	// Version is the DWARF version of the unit.
+	Version int
+	// Base is the unit's base address, usually its DW_AT_low_pc.
+	Base uint64
+	// AddrBase and LocListsBase are the unit's DW_AT_addr_base
+	// and DW_AT_loclists_base (DWARF 5).
+	AddrBase, LocListsBase uint64
+}
+
+// A LocReader reads location lists from the .debug_loc (DWARF 2-4)
+// and .debug_loclists (DWARF 5) sections. It uses .debug_addr to
+// resolve indexed addresses.
+type LocReader struct {
+	Enc                 Encoding
+	Loc, LocLists, Addr []byte
+}
+
+// Offset returns the .debug_loclists offset of location list index
+// idx of unit u, for attributes of form DW_FORM_loclistx.
+func (r *LocReader) Offset(u *Unit, idx uint64) (uint64, error) {
+	off := u.LocListsBase + idx*uint64(r.Enc.OffSize)
+	if off+uint64(r.Enc.OffSize) > uint64(len(r.LocLists)) {
+		return 0, fmt.Errorf("location list index %d out of range", idx)
+	}
+	b := &buf{order: r.Enc.Order, data: r.LocLists[off:]}
+	return u.LocListsBase + b.uint(r.Enc.OffSize), nil
+}
+
+// AddrIndex returns entry idx of unit u's address table.
+func (r *LocReader) AddrIndex(u *Unit, idx uint64) (uint64, bool) {
+	off := u.AddrBase + idx*uint64(r.Enc.PtrSize)
+	if off+uint64(r.Enc.PtrSize) > uint64(len(r.Addr)) {
+		return 0, false
+	}
+	b := &buf{order: r.Enc.Order, data: r.Addr[off:]}
+	return b.uint(r.Enc.PtrSize), true
+}
+
+// Read returns the location list at section offset off for unit u.
+// For DWARF 5 units, off is an offset in .debug_loclists; otherwise,
+// it's an offset in .debug_loc.
+func (r *LocReader) Read(u *Unit, off uint64) ([]LocEntry, error) {
+	if u.Version >= 5 {
+		return r.read5(u, off)
+	}
+	if off >= uint64(len(r.Loc)) {
+		return nil, fmt.Errorf("location list offset %#x out of range", off)
+	}
+	b := &buf{order: r.Enc.Order, data: r.Loc[off:]}
+	maxAddr := ^uint64(0) >> uint(64-8*r.Enc.PtrSize)
+	base := u.Base
+	var out []LocEntry
+	for {
+		lo, hi := b.uint(r.Enc.PtrSize), b.uint(r.Enc.PtrSize)
+		if b.err != nil {
+			return out, b.err
+		}
+		if lo == 0 && hi == 0 {
+			return out, nil
+		}
+		if lo == maxAddr {
+			// Base address selection.
+			base = hi
+			continue
+		}
+		expr := b.need(int(b.uint(2)))
+		if b.err != nil {
+			return out, b.err
+		}
+		out = append(out, LocEntry{Low: base + lo, High: base + hi, Expr: expr})
+	}
+}
+
+// DWARF 5 location list entry kinds.
+const (
+	lleEndOfList    = 0x00
+	lleBaseAddressx = 0x01
+	lleStartxEndx   = 0x02
+	lleStartxLength = 0x03
+	lleOffsetPair   = 0x04
+	lleDefaultLoc   = 0x05
+	lleBaseAddress  = 0x06
+	lleStartEnd     = 0x07
+	lleStartLength  = 0x08
+	lleGNUViewPair  = 0x09
+)
+
+func (r *LocReader) read5(u *Unit, off uint64) ([]LocEntry, error) {
+	if off >= uint64(len(r.LocLists)) {
+		return nil, fmt.Errorf("location list offset %#x out of range", off)
+	}
+	b := &buf{order: r.Enc.Order, data: r.LocLists[off:]}
+	base := u.Base
+	addrx := func(idx uint64) uint64 {
+		a, ok := r.AddrIndex(u, idx)
+		if !ok && b.err == nil {
+			b.err = fmt.Errorf("address index %d out of range", idx)
+		}
+		return a
+	}
+	var out []LocEntry
+	for {
+		kind := b.u8()
+		var e LocEntry
+		switch kind {
+		case lleEndOfList:
+			return out, b.err
+		case lleBaseAddressx:
+			base = addrx(b.uleb())
+			continue
+		case lleBaseAddress:
+			base = b.uint(r.Enc.PtrSize)
+			continue
+		case lleGNUViewPair:
+			// Location views, which we ignore.
+			b.uleb()
+			b.uleb()
+			continue
+		case lleStartxEndx:
+			e.Low = addrx(b.uleb())
+			e.High = addrx(b.uleb())
+		case lleStartxLength:
+			e.Low = addrx(b.uleb())
+			e.High = e.Low + b.uleb()
+		case lleOffsetPair:
+			e.Low = base + b.uleb()
+			e.High = base + b.uleb()
+		case lleDefaultLoc:
+			e.Default = true
+		case lleStartEnd:
+			e.Low = b.uint(r.Enc.PtrSize)
+			e.High = b.uint(r.Enc.PtrSize)
+		case lleStartLength:
+			e.Low = b.uint(r.Enc.PtrSize)
+			e.High = e.Low + b.uleb()
+		default:
+			if b.err == nil {
+				b.err = fmt.Errorf("unknown location list entry kind %#x", kind)
+			}
+		}
+		e.Expr = b.need(int(b.uleb()))
+		if b.err != nil {
+			return out, b.err
+		}
+		out = append(out, e)
+	}
+}
+
+// UnitHeader returns the DWARF version and offset size of the unit
+// in .debug_info section info that contains the entry at offset off.
+func UnitHeader(info []byte, enc Encoding, off uint64) (version, offSize int, ok bool) {
+	b := &buf{order: enc.Order, data: info}
+	for len(b.data) > 0 {
+		start := uint64(len(info) - len(b.data))
+		n, size := b.uint(4), 4
+		if n == 0xffffffff {
+			n, size = b.uint(8), 8
+		}
+		vers := int(b.uint(2))
+		if b.err != nil {
+			return 0, 0, false
+		}
+		end := uint64(len(info)-len(b.data)) - 2 + n
+		if start <= off && off < end {
+			return vers, size, true
+		}
+		if end > uint64(len(info)) {
+			return 0, 0, false
+		}
+		b.data = info[end:]
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,61 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dwexpr
+
+// A Shape describes the location an expression computes, determined
+// without evaluating it.
+type Shape struct {
+	Kind LocKind
+	// Reg is the register holding the value of a LocReg
+	// location, or the base register of a LocMem location's
+	// address if HasBase is set.
+	Reg     uint64
+	HasBase bool
+	// Frame is set for LocMem locations addressed relative to the
+	// frame base or the CFA.
+	Frame bool
+	// Static is set for LocMem locations at a constant address.
+	Static bool
+}
+
+// ShapeOf returns the shape of the location computed by ops.
+func ShapeOf(ops []Op) Shape {
+	// Skip trailing nops.
+	for len(ops) > 0 && ops[len(ops)-1].Code == opNop {
+		ops = ops[:len(ops)-1]
+	}
+	if len(ops) == 0 {
+		return Shape{Kind: LocNone}
+	}
+	for _, op := range ops {
+		if op.Code == opPiece || op.Code == opBitPiece {
+			return Shape{Kind: LocPieces}
+		}
+	}
+	switch last := ops[len(ops)-1]; {
+	case last.Code >= opReg0 && last.Code <= opReg31:
+		return Shape{Kind: LocReg, Reg: uint64(last.Code - opReg0)}
+	case last.Code == opRegx:
+		return Shape{Kind: LocReg, Reg: last.Args[0]}
+	case last.Code == opStackValue:
+		return Shape{Kind: LocValue}
+	case last.Code == opImplicitValue:
+		return Shape{Kind: LocImplicit}
+	case last.Code == opImplicitPtr || last.Code == opGNUImplicitPtr:
+		return Shape{Kind: LocImplicitPtr}
+	}
+	s := Shape{Kind: LocMem}
+	switch first := ops[0]; {
+	case first.Code == opFbreg || first.Code == opCallFrameCFA:
+		s.Frame = true
+	case first.Code >= opBreg0 && first.Code <= opBreg31:
+		s.Reg, s.HasBase = uint64(first.Code-opBreg0), true
+	case first.Code == opBregx:
+		s.Reg, s.HasBase = first.Args[0], true
+	case first.Code == opAddr || first.Code == opAddrx || first.Code == opGNUAddrIndex:
+		s.Static = len(ops) == 1
+	}
+	return s
+}
@@ -0,0 +1,358 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dwindex
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"encoding/binary"
+	"fmt"
+)
+
+// ParseDebugNames parses a DWARF 5 .debug_names section, using str
+// (the .debug_str section) to resolve names and info (the
+// .debug_info section) to locate units. If aranges (the
+// .debug_aranges section) is non-nil, it also populates the address
+// to compile unit map from it.
+//
+// See DWARF 5, section 6.1.1.
+func ParseDebugNames(names, str, aranges, info []byte, order binary.ByteOrder) (*Index, error) {
+	x := newIndex("debug_names")
+	units := &unitDIEs{info: info, order: order}
+	for len(names) > 0 {
+		rest, err := x.parseNameIndex(names, str, units, order)
+		if err != nil {
+			return nil, err
+		}
+		names = rest
+	}
+	if aranges != nil {
+		if err := x.parseAranges(aranges, units, order); err != nil {
+			return nil, err
+		}
+	}
+	x.sort()
+	return x, nil
+}
+
+// DWARF 5 name index attributes and the forms we understand.
+const (
+	idxCompileUnit = 1
+	idxDIEOffset   = 3
+
+	formAddr        = 0x01
+	formData2       = 0x05
+	formData4       = 0x06
+	formData8       = 0x07
+	formData1       = 0x0b
+	formSdata       = 0x0d
+	formStrp        = 0x0e
+	formUdata       = 0x0f
+	formRefAddr     = 0x10
+	formRef1        = 0x11
+	formRef2        = 0x12
+	formRef4        = 0x13
+	formRef8        = 0x14
+	formRefUdata    = 0x15
+	formSecOffset   = 0x17
+	formFlagPresent = 0x19
+	formData16      = 0x1e
+)
+
+type namesAbbrev struct {
+	tag   dwarf.Tag
+	attrs [][2]uint64 // (index attribute, form)
+}
+
+// buf is a little cursor over a byte slice.
+type buf struct {
+	order binary.ByteOrder
+	data  []byte
+	err   error
+}
+
+func (b *buf) need(n int) []byte {
+	if b.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(b.data) {
+		b.err = formatError("dwindex: unexpected end of data")
+		b.data = nil
+		return nil
+	}
+	out := b.data[:n]
+	b.data = b.data[n:]
+	return out
+}
+
+func (b *buf) u8() uint64 {
+	if p := b.need(1); p != nil {
+		return uint64(p[0])
+	}
+	return 0
+}
+
+func (b *buf) u16() uint64 {
+	if p := b.need(2); p != nil {
+		return uint64(b.order.Uint16(p))
+	}
+	return 0
+}
+
+func (b *buf) u32() uint64 {
+	if p := b.need(4); p != nil {
+		return uint64(b.order.Uint32(p))
+	}
+	return 0
+}
+
+func (b *buf) u64() uint64 {
+	if p := b.need(8); p != nil {
+		return b.order.Uint64(p)
+	}
+	return 0
+}
+
+func (b *buf) uleb() uint64 {
+	var v uint64
+	for shift := uint(0); ; shift += 7 {
+		c := b.u8()
+		if b.err != nil {
+			return 0
+		}
+		v |= (c & 0x7f) << shift
+		if c&0x80 == 0 {
+			return v
+		}
+	}
+}
+
+// uint reads an n-byte unsigned integer.
+func (b *buf) uint(n int) uint64 {
+	switch n {
+	case 1:
+		return b.u8()
+	case 2:
+		return b.u16()
+	case 4:
+		return b.u32()
+	case 8:
+		return b.u64()
+	}
+	b.err = fmt.Errorf("dwindex: bad integer size %d", n)
+	return 0
+}
+
+// unitLength reads a unit length and returns it and the offset size.
+func (b *buf) unitLength() (uint64, int) {
+	n := b.u32()
+	if n == 0xffffffff {
+		return b.u64(), 8
+	}
+	return n, 4
+}
+
+// form reads a value of the given form. It returns the value for
+// integer and reference forms and skips others.
+func (b *buf) form(form uint64, offSize int) uint64 {
+	switch form {
+	case formData1, formRef1:
+		return b.u8()
+	case formData2, formRef2:
+		return b.u16()
+	case formData4, formRef4:
+		return b.u32()
+	case formData8, formRef8:
+		return b.u64()
+	case formUdata, formRefUdata, formSdata:
+		return b.uleb()
+	case formStrp, formRefAddr, formSecOffset:
+		return b.uint(offSize)
+	case formAddr:
+		// Address size isn't recorded, so assume 8.
+		return b.u64()
+	case formFlagPresent:
+		return 1
+	case formData16:
+		b.need(16)
+		return 0
+	}
+	b.err = fmt.Errorf("dwindex: unsupported form %#x in .debug_names", form)
+	return 0
+}
+
+// parseNameIndex parses one name index unit from data and returns the
+// data following it.
+func (x *Index) parseNameIndex(data, str []byte, units *unitDIEs, order binary.ByteOrder) ([]byte, error) {
+	b := &buf{order: order, data: data}
+	length, offSize := b.unitLength()
+	unit := b.need(int(length))
+	if b.err != nil {
+		return nil, b.err
+	}
+	rest := b.data
+
+	b = &buf{order: order, data: unit}
+	if v := b.u16(); v != 5 {
+		return nil, fmt.Errorf("dwindex: unsupported .debug_names version %d", v)
+	}
+	b.u16() // Padding
+	cuCount := int(b.u32())
+	localTUCount := int(b.u32())
+	foreignTUCount := int(b.u32())
+	bucketCount := int(b.u32())
+	nameCount := int(b.u32())
+	abbrevSize := int(b.u32())
+	augSize := int(b.u32())
+	b.need(augSize)
+
+	// CU offsets are unit header offsets, which DIE offsets are
+	// relative to.
+	cus := make([]uint64, cuCount)
+	for i := range cus {
+		cus[i] = b.uint(offSize)
+	}
+	b.need(localTUCount * offSize)
+	b.need(foreignTUCount * 8)
+	b.need(bucketCount * 4)
+	if bucketCount > 0 {
+		b.need(nameCount * 4) // Hashes
+	}
+	strOffs := make([]uint64, nameCount)
+	for i := range strOffs {
+		strOffs[i] = b.uint(offSize)
+	}
+	entryOffs := make([]uint64, nameCount)
+	for i := range entryOffs {
+		entryOffs[i] = b.uint(offSize)
+	}
+
+	// Parse the abbreviation table.
+	ab := &buf{order: order, data: b.need(abbrevSize)}
+	if b.err != nil {
+		return nil, b.err
+	}
+	abbrevs := make(map[uint64]*namesAbbrev)
+	for {
+		code := ab.uleb()
+		if code == 0 || ab.err != nil {
+			break
+		}
+		a := &namesAbbrev{tag: dwarf.Tag(ab.uleb())}
+		for {
+			idx, form := ab.uleb(), ab.uleb()
+			if (idx == 0 && form == 0) || ab.err != nil {
+				break
+			}
+			a.attrs = append(a.attrs, [2]uint64{idx, form})
+		}
+		abbrevs[code] = a
+	}
+	if ab.err != nil {
+		return nil, ab.err
+	}
+	pool := b.data
+
+	// Parse the entries for each name.
+	for i := 0; i < nameCount; i++ {
+		if strOffs[i] >= uint64(len(str)) || entryOffs[i] > uint64(len(pool)) {
+			return nil, formatError("dwindex: bad .debug_names name table")
+		}
+		name := str[strOffs[i]:]
+		if j := bytes.IndexByte(name, 0); j >= 0 {
+			name = name[:j]
+		}
+		eb := &buf{order: order, data: pool[entryOffs[i]:]}
+		for {
+			code := eb.uleb()
+			if code == 0 || eb.err != nil {
+				break
+			}
+			a := abbrevs[code]
+			if a == nil {
+				return nil, fmt.Errorf("dwindex: unknown .debug_names abbreviation %d", code)
+			}
+			cu, haveCU, haveDIE := 0, false, false
+			var dieOff uint64
+			for _, attr := range a.attrs {
+				v := eb.form(attr[1], offSize)
+				switch attr[0] {
+				case idxCompileUnit:
+					cu, haveCU = int(v), true
+				case idxDIEOffset:
+					dieOff, haveDIE = v, true
+				}
+			}
+			if eb.err != nil {
+				return nil, eb.err
+			}
+			if !haveCU {
+				if cuCount != 1 {
+					// A type unit entry, or an
+					// entry we can't place.
+					continue
+				}
+				cu = 0
+			}
+			if cu >= len(cus) {
+				continue
+			}
+			cuDIE, err := units.get(cus[cu])
+			if err != nil {
+				return nil, err
+			}
+			e := Entry{CU: cuDIE, Tag: a.tag}
+			if haveDIE {
+				e.DIE = dwarf.Offset(cus[cu] + dieOff)
+			}
+			x.addName(string(name), e)
+		}
+	}
+	return rest, nil
+}
+
+// parseAranges parses a .debug_aranges section into x's address to
+// compile unit map.
+func (x *Index) parseAranges(data []byte, units *unitDIEs, order binary.ByteOrder) error {
+	for len(data) > 0 {
+		b := &buf{order: order, data: data}
+		length, offSize := b.unitLength()
+		hdrLen := len(data) - len(b.data)
+		unit := b.need(int(length))
+		if b.err != nil {
+			return b.err
+		}
+		data = b.data
+
+		b = &buf{order: order, data: unit}
+		b.u16() // Version
+		cu, err := units.get(b.uint(offSize))
+		if err != nil {
+			return err
+		}
+		addrSize := int(b.u8())
+		b.u8() // Segment selector size
+		// Tuples are aligned to twice the address size from the
+		// start of the unit.
+		if addrSize != 4 && addrSize != 8 {
+			return fmt.Errorf("dwindex: unsupported .debug_aranges address size %d", addrSize)
+		}
+		hdr := hdrLen + len(unit) - len(b.data)
+		if pad := hdr % (2 * addrSize); pad != 0 {
+			b.need(2*addrSize - pad)
+		}
+		for b.err == nil && len(b.data) >= 2*addrSize {
+			addr, size := b.uint(addrSize), b.uint(addrSize)
+			if addr == 0 && size == 0 {
+				break
+			}
+			x.cus = append(x.cus, Range{addr, addr + size, cu})
+		}
+		if b.err != nil {
+			return b.err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,265 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package dwindex implements accelerated indexes for DWARF lookups by
+// address and by name.
+//
+// Walking the DWARF of a large binary can take seconds, so an Index
+// is loaded from the producer-generated accelerator tables when the
+// binary has them (DWARF 5 .debug_names plus .debug_aranges, or
+// GDB's .gdb_index). Otherwise, Build walks the DWARF once and the
+// result can be persisted with Encode and Decode.
+package dwindex
+
+import (
+	"debug/dwarf"
+	"encoding/binary"
+	"encoding/gob"
+	"io"
+	"sort"
+)
+
+// An Index maps addresses to compile units and subprograms, and names
+// to debugging information entries.
+type Index struct {
+	// Source describes where this index came from: "debug_names",
+	// "gdb_index", or "built".
+	Source string
+
+	// cus maps address ranges to compile unit offsets, sorted by
+	// Low.
+	cus []Range
+	// funcs maps address ranges to subprogram DIE offsets, sorted
+	// by Low. This is only populated by Build, since the
+	// producer-generated tables don't record it.
+	funcs []Range
+	names map[string][]Entry
+}
+
+// A Range is an address range [Low, High) belonging to the DIE at
+// Off. For compile units, this is the unit's top-level DIE.
+type Range struct {
+	Low, High uint64
+	Off       dwarf.Offset
+}
+
+// An Entry is a named debugging information entry.
+type Entry struct {
+	// CU is the offset of the top-level DIE of the compile unit
+	// containing the entry.
+	CU dwarf.Offset
+	// DIE is the offset of the entry itself, or 0 if the index
+	// only identifies the compile unit (as .gdb_index does).
+	DIE dwarf.Offset
+	// Tag is the entry's tag, or 0 if unknown. .gdb_index only
+	// distinguishes subprograms and variables.
+	Tag dwarf.Tag
+}
+
+func newIndex(source string) *Index {
+	return &Index{Source: source, names: make(map[string][]Entry)}
+}
+
+func (x *Index) addName(name string, e Entry) {
+	for _, old := range x.names[name] {
+		if old == e {
+			return
+		}
+	}
+	x.names[name] = append(x.names[name], e)
+}
+
+func (x *Index) sort() {
+	for _, rs := range [][]Range{x.cus, x.funcs} {
+		sort.Slice(rs, func(i, j int) bool {
+			return rs[i].Low < rs[j].Low
+		})
+	}
+}
+
+// HasFuncs reports whether x can map addresses directly to
+// subprograms with AddrToFunc.
+func (x *Index) HasFuncs() bool {
+	return len(x.funcs) > 0
+}
+
+// HasCUs reports whether x can map addresses to compile units with
+// AddrToCU.
+func (x *Index) HasCUs() bool {
+	return len(x.cus) > 0
+}
+
+// AddrToCU returns the offset of the compile unit containing addr.
+func (x *Index) AddrToCU(addr uint64) (dwarf.Offset, bool) {
+	return lookupRange(x.cus, addr)
+}
+
+// AddrToFunc returns the offset of the subprogram DIE containing
+// addr.
+func (x *Index) AddrToFunc(addr uint64) (dwarf.Offset, bool) {
+	return lookupRange(x.funcs, addr)
+}
+
+func lookupRange(rs []Range, addr uint64) (dwarf.Offset, bool) {
+	i := sort.Search(len(rs), func(i int) bool {
+		return addr < rs[i].Low
+	}) - 1
+	// Ranges may nest or overlap (for example, a CU's range may
+	// span gaps filled by other CUs), so check a few preceding
+	// ranges as well.
+	for j := i; j >= 0 && j > i-8; j-- {
+		if addr < rs[j].High {
+			return rs[j].Off, true
+		}
+	}
+	return 0, false
+}
+
+// Lookup returns the entries named name.
+func (x *Index) Lookup(name string) []Entry {
+	return x.names[name]
+}
+
+// Build creates an Index by walking all of dw.
+func Build(dw *dwarf.Data) (*Index, error) {
+	x := newIndex("built")
+	var cu dwarf.Offset
+	dr := dw.Reader()
+	for {
+		ent, err := dr.Next()
+		if err != nil {
+			return nil, err
+		}
+		if ent == nil {
+			break
+		}
+		switch ent.Tag {
+		case dwarf.TagCompileUnit, dwarf.TagPartialUnit:
+			cu = ent.Offset
+			ranges, _ := dw.Ranges(ent)
+			for _, r := range ranges {
+				x.cus = append(x.cus, Range{r[0], r[1], cu})
+			}
+
+		case dwarf.TagSubprogram:
+			ranges, _ := dw.Ranges(ent)
+			for _, r := range ranges {
+				x.funcs = append(x.funcs, Range{r[0], r[1], ent.Offset})
+			}
+			x.addNames(ent, Entry{cu, ent.Offset, ent.Tag})
+			// Don't descend into local variables and
+			// inlined subroutines.
+			dr.SkipChildren()
+
+		case dwarf.TagVariable:
+			// Local variables are never reached, since
+			// we skip the children of subprograms.
+			x.addNames(ent, Entry{cu, ent.Offset, ent.Tag})
+			dr.SkipChildren()
+
+		case 0, dwarf.TagNamespace, dwarf.TagClassType, dwarf.TagStructType, dwarf.TagModule:
+			// End of children, or scopes that may contain
+			// subprograms and variables.
+
+		default:
+			dr.SkipChildren()
+		}
+	}
+	x.sort()
+	return x, nil
+}
+
+func (x *Index) addNames(ent *dwarf.Entry, e Entry) {
+	for _, attr := range []dwarf.Attr{dwarf.AttrName, dwarf.AttrLinkageName} {
+		if name, ok := ent.Val(attr).(string); ok && name != "" {
+			x.addName(name, e)
+		}
+	}
+}
+
+// indexWire is the serialized form of an Index.
+type indexWire struct {
+	Version    int
+	Source     string
+	CUs, Funcs []Range
+	Names      map[string][]Entry
+}
+
+// wireVersion is incremented when the meaning of the encoded index
+// changes, to invalidate old caches.
+const wireVersion = 1
+
+// Encode writes x to w in a form that can be read by Decode.
+func (x *Index) Encode(w io.Writer) error {
+	return gob.NewEncoder(w).Encode(&indexWire{wireVersion, x.Source, x.cus, x.funcs, x.names})
+}
+
+// Decode reads an Index written by Encode.
+func Decode(r io.Reader) (*Index, error) {
+	var wire indexWire
+	if err := gob.NewDecoder(r).Decode(&wire); err != nil {
+		return nil, err
+	}
+	if wire.Version != wireVersion {
+		return nil, errVersion
+	}
+	x := &Index{Source: wire.Source, cus: wire.CUs, funcs: wire.Funcs, names: wire.Names}
+	if x.names == nil {
+		x.names = make(map[string][]Entry)
+	}
+	return x, nil
+}
+
+// unitDIEs maps the unit header offsets used by the accelerator
+// tables to the offsets of the units' top-level DIEs, which is how
+// debug/dwarf identifies units.
+type unitDIEs struct {
+	info  []byte
+	order binary.ByteOrder
+	cache map[uint64]dwarf.Offset
+}
+
+func (u *unitDIEs) get(off uint64) (dwarf.Offset, error) {
+	if die, ok := u.cache[off]; ok {
+		return die, nil
+	}
+	if off >= uint64(len(u.info)) {
+		return 0, formatError("dwindex: unit offset out of range")
+	}
+	b := &buf{order: u.order, data: u.info[off:]}
+	_, offSize := b.unitLength()
+	version := b.u16()
+	if version >= 5 {
+		unitType := b.u8()
+		b.u8() // Address size
+		b.uint(offSize)
+		switch unitType {
+		case 2, 6: // DW_UT_type, DW_UT_split_type
+			b.u64()
+			b.uint(offSize)
+		case 4, 5: // DW_UT_skeleton, DW_UT_split_compile
+			b.u64()
+		}
+	} else {
+		b.uint(offSize)
+		b.u8() // Address size
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+	die := dwarf.Offset(uint64(len(u.info) - len(b.data)))
+	if u.cache == nil {
+		u.cache = make(map[uint64]dwarf.Offset)
+	}
+	u.cache[off] = die
+	return die, nil
+}
+
+type formatError string
+
+func (e formatError) Error() string {
+	return string(e)
+}
+
+var errVersion = formatError("dwindex: unsupported index version")
@@ -0,0 +1,263 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dwindex
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"debug/elf"
+	"encoding/binary"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// goTestdata opens an ELF file from the debug/dwarf test data in
+// GOROOT.
+func goTestdata(t *testing.T, name string) *elf.File {
+	f, err := elf.Open(filepath.Join(runtime.GOROOT(), "src", "debug", "dwarf", "testdata", name))
+	if err != nil {
+		t.Skipf("no test data: %v", err)
+	}
+	return f
+}
+
+func TestBuild(t *testing.T) {
+	for _, name := range []string{"line-gcc.elf", "line-clang-dwarf5.elf"} {
+		t.Run(name, func(t *testing.T) {
+			f := goTestdata(t, name)
+			defer f.Close()
+			dw, err := f.DWARF()
+			if err != nil {
+				t.Fatal(err)
+			}
+			x, err := Build(dw)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, fn := range []string{"main", "f1", "f2"} {
+				es := x.Lookup(fn)
+				if len(es) != 1 || es[0].Tag != dwarf.TagSubprogram {
+					t.Errorf("Lookup(%q) = %v; want one subprogram", fn, es)
+					continue
+				}
+				r := dw.Reader()
+				r.Seek(es[0].DIE)
+				ent, err := r.Next()
+				if err != nil {
+					t.Fatal(err)
+				}
+				pc, ok := ent.Val(dwarf.AttrLowpc).(uint64)
+				if !ok {
+					t.Errorf("%s has no low PC", fn)
+					continue
+				}
+				if off, ok := x.AddrToFunc(pc + 1); !ok || off != ent.Offset {
+					t.Errorf("AddrToFunc(%#x) = %#x, %v; want %#x", pc+1, off, ok, ent.Offset)
+				}
+				if cu, ok := x.AddrToCU(pc); !ok || cu != es[0].CU {
+					t.Errorf("AddrToCU(%#x) = %#x, %v; want %#x", pc, cu, ok, es[0].CU)
+				}
+			}
+
+			// Check that the index survives a round trip.
+			var buf bytes.Buffer
+			if err := x.Encode(&buf); err != nil {
+				t.Fatal(err)
+			}
+			y, err := Decode(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(x, y) {
+				t.Errorf("Decode(Encode(x)) != x")
+			}
+		})
+	}
+}
+
+func TestAranges(t *testing.T) {
+	f := goTestdata(t, "line-gcc-dwarf5.elf")
+	defer f.Close()
+	aranges, err := f.Section(".debug_aranges").Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dw, err := f.DWARF()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := Build(dw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := f.Section(".debug_info").Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, err := ParseDebugNames(nil, nil, aranges, info, f.ByteOrder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(x.cus, want.cus) {
+		t.Errorf("CU ranges from .debug_aranges are %v; want %v", x.cus, want.cus)
+	}
+}
+
+func TestGdbIndex(t *testing.T) {
+	var cuList, addrs, symTab, pool []byte
+	// Two CUs at 0x0 and 0x100.
+	cuList = appendU64(cuList, 0x0)
+	cuList = appendU64(cuList, 0x100)
+	cuList = appendU64(cuList, 0x100)
+	cuList = appendU64(cuList, 0x80)
+	// CU 1 covers [0x1000, 0x2000).
+	addrs = appendU64(addrs, 0x1000)
+	addrs = appendU64(addrs, 0x2000)
+	addrs = appendU32(addrs, 1)
+	// "main" is a static function in CU 1.
+	pool = append(pool, "main\x00"...)
+	vecOff := len(pool)
+	pool = appendU32(pool, 1)
+	pool = appendU32(pool, 1|3<<28|1<<31)
+	symTab = appendU32(symTab, 0)
+	symTab = appendU32(symTab, uint32(vecOff))
+	// An empty slot.
+	symTab = appendU32(symTab, 0)
+	symTab = appendU32(symTab, 0)
+
+	var data []byte
+	data = appendU32(data, 7)
+	off := uint32(24)
+	for _, part := range [][]byte{cuList, nil, addrs, symTab} {
+		data = appendU32(data, off)
+		off += uint32(len(part))
+	}
+	data = appendU32(data, off)
+	for _, part := range [][]byte{cuList, addrs, symTab, pool} {
+		data = append(data, part...)
+	}
+
+	info := appendUnit(nil, 0, 4)
+	info = appendUnit(info, 0x100, 4)
+	x, err := ParseGdbIndex(data, info, binary.LittleEndian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A version 4 unit header is 11 bytes.
+	if cu, ok := x.AddrToCU(0x1800); !ok || cu != 0x10b {
+		t.Errorf("AddrToCU(0x1800) = %#x, %v; want 0x10b, true", cu, ok)
+	}
+	if _, ok := x.AddrToCU(0x2000); ok {
+		t.Errorf("AddrToCU(0x2000) found a CU")
+	}
+	want := []Entry{{CU: 0x10b, Tag: dwarf.TagSubprogram}}
+	if got := x.Lookup("main"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Lookup(main) = %v; want %v", got, want)
+	}
+}
+
+func TestDebugNames(t *testing.T) {
+	str := []byte("\x00main\x00counter\x00")
+
+	// Abbreviations: code 1 is a subprogram with a CU-relative
+	// DIE offset; code 2 is a variable with a CU index and DIE
+	// offset.
+	abbrevs := []byte{
+		1, byte(dwarf.TagSubprogram), idxDIEOffset, formRef4, 0, 0,
+		2, byte(dwarf.TagVariable), idxCompileUnit, formData1, idxDIEOffset, formRef4, 0, 0,
+		0,
+	}
+	var pool []byte
+	mainOff := len(pool)
+	pool = append(pool, 1)
+	pool = appendU32(pool, 0x2a)
+	pool = append(pool, 0)
+	counterOff := len(pool)
+	pool = append(pool, 2, 0)
+	pool = appendU32(pool, 0x40)
+	pool = append(pool, 0)
+
+	var unit []byte
+	unit = appendU16(unit, 5)
+	unit = appendU16(unit, 0)
+	unit = appendU32(unit, 1) // CUs
+	unit = appendU32(unit, 0) // Local TUs
+	unit = appendU32(unit, 0) // Foreign TUs
+	unit = appendU32(unit, 0) // Buckets
+	unit = appendU32(unit, 2) // Names
+	unit = appendU32(unit, uint32(len(abbrevs)))
+	unit = appendU32(unit, 0) // Augmentation
+	unit = appendU32(unit, 0x200)
+	unit = appendU32(unit, 1) // "main"
+	unit = appendU32(unit, 6) // "counter"
+	unit = appendU32(unit, uint32(mainOff))
+	unit = appendU32(unit, uint32(counterOff))
+	unit = append(unit, abbrevs...)
+	unit = append(unit, pool...)
+	names := appendU32(nil, uint32(len(unit)))
+	names = append(names, unit...)
+
+	// One address range set for the CU, with 64-bit addresses.
+	var ar []byte
+	ar = appendU16(ar, 2)
+	ar = appendU32(ar, 0x200)
+	ar = append(ar, 8, 0)
+	ar = append(ar, 0, 0, 0, 0) // Pad the 12-byte header to 16
+	ar = appendU64(ar, 0x4000)
+	ar = appendU64(ar, 0x100)
+	ar = appendU64(ar, 0)
+	ar = appendU64(ar, 0)
+	aranges := appendU32(nil, uint32(len(ar)))
+	aranges = append(aranges, ar...)
+
+	// A version 5 compile unit header is 12 bytes.
+	info := appendUnit(nil, 0x200, 5)
+	x, err := ParseDebugNames(names, str, aranges, info, binary.LittleEndian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := x.Lookup("main"), []Entry{{0x20c, 0x22a, dwarf.TagSubprogram}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Lookup(main) = %v; want %v", got, want)
+	}
+	if got, want := x.Lookup("counter"), []Entry{{0x20c, 0x240, dwarf.TagVariable}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Lookup(counter) = %v; want %v", got, want)
+	}
+	if cu, ok := x.AddrToCU(0x40ff); !ok || cu != 0x20c {
+		t.Errorf("AddrToCU(0x40ff) = %#x, %v; want 0x20c, true", cu, ok)
+	}
+}
+
+// appendUnit pads info to off and appends a 32-bit DWARF compile
+// unit header of the given version with no DIEs.
+func appendUnit(info []byte, off int, version uint16) []byte {
+	for len(info) < off {
+		info = append(info, 0)
+	}
+	if version >= 5 {
+		info = appendU32(info, 8)
+		info = appendU16(info, version)
+		info = append(info, 1, 8) // DW_UT_compile, address size
+		return appendU32(info, 0)
+	}
+	info = appendU32(info, 7)
+	info = appendU16(info, version)
+	info = appendU32(info, 0)
+	return append(info, 8)
+}
+
+func appendU16(b []byte, v uint16) []byte {
+	return append(b, byte(v), byte(v>>8))
+}
+
+func appendU32(b []byte, v uint32) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+func appendU64(b []byte, v uint64) []byte {
+	return appendU32(appendU32(b, uint32(v)), uint32(v>>32))
+}
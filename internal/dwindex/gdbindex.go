@@ -0,0 +1,108 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dwindex
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"encoding/binary"
+	"fmt"
+)
+
+// ParseGdbIndex parses a version 7 or 8 .gdb_index section. info is
+// the .debug_info section, which is needed to find each compile
+// unit's top-level DIE.
+//
+// See https://sourceware.org/gdb/current/onlinedocs/gdb/Index-Section-Format.html.
+func ParseGdbIndex(data, info []byte, order binary.ByteOrder) (*Index, error) {
+	le := binary.LittleEndian
+	if len(data) < 24 {
+		return nil, formatError("dwindex: .gdb_index too short")
+	}
+	version := le.Uint32(data)
+	if version < 7 || version > 8 {
+		return nil, fmt.Errorf("dwindex: unsupported .gdb_index version %d", version)
+	}
+	var offs [5]uint32
+	for i := range offs {
+		offs[i] = le.Uint32(data[4+4*i:])
+		if offs[i] > uint32(len(data)) || (i > 0 && offs[i] < offs[i-1]) {
+			return nil, formatError("dwindex: bad .gdb_index header")
+		}
+	}
+	cuList := data[offs[0]:offs[1]]
+	addrArea := data[offs[2]:offs[3]]
+	symTab := data[offs[3]:offs[4]]
+	pool := data[offs[4]:]
+
+	x := newIndex("gdb_index")
+
+	// The CU list is pairs of 64-bit offset and length.
+	units := &unitDIEs{info: info, order: order}
+	var cus []dwarf.Offset
+	for ; len(cuList) >= 16; cuList = cuList[16:] {
+		cu, err := units.get(le.Uint64(cuList))
+		if err != nil {
+			return nil, err
+		}
+		cus = append(cus, cu)
+	}
+
+	// The address area is triples of 64-bit low and high
+	// addresses and a 32-bit CU index.
+	for ; len(addrArea) >= 20; addrArea = addrArea[20:] {
+		low, high, cu := le.Uint64(addrArea), le.Uint64(addrArea[8:]), le.Uint32(addrArea[16:])
+		if int(cu) >= len(cus) {
+			continue
+		}
+		x.cus = append(x.cus, Range{low, high, cus[cu]})
+	}
+
+	// The symbol table is an open-addressed hash table of pairs
+	// of constant pool offsets of the name and CU vector.
+	for ; len(symTab) >= 8; symTab = symTab[8:] {
+		nameOff, vecOff := le.Uint32(symTab), le.Uint32(symTab[4:])
+		if nameOff == 0 && vecOff == 0 {
+			continue
+		}
+		if int(nameOff) >= len(pool) || int(vecOff)+4 > len(pool) {
+			return nil, formatError("dwindex: bad .gdb_index symbol table")
+		}
+		name := pool[nameOff:]
+		if i := bytes.IndexByte(name, 0); i >= 0 {
+			name = name[:i]
+		}
+		vec := pool[vecOff:]
+		n := int(le.Uint32(vec))
+		if 4+4*n > len(vec) {
+			return nil, formatError("dwindex: bad .gdb_index CU vector")
+		}
+		for i := 0; i < n; i++ {
+			// The low 24 bits are the CU index, and bits
+			// 28-30 are the symbol kind.
+			v := le.Uint32(vec[4+4*i:])
+			cu := int(v & 0xffffff)
+			if cu >= len(cus) {
+				// A type unit.
+				continue
+			}
+			var tag dwarf.Tag
+			switch (v >> 28) & 7 {
+			case 1:
+				// Types aren't useful for symbol
+				// lookups.
+				continue
+			case 2:
+				tag = dwarf.TagVariable
+			case 3:
+				tag = dwarf.TagSubprogram
+			}
+			x.addName(string(name), Entry{CU: cus[cu], Tag: tag})
+		}
+	}
+
+	x.sort()
+	return x, nil
+}
@@ -0,0 +1,296 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package elfobj writes minimal ELF relocatable object files.
+//
+// A File consists of sections with contents, symbols that are either
+// defined in those sections or undefined, and relocations in those
+// sections against the symbols. The writer adds the symbol, string,
+// and relocation sections.
+package elfobj
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// A File is a relocatable object file.
+type File struct {
+	Class   elf.Class // ELFCLASS32 or ELFCLASS64
+	Data    elf.Data  // ELFDATA2LSB or ELFDATA2MSB
+	Machine elf.Machine
+
+	Sections []*Section
+	Symbols  []*Symbol
+}
+
+// A Section is a section of a File with contents.
+type Section struct {
+	Name  string
+	Type  elf.SectionType // Usually SHT_PROGBITS
+	Flags elf.SectionFlag
+	Align uint64
+	Data  []byte
+
+	// Relocs are the relocations to apply to Data. In a 64-bit
+	// File, they're written with explicit addends. In a 32-bit
+	// File, they're written without addends, as most 32-bit
+	// linkers expect, so the addends must already be stored in
+	// Data and Reloc.Addend is ignored.
+	Relocs []Reloc
+}
+
+// A Symbol is a symbol of a File.
+type Symbol struct {
+	Name string
+	Bind elf.SymBind
+	Type elf.SymType
+	// Section is the section defining this symbol, or nil if this
+	// symbol is undefined.
+	Section *Section
+	// Value is the offset of the symbol in Section.
+	Value uint64
+	Size  uint64
+}
+
+// A Reloc is a relocation in a Section.
+type Reloc struct {
+	// Offset is the offset in the section to relocate.
+	Offset uint64
+	// Type is the machine-specific relocation type, such as
+	// elf.R_X86_64_PC32.
+	Type uint32
+	// Sym is the symbol the relocation refers to, or nil if
+	// Type doesn't refer to a symbol.
+	Sym    *Symbol
+	Addend int64
+}
+
+// WriteTo writes the ELF encoding of f to w.
+func (f *File) WriteTo(w io.Writer) (int64, error) {
+	buf, err := f.encode()
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(buf)
+	return int64(n), err
+}
+
+// shdr is a section header in a class-independent form.
+type shdr struct {
+	name           string
+	typ            elf.SectionType
+	flags          elf.SectionFlag
+	off, size      uint64
+	link, info     uint32
+	align, entsize uint64
+	nameOff        uint32
+}
+
+// strtab accumulates an ELF string table.
+type strtab struct {
+	buf  bytes.Buffer
+	offs map[string]uint32
+}
+
+func (t *strtab) add(s string) uint32 {
+	if t.offs == nil {
+		t.buf.WriteByte(0)
+		t.offs = map[string]uint32{"": 0}
+	}
+	if off, ok := t.offs[s]; ok {
+		return off
+	}
+	off := uint32(t.buf.Len())
+	t.buf.WriteString(s)
+	t.buf.WriteByte(0)
+	t.offs[s] = off
+	return off
+}
+
+func (f *File) encode() ([]byte, error) {
+	var order binary.ByteOrder
+	switch f.Data {
+	case elf.ELFDATA2LSB:
+		order = binary.LittleEndian
+	case elf.ELFDATA2MSB:
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("unsupported ELF data encoding %v", f.Data)
+	}
+	is64 := false
+	switch f.Class {
+	case elf.ELFCLASS64:
+		is64 = true
+	case elf.ELFCLASS32:
+	default:
+		return nil, fmt.Errorf("unsupported ELF class %v", f.Class)
+	}
+
+	// Section 0 is the null section, followed by f's sections.
+	sectIdx := make(map[*Section]int)
+	for i, s := range f.Sections {
+		sectIdx[s] = i + 1
+	}
+
+	// Local symbols must precede global symbols. Symbol 0 is
+	// the null symbol.
+	symIdx := make(map[*Symbol]int)
+	syms := []*Symbol{nil}
+	firstGlobal := 0
+	for pass := 0; pass < 2; pass++ {
+		if pass == 1 {
+			firstGlobal = len(syms)
+		}
+		for _, sym := range f.Symbols {
+			if (sym.Bind == elf.STB_LOCAL) == (pass == 0) {
+				symIdx[sym] = len(syms)
+				syms = append(syms, sym)
+			}
+		}
+	}
+
+	var out bytes.Buffer
+	var hdrSize, shdrSize, symSize, relSize uint64 = 52, 40, 16, 8
+	if is64 {
+		hdrSize, shdrSize, symSize, relSize = 64, 64, 24, 24
+	}
+	wordAlign := uint64(4)
+	if is64 {
+		wordAlign = 8
+	}
+	out.Write(make([]byte, hdrSize))
+	pad := func(align uint64) {
+		for align > 1 && uint64(out.Len())%align != 0 {
+			out.WriteByte(0)
+		}
+	}
+	write := func(v interface{}) {
+		binary.Write(&out, order, v)
+	}
+
+	shdrs := []shdr{{}}
+	for _, s := range f.Sections {
+		pad(s.Align)
+		h := shdr{name: s.Name, typ: s.Type, flags: s.Flags, off: uint64(out.Len()), size: uint64(len(s.Data)), align: s.Align}
+		if s.Type != elf.SHT_NOBITS {
+			out.Write(s.Data)
+		}
+		shdrs = append(shdrs, h)
+	}
+
+	// The symbol table follows the relocation sections.
+	symtabIdx := len(shdrs)
+	for _, s := range f.Sections {
+		if len(s.Relocs) > 0 {
+			symtabIdx++
+		}
+	}
+	for _, s := range f.Sections {
+		if len(s.Relocs) == 0 {
+			continue
+		}
+		pad(wordAlign)
+		h := shdr{link: uint32(symtabIdx), info: uint32(sectIdx[s]), flags: elf.SHF_INFO_LINK, off: uint64(out.Len()), align: wordAlign, entsize: relSize}
+		for _, r := range s.Relocs {
+			si, ok := symIdx[r.Sym]
+			if !ok && r.Sym != nil {
+				return nil, fmt.Errorf("relocation in %s at %#x refers to a symbol not in the file", s.Name, r.Offset)
+			}
+			if is64 {
+				write(elf.Rela64{Off: r.Offset, Info: elf.R_INFO(uint32(si), r.Type), Addend: r.Addend})
+			} else {
+				write(elf.Rel32{Off: uint32(r.Offset), Info: elf.R_INFO32(uint32(si), r.Type)})
+			}
+		}
+		if is64 {
+			h.name, h.typ = ".rela"+s.Name, elf.SHT_RELA
+		} else {
+			h.name, h.typ = ".rel"+s.Name, elf.SHT_REL
+		}
+		h.size = uint64(out.Len()) - h.off
+		shdrs = append(shdrs, h)
+	}
+
+	var strs strtab
+	strs.add("")
+	pad(wordAlign)
+	symtab := shdr{name: ".symtab", typ: elf.SHT_SYMTAB, off: uint64(out.Len()), link: uint32(symtabIdx + 1), info: uint32(firstGlobal), align: wordAlign, entsize: symSize}
+	for _, sym := range syms {
+		if sym == nil {
+			out.Write(make([]byte, symSize))
+			continue
+		}
+		shndx := uint16(elf.SHN_UNDEF)
+		if sym.Section != nil {
+			i, ok := sectIdx[sym.Section]
+			if !ok {
+				return nil, fmt.Errorf("symbol %s is in a section not in the file", sym.Name)
+			}
+			shndx = uint16(i)
+		}
+		name := strs.add(sym.Name)
+		info := elf.ST_INFO(sym.Bind, sym.Type)
+		if is64 {
+			write(elf.Sym64{Name: name, Info: info, Shndx: shndx, Value: sym.Value, Size: sym.Size})
+		} else {
+			write(elf.Sym32{Name: name, Value: uint32(sym.Value), Size: uint32(sym.Size), Info: info, Shndx: shndx})
+		}
+	}
+	symtab.size = uint64(out.Len()) - symtab.off
+	shdrs = append(shdrs, symtab)
+
+	shdrs = append(shdrs, shdr{name: ".strtab", typ: elf.SHT_STRTAB, off: uint64(out.Len()), size: uint64(strs.buf.Len()), align: 1})
+	out.Write(strs.buf.Bytes())
+
+	// The section names include .shstrtab itself, so fill in its
+	// location after adding them.
+	var shstrs strtab
+	shdrs = append(shdrs, shdr{name: ".shstrtab", typ: elf.SHT_STRTAB, align: 1})
+	for i := range shdrs {
+		if i > 0 {
+			shdrs[i].nameOff = shstrs.add(shdrs[i].name)
+		}
+	}
+	sh := &shdrs[len(shdrs)-1]
+	sh.off, sh.size = uint64(out.Len()), uint64(shstrs.buf.Len())
+	out.Write(shstrs.buf.Bytes())
+
+	pad(wordAlign)
+	shoff := uint64(out.Len())
+	for _, h := range shdrs {
+		if is64 {
+			write(elf.Section64{Name: h.nameOff, Type: uint32(h.typ), Flags: uint64(h.flags), Off: h.off, Size: h.size, Link: h.link, Info: h.info, Addralign: h.align, Entsize: h.entsize})
+		} else {
+			write(elf.Section32{Name: h.nameOff, Type: uint32(h.typ), Flags: uint32(h.flags), Off: uint32(h.off), Size: uint32(h.size), Link: h.link, Info: h.info, Addralign: uint32(h.align), Entsize: uint32(h.entsize)})
+		}
+	}
+
+	// Fill in the file header.
+	buf := out.Bytes()
+	var ident [elf.EI_NIDENT]byte
+	copy(ident[:], elf.ELFMAG)
+	ident[elf.EI_CLASS] = byte(f.Class)
+	ident[elf.EI_DATA] = byte(f.Data)
+	ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	var hdr bytes.Buffer
+	if is64 {
+		binary.Write(&hdr, order, elf.Header64{
+			Ident: ident, Type: uint16(elf.ET_REL), Machine: uint16(f.Machine), Version: uint32(elf.EV_CURRENT),
+			Shoff: shoff, Ehsize: uint16(hdrSize), Shentsize: uint16(shdrSize),
+			Shnum: uint16(len(shdrs)), Shstrndx: uint16(len(shdrs) - 1),
+		})
+	} else {
+		binary.Write(&hdr, order, elf.Header32{
+			Ident: ident, Type: uint16(elf.ET_REL), Machine: uint16(f.Machine), Version: uint32(elf.EV_CURRENT),
+			Shoff: uint32(shoff), Ehsize: uint16(hdrSize), Shentsize: uint16(shdrSize),
+			Shnum: uint16(len(shdrs)), Shstrndx: uint16(len(shdrs) - 1),
+		})
+	}
+	copy(buf, hdr.Bytes())
+	return buf, nil
+}
@@ -0,0 +1,139 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package elfobj
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"testing"
+)
+
+// testFile returns a File with a function calling an undefined
+// function, plus a local helper symbol.
+func testFile(class elf.Class, machine elf.Machine, call uint32) *File {
+	text := &Section{
+		Name:  ".text",
+		Type:  elf.SHT_PROGBITS,
+		Flags: elf.SHF_ALLOC | elf.SHF_EXECINSTR,
+		Align: 16,
+		// CALL rel32; RET
+		Data: []byte{0xe8, 0, 0, 0, 0, 0xc3},
+	}
+	fn := &Symbol{Name: "f", Bind: elf.STB_GLOBAL, Type: elf.STT_FUNC, Section: text, Size: 6}
+	local := &Symbol{Name: "ret", Bind: elf.STB_LOCAL, Type: elf.STT_NOTYPE, Section: text, Value: 5}
+	g := &Symbol{Name: "g", Bind: elf.STB_GLOBAL}
+	text.Relocs = []Reloc{{Offset: 1, Type: call, Sym: g, Addend: -4}}
+	return &File{
+		Class:    class,
+		Data:     elf.ELFDATA2LSB,
+		Machine:  machine,
+		Sections: []*Section{text},
+		// Put a global first to check that locals are sorted
+		// first.
+		Symbols: []*Symbol{fn, local, g},
+	}
+}
+
+func TestWrite(t *testing.T) {
+	for _, test := range []struct {
+		class   elf.Class
+		machine elf.Machine
+		call    uint32
+		rel     string
+	}{
+		{elf.ELFCLASS64, elf.EM_X86_64, uint32(elf.R_X86_64_PLT32), ".rela.text"},
+		{elf.ELFCLASS32, elf.EM_386, uint32(elf.R_386_PC32), ".rel.text"},
+	} {
+		t.Run(test.class.String(), func(t *testing.T) {
+			var buf bytes.Buffer
+			if _, err := testFile(test.class, test.machine, test.call).WriteTo(&buf); err != nil {
+				t.Fatal(err)
+			}
+			f, err := elf.NewFile(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if f.Type != elf.ET_REL || f.Machine != test.machine || f.Class != test.class {
+				t.Errorf("got %v %v %v, want ET_REL %v %v", f.Type, f.Machine, f.Class, test.machine, test.class)
+			}
+
+			text := f.Section(".text")
+			if text == nil {
+				t.Fatal("no .text section")
+			}
+			data, err := text.Data()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := []byte{0xe8, 0, 0, 0, 0, 0xc3}; !bytes.Equal(data, want) {
+				t.Errorf(".text is %x, want %x", data, want)
+			}
+			if text.Addralign != 16 || text.Flags != elf.SHF_ALLOC|elf.SHF_EXECINSTR {
+				t.Errorf(".text has align %d and flags %v", text.Addralign, text.Flags)
+			}
+
+			syms, err := f.Symbols()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, s := range syms {
+				names = append(names, s.Name)
+			}
+			if len(syms) != 3 || syms[0].Name != "ret" || syms[1].Name != "f" || syms[2].Name != "g" {
+				t.Fatalf("got symbols %q, want [ret f g]", names)
+			}
+			if syms[1].Section != elf.SectionIndex(1) || syms[1].Size != 6 || elf.ST_TYPE(syms[1].Info) != elf.STT_FUNC {
+				t.Errorf("bad symbol f %+v", syms[1])
+			}
+			if syms[2].Section != elf.SHN_UNDEF {
+				t.Errorf("symbol g is in section %v, want undefined", syms[2].Section)
+			}
+			symtab := f.Section(".symtab")
+			if symtab.Info != 2 {
+				t.Errorf(".symtab info is %d, want first global 2", symtab.Info)
+			}
+
+			rel := f.Section(test.rel)
+			if rel == nil {
+				t.Fatalf("no %s section", test.rel)
+			}
+			if rel.Info != 1 || f.Sections[rel.Link] != symtab {
+				t.Errorf("%s links to section %d and symbols %d", test.rel, rel.Info, rel.Link)
+			}
+			rdata, err := rel.Data()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var off uint64
+			var sym, typ uint32
+			if test.class == elf.ELFCLASS64 {
+				var r elf.Rela64
+				binary.Read(bytes.NewReader(rdata), binary.LittleEndian, &r)
+				off, sym, typ = r.Off, elf.R_SYM64(r.Info), elf.R_TYPE64(r.Info)
+				if r.Addend != -4 {
+					t.Errorf("addend is %d, want -4", r.Addend)
+				}
+			} else {
+				var r elf.Rel32
+				binary.Read(bytes.NewReader(rdata), binary.LittleEndian, &r)
+				off, sym, typ = uint64(r.Off), elf.R_SYM32(r.Info), elf.R_TYPE32(r.Info)
+			}
+			// Symbol indexes count the null symbol.
+			if off != 1 || sym != 3 || typ != test.call {
+				t.Errorf("got reloc at %d to symbol %d type %d, want at 1 to 3 type %d", off, sym, typ, test.call)
+			}
+		})
+	}
+}
+
+func TestUnknownSymbol(t *testing.T) {
+	f := testFile(elf.ELFCLASS64, elf.EM_X86_64, uint32(elf.R_X86_64_PLT32))
+	f.Symbols = f.Symbols[:2]
+	if _, err := f.WriteTo(new(bytes.Buffer)); err == nil {
+		t.Error("want error for relocation to a symbol not in the file")
+	}
+}
@@ -4,22 +4,80 @@
 
 package functab
 
-import "encoding/binary"
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
 
+// A FormatError reports that a function table is malformed.
+type FormatError struct {
+	// Off is the offset in the pclntab of the malformed data.
+	Off uint64
+	Msg string
+}
+
+func (e *FormatError) Error() string {
+	return fmt.Sprintf("pclntab appears corrupted at offset %#x: %s", e.Off, e.Msg)
+}
+
+// A decoder reads values from data. Reads past the end of data return
+// zero values and record an error in err, so callers can decode a
+// whole structure and check err once at the end.
 type decoder struct {
 	order   binary.ByteOrder
 	ptrSize int
 	data    []byte
 	pos     uint64
+
+	// base is the offset of data in the pclntab, for errors.
+	base uint64
+	err  error
+}
+
+// fail records an error at offset off in data, unless d already has
+// an error.
+func (d *decoder) fail(off uint64, msg string) {
+	if d.err == nil {
+		d.err = &FormatError{d.base + off, msg}
+	}
+}
+
+// need reports whether data has n more bytes. If it doesn't, need
+// records an error.
+func (d *decoder) need(n uint64) bool {
+	if d.err != nil {
+		return false
+	}
+	if d.pos > uint64(len(d.data)) || n > uint64(len(d.data))-d.pos {
+		d.fail(d.pos, "unexpected end of data")
+		return false
+	}
+	return true
+}
+
+// needArray is like need, but for n elements of size bytes each.
+func (d *decoder) needArray(n, size uint64) bool {
+	if d.err == nil && size != 0 && n > uint64(len(d.data))/size {
+		d.fail(d.pos, fmt.Sprintf("count %d too large", n))
+		return false
+	}
+	return d.need(n * size)
 }
 
 func (d *decoder) Bytes(n uint64) []byte {
+	if !d.need(n) {
+		return nil
+	}
 	v := d.data[d.pos : d.pos+n]
 	d.pos += n
 	return v
 }
 
 func (d *decoder) Uint8() uint8 {
+	if !d.need(1) {
+		return 0
+	}
 	v := d.data[d.pos]
 	d.pos++
 	return v
@@ -30,6 +88,9 @@ func (d *decoder) Int8() int8 {
 }
 
 func (d *decoder) Uint16() uint16 {
+	if !d.need(2) {
+		return 0
+	}
 	v := d.order.Uint16(d.data[d.pos:])
 	d.pos += 2
 	return v
@@ -40,6 +101,9 @@ func (d *decoder) Int16() int16 {
 }
 
 func (d *decoder) Uint32() uint32 {
+	if !d.need(4) {
+		return 0
+	}
 	v := d.order.Uint32(d.data[d.pos:])
 	d.pos += 4
 	return v
@@ -50,6 +114,9 @@ func (d *decoder) Int32() int32 {
 }
 
 func (d *decoder) Ptr() uint64 {
+	if !d.need(uint64(d.ptrSize)) {
+		return 0
+	}
 	var v uint64
 	switch d.ptrSize {
 	case 4:
@@ -64,22 +131,41 @@ func (d *decoder) Ptr() uint64 {
 }
 
 func (d *decoder) CString() string {
-	start := d.pos
-	for d.data[d.pos] != 0 {
-		d.pos++
+	if !d.need(0) {
+		return ""
 	}
-	d.pos++
-	return string(d.data[start : d.pos-1])
+	n := bytes.IndexByte(d.data[d.pos:], 0)
+	if n < 0 {
+		d.fail(d.pos, "unterminated string")
+		return ""
+	}
+	v := string(d.data[d.pos : d.pos+uint64(n)])
+	d.pos += uint64(n) + 1
+	return v
 }
 
 func (d *decoder) Varint() int64 {
+	if !d.need(0) {
+		return 0
+	}
 	val, read := binary.Varint(d.data[d.pos:])
+	if read <= 0 {
+		d.fail(d.pos, "bad varint")
+		return 0
+	}
 	d.pos += uint64(read)
 	return val
 }
 
 func (d *decoder) Uvarint() uint64 {
+	if !d.need(0) {
+		return 0
+	}
 	val, read := binary.Uvarint(d.data[d.pos:])
+	if read <= 0 {
+		d.fail(d.pos, "bad varint")
+		return 0
+	}
 	d.pos += uint64(read)
 	return val
 }
@@ -11,7 +11,7 @@ import (
 	"fmt"
 	"strings"
 
-	"github.com/aclements/objbrowse/internal/obj"
+	"github.com/aclements/objbrowse/obj"
 )
 
 type FuncTab struct {
@@ -24,22 +24,29 @@ type FuncTab struct {
 	_PCDATA_StackMapIndex       int
 	_FUNCDATA_ArgsPointerMaps   int
 	_FUNCDATA_LocalsPointerMaps int
-}
 
-type Func struct {
-	PC       uint64
-	Name     string
-	PCSP     PCData
-	PCData   []PCData
-	FuncData []FuncData
-	ft       *FuncTab
+	fi         *fileInfo
+	version    pclnVersion
+	data       []byte // pclntab
+	fileTabOff uint32 // Go 1.2 format only
+
+	// Subtables of data in the Go 1.16 and later formats.
+	funcnameTab, cuTab, fileTab, pcTab []byte
 }
 
-type symtabHdr struct {
-	Magic     uint32
-	_         uint16
-	PCQuantum uint8
-	PtrSize   uint8
+type Func struct {
+	PC          uint64
+	Name        string
+	Args        int32
+	Deferreturn uint32
+	FuncID      uint8
+	PCSP        PCData
+	PCFile      PCData
+	PCLn        PCData
+	PCData      []PCData
+	FuncData    []FuncData
+	ft          *FuncTab
+	cuOff       uint32 // Go 1.16 and later formats only
 }
 
 type fileInfo struct {
@@ -49,33 +56,92 @@ type fileInfo struct {
 	pcQuantum uint8
 }
 
+// pclnVersion identifies a pclntab format.
+type pclnVersion int
+
+const (
+	ver12  pclnVersion = iota // Go 1.2 through 1.15
+	ver116                    // Go 1.16 and 1.17
+	ver118                    // Go 1.18 and 1.19
+	ver120                    // Go 1.20 and later
+)
+
+// pclnMagics maps the magic number in the pclntab header to the
+// format version.
+var pclnMagics = map[uint32]pclnVersion{
+	0xfffffffb: ver12,
+	0xfffffffa: ver116,
+	0xfffffff0: ver118,
+	0xfffffff1: ver120,
+}
+
 // NewFuncTab decodes a Go function table from data, which should be
 // the contents of the "runtime.pclntab" symbol in the object file
 // given by obj.
+//
+// If obj has no DWARF, or its DWARF doesn't define the runtime's
+// PCDATA and FUNCDATA indexes (which Go 1.20 and later don't), it
+// assumes the indexes used by the toolchain that produced the table
+// format.
 func NewFuncTab(data []byte, obj obj.Obj) (*FuncTab, error) {
-	var err error
+	if len(data) < 8 {
+		return nil, fmt.Errorf("pclntab too short")
+	}
 	var order binary.ByteOrder
-	var hdr symtabHdr
+	var version pclnVersion
 	for _, order = range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
-		if err := binary.Read(bytes.NewBuffer(data), order, &hdr); err != nil {
-			return nil, err
-		}
-		if hdr.Magic == 0xfffffffb {
+		if v, ok := pclnMagics[order.Uint32(data)]; ok {
+			version = v
 			goto hdrGood
 		}
 	}
-	return nil, fmt.Errorf("bad magic word in header %#x", hdr.Magic)
+	return nil, fmt.Errorf("bad magic word in header %#x", binary.LittleEndian.Uint32(data))
 hdrGood:
+	pcQuantum, ptrSize := data[6], data[7]
+	if ptrSize != 4 && ptrSize != 8 {
+		return nil, fmt.Errorf("bad pointer size %d in header", ptrSize)
+	}
 
-	d := decoder{order: order, ptrSize: int(hdr.PtrSize), data: data, pos: 8}
-	fi := &fileInfo{obj, d.order, d.ptrSize, hdr.PCQuantum}
+	d := decoder{order: order, ptrSize: int(ptrSize), data: data, pos: 8}
+	fi := &fileInfo{obj, d.order, d.ptrSize, pcQuantum}
 
-	ft := new(FuncTab)
+	ft := &FuncTab{fi: fi, version: version, data: data}
+
+	// Extract the PCDATA and FUNCDATA index definitions.
+	ft.Indexes = defaultIndexes(version)
+	if dw, err := obj.DWARF(); err == nil {
+		if indexes, err := getDataIndexes(dw); err == nil {
+			ft.Indexes = indexes
+		}
+	}
+	ft._PCDATA_StackMapIndex = int(ft.Indexes["_PCDATA_StackMapIndex"])
+	ft._FUNCDATA_ArgsPointerMaps = int(ft.Indexes["_FUNCDATA_ArgsPointerMaps"])
+	ft._FUNCDATA_LocalsPointerMaps = int(ft.Indexes["_FUNCDATA_LocalsPointerMaps"])
+
+	var err error
+	if version == ver12 {
+		err = ft.readFuncs12(&d)
+	} else {
+		err = ft.readFuncs116(&d)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ft, nil
+}
+
+// readFuncs12 reads the function table in the Go 1.2 format. d is
+// positioned just after the header.
+func (ft *FuncTab) readFuncs12(d *decoder) error {
+	fi, data := ft.fi, ft.data
 
 	// Read func PC/offset table.
 	//
 	// See cmd/link/internal/ld/pcln.go:pclntab
 	nfunc := d.Ptr()
+	if !d.needArray(nfunc, 2*uint64(d.ptrSize)) {
+		return d.err
+	}
 	ft.Funcs = make([]*Func, nfunc)
 	offsets := make([]uint64, nfunc)
 	for i := range offsets {
@@ -83,29 +149,15 @@ hdrGood:
 		offsets[i] = d.Ptr()
 	}
 	ft.EndPC = d.Ptr()
-	d.Uint32() // fileTabOffset
+	ft.fileTabOff = d.Uint32()
 
-	// Extract the PCDATA and FUNCDATA index definitions.
-	dw, err := obj.DWARF()
-	if err != nil {
-		return nil, err
-	}
-	ft.Indexes, err = getDataIndexes(dw)
-	if err != nil {
-		return nil, err
-	}
-	fetchIndex := func(name string, out *int) {
-		val, ok := ft.Indexes[name]
-		if !ok && err == nil {
-			err = fmt.Errorf("missing definition of %s", name)
+	pcData := func(pc uint64) PCData {
+		off := d.Uint32()
+		if uint64(off) > uint64(len(data)) {
+			d.fail(d.pos-4, "PC table offset out of range")
+			return PCData{fi, pc, nil}
 		}
-		*out = int(val)
-	}
-	fetchIndex("_PCDATA_StackMapIndex", &ft._PCDATA_StackMapIndex)
-	fetchIndex("_FUNCDATA_ArgsPointerMaps", &ft._FUNCDATA_ArgsPointerMaps)
-	fetchIndex("_FUNCDATA_LocalsPointerMaps", &ft._FUNCDATA_LocalsPointerMaps)
-	if err != nil {
-		return nil, err
+		return PCData{fi, pc, data[off:]}
 	}
 
 	// Read func structures.
@@ -116,22 +168,23 @@ hdrGood:
 		// See runtime/runtime2.go:_func
 		pc := d.Ptr()
 		nameoff := d.Int32()
-		d.Int32()  // args
-		d.Uint32() // deferreturn
-		pcspOff := d.Uint32()
-		pcsp := PCData{fi, pc, data[pcspOff:]}
-		d.Uint32() // pcfile
-		d.Uint32() // pcln
+		args := d.Int32()
+		deferreturn := d.Uint32()
+		pcsp := pcData(pc)
+		pcfile := pcData(pc)
+		pcln := pcData(pc)
 		npcdata := d.Uint32()
-		d.Uint8()  // funcID
+		funcID := d.Uint8()
 		d.Uint16() // unused
 		nfuncdata := d.Uint8()
 
 		// PC data offsets (npcdata * uint32)
+		if !d.needArray(uint64(npcdata), 4) {
+			return d.err
+		}
 		pcdata := make([]PCData, npcdata)
 		for i := range pcdata {
-			off := d.Uint32()
-			pcdata[i] = PCData{fi, pc, data[off:]}
+			pcdata[i] = pcData(pc)
 		}
 
 		// Func data offsets (nfuncdata * ptr)
@@ -145,14 +198,212 @@ hdrGood:
 		}
 
 		// Get name.
-		d.pos = uint64(nameoff)
+		d.pos = uint64(uint32(nameoff))
 		name := d.CString()
+		if d.err != nil {
+			return d.err
+		}
 
-		fn := &Func{pc, name, pcsp, pcdata, funcdata, ft}
+		fn := &Func{pc, name, args, deferreturn, funcID, pcsp, pcfile, pcln, pcdata, funcdata, ft, 0}
 		ft.Funcs[i] = fn
 	}
+	return nil
+}
 
-	return ft, nil
+// readFuncs116 reads the function table in the Go 1.16 and later
+// formats, which split the table into subtables. d is positioned
+// just after the header.
+//
+// See cmd/link/internal/ld/pcln.go:writeHeader and runtime/symtab.go.
+func (ft *FuncTab) readFuncs116(d *decoder) error {
+	fi, data := ft.fi, ft.data
+
+	nfunc := d.Ptr()
+	d.Ptr() // nfiles
+	var textStart uint64
+	if ft.version >= ver118 {
+		textStart = d.Ptr()
+		if textStart == 0 {
+			// Position-independent binaries relocate
+			// this, so fall back to the symbol.
+			textStart = symAddr(fi.mmap, "runtime.text")
+		}
+	}
+	subtable := func() []byte {
+		off := d.Ptr()
+		if off > uint64(len(data)) {
+			d.fail(d.pos-uint64(d.ptrSize), "subtable offset out of range")
+			return nil
+		}
+		return data[off:]
+	}
+	ft.funcnameTab = subtable()
+	ft.cuTab = subtable()
+	ft.fileTab = subtable()
+	ft.pcTab = subtable()
+	funcTab := subtable()
+	if d.err != nil {
+		return d.err
+	}
+	funcTabOff := uint64(len(data) - len(funcTab))
+
+	// Since Go 1.18, FUNCDATA are offsets from the go:func.*
+	// symbol.
+	var goFunc uint64
+	if ft.version >= ver118 {
+		goFunc = symAddr(fi.mmap, "go:func.*")
+		if goFunc == 0 {
+			goFunc = symAddr(fi.mmap, "go.func.*")
+		}
+	}
+
+	// The function table is pairs of entry PC and _func offset,
+	// followed by the end PC. Since Go 1.18, these are 32-bit
+	// offsets from textStart.
+	fd := &decoder{order: fi.order, ptrSize: fi.ptrSize, data: funcTab, base: funcTabOff}
+	readEntry := func() (pc, off uint64) {
+		if ft.version == ver116 {
+			return fd.Ptr(), fd.Ptr()
+		}
+		return textStart + uint64(fd.Uint32()), uint64(fd.Uint32())
+	}
+	entrySize := uint64(8)
+	if ft.version == ver116 {
+		entrySize = 2 * uint64(fd.ptrSize)
+	}
+	if !fd.needArray(nfunc, entrySize) {
+		return fd.err
+	}
+	ft.Funcs = make([]*Func, nfunc)
+	offsets := make([]uint64, nfunc)
+	for i := range offsets {
+		_, offsets[i] = readEntry()
+	}
+	ft.EndPC, _ = readEntry()
+
+	pcData := func(pc uint64, off uint32) PCData {
+		// Offset 0 means there is no table.
+		if off == 0 {
+			return PCData{fi, pc, nil}
+		}
+		if uint64(off) > uint64(len(ft.pcTab)) {
+			fd.fail(fd.pos-4, "PC table offset out of range")
+			return PCData{fi, pc, nil}
+		}
+		return PCData{fi, pc, ft.pcTab[off:]}
+	}
+	for i := range ft.Funcs {
+		fd.pos = offsets[i]
+
+		// See runtime/runtime2.go:_func.
+		var pc uint64
+		if ft.version == ver116 {
+			pc = fd.Ptr()
+		} else {
+			pc = textStart + uint64(fd.Uint32())
+		}
+		nameoff := fd.Uint32()
+		args := fd.Int32()
+		deferreturn := fd.Uint32()
+		pcsp := pcData(pc, fd.Uint32())
+		pcfile := pcData(pc, fd.Uint32())
+		pcln := pcData(pc, fd.Uint32())
+		npcdata := fd.Uint32()
+		cuOffset := fd.Uint32()
+		if ft.version >= ver120 {
+			fd.Int32() // startLine
+		}
+		funcID := fd.Uint8()
+		fd.Uint16() // flag (since Go 1.18) and padding
+		nfuncdata := fd.Uint8()
+
+		if !fd.needArray(uint64(npcdata), 4) {
+			return fd.err
+		}
+		pcdata := make([]PCData, npcdata)
+		for i := range pcdata {
+			pcdata[i] = pcData(pc, fd.Uint32())
+		}
+
+		funcdata := make([]FuncData, nfuncdata)
+		if ft.version == ver116 {
+			if fd.ptrSize == 8 && fd.pos&4 != 0 {
+				// Func data is ptr-aligned.
+				fd.pos += 4
+			}
+			for i := range funcdata {
+				funcdata[i] = FuncData{fi, fd.Ptr()}
+			}
+		} else {
+			for i := range funcdata {
+				off := fd.Uint32()
+				if off != ^uint32(0) && goFunc != 0 {
+					funcdata[i] = FuncData{fi, goFunc + uint64(off)}
+				} else {
+					funcdata[i] = FuncData{fi, 0}
+				}
+			}
+		}
+
+		if fd.err != nil {
+			return fd.err
+		}
+		name := cString(ft.funcnameTab, nameoff)
+		ft.Funcs[i] = &Func{pc, name, args, deferreturn, funcID, pcsp, pcfile, pcln, pcdata, funcdata, ft, cuOffset}
+	}
+	return nil
+}
+
+// symAddr returns the address of the symbol named name in o, or 0 if
+// there is no such symbol.
+func symAddr(o obj.Obj, name string) uint64 {
+	syms, err := o.Symbols()
+	if err != nil {
+		return 0
+	}
+	var sym obj.Sym
+	for i := obj.SymID(0); i < syms.Len(); i++ {
+		syms.Get(i, &sym)
+		if sym.Name == name && sym.HasAddr {
+			return sym.Value
+		}
+	}
+	return 0
+}
+
+// defaultIndexes returns the runtime's PCDATA and FUNCDATA indexes
+// for the toolchains that produce pclntab format version. For the Go
+// 1.2 format, these are the Go 1.12 through 1.15 indexes.
+//
+// See runtime/symtab.go and, since Go 1.20, internal/abi/symtab.go.
+func defaultIndexes(version pclnVersion) map[string]int64 {
+	if version == ver12 {
+		return map[string]int64{
+			"_PCDATA_RegMapIndex":          0,
+			"_PCDATA_StackMapIndex":        1,
+			"_PCDATA_InlTreeIndex":         2,
+			"_FUNCDATA_ArgsPointerMaps":    0,
+			"_FUNCDATA_LocalsPointerMaps":  1,
+			"_FUNCDATA_RegPointerMaps":     2,
+			"_FUNCDATA_StackObjects":       3,
+			"_FUNCDATA_InlTree":            4,
+			"_FUNCDATA_OpenCodedDeferInfo": 5,
+		}
+	}
+	return map[string]int64{
+		"_PCDATA_UnsafePoint":          0,
+		"_PCDATA_StackMapIndex":        1,
+		"_PCDATA_InlTreeIndex":         2,
+		"_PCDATA_ArgLiveIndex":         3,
+		"_FUNCDATA_ArgsPointerMaps":    0,
+		"_FUNCDATA_LocalsPointerMaps":  1,
+		"_FUNCDATA_StackObjects":       2,
+		"_FUNCDATA_InlTree":            3,
+		"_FUNCDATA_OpenCodedDeferInfo": 4,
+		"_FUNCDATA_ArgInfo":            5,
+		"_FUNCDATA_ArgLiveInfo":        6,
+		"_FUNCDATA_WrapInfo":           7,
+	}
 }
 
 func getDataIndexes(dw *dwarf.Data) (map[string]int64, error) {
@@ -202,13 +453,109 @@ func getDataIndexes(dw *dwarf.Data) (map[string]int64, error) {
 	return indexes, nil
 }
 
+// FileName returns the name of file number i in the file table, or
+// "" if i is out of range. Since Go 1.16, file numbers are relative
+// to each function's compilation unit, so this always returns "" and
+// callers should use Func.FileName instead.
+func (ft *FuncTab) FileName(i int32) string {
+	if ft.version != ver12 {
+		return ""
+	}
+	// See cmd/link/internal/ld/pcln.go:pclntab. The file table
+	// is a count followed by uint32 offsets of file names. Entry
+	// 0 is unused.
+	off := uint64(ft.fileTabOff)
+	if i <= 0 || off+4 > uint64(len(ft.data)) {
+		return ""
+	}
+	d := decoder{order: ft.fi.order, data: ft.data, pos: off}
+	if uint32(i) >= d.Uint32() {
+		return ""
+	}
+	d.pos = off + 4*uint64(i)
+	if d.pos+4 > uint64(len(ft.data)) {
+		return ""
+	}
+	return ft.stringAt(d.Uint32())
+}
+
+// FileName returns the name of file number i as used by f's pcfile
+// table and inline tree, or "" if i is out of range.
+func (f *Func) FileName(i int32) string {
+	ft := f.ft
+	if ft.version == ver12 {
+		return ft.FileName(i)
+	}
+	// The CU table maps each CU's file numbers to offsets in
+	// the file name table.
+	off := (uint64(f.cuOff) + uint64(i)) * 4
+	if i < 0 || off+4 > uint64(len(ft.cuTab)) {
+		return ""
+	}
+	nameOff := ft.fi.order.Uint32(ft.cuTab[off:])
+	if nameOff == ^uint32(0) {
+		return ""
+	}
+	return cString(ft.fileTab, nameOff)
+}
+
+// funcName returns the function name at offset off, as used by the
+// inline tree.
+func (ft *FuncTab) funcName(off uint32) string {
+	if ft.version == ver12 {
+		return ft.stringAt(off)
+	}
+	return cString(ft.funcnameTab, off)
+}
+
+// stringAt returns the NUL-terminated string at offset off in
+// pclntab.
+func (ft *FuncTab) stringAt(off uint32) string {
+	return cString(ft.data, off)
+}
+
+// cString returns the NUL-terminated string at offset off in data.
+func cString(data []byte, off uint32) string {
+	if uint64(off) >= uint64(len(data)) {
+		return ""
+	}
+	s := data[off:]
+	if i := bytes.IndexByte(s, 0); i >= 0 {
+		s = s[:i]
+	}
+	return string(s)
+}
+
+// PCDataName returns the name of PCDATA table i, such as
+// "_PCDATA_StackMapIndex", or "" if it is not known.
+func (ft *FuncTab) PCDataName(i int) string {
+	return ft.indexName("_PCDATA_", i)
+}
+
+// FuncDataName returns the name of FUNCDATA index i, such as
+// "_FUNCDATA_LocalsPointerMaps", or "" if it is not known.
+func (ft *FuncTab) FuncDataName(i int) string {
+	return ft.indexName("_FUNCDATA_", i)
+}
+
+func (ft *FuncTab) indexName(prefix string, i int) string {
+	for name, val := range ft.Indexes {
+		if val == int64(i) && strings.HasPrefix(name, prefix) {
+			return name
+		}
+	}
+	return ""
+}
+
 type Liveness struct {
 	Index        PCTable
 	Args, Locals []Bitmap
 }
 
 func (f Func) Liveness() (Liveness, error) {
-	if len(f.PCData) <= f.ft._PCDATA_StackMapIndex {
+	if len(f.PCData) <= f.ft._PCDATA_StackMapIndex ||
+		len(f.FuncData) <= f.ft._FUNCDATA_ArgsPointerMaps ||
+		len(f.FuncData) <= f.ft._FUNCDATA_LocalsPointerMaps {
 		return Liveness{}, nil
 	}
 
@@ -14,6 +14,11 @@ type FuncData struct {
 	ptr uint64
 }
 
+// Ptr returns the address of this FUNCDATA, or 0 if it is nil.
+func (f FuncData) Ptr() uint64 {
+	return f.ptr
+}
+
 func (f FuncData) Read(size uint64) ([]byte, error) {
 	data, err := f.fi.mmap.Data(f.ptr, size)
 	if err != nil {
@@ -25,33 +30,102 @@ func (f FuncData) Read(size uint64) ([]byte, error) {
 	return data.P, nil
 }
 
+// maxEmptyStackMaps limits the number of empty bitmaps in a stack
+// map. Non-empty bitmaps are limited by the size of the data, but
+// empty ones take no space.
+const maxEmptyStackMaps = 1 << 20
+
 func (f FuncData) StackMap() ([]Bitmap, error) {
 	// Read the header
 	hdr, err := f.Read(8)
 	if err != nil {
 		return nil, err
 	}
-	d := decoder{f.fi.order, f.fi.ptrSize, hdr, 0}
+	d := decoder{order: f.fi.order, ptrSize: f.fi.ptrSize, data: hdr}
 	n := d.Uint32()
 	nbit := d.Uint32()
-	bytes := (nbit + 7) / 8
+	bytes := (uint64(nbit) + 7) / 8
+	if d.err != nil {
+		return nil, fmt.Errorf("stack map at %#x truncated", f.ptr)
+	}
+	if bytes == 0 && n > maxEmptyStackMaps {
+		return nil, fmt.Errorf("stack map at %#x has implausible count %d", f.ptr, n)
+	}
 
 	// Now we know the size, so the read the whole thing.
-	data, err := f.Read(8 + uint64(n*bytes))
+	data, err := f.Read(8 + uint64(n)*bytes)
 	if err != nil {
 		return nil, err
 	}
+	d.data = data
+	if !d.needArray(uint64(n), bytes) {
+		return nil, fmt.Errorf("stack map at %#x truncated", f.ptr)
+	}
 
 	// Read the bitmaps
-	d.data = data
 	bitmaps := make([]Bitmap, n)
 	for i := range bitmaps {
 		bitmaps[i].N = int(nbit)
-		bitmaps[i].Bytes = d.Bytes(uint64(bytes))
+		bitmaps[i].Bytes = d.Bytes(bytes)
 	}
 	return bitmaps, nil
 }
 
+// OpenCodedDeferInfo is the decoded _FUNCDATA_OpenCodedDeferInfo of
+// a function that uses open-coded defers.
+type OpenCodedDeferInfo struct {
+	// DeferBitsOffset is the frame offset of the deferBits
+	// variable.
+	DeferBitsOffset int64
+	Defers          []OpenCodedDefer
+}
+
+type OpenCodedDefer struct {
+	ArgsSize int64
+	// FnOffset is the frame offset of the closure for this defer.
+	FnOffset int64
+	Args     []OpenCodedDeferArg
+}
+
+type OpenCodedDeferArg struct {
+	Offset, Len, CallOffset int64
+}
+
+// OpenCodedDeferInfo decodes f as open-coded defer information.
+//
+// See cmd/compile/internal/gc/ssa.go:emitOpenDeferInfo.
+func (f FuncData) OpenCodedDeferInfo() (info OpenCodedDeferInfo, err error) {
+	// The encoding is variable-length, so read a generous window
+	// and decode from it.
+	const window = 512
+	data, err := f.Read(window)
+	if err != nil {
+		return info, err
+	}
+
+	d := decoder{order: f.fi.order, ptrSize: f.fi.ptrSize, data: data}
+	info.DeferBitsOffset = int64(d.Uvarint())
+	nDefers := d.Uvarint()
+	for i := uint64(0); i < nDefers && d.err == nil; i++ {
+		var od OpenCodedDefer
+		od.ArgsSize = int64(d.Uvarint())
+		od.FnOffset = int64(d.Uvarint())
+		nArgs := d.Uvarint()
+		for j := uint64(0); j < nArgs && d.err == nil; j++ {
+			var arg OpenCodedDeferArg
+			arg.Offset = int64(d.Uvarint())
+			arg.Len = int64(d.Uvarint())
+			arg.CallOffset = int64(d.Uvarint())
+			od.Args = append(od.Args, arg)
+		}
+		info.Defers = append(info.Defers, od)
+	}
+	if d.err != nil {
+		return OpenCodedDeferInfo{}, fmt.Errorf("open-coded defer info exceeds %d bytes", window)
+	}
+	return info, nil
+}
+
 type Bitmap struct {
 	N     int // number of bits
 	Bytes []byte
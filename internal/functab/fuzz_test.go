@@ -0,0 +1,249 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package functab
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/aclements/objbrowse/arch"
+	"github.com/aclements/objbrowse/obj"
+)
+
+// pcTable encodes a PC-value table from pairs of value and PC delta.
+func pcTable(pairs ...int) []byte {
+	var out []byte
+	val := -1
+	for i := 0; i < len(pairs); i += 2 {
+		out = appendVarint(out, int64(pairs[i]-val))
+		out = appendUvarint(out, uint64(pairs[i+1]))
+		val = pairs[i]
+	}
+	return append(out, 0)
+}
+
+func appendVarint(b []byte, v int64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutVarint(buf[:], v)]...)
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+func u32(b []byte, v uint32) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+func u64(b []byte, v uint64) []byte {
+	return u32(u32(b, uint32(v)), uint32(v>>32))
+}
+
+// buildPclntab120 returns a little-endian, 64-bit pclntab in the Go
+// 1.20 format with two functions. The first has stack maps and an
+// inlined call.
+func buildPclntab120() []byte {
+	const hdrSize = 8 + 8*8
+
+	// FUNCDATA follows the header: args and locals stack maps
+	// and an inline tree with one call.
+	var funcdata []byte
+	funcdata = u32(u32(funcdata, 1), 8)
+	funcdata = append(funcdata, 0x5, 0, 0, 0, 0, 0, 0, 0)
+	funcdata = u32(u32(funcdata, 1), 16)
+	funcdata = append(funcdata, 0x3, 0x1, 0, 0, 0, 0, 0, 0)
+	funcdata = append(funcdata, 0, 0, 0, 0)
+	funcdata = u32(funcdata, 11) // main.f
+	funcdata = u32(funcdata, 4)  // parentPc
+	funcdata = u32(funcdata, 0)
+
+	funcnames := []byte("\x00main.main\x00main.f\x00")
+	cuTab := u32(u32(nil, 0), 1)
+	fileTab := []byte("\x00main.go\x00")
+
+	pcTab := []byte{0}
+	tab := func(t []byte) uint32 {
+		off := uint32(len(pcTab))
+		pcTab = append(pcTab, t...)
+		return off
+	}
+	pcsp := tab(pcTable(0, 4, 8, 12))
+	pcfile := tab(pcTable(1, 16))
+	pcln := tab(pcTable(3, 4, 4, 8, 5, 4))
+	inl := tab(pcTable(-1, 4, 0, 8, -1, 4))
+	stk := tab(pcTable(0, 16))
+
+	fn := func(entry, name uint32, pcdata, funcdata []uint32) []byte {
+		var f []byte
+		f = u32(f, entry)
+		f = u32(f, name)
+		f = u32(f, 0) // args
+		f = u32(f, 0) // deferreturn
+		f = u32(f, pcsp)
+		f = u32(f, pcfile)
+		f = u32(f, pcln)
+		f = u32(f, uint32(len(pcdata)))
+		f = u32(f, 0) // cuOffset
+		f = u32(f, 0) // startLine
+		f = append(f, 0, 0, 0, byte(len(funcdata)))
+		for _, v := range pcdata {
+			f = u32(f, v)
+		}
+		for _, v := range funcdata {
+			f = u32(f, v)
+		}
+		return f
+	}
+	f0 := fn(0, 1, []uint32{0, stk, inl}, []uint32{hdrSize, hdrSize + 16, ^uint32(0), hdrSize + 32})
+	f1 := fn(16, 11, nil, nil)
+	const entries = 3 * 8
+	var funcTab []byte
+	funcTab = u32(u32(funcTab, 0), entries)
+	funcTab = u32(u32(funcTab, 16), uint32(entries+len(f0)))
+	funcTab = u32(u32(funcTab, 32), 0)
+	funcTab = append(append(funcTab, f0...), f1...)
+
+	var out []byte
+	out = u32(out, 0xfffffff1)
+	out = append(out, 0, 0, 1, 8)
+	out = u64(out, 2) // nfunc
+	out = u64(out, 1) // nfiles
+	out = u64(out, 0x1000)
+	off := uint64(hdrSize + len(funcdata))
+	for _, t := range [][]byte{funcnames, cuTab, fileTab, pcTab, funcTab} {
+		out = u64(out, off)
+		off += uint64(len(t))
+	}
+	for _, t := range [][]byte{funcdata, funcnames, cuTab, fileTab, pcTab, funcTab} {
+		out = append(out, t...)
+	}
+	return out
+}
+
+// buildPclntab12 returns a little-endian, 64-bit pclntab in the Go 1.2
+// format with one function.
+func buildPclntab12() []byte {
+	// Header and function table.
+	const funcOff = 8 + 8 + 16 + 8 + 4 + 4
+	var out []byte
+	out = u32(out, 0xfffffffb)
+	out = append(out, 0, 0, 1, 8)
+	out = u64(out, 1)
+	out = u64(u64(out, 0x1000), funcOff)
+	out = u64(out, 0x1010)
+	fileTabOff := len(out)
+	out = u32(out, 0)
+	out = u32(out, 0) // padding
+
+	// Everything after the _func is at a known offset from it.
+	const fnSize = 8 + 4*7 + 4
+	pcsp := pcTable(0, 16)
+	pcfile := pcTable(1, 16)
+	pcln := pcTable(7, 16)
+	names := uint32(funcOff + fnSize)
+	tabs := names + uint32(len("main.main\x00main.go\x00"))
+	fileTab := tabs + uint32(len(pcsp)+len(pcfile)+len(pcln))
+	binary.LittleEndian.PutUint32(out[fileTabOff:], fileTab)
+
+	out = u64(out, 0x1000)
+	out = u32(out, names)
+	out = u32(out, 0) // args
+	out = u32(out, 0) // deferreturn
+	out = u32(out, tabs)
+	out = u32(out, tabs+uint32(len(pcsp)))
+	out = u32(out, tabs+uint32(len(pcsp)+len(pcfile)))
+	out = u32(out, 0) // npcdata
+	out = append(out, 0, 0, 0, 0)
+	out = append(out, "main.main\x00main.go\x00"...)
+	out = append(append(append(out, pcsp...), pcfile...), pcln...)
+	// File table: a count, then offsets of file names. Entry 0
+	// overlaps the count.
+	out = u32(u32(out, 2), names+10)
+	return out
+}
+
+// testImage returns an Obj whose memory is data, with go:func.* at
+// the start of data, so FUNCDATA offsets are offsets in data.
+func testImage(data []byte) obj.Obj {
+	const base = 0x10000
+	syms := []obj.Sym{{Name: "go:func.*", Value: base, HasAddr: true}}
+	return obj.OpenRaw(data, arch.AMD64, base, syms)
+}
+
+// FuzzNewFuncTab checks that malformed function tables produce
+// errors rather than panics. The fuzz input is both the function
+// table and the memory image that FUNCDATA points into.
+func FuzzNewFuncTab(f *testing.F) {
+	f.Add(buildPclntab120())
+	f.Add(buildPclntab12())
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ft, err := NewFuncTab(data, testImage(data))
+		if err != nil {
+			return
+		}
+		for _, fn := range ft.Funcs {
+			fn.PCSP.Decode()
+			fn.PCFile.Decode()
+			fn.PCLn.Decode()
+			for _, pcd := range fn.PCData {
+				pcd.Decode()
+			}
+			for _, fd := range fn.FuncData {
+				if bms, err := fd.StackMap(); err == nil {
+					for _, bm := range bms {
+						_ = bm.String()
+						bm.Hex()
+					}
+				}
+				fd.OpenCodedDeferInfo()
+			}
+			fn.Liveness()
+			if tree, err := fn.InlineTree(); err == nil {
+				tree.Stack(fn.PC)
+			}
+			fn.FileName(0)
+			ft.FileName(1)
+		}
+	})
+}
+
+func TestPclntabSeeds(t *testing.T) {
+	// Make sure the fuzz seeds are valid, so fuzzing starts from
+	// interesting inputs.
+	for _, data := range [][]byte{buildPclntab120(), buildPclntab12()} {
+		ft, err := NewFuncTab(data, testImage(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fn := ft.Funcs[0]
+		if fn.Name != "main.main" || fn.PC != 0x1000 {
+			t.Errorf("got func %s at %#x, want main.main at 0x1000", fn.Name, fn.PC)
+		}
+		if name := fn.FileName(1); ft.version == ver12 && name != "main.go" {
+			t.Errorf("file 1 is %q, want main.go", name)
+		}
+		if line, ok := fn.PCLn.Decode().Lookup(0x1000); !ok || line != 3 && line != 7 {
+			t.Errorf("line at entry = %d, %v", line, ok)
+		}
+		if ft.version != ver120 {
+			continue
+		}
+		if name := fn.FileName(1); name != "main.go" {
+			t.Errorf("file 1 is %q, want main.go", name)
+		}
+		live, err := fn.Liveness()
+		if err != nil || len(live.Args) != 1 || live.Args[0].String() != "10100000" {
+			t.Errorf("got liveness %+v, %v", live, err)
+		}
+		tree, err := fn.InlineTree()
+		if err != nil || len(tree.Calls) != 1 || tree.Calls[0].Func != "main.f" {
+			t.Errorf("got inline tree %+v, %v", tree, err)
+		}
+	}
+}
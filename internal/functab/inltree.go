@@ -0,0 +1,141 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package functab
+
+import "fmt"
+
+// An InlineTree is the runtime's record of the calls inlined into a
+// function.
+type InlineTree struct {
+	// Index maps each PC in the function to an index in Calls of
+	// the innermost inlined call at that PC, or -1 if the PC is
+	// not in an inlined call.
+	Index PCTable
+
+	// Calls is the tree of inlined calls.
+	Calls []InlinedCall
+}
+
+// An InlinedCall is a node in an InlineTree.
+//
+// See runtime/symtab.go:inlinedCall.
+type InlinedCall struct {
+	// Parent is the index of the inlined call this call was
+	// inlined into, or -1 if it was inlined directly into the
+	// outer function.
+	Parent int16
+	FuncID uint8
+	// File and Line are the position of the call site.
+	File string
+	Line int32
+	// Func is the name of the inlined function.
+	Func string
+	// ParentPC is the PC of an instruction whose source position
+	// is the call site.
+	ParentPC uint64
+}
+
+// inlinedCallSize is the size of runtime.inlinedCall. Go 1.20
+// shrank it to inlinedCallSize120.
+const (
+	inlinedCallSize    = 20
+	inlinedCallSize120 = 16
+)
+
+// InlineTree decodes f's inline tree. If f has no inlined calls, it
+// returns an empty InlineTree.
+func (f *Func) InlineTree() (InlineTree, error) {
+	pcIdx, ok1 := f.ft.Indexes["_PCDATA_InlTreeIndex"]
+	fdIdx, ok2 := f.ft.Indexes["_FUNCDATA_InlTree"]
+	if !ok1 || !ok2 || int(pcIdx) >= len(f.PCData) || int(fdIdx) >= len(f.FuncData) {
+		return InlineTree{}, nil
+	}
+	fd := f.FuncData[fdIdx]
+	if fd.ptr == 0 {
+		return InlineTree{}, nil
+	}
+	index := f.PCData[pcIdx].Decode()
+
+	// The tree doesn't record its length, so find the largest
+	// index used. Parents always precede their children, so this
+	// covers the whole tree.
+	n := int32(-1)
+	for _, v := range index.Values {
+		if v > n {
+			n = v
+		}
+	}
+	n++
+	if n == 0 {
+		return InlineTree{index, nil}, nil
+	}
+
+	size := uint64(inlinedCallSize)
+	if f.ft.version >= ver120 {
+		size = inlinedCallSize120
+	}
+	data, err := fd.Read(uint64(n) * size)
+	if err != nil {
+		return InlineTree{}, err
+	}
+	if uint64(len(data)) < uint64(n)*size {
+		return InlineTree{}, fmt.Errorf("inline tree truncated")
+	}
+	d := decoder{order: f.ft.fi.order, ptrSize: f.ft.fi.ptrSize, data: data}
+	calls := make([]InlinedCall, n)
+	if f.ft.version >= ver120 {
+		// Since Go 1.20, calls don't record their parent or
+		// call site position. Both come from the tables at
+		// the parent PC.
+		files, lines := f.PCFile.Decode(), f.PCLn.Decode()
+		for i := range calls {
+			c := &calls[i]
+			c.FuncID = d.Uint8()
+			d.Bytes(3) // padding
+			c.Func = f.ft.funcName(d.Uint32())
+			c.ParentPC = f.PC + uint64(d.Int32())
+			d.Int32() // startLine
+			c.Parent = -1
+			if p, ok := index.Lookup(c.ParentPC); ok {
+				c.Parent = int16(p)
+			}
+			if file, ok := files.Lookup(c.ParentPC); ok {
+				c.File = f.FileName(file)
+			}
+			c.Line, _ = lines.Lookup(c.ParentPC)
+		}
+		return InlineTree{index, calls}, nil
+	}
+	for i := range calls {
+		c := &calls[i]
+		c.Parent = d.Int16()
+		c.FuncID = d.Uint8()
+		d.Uint8() // padding
+		c.File = f.FileName(d.Int32())
+		c.Line = d.Int32()
+		c.Func = f.ft.funcName(d.Uint32())
+		c.ParentPC = f.PC + uint64(d.Int32())
+	}
+	return InlineTree{index, calls}, nil
+}
+
+// Stack returns the inlined call stack at pc, from outermost to
+// innermost.
+func (t InlineTree) Stack(pc uint64) []InlinedCall {
+	idx, ok := t.Index.Lookup(pc)
+	if !ok {
+		return nil
+	}
+	var stack []InlinedCall
+	for idx >= 0 && int(idx) < len(t.Calls) && len(stack) <= len(t.Calls) {
+		stack = append(stack, t.Calls[idx])
+		idx = int32(t.Calls[idx].Parent)
+	}
+	// Reverse to outermost first.
+	for i, j := 0, len(stack)-1; i < j; i, j = i+1, j-1 {
+		stack[i], stack[j] = stack[j], stack[i]
+	}
+	return stack
+}
@@ -13,7 +13,8 @@ type PCData struct {
 }
 
 func (p PCData) Decode() PCTable {
-	d := decoder{nil, 0, p.raw, 0}
+	// A malformed table ends at the first bad value.
+	d := decoder{data: p.raw}
 	pc := p.pc
 	val := int32(-1)
 	var tab PCTable
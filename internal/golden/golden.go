@@ -0,0 +1,121 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package golden compares test results to expected results stored in
+// golden files.
+//
+// Running a test with the -update flag rewrites its golden files with
+// the current results instead of comparing against them. The
+// differences then show up in version control for review.
+//
+// The object file corpus the golden tests run over is in the
+// module's testdata/corpus directory. See testdata/mkcorpus.sh.
+package golden
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aclements/objbrowse/internal/linediff"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files with the current results")
+
+// maxDiffLines limits how many differing lines a failure reports.
+const maxDiffLines = 40
+
+// TB is the part of testing.TB that this package uses.
+type TB interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+	Fatalf(format string, args ...interface{})
+}
+
+// Check compares got to the contents of the golden file at path. If
+// -update is set, it writes got to path instead.
+func Check(t TB, path string, got []byte) {
+	t.Helper()
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatalf("%v", err)
+		}
+		if err := ioutil.WriteFile(path, got, 0666); err != nil {
+			t.Fatalf("%v", err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Errorf("%v (run with -update to create it)", err)
+		return
+	}
+	if bytes.Equal(got, want) {
+		return
+	}
+	t.Errorf("result differs from %s (run with -update to accept it):\n%s", path, Diff(string(want), string(got)))
+}
+
+// CheckJSON is like Check, but compares got encoded as indented JSON.
+func CheckJSON(t TB, path string, got interface{}) {
+	t.Helper()
+	buf, err := json.MarshalIndent(got, "", "\t")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	Check(t, path, append(buf, '\n'))
+}
+
+// Diff returns the differences between want and got as a unified
+// diff without context, limited to maxDiffLines lines.
+func Diff(want, got string) string {
+	a, b := strings.Split(want, "\n"), strings.Split(got, "\n")
+	var out strings.Builder
+	n := 0
+	for _, e := range linediff.Diff(a, b) {
+		var line string
+		switch e.Op {
+		case linediff.Equal:
+			continue
+		case linediff.Delete:
+			line = fmt.Sprintf("%d: - %s", e.A+1, a[e.A])
+		case linediff.Insert:
+			line = fmt.Sprintf("%d: + %s", e.B+1, b[e.B])
+		}
+		if n++; n > maxDiffLines {
+			out.WriteString("...\n")
+			break
+		}
+		out.WriteString(line + "\n")
+	}
+	return out.String()
+}
+
+// Files returns the paths of the files in dir, in order, excluding
+// subdirectories and files whose names start with "." or "_".
+func Files(t TB, dir string) []string {
+	t.Helper()
+	ents, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	var paths []string
+	for _, ent := range ents {
+		if ent.IsDir() || strings.HasPrefix(ent.Name(), ".") || strings.HasPrefix(ent.Name(), "_") {
+			continue
+		}
+		paths = append(paths, filepath.Join(dir, ent.Name()))
+	}
+	sort.Strings(paths)
+	if len(paths) == 0 {
+		t.Fatalf("no files in %s", dir)
+	}
+	return paths
+}
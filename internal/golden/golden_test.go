@@ -0,0 +1,107 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package golden
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// recorder is a TB that records failures.
+type recorder struct {
+	errs  []string
+	fatal bool
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errs = append(r.errs, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Fatalf(format string, args ...interface{}) {
+	r.Errorf(format, args...)
+	r.fatal = true
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func TestCheck(t *testing.T) {
+	dir := tempDir(t)
+	path := filepath.Join(dir, "sub", "x.json")
+
+	var r recorder
+	CheckJSON(&r, path, map[string]int{"a": 1})
+	if len(r.errs) != 1 || !strings.Contains(r.errs[0], "-update") {
+		t.Errorf("missing golden file: got errors %q", r.errs)
+	}
+
+	*update = true
+	r = recorder{}
+	CheckJSON(&r, path, map[string]int{"a": 1, "b": 2})
+	*update = false
+	if len(r.errs) != 0 {
+		t.Fatalf("update: got errors %q", r.errs)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "{\n\t\"a\": 1,\n\t\"b\": 2\n}\n"; string(data) != want {
+		t.Errorf("update wrote %q, want %q", data, want)
+	}
+
+	r = recorder{}
+	CheckJSON(&r, path, map[string]int{"a": 1, "b": 2})
+	if len(r.errs) != 0 {
+		t.Errorf("same result: got errors %q", r.errs)
+	}
+
+	r = recorder{}
+	CheckJSON(&r, path, map[string]int{"a": 1, "b": 3})
+	if len(r.errs) != 1 || !strings.Contains(r.errs[0], "3: - \t\"b\": 2\n3: + \t\"b\": 3\n") {
+		t.Errorf("changed result: got errors %q", r.errs)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	var want, got []string
+	for i := 0; i < 100; i++ {
+		want = append(want, fmt.Sprint(i))
+		got = append(got, fmt.Sprint(-i))
+	}
+	d := Diff(strings.Join(want, "\n"), strings.Join(got, "\n"))
+	lines := strings.Split(strings.TrimSuffix(d, "\n"), "\n")
+	if len(lines) != maxDiffLines+1 || lines[maxDiffLines] != "..." {
+		t.Errorf("diff of %d lines not limited:\n%s", len(lines), d)
+	}
+}
+
+func TestFiles(t *testing.T) {
+	dir := tempDir(t)
+	for _, name := range []string{"b", "a", ".hidden", "_skip"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "src"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	got := Files(t, dir)
+	if want := []string{filepath.Join(dir, "a"), filepath.Join(dir, "b")}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,359 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package highlight implements simple language-aware tokenization of
+// source code for syntax highlighting.
+//
+// This is not a full lexer for any language. It recognizes just
+// enough (comments, strings, numbers, keywords, and preprocessor
+// directives) to produce useful highlighting, and it never fails: any
+// unrecognized text is simply left unclassified.
+package highlight
+
+import (
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// A Class is a category of source token.
+type Class uint8
+
+const (
+	None Class = iota
+	Keyword
+	Type
+	Comment
+	String
+	Number
+	Preproc
+)
+
+var classNames = [...]string{
+	None:    "",
+	Keyword: "kw",
+	Type:    "type",
+	Comment: "com",
+	String:  "str",
+	Number:  "num",
+	Preproc: "pp",
+}
+
+// String returns a short name for c, suitable for use as a CSS class
+// suffix.
+func (c Class) String() string {
+	if int(c) < len(classNames) {
+		return classNames[c]
+	}
+	return "?"
+}
+
+// A Span is a classified range of bytes [Start, End) in a line.
+type Span struct {
+	Start, End int
+	Class      Class
+}
+
+// A Lexer tokenizes source code one line at a time. It carries state
+// between lines, so lines must be passed to Line in order.
+type Lexer struct {
+	lang *language
+
+	// inComment indicates the previous line ended inside a block
+	// comment.
+	inComment bool
+	// inRaw indicates the previous line ended inside a raw
+	// string.
+	inRaw bool
+}
+
+type language struct {
+	keywords map[string]bool
+	types    map[string]bool
+
+	// lineComments are prefixes that start a comment running to
+	// the end of the line.
+	lineComments []string
+	// blockComments indicates the language has /* */ comments.
+	blockComments bool
+	// rawStrings indicates the language has Go-style `raw`
+	// strings, which may span lines.
+	rawStrings bool
+	// preproc indicates that a line starting with "#" is a
+	// preprocessor directive.
+	preproc bool
+	// dollarNumbers indicates that "$" may prefix a numeric
+	// literal, as in assembly immediates.
+	dollarNumbers bool
+	// dotIdents indicates that identifiers may contain (and
+	// start with) ".", as in assembler directives.
+	dotIdents bool
+}
+
+// NewLexer returns a Lexer for the language of the source file at
+// path, based on its extension. If the language is not known, it
+// returns nil.
+func NewLexer(path string) *Lexer {
+	lang, ok := langByExt[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return nil
+	}
+	return &Lexer{lang: lang}
+}
+
+// Line tokenizes a single line of source, which must not include the
+// trailing newline, and returns the classified spans of line in
+// order. Unclassified text does not appear in the result.
+func (l *Lexer) Line(line string) []Span {
+	var spans []Span
+	add := func(start, end int, class Class) {
+		if start == end {
+			return
+		}
+		if n := len(spans); n > 0 && spans[n-1].End == start && spans[n-1].Class == class {
+			spans[n-1].End = end
+			return
+		}
+		spans = append(spans, Span{start, end, class})
+	}
+	lang := l.lang
+
+	i := 0
+	// Resume any multi-line tokens.
+	if l.inComment {
+		end := strings.Index(line, "*/")
+		if end < 0 {
+			add(0, len(line), Comment)
+			return spans
+		}
+		i = end + 2
+		add(0, i, Comment)
+		l.inComment = false
+	} else if l.inRaw {
+		end := strings.IndexByte(line, '`')
+		if end < 0 {
+			add(0, len(line), String)
+			return spans
+		}
+		i = end + 1
+		add(0, i, String)
+		l.inRaw = false
+	}
+
+	// Preprocessor directives take over the whole line, except
+	// for trailing comments.
+	if lang.preproc && i == 0 {
+		trimmed := strings.TrimLeft(line, " \t")
+		if strings.HasPrefix(trimmed, "#") {
+			end := len(line)
+			if c := strings.Index(line, "//"); c >= 0 {
+				end = c
+			}
+			if c := strings.Index(line, "/*"); c >= 0 && c < end {
+				end = c
+			}
+			add(len(line)-len(trimmed), end, Preproc)
+			i = end
+		}
+	}
+
+	for i < len(line) {
+		c := line[i]
+		rest := line[i:]
+
+		// Comments.
+		if lang.blockComments && strings.HasPrefix(rest, "/*") {
+			end := strings.Index(rest[2:], "*/")
+			if end < 0 {
+				add(i, len(line), Comment)
+				l.inComment = true
+				return spans
+			}
+			add(i, i+2+end+2, Comment)
+			i += 2 + end + 2
+			continue
+		}
+		lineComment := false
+		for _, pfx := range lang.lineComments {
+			if strings.HasPrefix(rest, pfx) {
+				lineComment = true
+				break
+			}
+		}
+		if lineComment {
+			add(i, len(line), Comment)
+			return spans
+		}
+
+		switch {
+		case c == '"' || c == '\'':
+			end := scanQuoted(line, i)
+			add(i, end, String)
+			i = end
+
+		case c == '`' && lang.rawStrings:
+			end := strings.IndexByte(rest[1:], '`')
+			if end < 0 {
+				add(i, len(line), String)
+				l.inRaw = true
+				return spans
+			}
+			add(i, i+1+end+1, String)
+			i += 1 + end + 1
+
+		case isDigit(c) || (c == '$' && lang.dollarNumbers && i+1 < len(line) && (isDigit(line[i+1]) || line[i+1] == '-')) ||
+			(c == '.' && i+1 < len(line) && isDigit(line[i+1])):
+			end := i + 1
+			for end < len(line) && (isIdent(line[end]) || line[end] == '.') {
+				end++
+			}
+			add(i, end, Number)
+			i = end
+
+		default:
+			r, size := utf8.DecodeRuneInString(rest)
+			if isIdentStart(r) || (lang.dotIdents && c == '.') {
+				end := i + size
+				for end < len(line) {
+					r, size := utf8.DecodeRuneInString(line[end:])
+					if !isIdentRune(r) && !(lang.dotIdents && r == '.') {
+						break
+					}
+					end += size
+				}
+				word := line[i:end]
+				switch {
+				case lang.keywords[word]:
+					add(i, end, Keyword)
+				case lang.types[word]:
+					add(i, end, Type)
+				}
+				i = end
+				continue
+			}
+			i += size
+		}
+	}
+	return spans
+}
+
+// scanQuoted returns the index just past the quoted string or
+// character literal starting at line[start]. If the literal is not
+// terminated, it extends to the end of the line.
+func scanQuoted(line string, start int) int {
+	quote := line[start]
+	for i := start + 1; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case quote:
+			return i + 1
+		}
+	}
+	return len(line)
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isIdent(c byte) bool {
+	return c == '_' || isDigit(c) || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isIdentRune(r rune) bool {
+	// Go assembly uses U+00B7 MIDDLE DOT and U+2215 DIVISION
+	// SLASH in symbol names.
+	return r == '_' || r == '·' || r == '∕' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func wordSet(words string) map[string]bool {
+	m := make(map[string]bool)
+	for _, w := range strings.Fields(words) {
+		m[w] = true
+	}
+	return m
+}
+
+var langGo = &language{
+	keywords: wordSet(`break case chan const continue default defer else
+		fallthrough for func go goto if import interface map package
+		range return select struct switch type var`),
+	types: wordSet(`bool byte complex64 complex128 error float32 float64
+		int int8 int16 int32 int64 rune string uint uint8 uint16
+		uint32 uint64 uintptr true false iota nil`),
+	lineComments:  []string{"//"},
+	blockComments: true,
+	rawStrings:    true,
+}
+
+const cKeywords = `auto break case const continue default do else enum
+	extern for goto if inline register restrict return sizeof static
+	struct switch typedef union volatile while _Alignas _Alignof
+	_Atomic _Bool _Complex _Generic _Noreturn _Static_assert
+	_Thread_local`
+
+const cTypes = `char double float int long short signed unsigned void
+	size_t ssize_t ptrdiff_t intptr_t uintptr_t int8_t int16_t int32_t
+	int64_t uint8_t uint16_t uint32_t uint64_t bool NULL`
+
+var langC = &language{
+	keywords:      wordSet(cKeywords),
+	types:         wordSet(cTypes),
+	lineComments:  []string{"//"},
+	blockComments: true,
+	preproc:       true,
+}
+
+var langCXX = &language{
+	keywords: wordSet(cKeywords + ` alignas alignof and asm catch class
+		co_await co_return co_yield concept consteval constexpr
+		constinit const_cast decltype delete dynamic_cast explicit
+		export friend mutable namespace new noexcept not operator or
+		private protected public reinterpret_cast requires
+		static_assert static_cast template this thread_local throw
+		try typeid typename using virtual xor`),
+	types:         wordSet(cTypes + ` wchar_t char8_t char16_t char32_t true false nullptr`),
+	lineComments:  []string{"//"},
+	blockComments: true,
+	preproc:       true,
+}
+
+var langAsm = &language{
+	// Go assembler pseudo-instructions and common GNU assembler
+	// directives.
+	keywords: wordSet(`TEXT DATA GLOBL FUNCDATA PCDATA NO_LOCAL_POINTERS
+		NOSPLIT NOFRAME WRAPPER NEEDCTXT RODATA NOPTR DUPOK TLSBSS
+		.text .data .bss .section .globl .global .type .size .align
+		.p2align .byte .word .short .long .quad .ascii .asciz .string
+		.zero .set .equ .macro .endm .file .loc .cfi_startproc
+		.cfi_endproc .intel_syntax .att_syntax .local .comm .weak
+		.hidden .ident .rept .endr .if .else .endif .include`),
+	types:         wordSet(`SB FP SP PC`),
+	lineComments:  []string{"//"},
+	blockComments: true,
+	preproc:       true,
+	dollarNumbers: true,
+	dotIdents:     true,
+}
+
+var langByExt = map[string]*language{
+	".go":  langGo,
+	".c":   langC,
+	".h":   langC,
+	".cc":  langCXX,
+	".cpp": langCXX,
+	".cxx": langCXX,
+	".c++": langCXX,
+	".hh":  langCXX,
+	".hpp": langCXX,
+	".hxx": langCXX,
+	".s":   langAsm,
+	".asm": langAsm,
+}
@@ -0,0 +1,53 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package highlight
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// format renders spans in line as "text:class" pairs.
+func format(line string, spans []Span) string {
+	var parts []string
+	for _, s := range spans {
+		parts = append(parts, fmt.Sprintf("%s:%s", line[s.Start:s.End], s.Class))
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestLexer(t *testing.T) {
+	for _, test := range []struct {
+		path  string
+		lines []string
+		want  []string
+	}{
+		{"x.go",
+			[]string{`func f(x int) string { return "a\"b" + 'c' // done`},
+			[]string{`func:kw int:type string:type return:kw "a\"b":str 'c':str // done:com`}},
+		{"x.go",
+			[]string{"x := `raw", "still raw` + 0x1f /* multi", "line */ y"},
+			[]string{"`raw:str", "still raw`:str 0x1f:num /* multi:com", "line */:com"}},
+		{"x.c",
+			[]string{`  #include <stdio.h> // io`, `static unsigned long n = 10UL;`},
+			[]string{`#include <stdio.h> :pp // io:com`, `static:kw unsigned:type long:type 10UL:num`}},
+		{"x.s",
+			[]string{`TEXT ·f(SB), NOSPLIT, $0-8`, `	.globl main`},
+			[]string{`TEXT:kw SB:type NOSPLIT:kw $0:num 8:num`, `.globl:kw`}},
+	} {
+		l := NewLexer(test.path)
+		for i, line := range test.lines {
+			got := format(line, l.Line(line))
+			if got != test.want[i] {
+				t.Errorf("%s line %d: got %s, want %s", test.path, i, got, test.want[i])
+			}
+		}
+	}
+
+	if NewLexer("x.txt") != nil {
+		t.Errorf("expected nil Lexer for unknown language")
+	}
+}
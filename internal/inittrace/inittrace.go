@@ -0,0 +1,89 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package inittrace parses the package initialization trace a Go
+// program prints to standard error when run with GODEBUG=inittrace=1.
+package inittrace
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// An Init is the initialization of one package.
+type Init struct {
+	Package string
+	// Start is when initialization started and Clock is how long
+	// it took, in milliseconds. Start is relative to when the
+	// program started.
+	Start, Clock float64
+	// Bytes and Allocs are the heap memory allocated.
+	Bytes, Allocs uint64
+}
+
+// ErrRuntimeTrace is returned by Parse for a runtime/trace file,
+// which doesn't record package initialization.
+var ErrRuntimeTrace = errors.New("runtime/trace files don't record package initialization; use the output of GODEBUG=inittrace=1")
+
+// Parse reads an initialization trace. The trace may be mixed with
+// other output, which Parse ignores. It's an error if there are no
+// trace lines at all.
+func Parse(r io.Reader) ([]Init, error) {
+	br := bufio.NewReader(r)
+	if hdr, _ := br.Peek(16); bytes.HasPrefix(hdr, []byte("go 1.")) && bytes.Contains(hdr, []byte(" trace")) {
+		return nil, ErrRuntimeTrace
+	}
+	s := bufio.NewScanner(br)
+	s.Buffer(nil, 1<<20)
+	var inits []Init
+	for lineNo := 1; s.Scan(); lineNo++ {
+		line := strings.TrimSpace(s.Text())
+		if !strings.HasPrefix(line, "init ") {
+			continue
+		}
+		in, err := parseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+		inits = append(inits, in)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if len(inits) == 0 {
+		return nil, errors.New("no inittrace lines; run the program with GODEBUG=inittrace=1")
+	}
+	return inits, nil
+}
+
+// parseLine parses a line like
+//
+//	init net/http @1.2 ms, 0.35 ms clock, 81920 bytes, 1042 allocs
+func parseLine(line string) (Init, error) {
+	var in Init
+	f := strings.Fields(strings.Replace(line, ",", " ", -1))
+	if len(f) != 11 || f[3] != "ms" || f[5] != "ms" || f[6] != "clock" || f[8] != "bytes" || f[10] != "allocs" || !strings.HasPrefix(f[2], "@") {
+		return in, fmt.Errorf("malformed inittrace line %q", line)
+	}
+	in.Package = f[1]
+	var err error
+	if in.Start, err = strconv.ParseFloat(f[2][1:], 64); err != nil {
+		return in, err
+	}
+	if in.Clock, err = strconv.ParseFloat(f[4], 64); err != nil {
+		return in, err
+	}
+	if in.Bytes, err = strconv.ParseUint(f[7], 10, 64); err != nil {
+		return in, err
+	}
+	if in.Allocs, err = strconv.ParseUint(f[9], 10, 64); err != nil {
+		return in, err
+	}
+	return in, nil
+}
@@ -0,0 +1,47 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package inittrace
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	const trace = `init internal/bytealg @0 ms, 0 ms clock, 0 bytes, 0 allocs
+init runtime @0.032 ms, 0.013 ms clock, 0 bytes, 0 allocs
+hello from main
+init net/http @1.2 ms, 0.35 ms clock, 81920 bytes, 1042 allocs
+`
+	got, err := Parse(strings.NewReader(trace))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Init{
+		{"internal/bytealg", 0, 0, 0, 0},
+		{"runtime", 0.032, 0.013, 0, 0},
+		{"net/http", 1.2, 0.35, 81920, 1042},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, test := range []struct {
+		in, err string
+	}{
+		{"hello\n", "no inittrace lines"},
+		{"init os @x ms, 0 ms clock, 0 bytes, 0 allocs\n", "line 1: strconv.ParseFloat"},
+		{"ok\ninit os @1 ms\n", "line 2: malformed"},
+		{"go 1.22 trace\x00\x00\x00", "runtime/trace"},
+	} {
+		_, err := Parse(strings.NewReader(test.in))
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("Parse(%q): got error %v, want %q", test.in, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package linediff computes line-oriented differences using Myers'
+// O(ND) algorithm.
+package linediff
+
+// An Op is the kind of an Edit.
+type Op byte
+
+const (
+	Equal  Op = ' '
+	Delete Op = '-'
+	Insert Op = '+'
+)
+
+// An Edit is one line of a difference. A is the line's index in the
+// old lines and B is its index in the new lines, or -1 if the line
+// isn't on that side.
+type Edit struct {
+	Op   Op
+	A, B int
+}
+
+// MaxEdits limits the edit distance Diff searches for. Beyond it,
+// Diff reports the differing middle of the inputs as replaced
+// wholesale, which keeps the cost bounded for unrelated inputs.
+const MaxEdits = 4096
+
+// Diff returns the edits that transform a into b.
+func Diff(a, b []string) []Edit {
+	// Strip the common prefix and suffix, which is usually most
+	// of the input.
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+
+	var edits []Edit
+	for i := 0; i < pre; i++ {
+		edits = append(edits, Edit{Equal, i, i})
+	}
+	mid := myers(a[pre:len(a)-suf], b[pre:len(b)-suf])
+	for _, e := range mid {
+		if e.A >= 0 {
+			e.A += pre
+		}
+		if e.B >= 0 {
+			e.B += pre
+		}
+		edits = append(edits, e)
+	}
+	for i := 0; i < suf; i++ {
+		edits = append(edits, Edit{Equal, len(a) - suf + i, len(b) - suf + i})
+	}
+	return edits
+}
+
+func myers(a, b []string) []Edit {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return replace(a, b)
+	}
+	// v[k+max] is the furthest x reached on diagonal k. trace[d]
+	// is the slice of v for diagonals -d..d at the start of step
+	// d, which is all backtracking needs.
+	max := n + m
+	v := make([]int, 2*max+2)
+	var trace [][]int
+	for d := 0; d <= max && d <= MaxEdits; d++ {
+		trace = append(trace, append([]int(nil), v[max-d:max+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && v[max+k-1] < v[max+k+1] {
+				x = v[max+k+1]
+			} else {
+				x = v[max+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[max+k] = x
+			if x >= n && y >= m {
+				return backtrack(trace, n, m)
+			}
+		}
+	}
+	return replace(a, b)
+}
+
+// backtrack recovers the edits from the trace of a Myers search that
+// reached (n, m).
+func backtrack(trace [][]int, n, m int) []Edit {
+	var rev []Edit
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		// trace[d][i] is v for diagonal i-d.
+		v := func(k int) int { return trace[d][k+d] }
+		k := x - y
+		var prevK int
+		if k == -d || k != d && v(k-1) < v(k+1) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			rev = append(rev, Edit{Equal, x, y})
+		}
+		if d > 0 {
+			if x == prevX {
+				rev = append(rev, Edit{Insert, -1, prevY})
+			} else {
+				rev = append(rev, Edit{Delete, prevX, -1})
+			}
+		}
+		x, y = prevX, prevY
+	}
+	for i, j := 0, len(rev)-1; i < j; i, j = i+1, j-1 {
+		rev[i], rev[j] = rev[j], rev[i]
+	}
+	return rev
+}
+
+// replace returns edits that delete all of a and insert all of b.
+func replace(a, b []string) []Edit {
+	edits := make([]Edit, 0, len(a)+len(b))
+	for i := range a {
+		edits = append(edits, Edit{Delete, i, -1})
+	}
+	for i := range b {
+		edits = append(edits, Edit{Insert, -1, i})
+	}
+	return edits
+}
@@ -0,0 +1,116 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package linediff
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// format renders edits as a string of op characters and lines.
+func format(a, b []string, edits []Edit) string {
+	var out []string
+	for _, e := range edits {
+		if e.Op == Insert {
+			out = append(out, "+"+b[e.B])
+		} else {
+			out = append(out, string(e.Op)+a[e.A])
+		}
+	}
+	return strings.Join(out, " ")
+}
+
+// check verifies that edits transform a into b.
+func check(t *testing.T, a, b []string, edits []Edit) {
+	t.Helper()
+	var gotA, gotB []string
+	for _, e := range edits {
+		switch e.Op {
+		case Equal:
+			if a[e.A] != b[e.B] {
+				t.Fatalf("equal edit %+v joins %q and %q", e, a[e.A], b[e.B])
+			}
+			gotA, gotB = append(gotA, a[e.A]), append(gotB, b[e.B])
+		case Delete:
+			gotA = append(gotA, a[e.A])
+		case Insert:
+			gotB = append(gotB, b[e.B])
+		}
+	}
+	if strings.Join(gotA, "\n") != strings.Join(a, "\n") || strings.Join(gotB, "\n") != strings.Join(b, "\n") {
+		t.Fatalf("edits %v don't transform %q into %q", edits, a, b)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	for _, test := range []struct {
+		a, b string
+		want string
+	}{
+		{"", "", ""},
+		{"a b c", "a b c", " a  b  c"},
+		{"", "a b", "+a +b"},
+		{"a b", "", "-a -b"},
+		{"a b c", "a x c", " a -b +x  c"},
+		{"a b c d", "a c d", " a -b  c  d"},
+		{"a c", "a b c", " a +b  c"},
+		{"a b c a b b a", "c b a b a c", "-a -b  c +b  a  b -b  a +c"},
+	} {
+		a, b := strings.Fields(test.a), strings.Fields(test.b)
+		edits := Diff(a, b)
+		check(t, a, b, edits)
+		if got := format(a, b, edits); got != test.want {
+			t.Errorf("Diff(%q, %q) = %q, want %q", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestDiffRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	gen := func() []string {
+		s := make([]string, r.Intn(50))
+		for i := range s {
+			s[i] = string(rune('a' + r.Intn(4)))
+		}
+		return s
+	}
+	for i := 0; i < 1000; i++ {
+		a, b := gen(), gen()
+		edits := Diff(a, b)
+		check(t, a, b, edits)
+		// The diff must be minimal.
+		changes := 0
+		for _, e := range edits {
+			if e.Op != Equal {
+				changes++
+			}
+		}
+		if want := len(a) + len(b) - 2*lcs(a, b); changes != want {
+			t.Fatalf("Diff(%q, %q) has %d changes, want %d", a, b, changes, want)
+		}
+	}
+}
+
+// lcs returns the length of the longest common subsequence of a and
+// b.
+func lcs(a, b []string) int {
+	dp := make([][]int, len(a)+1)
+	for i := range dp {
+		dp[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				dp[i][j] = dp[i+1][j+1] + 1
+			} else if dp[i+1][j] > dp[i][j+1] {
+				dp[i][j] = dp[i+1][j]
+			} else {
+				dp[i][j] = dp[i][j+1]
+			}
+		}
+	}
+	return dp[0][0]
+}
@@ -0,0 +1,318 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package linkmap parses the link maps written by the GNU linkers
+// (ld -M or -Map) and by LLD (--Map).
+package linkmap
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// A Map is a parsed link map.
+type Map struct {
+	// Format is "gnu" or "lld".
+	Format string
+	// Sections are the output sections, in map order.
+	Sections []Section
+	// Inputs are the input sections placed in output sections.
+	Inputs []Input
+	// Symbols are the symbols the map lists, including symbols
+	// assigned by the linker script. GNU maps list only global
+	// symbols, while LLD maps list local symbols, too.
+	Symbols []Symbol
+	// Discarded are the input sections removed from the link,
+	// such as by --gc-sections. Only GNU maps record these.
+	Discarded []Input
+}
+
+// A Section is an output section.
+type Section struct {
+	Name       string
+	Addr, Size uint64
+}
+
+// An Input is an input section.
+type Input struct {
+	// Section is the name of the input section, such as
+	// ".text.main".
+	Section string
+	// Out is the name of the output section containing it, or ""
+	// if it was discarded.
+	Out string
+	// File is the object file that contributed it, possibly as
+	// "archive.a(member.o)".
+	File       string
+	Addr, Size uint64
+}
+
+// A Symbol is a symbol listed in a map.
+type Symbol struct {
+	Name string
+	Addr uint64
+	// Input is the index in Map.Inputs of the input section
+	// defining this symbol, or -1 if the linker script assigned
+	// it.
+	Input int
+}
+
+// Parse reads a link map in either GNU or LLD format.
+func Parse(r io.Reader) (*Map, error) {
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+	var lines []string
+	for s.Scan() {
+		lines = append(lines, strings.TrimRight(s.Text(), " \t\r"))
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+		if f := strings.Fields(line); len(f) >= 3 && (f[0] == "VMA" || f[0] == "Address") {
+			return parseLLD(lines)
+		}
+		break
+	}
+	return parseGNU(lines)
+}
+
+// parseGNU parses a GNU ld map. The interesting parts are the
+// "Discarded input sections" list and the "Linker script and memory
+// map", which contains lines like
+//
+//	.text           0x0000000000001050      0x112
+//	 .text.main     0x0000000000001139       0x29 main.o
+//	                0x0000000000001139                main
+//
+// for output sections, input sections, and symbols. Names too long
+// for their column are followed by a line break.
+func parseGNU(lines []string) (*Map, error) {
+	m := &Map{Format: "gnu"}
+	const (
+		other = iota
+		discarded
+		memoryMap
+	)
+	part := other
+	out := ""
+	in := -1
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch line {
+		case "Discarded input sections":
+			part = discarded
+			continue
+		case "Linker script and memory map":
+			part = memoryMap
+			continue
+		case "Memory Configuration", "Archive member included to satisfy reference by file (symbol)",
+			"Allocating common symbols", "As-needed library included to satisfy reference by file (symbol)",
+			"Cross Reference Table":
+			part = other
+			continue
+		}
+		if part == other || line == "" {
+			continue
+		}
+
+		f := strings.Fields(line)
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		// Join a name with the numbers on the following line.
+		if len(f) == 1 && indent <= 1 && i+1 < len(lines) {
+			if next := strings.Fields(lines[i+1]); len(next) >= 2 && isHex(next[0]) && isHex(next[1]) {
+				f = append(f, next...)
+				i++
+			}
+		}
+
+		if part == discarded {
+			if indent == 1 && len(f) >= 4 && isHex(f[1]) && isHex(f[2]) {
+				m.Discarded = append(m.Discarded, Input{
+					Section: f[0],
+					File:    strings.Join(f[3:], " "),
+					Addr:    parseHex(f[1]),
+					Size:    parseHex(f[2]),
+				})
+			}
+			continue
+		}
+
+		switch {
+		case indent == 0:
+			// Output section, or a linker script command
+			// such as "LOAD file".
+			if len(f) >= 3 && isHex(f[1]) && isHex(f[2]) {
+				out, in = f[0], -1
+				if out != "/DISCARD/" {
+					m.Sections = append(m.Sections, Section{f[0], parseHex(f[1]), parseHex(f[2])})
+				}
+			} else if len(f) == 1 {
+				// An empty output section.
+				out, in = f[0], -1
+			}
+		case indent == 1 && out != "":
+			// Input section. Skip input section patterns
+			// like "*(.text)" and padding ("*fill*").
+			if strings.HasPrefix(f[0], "*") || len(f) < 4 || !isHex(f[1]) || !isHex(f[2]) {
+				continue
+			}
+			inp := Input{
+				Section: f[0],
+				Out:     out,
+				File:    strings.Join(f[3:], " "),
+				Addr:    parseHex(f[1]),
+				Size:    parseHex(f[2]),
+			}
+			if out == "/DISCARD/" {
+				inp.Out = ""
+				m.Discarded = append(m.Discarded, inp)
+				continue
+			}
+			in = len(m.Inputs)
+			m.Inputs = append(m.Inputs, inp)
+		default:
+			// Symbol, or an assignment like "0x... _end = .".
+			// Unused PROVIDE assignments have "[!provide]"
+			// in place of an address.
+			if len(f) < 2 || !isHex(f[0]) {
+				continue
+			}
+			if len(f) == 2 && isSymbolName(f[1]) && in >= 0 {
+				m.Symbols = append(m.Symbols, Symbol{f[1], parseHex(f[0]), in})
+			} else if name, ok := assigned(f[1:]); ok {
+				m.Symbols = append(m.Symbols, Symbol{name, parseHex(f[0]), -1})
+			}
+		}
+	}
+	if len(m.Sections) == 0 && len(m.Discarded) == 0 {
+		return nil, fmt.Errorf("no memory map found; not a GNU or LLD link map")
+	}
+	return m, nil
+}
+
+// parseLLD parses an LLD map, which has a header followed by lines
+// like
+//
+//	   VMA              LMA     Size Align Out     In      Symbol
+//	201000           201000       2e     4 .text
+//	201000           201000       28     4         main.o:(.text)
+//	201000           201000        0     1                 main
+//
+// Old versions of LLD omit the LMA column and call the VMA column
+// "Address".
+func parseLLD(lines []string) (*Map, error) {
+	m := &Map{Format: "lld"}
+	// Find the header and the columns.
+	h := 0
+	for lines[h] == "" {
+		h++
+	}
+	header := lines[h]
+	outCol := strings.Index(header, "Out")
+	if outCol < 0 {
+		return nil, fmt.Errorf("malformed LLD map header: %q", header)
+	}
+	cols := strings.Fields(header[:outCol])
+	addrCol, sizeCol := -1, -1
+	for i, c := range cols {
+		switch c {
+		case "VMA", "Address":
+			addrCol = i
+		case "Size":
+			sizeCol = i
+		}
+	}
+	if addrCol < 0 || sizeCol < 0 {
+		return nil, fmt.Errorf("malformed LLD map header: %q", header)
+	}
+
+	out := ""
+	in := -1
+	for n, line := range lines[h+1:] {
+		if line == "" {
+			continue
+		}
+		if len(line) <= outCol {
+			return nil, fmt.Errorf("line %d: short line in LLD map", h+n+2)
+		}
+		nums := strings.Fields(line[:outCol])
+		if len(nums) != len(cols) {
+			return nil, fmt.Errorf("line %d: expected %d columns", h+n+2, len(cols))
+		}
+		addr, size := parseHex(nums[addrCol]), parseHex(nums[sizeCol])
+		rest := line[outCol:]
+		name := strings.TrimLeft(rest, " ")
+		switch len(rest) - len(name) {
+		case 0:
+			out, in = name, -1
+			m.Sections = append(m.Sections, Section{name, addr, size})
+		case 8:
+			// "file:(section)", where file may be
+			// "archive.a(member.o)".
+			inp := Input{Out: out, File: name, Addr: addr, Size: size}
+			if i := strings.LastIndex(name, ":("); i >= 0 && strings.HasSuffix(name, ")") {
+				inp.File, inp.Section = name[:i], name[i+2:len(name)-1]
+			}
+			in = len(m.Inputs)
+			m.Inputs = append(m.Inputs, inp)
+		default:
+			// Symbol, or an assignment.
+			if isSymbolName(name) {
+				m.Symbols = append(m.Symbols, Symbol{name, addr, in})
+			} else if name, ok := assigned(strings.Fields(name)); ok {
+				m.Symbols = append(m.Symbols, Symbol{name, addr, -1})
+			}
+		}
+	}
+	return m, nil
+}
+
+// assigned returns the symbol assigned by the linker script
+// statement in fields f, such as "_end = ." or "PROVIDE (end = .)".
+// Assignments to "." don't define symbols.
+func assigned(f []string) (string, bool) {
+	if len(f) > 0 {
+		switch f[0] {
+		case "PROVIDE", "PROVIDE_HIDDEN", "HIDDEN":
+			f = f[1:]
+		}
+	}
+	if len(f) > 0 && strings.HasPrefix(f[0], "(") {
+		f[0] = f[0][1:]
+		if f[0] == "" {
+			f = f[1:]
+		}
+	}
+	if len(f) < 2 || f[1] != "=" || !isSymbolName(f[0]) {
+		return "", false
+	}
+	return f[0], true
+}
+
+// isSymbolName reports whether s looks like a symbol name rather than
+// a linker script expression.
+func isSymbolName(s string) bool {
+	return s != "" && s != "." && !strings.ContainsAny(s, " =()")
+}
+
+func isHex(s string) bool {
+	s = strings.TrimPrefix(s, "0x")
+	if s == "" {
+		return false
+	}
+	_, err := strconv.ParseUint(s, 16, 64)
+	return err == nil
+}
+
+func parseHex(s string) uint64 {
+	v, _ := strconv.ParseUint(strings.TrimPrefix(s, "0x"), 16, 64)
+	return v
+}
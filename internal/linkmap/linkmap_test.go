@@ -0,0 +1,138 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package linkmap
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const gnuMap = `As-needed library included to satisfy reference by file (symbol)
+
+libc.so.6                     main.o (puts@@GLIBC_2.2.5)
+
+Discarded input sections
+
+ .data          0x0000000000000000        0x0 main.o
+ .text.unused   0x0000000000000000       0x15 main.o
+ .text.very_long_function_name
+                0x0000000000000000        0x4 main.o
+
+Memory Configuration
+
+Name             Origin             Length             Attributes
+*default*        0x0000000000000000 0xffffffffffffffff
+
+Linker script and memory map
+
+LOAD main.o
+                [!provide]                        PROVIDE (__executable_start = SEGMENT_START ("text-segment", 0x0))
+                0x0000000000000318                . = (SEGMENT_START ("text-segment", 0x0) + SIZEOF_HEADERS)
+
+.hash
+
+.note.gnu.property
+                0x0000000000000338       0x20
+ .note.gnu.property
+                0x0000000000000338       0x20 crt1.o
+
+.text           0x0000000000001050       0x40
+ *(.text .stub .text.*)
+ .text          0x0000000000001050       0x22 crt1.o
+                0x0000000000001050                _start
+ *fill*         0x0000000000001072        0xe 
+ .text.main     0x0000000000001080       0x10 libx.a(main.o)
+                0x0000000000001080                main
+                0x0000000000001090                PROVIDE (etext = .)
+                [!provide]                        PROVIDE (__etext = .)
+                0x0000000000001090                _etext = .
+                0x0000000000001090                . = ALIGN (0x8)
+
+/DISCARD/
+ *(.note.GNU-stack)
+ .comment       0x0000000000000000       0x12 main.o
+OUTPUT(prog elf64-x86-64)
+`
+
+func TestGNU(t *testing.T) {
+	m, err := Parse(strings.NewReader(gnuMap))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Map{
+		Format: "gnu",
+		Sections: []Section{
+			{".note.gnu.property", 0x338, 0x20},
+			{".text", 0x1050, 0x40},
+		},
+		Inputs: []Input{
+			{".note.gnu.property", ".note.gnu.property", "crt1.o", 0x338, 0x20},
+			{".text", ".text", "crt1.o", 0x1050, 0x22},
+			{".text.main", ".text", "libx.a(main.o)", 0x1080, 0x10},
+		},
+		Symbols: []Symbol{
+			{"_start", 0x1050, 1},
+			{"main", 0x1080, 2},
+			{"etext", 0x1090, -1},
+			{"_etext", 0x1090, -1},
+		},
+		Discarded: []Input{
+			{".data", "", "main.o", 0, 0},
+			{".text.unused", "", "main.o", 0, 0x15},
+			{".text.very_long_function_name", "", "main.o", 0, 4},
+			{".comment", "", "main.o", 0, 0x12},
+		},
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("got %+v\nwant %+v", m, want)
+	}
+}
+
+const lldMap = `             VMA              LMA     Size Align Out     In      Symbol
+          200238           200238       1c     1 .interp
+          200238           200238       1c     1         <internal>:(.interp)
+          201000           201000       2e     4 .text
+          201000           201000       28     4         main.o:(.text)
+          201000           201000        0     1                 main
+          201010           201010        0     1                 helper
+          201028           201028        6     4         libx.a(x.o):(.text.x)
+          201028           201028        0     1                 x
+          202000           202000        0     1                 PROVIDE_HIDDEN ( __init_array_start = . )
+`
+
+func TestLLD(t *testing.T) {
+	m, err := Parse(strings.NewReader(lldMap))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Map{
+		Format: "lld",
+		Sections: []Section{
+			{".interp", 0x200238, 0x1c},
+			{".text", 0x201000, 0x2e},
+		},
+		Inputs: []Input{
+			{".interp", ".interp", "<internal>", 0x200238, 0x1c},
+			{".text", ".text", "main.o", 0x201000, 0x28},
+			{".text.x", ".text", "libx.a(x.o)", 0x201028, 6},
+		},
+		Symbols: []Symbol{
+			{"main", 0x201000, 1},
+			{"helper", 0x201010, 1},
+			{"x", 0x201028, 2},
+			{"__init_array_start", 0x202000, -1},
+		},
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("got %+v\nwant %+v", m, want)
+	}
+}
+
+func TestNotMap(t *testing.T) {
+	if _, err := Parse(strings.NewReader("hello\nworld\n")); err == nil {
+		t.Errorf("want error for non-map input")
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package logging writes structured log records, which have a message
+// and a list of key-value attributes, in the style of log/slog.
+//
+// Attributes are passed as alternating keys and values:
+//
+//	lg.Warn("reading source", "path", path, "err", err)
+//
+// and a Logger returned by With adds its attributes to every record,
+// which is how a request's records are tied together.
+//
+// objbrowse supports Go 1.14, as go.mod says, and log/slog is only in
+// Go 1.21 and later. This package implements the small part of it
+// objbrowse needs, with the same record format, so switching to
+// log/slog when the go directive is raised is mechanical.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// A Level is the importance of a record.
+type Level int
+
+const (
+	LevelDebug Level = -4
+	LevelInfo  Level = 0
+	LevelWarn  Level = 4
+	LevelError Level = 8
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("LEVEL(%d)", int(l))
+}
+
+// An Attr is a key-value attribute of a record.
+type Attr struct {
+	Key   string
+	Value interface{}
+}
+
+// String formats a's value with fmt's %v.
+func (a Attr) String() string {
+	if s, ok := a.Value.(string); ok {
+		return s
+	}
+	return fmt.Sprint(a.Value)
+}
+
+// A Record is one log entry.
+type Record struct {
+	Time  time.Time
+	Level Level
+	Msg   string
+	Attrs []Attr
+}
+
+// Attr returns the value of the last attribute of r named key.
+func (r *Record) Attr(key string) (interface{}, bool) {
+	for i := len(r.Attrs) - 1; i >= 0; i-- {
+		if r.Attrs[i].Key == key {
+			return r.Attrs[i].Value, true
+		}
+	}
+	return nil, false
+}
+
+// A Handler consumes records. It must be safe for concurrent use.
+type Handler interface {
+	// Enabled reports whether the handler wants records at
+	// level, so Loggers can skip building the others.
+	Enabled(level Level) bool
+	// Handle consumes r. r.Attrs is never modified, so h may
+	// retain r.
+	Handle(r Record)
+}
+
+// A Logger passes records to a Handler.
+type Logger struct {
+	h     Handler
+	attrs []Attr
+}
+
+// New returns a Logger that sends records to h.
+func New(h Handler) *Logger {
+	return &Logger{h: h}
+}
+
+// With returns a Logger that adds the attributes given by args, as
+// alternating keys and values, to every record.
+func (l *Logger) With(args ...interface{}) *Logger {
+	attrs := append(l.attrs[:len(l.attrs):len(l.attrs)], argsToAttrs(args)...)
+	return &Logger{l.h, attrs}
+}
+
+// Enabled reports whether l logs records at level.
+func (l *Logger) Enabled(level Level) bool {
+	return l.h.Enabled(level)
+}
+
+// Log logs msg at level with the attributes given by args, as
+// alternating keys and values.
+func (l *Logger) Log(level Level, msg string, args ...interface{}) {
+	if !l.h.Enabled(level) {
+		return
+	}
+	attrs := append(l.attrs[:len(l.attrs):len(l.attrs)], argsToAttrs(args)...)
+	l.h.Handle(Record{time.Now(), level, msg, attrs})
+}
+
+// Debug logs at LevelDebug.
+func (l *Logger) Debug(msg string, args ...interface{}) { l.Log(LevelDebug, msg, args...) }
+
+// Info logs at LevelInfo.
+func (l *Logger) Info(msg string, args ...interface{}) { l.Log(LevelInfo, msg, args...) }
+
+// Warn logs at LevelWarn.
+func (l *Logger) Warn(msg string, args ...interface{}) { l.Log(LevelWarn, msg, args...) }
+
+// Error logs at LevelError.
+func (l *Logger) Error(msg string, args ...interface{}) { l.Log(LevelError, msg, args...) }
+
+// badKey is the key of a value in args that's missing its key.
+const badKey = "!BADKEY"
+
+func argsToAttrs(args []interface{}) []Attr {
+	var attrs []Attr
+	for len(args) > 0 {
+		key, ok := args[0].(string)
+		if !ok || len(args) == 1 {
+			attrs = append(attrs, Attr{badKey, args[0]})
+			args = args[1:]
+			continue
+		}
+		attrs = append(attrs, Attr{key, args[1]})
+		args = args[2:]
+	}
+	return attrs
+}
+
+// A TextHandler writes records at or above a minimum level as lines
+// of key=value pairs, such as
+//
+//	time=2020-05-01T12:00:00.000-04:00 level=WARN msg="view failed" view=Source
+type TextHandler struct {
+	mu  sync.Mutex
+	w   io.Writer
+	min Level
+}
+
+// NewTextHandler returns a handler that writes records at level min
+// or above to w.
+func NewTextHandler(w io.Writer, min Level) *TextHandler {
+	return &TextHandler{w: w, min: min}
+}
+
+func (h *TextHandler) Enabled(level Level) bool {
+	return level >= h.min
+}
+
+func (h *TextHandler) Handle(r Record) {
+	var b strings.Builder
+	b.WriteString("time=")
+	b.WriteString(r.Time.Format("2006-01-02T15:04:05.000Z07:00"))
+	b.WriteString(" level=")
+	b.WriteString(r.Level.String())
+	b.WriteString(" msg=")
+	b.WriteString(quote(r.Msg))
+	for _, a := range r.Attrs {
+		b.WriteByte(' ')
+		b.WriteString(quote(a.Key))
+		b.WriteByte('=')
+		b.WriteString(quote(a.String()))
+	}
+	b.WriteByte('\n')
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	io.WriteString(h.w, b.String())
+}
+
+// quote quotes s if it's empty or has spaces, quotes, "=", or
+// unprintable characters, so lines can be split back into pairs.
+func quote(s string) string {
+	if s == "" || strings.IndexFunc(s, func(r rune) bool {
+		return unicode.IsSpace(r) || r == '"' || r == '=' || !unicode.IsPrint(r)
+	}) >= 0 {
+		return strconv.Quote(s)
+	}
+	return s
+}
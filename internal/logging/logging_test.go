@@ -0,0 +1,51 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package logging
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTextHandler(t *testing.T) {
+	var b strings.Builder
+	lg := New(NewTextHandler(&b, LevelInfo))
+	req := lg.With("req", 7)
+	req.Debug("hidden")
+	req.Warn("view failed", "view", "Source", "err", errors.New("no such file"), "dur", 1500*time.Millisecond)
+	lg.Info("odd", "k", "", "x=y", 1, "dangling")
+
+	// Drop the times.
+	got := regexp.MustCompile(`(?m)^time=\S+ `).ReplaceAllString(b.String(), "")
+	const want = `level=WARN msg="view failed" req=7 view=Source err="no such file" dur=1.5s
+level=INFO msg=odd k="" "x=y"=1 !BADKEY=dangling
+`
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+type recorder []Record
+
+func (r *recorder) Enabled(Level) bool { return true }
+func (r *recorder) Handle(rec Record)  { *r = append(*r, rec) }
+
+func TestWith(t *testing.T) {
+	var recs recorder
+	lg := New(&recs).With("a", 1)
+	// Sibling loggers mustn't share attributes.
+	lg1, lg2 := lg.With("b", 2), lg.With("c", 3)
+	lg1.Info("one")
+	lg2.Info("two", "a", 4)
+	if len(recs) != 2 || len(recs[0].Attrs) != 2 || recs[0].Attrs[1].Key != "b" || recs[1].Attrs[1].Key != "c" {
+		t.Fatalf("got %+v", recs)
+	}
+	if v, _ := recs[1].Attr("a"); v != 4 {
+		t.Errorf("Attr(a) = %v, want the last value, 4", v)
+	}
+}
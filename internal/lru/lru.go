@@ -0,0 +1,215 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package lru implements caches that share a memory budget. When the
+// total size of their entries exceeds the budget, the least recently
+// used entries of all the caches are evicted.
+//
+// Entry sizes are estimates supplied by the caller, so a budget
+// bounds the memory caches hold only as well as the estimates do.
+package lru
+
+import (
+	"container/list"
+	"sort"
+	"sync"
+)
+
+// A Budget limits the total size of the entries of a set of caches.
+type Budget struct {
+	mu     sync.Mutex
+	limit  int64
+	used   int64
+	lru    list.List // Of *entry, most recently used first
+	caches []*Cache
+}
+
+// NewBudget returns a budget of limit bytes. If limit is 0, the
+// budget is unlimited, so caches never evict entries.
+func NewBudget(limit int64) *Budget {
+	return &Budget{limit: limit}
+}
+
+// SetLimit changes the budget to limit bytes, evicting entries if
+// the caches now exceed it.
+func (b *Budget) SetLimit(limit int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.limit = limit
+	b.evict()
+}
+
+// Limit returns the budget's limit in bytes, or 0 if it's unlimited.
+func (b *Budget) Limit() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.limit
+}
+
+// Used returns the total size of the entries in the budget's caches.
+func (b *Budget) Used() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.used
+}
+
+// NewCache returns a new, empty cache that shares b. name identifies
+// the cache in Stats.
+func (b *Budget) NewCache(name string) *Cache {
+	c := &Cache{b: b, name: name, m: make(map[interface{}]*list.Element)}
+	b.mu.Lock()
+	b.caches = append(b.caches, c)
+	b.mu.Unlock()
+	return c
+}
+
+// Stats describes a cache's contents and use.
+type Stats struct {
+	Name    string
+	Entries int
+	Bytes   int64
+
+	Hits, Misses, Evictions int64
+}
+
+// Stats returns the statistics of b's caches, in order by name.
+// Caches with the same name are combined. The statistics of closed
+// caches are dropped.
+func (b *Budget) Stats() []Stats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	byName := make(map[string]int)
+	var out []Stats
+	for _, c := range b.caches {
+		i, ok := byName[c.name]
+		if !ok {
+			i = len(out)
+			out = append(out, Stats{Name: c.name})
+			byName[c.name] = i
+		}
+		st := &out[i]
+		st.Entries += len(c.m)
+		st.Bytes += c.stats.Bytes
+		st.Hits += c.stats.Hits
+		st.Misses += c.stats.Misses
+		st.Evictions += c.stats.Evictions
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// evict removes the least recently used entries until b is within its
+// limit. b.mu must be held.
+func (b *Budget) evict() {
+	for b.limit > 0 && b.used > b.limit {
+		e := b.lru.Remove(b.lru.Back()).(*entry)
+		e.c.remove(e)
+		e.c.stats.Evictions++
+	}
+}
+
+// A Cache maps keys to values whose memory is accounted to a Budget.
+// A Cache is safe for concurrent use.
+type Cache struct {
+	b     *Budget
+	name  string
+	m     map[interface{}]*list.Element
+	stats Stats // Bytes, Hits, Misses, and Evictions
+
+	closed bool
+}
+
+type entry struct {
+	c    *Cache
+	key  interface{}
+	val  interface{}
+	size int64
+}
+
+// Get returns the value cached for key and marks it as recently used.
+func (c *Cache) Get(key interface{}) (interface{}, bool) {
+	b := c.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	el, ok := c.m[key]
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+	c.stats.Hits++
+	b.lru.MoveToFront(el)
+	return el.Value.(*entry).val, true
+}
+
+// Add caches val for key, replacing any value already cached for it.
+// size is an estimate of the bytes val retains. Adding entries may
+// evict the least recently used entries of any cache sharing c's
+// budget. If size alone exceeds the budget, val isn't cached.
+func (c *Cache) Add(key, val interface{}, size int64) {
+	b := c.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if el, ok := c.m[key]; ok {
+		b.lru.Remove(el)
+		c.remove(el.Value.(*entry))
+	}
+	if c.closed || b.limit > 0 && size > b.limit {
+		return
+	}
+	e := &entry{c, key, val, size}
+	c.m[key] = b.lru.PushFront(e)
+	c.stats.Bytes += size
+	b.used += size
+	b.evict()
+}
+
+// Remove removes key from the cache.
+func (c *Cache) Remove(key interface{}) {
+	b := c.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if el, ok := c.m[key]; ok {
+		b.lru.Remove(el)
+		c.remove(el.Value.(*entry))
+	}
+}
+
+// Purge removes every entry from the cache.
+func (c *Cache) Purge() {
+	b := c.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c.purge()
+}
+
+// Close removes every entry from the cache and detaches it from its
+// budget. After Close, Add does nothing, so Get always misses.
+func (c *Cache) Close() {
+	b := c.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c.purge()
+	c.closed = true
+	for i, c2 := range b.caches {
+		if c2 == c {
+			b.caches = append(b.caches[:i], b.caches[i+1:]...)
+			break
+		}
+	}
+}
+
+func (c *Cache) purge() {
+	for _, el := range c.m {
+		c.b.lru.Remove(el)
+		c.remove(el.Value.(*entry))
+	}
+}
+
+// remove drops e from c's map and accounting. It must already be
+// removed from the LRU list, and b.mu must be held.
+func (c *Cache) remove(e *entry) {
+	delete(c.m, e.key)
+	c.stats.Bytes -= e.size
+	c.b.used -= e.size
+}
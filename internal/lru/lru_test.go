@@ -0,0 +1,91 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lru
+
+import "testing"
+
+func TestEvict(t *testing.T) {
+	b := NewBudget(100)
+	c1, c2 := b.NewCache("one"), b.NewCache("two")
+	c1.Add("a", 1, 40)
+	c2.Add("b", 2, 40)
+	// Using a makes b the least recently used.
+	if v, ok := c1.Get("a"); !ok || v != 1 {
+		t.Fatalf("Get(a) = %v, %v", v, ok)
+	}
+	c1.Add("c", 3, 40)
+	if _, ok := c2.Get("b"); ok {
+		t.Errorf("b was not evicted")
+	}
+	if _, ok := c1.Get("a"); !ok {
+		t.Errorf("a was evicted")
+	}
+	if used := b.Used(); used != 80 {
+		t.Errorf("Used() = %d, want 80", used)
+	}
+
+	st := b.Stats()
+	if len(st) != 2 || st[0].Name != "one" || st[0].Entries != 2 || st[0].Bytes != 80 || st[0].Hits != 2 {
+		t.Errorf("Stats()[0] = %+v", st[0])
+	}
+	if st[1].Evictions != 1 || st[1].Misses != 1 || st[1].Bytes != 0 {
+		t.Errorf("Stats()[1] = %+v", st[1])
+	}
+
+	b.SetLimit(50)
+	if used := b.Used(); used != 40 {
+		t.Errorf("after SetLimit(50), Used() = %d, want 40", used)
+	}
+}
+
+func TestTooLarge(t *testing.T) {
+	b := NewBudget(10)
+	c := b.NewCache("c")
+	c.Add("a", 1, 5)
+	c.Add("big", 2, 11)
+	if _, ok := c.Get("big"); ok {
+		t.Errorf("entry larger than budget was cached")
+	}
+	if _, ok := c.Get("a"); !ok {
+		t.Errorf("entry larger than budget evicted others")
+	}
+}
+
+func TestReplace(t *testing.T) {
+	b := NewBudget(0)
+	c := b.NewCache("c")
+	c.Add("a", 1, 5)
+	c.Add("a", 2, 7)
+	if v, _ := c.Get("a"); v != 2 || b.Used() != 7 {
+		t.Errorf("after replacing, Get(a) = %v and Used() = %d", v, b.Used())
+	}
+	c.Add("b", 3, 1<<40)
+	if b.Used() != 7+1<<40 {
+		t.Errorf("unlimited budget evicted entries")
+	}
+	c.Remove("b")
+	c.Purge()
+	if b.Used() != 0 || b.Stats()[0].Entries != 0 {
+		t.Errorf("after Purge, Used() = %d", b.Used())
+	}
+}
+
+func TestClose(t *testing.T) {
+	b := NewBudget(0)
+	c1, c2 := b.NewCache("c"), b.NewCache("c")
+	c1.Add("a", 1, 5)
+	c2.Add("a", 2, 7)
+	if st := b.Stats(); len(st) != 1 || st[0].Entries != 2 || st[0].Bytes != 12 {
+		t.Errorf("Stats() = %+v, want caches combined", st)
+	}
+	c1.Close()
+	c1.Add("b", 3, 1)
+	if _, ok := c1.Get("b"); ok {
+		t.Errorf("closed cache cached a value")
+	}
+	if st := b.Stats(); len(st) != 1 || st[0].Entries != 1 || b.Used() != 7 {
+		t.Errorf("after Close, Stats() = %+v", st)
+	}
+}
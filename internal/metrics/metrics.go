@@ -0,0 +1,290 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package metrics collects counters, histograms, and gauges and
+// writes them in the Prometheus text exposition format.
+//
+// It implements only what a single process exporting its own metrics
+// needs, so it has no dependencies.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets are histogram bucket bounds suited to latencies in
+// seconds, from 5ms to 10s.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// A Registry is a set of metrics. It is safe for concurrent use.
+type Registry struct {
+	mu       sync.Mutex
+	metrics  map[string]metric
+	collects []func()
+}
+
+type metric interface {
+	// write writes the samples of the metric called name. The
+	// registry's lock is held.
+	write(w *bufio.Writer, name string)
+}
+
+type desc struct {
+	help, typ string
+	labels    []string
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]metric)}
+}
+
+func (r *Registry) register(name string, m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.metrics[name]; ok {
+		panic("metric " + name + " registered twice")
+	}
+	r.metrics[name] = m
+}
+
+// OnCollect registers fn to run each time r is written, before any
+// metric functions. This lets several metric functions share data
+// that's expensive to gather, such as runtime.MemStats. Calls are
+// serialized, and fn must not use the registry.
+func (r *Registry) OnCollect(fn func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collects = append(r.collects, fn)
+}
+
+// WriteText writes every metric in r to w in the Prometheus text
+// format, in order by name.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, fn := range r.collects {
+		fn()
+	}
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	bw := bufio.NewWriter(w)
+	for _, name := range names {
+		r.metrics[name].write(bw, name)
+	}
+	return bw.Flush()
+}
+
+// ServeHTTP serves r in the Prometheus text format.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteText(w)
+}
+
+func (d *desc) header(w *bufio.Writer, name string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(d.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, d.typ)
+}
+
+// key joins label values into a map key.
+func (d *desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("got %d label values, want %d", len(values), len(d.labels)))
+	}
+	return strings.Join(values, "\x00")
+}
+
+// sample writes one sample of name with d's labels set to values,
+// plus an extra label if extra isn't "".
+func (d *desc) sample(w *bufio.Writer, name string, values []string, extra, extraVal string, v float64) {
+	w.WriteString(name)
+	if len(values) > 0 || extra != "" {
+		w.WriteByte('{')
+		for i, l := range d.labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			writeLabel(w, l, values[i])
+		}
+		if extra != "" {
+			if len(values) > 0 {
+				w.WriteByte(',')
+			}
+			writeLabel(w, extra, extraVal)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(v))
+	w.WriteByte('\n')
+}
+
+func writeLabel(w *bufio.Writer, label, val string) {
+	w.WriteString(label)
+	w.WriteString(`="`)
+	w.WriteString(strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(val))
+	w.WriteByte('"')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// sortedKeys returns the keys of m in order, which orders samples by
+// label values.
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// A Counter is a set of monotonically increasing values, one for each
+// combination of label values.
+type Counter struct {
+	desc
+	values map[string][]string
+	counts map[string]float64
+	r      *Registry
+}
+
+// NewCounter registers a counter called name with the given labels.
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{desc{help, "counter", labels}, make(map[string][]string), make(map[string]float64), r}
+	r.register(name, c)
+	return c
+}
+
+// Add adds v, which must not be negative, to the counter with the
+// given label values.
+func (c *Counter) Add(v float64, values ...string) {
+	k := c.key(values)
+	c.r.mu.Lock()
+	defer c.r.mu.Unlock()
+	if _, ok := c.values[k]; !ok {
+		c.values[k] = append([]string(nil), values...)
+	}
+	c.counts[k] += v
+}
+
+func (c *Counter) write(w *bufio.Writer, name string) {
+	c.header(w, name)
+	for _, k := range sortedKeys(c.values) {
+		c.sample(w, name, c.values[k], "", "", c.counts[k])
+	}
+}
+
+// A Histogram counts observations, such as latencies, in buckets,
+// separately for each combination of label values.
+type Histogram struct {
+	desc
+	buckets []float64
+	values  map[string][]string
+	series  map[string]*histSeries
+	r       *Registry
+}
+
+type histSeries struct {
+	counts []uint64 // Per bucket, not cumulative; last is +Inf
+	sum    float64
+}
+
+// NewHistogram registers a histogram called name with the given
+// upper bucket bounds, which must be increasing, and labels. A +Inf
+// bucket is implied.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{desc{help, "histogram", labels}, buckets, make(map[string][]string), make(map[string]*histSeries), r}
+	r.register(name, h)
+	return h
+}
+
+// Observe records v in the histogram with the given label values.
+func (h *Histogram) Observe(v float64, values ...string) {
+	k := h.key(values)
+	i := sort.SearchFloat64s(h.buckets, v)
+	h.r.mu.Lock()
+	defer h.r.mu.Unlock()
+	s := h.series[k]
+	if s == nil {
+		h.values[k] = append([]string(nil), values...)
+		s = &histSeries{counts: make([]uint64, len(h.buckets)+1)}
+		h.series[k] = s
+	}
+	s.counts[i]++
+	s.sum += v
+}
+
+func (h *Histogram) write(w *bufio.Writer, name string) {
+	h.header(w, name)
+	for _, k := range sortedKeys(h.values) {
+		s, values := h.series[k], h.values[k]
+		var n uint64
+		for i, c := range s.counts {
+			n += c
+			le := math.Inf(1)
+			if i < len(h.buckets) {
+				le = h.buckets[i]
+			}
+			h.sample(w, name+"_bucket", values, "le", formatFloat(le), float64(n))
+		}
+		h.sample(w, name+"_sum", values, "", "", s.sum)
+		h.sample(w, name+"_count", values, "", "", float64(n))
+	}
+}
+
+// A Sample is the value of a metric with the given label values.
+type Sample struct {
+	Labels []string
+	Value  float64
+}
+
+// A funcMetric reads its samples from a function when it's written.
+type funcMetric struct {
+	desc
+	fn func() []Sample
+}
+
+// NewGaugeFunc registers a gauge called name whose samples are
+// returned by fn each time the registry is written. fn must not use
+// the registry.
+func (r *Registry) NewGaugeFunc(name, help string, labels []string, fn func() []Sample) {
+	r.register(name, &funcMetric{desc{help, "gauge", labels}, fn})
+}
+
+// NewCounterFunc is like NewGaugeFunc, but registers a counter, for
+// counts maintained elsewhere.
+func (r *Registry) NewCounterFunc(name, help string, labels []string, fn func() []Sample) {
+	r.register(name, &funcMetric{desc{help, "counter", labels}, fn})
+}
+
+func (m *funcMetric) write(w *bufio.Writer, name string) {
+	m.header(w, name)
+	samples := m.fn()
+	sort.Slice(samples, func(i, j int) bool {
+		return strings.Join(samples[i].Labels, "\x00") < strings.Join(samples[j].Labels, "\x00")
+	})
+	for _, s := range samples {
+		m.key(s.Labels) // Check the number of labels.
+		m.sample(w, name, s.Labels, "", "", s.Value)
+	}
+}
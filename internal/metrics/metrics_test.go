@@ -0,0 +1,85 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("requests_total", "Requests served.", "path")
+	c.Add(1, "/b")
+	c.Add(2, `/a"`)
+	c.Add(1, "/b")
+	h := r.NewHistogram("latency_seconds", "Request latency.", []float64{0.1, 1})
+	h.Observe(0.05)
+	h.Observe(0.1)
+	h.Observe(3)
+	r.NewGaugeFunc("bytes", "Bytes\nused.", []string{"cache"}, func() []Sample {
+		return []Sample{{[]string{"y"}, 2}, {[]string{"x"}, 1.5}}
+	})
+
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	const want = `# HELP bytes Bytes\nused.
+# TYPE bytes gauge
+bytes{cache="x"} 1.5
+bytes{cache="y"} 2
+# HELP latency_seconds Request latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 2
+latency_seconds_bucket{le="1"} 2
+latency_seconds_bucket{le="+Inf"} 3
+latency_seconds_sum 3.15
+latency_seconds_count 3
+# HELP requests_total Requests served.
+# TYPE requests_total counter
+requests_total{path="/a\""} 2
+requests_total{path="/b"} 2
+`
+	if got := b.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestLabelCount(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("c", "", "a", "b")
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Add with too few label values didn't panic")
+		}
+	}()
+	c.Add(1, "x")
+}
+
+func TestOnCollect(t *testing.T) {
+	r := NewRegistry()
+	var collects int
+	var v float64
+	r.OnCollect(func() {
+		collects++
+		v++
+	})
+	for _, name := range []string{"a", "b"} {
+		r.NewGaugeFunc(name, "", nil, func() []Sample { return []Sample{{Value: v}} })
+	}
+
+	for i := 1; i <= 2; i++ {
+		var b strings.Builder
+		r.WriteText(&b)
+		if collects != i {
+			t.Fatalf("after %d writes, got %d collects", i, collects)
+		}
+		if want := fmt.Sprintf("a %d\n", i); !strings.Contains(b.String(), want) || !strings.Contains(b.String(), "b"+want[1:]) {
+			t.Errorf("write %d: got:\n%s\nwant gauges a and b equal to %d", i, b.String(), i)
+		}
+	}
+}
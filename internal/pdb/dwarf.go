@@ -0,0 +1,321 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pdb
+
+import (
+	"debug/dwarf"
+	"encoding/binary"
+	"sort"
+)
+
+// DWARF returns a synthesized DWARF equivalent of f's modules,
+// functions, and line tables, so PDB debug info can be used anywhere
+// DWARF is. Each module becomes a compile unit with a subprogram for
+// each function and a line table. addr maps PDB addresses to
+// addresses in the image; ranges it can't map are omitted.
+//
+// The result has no type or variable information.
+func (f *File) DWARF(addr func(Addr) (uint64, bool)) (*dwarf.Data, error) {
+	funcs := make([][]Sym, len(f.Modules))
+	for _, sym := range f.Syms {
+		if sym.Kind == SymFunc && sym.Module >= 0 && sym.Module < len(funcs) {
+			funcs[sym.Module] = append(funcs[sym.Module], sym)
+		}
+	}
+
+	abbrev := []byte{
+		abbrevCU, tagCompileUnit, 1,
+		atName, formString,
+		atLowpc, formAddr,
+		atRanges, formSecOffset,
+		atStmtList, formSecOffset,
+		0, 0,
+		abbrevFunc, tagSubprogram, 0,
+		atName, formString,
+		atLowpc, formAddr,
+		atHighpc, formData4,
+		atExternal, formFlag,
+		atDeclFile, formUdata,
+		atDeclLine, formUdata,
+		0, 0,
+		0,
+	}
+	var info, line, ranges []byte
+	le := binary.LittleEndian
+	for i, mod := range f.Modules {
+		// Collect the code ranges and line sequences of this
+		// module.
+		var seqs []lineSeq
+		var cuRanges [][2]uint64
+		for _, ls := range mod.Lines {
+			if a, ok := addr(ls.Addr); ok && ls.Size > 0 {
+				seqs = append(seqs, lineSeq{a, ls})
+				cuRanges = append(cuRanges, [2]uint64{a, a + uint64(ls.Size)})
+			}
+		}
+		type fn struct {
+			addr uint64
+			Sym
+		}
+		var fns []fn
+		for _, sym := range funcs[i] {
+			if a, ok := addr(sym.Addr); ok && sym.Size > 0 {
+				fns = append(fns, fn{a, sym})
+				cuRanges = append(cuRanges, [2]uint64{a, a + uint64(sym.Size)})
+			}
+		}
+		if len(cuRanges) == 0 {
+			continue
+		}
+		sort.Slice(seqs, func(i, j int) bool { return seqs[i].addr < seqs[j].addr })
+		sort.Slice(cuRanges, func(i, j int) bool { return cuRanges[i][0] < cuRanges[j][0] })
+		sort.Slice(fns, func(i, j int) bool { return fns[i].addr < fns[j].addr })
+
+		// Functions usually coincide with line sequences, so
+		// merge overlapping ranges. Ranges are relative to the
+		// CU's low PC, which is 0.
+		merged := cuRanges[:1]
+		for _, r := range cuRanges[1:] {
+			last := &merged[len(merged)-1]
+			if r[0] <= last[1] {
+				if r[1] > last[1] {
+					last[1] = r[1]
+				}
+				continue
+			}
+			merged = append(merged, r)
+		}
+		rangesOff := len(ranges)
+		for _, r := range merged {
+			ranges = appendU64(ranges, r[0])
+			ranges = appendU64(ranges, r[1])
+		}
+		ranges = appendU64(appendU64(ranges, 0), 0)
+
+		var files []string
+		fileIdx := make(map[string]uint64)
+		for _, s := range seqs {
+			for _, row := range s.Rows {
+				if _, ok := fileIdx[row.File]; !ok {
+					files = append(files, row.File)
+					fileIdx[row.File] = uint64(len(files))
+				}
+			}
+		}
+		lineOff := len(line)
+		line = appendLineProgram(line, seqs, files, fileIdx)
+
+		// Compile unit header and DIE.
+		cuOff := len(info)
+		info = appendU32(info, 0) // Length, filled in below
+		info = appendU16(info, 4) // Version
+		info = appendU32(info, 0) // Abbrev offset
+		info = append(info, 8)    // Address size
+		info = append(info, abbrevCU)
+		info = appendString(info, mod.Name)
+		info = appendU64(info, 0)
+		info = appendU32(info, uint32(rangesOff))
+		info = appendU32(info, uint32(lineOff))
+		for _, fn := range fns {
+			info = append(info, abbrevFunc)
+			info = appendString(info, fn.Name)
+			info = appendU64(info, fn.addr)
+			info = appendU32(info, fn.Size)
+			if fn.Local {
+				info = append(info, 0)
+			} else {
+				info = append(info, 1)
+			}
+			// Take the declaration position from the
+			// function's first line table row.
+			var declFile uint64
+			var declLine int
+			if row, ok := findRow(seqs, fn.addr); ok {
+				declFile, declLine = fileIdx[row.File], row.Line
+			}
+			info = appendULEB(info, declFile)
+			info = appendULEB(info, uint64(declLine))
+		}
+		info = append(info, 0) // End of children
+		le.PutUint32(info[cuOff:], uint32(len(info)-cuOff-4))
+	}
+	if len(info) == 0 {
+		return nil, ErrNoDebugInfo
+	}
+	return dwarf.New(abbrev, nil, nil, info, line, nil, ranges, nil)
+}
+
+// ErrNoDebugInfo is returned by File.DWARF if there are no functions
+// or line tables to convert.
+var ErrNoDebugInfo = formatError("pdb: no functions or line tables")
+
+// DWARF constants used by the synthesized DWARF.
+const (
+	abbrevCU   = 1
+	abbrevFunc = 2
+
+	tagCompileUnit = 0x11
+	tagSubprogram  = 0x2e
+
+	atName     = 0x03
+	atStmtList = 0x10
+	atLowpc    = 0x11
+	atHighpc   = 0x12
+	atDeclFile = 0x3a
+	atDeclLine = 0x3b
+	atExternal = 0x3f
+	atRanges   = 0x55
+
+	formAddr      = 0x01
+	formData4     = 0x06
+	formString    = 0x08
+	formFlag      = 0x0c
+	formUdata     = 0x0f
+	formSecOffset = 0x17
+
+	lnsCopy        = 1
+	lnsAdvancePC   = 2
+	lnsAdvanceLine = 3
+	lnsSetFile     = 4
+	lnsNegateStmt  = 6
+	lneEndSequence = 1
+	lneSetAddress  = 2
+)
+
+// A lineSeq is a LineSeq at an image address.
+type lineSeq struct {
+	addr uint64
+	LineSeq
+}
+
+// findRow returns the line table row covering addr in seqs, which
+// are sorted by address.
+func findRow(seqs []lineSeq, addr uint64) (LineRow, bool) {
+	i := sort.Search(len(seqs), func(i int) bool { return seqs[i].addr > addr }) - 1
+	if i < 0 || addr-seqs[i].addr >= uint64(seqs[i].Size) {
+		return LineRow{}, false
+	}
+	off := uint32(addr - seqs[i].addr)
+	rows := seqs[i].Rows
+	j := sort.Search(len(rows), func(j int) bool { return rows[j].Off > off }) - 1
+	if j < 0 {
+		return LineRow{}, false
+	}
+	return rows[j], true
+}
+
+// appendLineProgram appends a DWARF 4 line number program for seqs to
+// b. files lists the file names, and fileIdx maps each name to its
+// 1-based index in files.
+func appendLineProgram(b []byte, seqs []lineSeq, files []string, fileIdx map[string]uint64) []byte {
+	le := binary.LittleEndian
+	start := len(b)
+	b = appendU32(b, 0) // Length, filled in below
+	b = appendU16(b, 4) // Version
+	hdrLenOff := len(b)
+	b = appendU32(b, 0) // Header length, filled in below
+	b = append(b,
+		1,                                  // Minimum instruction length
+		1,                                  // Maximum operations per instruction
+		1,                                  // Default is_stmt
+		0xfb,                               // Line base (-5)
+		14,                                 // Line range
+		13,                                 // Opcode base
+		0, 1, 1, 1, 1, 0, 0, 0, 1, 0, 0, 1, // Standard opcode lengths
+		0, // No include directories
+	)
+	for _, name := range files {
+		b = appendString(b, name)
+		b = append(b, 0, 0, 0) // Directory, mtime, length
+	}
+	b = append(b, 0)
+	le.PutUint32(b[hdrLenOff:], uint32(len(b)-hdrLenOff-4))
+
+	for _, s := range seqs {
+		b = append(b, 0, 9, lneSetAddress)
+		b = appendU64(b, s.addr)
+		var off uint32
+		file, line, stmt := uint64(1), 1, true
+		for _, row := range s.Rows {
+			if row.Off >= s.Size {
+				break
+			}
+			if row.Off > off {
+				b = append(b, lnsAdvancePC)
+				b = appendULEB(b, uint64(row.Off-off))
+				off = row.Off
+			}
+			if f := fileIdx[row.File]; f != file {
+				b = append(b, lnsSetFile)
+				b = appendULEB(b, f)
+				file = f
+			}
+			// MSVC marks compiler-generated code with
+			// special line numbers starting at 0xf00000.
+			l := row.Line
+			if l >= 0xf00000 {
+				l = 0
+			}
+			if l != line {
+				b = append(b, lnsAdvanceLine)
+				b = appendSLEB(b, int64(l-line))
+				line = l
+			}
+			if row.Stmt != stmt {
+				b = append(b, lnsNegateStmt)
+				stmt = row.Stmt
+			}
+			b = append(b, lnsCopy)
+		}
+		if s.Size > off {
+			b = append(b, lnsAdvancePC)
+			b = appendULEB(b, uint64(s.Size-off))
+		}
+		b = append(b, 0, 1, lneEndSequence)
+	}
+	le.PutUint32(b[start:], uint32(len(b)-start-4))
+	return b
+}
+
+func appendU16(b []byte, v uint16) []byte {
+	return append(b, byte(v), byte(v>>8))
+}
+
+func appendU32(b []byte, v uint32) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+func appendU64(b []byte, v uint64) []byte {
+	return appendU32(appendU32(b, uint32(v)), uint32(v>>32))
+}
+
+func appendString(b []byte, s string) []byte {
+	return append(append(b, s...), 0)
+}
+
+func appendULEB(b []byte, v uint64) []byte {
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		if v != 0 {
+			c |= 0x80
+		}
+		b = append(b, c)
+		if v == 0 {
+			return b
+		}
+	}
+}
+
+func appendSLEB(b []byte, v int64) []byte {
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		if (v == 0 && c&0x40 == 0) || (v == -1 && c&0x40 != 0) {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// msf is a multi-stream file. It's divided into fixed-size blocks,
+// and each stream is a list of blocks, which the stream directory
+// records.
+type msf struct {
+	r         io.ReaderAt
+	blockSize uint32
+	numBlocks uint32
+	sizes     []uint32
+	blocks    [][]uint32
+}
+
+// nilStream is the size of a stream that doesn't exist.
+const nilStream = 0xffffffff
+
+func openMSF(r io.ReaderAt) (*msf, error) {
+	var hdr [56]byte
+	if _, err := r.ReadAt(hdr[:], 0); err != nil || string(hdr[:32]) != string(msfMagic) {
+		return nil, formatError("pdb: not a PDB file")
+	}
+	le := binary.LittleEndian
+	m := &msf{r: r, blockSize: le.Uint32(hdr[32:]), numBlocks: le.Uint32(hdr[40:])}
+	dirBytes, blockMapAddr := le.Uint32(hdr[44:]), le.Uint32(hdr[52:])
+	switch m.blockSize {
+	case 512, 1024, 2048, 4096, 8192, 16384, 32768:
+	default:
+		return nil, fmt.Errorf("pdb: bad block size %d", m.blockSize)
+	}
+
+	// The block map lists the blocks of the stream directory.
+	nDirBlocks := (dirBytes + m.blockSize - 1) / m.blockSize
+	if nDirBlocks > m.blockSize/4 || blockMapAddr >= m.numBlocks {
+		return nil, formatError("pdb: bad stream directory")
+	}
+	blockMap := make([]byte, 4*nDirBlocks)
+	if _, err := r.ReadAt(blockMap, int64(blockMapAddr)*int64(m.blockSize)); err != nil {
+		return nil, fmt.Errorf("pdb: reading block map: %v", err)
+	}
+	dirBlocks := make([]uint32, nDirBlocks)
+	for i := range dirBlocks {
+		dirBlocks[i] = le.Uint32(blockMap[4*i:])
+	}
+	dir, err := m.read(dirBlocks, dirBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	// The directory is the number of streams, the size of each
+	// stream, and then the blocks of each stream.
+	b := &buf{data: dir}
+	n := b.u32()
+	if uint64(n)*4 > uint64(len(b.data)) {
+		return nil, formatError("pdb: bad stream directory")
+	}
+	m.sizes = make([]uint32, n)
+	for i := range m.sizes {
+		m.sizes[i] = b.u32()
+	}
+	m.blocks = make([][]uint32, n)
+	for i, size := range m.sizes {
+		if size == nilStream {
+			continue
+		}
+		nb := (uint64(size) + uint64(m.blockSize) - 1) / uint64(m.blockSize)
+		if nb*4 > uint64(len(b.data)) {
+			return nil, formatError("pdb: bad stream directory")
+		}
+		m.blocks[i] = make([]uint32, nb)
+		for j := range m.blocks[i] {
+			m.blocks[i][j] = b.u32()
+		}
+	}
+	return m, b.err
+}
+
+// stream returns the contents of stream i. A stream that doesn't
+// exist is empty.
+func (m *msf) stream(i int) ([]byte, error) {
+	if i < 0 || i >= len(m.sizes) {
+		return nil, fmt.Errorf("pdb: stream %d out of range", i)
+	}
+	if m.sizes[i] == nilStream {
+		return nil, nil
+	}
+	data, err := m.read(m.blocks[i], m.sizes[i])
+	if err != nil {
+		return nil, fmt.Errorf("pdb: reading stream %d: %v", i, err)
+	}
+	return data, nil
+}
+
+// read reads size bytes from the given blocks.
+func (m *msf) read(blocks []uint32, size uint32) ([]byte, error) {
+	if uint64(size) > uint64(len(blocks))*uint64(m.blockSize) {
+		return nil, formatError("pdb: stream larger than its blocks")
+	}
+	out := make([]byte, size)
+	for i, blk := range blocks {
+		if blk >= m.numBlocks {
+			return nil, fmt.Errorf("pdb: block %d out of range", blk)
+		}
+		start := uint32(i) * m.blockSize
+		if start >= size {
+			break
+		}
+		end := start + m.blockSize
+		if end > size {
+			end = size
+		}
+		if _, err := m.r.ReadAt(out[start:end], int64(blk)*int64(m.blockSize)); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,554 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package pdb reads the symbols and line tables from Microsoft PDB
+// (program database) files, the debug info format for Windows PE
+// images.
+//
+// A PDB is a multi-stream file (MSF) containing many streams. This
+// package reads the PDB info stream, the DBI stream and its module
+// streams, the global symbol record stream, and the "/names" string
+// table. It doesn't read type information.
+//
+// See https://llvm.org/docs/PDB/index.html.
+package pdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// A File is a parsed PDB file.
+type File struct {
+	// GUID and Age identify the image this PDB belongs to. They
+	// match the CodeView entry in the image's debug directory.
+	GUID [16]byte
+	Age  uint32
+
+	// Modules are the compilation units (object files) linked
+	// into the image.
+	Modules []Module
+
+	// Syms are the functions, data, and public symbols in the
+	// image, in the order they appear in the PDB.
+	Syms []Sym
+}
+
+// A Module is one object file linked into the image.
+type Module struct {
+	// Name is the name of the module, usually the path of the
+	// object file. ObjFile is the archive containing the object
+	// file, or the object file itself.
+	Name, ObjFile string
+
+	// Lines are the line tables for this module's code.
+	Lines []LineSeq
+}
+
+// An Addr is an address in a PE image, given as a 1-based section
+// number and an offset within that section.
+type Addr struct {
+	Seg uint16
+	Off uint32
+}
+
+// A LineSeq maps a contiguous range of code to source lines.
+type LineSeq struct {
+	Addr Addr
+	Size uint32
+	// Rows are the line table rows in increasing Off order. Each
+	// row covers code up to the next row or the end of the
+	// sequence.
+	Rows []LineRow
+}
+
+// A LineRow is one row of a line table.
+type LineRow struct {
+	// Off is the offset of this row from the start of the
+	// sequence.
+	Off  uint32
+	File string
+	Line int
+	// Stmt indicates this is the start of a statement.
+	Stmt bool
+}
+
+// A Sym is a symbol from a PDB.
+type Sym struct {
+	Name string
+	Kind SymKind
+	Addr Addr
+	// Size is the size of a function in bytes. It is 0 for data
+	// and public symbols, which don't record their size.
+	Size uint32
+	// Local indicates this symbol is only visible within its
+	// module, like a C static.
+	Local bool
+	// Module is the index in File.Modules of the module that
+	// defines this symbol, or -1 if unknown.
+	Module int
+}
+
+type SymKind uint8
+
+const (
+	// SymFunc is a function from a module's symbols. Its name is
+	// undecorated.
+	SymFunc SymKind = 1 + iota
+	// SymData is a global or static variable.
+	SymData
+	// SymPublic is a public symbol. Its name is the decorated
+	// linker name.
+	SymPublic
+	// SymPublicFunc is a public symbol for code.
+	SymPublicFunc
+)
+
+var msfMagic = []byte("Microsoft C/C++ MSF 7.00\r\n\x1aDS\x00\x00\x00")
+
+// IsPDB reports whether r starts with the PDB file signature.
+func IsPDB(r io.ReaderAt) bool {
+	var magic [32]byte
+	if _, err := r.ReadAt(magic[:], 0); err != nil {
+		return false
+	}
+	return bytes.Equal(magic[:], msfMagic)
+}
+
+// Well-known stream indexes.
+const (
+	streamPDB = 1
+	streamDBI = 3
+)
+
+// Open parses the PDB file in r.
+func Open(r io.ReaderAt) (*File, error) {
+	m, err := openMSF(r)
+	if err != nil {
+		return nil, err
+	}
+	f := new(File)
+
+	// The PDB info stream identifies the PDB and names other
+	// streams.
+	info, err := m.stream(streamPDB)
+	if err != nil {
+		return nil, err
+	}
+	named, err := f.readInfo(info)
+	if err != nil {
+		return nil, err
+	}
+	var names []byte
+	if i, ok := named["/names"]; ok {
+		data, err := m.stream(int(i))
+		if err != nil {
+			return nil, err
+		}
+		if names, err = readStringTable(data); err != nil {
+			return nil, err
+		}
+	}
+
+	dbi, err := m.stream(streamDBI)
+	if err != nil {
+		return nil, err
+	}
+	if len(dbi) == 0 {
+		// No debug info, just the identity.
+		return f, nil
+	}
+	symRecStream, err := f.readDBI(m, dbi, names)
+	if err != nil {
+		return nil, err
+	}
+
+	// The symbol record stream holds the global and public
+	// symbols.
+	if symRecStream != 0xffff {
+		data, err := m.stream(int(symRecStream))
+		if err != nil {
+			return nil, err
+		}
+		f.Syms = append(f.Syms, readSyms(data, -1)...)
+	}
+	return f, nil
+}
+
+// ReadGUID returns the GUID identifying the PDB file in r, without
+// reading the rest of the PDB.
+func ReadGUID(r io.ReaderAt) ([16]byte, error) {
+	var guid [16]byte
+	m, err := openMSF(r)
+	if err != nil {
+		return guid, err
+	}
+	info, err := m.stream(streamPDB)
+	if err != nil {
+		return guid, err
+	}
+	if len(info) < 28 {
+		return guid, formatError("pdb: PDB info stream too short")
+	}
+	copy(guid[:], info[12:])
+	return guid, nil
+}
+
+// readInfo parses the PDB info stream and returns its map of named
+// streams.
+func (f *File) readInfo(data []byte) (map[string]uint32, error) {
+	b := &buf{data: data}
+	b.u32() // Version
+	b.u32() // Signature
+	f.Age = b.u32()
+	copy(f.GUID[:], b.need(16))
+
+	// The named stream map is a string buffer followed by a hash
+	// table from string offsets to stream indexes.
+	strs := b.need(int(b.u32()))
+	b.u32() // Size
+	capacity := b.u32()
+	present := b.bits()
+	b.bits() // Deleted
+	if b.err != nil {
+		return nil, b.err
+	}
+	named := make(map[string]uint32)
+	for i := uint32(0); i < capacity && i/32 < uint32(len(present)); i++ {
+		if present[i/32]&(1<<(i%32)) == 0 {
+			continue
+		}
+		off, stream := b.u32(), b.u32()
+		if b.err != nil {
+			return nil, b.err
+		}
+		if int(off) < len(strs) {
+			named[cstring(strs[off:])] = stream
+		}
+	}
+	return named, nil
+}
+
+// readStringTable parses the "/names" stream and returns its string
+// buffer.
+func readStringTable(data []byte) ([]byte, error) {
+	b := &buf{data: data}
+	if b.u32() != 0xeffeeffe {
+		return nil, formatError("pdb: bad string table signature")
+	}
+	b.u32() // Version
+	strs := b.need(int(b.u32()))
+	return strs, b.err
+}
+
+// readDBI parses the DBI stream and the module streams it refers
+// to. It returns the index of the symbol record stream.
+func (f *File) readDBI(m *msf, data []byte, names []byte) (uint16, error) {
+	b := &buf{data: data}
+	if int32(b.u32()) != -1 {
+		return 0, formatError("pdb: unsupported DBI stream version")
+	}
+	b.u32() // VersionHeader
+	b.u32() // Age
+	b.u16() // GlobalStreamIndex
+	b.u16() // BuildNumber
+	b.u16() // PublicStreamIndex
+	b.u16() // PdbDllVersion
+	symRecStream := b.u16()
+	b.u16() // PdbDllRbld
+	modInfoSize := b.u32()
+	b.need(36) // Other substream sizes, flags, and machine
+	modInfo := b.need(int(modInfoSize))
+	if b.err != nil {
+		return 0, b.err
+	}
+
+	for mb := (&buf{data: modInfo}); len(mb.data) > 0 && mb.err == nil; {
+		mb.need(34) // Unused, section contribution, and flags
+		stream := mb.u16()
+		symSize := mb.u32()
+		c11Size := mb.u32()
+		c13Size := mb.u32()
+		mb.need(16) // Source file count and unused fields
+		mod := Module{Name: mb.cstring(), ObjFile: mb.cstring()}
+		// Each entry is padded to a multiple of 4 bytes.
+		if pad := (len(modInfo) - len(mb.data)) % 4; pad != 0 {
+			mb.need(4 - pad)
+		}
+		if mb.err != nil {
+			return 0, mb.err
+		}
+
+		modIdx := len(f.Modules)
+		if stream != 0xffff {
+			sdata, err := m.stream(int(stream))
+			if err != nil {
+				return 0, err
+			}
+			if uint64(symSize)+uint64(c11Size)+uint64(c13Size) > uint64(len(sdata)) {
+				return 0, fmt.Errorf("pdb: module %s: stream too short", mod.Name)
+			}
+			// The symbols start with a 4-byte signature.
+			if symSize >= 4 {
+				f.Syms = append(f.Syms, readSyms(sdata[4:symSize], modIdx)...)
+			}
+			c13 := sdata[symSize+c11Size : symSize+c11Size+c13Size]
+			mod.Lines, err = readLines(c13, names)
+			if err != nil {
+				return 0, fmt.Errorf("pdb: module %s: %v", mod.Name, err)
+			}
+		}
+		f.Modules = append(f.Modules, mod)
+	}
+	return symRecStream, nil
+}
+
+// CodeView symbol record kinds.
+const (
+	sThunk32    = 0x1102
+	sLData32    = 0x110c
+	sGData32    = 0x110d
+	sPub32      = 0x110e
+	sLProc32    = 0x110f
+	sGProc32    = 0x1110
+	sLThread32  = 0x1112
+	sGThread32  = 0x1113
+	sLProc32ID  = 0x1146
+	sGProc32ID  = 0x1147
+	pubFlagCode = 1
+	pubFlagFunc = 2
+)
+
+// readSyms reads the CodeView symbol records in data and returns the
+// ones that have addresses.
+func readSyms(data []byte, module int) []Sym {
+	var out []Sym
+	le := binary.LittleEndian
+	for len(data) >= 4 {
+		// Each record is a length (not counting itself), a
+		// kind, and kind-specific data.
+		n := int(le.Uint16(data))
+		if n < 2 || 2+n > len(data) {
+			break
+		}
+		kind := le.Uint16(data[2:])
+		b := &buf{data: data[4 : 2+n]}
+		data = data[2+n:]
+
+		sym := Sym{Module: module}
+		switch kind {
+		case sGProc32, sLProc32, sGProc32ID, sLProc32ID:
+			b.need(12) // Parent, End, and Next
+			sym.Size = b.u32()
+			b.need(12) // DbgStart, DbgEnd, and type
+			sym.Addr.Off = b.u32()
+			sym.Addr.Seg = b.u16()
+			b.u8() // Flags
+			sym.Kind = SymFunc
+			sym.Local = kind == sLProc32 || kind == sLProc32ID
+		case sThunk32:
+			b.need(12) // Parent, End, and Next
+			sym.Addr.Off = b.u32()
+			sym.Addr.Seg = b.u16()
+			sym.Size = uint32(b.u16())
+			b.u8() // Ordinal
+			sym.Kind = SymFunc
+		case sGData32, sLData32, sGThread32, sLThread32:
+			b.u32() // Type
+			sym.Addr.Off = b.u32()
+			sym.Addr.Seg = b.u16()
+			sym.Kind = SymData
+			sym.Local = kind == sLData32 || kind == sLThread32
+		case sPub32:
+			flags := b.u32()
+			sym.Addr.Off = b.u32()
+			sym.Addr.Seg = b.u16()
+			sym.Kind = SymPublic
+			if flags&(pubFlagCode|pubFlagFunc) != 0 {
+				sym.Kind = SymPublicFunc
+			}
+		default:
+			continue
+		}
+		sym.Name = b.cstring()
+		if b.err != nil || sym.Addr.Seg == 0 {
+			continue
+		}
+		out = append(out, sym)
+	}
+	return out
+}
+
+// C13 debug subsection kinds.
+const (
+	debugSLines        = 0xf2
+	debugSFileChecksum = 0xf4
+	debugSIgnore       = 0x80000000
+	linesHaveColumns   = 1
+)
+
+// readLines reads the line tables from the C13 debug subsections of
+// a module stream.
+func readLines(data []byte, names []byte) ([]LineSeq, error) {
+	le := binary.LittleEndian
+	var lines [][]byte
+	var checksums []byte
+	for len(data) >= 8 {
+		kind, n := le.Uint32(data), le.Uint32(data[4:])
+		if uint64(n) > uint64(len(data)-8) {
+			return nil, formatError("pdb: bad debug subsection length")
+		}
+		sub := data[8 : 8+n]
+		data = data[8+n:]
+		if pad := int(n+3)&^3 - int(n); pad <= len(data) {
+			data = data[pad:]
+		}
+		switch kind {
+		case debugSLines:
+			lines = append(lines, sub)
+		case debugSFileChecksum:
+			checksums = sub
+		}
+	}
+
+	// The line blocks refer to files by their offset in the file
+	// checksums subsection, which refers to the string table.
+	fileName := func(off uint32) string {
+		if uint64(off)+4 > uint64(len(checksums)) {
+			return ""
+		}
+		nameOff := le.Uint32(checksums[off:])
+		if uint64(nameOff) >= uint64(len(names)) {
+			return ""
+		}
+		return cstring(names[nameOff:])
+	}
+
+	var out []LineSeq
+	for _, sub := range lines {
+		b := &buf{data: sub}
+		var seq LineSeq
+		seq.Addr.Off = b.u32()
+		seq.Addr.Seg = b.u16()
+		flags := b.u16()
+		seq.Size = b.u32()
+		for len(b.data) > 0 && b.err == nil {
+			file := fileName(b.u32())
+			nLines := b.u32()
+			blockSize := b.u32()
+			if blockSize < 12 {
+				return nil, formatError("pdb: bad line block size")
+			}
+			block := &buf{data: b.need(int(blockSize - 12))}
+			for i := uint32(0); i < nLines && block.err == nil; i++ {
+				off := block.u32()
+				v := block.u32()
+				// The low 24 bits are the line number,
+				// and the high bit indicates a
+				// statement.
+				seq.Rows = append(seq.Rows, LineRow{Off: off, File: file, Line: int(v & 0xffffff), Stmt: v&(1<<31) != 0})
+			}
+			if flags&linesHaveColumns == 0 && block.err == nil && len(block.data) != 0 {
+				return nil, formatError("pdb: bad line block")
+			}
+			if block.err != nil {
+				return nil, block.err
+			}
+		}
+		if b.err != nil {
+			return nil, b.err
+		}
+		sort.SliceStable(seq.Rows, func(i, j int) bool {
+			return seq.Rows[i].Off < seq.Rows[j].Off
+		})
+		out = append(out, seq)
+	}
+	return out, nil
+}
+
+// buf is a little-endian cursor over a byte slice.
+type buf struct {
+	data []byte
+	err  error
+}
+
+func (b *buf) need(n int) []byte {
+	if b.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(b.data) {
+		b.err = formatError("pdb: unexpected end of data")
+		b.data = nil
+		return nil
+	}
+	out := b.data[:n]
+	b.data = b.data[n:]
+	return out
+}
+
+func (b *buf) u8() uint8 {
+	if p := b.need(1); p != nil {
+		return p[0]
+	}
+	return 0
+}
+
+func (b *buf) u16() uint16 {
+	if p := b.need(2); p != nil {
+		return binary.LittleEndian.Uint16(p)
+	}
+	return 0
+}
+
+func (b *buf) u32() uint32 {
+	if p := b.need(4); p != nil {
+		return binary.LittleEndian.Uint32(p)
+	}
+	return 0
+}
+
+// bits reads a bit vector, which is a word count followed by that
+// many 32-bit words.
+func (b *buf) bits() []uint32 {
+	n := b.u32()
+	if uint64(n)*4 > uint64(len(b.data)) {
+		b.need(len(b.data) + 1)
+		return nil
+	}
+	out := make([]uint32, n)
+	for i := range out {
+		out[i] = b.u32()
+	}
+	return out
+}
+
+func (b *buf) cstring() string {
+	if b.err != nil {
+		return ""
+	}
+	i := bytes.IndexByte(b.data, 0)
+	if i < 0 {
+		b.need(len(b.data) + 1)
+		return ""
+	}
+	s := string(b.data[:i])
+	b.data = b.data[i+1:]
+	return s
+}
+
+func cstring(p []byte) string {
+	if i := bytes.IndexByte(p, 0); i >= 0 {
+		p = p[:i]
+	}
+	return string(p)
+}
+
+type formatError string
+
+func (e formatError) Error() string {
+	return string(e)
+}
@@ -0,0 +1,310 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pdb
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"reflect"
+	"testing"
+)
+
+var testGUID = [16]byte{0x33, 0x22, 0x11, 0x00, 0x55, 0x44, 0x77, 0x66, 0x88, 0x99, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+
+// buildMSF lays out streams in a multi-stream file with 512-byte
+// blocks. A nil stream doesn't exist.
+func buildMSF(streams [][]byte) []byte {
+	const bs = 512
+	// Blocks 0-2 are the superblock and free block maps.
+	blocks := 3
+	alloc := func(data []byte) []uint32 {
+		var out []uint32
+		for i := 0; i < len(data); i += bs {
+			out = append(out, uint32(blocks))
+			blocks++
+		}
+		return out
+	}
+	var dir []byte
+	dir = appendU32(dir, uint32(len(streams)))
+	for _, s := range streams {
+		if s == nil {
+			dir = appendU32(dir, nilStream)
+		} else {
+			dir = appendU32(dir, uint32(len(s)))
+		}
+	}
+	var contents []byte
+	for _, s := range streams {
+		for _, b := range alloc(s) {
+			dir = appendU32(dir, b)
+		}
+		contents = append(contents, s...)
+		if pad := len(contents) % bs; pad != 0 {
+			contents = append(contents, make([]byte, bs-pad)...)
+		}
+	}
+	dirBlocks := alloc(dir)
+	blockMap := blocks
+	blocks++
+
+	out := make([]byte, 3*bs, blocks*bs)
+	copy(out, msfMagic)
+	sb := out[32:32:56]
+	sb = appendU32(sb, bs)
+	sb = appendU32(sb, 1)
+	sb = appendU32(sb, uint32(blocks))
+	sb = appendU32(sb, uint32(len(dir)))
+	sb = appendU32(sb, 0)
+	sb = appendU32(sb, uint32(blockMap))
+	out = append(out, contents...)
+	out = append(out, dir...)
+	out = append(out, make([]byte, len(dirBlocks)*bs-len(dir))...)
+	for _, b := range dirBlocks {
+		out = appendU32(out, b)
+	}
+	return append(out, make([]byte, bs-4*len(dirBlocks))...)
+}
+
+// record returns a CodeView symbol record.
+func record(kind uint16, data ...[]byte) []byte {
+	body := bytes.Join(data, nil)
+	return append(appendU16(appendU16(nil, uint16(2+len(body))), kind), body...)
+}
+
+// buildTestPDB returns a PDB with one module containing main, a
+// static data symbol, and a line table, and a symbol record stream
+// with a public symbol and a global data symbol.
+func buildTestPDB() []byte {
+	// PDB info stream, with a named stream map containing
+	// "/names" as stream 5.
+	var info []byte
+	info = appendU32(info, 20000404)
+	info = appendU32(info, 0)
+	info = appendU32(info, 2)
+	info = append(info, testGUID[:]...)
+	info = appendU32(info, 7)
+	info = append(info, "/names\x00"...)
+	info = appendU32(info, 1) // Size
+	info = appendU32(info, 1) // Capacity
+	info = appendU32(info, 1) // Present words
+	info = appendU32(info, 1)
+	info = appendU32(info, 0) // Deleted words
+	info = appendU32(info, 0)
+	info = appendU32(info, 5)
+
+	var names []byte
+	names = appendU32(names, 0xeffeeffe)
+	names = appendU32(names, 1)
+	strs := "\x00C:\\src\\main.c\x00C:\\src\\util.h\x00"
+	names = appendU32(names, uint32(len(strs)))
+	names = append(names, strs...)
+
+	// Module stream.
+	mod := appendU32(nil, 4)
+	mod = append(mod, record(sGProc32,
+		make([]byte, 12),
+		appendU32(nil, 0x20), // Size
+		make([]byte, 12),
+		appendU32(nil, 0x10), // Offset
+		appendU16(nil, 1),    // Segment
+		[]byte{0},
+		[]byte("main\x00"))...)
+	mod = append(mod, record(0x6, nil)...) // S_END
+	mod = append(mod, record(sLData32,
+		appendU32(nil, 0x74),
+		appendU32(nil, 0x8),
+		appendU16(nil, 2),
+		[]byte("counter\x00"))...)
+	symSize := len(mod)
+
+	var c13 []byte
+	checksums := []byte{1, 0, 0, 0, 0, 0, 0, 0, 15, 0, 0, 0, 0, 0, 0, 0}
+	c13 = appendU32(c13, debugSFileChecksum)
+	c13 = appendU32(c13, uint32(len(checksums)))
+	c13 = append(c13, checksums...)
+	var lines []byte
+	lines = appendU32(lines, 0x10)
+	lines = appendU16(lines, 1)
+	lines = appendU16(lines, 0)
+	lines = appendU32(lines, 0x20)
+	block := func(file uint32, rows ...uint32) {
+		lines = appendU32(lines, file)
+		lines = appendU32(lines, uint32(len(rows)/2))
+		lines = appendU32(lines, uint32(12+4*len(rows)))
+		for i := 0; i < len(rows); i += 2 {
+			lines = appendU32(lines, rows[i])
+			lines = appendU32(lines, rows[i+1]|1<<31)
+		}
+	}
+	block(0, 0, 3, 8, 4)
+	block(8, 0x10, 10)
+	c13 = appendU32(c13, debugSLines)
+	c13 = appendU32(c13, uint32(len(lines)))
+	c13 = append(c13, lines...)
+	mod = append(mod, c13...)
+
+	// DBI stream, with one module in stream 6 and the symbol
+	// record stream in stream 7.
+	var modInfo []byte
+	modInfo = append(modInfo, make([]byte, 34)...)
+	modInfo = appendU16(modInfo, 6)
+	modInfo = appendU32(modInfo, uint32(symSize))
+	modInfo = appendU32(modInfo, 0)
+	modInfo = appendU32(modInfo, uint32(len(c13)))
+	modInfo = append(modInfo, make([]byte, 16)...)
+	modInfo = append(modInfo, "main.obj\x00main.obj\x00"...)
+	for len(modInfo)%4 != 0 {
+		modInfo = append(modInfo, 0)
+	}
+	var dbi []byte
+	dbi = appendU32(dbi, 0xffffffff)
+	dbi = appendU32(dbi, 19990903)
+	dbi = appendU32(dbi, 2)
+	dbi = appendU16(dbi, 0xffff)
+	dbi = appendU16(dbi, 0)
+	dbi = appendU16(dbi, 0xffff)
+	dbi = appendU16(dbi, 0)
+	dbi = appendU16(dbi, 7)
+	dbi = appendU16(dbi, 0)
+	dbi = appendU32(dbi, uint32(len(modInfo)))
+	dbi = append(dbi, make([]byte, 36)...)
+	dbi = append(dbi, modInfo...)
+
+	var symRec []byte
+	symRec = append(symRec, record(sPub32,
+		appendU32(nil, pubFlagFunc),
+		appendU32(nil, 0x10),
+		appendU16(nil, 1),
+		[]byte("?main@@YAHXZ\x00\x00"))...)
+	symRec = append(symRec, record(sGData32,
+		appendU32(nil, 0x74),
+		appendU32(nil, 0),
+		appendU16(nil, 2),
+		[]byte("total\x00\x00\x00"))...)
+
+	return buildMSF([][]byte{{}, info, nil, dbi, nil, names, mod, symRec})
+}
+
+func TestOpen(t *testing.T) {
+	f, err := Open(bytes.NewReader(buildTestPDB()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.GUID != testGUID || f.Age != 2 {
+		t.Errorf("GUID, Age = %x, %d; want %x, 2", f.GUID, f.Age, testGUID)
+	}
+
+	wantLines := []LineSeq{{
+		Addr: Addr{1, 0x10},
+		Size: 0x20,
+		Rows: []LineRow{
+			{0, `C:\src\main.c`, 3, true},
+			{8, `C:\src\main.c`, 4, true},
+			{0x10, `C:\src\util.h`, 10, true},
+		},
+	}}
+	if len(f.Modules) != 1 {
+		t.Fatalf("got %d modules, want 1", len(f.Modules))
+	}
+	if m := f.Modules[0]; m.Name != "main.obj" || !reflect.DeepEqual(m.Lines, wantLines) {
+		t.Errorf("got module %+v, want main.obj with lines %+v", m, wantLines)
+	}
+
+	wantSyms := []Sym{
+		{"main", SymFunc, Addr{1, 0x10}, 0x20, false, 0},
+		{"counter", SymData, Addr{2, 0x8}, 0, true, 0},
+		{"?main@@YAHXZ", SymPublicFunc, Addr{1, 0x10}, 0, false, -1},
+		{"total", SymData, Addr{2, 0}, 0, false, -1},
+	}
+	if !reflect.DeepEqual(f.Syms, wantSyms) {
+		t.Errorf("got symbols:\n%+v\nwant:\n%+v", f.Syms, wantSyms)
+	}
+}
+
+func TestReadGUID(t *testing.T) {
+	guid, err := ReadGUID(bytes.NewReader(buildTestPDB()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if guid != testGUID {
+		t.Errorf("got GUID %x, want %x", guid, testGUID)
+	}
+}
+
+func TestDWARF(t *testing.T) {
+	f, err := Open(bytes.NewReader(buildTestPDB()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dw, err := f.DWARF(func(a Addr) (uint64, bool) {
+		return 0x140000000 + uint64(a.Seg)*0x1000 + uint64(a.Off), true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := dw.Reader()
+	cu, err := r.Next()
+	if err != nil || cu == nil || cu.Tag != dwarf.TagCompileUnit {
+		t.Fatalf("want compile unit, got %v, %v", cu, err)
+	}
+	if ranges, err := dw.Ranges(cu); err != nil || !reflect.DeepEqual(ranges, [][2]uint64{{0x140001010, 0x140001030}}) {
+		t.Errorf("CU ranges = %#x, %v", ranges, err)
+	}
+	sub, err := r.Next()
+	if err != nil || sub == nil || sub.Tag != dwarf.TagSubprogram {
+		t.Fatalf("want subprogram, got %v, %v", sub, err)
+	}
+	if name := sub.Val(dwarf.AttrName); name != "main" {
+		t.Errorf("subprogram name = %v, want main", name)
+	}
+	if ranges, err := dw.Ranges(sub); err != nil || !reflect.DeepEqual(ranges, [][2]uint64{{0x140001010, 0x140001030}}) {
+		t.Errorf("subprogram ranges = %#x, %v", ranges, err)
+	}
+
+	lr, err := dw.LineReader(cu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type row struct {
+		addr uint64
+		file string
+		line int
+		end  bool
+	}
+	var got []row
+	var le dwarf.LineEntry
+	for lr.Next(&le) == nil {
+		got = append(got, row{le.Address, le.File.Name, le.Line, le.EndSequence})
+	}
+	want := []row{
+		{0x140001010, `C:\src\main.c`, 3, false},
+		{0x140001018, `C:\src\main.c`, 4, false},
+		{0x140001020, `C:\src\util.h`, 10, false},
+		{0x140001030, `C:\src\util.h`, 10, true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got line table:\n%+v\nwant:\n%+v", got, want)
+	}
+	if file := sub.Val(dwarf.AttrDeclFile); file != int64(1) {
+		t.Errorf("subprogram decl file = %v, want 1", file)
+	}
+}
+
+func TestCorrupt(t *testing.T) {
+	// Truncated and damaged PDBs should fail cleanly.
+	data := buildTestPDB()
+	for n := 0; n < len(data); n += 64 {
+		Open(bytes.NewReader(data[:n]))
+	}
+	for i := 0; i < len(data); i++ {
+		damaged := append([]byte(nil), data...)
+		damaged[i] ^= 0xff
+		if f, err := Open(bytes.NewReader(damaged)); err == nil {
+			f.DWARF(func(a Addr) (uint64, bool) { return uint64(a.Off), true })
+		}
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package perfscript parses the text output of "perf script".
+//
+// It understands the default output format, call chains from "perf
+// record -g", branch stacks printed by the brstack and brstacksym
+// fields (for example, from "perf record -b" with LBR), and branch
+// events decoded from Intel PT by "perf script --itrace=b". Lines it
+// doesn't understand are ignored.
+package perfscript
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A Sample is one sample record.
+type Sample struct {
+	// IP is the sampled location. If the record has a call chain,
+	// this is its leaf.
+	IP Loc
+	// Period is the sample's period, or 1 if not printed.
+	Period uint64
+	// Branches is the sample's branch stack, most recent first.
+	Branches []Branch
+	// Target is the target of a branch event, in which case IP
+	// is the branch source. It is nil for other samples.
+	Target *Loc
+}
+
+// A Loc is a code location. Either Addr or Sym may be unknown.
+type Loc struct {
+	Addr    uint64
+	HasAddr bool
+	// Sym and Off give the location as an offset from a symbol,
+	// if known.
+	Sym string
+	Off uint64
+	// DSO is the object containing the location, if known.
+	DSO string
+}
+
+// A Branch is a taken branch from a branch stack.
+type Branch struct {
+	From, To   Loc
+	Mispredict bool
+}
+
+var (
+	// locRe matches "ip sym+0xoff (dso)", where "+0xoff" and the
+	// symbol may be missing.
+	locRe = regexp.MustCompile(`(?:^|\s)([0-9a-f]+)\s+(?:(\S+?)(?:\+0x([0-9a-f]+))?\s+)?\(([^)]*)\)`)
+	// periodRe matches the period following the timestamp and
+	// preceding the event name.
+	periodRe = regexp.MustCompile(`\d:\s+(\d+)\s+[\w\-.:/]+:`)
+	// brHexRe matches a brstack entry.
+	brHexRe = regexp.MustCompile(`^0x([0-9a-f]+)/0x([0-9a-f]+)/([PM-])/`)
+	// brSymRe matches a brstacksym entry. Go symbols may contain
+	// "/", so this relies on the "+0x" offsets.
+	brSymRe = regexp.MustCompile(`^(.+?)\+0x([0-9a-f]+)/(.+?)\+0x([0-9a-f]+)/([PM-])/`)
+)
+
+// Parse reads perf script output from r and returns its samples.
+func Parse(r io.Reader) ([]Sample, error) {
+	var samples []Sample
+	var cur *Sample
+	// inChain indicates the current record has call chain lines
+	// and the first has been seen.
+	var inChain bool
+	flush := func() {
+		if cur != nil && (cur.IP.HasAddr || cur.IP.Sym != "" || len(cur.Branches) > 0) {
+			samples = append(samples, *cur)
+		}
+		cur, inChain = nil, false
+	}
+
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 16<<20)
+	for s.Scan() {
+		line := s.Text()
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			flush()
+			continue
+		}
+		if strings.HasPrefix(line, "\t") && cur != nil {
+			// Call chain line. The first is the leaf.
+			if !inChain {
+				if loc, ok := parseLoc(line); ok {
+					cur.IP = loc
+					inChain = true
+				}
+			}
+			continue
+		}
+
+		// A new record.
+		flush()
+		cur = &Sample{Period: 1}
+		if m := periodRe.FindStringSubmatch(line); m != nil {
+			if p, err := strconv.ParseUint(m[1], 10, 64); err == nil {
+				cur.Period = p
+			}
+		}
+		if i := strings.Index(line, " => "); i >= 0 {
+			// Branch event.
+			from, ok1 := parseLoc(line[:i])
+			to, ok2 := parseLoc(line[i+len(" => "):])
+			if ok1 && ok2 {
+				cur.IP, cur.Target = from, &to
+			}
+		} else if loc, ok := parseLoc(line); ok {
+			cur.IP = loc
+		}
+		for _, f := range strings.Fields(line) {
+			if br, ok := parseBranch(f); ok {
+				cur.Branches = append(cur.Branches, br)
+			}
+		}
+	}
+	flush()
+	return samples, s.Err()
+}
+
+func parseLoc(text string) (Loc, bool) {
+	m := locRe.FindStringSubmatch(text)
+	if m == nil {
+		return Loc{}, false
+	}
+	var loc Loc
+	addr, err := strconv.ParseUint(m[1], 16, 64)
+	if err != nil {
+		return Loc{}, false
+	}
+	loc.Addr, loc.HasAddr = addr, true
+	if m[2] != "" && m[2] != "[unknown]" {
+		loc.Sym = m[2]
+		loc.Off, _ = strconv.ParseUint(m[3], 16, 64)
+	}
+	loc.DSO = m[4]
+	return loc, true
+}
+
+func parseBranch(f string) (Branch, bool) {
+	if m := brHexRe.FindStringSubmatch(f); m != nil {
+		from, err1 := strconv.ParseUint(m[1], 16, 64)
+		to, err2 := strconv.ParseUint(m[2], 16, 64)
+		if err1 != nil || err2 != nil {
+			return Branch{}, false
+		}
+		return Branch{Loc{Addr: from, HasAddr: true}, Loc{Addr: to, HasAddr: true}, m[3] == "M"}, true
+	}
+	if m := brSymRe.FindStringSubmatch(f); m != nil {
+		fromOff, err1 := strconv.ParseUint(m[2], 16, 64)
+		toOff, err2 := strconv.ParseUint(m[4], 16, 64)
+		if err1 != nil || err2 != nil {
+			return Branch{}, false
+		}
+		return Branch{Loc{Sym: m[1], Off: fromOff}, Loc{Sym: m[3], Off: toOff}, m[5] == "M"}, true
+	}
+	return Branch{}, false
+}
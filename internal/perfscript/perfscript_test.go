@@ -0,0 +1,45 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package perfscript
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	const input = `# header comment
+               t  1234 [000] 12345.678901:     250000 cycles:u:      401126 main+0x16 (/tmp/t)
+               t  1234 [000] 12345.679901:     250000 cycles:u: 
+	          401150 net/http.(*conn).serve+0x10 (/tmp/t)
+	          401000 main+0x0 (/tmp/t)
+
+               t  1234 12345.680000: 1 branches:  ffffffff8100 [unknown] ([kernel.kallsyms])  0x401126/0x401100/P/-/-/0  0x4010f0/0x401120/M/-/-/3
+               t  1234 12345.690000: branches:  main+0x16/net/http.f+0x0/P/-/-/0
+               t  1234 12345.700000:          1   branches:u:            401126 main+0x16 (/tmp/t) =>           401100 main+0x0 (/tmp/t)
+`
+	got, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Sample{
+		{IP: Loc{Addr: 0x401126, HasAddr: true, Sym: "main", Off: 0x16, DSO: "/tmp/t"}, Period: 250000},
+		{IP: Loc{Addr: 0x401150, HasAddr: true, Sym: "net/http.(*conn).serve", Off: 0x10, DSO: "/tmp/t"}, Period: 250000},
+		{IP: Loc{Addr: 0xffffffff8100, HasAddr: true, DSO: "[kernel.kallsyms]"}, Period: 1,
+			Branches: []Branch{
+				{From: Loc{Addr: 0x401126, HasAddr: true}, To: Loc{Addr: 0x401100, HasAddr: true}},
+				{From: Loc{Addr: 0x4010f0, HasAddr: true}, To: Loc{Addr: 0x401120, HasAddr: true}, Mispredict: true},
+			}},
+		{Period: 1, Branches: []Branch{
+			{From: Loc{Sym: "main", Off: 0x16}, To: Loc{Sym: "net/http.f"}},
+		}},
+		{IP: Loc{Addr: 0x401126, HasAddr: true, Sym: "main", Off: 0x16, DSO: "/tmp/t"}, Period: 1,
+			Target: &Loc{Addr: 0x401100, HasAddr: true, Sym: "main", DSO: "/tmp/t"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%+v\nwant:\n%+v", got, want)
+	}
+}
@@ -0,0 +1,341 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package profile reads and writes pprof-format profiles.
+//
+// Parse decodes only what's needed to attribute samples to
+// instruction addresses: sample types, sample values, the addresses
+// of each sample's stack, and the mappings that relate those
+// addresses to files. It ignores functions, line information, and
+// labels. A Builder writes profiles of weighted stacks of functions.
+package profile
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+)
+
+// A Profile is a decoded pprof profile.
+type Profile struct {
+	// SampleTypes gives the type of each value in Sample.Values.
+	SampleTypes []ValueType
+	Samples     []Sample
+	// Mappings are the files mapped into the profiled process,
+	// in the profile's order. By convention, the first is the
+	// main executable.
+	Mappings []Mapping
+}
+
+// A Mapping is a file mapped into the profiled process's address
+// space.
+type Mapping struct {
+	// Start and Limit are the range of addresses mapped.
+	Start, Limit uint64
+	// Offset is the offset in the file of the byte mapped at
+	// Start.
+	Offset uint64
+	File   string
+}
+
+// FindMapping returns the mapping containing address pc, or nil if
+// there is none.
+func (p *Profile) FindMapping(pc uint64) *Mapping {
+	for i := range p.Mappings {
+		m := &p.Mappings[i]
+		if m.Start <= pc && pc < m.Limit {
+			return m
+		}
+	}
+	return nil
+}
+
+// A ValueType describes a sample value, such as "alloc_space" in
+// "bytes".
+type ValueType struct {
+	Type, Unit string
+}
+
+// A Sample is a single stack and its values.
+type Sample struct {
+	// PCs is the stack of instruction addresses, leaf first.
+	// Non-leaf addresses are typically return addresses.
+	PCs    []uint64
+	Values []int64
+}
+
+// ValueIndex returns the index in Sample.Values of the value with
+// the given type, or -1 if there is no such value.
+func (p *Profile) ValueIndex(typ string) int {
+	for i, vt := range p.SampleTypes {
+		if vt.Type == typ {
+			return i
+		}
+	}
+	return -1
+}
+
+// Field numbers from profile.proto.
+const (
+	profSampleType  = 1
+	profSample      = 2
+	profMapping     = 3
+	profLocation    = 4
+	profFunction    = 5
+	profStringTable = 6
+
+	valueTypeType = 1
+	valueTypeUnit = 2
+
+	sampleLocationID = 1
+	sampleValue      = 2
+
+	mappingStart    = 2
+	mappingLimit    = 3
+	mappingOffset   = 4
+	mappingFilename = 5
+
+	locationID      = 1
+	locationAddress = 3
+	locationLine    = 4
+
+	lineFunctionID = 1
+	lineLine       = 2
+
+	functionID         = 1
+	functionName       = 2
+	functionSystemName = 3
+	functionFilename   = 4
+)
+
+// Parse decodes a pprof profile, which may be gzip-compressed.
+func Parse(data []byte) (*Profile, error) {
+	if len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b {
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		data, err = ioutil.ReadAll(gz)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Sample types and samples refer to the string and location
+	// tables, which may appear anywhere in the message, so
+	// collect the raw references first.
+	type rawValueType struct{ typ, unit int64 }
+	type rawSample struct {
+		locs   []uint64
+		values []int64
+	}
+	type rawMapping struct {
+		Mapping
+		file int64
+	}
+	var rawTypes []rawValueType
+	var rawSamples []rawSample
+	var rawMappings []rawMapping
+	var strtab []string
+	locs := make(map[uint64]uint64)
+
+	err := fields(data, func(num int, wire int, v uint64, b []byte) error {
+		switch num {
+		case profSampleType:
+			var vt rawValueType
+			err := fields(b, func(num int, wire int, v uint64, b []byte) error {
+				switch num {
+				case valueTypeType:
+					vt.typ = int64(v)
+				case valueTypeUnit:
+					vt.unit = int64(v)
+				}
+				return nil
+			})
+			rawTypes = append(rawTypes, vt)
+			return err
+
+		case profSample:
+			var s rawSample
+			err := fields(b, func(num int, wire int, v uint64, b []byte) error {
+				switch num {
+				case sampleLocationID:
+					return repeated(wire, v, b, func(v uint64) {
+						s.locs = append(s.locs, v)
+					})
+				case sampleValue:
+					return repeated(wire, v, b, func(v uint64) {
+						s.values = append(s.values, int64(v))
+					})
+				}
+				return nil
+			})
+			rawSamples = append(rawSamples, s)
+			return err
+
+		case profMapping:
+			var m rawMapping
+			err := fields(b, func(num int, wire int, v uint64, b []byte) error {
+				switch num {
+				case mappingStart:
+					m.Start = v
+				case mappingLimit:
+					m.Limit = v
+				case mappingOffset:
+					m.Offset = v
+				case mappingFilename:
+					m.file = int64(v)
+				}
+				return nil
+			})
+			rawMappings = append(rawMappings, m)
+			return err
+
+		case profLocation:
+			var id, addr uint64
+			err := fields(b, func(num int, wire int, v uint64, b []byte) error {
+				switch num {
+				case locationID:
+					id = v
+				case locationAddress:
+					addr = v
+				}
+				return nil
+			})
+			locs[id] = addr
+			return err
+
+		case profStringTable:
+			strtab = append(strtab, string(b))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("malformed profile: %v", err)
+	}
+
+	str := func(i int64) string {
+		if 0 <= i && i < int64(len(strtab)) {
+			return strtab[i]
+		}
+		return ""
+	}
+	p := new(Profile)
+	for _, vt := range rawTypes {
+		p.SampleTypes = append(p.SampleTypes, ValueType{str(vt.typ), str(vt.unit)})
+	}
+	for _, rm := range rawMappings {
+		m := rm.Mapping
+		m.File = str(rm.file)
+		p.Mappings = append(p.Mappings, m)
+	}
+	for i, rs := range rawSamples {
+		if len(rs.values) != len(p.SampleTypes) {
+			return nil, fmt.Errorf("malformed profile: sample %d has %d values, but there are %d sample types", i, len(rs.values), len(p.SampleTypes))
+		}
+		s := Sample{Values: rs.values}
+		for _, id := range rs.locs {
+			s.PCs = append(s.PCs, locs[id])
+		}
+		p.Samples = append(p.Samples, s)
+	}
+	return p, nil
+}
+
+// Protobuf wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// fields calls fn for each field in protobuf message data. For
+// varint and fixed fields, v is the value. For length-delimited
+// fields, b is the contents.
+func fields(data []byte, fn func(num int, wire int, v uint64, b []byte) error) error {
+	for len(data) > 0 {
+		key, n := varint(data)
+		if n <= 0 {
+			return fmt.Errorf("bad field key")
+		}
+		data = data[n:]
+		num, wire := int(key>>3), int(key&7)
+		var v uint64
+		var b []byte
+		switch wire {
+		case wireVarint:
+			v, n = varint(data)
+			if n <= 0 {
+				return fmt.Errorf("bad varint in field %d", num)
+			}
+			data = data[n:]
+		case wireFixed64:
+			if len(data) < 8 {
+				return fmt.Errorf("truncated field %d", num)
+			}
+			for i := 7; i >= 0; i-- {
+				v = v<<8 | uint64(data[i])
+			}
+			data = data[8:]
+		case wireBytes:
+			l, n := varint(data)
+			if n <= 0 || uint64(len(data)-n) < l {
+				return fmt.Errorf("truncated field %d", num)
+			}
+			b = data[n : n+int(l)]
+			data = data[n+int(l):]
+		case wireFixed32:
+			if len(data) < 4 {
+				return fmt.Errorf("truncated field %d", num)
+			}
+			for i := 3; i >= 0; i-- {
+				v = v<<8 | uint64(data[i])
+			}
+			data = data[4:]
+		default:
+			return fmt.Errorf("unknown wire type %d in field %d", wire, num)
+		}
+		if err := fn(num, wire, v, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// repeated decodes a repeated varint field, which may be either
+// packed or a single value.
+func repeated(wire int, v uint64, b []byte, fn func(uint64)) error {
+	if wire != wireBytes {
+		fn(v)
+		return nil
+	}
+	for len(b) > 0 {
+		v, n := varint(b)
+		if n <= 0 {
+			return fmt.Errorf("bad packed varint")
+		}
+		fn(v)
+		b = b[n:]
+	}
+	return nil
+}
+
+// varint decodes a varint from the beginning of b. It returns the
+// value and the number of bytes consumed, or n <= 0 on error.
+func varint(b []byte) (v uint64, n int) {
+	for shift := uint(0); shift < 64; shift += 7 {
+		if n >= len(b) {
+			return 0, 0
+		}
+		c := b[n]
+		n++
+		v |= uint64(c&0x7f) << shift
+		if c < 0x80 {
+			return v, n
+		}
+	}
+	return 0, -1
+}
@@ -0,0 +1,75 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package profile
+
+import (
+	"bytes"
+	"runtime"
+	"runtime/pprof"
+	"testing"
+)
+
+var sink []byte
+
+func TestParseHeap(t *testing.T) {
+	old := runtime.MemProfileRate
+	runtime.MemProfileRate = 1
+	defer func() { runtime.MemProfileRate = old }()
+	for i := 0; i < 100; i++ {
+		sink = make([]byte, 1024)
+	}
+	runtime.GC()
+
+	var buf bytes.Buffer
+	if err := pprof.Lookup("allocs").WriteTo(&buf, 0); err != nil {
+		t.Fatal(err)
+	}
+	p, err := Parse(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bytesIdx := p.ValueIndex("alloc_space")
+	if bytesIdx < 0 {
+		t.Fatalf("no alloc_space sample type in %v", p.SampleTypes)
+	}
+	if unit := p.SampleTypes[bytesIdx].Unit; unit != "bytes" {
+		t.Errorf("alloc_space unit is %q, want bytes", unit)
+	}
+	if p.ValueIndex("bogus") != -1 {
+		t.Errorf("found bogus sample type")
+	}
+
+	var total int64
+	for _, s := range p.Samples {
+		if len(s.Values) != len(p.SampleTypes) {
+			t.Fatalf("sample has %d values, want %d", len(s.Values), len(p.SampleTypes))
+		}
+		if len(s.PCs) == 0 || s.PCs[0] == 0 {
+			t.Fatalf("sample has no stack: %v", s.PCs)
+		}
+		if runtime.GOOS == "linux" && p.FindMapping(s.PCs[0]) == nil {
+			t.Fatalf("no mapping contains PC %#x in %+v", s.PCs[0], p.Mappings)
+		}
+		total += s.Values[bytesIdx]
+	}
+	if total < 100*1024 {
+		t.Errorf("total allocated bytes %d, want at least %d", total, 100*1024)
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	for _, data := range [][]byte{
+		{0x0a},             // Truncated key and length
+		{0x0a, 0x05, 0x00}, // Truncated bytes field
+		{0x0b},             // Unknown wire type
+		// One sample type, but a sample with two values
+		{0x0a, 0x00, 0x12, 0x04, 0x10, 0x01, 0x10, 0x02},
+	} {
+		if _, err := Parse(data); err == nil {
+			t.Errorf("Parse(%x) succeeded, want error", data)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package profile
+
+import (
+	"compress/gzip"
+	"io"
+)
+
+// A Frame is one frame of a stack added to a Builder.
+type Frame struct {
+	// Func is the function name. Frames with the same Func and
+	// File share a pprof function.
+	Func, File string
+	Line       int64
+	// Addr is the frame's instruction address, or 0 if it has
+	// none.
+	Addr uint64
+}
+
+// A Builder accumulates weighted stacks and writes them as a pprof
+// profile.
+type Builder struct {
+	types   []ValueType
+	samples []builderSample
+	locs    map[Frame]uint64
+	funcs   map[[2]string]uint64
+	strs    map[string]int64
+
+	// Encoded tables. IDs are indexes plus one.
+	locBuf, funcBuf buffer
+	strtab          []string
+}
+
+type builderSample struct {
+	locs   []int64
+	values []int64
+}
+
+// NewBuilder returns a Builder for profiles with the given sample
+// types.
+func NewBuilder(types ...ValueType) *Builder {
+	b := &Builder{
+		types: types,
+		locs:  make(map[Frame]uint64),
+		funcs: make(map[[2]string]uint64),
+		strs:  make(map[string]int64),
+	}
+	// The string table must start with "".
+	b.str("")
+	return b
+}
+
+// Add adds a sample with the given stack, leaf first, and one value
+// for each sample type.
+func (b *Builder) Add(stack []Frame, values ...int64) {
+	s := builderSample{values: values}
+	for _, f := range stack {
+		s.locs = append(s.locs, int64(b.loc(f)))
+	}
+	b.samples = append(b.samples, s)
+}
+
+func (b *Builder) str(s string) int64 {
+	i, ok := b.strs[s]
+	if !ok {
+		i = int64(len(b.strtab))
+		b.strtab = append(b.strtab, s)
+		b.strs[s] = i
+	}
+	return i
+}
+
+func (b *Builder) loc(f Frame) uint64 {
+	if id, ok := b.locs[f]; ok {
+		return id
+	}
+	id := uint64(len(b.locs) + 1)
+	b.locs[f] = id
+	var line, msg buffer
+	line.int(lineFunctionID, int64(b.fn(f.Func, f.File)))
+	line.int(lineLine, f.Line)
+	msg.int(locationID, int64(id))
+	msg.int(locationAddress, int64(f.Addr))
+	msg.bytes(locationLine, line.buf)
+	b.locBuf.bytes(profLocation, msg.buf)
+	return id
+}
+
+func (b *Builder) fn(name, file string) uint64 {
+	key := [2]string{name, file}
+	if id, ok := b.funcs[key]; ok {
+		return id
+	}
+	id := uint64(len(b.funcs) + 1)
+	b.funcs[key] = id
+	var msg buffer
+	msg.int(functionID, int64(id))
+	msg.int(functionName, b.str(name))
+	msg.int(functionSystemName, b.str(name))
+	msg.int(functionFilename, b.str(file))
+	b.funcBuf.bytes(profFunction, msg.buf)
+	return id
+}
+
+// WriteTo writes the profile to w, gzip-compressed as the pprof tool
+// writes profiles.
+func (b *Builder) WriteTo(w io.Writer) (int64, error) {
+	var out, msg buffer
+	for _, t := range b.types {
+		msg.reset()
+		msg.int(valueTypeType, b.str(t.Type))
+		msg.int(valueTypeUnit, b.str(t.Unit))
+		out.bytes(profSampleType, msg.buf)
+	}
+	for _, s := range b.samples {
+		msg.reset()
+		msg.packed(sampleLocationID, s.locs)
+		msg.packed(sampleValue, s.values)
+		out.bytes(profSample, msg.buf)
+	}
+	out.buf = append(out.buf, b.locBuf.buf...)
+	out.buf = append(out.buf, b.funcBuf.buf...)
+	for _, s := range b.strtab {
+		out.bytes(profStringTable, []byte(s))
+	}
+
+	cw := &countWriter{w: w}
+	zw := gzip.NewWriter(cw)
+	if _, err := zw.Write(out.buf); err != nil {
+		return cw.n, err
+	}
+	err := zw.Close()
+	return cw.n, err
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// buffer accumulates an encoded protobuf message.
+type buffer struct {
+	buf []byte
+}
+
+func (b *buffer) reset() {
+	b.buf = b.buf[:0]
+}
+
+func (b *buffer) varint(x uint64) {
+	for x >= 0x80 {
+		b.buf = append(b.buf, byte(x)|0x80)
+		x >>= 7
+	}
+	b.buf = append(b.buf, byte(x))
+}
+
+// int appends a varint field. Like proto3, it omits zero values.
+func (b *buffer) int(field int, x int64) {
+	if x == 0 {
+		return
+	}
+	b.varint(uint64(field)<<3 | wireVarint)
+	b.varint(uint64(x))
+}
+
+// bytes appends a length-delimited field.
+func (b *buffer) bytes(field int, data []byte) {
+	b.varint(uint64(field)<<3 | wireBytes)
+	b.varint(uint64(len(data)))
+	b.buf = append(b.buf, data...)
+}
+
+// packed appends a packed repeated varint field.
+func (b *buffer) packed(field int, xs []int64) {
+	if len(xs) == 0 {
+		return
+	}
+	var p buffer
+	for _, x := range xs {
+		p.varint(uint64(x))
+	}
+	b.bytes(field, p.buf)
+}
@@ -0,0 +1,46 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package profile
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestBuilder(t *testing.T) {
+	b := NewBuilder(ValueType{"space", "bytes"}, ValueType{"count", "count"})
+	main := Frame{Func: "main", File: "main.go", Line: 10, Addr: 0x1000}
+	f := Frame{Func: "f", File: "f.go", Line: 3, Addr: 0x2000}
+	g := Frame{Func: "g", File: "f.go", Line: 7, Addr: 0x3000}
+	b.Add([]Frame{f, main}, 100, 1)
+	b.Add([]Frame{g, f, main}, 200, 2)
+	// Frames may repeat, and large values need multi-byte
+	// varints.
+	b.Add([]Frame{f, main}, 1<<40, 3)
+
+	var buf bytes.Buffer
+	if _, err := b.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	p, err := Parse(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Profile{
+		SampleTypes: []ValueType{{"space", "bytes"}, {"count", "count"}},
+		Samples: []Sample{
+			{PCs: []uint64{0x2000, 0x1000}, Values: []int64{100, 1}},
+			{PCs: []uint64{0x3000, 0x2000, 0x1000}, Values: []int64{200, 2}},
+			{PCs: []uint64{0x2000, 0x1000}, Values: []int64{1 << 40, 3}},
+		},
+	}
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("got %+v, want %+v", p, want)
+	}
+	if len(b.locs) != 3 || len(b.funcs) != 3 {
+		t.Errorf("got %d locations and %d functions, want 3 and 3", len(b.locs), len(b.funcs))
+	}
+}
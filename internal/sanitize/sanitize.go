@@ -0,0 +1,188 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package sanitize reduces markup from an untrusted source to HTML
+// that is safe to show in another page.
+//
+// The input is XHTML, as browsers produce with XMLSerializer, so it
+// can be parsed by encoding/xml. Only an allowlist of presentational
+// HTML and SVG elements and attributes survives. Scripts, event
+// handlers, forms, embedded content, and links or styles that could
+// load external resources are removed.
+package sanitize
+
+import (
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// elements are the allowed elements. Their value indicates an element
+// is void (has no end tag) in HTML.
+var elements = map[string]bool{
+	"a": false, "abbr": false, "b": false, "br": true, "code": false,
+	"col": true, "colgroup": false, "dd": false, "del": false,
+	"details": false, "div": false, "dl": false, "dt": false,
+	"em": false, "h1": false, "h2": false, "h3": false, "h4": false,
+	"h5": false, "h6": false, "hr": true, "i": false, "ins": false,
+	"li": false, "mark": false, "ol": false, "p": false, "pre": false,
+	"s": false, "small": false, "span": false, "strong": false,
+	"sub": false, "summary": false, "sup": false, "table": false,
+	"tbody": false, "td": false, "tfoot": false, "th": false,
+	"thead": false, "tr": false, "u": false, "ul": false, "wbr": true,
+
+	"svg": false, "g": false, "path": false, "rect": false,
+	"line": false, "polyline": false, "polygon": false,
+	"circle": false, "ellipse": false, "text": false, "tspan": false,
+	"title": false, "defs": false, "marker": false,
+}
+
+// unwrap are the disallowed elements whose contents are kept.
+var unwrap = map[string]bool{
+	"article": true, "aside": true, "body": true, "center": true,
+	"font": true, "footer": true, "form": true, "header": true,
+	"html": true, "label": true, "main": true, "nav": true,
+	"section": true,
+}
+
+// attrs are the allowed attributes of all elements.
+var attrs = map[string]bool{
+	"class": true, "title": true, "colspan": true, "rowspan": true,
+	"open": true, "id": true, "style": true, "href": true,
+
+	"d": true, "x": true, "y": true, "x1": true, "y1": true, "x2": true,
+	"y2": true, "cx": true, "cy": true, "r": true, "rx": true,
+	"ry": true, "dx": true, "dy": true, "width": true, "height": true,
+	"viewBox": true, "points": true, "fill": true, "stroke": true,
+	"stroke-width": true, "stroke-dasharray": true, "opacity": true,
+	"transform": true, "text-anchor": true, "font-size": true,
+	"marker-end": true, "marker-start": true, "markerWidth": true,
+	"markerHeight": true, "refX": true, "refY": true, "orient": true,
+}
+
+// Attribute values that may refer to other resources are only kept
+// if they're safe.
+var (
+	// safeURL matches links within the page's site and to web
+	// pages, but not protocol-relative URLs or other schemes,
+	// such as javascript:.
+	safeURL = regexp.MustCompile(`^(#|/[^/\\]|/$|https?://)`)
+	// safeRef matches references to elements of the document.
+	safeRef = regexp.MustCompile(`^url\(#[-\w]+\)$`)
+	// unsafeCSS matches CSS that can load resources or escape
+	// the declaration.
+	unsafeCSS = regexp.MustCompile(`(?i)url\s*\(|expression|@import|\\|<|/\*`)
+)
+
+// MaxDepth limits how deeply elements may nest.
+const MaxDepth = 256
+
+// HTML reads XHTML from r and returns the allowed parts of it as HTML.
+func HTML(r io.Reader) (string, error) {
+	d := xml.NewDecoder(r)
+	// Browsers serialize HTML as XML with entities they don't
+	// expand, and pages may use HTML names.
+	d.Strict = false
+	d.Entity = xml.HTMLEntity
+	d.AutoClose = xml.HTMLAutoClose
+
+	var out strings.Builder
+	// stack holds each open element and what happened to it.
+	const (
+		written = iota
+		unwrapped
+		skipped
+	)
+	type open struct {
+		name string
+		what int
+	}
+	var stack []open
+	// skip counts the open elements whose contents are removed.
+	skip := 0
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return "", err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if len(stack) >= MaxDepth {
+				return "", fmt.Errorf("elements nested more than %d deep", MaxDepth)
+			}
+			name := tok.Name.Local
+			_, ok := elements[name]
+			switch {
+			case skip == 0 && ok:
+				stack = append(stack, open{name, written})
+			case skip == 0 && unwrap[name]:
+				stack = append(stack, open{name, unwrapped})
+				continue
+			default:
+				stack = append(stack, open{name, skipped})
+				skip++
+				continue
+			}
+			out.WriteString("<" + name)
+			for _, a := range tok.Attr {
+				if v, ok := attrValue(name, a); ok {
+					fmt.Fprintf(&out, ` %s="%s"`, a.Name.Local, html.EscapeString(v))
+				}
+			}
+			out.WriteString(">")
+
+		case xml.EndElement:
+			if len(stack) == 0 {
+				continue
+			}
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			switch {
+			case top.what == skipped:
+				skip--
+			case top.what == written && !elements[top.name]:
+				out.WriteString("</" + top.name + ">")
+			}
+
+		case xml.CharData:
+			if skip == 0 {
+				out.WriteString(html.EscapeString(string(tok)))
+			}
+		}
+	}
+	return out.String(), nil
+}
+
+// attrValue returns the value of attribute a of element elt, or false
+// if it's not allowed.
+func attrValue(elt string, a xml.Attr) (string, bool) {
+	name, v := a.Name.Local, a.Value
+	if a.Name.Space != "" && a.Name.Space != "http://www.w3.org/1999/xhtml" && a.Name.Space != "http://www.w3.org/2000/svg" {
+		// Including xlink:href and xmlns.
+		return "", false
+	}
+	if !attrs[name] {
+		return "", false
+	}
+	switch name {
+	case "id":
+		// Markers need IDs to be referenced. Other IDs could
+		// clobber the page's own.
+		return v, elt == "marker"
+	case "href":
+		return v, elt == "a" && safeURL.MatchString(v)
+	case "style":
+		return v, !unsafeCSS.MatchString(v)
+	case "fill", "stroke", "marker-end", "marker-start":
+		if strings.Contains(strings.ToLower(v), "url") {
+			return v, safeRef.MatchString(v)
+		}
+	}
+	return v, true
+}
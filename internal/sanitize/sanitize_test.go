@@ -0,0 +1,62 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sanitize
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHTML(t *testing.T) {
+	for _, test := range []struct {
+		in, want string
+	}{
+		{`<div xmlns="http://www.w3.org/1999/xhtml" class="asm">mov &amp; add</div>`,
+			`<div class="asm">mov &amp; add</div>`},
+		// Scripts, handlers, and forms go, including their contents.
+		{`<div onclick="x()"><script>alert(1)</script><b>ok</b></div>`,
+			`<div><b>ok</b></div>`},
+		{`<div><button type="button">Copy</button><input value="q"/>text</div>`,
+			`<div>text</div>`},
+		{`<div><iframe src="x"><p>in</p></iframe><style>*{}</style></div>`,
+			`<div></div>`},
+		// Layout elements are dropped, but their contents kept.
+		{`<form><label>name <b>x</b></label></form>`,
+			`name <b>x</b>`},
+		// Void elements have no end tag.
+		{`<p>a<br/>b<hr></hr></p>`,
+			`<p>a<br>b<hr></p>`},
+		// Links may only go to the same site or to web pages.
+		{`<a href="/s/main.main">f</a><a href="javascript:alert(1)">g</a><a href="//evil/">h</a><a href="https://go.dev/">i</a>`,
+			`<a href="/s/main.main">f</a><a>g</a><a>h</a><a href="https://go.dev/">i</a>`},
+		// Styles can't load resources.
+		{`<span style="width: 10px; color: red">a</span><span style="background: URL(http://x/)">b</span>`,
+			`<span style="width: 10px; color: red">a</span><span>b</span>`},
+		// SVG survives, with references only within the document.
+		{`<svg xmlns="http://www.w3.org/2000/svg" width="10"><defs><marker id="m"/></defs><path d="M0 0" marker-end="url(#m)" fill="url(http://x/)"/><image href="x"/></svg>`,
+			`<svg width="10"><defs><marker id="m"></marker></defs><path d="M0 0" marker-end="url(#m)"></path></svg>`},
+		{`<div id="errorArea" title="a &quot;b&quot; &lt;c&gt;">&nbsp;&lt;</div>`,
+			`<div title="a &#34;b&#34; &lt;c&gt;">` + "\u00a0" + `&lt;</div>`},
+		// Unknown elements are removed, whatever their case.
+		{`<SCRIPT>x</SCRIPT><Div>y</Div>z`,
+			`z`},
+	} {
+		got, err := HTML(strings.NewReader(test.in))
+		if err != nil {
+			t.Errorf("%s: %v", test.in, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s:\nwant %s\ngot  %s", test.in, test.want, got)
+		}
+	}
+}
+
+func TestDepth(t *testing.T) {
+	in := strings.Repeat("<div>", MaxDepth+1) + strings.Repeat("</div>", MaxDepth+1)
+	if _, err := HTML(strings.NewReader(in)); err == nil {
+		t.Errorf("want error for deep nesting")
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package sanitizer parses error reports from AddressSanitizer (and
+// the other LLVM sanitizers that share its report format) and
+// Valgrind.
+package sanitizer
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A Report is a single error report.
+type Report struct {
+	// Tool is "asan" or "valgrind".
+	Tool string
+	// Kind is the kind of error, such as "heap-buffer-overflow"
+	// or "Invalid read of size 4".
+	Kind string
+	// Summary is the report's first line.
+	Summary string
+	Stacks  []Stack
+}
+
+// A Stack is a stack trace in a report, such as the access stack or
+// the allocation stack.
+type Stack struct {
+	// Title is the line describing the stack.
+	Title  string
+	Frames []Frame
+}
+
+// A Frame is one frame of a stack trace. Any field may be missing.
+type Frame struct {
+	PC   uint64
+	Func string
+	File string
+	Line int
+	// Module and ModuleOff give the location as an offset in a
+	// binary, if the tool printed it.
+	Module    string
+	ModuleOff uint64
+	HasOff    bool
+}
+
+var (
+	pidRe       = regexp.MustCompile(`^==\d+==`)
+	asanStartRe = regexp.MustCompile(`^==\d+==\s*ERROR: (\w+Sanitizer): (\S+)`)
+	asanFrameRe = regexp.MustCompile(`^\s*#(\d+) 0x([0-9a-f]+)(?: in (\S+))?(?: (.*))?$`)
+	vgFrameRe   = regexp.MustCompile(`^\s+(at|by) 0x([0-9A-Fa-f]+): (.*?)(?: \((?:in )?([^()]*)\))?$`)
+	fileLineRe  = regexp.MustCompile(`^(.*?):(\d+)(?::\d+)?$`)
+	moduleOffRe = regexp.MustCompile(`^\(?([^()+]*)\+0x([0-9a-f]+)\)?$`)
+)
+
+// Parse reads a log containing sanitizer or Valgrind reports and
+// returns the reports, ignoring other output.
+func Parse(r io.Reader) ([]Report, error) {
+	var reports []Report
+	var cur *Report
+	var title string
+	flush := func() {
+		if cur != nil && len(cur.Stacks) > 0 {
+			reports = append(reports, *cur)
+		}
+		cur, title = nil, ""
+	}
+	// addFrame adds f to the current stack, or to a new stack if
+	// f is the innermost frame.
+	addFrame := func(f Frame, innermost bool) {
+		if innermost || len(cur.Stacks) == 0 {
+			cur.Stacks = append(cur.Stacks, Stack{Title: title})
+		}
+		st := &cur.Stacks[len(cur.Stacks)-1]
+		st.Frames = append(st.Frames, f)
+	}
+
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		line := s.Text()
+
+		// AddressSanitizer.
+		if m := asanStartRe.FindStringSubmatch(line); m != nil {
+			flush()
+			cur = &Report{Tool: "asan", Kind: m[2], Summary: strings.TrimSpace(pidRe.ReplaceAllString(line, ""))}
+			continue
+		}
+		if cur != nil && cur.Tool == "asan" {
+			if m := asanFrameRe.FindStringSubmatch(line); m != nil {
+				addFrame(parseASanFrame(m), m[1] == "0")
+				continue
+			}
+			trimmed := strings.TrimSpace(line)
+			if strings.HasPrefix(trimmed, "SUMMARY:") || strings.HasSuffix(trimmed, "ABORTING") {
+				flush()
+			} else if trimmed != "" {
+				// A new stack starts after its title.
+				title = trimmed
+			}
+			continue
+		}
+
+		// Valgrind.
+		if !pidRe.MatchString(line) {
+			continue
+		}
+		body := pidRe.ReplaceAllString(line, "")
+		switch {
+		case strings.TrimSpace(body) == "":
+			flush()
+		case vgFrameRe.MatchString(body):
+			if cur != nil {
+				m := vgFrameRe.FindStringSubmatch(body)
+				addFrame(parseValgrindFrame(m), m[1] == "at")
+			}
+		case strings.HasPrefix(body, "  "):
+			// Sub-heading, such as "Address 0x... is ...".
+			if cur != nil {
+				title = strings.TrimSpace(body)
+			}
+		case strings.HasPrefix(body, " "):
+			flush()
+			text := strings.TrimSpace(body)
+			cur = &Report{Tool: "valgrind", Kind: text, Summary: text}
+			title = text
+		}
+	}
+	flush()
+	return reports, s.Err()
+}
+
+func parseASanFrame(m []string) Frame {
+	var f Frame
+	f.PC, _ = strconv.ParseUint(m[2], 16, 64)
+	f.Func = m[3]
+	loc := strings.TrimSpace(m[4])
+	if mm := moduleOffRe.FindStringSubmatch(loc); mm != nil {
+		f.Module = mm[1]
+		f.ModuleOff, _ = strconv.ParseUint(mm[2], 16, 64)
+		f.HasOff = true
+	} else if mm := fileLineRe.FindStringSubmatch(loc); mm != nil {
+		f.File = mm[1]
+		f.Line, _ = strconv.Atoi(mm[2])
+	} else {
+		f.File = loc
+	}
+	return f
+}
+
+func parseValgrindFrame(m []string) Frame {
+	var f Frame
+	f.PC, _ = strconv.ParseUint(m[2], 16, 64)
+	f.Func = m[3]
+	if f.Func == "???" {
+		f.Func = ""
+	}
+	loc := m[4]
+	if mm := fileLineRe.FindStringSubmatch(loc); mm != nil {
+		f.File = mm[1]
+		f.Line, _ = strconv.Atoi(mm[2])
+	} else {
+		f.Module = loc
+	}
+	return f
+}
@@ -0,0 +1,92 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sanitizer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const asanLog = `program output
+=================================================================
+==4242==ERROR: AddressSanitizer: heap-buffer-overflow on address 0x602000000011 at pc 0x5555555551d4 bp 0x7ffc sp 0x7ffc
+READ of size 1 at 0x602000000011 thread T0
+    #0 0x5555555551d4 in main /tmp/t.c:5:10
+    #1 0x7ffff7829d8f  (/lib/x86_64-linux-gnu/libc.so.6+0x29d8f)
+    #2 0x5555555550c4 in _start (/tmp/t+0x10c4)
+
+0x602000000011 is located 0 bytes to the right of 1-byte region
+allocated by thread T0 here:
+    #0 0x7ffff7cb4887 in __interceptor_malloc ../../../../src/libsanitizer/asan/asan_malloc_linux.cpp:145
+    #1 0x555555555196 in main /tmp/t.c:4:13
+
+SUMMARY: AddressSanitizer: heap-buffer-overflow /tmp/t.c:5:10 in main
+Shadow bytes around the buggy address:
+==4242==ABORTING
+`
+
+const valgrindLog = `==123== Memcheck, a memory error detector
+==123== 
+==123== Invalid read of size 4
+==123==    at 0x108671: main (t.c:5)
+==123==  Address 0x522d044 is 0 bytes after a block of size 4 alloc'd
+==123==    at 0x4C2FB0F: malloc (in /usr/lib/valgrind/vgpreload_memcheck-amd64-linux.so)
+==123==    by 0x108662: main (t.c:4)
+==123== 
+==123== HEAP SUMMARY:
+==123==     in use at exit: 0 bytes in 0 blocks
+==123== 
+`
+
+func TestASan(t *testing.T) {
+	got, err := Parse(strings.NewReader(asanLog))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Report{{
+		Tool:    "asan",
+		Kind:    "heap-buffer-overflow",
+		Summary: "ERROR: AddressSanitizer: heap-buffer-overflow on address 0x602000000011 at pc 0x5555555551d4 bp 0x7ffc sp 0x7ffc",
+		Stacks: []Stack{
+			{Title: "READ of size 1 at 0x602000000011 thread T0", Frames: []Frame{
+				{PC: 0x5555555551d4, Func: "main", File: "/tmp/t.c", Line: 5},
+				{PC: 0x7ffff7829d8f, Module: "/lib/x86_64-linux-gnu/libc.so.6", ModuleOff: 0x29d8f, HasOff: true},
+				{PC: 0x5555555550c4, Func: "_start", Module: "/tmp/t", ModuleOff: 0x10c4, HasOff: true},
+			}},
+			{Title: "allocated by thread T0 here:", Frames: []Frame{
+				{PC: 0x7ffff7cb4887, Func: "__interceptor_malloc", File: "../../../../src/libsanitizer/asan/asan_malloc_linux.cpp", Line: 145},
+				{PC: 0x555555555196, Func: "main", File: "/tmp/t.c", Line: 4},
+			}},
+		},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%+v\nwant:\n%+v", got, want)
+	}
+}
+
+func TestValgrind(t *testing.T) {
+	got, err := Parse(strings.NewReader(valgrindLog))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Report{{
+		Tool:    "valgrind",
+		Kind:    "Invalid read of size 4",
+		Summary: "Invalid read of size 4",
+		Stacks: []Stack{
+			{Title: "Invalid read of size 4", Frames: []Frame{
+				{PC: 0x108671, Func: "main", File: "t.c", Line: 5},
+			}},
+			{Title: "Address 0x522d044 is 0 bytes after a block of size 4 alloc'd", Frames: []Frame{
+				{PC: 0x4C2FB0F, Func: "malloc", Module: "/usr/lib/valgrind/vgpreload_memcheck-amd64-linux.so"},
+				{PC: 0x108662, Func: "main", File: "t.c", Line: 4},
+			}},
+		},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%+v\nwant:\n%+v", got, want)
+	}
+}
@@ -7,14 +7,17 @@ package symtab
 import (
 	"sort"
 
-	"github.com/aclements/objbrowse/internal/obj"
+	"github.com/aclements/objbrowse/obj"
 )
 
 // Table facilitates fast symbol lookup.
 type Table struct {
 	syms []obj.Sym
 	addr []obj.SymID
-	name map[string]obj.SymID
+	name map[string][]obj.SymID
+
+	// maxSize is the size of the largest symbol in addr.
+	maxSize uint64
 }
 
 // NewTable creates a new table for syms.
@@ -45,12 +48,19 @@ func NewTable(symbols obj.Symbols) *Table {
 	})
 
 	// Create name map for fast name lookup.
-	name := make(map[string]obj.SymID)
+	name := make(map[string][]obj.SymID)
 	for i, s := range syms {
-		name[s.Name] = obj.SymID(i)
+		name[s.Name] = append(name[s.Name], obj.SymID(i))
+	}
+
+	var maxSize uint64
+	for _, id := range addr {
+		if syms[id].Size > maxSize {
+			maxSize = syms[id].Size
+		}
 	}
 
-	return &Table{syms, addr, name}
+	return &Table{syms, addr, name, maxSize}
 }
 
 // Syms returns all symbols in Table. The returned slice can be
@@ -59,13 +69,37 @@ func (t *Table) Syms() []obj.Sym {
 	return t.syms
 }
 
-// Name returns the symbol with the given name.
-func (t *Table) Name(name string) (obj.SymID, bool) {
-	i, ok := t.name[name]
-	if !ok {
-		i = -1
+// Name returns all symbols with the given name, in SymID order.
+// Names need not be unique: static symbols in different compilation
+// units can share a name, and a symbol may appear in both the static
+// and dynamic symbol tables. The caller must not modify the returned
+// slice.
+func (t *Table) Name(name string) []obj.SymID {
+	return t.name[name]
+}
+
+// Lookup returns the "best" symbol with the given name. It prefers
+// symbols with an address, and then symbols from the static symbol
+// table, and otherwise picks the lowest SymID.
+func (t *Table) Lookup(name string) (obj.SymID, bool) {
+	ids := t.name[name]
+	if len(ids) == 0 {
+		return -1, false
 	}
-	return i, ok
+	best := ids[0]
+	for _, id := range ids[1:] {
+		b, s := &t.syms[best], &t.syms[id]
+		if s.HasAddr != b.HasAddr {
+			if s.HasAddr {
+				best = id
+			}
+			continue
+		}
+		if !s.Dynamic && b.Dynamic {
+			best = id
+		}
+	}
+	return best, true
 }
 
 // Addr returns the symbol containing addr.
@@ -102,6 +136,69 @@ func (t *Table) Addr(addr uint64) (obj.SymID, bool) {
 	return -1, false
 }
 
+// An AddrMatch is a symbol that covers an address.
+type AddrMatch struct {
+	ID obj.SymID
+	// Primary indicates this is the symbol Addr would return.
+	Primary bool
+}
+
+// AddrAll returns every symbol covering addr: symbols whose range
+// contains addr and zero-sized symbols at addr. The symbol Addr
+// would pick is flagged as primary and comes first, even if it
+// doesn't strictly cover addr. The rest are in address order.
+func (t *Table) AddrAll(addr uint64) []AddrMatch {
+	primary, ok := t.Addr(addr)
+	var out []AddrMatch
+	if ok {
+		out = append(out, AddrMatch{primary, true})
+	}
+	// Scan back from the last symbol starting at or before addr
+	// as far as any symbol could reach addr.
+	end := sort.Search(len(t.addr), func(i int) bool {
+		return addr < t.syms[t.addr[i]].Value
+	})
+	start := end
+	for start > 0 && addr-t.syms[t.addr[start-1]].Value <= t.maxSize {
+		start--
+	}
+	for _, id := range t.addr[start:end] {
+		sym := &t.syms[id]
+		if id == primary && ok {
+			continue
+		}
+		if addr < sym.Value+sym.Size || (sym.Size == 0 && sym.Value == addr) {
+			out = append(out, AddrMatch{id, false})
+		}
+	}
+	return out
+}
+
+// InRange returns the symbols that start in [lo, hi), in address
+// order.
+func (t *Table) InRange(lo, hi uint64) []obj.SymID {
+	i := sort.Search(len(t.addr), func(i int) bool {
+		return lo <= t.syms[t.addr[i]].Value
+	})
+	j := sort.Search(len(t.addr), func(i int) bool {
+		return hi <= t.syms[t.addr[i]].Value
+	})
+	return t.addr[i:j]
+}
+
+// AtAddr returns all symbols whose value is exactly addr, in name
+// order.
+func (t *Table) AtAddr(addr uint64) []obj.SymID {
+	i := sort.Search(len(t.addr), func(i int) bool {
+		return addr <= t.syms[t.addr[i]].Value
+	})
+	var out []obj.SymID
+	for ; i < len(t.addr) && t.syms[t.addr[i]].Value == addr; i++ {
+		out = append(out, t.addr[i])
+	}
+	return out
+}
+
 // SymName returns the name and base of the symbol containing addr. It
 // returns "", 0 if no symbol contains addr.
 //
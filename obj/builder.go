@@ -0,0 +1,266 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package obj
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"sort"
+)
+
+// A Builder constructs an Obj in memory from sections, symbols, and
+// relocations supplied by the caller, rather than decoding them from
+// an object file. This is useful for tests that need an object with
+// particular contents, and for tools whose data doesn't come from an
+// object file.
+//
+// Objects built by a Builder have no DWARF.
+type Builder struct {
+	info  ObjInfo
+	sects []builtSect
+	syms  []Sym
+	// err is the first error from an Add method, which Obj
+	// reports.
+	err error
+}
+
+type builtSect struct {
+	Section
+	data   []byte
+	relocs []Reloc
+}
+
+// NewBuilder returns a Builder for an object described by info. If
+// info.Format is "", the object's format is "synthetic".
+func NewBuilder(info ObjInfo) *Builder {
+	if info.Format == "" {
+		info.Format = "synthetic"
+	}
+	return &Builder{info: info}
+}
+
+// AddSection adds a section with contents data and returns its index.
+// If s.Size is 0, it's the length of data. Otherwise, data may be
+// shorter than s.Size, and the rest of the section is zeros. If s.Zero
+// is set, data must be nil.
+func (b *Builder) AddSection(s Section, data []byte) int {
+	if s.Size == 0 && !s.Zero {
+		s.Size = uint64(len(data))
+	}
+	b.sects = append(b.sects, builtSect{Section: s, data: data})
+	return len(b.sects) - 1
+}
+
+// AddSymbol adds s to the symbol table and returns its ID. s.Section
+// must be the index of a section or -1, since the zero Sym is in
+// section 0. If s.Kind is 0, AddSymbol infers it from s.Section's
+// flags, as nm would.
+func (b *Builder) AddSymbol(s Sym) SymID {
+	if s.Kind == 0 {
+		s.Kind = SymUnknown
+		if s.Section < 0 {
+			s.Kind = SymUndef
+		} else if s.Section < len(b.sects) {
+			sect := &b.sects[s.Section]
+			switch sect.Flags & (SectAlloc | SectWrite | SectExec) {
+			case SectAlloc | SectExec:
+				s.Kind = SymText
+			case SectAlloc:
+				s.Kind = SymROData
+			case SectAlloc | SectWrite:
+				s.Kind = SymData
+				if sect.Zero {
+					s.Kind = SymBSS
+				}
+			}
+		}
+	}
+	b.syms = append(b.syms, s)
+	return SymID(len(b.syms) - 1)
+}
+
+// AddReloc adds relocation r to section sect. r.Offset is an address
+// in sect, like Section.Addr.
+func (b *Builder) AddReloc(sect int, r Reloc) {
+	if sect < 0 || sect >= len(b.sects) {
+		if b.err == nil {
+			b.err = fmt.Errorf("relocation at %#x: %w", r.Offset, &IndexError{"section", sect})
+		}
+		return
+	}
+	b.sects[sect].relocs = append(b.sects[sect].relocs, r)
+}
+
+// Obj returns the object built so far. It returns an error if the
+// sections, symbols, or relocations are inconsistent, such as a
+// symbol outside its section. Later changes to b don't affect the
+// returned Obj.
+func (b *Builder) Obj() (Obj, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	f := &builtFile{info: b.info, syms: append([]Sym(nil), b.syms...)}
+	for _, s := range b.sects {
+		if s.Zero && s.data != nil {
+			return nil, fmt.Errorf("zero-filled section %q has data", s.Name)
+		}
+		if uint64(len(s.data)) > s.Size {
+			return nil, fmt.Errorf("section %q has %d bytes of data, but size %d", s.Name, len(s.data), s.Size)
+		}
+		if s.Size > maxDataSize {
+			return nil, fmt.Errorf("section %q size %#x too large", s.Name, s.Size)
+		}
+		data := make([]byte, s.Size)
+		copy(data, s.data)
+		s.data = data
+
+		s.relocs = append([]Reloc(nil), s.relocs...)
+		sort.SliceStable(s.relocs, func(i, j int) bool {
+			return s.relocs[i].Offset < s.relocs[j].Offset
+		})
+		for _, r := range s.relocs {
+			if r.Offset < s.Addr || r.Offset-s.Addr+uint64(r.Size) > s.Size {
+				return nil, fmt.Errorf("relocation at %#x is outside section %q", r.Offset, s.Name)
+			}
+			if r.Symbol < -1 || r.Symbol >= SymID(len(b.syms)) {
+				return nil, fmt.Errorf("relocation at %#x in section %q: %w", r.Offset, s.Name, &IndexError{"symbol", int(r.Symbol)})
+			}
+			if r.Type == nil {
+				return nil, fmt.Errorf("relocation at %#x in section %q has no type", r.Offset, s.Name)
+			}
+		}
+		f.sects = append(f.sects, s)
+	}
+	for _, s := range f.syms {
+		if s.Section < -1 || s.Section >= len(f.sects) {
+			return nil, fmt.Errorf("symbol %q: %w", s.Name, &IndexError{"section", s.Section})
+		}
+		if s.Section >= 0 {
+			sect := &f.sects[s.Section]
+			if s.Value < sect.Addr || s.Value-sect.Addr > sect.Size {
+				return nil, fmt.Errorf("symbol %q is outside section %q", s.Name, sect.Name)
+			}
+		}
+	}
+	return f, nil
+}
+
+// builtFile is an Obj constructed by a Builder.
+type builtFile struct {
+	info  ObjInfo
+	sects []builtSect
+	syms  []Sym
+}
+
+func (f *builtFile) Info() ObjInfo {
+	return f.info
+}
+
+// Data looks up ptr in the sections that have SectAlloc set.
+func (f *builtFile) Data(ptr, size uint64) (Data, error) {
+	for i := range f.sects {
+		sect := &f.sects[i]
+		if sect.Flags&SectAlloc == 0 {
+			continue
+		}
+		end := sect.Addr + sect.Size
+		if sect.Addr <= ptr && ptr < end {
+			if ptr+size > end {
+				size = end - ptr
+			}
+			return sect.sectData(ptr, size), nil
+		}
+	}
+	return Data{R: noRelocs}, nil
+}
+
+func (f *builtFile) Sections() []Section {
+	sects := make([]Section, len(f.sects))
+	for i := range f.sects {
+		sects[i] = f.sects[i].Section
+	}
+	return sects
+}
+
+func (f *builtFile) SectionData(i int) (Data, error) {
+	if i < 0 || i >= len(f.sects) {
+		return Data{}, &IndexError{"section", i}
+	}
+	sect := &f.sects[i]
+	return sect.sectData(sect.Addr, sect.Size), nil
+}
+
+func (f *builtFile) Symbols() (Symbols, error) {
+	return (*builtSymbols)(f), nil
+}
+
+type builtSymbols builtFile
+
+func (f *builtSymbols) Len() SymID {
+	return SymID(len(f.syms))
+}
+
+func (f *builtSymbols) Get(i SymID, sym *Sym) {
+	*sym = f.syms[i]
+}
+
+func (f *builtFile) SymbolData(i SymID) (Data, error) {
+	if i < 0 || int(i) >= len(f.syms) {
+		return Data{}, &IndexError{"symbol", int(i)}
+	}
+	s := f.syms[i]
+	if s.Section < 0 {
+		return Data{Addr: s.Value, R: noRelocs}, nil
+	}
+	sect := &f.sects[s.Section]
+	size := s.Size
+	if end := sect.Size - (s.Value - sect.Addr); size > end {
+		size = end
+	}
+	return sect.sectData(s.Value, size), nil
+}
+
+func (f *builtFile) DWARF() (*dwarf.Data, error) {
+	return nil, fmt.Errorf("built objects have no DWARF: %w", ErrNoDWARF)
+}
+
+// sectData returns the size bytes at ptr in s and the relocations
+// that overlap them. ptr and size must be within s.
+func (s *builtSect) sectData(ptr, size uint64) Data {
+	off := ptr - s.Addr
+	out := Data{Addr: ptr, P: s.data[off : off+size], R: noRelocs}
+
+	// Relocations are sorted by offset, but have different sizes,
+	// so search for the first that could overlap ptr given the
+	// largest Reloc.Size, then trim those that end before it.
+	end := ptr + size
+	lo := sort.Search(len(s.relocs), func(i int) bool {
+		return s.relocs[i].Offset+0xff >= ptr
+	})
+	for lo < len(s.relocs) {
+		r := &s.relocs[lo]
+		if r.Offset >= ptr || r.Offset+uint64(r.Size) > ptr {
+			break
+		}
+		lo++
+	}
+	hi := lo + sort.Search(len(s.relocs)-lo, func(i int) bool {
+		return s.relocs[lo+i].Offset >= end
+	})
+	if lo < hi {
+		out.R = builtRelocs(s.relocs[lo:hi])
+	}
+	return out
+}
+
+type builtRelocs []Reloc
+
+func (rs builtRelocs) Len() int {
+	return len(rs)
+}
+
+func (rs builtRelocs) Get(i int, r *Reloc) {
+	*r = rs[i]
+}
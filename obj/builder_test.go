@@ -0,0 +1,138 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package obj
+
+import (
+	"bytes"
+	"debug/elf"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aclements/objbrowse/arch"
+)
+
+// buildTest builds an object with text, data, and bss sections, a
+// debug section, and a relocation from data to text.
+func buildTest() *Builder {
+	b := NewBuilder(ObjInfo{Arch: arch.AMD64})
+	text := b.AddSection(Section{Name: ".text", Addr: 0x1000, Flags: SectAlloc | SectExec}, []byte{0x90, 0x90, 0xc3})
+	data := b.AddSection(Section{Name: ".data", Addr: 0x2000, Size: 16, Flags: SectAlloc | SectWrite}, []byte{1, 2})
+	b.AddSection(Section{Name: ".bss", Addr: 0x3000, Size: 8, Zero: true, Flags: SectAlloc | SectWrite}, nil)
+	b.AddSection(Section{Name: ".comment"}, []byte("hi"))
+	f := b.AddSymbol(Sym{Name: "f", Value: 0x1000, Size: 3, HasAddr: true, Section: text})
+	b.AddSymbol(Sym{Name: "ptr", Value: 0x2008, Size: 8, HasAddr: true, Section: data})
+	b.AddSymbol(Sym{Name: "zero", Value: 0x3000, Size: 8, HasAddr: true, Section: 2})
+	b.AddSymbol(Sym{Name: "ext", Section: -1})
+	b.AddReloc(data, Reloc{Offset: 0x2008, Size: 8, Type: elf.R_X86_64_64, Symbol: f, Addend: 1})
+	return b
+}
+
+func TestBuilder(t *testing.T) {
+	o, err := buildTest().Obj()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info := o.Info(); info.Format != "synthetic" || info.Arch != arch.AMD64 {
+		t.Errorf("Info() = %+v", info)
+	}
+	if sects := o.Sections(); len(sects) != 4 || sects[0].Size != 3 || sects[1].Size != 16 {
+		t.Errorf("Sections() = %+v", sects)
+	}
+
+	syms, err := o.Symbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kinds []byte
+	var sym Sym
+	for i := SymID(0); i < syms.Len(); i++ {
+		syms.Get(i, &sym)
+		kinds = append(kinds, byte(sym.Kind))
+	}
+	if string(kinds) != "TDBU" {
+		t.Errorf("symbol kinds are %q, want %q", kinds, "TDBU")
+	}
+
+	d, err := o.SymbolData(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Addr != 0x2008 || len(d.P) != 8 || d.R.Len() != 1 {
+		t.Fatalf("SymbolData(ptr) = %+v", d)
+	}
+	var r Reloc
+	d.R.Get(0, &r)
+	if r.Offset != 0x2008 || r.Symbol != 0 || r.Addend != 1 || r.Type.String() != "R_X86_64_64" {
+		t.Errorf("ptr's relocation is %+v", r)
+	}
+
+	// Data looks up loaded sections and fills in zeros.
+	d, err = o.Data(0x2000, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(d.P[:4], []byte{1, 2, 0, 0}) || len(d.P) != 16 {
+		t.Errorf("Data(0x2000) = %x", d.P)
+	}
+	d, _ = o.Data(0x2000, 8)
+	if d.R.Len() != 0 {
+		t.Errorf("Data(0x2000, 8) has relocations")
+	}
+	d, _ = o.Data(0x3004, 4)
+	if !bytes.Equal(d.P, []byte{0, 0, 0, 0}) {
+		t.Errorf("Data(0x3004) = %x", d.P)
+	}
+	if d, _ := o.Data(0, 2); d.P != nil {
+		t.Errorf("Data(0) found unloaded section: %x", d.P)
+	}
+
+	if _, err := o.DWARF(); !errors.Is(err, ErrNoDWARF) {
+		t.Errorf("DWARF() returned %v, want ErrNoDWARF", err)
+	}
+	var ie *IndexError
+	if _, err := o.SymbolData(4); !errors.As(err, &ie) {
+		t.Errorf("SymbolData(4) returned %v, want IndexError", err)
+	}
+}
+
+func TestBuilderErrors(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		build func(b *Builder)
+		want  string
+	}{
+		{"zero data", func(b *Builder) {
+			b.AddSection(Section{Name: ".z", Size: 1, Zero: true}, []byte{1})
+		}, "has data"},
+		{"long data", func(b *Builder) {
+			b.AddSection(Section{Name: ".x", Size: 1}, []byte{1, 2})
+		}, "has 2 bytes of data"},
+		{"symbol section", func(b *Builder) {
+			b.AddSymbol(Sym{Name: "s", Section: 10})
+		}, "section index 10 out of range"},
+		{"symbol outside", func(b *Builder) {
+			b.AddSymbol(Sym{Name: "s", Value: 0x5000, Section: 0})
+		}, "outside section"},
+		{"reloc section", func(b *Builder) {
+			b.AddReloc(10, Reloc{Type: elf.R_X86_64_64})
+		}, "section index 10 out of range"},
+		{"reloc outside", func(b *Builder) {
+			b.AddReloc(0, Reloc{Offset: 0x1002, Size: 4, Type: elf.R_X86_64_64, Symbol: -1})
+		}, "outside section"},
+		{"reloc symbol", func(b *Builder) {
+			b.AddReloc(0, Reloc{Offset: 0x1000, Type: elf.R_X86_64_64, Symbol: 10})
+		}, "symbol index 10 out of range"},
+		{"reloc type", func(b *Builder) {
+			b.AddReloc(0, Reloc{Offset: 0x1000, Symbol: -1})
+		}, "has no type"},
+	} {
+		b := buildTest()
+		test.build(b)
+		if _, err := b.Obj(); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: got %v, want error containing %q", test.name, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package obj
+
+// A Cache holds data that an Obj decodes on demand, such as
+// relocations, so it can be discarded to save memory and decoded
+// again when it's next needed.
+//
+// Keys are comparable values that are unique to the Obj, so one Cache
+// may be shared by several Objs. A Cache must be safe for concurrent
+// use.
+type Cache interface {
+	// Get returns the value for key, if it's cached.
+	Get(key interface{}) (val interface{}, ok bool)
+	// Add caches val for key. size estimates the bytes of memory
+	// val retains.
+	Add(key, val interface{}, size int64)
+}
+
+// cacher is implemented by Objs that can use a Cache.
+type cacher interface {
+	setCache(c Cache)
+}
+
+// SetCache makes o keep the data it decodes on demand in c, rather
+// than for o's lifetime. It has no effect on formats that don't
+// decode anything on demand. SetCache must not be called concurrently
+// with other uses of o, and data o decoded before SetCache is still
+// kept for o's lifetime, so it's best called right after opening o.
+func SetCache(o Obj, c Cache) {
+	if o, ok := o.(cacher); ok {
+		o.setCache(c)
+	}
+}
+
+func (f *elfFile) setCache(c Cache) {
+	f.cache = c
+}
+
+func (f *debugObj) setCache(c Cache) {
+	SetCache(f.Obj, c)
+	SetCache(f.debug, c)
+}
+
+func (f *pdbFile) setCache(c Cache) {
+	SetCache(f.image, c)
+}
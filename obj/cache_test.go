@@ -0,0 +1,90 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package obj
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// mapCache is a Cache that can drop everything.
+type mapCache struct {
+	mu   sync.Mutex
+	m    map[interface{}]interface{}
+	size int64
+}
+
+func (c *mapCache) Get(key interface{}) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.m[key]
+	return v, ok
+}
+
+func (c *mapCache) Add(key, val interface{}, size int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.m == nil {
+		c.m = make(map[interface{}]interface{})
+	}
+	c.m[key] = val
+	c.size += size
+}
+
+func relocsOf(t *testing.T, o Obj) [][]Reloc {
+	var out [][]Reloc
+	for i := range o.Sections() {
+		d, err := o.SectionData(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var rs []Reloc
+		for j := 0; j < d.R.Len(); j++ {
+			var r Reloc
+			d.R.Get(j, &r)
+			rs = append(rs, r)
+		}
+		out = append(out, rs)
+	}
+	return out
+}
+
+func TestCache(t *testing.T) {
+	open := func() Obj {
+		f, err := os.Open(filepath.Join("..", "testdata", "corpus", "elf-amd64-rel"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { f.Close() })
+		o, err := Open(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return o
+	}
+	want := relocsOf(t, open())
+
+	var c mapCache
+	o := open()
+	SetCache(o, &c)
+	if got := relocsOf(t, o); !reflect.DeepEqual(got, want) {
+		t.Fatalf("relocations differ with a cache:\n%v\nwant:\n%v", got, want)
+	}
+	if len(c.m) == 0 || c.size == 0 {
+		t.Fatalf("nothing cached")
+	}
+
+	// Evicting everything decodes the relocations again.
+	c.m = nil
+	if got := relocsOf(t, o); !reflect.DeepEqual(got, want) {
+		t.Fatalf("relocations differ after eviction:\n%v\nwant:\n%v", got, want)
+	}
+	if len(c.m) == 0 {
+		t.Fatalf("nothing cached after eviction")
+	}
+}
@@ -0,0 +1,359 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package obj
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// BuildID returns the GNU build ID of o from its .note.gnu.build-id
+// section, if it has one.
+func BuildID(o Obj) ([]byte, bool) {
+	if d, ok := o.(*debugObj); ok {
+		o = d.Obj
+	}
+	f, ok := o.(*elfFile)
+	if !ok {
+		return nil, false
+	}
+	sect := f.elf.Section(".note.gnu.build-id")
+	if sect == nil {
+		return nil, false
+	}
+	data, err := sect.Data()
+	if err != nil {
+		return nil, false
+	}
+	// Walk the notes looking for NT_GNU_BUILD_ID in the "GNU"
+	// namespace.
+	const ntGNUBuildID = 3
+	order := f.elf.ByteOrder
+	align4 := func(n uint32) uint32 { return (n + 3) &^ 3 }
+	for len(data) >= 12 {
+		namesz, descsz, typ := order.Uint32(data), order.Uint32(data[4:]), order.Uint32(data[8:])
+		data = data[12:]
+		if uint64(align4(namesz))+uint64(align4(descsz)) > uint64(len(data)) {
+			break
+		}
+		name := data[:namesz]
+		desc := data[align4(namesz) : align4(namesz)+descsz]
+		data = data[align4(namesz)+align4(descsz):]
+		if typ == ntGNUBuildID && string(bytes.TrimRight(name, "\x00")) == "GNU" {
+			return desc, true
+		}
+	}
+	return nil, false
+}
+
+// DebugLink returns the file name and CRC-32 of the separate debug
+// info file named by o's .gnu_debuglink section, if it has one.
+func DebugLink(o Obj) (name string, crc uint32, ok bool) {
+	f, ok := o.(*elfFile)
+	if !ok {
+		return "", 0, false
+	}
+	sect := f.elf.Section(".gnu_debuglink")
+	if sect == nil {
+		return "", 0, false
+	}
+	data, err := sect.Data()
+	if err != nil {
+		return "", 0, false
+	}
+	// The section is a NUL-terminated file name, padded to a
+	// multiple of 4 bytes, followed by a 4-byte CRC.
+	n := bytes.IndexByte(data, 0)
+	if n <= 0 {
+		return "", 0, false
+	}
+	crcOff := (n + 4) &^ 3
+	if crcOff+4 > len(data) {
+		return "", 0, false
+	}
+	return string(data[:n]), f.elf.ByteOrder.Uint32(data[crcOff:]), true
+}
+
+// DWARFSection returns the raw, decompressed contents of the named
+// DWARF section of o (for example, ".debug_names") and the byte order
+// of o's DWARF. If o has a separate debug info file, it reads the
+// section from that file.
+func DWARFSection(o Obj, name string) ([]byte, binary.ByteOrder, bool) {
+	if d, ok := o.(*debugObj); ok {
+		if d.dwarfErr != nil {
+			return nil, nil, false
+		}
+		o = d.debug
+	}
+	if f, ok := o.(*peFile); ok {
+		// MinGW puts DWARF in PE sections with long names.
+		sect := f.pe.Section(name)
+		if sect == nil {
+			return nil, nil, false
+		}
+		data, err := sect.Data()
+		if err != nil {
+			return nil, nil, false
+		}
+		// The raw data is padded to the file alignment.
+		if sect.VirtualSize != 0 && uint64(sect.VirtualSize) < uint64(len(data)) {
+			data = data[:sect.VirtualSize]
+		}
+		return data, binary.LittleEndian, true
+	}
+	f, ok := o.(*elfFile)
+	if !ok {
+		return nil, nil, false
+	}
+	sect := f.elf.Section(name)
+	if sect == nil || sect.Type == elf.SHT_NOBITS {
+		return nil, nil, false
+	}
+	data, err := sect.Data()
+	if err != nil {
+		return nil, nil, false
+	}
+	return data, f.elf.ByteOrder, true
+}
+
+// WithDebug returns an Obj that reads code and data from o, but reads
+// DWARF from debug, a separate debug info file for o. If syms is
+// true, it also reads the symbol table from debug, which is useful if
+// o is stripped.
+func WithDebug(o, debug Obj, syms bool) Obj {
+	return &debugObj{Obj: o, debug: debug, syms: syms}
+}
+
+type debugObj struct {
+	Obj
+	debug Obj
+	syms  bool
+
+	// moved, if non-nil, is debug's symbol table translated to
+	// o's addresses and sections. See WithDebugBuild.
+	moved symSlice
+	// dwarfErr, if non-nil, is returned instead of debug's DWARF.
+	dwarfErr error
+}
+
+func (f *debugObj) DWARF() (*dwarf.Data, error) {
+	if f.dwarfErr != nil {
+		return nil, f.dwarfErr
+	}
+	return f.debug.DWARF()
+}
+
+func (f *debugObj) Symbols() (Symbols, error) {
+	if f.moved != nil {
+		return f.moved, nil
+	}
+	if f.syms {
+		return f.debug.Symbols()
+	}
+	return f.Obj.Symbols()
+}
+
+func (f *debugObj) SymbolData(i SymID) (Data, error) {
+	if !f.syms {
+		return f.Obj.SymbolData(i)
+	}
+	// The debug file has the symbol table, but generally not
+	// the data, so look the symbol up by address in o.
+	syms, err := f.Symbols()
+	if err != nil {
+		return Data{}, err
+	}
+	if i < 0 || i >= syms.Len() {
+		return Data{}, &IndexError{"symbol", int(i)}
+	}
+	var sym Sym
+	syms.Get(i, &sym)
+	if !sym.HasAddr {
+		return Data{R: noRelocs}, nil
+	}
+	data, err := f.Obj.Data(sym.Value, sym.Size)
+	if err != nil {
+		return Data{}, err
+	}
+	// Relocations in o refer to o's symbol IDs, which don't
+	// mean anything in the debug file's symbol table.
+	data.R = noRelocs
+	if data.P == nil {
+		data.Addr = sym.Value
+	}
+	return data, nil
+}
+
+type symSlice []Sym
+
+func (s symSlice) Len() SymID {
+	return SymID(len(s))
+}
+
+func (s symSlice) Get(i SymID, sym *Sym) {
+	*sym = s[i]
+}
+
+// A BuildMatch describes how a debug build lines up with the build it
+// provides symbols for. See WithDebugBuild.
+type BuildMatch struct {
+	// SameBuildID indicates that both builds have the same GNU
+	// build ID, so they're almost certainly identical.
+	SameBuildID bool
+
+	// Moved lists the sections that are at different addresses
+	// in the two builds.
+	Moved []string
+
+	// DWARF indicates that the debug build's DWARF is used. This
+	// requires that no section containing code moved, since DWARF
+	// addresses can't be translated. If only data moved, the
+	// DWARF locations of global variables are wrong.
+	DWARF bool
+
+	// Missing lists the loaded sections of the debug build that
+	// the other build doesn't have. Symbols in them are dropped.
+	Missing []string
+
+	// Checked is the number of functions whose code was
+	// compared between the builds, and Matched is the number
+	// that were the same. If data moved, references to it
+	// differ, so code only has to be mostly the same.
+	Checked, Matched int
+}
+
+// maxBuildChecks is the number of functions WithDebugBuild compares.
+const maxBuildChecks = 256
+
+// WithDebugBuild returns an Obj that reads code and data from o, but
+// reads symbols and DWARF from debug, an unstripped build of the same
+// program (for example, o built with -ldflags=-s -w and debug built
+// without). Unlike WithDebug, the builds may be laid out differently:
+// WithDebugBuild matches their sections by name and translates
+// debug's symbols to o's addresses. DWARF addresses can't be
+// translated, so if any section containing code moved, the result
+// has no DWARF.
+//
+// To check that the builds match, WithDebugBuild compares the code of
+// a sample of functions. It returns an error if none match.
+func WithDebugBuild(o, debug Obj) (Obj, *BuildMatch, error) {
+	oa, da := o.Info().Arch, debug.Info().Arch
+	if oa != nil && da != nil && oa != da {
+		return nil, nil, fmt.Errorf("debug build is for %s, not %s", da.GoArch, oa.GoArch)
+	}
+
+	m := new(BuildMatch)
+	if id, ok := BuildID(o); ok {
+		did, ok := BuildID(debug)
+		m.SameBuildID = ok && bytes.Equal(id, did)
+	}
+
+	// Map debug's sections to o's by name.
+	oSects, dSects := o.Sections(), debug.Sections()
+	byName := make(map[string]int)
+	for i, s := range oSects {
+		if _, ok := byName[s.Name]; !ok {
+			byName[s.Name] = i
+		}
+	}
+	sectMap := make([]int, len(dSects))
+	delta := make([]uint64, len(dSects))
+	for i, s := range dSects {
+		j, ok := byName[s.Name]
+		if !ok {
+			sectMap[i] = -1
+			if s.Addr != 0 {
+				m.Missing = append(m.Missing, s.Name)
+			}
+			continue
+		}
+		sectMap[i] = j
+		delta[i] = oSects[j].Addr - s.Addr
+		if delta[i] != 0 {
+			m.Moved = append(m.Moved, s.Name)
+		}
+	}
+
+	// Translate debug's symbols, remembering the functions so
+	// we can compare their code.
+	syms, err := debug.Symbols()
+	if err != nil {
+		return nil, nil, err
+	}
+	moved := make(symSlice, 0, syms.Len())
+	var funcs, funcIDs []SymID
+	codeMoved := false
+	var sym Sym
+	for i := SymID(0); i < syms.Len(); i++ {
+		syms.Get(i, &sym)
+		if 0 <= sym.Section && sym.Section < len(dSects) {
+			if sectMap[sym.Section] < 0 {
+				continue
+			}
+			if sym.HasAddr {
+				sym.Value += delta[sym.Section]
+			}
+			sym.Section = sectMap[sym.Section]
+		}
+		if sym.Kind == SymText && sym.HasAddr && sym.Size > 0 && sym.Size <= maxDataSize {
+			if delta[sym.Section] != 0 {
+				codeMoved = true
+			}
+			funcs = append(funcs, SymID(len(moved)))
+			funcIDs = append(funcIDs, i)
+		}
+		moved = append(moved, sym)
+	}
+
+	step := 1
+	if len(funcs) > maxBuildChecks {
+		step = len(funcs) / maxBuildChecks
+	}
+	for k := 0; k < len(funcs) && m.Checked < maxBuildChecks; k += step {
+		want, err := debug.SymbolData(funcIDs[k])
+		if err != nil || want.P == nil {
+			continue
+		}
+		sym := moved[funcs[k]]
+		m.Checked++
+		got, err := o.Data(sym.Value, sym.Size)
+		if err == nil && similarCode(got.P, want.P) {
+			m.Matched++
+		}
+	}
+	if m.Checked > 0 && m.Matched == 0 {
+		return nil, m, errors.New("debug build's code doesn't match; it may be from different source or build flags")
+	}
+
+	d := &debugObj{Obj: o, debug: debug, syms: true, moved: moved}
+	m.DWARF = !codeMoved
+	if codeMoved {
+		d.dwarfErr = fmt.Errorf("debug build's code is laid out differently (%s moved): %w", strings.Join(m.Moved, ", "), ErrNoDWARF)
+	}
+	return d, m, nil
+}
+
+// similarCode reports whether two functions' code is the same, except
+// perhaps for the displacements of references to data. It allows a
+// quarter of the bytes to differ, which is far more than differ
+// between builds of the same code, but far fewer than differ between
+// unrelated code.
+func similarCode(a, b []byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	diff := 0
+	for i := range a {
+		if a[i] != b[i] {
+			diff++
+		}
+	}
+	return diff*4 <= len(a)
+}
@@ -0,0 +1,647 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package obj
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aclements/objbrowse/arch"
+)
+
+type elfFile struct {
+	elf      *elf.File
+	r        io.ReaderAt
+	mapRef   mapRef
+	sections map[*elf.Section]*elfSection
+
+	syms       []elf.Symbol
+	dynStart   SymID // syms index of first dynamic symbol
+	synthStart SymID // syms index of first synthesized item symbol
+
+	vers *elfVersions
+
+	// cache, if non-nil, holds decoded relocations. See SetCache.
+	cache Cache
+}
+
+type elfSection struct {
+	sect *elf.Section
+
+	// Decoded and sorted relocations applied to this section.
+	relocs struct {
+		srcs []*elfRelSection // REL or RELA sections that apply to this section
+
+		// loaded is the decoded relocations, if f has no
+		// cache. Otherwise, they're in the cache.
+		load   sync.Once
+		loaded *elfSectRelocs
+		err    error
+	}
+}
+
+// elfSectRelocs are the decoded relocations that apply to a section.
+type elfSectRelocs struct {
+	relas []elf.Rela64
+
+	baseSymIDs []SymID // If nil, use baseSymID
+	baseSymID  SymID
+}
+
+func openElf(r io.ReaderAt) (Obj, error) {
+	elfF, err := elf.NewFile(r)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &elfFile{elf: elfF, r: r}
+
+	// Load symbols from both symbol sections so we can assign
+	// them global indexes. Note that the same symbol can appear
+	// in both tables. Clients need to deal with that.
+	staticSyms, err := f.elf.Symbols()
+	if err != nil && err != elf.ErrNoSymbols {
+		return nil, err
+	}
+	f.syms = append(f.syms, staticSyms...)
+	f.dynStart = SymID(len(f.syms))
+	dynSyms, err := f.elf.DynamicSymbols()
+	if err != nil && err != elf.ErrNoSymbols {
+		return nil, err
+	}
+	f.syms = append(f.syms, dynSyms...)
+	f.vers = readELFVersions(f.elf)
+	elfSynthesizeSizes(f.syms, f.elf.Sections)
+	f.synthStart = SymID(len(f.syms))
+	f.syms = append(f.syms, elfMergeItems(f.elf.Sections)...)
+	f.syms = append(f.syms, elfPLTEntries(f.elf, dynSyms)...)
+	if f.elf.Type != elf.ET_REL {
+		f.syms = append(f.syms, elfGaps(f.syms, f.elf.Sections)...)
+	}
+
+	// Populate section map. Section 0 is reserved, but a
+	// malformed file may not even have that.
+	sects := f.elf.Sections
+	if len(sects) > 0 {
+		sects = sects[1:]
+	}
+	f.sections = make(map[*elf.Section]*elfSection)
+	for _, sect := range sects {
+		f.sections[sect] = &elfSection{sect: sect}
+	}
+
+	// Map relocation sections to the sections they apply to.
+	//
+	// There's nothing stopping ELF from containing more than one
+	// of each symbol table. The debug/elf package only returns
+	// the first it finds of each, so we can only handle
+	// relocation sections against these.
+	symtab := f.elf.SectionByType(elf.SHT_SYMTAB)
+	dynsym := f.elf.SectionByType(elf.SHT_DYNSYM)
+	for _, sect := range sects {
+		switch sect.Type {
+		case elf.SHT_RELA, elf.SHT_REL:
+			if sect.Info < 0 || int(sect.Info) >= len(f.elf.Sections) ||
+				sect.Link <= 0 || int(sect.Link) >= len(f.elf.Sections) {
+				// This is an malformed relocation
+				// section. Ignore.
+				break
+			}
+
+			// Figure out mapping from per-symbol-table
+			// indexes to global indexes.
+			relsyms := f.elf.Sections[sect.Link]
+			var baseSymID SymID
+			if relsyms == symtab {
+				baseSymID = 0
+			} else if relsyms == dynsym {
+				baseSymID = f.dynStart
+			} else {
+				// We only return symbols from these
+				// two sections, so we can't represent
+				// relocations that have targets from
+				// some other section.
+				break
+			}
+
+			ers := &elfRelSection{elf: f.elf, sect: sect, baseSymID: baseSymID}
+
+			// Attach the relocation section to the
+			// sections it applies to.
+			if sect.Info != 0 {
+				target := f.sections[f.elf.Sections[sect.Info]]
+				target.relocs.srcs = append(target.relocs.srcs, ers)
+			} else {
+				// This applies to "all" sections.
+				// E.g., .rela.dyn is a .so.
+				for _, es := range f.sections {
+					if es.sect.Flags&elf.SHF_ALLOC == 0 {
+						continue
+					}
+					es.relocs.srcs = append(es.relocs.srcs, ers)
+				}
+			}
+		}
+	}
+
+	return f, nil
+}
+
+func elfSynthesizeSizes(syms []elf.Symbol, sects []*elf.Section) {
+	// Sort by address (without destroying order).
+	addr := make([]int, 0, len(syms))
+	for i := range syms {
+		if elfHasAddr(&syms[i]) {
+			addr = append(addr, i)
+		}
+	}
+	sort.Slice(addr, func(i, j int) bool {
+		si, sj := &syms[addr[i]], &syms[addr[j]]
+		if si.Section != sj.Section {
+			return si.Section < sj.Section
+		}
+		return si.Value < sj.Value
+	})
+
+	// Assign addresses to zero-sized symbols within each section.
+	for len(addr) != 0 {
+		// Collect symbols that have the same value and
+		// section. Most of the time we'll get groups of 1,
+		// but sometimes there are multiple names for the same
+		// address (especially in shared objects).
+		s1 := &syms[addr[0]]
+		group := 1
+		anyZero := s1.Size == 0
+		for group < len(addr) {
+			s2 := &syms[addr[group]]
+			if s1.Value != s2.Value || s1.Section != s2.Section {
+				break
+			}
+			if s1.Size == 0 {
+				anyZero = true
+			}
+			group++
+		}
+		if !anyZero {
+			// They all have sizes. Move on.
+			addr = addr[group:]
+			continue
+		}
+
+		// Compute the size of these symbols.
+		var size uint64
+		if group == len(addr) || s1.Section != syms[addr[group]].Section {
+			// Cap the symbols at the end of the section.
+			if 0 < s1.Section && int(s1.Section) < len(sects) {
+				sect := sects[s1.Section]
+				size = sect.Addr + sect.Size - s1.Value
+			}
+		} else {
+			size = syms[addr[group]].Value - s1.Value
+		}
+
+		// Apply this size to all zero-sized symbols in this group.
+		for _, symi := range addr[:group] {
+			if syms[symi].Size == 0 {
+				syms[symi].Size = size
+			}
+		}
+		addr = addr[group:]
+	}
+}
+
+// elfHasAddr returns true if sym's value is a meaningful address in
+// the loaded object's virtual address space.
+// elfMergeItems synthesizes a local symbol for each loaded SHF_MERGE
+// section and for each string or constant in it, so references to
+// these items can be resolved to the specific item rather than to the
+// start of the section.
+func elfMergeItems(sects []*elf.Section) []elf.Symbol {
+	var syms []elf.Symbol
+	for i, sect := range sects {
+		const want = elf.SHF_MERGE | elf.SHF_ALLOC
+		if sect.Flags&want != want || sect.Type == elf.SHT_NOBITS || sect.Entsize == 0 {
+			continue
+		}
+		data, err := sect.Data()
+		if err != nil {
+			continue
+		}
+		ent := int(sect.Entsize)
+		// Give the whole section a symbol, too, so it can be
+		// viewed with its item boundaries.
+		syms = append(syms, elf.Symbol{
+			Name:    sect.Name,
+			Info:    elf.ST_INFO(elf.STB_LOCAL, elf.STT_SECTION),
+			Section: elf.SectionIndex(i),
+			Value:   sect.Addr,
+			Size:    sect.Size,
+		})
+		add := func(start, end int) {
+			syms = append(syms, elf.Symbol{
+				Name:    fmt.Sprintf("%s[%#x]", sect.Name, start),
+				Info:    elf.ST_INFO(elf.STB_LOCAL, elf.STT_OBJECT),
+				Section: elf.SectionIndex(i),
+				Value:   sect.Addr + uint64(start),
+				Size:    uint64(end - start),
+			})
+		}
+		if sect.Flags&elf.SHF_STRINGS == 0 {
+			// Fixed-size constants.
+			for off := 0; off+ent <= len(data); off += ent {
+				add(off, off+ent)
+			}
+			continue
+		}
+		// NUL-terminated strings of ent-byte characters.
+		start := 0
+		for off := 0; off+ent <= len(data); off += ent {
+			if elfIsNul(data[off : off+ent]) {
+				add(start, off+ent)
+				start = off + ent
+			}
+		}
+		if start < len(data) {
+			// Unterminated trailing string.
+			add(start, len(data))
+		}
+	}
+	return syms
+}
+
+// elfPLTEntries synthesizes a "name@plt" symbol for each PLT entry
+// that jumps through a GOT slot bound to dynamic symbol name, so calls
+// through the PLT resolve to the function they call. This only
+// understands x86-64 PLTs, where each entry jumps through its slot
+// with a RIP-relative indirect JMP.
+func elfPLTEntries(f *elf.File, dynSyms []elf.Symbol) []elf.Symbol {
+	if f.Machine != elf.EM_X86_64 || f.Class != elf.ELFCLASS64 {
+		return nil
+	}
+
+	// Map GOT slots to the dynamic symbols bound to them.
+	slots := make(map[uint64]string)
+	for _, sect := range f.Sections {
+		if sect.Type != elf.SHT_RELA || int(sect.Link) >= len(f.Sections) || f.Sections[sect.Link].Type != elf.SHT_DYNSYM {
+			continue
+		}
+		data, err := sect.Data()
+		if err != nil {
+			continue
+		}
+		for _, r := range elfReadRela64(data, f.ByteOrder) {
+			switch elf.R_X86_64(elf.R_TYPE64(r.Info)) {
+			case elf.R_X86_64_JMP_SLOT, elf.R_X86_64_GLOB_DAT:
+				// DynamicSymbols omits the null symbol.
+				if i := int(elf.R_SYM64(r.Info)) - 1; 0 <= i && i < len(dynSyms) && dynSyms[i].Name != "" {
+					slots[r.Off] = dynSyms[i].Name
+				}
+			}
+		}
+	}
+	if len(slots) == 0 {
+		return nil
+	}
+
+	var syms []elf.Symbol
+	for i, sect := range f.Sections {
+		if !strings.HasPrefix(sect.Name, ".plt") || sect.Flags&elf.SHF_EXECINSTR == 0 || sect.Type == elf.SHT_NOBITS {
+			continue
+		}
+		data, err := sect.Data()
+		if err != nil {
+			continue
+		}
+		ent := int(sect.Entsize)
+		if ent == 0 {
+			ent = 16
+		}
+		for off := 0; off+ent <= len(data); off += ent {
+			// Find the entry's "JMP *disp(%rip)", which may
+			// follow an ENDBR64 or BND prefix.
+			e := data[off : off+ent]
+			for k := 0; k+6 <= len(e); k++ {
+				if e[k] != 0xff || e[k+1] != 0x25 {
+					continue
+				}
+				disp := int32(f.ByteOrder.Uint32(e[k+2:]))
+				slot := sect.Addr + uint64(off+k+6) + uint64(int64(disp))
+				if name, ok := slots[slot]; ok {
+					syms = append(syms, elf.Symbol{
+						Name:    name + "@plt",
+						Info:    elf.ST_INFO(elf.STB_LOCAL, elf.STT_FUNC),
+						Section: elf.SectionIndex(i),
+						Value:   sect.Addr + uint64(off),
+						Size:    uint64(ent),
+					})
+				}
+				break
+			}
+		}
+	}
+	return syms
+}
+
+// elfGaps synthesizes a local symbol for each range of a loaded
+// section that isn't covered by any of syms, such as a PLT header,
+// linker stubs, or all of a stripped binary, so every loaded address
+// resolves to some symbol. A gap at the start of a section is named
+// after the section, and later gaps are named "section+0xoff". Gaps
+// between symbols that are shorter than the section's alignment are
+// usually alignment padding, which nothing refers to, so they don't
+// get symbols.
+func elfGaps(syms []elf.Symbol, sects []*elf.Section) []elf.Symbol {
+	type span struct{ lo, hi uint64 }
+	covered := make(map[elf.SectionIndex][]span)
+	for i := range syms {
+		s := &syms[i]
+		if s.Size != 0 && elfHasAddr(s) {
+			covered[s.Section] = append(covered[s.Section], span{s.Value, s.Value + s.Size})
+		}
+	}
+
+	var out []elf.Symbol
+	for i, sect := range sects {
+		if sect.Flags&elf.SHF_ALLOC == 0 || sect.Flags&elf.SHF_TLS != 0 || sect.Addr == 0 || sect.Size == 0 {
+			continue
+		}
+		spans := covered[elf.SectionIndex(i)]
+		sort.Slice(spans, func(i, j int) bool { return spans[i].lo < spans[j].lo })
+		pos, end := sect.Addr, sect.Addr+sect.Size
+		gap := func(hi uint64) {
+			if hi > end {
+				hi = end
+			}
+			if pos >= hi {
+				return
+			}
+			if pos != sect.Addr && hi != end && hi-pos < sect.Addralign {
+				// Padding.
+				return
+			}
+			name := sect.Name
+			if pos != sect.Addr {
+				name = fmt.Sprintf("%s+%#x", sect.Name, pos-sect.Addr)
+			}
+			out = append(out, elf.Symbol{
+				Name:    name,
+				Info:    elf.ST_INFO(elf.STB_LOCAL, elf.STT_NOTYPE),
+				Section: elf.SectionIndex(i),
+				Value:   pos,
+				Size:    hi - pos,
+			})
+		}
+		for _, sp := range spans {
+			gap(sp.lo)
+			if sp.hi > pos {
+				pos = sp.hi
+			}
+		}
+		gap(end)
+	}
+	return out
+}
+
+func elfIsNul(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func elfHasAddr(sym *elf.Symbol) bool {
+	switch sym.Section {
+	case elf.SHN_UNDEF, elf.SHN_ABS:
+		return false
+	}
+	switch elf.ST_TYPE(sym.Info) {
+	case elf.STT_FILE, elf.STT_TLS:
+		// STT_FILE symbols should also be absolute,
+		// but we check just in case. STT_TLS symbols
+		// have TLS-relative addresses, not regular
+		// addresses.
+		return false
+	}
+	return true
+}
+
+// elfToArch maps from ELF machine to the architectures for each
+// class and byte order, since some machine types cover several Go
+// architectures.
+var elfToArch = map[elf.Machine][]*arch.Arch{
+	elf.EM_X86_64:  {arch.AMD64},
+	elf.EM_386:     {arch.I386},
+	elf.EM_ARM:     {arch.ARM},
+	elf.EM_AARCH64: {arch.ARM64},
+	elf.EM_MIPS:    {arch.MIPS, arch.MIPSLE, arch.MIPS64, arch.MIPS64LE},
+	elf.EM_PPC64:   {arch.PPC64, arch.PPC64LE},
+	elf.EM_S390:    {arch.S390X},
+
+	elfMachineLoongArch: {arch.LOONG64},
+
+	// Machines missing from elfRelocTypes show relocations with
+	// unknown types.
+}
+
+// elfArch returns the architecture of f, or nil if it's unknown.
+func elfArch(f *elf.File) *arch.Arch {
+	ptrSize := 4
+	if f.Class == elf.ELFCLASS64 {
+		ptrSize = 8
+	}
+	for _, a := range elfToArch[f.Machine] {
+		if a.PtrSize == ptrSize && a.ByteOrder == f.ByteOrder {
+			return a
+		}
+	}
+	return nil
+}
+
+func (f *elfFile) Info() ObjInfo {
+	return ObjInfo{
+		Arch:        elfArch(f.elf),
+		Format:      "elf",
+		PIE:         f.elf.Type == elf.ET_DYN,
+		Relocatable: f.elf.Type == elf.ET_REL,
+	}
+}
+
+func (f *elfFile) Data(ptr, size uint64) (Data, error) {
+	// Look up the section containing ptr.
+	//
+	// TODO: This whole operation is poorly defined. If this is a
+	// loadable object and this is over the loaded address space,
+	// we should check the program headers, not the section
+	// headers. On a non-loadable object, this is meaningless (and
+	// sections may even overlap).
+	for _, sect := range f.elf.Sections {
+		end := sect.Addr + sect.Size
+		if sect.Addr <= ptr && ptr < end {
+			// Found it. Limit size.
+			if ptr+size > end {
+				size = end - ptr
+			}
+			return f.sectData(sect, ptr, size)
+		}
+	}
+	return Data{R: noRelocs}, nil
+}
+
+func (f *elfFile) Sections() []Section {
+	// Skip the null section.
+	var sects []Section
+	for i, sect := range f.elf.Sections {
+		if i > 0 {
+			var flags SectFlags
+			if sect.Flags&elf.SHF_ALLOC != 0 {
+				flags |= SectAlloc
+			}
+			if sect.Flags&elf.SHF_WRITE != 0 {
+				flags |= SectWrite
+			}
+			if sect.Flags&elf.SHF_EXECINSTR != 0 {
+				flags |= SectExec
+			}
+			sects = append(sects, Section{sect.Name, sect.Addr, sect.Size, sect.Type == elf.SHT_NOBITS, sect.Addralign, flags})
+		}
+	}
+	return sects
+}
+
+func (f *elfFile) SectionData(i int) (Data, error) {
+	if i < 0 || i+1 >= len(f.elf.Sections) {
+		return Data{}, &IndexError{"section", i}
+	}
+	sect := f.elf.Sections[i+1]
+	return f.sectData(sect, sect.Addr, sect.Size)
+}
+
+func (f *elfFile) Symbols() (Symbols, error) {
+	return &elfSymbols{f.elf, f.syms, f.dynStart, f.synthStart, f.vers.syms}, nil
+}
+
+type elfSymbols struct {
+	elf        *elf.File
+	syms       []elf.Symbol
+	dynStart   SymID
+	synthStart SymID
+	vers       []elfSymVersion // Indexed from dynStart
+}
+
+func (t *elfSymbols) Len() SymID {
+	return SymID(len(t.syms))
+}
+
+func (t *elfSymbols) Get(i SymID, s *Sym) {
+	esym := t.syms[i]
+
+	kind := SymUnknown
+	switch esym.Section {
+	case elf.SHN_UNDEF:
+		kind = SymUndef
+	case elf.SHN_COMMON:
+		kind = SymBSS
+	case elf.SHN_ABS:
+		kind = SymAbsolute
+	default:
+		if esym.Section < 0 || esym.Section >= elf.SectionIndex(len(t.elf.Sections)) {
+			// Leave unknown.
+			break
+		}
+		sect := t.elf.Sections[esym.Section]
+		switch sect.Flags & (elf.SHF_WRITE | elf.SHF_ALLOC | elf.SHF_EXECINSTR) {
+		case elf.SHF_ALLOC | elf.SHF_EXECINSTR:
+			kind = SymText
+		case elf.SHF_ALLOC:
+			kind = SymROData
+		case elf.SHF_ALLOC | elf.SHF_WRITE:
+			kind = SymData
+		}
+	}
+	local := elf.ST_BIND(esym.Info) == elf.STB_LOCAL
+	hasAddr := elfHasAddr(&esym)
+
+	*s = Sym{Name: esym.Name, Value: esym.Value, Size: esym.Size, Kind: kind, Local: local, HasAddr: hasAddr}
+	s.Weak = elf.ST_BIND(esym.Info) == elf.STB_WEAK
+	switch elf.ST_VISIBILITY(esym.Other) {
+	case elf.STV_PROTECTED:
+		s.Visibility = SymProtected
+	case elf.STV_HIDDEN:
+		s.Visibility = SymHidden
+	case elf.STV_INTERNAL:
+		s.Visibility = SymInternal
+	}
+	// Only the dynamic symbol table carries versions.
+	s.Version = esym.Version
+	s.Dynamic = i >= t.dynStart && i < t.synthStart
+	if j := int(i - t.dynStart); s.Dynamic && j < len(t.vers) {
+		v := &t.vers[j]
+		s.Version, s.Library, s.VersionHidden = v.name, v.library, v.hidden
+	}
+	s.Synthetic = i >= t.synthStart
+	s.Section = -1
+	if esym.Section > 0 && esym.Section < elf.SectionIndex(len(t.elf.Sections)) {
+		// Obj.Sections omits the null section.
+		s.Section = int(esym.Section) - 1
+	}
+	s.Info, s.Other = esym.Info, esym.Other
+}
+
+func (f *elfFile) SymbolData(i SymID) (Data, error) {
+	if i < 0 || int(i) >= len(f.syms) {
+		return Data{}, &IndexError{"symbol", int(i)}
+	}
+	s := f.syms[i]
+	if s.Section == elf.SHN_UNDEF || s.Section >= elf.SectionIndex(len(f.elf.Sections)) {
+		// Undefined, absolute, or common.
+		return Data{Addr: s.Value, R: noRelocs}, nil
+	}
+	sect := f.elf.Sections[s.Section]
+	if s.Value < sect.Addr || s.Value-sect.Addr > sect.Size {
+		return Data{}, fmt.Errorf("symbol %q is outside section %q", s.Name, sect.Name)
+	}
+	size := s.Size
+	if end := sect.Size - (s.Value - sect.Addr); size > end {
+		size = end
+	}
+	return f.sectData(sect, s.Value, size)
+}
+
+func (f *elfFile) DWARF() (*dwarf.Data, error) {
+	if f.elf.Section(".debug_info") == nil && f.elf.Section(".zdebug_info") == nil {
+		return nil, ErrNoDWARF
+	}
+	return f.elf.DWARF()
+}
+
+func (f *elfFile) sectData(sect *elf.Section, ptr, size uint64) (Data, error) {
+	pos, flen := ptr-sect.Addr, uint64(0)
+	if sect.Type != elf.SHT_NOBITS && pos < sect.Size {
+		flen = sect.Size - pos
+	}
+	p, err := readData(f.r, 0, int64(sect.Offset)+int64(pos), flen, size)
+	if err != nil {
+		return Data{}, err
+	}
+	out := Data{Addr: ptr, P: p, R: noRelocs}
+
+	// Get relocations.
+	relocs, err := f.sectRelocs(sect, ptr, size)
+	if err != nil {
+		return Data{}, err
+	}
+	if relocs == nil {
+		return out, nil
+	}
+	out.R = relocs
+	return out, err
+}
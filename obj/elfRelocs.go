@@ -0,0 +1,530 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package obj
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"sort"
+	"sync"
+)
+
+type elfRelocType struct {
+	typ  RelocType
+	size byte
+}
+
+const elfRelocMaxSize = 16
+
+var elfRelocTypes = map[elf.Machine]map[uint32]elfRelocType{
+	elf.EM_X86_64: map[uint32]elfRelocType{
+		uint32(elf.R_X86_64_NONE):            {elf.R_X86_64_NONE, 0},
+		uint32(elf.R_X86_64_64):              {elf.R_X86_64_64, 8},
+		uint32(elf.R_X86_64_PC32):            {elf.R_X86_64_PC32, 4},
+		uint32(elf.R_X86_64_GOT32):           {elf.R_X86_64_GOT32, 4},
+		uint32(elf.R_X86_64_PLT32):           {elf.R_X86_64_PLT32, 4},
+		uint32(elf.R_X86_64_COPY):            {elf.R_X86_64_COPY, 0},
+		uint32(elf.R_X86_64_GLOB_DAT):        {elf.R_X86_64_GLOB_DAT, 8},
+		uint32(elf.R_X86_64_JMP_SLOT):        {elf.R_X86_64_JMP_SLOT, 8},
+		uint32(elf.R_X86_64_RELATIVE):        {elf.R_X86_64_RELATIVE, 8},
+		uint32(elf.R_X86_64_GOTPCREL):        {elf.R_X86_64_GOTPCREL, 4},
+		uint32(elf.R_X86_64_32):              {elf.R_X86_64_32, 4},
+		uint32(elf.R_X86_64_32S):             {elf.R_X86_64_32S, 4},
+		uint32(elf.R_X86_64_16):              {elf.R_X86_64_16, 2},
+		uint32(elf.R_X86_64_PC16):            {elf.R_X86_64_PC16, 2},
+		uint32(elf.R_X86_64_8):               {elf.R_X86_64_8, 1},
+		uint32(elf.R_X86_64_PC8):             {elf.R_X86_64_PC8, 1},
+		uint32(elf.R_X86_64_DTPMOD64):        {elf.R_X86_64_DTPMOD64, 8},
+		uint32(elf.R_X86_64_DTPOFF64):        {elf.R_X86_64_DTPOFF64, 8},
+		uint32(elf.R_X86_64_TPOFF64):         {elf.R_X86_64_TPOFF64, 8},
+		uint32(elf.R_X86_64_TLSGD):           {elf.R_X86_64_TLSGD, 4},
+		uint32(elf.R_X86_64_TLSLD):           {elf.R_X86_64_TLSLD, 4},
+		uint32(elf.R_X86_64_DTPOFF32):        {elf.R_X86_64_DTPOFF32, 4},
+		uint32(elf.R_X86_64_GOTTPOFF):        {elf.R_X86_64_GOTTPOFF, 4},
+		uint32(elf.R_X86_64_TPOFF32):         {elf.R_X86_64_TPOFF32, 4},
+		uint32(elf.R_X86_64_PC64):            {elf.R_X86_64_PC64, 8},
+		uint32(elf.R_X86_64_GOTOFF64):        {elf.R_X86_64_GOTOFF64, 8},
+		uint32(elf.R_X86_64_GOTPC32):         {elf.R_X86_64_GOTPC32, 4},
+		uint32(elf.R_X86_64_GOT64):           {elf.R_X86_64_GOT64, 8},
+		uint32(elf.R_X86_64_GOTPCREL64):      {elf.R_X86_64_GOTPCREL64, 8},
+		uint32(elf.R_X86_64_GOTPC64):         {elf.R_X86_64_GOTPC64, 8},
+		uint32(elf.R_X86_64_GOTPLT64):        {elf.R_X86_64_GOTPLT64, 8},
+		uint32(elf.R_X86_64_PLTOFF64):        {elf.R_X86_64_PLTOFF64, 8},
+		uint32(elf.R_X86_64_SIZE32):          {elf.R_X86_64_SIZE32, 4},
+		uint32(elf.R_X86_64_SIZE64):          {elf.R_X86_64_SIZE64, 8},
+		uint32(elf.R_X86_64_GOTPC32_TLSDESC): {elf.R_X86_64_GOTPC32_TLSDESC, 4},
+		uint32(elf.R_X86_64_TLSDESC_CALL):    {elf.R_X86_64_TLSDESC_CALL, 0},
+		uint32(elf.R_X86_64_TLSDESC):         {elf.R_X86_64_TLSDESC, 16},
+		uint32(elf.R_X86_64_IRELATIVE):       {elf.R_X86_64_IRELATIVE, 8},
+		// See https://github.com/hjl-tools/x86-psABI/wiki/X86-psABI
+		uint32(elf.R_X86_64_RELATIVE64):    {elf.R_X86_64_RELATIVE64, 8}, // For x32
+		uint32(elf.R_X86_64_PC32_BND):      {elf.R_X86_64_PC32_BND, 4},   // For x32; deprecated
+		uint32(elf.R_X86_64_PLT32_BND):     {elf.R_X86_64_PLT32_BND, 4},  // For x32; deprecated
+		uint32(elf.R_X86_64_GOTPCRELX):     {elf.R_X86_64_GOTPCRELX, 4},
+		uint32(elf.R_X86_64_REX_GOTPCRELX): {elf.R_X86_64_REX_GOTPCRELX, 4},
+	},
+
+	elf.EM_386: map[uint32]elfRelocType{
+		uint32(elf.R_386_NONE):          {elf.R_386_NONE, 0},
+		uint32(elf.R_386_32):            {elf.R_386_32, 4},
+		uint32(elf.R_386_PC32):          {elf.R_386_PC32, 4},
+		uint32(elf.R_386_GOT32):         {elf.R_386_GOT32, 4},
+		uint32(elf.R_386_PLT32):         {elf.R_386_PLT32, 4},
+		uint32(elf.R_386_COPY):          {elf.R_386_COPY, 0},
+		uint32(elf.R_386_GLOB_DAT):      {elf.R_386_GLOB_DAT, 4},
+		uint32(elf.R_386_JMP_SLOT):      {elf.R_386_JMP_SLOT, 4},
+		uint32(elf.R_386_RELATIVE):      {elf.R_386_RELATIVE, 4},
+		uint32(elf.R_386_GOTOFF):        {elf.R_386_GOTOFF, 4},
+		uint32(elf.R_386_GOTPC):         {elf.R_386_GOTPC, 4},
+		uint32(elf.R_386_TLS_TPOFF):     {elf.R_386_TLS_TPOFF, 4},
+		uint32(elf.R_386_TLS_IE):        {elf.R_386_TLS_IE, 4},
+		uint32(elf.R_386_TLS_GOTIE):     {elf.R_386_TLS_GOTIE, 4},
+		uint32(elf.R_386_TLS_LE):        {elf.R_386_TLS_LE, 4},
+		uint32(elf.R_386_TLS_GD):        {elf.R_386_TLS_GD, 4},
+		uint32(elf.R_386_TLS_LDM):       {elf.R_386_TLS_LDM, 4},
+		uint32(elf.R_386_16):            {elf.R_386_16, 2},
+		uint32(elf.R_386_PC16):          {elf.R_386_PC16, 2},
+		uint32(elf.R_386_8):             {elf.R_386_8, 1},
+		uint32(elf.R_386_PC8):           {elf.R_386_PC8, 1},
+		uint32(elf.R_386_TLS_GD_32):     {elf.R_386_TLS_GD_32, 4},
+		uint32(elf.R_386_TLS_GD_PUSH):   {elf.R_386_TLS_GD_PUSH, 4},
+		uint32(elf.R_386_TLS_GD_CALL):   {elf.R_386_TLS_GD_CALL, 4},
+		uint32(elf.R_386_TLS_GD_POP):    {elf.R_386_TLS_GD_POP, 4},
+		uint32(elf.R_386_TLS_LDM_32):    {elf.R_386_TLS_LDM_32, 4},
+		uint32(elf.R_386_TLS_LDM_PUSH):  {elf.R_386_TLS_LDM_PUSH, 4},
+		uint32(elf.R_386_TLS_LDM_CALL):  {elf.R_386_TLS_LDM_CALL, 4},
+		uint32(elf.R_386_TLS_LDM_POP):   {elf.R_386_TLS_LDM_POP, 4},
+		uint32(elf.R_386_TLS_LDO_32):    {elf.R_386_TLS_LDO_32, 4},
+		uint32(elf.R_386_TLS_IE_32):     {elf.R_386_TLS_IE_32, 4},
+		uint32(elf.R_386_TLS_LE_32):     {elf.R_386_TLS_LE_32, 4},
+		uint32(elf.R_386_TLS_DTPMOD32):  {elf.R_386_TLS_DTPMOD32, 4},
+		uint32(elf.R_386_TLS_DTPOFF32):  {elf.R_386_TLS_DTPOFF32, 4},
+		uint32(elf.R_386_TLS_TPOFF32):   {elf.R_386_TLS_TPOFF32, 4},
+		uint32(elf.R_386_SIZE32):        {elf.R_386_SIZE32, 4},
+		uint32(elf.R_386_TLS_GOTDESC):   {elf.R_386_TLS_GOTDESC, 4},
+		uint32(elf.R_386_TLS_DESC_CALL): {elf.R_386_TLS_DESC_CALL, 0},
+		uint32(elf.R_386_TLS_DESC):      {elf.R_386_TLS_DESC, 4},
+		uint32(elf.R_386_IRELATIVE):     {elf.R_386_IRELATIVE, 4},
+		uint32(elf.R_386_GOT32X):        {elf.R_386_GOT32X, 4},
+	},
+	elf.EM_MIPS: map[uint32]elfRelocType{
+		uint32(elf.R_MIPS_NONE):            {elf.R_MIPS_NONE, 0},
+		uint32(elf.R_MIPS_16):              {elf.R_MIPS_16, 2},
+		uint32(elf.R_MIPS_32):              {elf.R_MIPS_32, 4},
+		uint32(elf.R_MIPS_REL32):           {elf.R_MIPS_REL32, 4},
+		uint32(elf.R_MIPS_26):              {elf.R_MIPS_26, 4},
+		uint32(elf.R_MIPS_HI16):            {elf.R_MIPS_HI16, 4},
+		uint32(elf.R_MIPS_LO16):            {elf.R_MIPS_LO16, 4},
+		uint32(elf.R_MIPS_GPREL16):         {elf.R_MIPS_GPREL16, 4},
+		uint32(elf.R_MIPS_LITERAL):         {elf.R_MIPS_LITERAL, 4},
+		uint32(elf.R_MIPS_GOT16):           {elf.R_MIPS_GOT16, 4},
+		uint32(elf.R_MIPS_PC16):            {elf.R_MIPS_PC16, 4},
+		uint32(elf.R_MIPS_CALL16):          {elf.R_MIPS_CALL16, 4},
+		uint32(elf.R_MIPS_GPREL32):         {elf.R_MIPS_GPREL32, 4},
+		uint32(elf.R_MIPS_64):              {elf.R_MIPS_64, 8},
+		uint32(elf.R_MIPS_GOT_DISP):        {elf.R_MIPS_GOT_DISP, 4},
+		uint32(elf.R_MIPS_GOT_PAGE):        {elf.R_MIPS_GOT_PAGE, 4},
+		uint32(elf.R_MIPS_GOT_OFST):        {elf.R_MIPS_GOT_OFST, 4},
+		uint32(elf.R_MIPS_GOT_HI16):        {elf.R_MIPS_GOT_HI16, 4},
+		uint32(elf.R_MIPS_GOT_LO16):        {elf.R_MIPS_GOT_LO16, 4},
+		uint32(elf.R_MIPS_SUB):             {elf.R_MIPS_SUB, 8},
+		uint32(elf.R_MIPS_HIGHER):          {elf.R_MIPS_HIGHER, 4},
+		uint32(elf.R_MIPS_HIGHEST):         {elf.R_MIPS_HIGHEST, 4},
+		uint32(elf.R_MIPS_CALL_HI16):       {elf.R_MIPS_CALL_HI16, 4},
+		uint32(elf.R_MIPS_CALL_LO16):       {elf.R_MIPS_CALL_LO16, 4},
+		uint32(elf.R_MIPS_JALR):            {elf.R_MIPS_JALR, 0},
+		uint32(elf.R_MIPS_TLS_DTPMOD32):    {elf.R_MIPS_TLS_DTPMOD32, 4},
+		uint32(elf.R_MIPS_TLS_DTPREL32):    {elf.R_MIPS_TLS_DTPREL32, 4},
+		uint32(elf.R_MIPS_TLS_DTPMOD64):    {elf.R_MIPS_TLS_DTPMOD64, 8},
+		uint32(elf.R_MIPS_TLS_DTPREL64):    {elf.R_MIPS_TLS_DTPREL64, 8},
+		uint32(elf.R_MIPS_TLS_GD):          {elf.R_MIPS_TLS_GD, 4},
+		uint32(elf.R_MIPS_TLS_LDM):         {elf.R_MIPS_TLS_LDM, 4},
+		uint32(elf.R_MIPS_TLS_DTPREL_HI16): {elf.R_MIPS_TLS_DTPREL_HI16, 4},
+		uint32(elf.R_MIPS_TLS_DTPREL_LO16): {elf.R_MIPS_TLS_DTPREL_LO16, 4},
+		uint32(elf.R_MIPS_TLS_GOTTPREL):    {elf.R_MIPS_TLS_GOTTPREL, 4},
+		uint32(elf.R_MIPS_TLS_TPREL32):     {elf.R_MIPS_TLS_TPREL32, 4},
+		uint32(elf.R_MIPS_TLS_TPREL64):     {elf.R_MIPS_TLS_TPREL64, 8},
+		uint32(elf.R_MIPS_TLS_TPREL_HI16):  {elf.R_MIPS_TLS_TPREL_HI16, 4},
+		uint32(elf.R_MIPS_TLS_TPREL_LO16):  {elf.R_MIPS_TLS_TPREL_LO16, 4},
+	},
+
+	// debug/elf doesn't define LoongArch relocations before Go
+	// 1.19, so these are from the LoongArch ELF psABI.
+	elfMachineLoongArch: map[uint32]elfRelocType{
+		0:   {elfRelocName("R_LARCH_NONE"), 0},
+		1:   {elfRelocName("R_LARCH_32"), 4},
+		2:   {elfRelocName("R_LARCH_64"), 8},
+		3:   {elfRelocName("R_LARCH_RELATIVE"), 8},
+		4:   {elfRelocName("R_LARCH_COPY"), 0},
+		5:   {elfRelocName("R_LARCH_JUMP_SLOT"), 8},
+		6:   {elfRelocName("R_LARCH_TLS_DTPMOD32"), 4},
+		7:   {elfRelocName("R_LARCH_TLS_DTPMOD64"), 8},
+		8:   {elfRelocName("R_LARCH_TLS_DTPREL32"), 4},
+		9:   {elfRelocName("R_LARCH_TLS_DTPREL64"), 8},
+		10:  {elfRelocName("R_LARCH_TLS_TPREL32"), 4},
+		11:  {elfRelocName("R_LARCH_TLS_TPREL64"), 8},
+		12:  {elfRelocName("R_LARCH_IRELATIVE"), 8},
+		47:  {elfRelocName("R_LARCH_ADD8"), 1},
+		48:  {elfRelocName("R_LARCH_ADD16"), 2},
+		49:  {elfRelocName("R_LARCH_ADD24"), 3},
+		50:  {elfRelocName("R_LARCH_ADD32"), 4},
+		51:  {elfRelocName("R_LARCH_ADD64"), 8},
+		52:  {elfRelocName("R_LARCH_SUB8"), 1},
+		53:  {elfRelocName("R_LARCH_SUB16"), 2},
+		54:  {elfRelocName("R_LARCH_SUB24"), 3},
+		55:  {elfRelocName("R_LARCH_SUB32"), 4},
+		56:  {elfRelocName("R_LARCH_SUB64"), 8},
+		64:  {elfRelocName("R_LARCH_B16"), 4},
+		65:  {elfRelocName("R_LARCH_B21"), 4},
+		66:  {elfRelocName("R_LARCH_B26"), 4},
+		67:  {elfRelocName("R_LARCH_ABS_HI20"), 4},
+		68:  {elfRelocName("R_LARCH_ABS_LO12"), 4},
+		69:  {elfRelocName("R_LARCH_ABS64_LO20"), 4},
+		70:  {elfRelocName("R_LARCH_ABS64_HI12"), 4},
+		71:  {elfRelocName("R_LARCH_PCALA_HI20"), 4},
+		72:  {elfRelocName("R_LARCH_PCALA_LO12"), 4},
+		73:  {elfRelocName("R_LARCH_PCALA64_LO20"), 4},
+		74:  {elfRelocName("R_LARCH_PCALA64_HI12"), 4},
+		75:  {elfRelocName("R_LARCH_GOT_PC_HI20"), 4},
+		76:  {elfRelocName("R_LARCH_GOT_PC_LO12"), 4},
+		77:  {elfRelocName("R_LARCH_GOT64_PC_LO20"), 4},
+		78:  {elfRelocName("R_LARCH_GOT64_PC_HI12"), 4},
+		79:  {elfRelocName("R_LARCH_GOT_HI20"), 4},
+		80:  {elfRelocName("R_LARCH_GOT_LO12"), 4},
+		81:  {elfRelocName("R_LARCH_GOT64_LO20"), 4},
+		82:  {elfRelocName("R_LARCH_GOT64_HI12"), 4},
+		83:  {elfRelocName("R_LARCH_TLS_LE_HI20"), 4},
+		84:  {elfRelocName("R_LARCH_TLS_LE_LO12"), 4},
+		85:  {elfRelocName("R_LARCH_TLS_LE64_LO20"), 4},
+		86:  {elfRelocName("R_LARCH_TLS_LE64_HI12"), 4},
+		87:  {elfRelocName("R_LARCH_TLS_IE_PC_HI20"), 4},
+		88:  {elfRelocName("R_LARCH_TLS_IE_PC_LO12"), 4},
+		89:  {elfRelocName("R_LARCH_TLS_IE64_PC_LO20"), 4},
+		90:  {elfRelocName("R_LARCH_TLS_IE64_PC_HI12"), 4},
+		91:  {elfRelocName("R_LARCH_TLS_IE_HI20"), 4},
+		92:  {elfRelocName("R_LARCH_TLS_IE_LO12"), 4},
+		93:  {elfRelocName("R_LARCH_TLS_IE64_LO20"), 4},
+		94:  {elfRelocName("R_LARCH_TLS_IE64_HI12"), 4},
+		95:  {elfRelocName("R_LARCH_TLS_LD_PC_HI20"), 4},
+		96:  {elfRelocName("R_LARCH_TLS_LD_HI20"), 4},
+		97:  {elfRelocName("R_LARCH_TLS_GD_PC_HI20"), 4},
+		98:  {elfRelocName("R_LARCH_TLS_GD_HI20"), 4},
+		99:  {elfRelocName("R_LARCH_32_PCREL"), 4},
+		100: {elfRelocName("R_LARCH_RELAX"), 0},
+		102: {elfRelocName("R_LARCH_ALIGN"), 0},
+		103: {elfRelocName("R_LARCH_PCREL20_S2"), 4},
+		105: {elfRelocName("R_LARCH_ADD6"), 1},
+		106: {elfRelocName("R_LARCH_SUB6"), 1},
+		109: {elfRelocName("R_LARCH_64_PCREL"), 8},
+		110: {elfRelocName("R_LARCH_CALL36"), 8},
+	},
+}
+
+// elfMachineLoongArch is EM_LOONGARCH, which debug/elf doesn't define
+// before Go 1.19.
+const elfMachineLoongArch elf.Machine = 258
+
+// elfRelocName is a relocation type debug/elf doesn't define.
+type elfRelocName string
+
+func (n elfRelocName) String() string {
+	return string(n)
+}
+
+// elfRelSection is a decoded SHT_REL[A] section.
+type elfRelSection struct {
+	elf  *elf.File
+	sect *elf.Section // SHT_REL[A] section
+
+	// baseSymID is the global symbol index of the first symbol in
+	// this relocation section's symbol table.
+	baseSymID SymID
+
+	load  sync.Once
+	relas []elf.Rela64 // Sorted by offset
+	err   error
+}
+
+// get returns the relocations in this section that apply to [addr,
+// addr+size). The section is decoded on first use and kept, unless
+// fresh is set, in which case it's decoded again and the result
+// doesn't share memory with anything else.
+func (r *elfRelSection) get(addr, size uint64, fresh bool) ([]elf.Rela64, error) {
+	var relas []elf.Rela64
+	if fresh {
+		var err error
+		if relas, err = r.decode(); err != nil {
+			return nil, err
+		}
+	} else {
+		r.load.Do(func() { r.relas, r.err = r.decode() })
+		if r.err != nil {
+			return nil, r.err
+		}
+		relas = r.relas
+	}
+
+	// Find the relocations for this region. This is only used for
+	// whole sections, so we don't have to worry about relocations
+	// that partially overlap the region.
+	start := sort.Search(len(relas), func(i int) bool {
+		return relas[i].Off >= addr
+	})
+	end := sort.Search(len(relas), func(i int) bool {
+		return relas[i].Off >= addr+size
+	})
+	if fresh {
+		return append([]elf.Rela64(nil), relas[start:end]...), nil
+	}
+	return relas[start:end], nil
+}
+
+// decode decodes this relocation section, sorted by offset.
+func (r *elfRelSection) decode() ([]elf.Rela64, error) {
+	o := r.elf.ByteOrder
+
+	data, err := r.sect.Data()
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse and canonicalize the relocations in rela64s.
+	var relas []elf.Rela64
+	switch {
+	case r.sect.Type == elf.SHT_REL && r.elf.Class == elf.ELFCLASS32:
+		relas = elfReadRel32(data, o)
+	case r.sect.Type == elf.SHT_REL && r.elf.Class == elf.ELFCLASS64:
+		relas = elfReadRel64(data, o)
+	case r.sect.Type == elf.SHT_RELA && r.elf.Class == elf.ELFCLASS32:
+		relas = elfReadRela32(data, o)
+	case r.sect.Type == elf.SHT_RELA && r.elf.Class == elf.ELFCLASS64:
+		relas = elfReadRela64(data, o)
+	default:
+		// We shouldn't have created an elfRelSection
+		// for this at all.
+		panic("unexpected relocation section type")
+	}
+
+	if r.elf.Machine == elf.EM_MIPS && r.elf.Class == elf.ELFCLASS64 {
+		elfMIPS64Info(relas, o)
+	}
+
+	// Sort relocations by address for fast lookup and
+	// range slicing.
+	sort.Slice(relas, func(i, j int) bool { return relas[i].Off < relas[j].Off })
+	return relas, nil
+}
+
+// elfMIPS64Info canonicalizes the info fields of MIPS64 relocations.
+// MIPS64 splits r_info into a 32-bit symbol index followed by an
+// 8-bit special symbol and three 8-bit types, so reading it as a
+// 64-bit word gives a different layout in each byte order. This
+// keeps only the first type, which is the one that matters for Go
+// and most C binaries.
+func elfMIPS64Info(relas []elf.Rela64, o binary.ByteOrder) {
+	for i := range relas {
+		info := relas[i].Info
+		if o == binary.BigEndian {
+			relas[i].Info = elf.R_INFO(uint32(info>>32), uint32(info&0xff))
+		} else {
+			relas[i].Info = elf.R_INFO(uint32(info), uint32(info>>56))
+		}
+	}
+}
+
+func elfReadRel32(data []byte, o binary.ByteOrder) []elf.Rela64 {
+	var out []elf.Rela64
+	for len(data) >= 8 {
+		off := o.Uint32(data)
+		info := o.Uint32(data[4:])
+		info64 := elf.R_INFO(elf.R_SYM32(info), elf.R_TYPE32(info))
+		data = data[8:]
+		out = append(out, elf.Rela64{uint64(off), info64, 0})
+	}
+	return out
+}
+
+func elfReadRel64(data []byte, o binary.ByteOrder) []elf.Rela64 {
+	var out []elf.Rela64
+	for len(data) >= 16 {
+		off := o.Uint64(data)
+		info := o.Uint64(data[8:])
+		data = data[16:]
+		out = append(out, elf.Rela64{off, info, 0})
+	}
+	return out
+}
+
+func elfReadRela32(data []byte, o binary.ByteOrder) []elf.Rela64 {
+	var out []elf.Rela64
+	for len(data) >= 12 {
+		off := o.Uint32(data)
+		info := o.Uint32(data[4:])
+		info64 := elf.R_INFO(elf.R_SYM32(info), elf.R_TYPE32(info))
+		add := int32(o.Uint32(data[8:]))
+		data = data[12:]
+		out = append(out, elf.Rela64{uint64(off), info64, int64(add)})
+	}
+	return out
+}
+
+func elfReadRela64(data []byte, o binary.ByteOrder) []elf.Rela64 {
+	var out []elf.Rela64
+	for len(data) >= 24 {
+		off := o.Uint64(data)
+		info := o.Uint64(data[8:])
+		add := int64(o.Uint64(data[16:]))
+		data = data[24:]
+		out = append(out, elf.Rela64{off, info, add})
+	}
+	return out
+}
+
+func (f *elfFile) sectRelocs(sect *elf.Section, ptr, size uint64) (*elfRelocs, error) {
+	s := f.sections[sect]
+	if s == nil || len(s.relocs.srcs) == 0 {
+		return nil, nil
+	}
+	rs, err := f.loadRelocs(s)
+	if err != nil {
+		return nil, err
+	}
+	relas := rs.relas
+
+	// Position the iterator at the first relocation that overlaps
+	// this range. Since relocations have different sizes, we
+	// binary search for the first that *could* overlap it, the
+	// linearly trim until we get a real overlap.
+	types := elfRelocTypes[f.elf.Machine]
+	start := sort.Search(len(relas), func(i int) bool {
+		return relas[i].Off+elfRelocMaxSize >= ptr
+	})
+	for ; start < len(relas); start++ {
+		sz := types[elf.R_TYPE64(relas[start].Info)].size
+		if relas[start].Off+uint64(sz) >= ptr {
+			break
+		}
+	}
+	// Find the iterator end.
+	end := sort.Search(len(relas), func(i int) bool {
+		return relas[i].Off >= ptr+size
+	})
+	if end < start {
+		end = start
+	}
+	relas = relas[start:end]
+
+	// Slice the base SymIDs likewise.
+	var baseSymIDs []SymID
+	if rs.baseSymIDs != nil {
+		baseSymIDs = rs.baseSymIDs[start:end]
+	}
+
+	return &elfRelocs{types, relas, rs.baseSymID, baseSymIDs}, nil
+}
+
+// loadRelocs returns the decoded relocations that apply to s. They're
+// kept for the life of f or, if f has a cache, in the cache.
+func (f *elfFile) loadRelocs(s *elfSection) (*elfSectRelocs, error) {
+	if f.cache == nil {
+		s.relocs.load.Do(func() {
+			s.relocs.loaded, s.relocs.err = s.decodeRelocs(false)
+		})
+		return s.relocs.loaded, s.relocs.err
+	}
+	if v, ok := f.cache.Get(s); ok {
+		return v.(*elfSectRelocs), nil
+	}
+	rs, err := s.decodeRelocs(true)
+	if err != nil {
+		return nil, err
+	}
+	// An elf.Rela64 is 24 bytes, and a SymID is at most 8.
+	f.cache.Add(s, rs, int64(len(rs.relas))*24+int64(len(rs.baseSymIDs))*8)
+	return rs, nil
+}
+
+// decodeRelocs decodes and merges the relocations that apply to s. If
+// fresh is set, the result doesn't share memory with the decoded
+// relocation sections, which aren't kept.
+func (s *elfSection) decodeRelocs(fresh bool) (*elfSectRelocs, error) {
+	var all [][]elf.Rela64
+	var baseSymID []SymID
+	for _, src := range s.relocs.srcs {
+		relas, err := src.get(s.sect.Addr, s.sect.Size, fresh)
+		if err != nil {
+			return nil, err
+		}
+		if len(relas) > 0 {
+			all = append(all, relas)
+			baseSymID = append(baseSymID, src.baseSymID)
+		}
+	}
+
+	// In the common case, there's only one applicable relas
+	// slice, and we can use it directly.
+	switch len(all) {
+	case 0:
+		return &elfSectRelocs{}, nil
+	case 1:
+		return &elfSectRelocs{relas: all[0], baseSymID: baseSymID[0]}, nil
+	}
+	// Merge the relocations.
+	var relas []elf.Rela64
+	var baseSymIDs []SymID
+	for i, a := range all {
+		relas = append(relas, a...)
+		for range a {
+			baseSymIDs = append(baseSymIDs, baseSymID[i])
+		}
+	}
+	sort.Sort(&elfRelaSorter{relas, baseSymIDs})
+	return &elfSectRelocs{relas: relas, baseSymIDs: baseSymIDs}, nil
+}
+
+type elfRelaSorter struct {
+	relas      []elf.Rela64
+	baseSymIDs []SymID
+}
+
+func (s *elfRelaSorter) Len() int           { return len(s.relas) }
+func (s *elfRelaSorter) Less(i, j int) bool { return s.relas[i].Off < s.relas[j].Off }
+func (s *elfRelaSorter) Swap(i, j int) {
+	s.relas[i], s.relas[j] = s.relas[j], s.relas[i]
+	s.baseSymIDs[i], s.baseSymIDs[j] = s.baseSymIDs[j], s.baseSymIDs[i]
+}
+
+type elfRelocs struct {
+	types      map[uint32]elfRelocType
+	relas      []elf.Rela64
+	baseSymID  SymID
+	baseSymIDs []SymID
+}
+
+func (rs *elfRelocs) Len() int {
+	return len(rs.relas)
+}
+
+func (rs *elfRelocs) Get(i int, r *Reloc) {
+	rela := rs.relas[i]
+
+	sym, typ := elf.R_SYM64(rela.Info), elf.R_TYPE64(rela.Info)
+	ert, ok := rs.types[typ]
+	if !ok {
+		ert.typ = unknownRelocType{int(typ)}
+	}
+
+	symID := SymID(-1)
+	if sym != 0 {
+		// baseSymID is symbol 1 in the section.
+		if rs.baseSymIDs != nil {
+			symID = rs.baseSymIDs[i] + SymID(sym) - 1
+		} else {
+			symID = rs.baseSymID + SymID(sym) - 1
+		}
+	}
+
+	*r = Reloc{rela.Off, ert.size, ert.typ, symID, rela.Addend}
+}
@@ -0,0 +1,117 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package obj
+
+import (
+	"debug/elf"
+	"fmt"
+)
+
+// ELFSegment is a program header of an ELF file.
+type ELFSegment struct {
+	// Type is the segment type, such as "PT_LOAD".
+	Type string
+	Addr uint64
+	// Offset is the segment's offset in the file.
+	Offset   uint64
+	MemSize  uint64
+	FileSize uint64
+	Read     bool
+	Write    bool
+	Exec     bool
+}
+
+// ReadELFSegments returns the program headers of o, or false if o
+// isn't an ELF file. Relocatable objects have no program headers.
+func ReadELFSegments(o Obj) ([]ELFSegment, bool) {
+	if d, ok := o.(*debugObj); ok {
+		o = d.Obj
+	}
+	f, ok := o.(*elfFile)
+	if !ok {
+		return nil, false
+	}
+	segs := make([]ELFSegment, len(f.elf.Progs))
+	for i, p := range f.elf.Progs {
+		segs[i] = ELFSegment{
+			Type:     p.Type.String(),
+			Addr:     p.Vaddr,
+			Offset:   p.Off,
+			MemSize:  p.Memsz,
+			FileSize: p.Filesz,
+			Read:     p.Flags&elf.PF_R != 0,
+			Write:    p.Flags&elf.PF_W != 0,
+			Exec:     p.Flags&elf.PF_X != 0,
+		}
+	}
+	return segs, true
+}
+
+// elfDynValues returns the values of the given tag in f's dynamic
+// section. debug/elf only decodes string-valued tags.
+func elfDynValues(f *elf.File, tag elf.DynTag) ([]uint64, error) {
+	ds := f.SectionByType(elf.SHT_DYNAMIC)
+	if ds == nil {
+		return nil, nil
+	}
+	data, err := ds.Data()
+	if err != nil {
+		return nil, err
+	}
+	var vals []uint64
+	o := f.ByteOrder
+	for len(data) > 0 {
+		var t elf.DynTag
+		var v uint64
+		switch f.Class {
+		case elf.ELFCLASS32:
+			if len(data) < 8 {
+				return vals, fmt.Errorf("%s: truncated entry", ds.Name)
+			}
+			t, v = elf.DynTag(int32(o.Uint32(data))), uint64(o.Uint32(data[4:]))
+			data = data[8:]
+		case elf.ELFCLASS64:
+			if len(data) < 16 {
+				return vals, fmt.Errorf("%s: truncated entry", ds.Name)
+			}
+			t, v = elf.DynTag(o.Uint64(data)), o.Uint64(data[8:])
+			data = data[16:]
+		default:
+			return nil, fmt.Errorf("unknown ELF class %s", f.Class)
+		}
+		if t == elf.DT_NULL {
+			break
+		}
+		if t == tag {
+			vals = append(vals, v)
+		}
+	}
+	return vals, nil
+}
+
+// elfBindNow reports whether the dynamic linker resolves all of f's
+// symbols at load time, which lets it make the whole GOT read-only.
+func elfBindNow(f *elf.File) (bool, error) {
+	const DF_1_NOW = 0x1 // Not in debug/elf as of Go 1.14.
+	for _, q := range []struct {
+		tag  elf.DynTag
+		mask uint64
+	}{
+		{elf.DT_BIND_NOW, 0},
+		{elf.DT_FLAGS, uint64(elf.DF_BIND_NOW)},
+		{elf.DT_FLAGS_1, DF_1_NOW},
+	} {
+		vals, err := elfDynValues(f, q.tag)
+		if err != nil {
+			return false, err
+		}
+		for _, v := range vals {
+			if q.mask == 0 || v&q.mask != 0 {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,267 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package obj
+
+import (
+	"bytes"
+	"debug/elf"
+	"fmt"
+	"strings"
+)
+
+// ELFDynamic describes how an ELF file is dynamically linked: the
+// libraries it needs and the GNU symbol versions it defines and
+// requires.
+type ELFDynamic struct {
+	// SOName is the file's DT_SONAME, if it's a shared library.
+	SOName string
+	// Needed lists the DT_NEEDED libraries, in load order.
+	Needed []string
+	// RPath and RunPath are the library search paths.
+	RPath, RunPath []string
+	// BindNow indicates the dynamic linker resolves all symbols at
+	// load time, so full RELRO can protect the GOT.
+	BindNow bool
+
+	// VersionDefs are the versions the file defines, from
+	// .gnu.version_d.
+	VersionDefs []ELFVersionDef
+	// VersionNeeds are the versions the file requires of each
+	// library, from .gnu.version_r.
+	VersionNeeds []ELFVersionNeed
+
+	// Errors lists problems found decoding the version tables.
+	Errors []string
+}
+
+// ELFVersionDef is a version defined by an ELF file.
+type ELFVersionDef struct {
+	Index uint16
+	Name  string
+	// Base indicates this definition names the file itself
+	// rather than a version of its symbols.
+	Base bool
+	Weak bool
+	// Parents are the versions this version inherits from.
+	Parents []string
+}
+
+// ELFVersionNeed is the set of versions an ELF file requires of a
+// library.
+type ELFVersionNeed struct {
+	File     string
+	Versions []ELFVersionNeedAux
+}
+
+// ELFVersionNeedAux is a version required of a library.
+type ELFVersionNeedAux struct {
+	Index uint16
+	Name  string
+	// Weak indicates the version is only needed if it's present.
+	Weak bool
+}
+
+const (
+	elfVerFlagBase = 0x1 // VER_FLG_BASE
+	elfVerFlagWeak = 0x2 // VER_FLG_WEAK
+
+	elfVersymHidden = 0x8000
+)
+
+// elfSymVersion is the version of a dynamic symbol.
+type elfSymVersion struct {
+	name    string
+	library string
+	hidden  bool
+}
+
+// elfVersions decodes the GNU version tables of f.
+type elfVersions struct {
+	defs   []ELFVersionDef
+	needs  []ELFVersionNeed
+	errors []string
+
+	// syms is the version of each dynamic symbol, indexed like
+	// DynamicSymbols, or nil if f has no version tables.
+	syms []elfSymVersion
+}
+
+func readELFVersions(f *elf.File) *elfVersions {
+	v := new(elfVersions)
+	byIndex := make(map[uint16]elfSymVersion)
+	var versym *elf.Section
+	for _, sect := range f.Sections {
+		switch sect.Type {
+		case elf.SHT_GNU_VERSYM:
+			versym = sect
+		case elf.SHT_GNU_VERDEF:
+			v.readDefs(f, sect, byIndex)
+		case elf.SHT_GNU_VERNEED:
+			v.readNeeds(f, sect, byIndex)
+		}
+	}
+	if versym == nil {
+		return v
+	}
+	data, err := versym.Data()
+	if err != nil {
+		v.errors = append(v.errors, fmt.Sprintf("%s: %v", versym.Name, err))
+		return v
+	}
+	// The version table has an entry for every dynamic symbol,
+	// including the null symbol, which DynamicSymbols omits.
+	for i := 2; i+2 <= len(data); i += 2 {
+		x := f.ByteOrder.Uint16(data[i:])
+		sv := byIndex[x&^elfVersymHidden]
+		// Only definitions have default versions.
+		sv.hidden = x&elfVersymHidden != 0 && sv.library == ""
+		v.syms = append(v.syms, sv)
+	}
+	return v
+}
+
+// strtab returns a function that reads strings from the string
+// table linked from sect.
+func (v *elfVersions) strtab(f *elf.File, sect *elf.Section) func(off uint32) string {
+	var data []byte
+	if int(sect.Link) < len(f.Sections) {
+		var err error
+		data, err = f.Sections[sect.Link].Data()
+		if err != nil {
+			v.errors = append(v.errors, fmt.Sprintf("%s: %v", f.Sections[sect.Link].Name, err))
+		}
+	}
+	return func(off uint32) string {
+		if int(off) >= len(data) {
+			return ""
+		}
+		s := data[off:]
+		if i := bytes.IndexByte(s, 0); i >= 0 {
+			s = s[:i]
+		}
+		return string(s)
+	}
+}
+
+func (v *elfVersions) readDefs(f *elf.File, sect *elf.Section, byIndex map[uint16]elfSymVersion) {
+	data, err := sect.Data()
+	if err != nil {
+		v.errors = append(v.errors, fmt.Sprintf("%s: %v", sect.Name, err))
+		return
+	}
+	str := v.strtab(f, sect)
+	o := f.ByteOrder
+	// Follow the chain of Elf_Verdef entries, bounding it by the
+	// section size in case it loops.
+	for off, n := 0, 0; n < len(data)/20; n++ {
+		if off < 0 || off+20 > len(data) {
+			v.errors = append(v.errors, fmt.Sprintf("%s: entry at %#x out of bounds", sect.Name, off))
+			return
+		}
+		d := data[off:]
+		flags, ndx, cnt := o.Uint16(d[2:]), o.Uint16(d[4:]), o.Uint16(d[6:])
+		aux, next := o.Uint32(d[12:]), o.Uint32(d[16:])
+		def := ELFVersionDef{Index: ndx, Base: flags&elfVerFlagBase != 0, Weak: flags&elfVerFlagWeak != 0}
+		// The first Elf_Verdaux names the version and the rest
+		// name its parents.
+		for a, i := off+int(aux), 0; i < int(cnt); i++ {
+			if a < 0 || a+8 > len(data) {
+				v.errors = append(v.errors, fmt.Sprintf("%s: aux entry at %#x out of bounds", sect.Name, a))
+				break
+			}
+			name := str(o.Uint32(data[a:]))
+			if i == 0 {
+				def.Name = name
+			} else {
+				def.Parents = append(def.Parents, name)
+			}
+			a += int(o.Uint32(data[a+4:]))
+		}
+		v.defs = append(v.defs, def)
+		if !def.Base {
+			byIndex[ndx] = elfSymVersion{name: def.Name}
+		}
+		if next == 0 {
+			return
+		}
+		off += int(next)
+	}
+}
+
+func (v *elfVersions) readNeeds(f *elf.File, sect *elf.Section, byIndex map[uint16]elfSymVersion) {
+	data, err := sect.Data()
+	if err != nil {
+		v.errors = append(v.errors, fmt.Sprintf("%s: %v", sect.Name, err))
+		return
+	}
+	str := v.strtab(f, sect)
+	o := f.ByteOrder
+	for off, n := 0, 0; n < len(data)/16; n++ {
+		if off < 0 || off+16 > len(data) {
+			v.errors = append(v.errors, fmt.Sprintf("%s: entry at %#x out of bounds", sect.Name, off))
+			return
+		}
+		d := data[off:]
+		cnt := o.Uint16(d[2:])
+		need := ELFVersionNeed{File: str(o.Uint32(d[4:]))}
+		aux, next := o.Uint32(d[8:]), o.Uint32(d[12:])
+		for a, i := off+int(aux), 0; i < int(cnt); i++ {
+			if a < 0 || a+16 > len(data) {
+				v.errors = append(v.errors, fmt.Sprintf("%s: aux entry at %#x out of bounds", sect.Name, a))
+				break
+			}
+			flags, other := o.Uint16(data[a+4:]), o.Uint16(data[a+6:])
+			vers := ELFVersionNeedAux{Index: other, Name: str(o.Uint32(data[a+8:])), Weak: flags&elfVerFlagWeak != 0}
+			need.Versions = append(need.Versions, vers)
+			byIndex[other] = elfSymVersion{name: vers.Name, library: need.File}
+			a += int(o.Uint32(data[a+12:]))
+		}
+		v.needs = append(v.needs, need)
+		if next == 0 {
+			return
+		}
+		off += int(next)
+	}
+}
+
+// ReadELFDynamic returns the dynamic linking information of o, or
+// false if o isn't an ELF file.
+func ReadELFDynamic(o Obj) (*ELFDynamic, bool) {
+	if d, ok := o.(*debugObj); ok {
+		o = d.Obj
+	}
+	f, ok := o.(*elfFile)
+	if !ok {
+		return nil, false
+	}
+	d := &ELFDynamic{
+		VersionDefs:  f.vers.defs,
+		VersionNeeds: f.vers.needs,
+		Errors:       append([]string(nil), f.vers.errors...),
+	}
+	dynStrings := func(tag elf.DynTag) []string {
+		ss, err := f.elf.DynString(tag)
+		if err != nil {
+			d.Errors = append(d.Errors, fmt.Sprintf("%s: %v", tag, err))
+		}
+		return ss
+	}
+	if ss := dynStrings(elf.DT_SONAME); len(ss) > 0 {
+		d.SOName = ss[0]
+	}
+	d.Needed = dynStrings(elf.DT_NEEDED)
+	for _, p := range dynStrings(elf.DT_RPATH) {
+		d.RPath = append(d.RPath, strings.Split(p, ":")...)
+	}
+	for _, p := range dynStrings(elf.DT_RUNPATH) {
+		d.RunPath = append(d.RunPath, strings.Split(p, ":")...)
+	}
+	bindNow, err := elfBindNow(f.elf)
+	if err != nil {
+		d.Errors = append(d.Errors, err.Error())
+	}
+	d.BindNow = bindNow
+	return d, true
+}
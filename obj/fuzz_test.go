@@ -0,0 +1,68 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package obj
+
+import (
+	"bytes"
+	"testing"
+)
+
+// FuzzOpen checks that malformed object files produce errors rather
+// than panics. The seed corpus in testdata/fuzz/FuzzOpen has small
+// ELF, PE, and TE files.
+func FuzzOpen(f *testing.F) {
+	f.Fuzz(func(t *testing.T, data []byte) {
+		o, err := Open(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		walk(o)
+	})
+}
+
+// walk reads everything in o.
+func walk(o Obj) {
+	o.Info()
+	for i, s := range o.Sections() {
+		if d, err := o.SectionData(i); err == nil {
+			walkRelocs(d.R)
+		}
+		o.Data(s.Addr, s.Size)
+	}
+	if syms, err := o.Symbols(); err == nil {
+		var sym Sym
+		for i := SymID(0); i < syms.Len(); i++ {
+			syms.Get(i, &sym)
+			if d, err := o.SymbolData(i); err == nil {
+				walkRelocs(d.R)
+			}
+		}
+	}
+	if dw, err := o.DWARF(); err == nil {
+		r := dw.Reader()
+		for {
+			e, err := r.Next()
+			if err != nil || e == nil {
+				break
+			}
+		}
+	}
+	ReadPEHeaders(o)
+	BuildID(o)
+	DebugLink(o)
+}
+
+func walkRelocs(rs Relocs) {
+	var r Reloc
+	for i := 0; i < rs.Len(); i++ {
+		rs.Get(i, &r)
+		if r.Type != nil {
+			_ = r.Type.String()
+		}
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package obj
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aclements/objbrowse/internal/golden"
+)
+
+// goldenObj is what TestGolden records about an object file.
+type goldenObj struct {
+	Error     string          `json:",omitempty"`
+	Arch      string          `json:",omitempty"`
+	Format    string          `json:",omitempty"`
+	PIE       bool            `json:",omitempty"`
+	Reloc     bool            `json:",omitempty"`
+	BuildID   string          `json:",omitempty"`
+	DebugLink string          `json:",omitempty"`
+	Sections  []goldenSection `json:",omitempty"`
+	Symbols   []string        `json:",omitempty"`
+	SymError  string          `json:",omitempty"`
+	Units     []string        `json:",omitempty"`
+}
+
+type goldenSection struct {
+	Name   string
+	Addr   string
+	Size   uint64
+	Flags  string   `json:",omitempty"`
+	Zero   bool     `json:",omitempty"`
+	Relocs []string `json:",omitempty"`
+}
+
+// TestGolden checks what Open reads from each file of the object
+// file corpus against testdata/golden.
+func TestGolden(t *testing.T) {
+	for _, path := range golden.Files(t, filepath.Join("..", "testdata", "corpus")) {
+		name := filepath.Base(path)
+		t.Run(name, func(t *testing.T) {
+			g := describe(t, path)
+			golden.CheckJSON(t, filepath.Join("testdata", "golden", name+".json"), g)
+		})
+	}
+}
+
+func describe(t *testing.T, path string) *goldenObj {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	o, err := Open(f)
+	if err != nil {
+		return &goldenObj{Error: err.Error()}
+	}
+
+	var g goldenObj
+	info := o.Info()
+	if info.Arch != nil {
+		g.Arch = info.Arch.GoArch
+	}
+	g.Format, g.PIE, g.Reloc = info.Format, info.PIE, info.Relocatable
+	if id, ok := BuildID(o); ok {
+		g.BuildID = fmt.Sprintf("%x", id)
+	}
+	if name, crc, ok := DebugLink(o); ok {
+		g.DebugLink = fmt.Sprintf("%s %08x", name, crc)
+	}
+
+	syms, err := o.Symbols()
+	if err != nil {
+		g.SymError = err.Error()
+	}
+	symName := func(id SymID) string {
+		if id < 0 || syms == nil || id >= syms.Len() {
+			return fmt.Sprint(id)
+		}
+		var s Sym
+		syms.Get(id, &s)
+		if s.Name == "" && s.Section >= 0 {
+			// Name section symbols after their section.
+			return o.Sections()[s.Section].Name
+		}
+		return s.Name
+	}
+
+	for i, s := range o.Sections() {
+		gs := goldenSection{Name: s.Name, Addr: fmt.Sprintf("%#x", s.Addr), Size: s.Size, Flags: s.Flags.String(), Zero: s.Zero}
+		d, err := o.SectionData(i)
+		if err != nil {
+			gs.Relocs = []string{err.Error()}
+		} else {
+			var r Reloc
+			for j := 0; j < d.R.Len(); j++ {
+				d.R.Get(j, &r)
+				gs.Relocs = append(gs.Relocs, fmt.Sprintf("%#x %d %v %s%+d", r.Offset, r.Size, r.Type, symName(r.Symbol), r.Addend))
+			}
+		}
+		g.Sections = append(g.Sections, gs)
+	}
+
+	if syms != nil {
+		var s Sym
+		for i := SymID(0); i < syms.Len(); i++ {
+			syms.Get(i, &s)
+			attrs := ""
+			if s.Local {
+				attrs += " local"
+			}
+			if s.Weak {
+				attrs += " weak"
+			}
+			if s.Dynamic {
+				attrs += " dynamic"
+			}
+			if s.Synthetic {
+				attrs += " synthetic"
+			}
+			if s.Visibility != SymDefault {
+				attrs += " " + s.Visibility.String()
+			}
+			g.Symbols = append(g.Symbols, fmt.Sprintf("%#x %d %c %s%s", s.Value, s.Size, s.Kind, s.Name, attrs))
+		}
+	}
+
+	if dw, err := o.DWARF(); err == nil {
+		r := dw.Reader()
+		for {
+			e, err := r.Next()
+			if err != nil {
+				g.Units = append(g.Units, err.Error())
+				break
+			}
+			if e == nil {
+				break
+			}
+			if e.Tag == dwarf.TagCompileUnit {
+				name, _ := e.Val(dwarf.AttrName).(string)
+				g.Units = append(g.Units, name)
+			}
+			r.SkipChildren()
+		}
+	}
+	return &g
+}
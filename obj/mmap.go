@@ -0,0 +1,150 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package obj
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// maxMapSize limits the size of file Mmap will map: 1 GiB on 32-bit
+// systems, which leaves room in the address space for everything
+// else, and 1 TiB on 64-bit systems.
+const maxMapSize = int64(^uint(0)>>2) & (1<<40 - 1)
+
+// errUnmapped is returned by reads from a MappedFile after it has
+// been unmapped.
+var errUnmapped = errors.New("read from unmapped file")
+
+// A MappedFile is a file mapped read-only into memory. When Open
+// reads an object from a MappedFile, section and symbol data refer
+// directly to the mapping rather than being copied, so only the parts
+// of a file that are used occupy memory, and the OS can reclaim them
+// under memory pressure. This also lifts the limit on the size of a
+// single section's data, which otherwise applies because the data is
+// copied.
+//
+// Data from a MappedFile is read-only: writing to it faults.
+//
+// A MappedFile is reference counted. Mmap returns it with one
+// reference, which Close releases. Each Obj opened from it holds
+// another reference until the Obj is closed with the package's Close
+// function, so Data from the Obj remains valid until then. The file
+// is unmapped when the last reference is released, after which
+// reading Data from it faults.
+type MappedFile struct {
+	mu   sync.Mutex
+	data []byte
+	refs int
+}
+
+// Mmap maps f into memory. It returns an error if f is too large to
+// map or the system doesn't support mapping files, in which case the
+// caller can read f directly instead. f may be closed once Mmap
+// returns.
+func Mmap(f *os.File) (*MappedFile, error) {
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := st.Size()
+	if size > maxMapSize {
+		return nil, fmt.Errorf("%s: %d bytes is too large to map", f.Name(), size)
+	}
+	m := &MappedFile{refs: 1}
+	if size > 0 {
+		if m.data, err = mmap(f, int(size)); err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name(), err)
+		}
+	}
+	return m, nil
+}
+
+// Len returns the size of the mapped file.
+func (m *MappedFile) Len() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return int64(len(m.data))
+}
+
+// ReadAt copies the data at off in the file to p.
+func (m *MappedFile) ReadAt(p []byte, off int64) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.refs == 0 {
+		return 0, errUnmapped
+	}
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if off >= int64(len(m.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, m.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Close releases the reference returned by Mmap.
+func (m *MappedFile) Close() error {
+	return m.release()
+}
+
+// slice returns the n bytes at off in the mapping, without copying
+// them. It returns false if they aren't all in the file.
+func (m *MappedFile) slice(off int64, n uint64) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.refs == 0 || off < 0 || off > int64(len(m.data)) || n > uint64(int64(len(m.data))-off) {
+		return nil, false
+	}
+	return m.data[off : off+int64(n) : off+int64(n)], true
+}
+
+// retain adds a reference to m for ref.
+func (m *MappedFile) retain(ref *mapRef) {
+	m.mu.Lock()
+	m.refs++
+	m.mu.Unlock()
+	ref.m = m
+}
+
+func (m *MappedFile) release() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.refs == 0 {
+		return errors.New("MappedFile released too many times")
+	}
+	m.refs--
+	if m.refs > 0 || m.data == nil {
+		return nil
+	}
+	data := m.data
+	m.data = nil
+	return munmap(data)
+}
+
+// A mapRef is an Obj's reference to the MappedFile it was opened
+// from, if any.
+type mapRef struct {
+	once sync.Once
+	m    *MappedFile
+}
+
+// close releases the reference. Later calls do nothing.
+func (r *mapRef) close() error {
+	var err error
+	r.once.Do(func() {
+		if r.m != nil {
+			err = r.m.release()
+		}
+	})
+	return err
+}
@@ -0,0 +1,91 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package obj
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func mmapTest(t *testing.T, name string) (*MappedFile, *os.File) {
+	f, err := os.Open(filepath.Join("..", "testdata", "corpus", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	m, err := Mmap(f)
+	if err != nil {
+		t.Skip(err)
+	}
+	return m, f
+}
+
+func TestMmap(t *testing.T) {
+	for _, name := range []string{"elf-amd64-exec", "elf-386-rel", "pe-amd64"} {
+		m, f := mmapTest(t, name)
+		mo, err := Open(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The Obj keeps the mapping after Close.
+		m.Close()
+		fo, err := Open(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i, s := range fo.Sections() {
+			want, err1 := fo.SectionData(i)
+			got, err2 := mo.SectionData(i)
+			if (err1 == nil) != (err2 == nil) {
+				t.Errorf("%s: section %s: got error %v, want %v", name, s.Name, err2, err1)
+				continue
+			}
+			if !bytes.Equal(got.P, want.P) || got.R.Len() != want.R.Len() {
+				t.Errorf("%s: section %s differs when mapped", name, s.Name)
+			}
+		}
+		syms, _ := fo.Symbols()
+		for i := SymID(0); i < syms.Len(); i++ {
+			want, _ := fo.SymbolData(i)
+			got, _ := mo.SymbolData(i)
+			if !bytes.Equal(got.P, want.P) {
+				t.Errorf("%s: symbol %d differs when mapped", name, i)
+			}
+		}
+		Close(mo)
+	}
+}
+
+func TestMmapRelease(t *testing.T) {
+	m, _ := mmapTest(t, "elf-amd64-exec")
+	o, err := Open(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Close()
+
+	// The Obj's reference keeps the file mapped until it's
+	// closed.
+	var buf [4]byte
+	if _, err := m.ReadAt(buf[:], 0); err != nil {
+		t.Fatalf("reading mapping before Close: %v", err)
+	}
+	if err := Close(o); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.ReadAt(buf[:], 0); err != errUnmapped {
+		t.Fatalf("reading mapping after Close: got %v, want %v", err, errUnmapped)
+	}
+	// Closing again does nothing.
+	if err := Close(o); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+	if err := m.Close(); err == nil {
+		t.Errorf("extra Close succeeded")
+	}
+}
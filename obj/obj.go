@@ -0,0 +1,503 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package obj reads object files in several formats through a common
+// interface, Obj. It supports ELF and PE files, UEFI TE images, flat
+// binary images (see OpenRaw), and PDB debug info for PE images (see
+// OpenPDB). A Builder constructs an Obj in memory instead.
+//
+// # Addresses
+//
+// Addresses are the virtual addresses at which an object is linked to
+// load. For PE, this includes the image base. Sym.Value, Section.Addr,
+// and Data.Addr are all in this address space, and Mem.Data looks up
+// data by it. Sections that aren't loaded, like debug info, have
+// address 0.
+//
+// In a relocatable object, every section may have address 0, so an
+// address is only meaningful relative to its section. For these, use
+// Sym.Section with SymbolData or SectionData rather than Mem.Data.
+//
+// # Symbol tables
+//
+// An object file may have more than one symbol table, such as ELF's
+// static and dynamic symbol tables. Symbols combines them into a
+// single index space: the static symbols come first, then the dynamic
+// symbols (marked by Sym.Dynamic), then any symbols synthesized from
+// section contents (marked by Sym.Synthetic). In a linked ELF file,
+// synthesized symbols cover every loaded address no other symbol
+// does, so address lookups always find a symbol. The same symbol may
+// appear in more than one table. SymIDs are stable for the life of an
+// Obj, and Reloc.Symbol refers to symbols by SymID.
+//
+// # Errors
+//
+// Open returns ErrUnknownFormat if no format recognizes a file.
+// Obj.DWARF returns an error wrapping ErrNoDWARF if an object has no
+// DWARF, which callers can test with errors.Is. Out-of-range section
+// and symbol indexes produce an *IndexError. Other errors come from
+// reading the file or describe malformed input.
+//
+// An Obj is safe for concurrent use by multiple goroutines.
+package obj
+
+import (
+	"debug/dwarf"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aclements/objbrowse/arch"
+)
+
+// Data is a range of bytes from an object file and the relocations
+// that apply to them.
+type Data struct {
+	// Addr is the address at which this data starts.
+	Addr uint64
+
+	// P stores the raw byte data.
+	P []byte
+
+	// R stores the relocations applied to this Data.
+	//
+	// This may include relocations outside or partially outside
+	// of this Data's address range.
+	//
+	// This is never nil, so it's always safe to call methods on
+	// R.
+	R Relocs
+}
+
+// Mem represents a sparse memory map.
+type Mem interface {
+	// Data returns the data at ptr in the memory map. If size
+	// exceeds the size of the data at ptr, the result will be
+	// smaller than size. If ptr isn't in the memory map at all,
+	// the result's P will be nil.
+	Data(ptr, size uint64) (Data, error)
+}
+
+// TODO: Making an Obj also a Mem is not well defined for relocatable
+// files. E.g., in an unlinked object, every section can have address
+// 0. Even a fully linked object may have non-load sections that don't
+// have a defined address.
+//
+// Maybe an object is a collection of Mems? A loadable object would
+// have its loaded Mem, but every symbol could independently say which
+// Mem (segment or section) it's from and every reference could say
+// what it's against.
+//
+// Right now the only use of Mem.Data is to follow the funcdata
+// pointer. There could be a general "follow this pointer" that
+// understands some basic relocations.
+
+// An Obj is an object file.
+type Obj interface {
+	// Mem maps the object's loaded sections by address.
+	Mem
+
+	// Info returns the object's architecture and format.
+	Info() ObjInfo
+
+	// Symbols returns the object's symbols.
+	Symbols() (Symbols, error)
+
+	// SymbolData returns the contents of symbol i. If the symbol
+	// has no contents in the file, such as an undefined symbol or
+	// a symbol in a zero-filled section, the result's P is nil or
+	// zero-filled.
+	SymbolData(i SymID) (Data, error)
+
+	// Sections returns the object's sections.
+	Sections() []Section
+
+	// SectionData returns the contents of section i. A
+	// zero-filled section's contents are zeros.
+	SectionData(i int) (Data, error)
+
+	// DWARF returns the object's DWARF debug info.
+	DWARF() (*dwarf.Data, error)
+}
+
+// A Section is a contiguous region of an object file, such as an ELF
+// section. Sections are numbered by their index in Obj.Sections.
+type Section struct {
+	Name       string
+	Addr, Size uint64
+	// Zero indicates this section has no data in the file and is
+	// zero-filled when loaded, like ".bss".
+	Zero bool
+	// Align is the required alignment of this section, or 0 if
+	// unknown.
+	Align uint64
+	// Flags are how the section is loaded, or 0 if that's
+	// unknown, as for raw images.
+	Flags SectFlags
+}
+
+// SectFlags describe how a section is loaded into memory.
+type SectFlags uint8
+
+const (
+	// SectAlloc indicates the section occupies memory when the
+	// object is loaded.
+	SectAlloc SectFlags = 1 << iota
+	// SectWrite indicates the section is writable when loaded.
+	SectWrite
+	// SectExec indicates the section is executable when loaded.
+	SectExec
+)
+
+// String returns the flags like readelf, as a combination of "A",
+// "W", and "X".
+func (f SectFlags) String() string {
+	var buf [3]byte
+	s := buf[:0]
+	if f&SectAlloc != 0 {
+		s = append(s, 'A')
+	}
+	if f&SectWrite != 0 {
+		s = append(s, 'W')
+	}
+	if f&SectExec != 0 {
+		s = append(s, 'X')
+	}
+	return string(s)
+}
+
+// ObjInfo describes an object file as a whole.
+type ObjInfo struct {
+	// Arch is the machine architecture of this object file, or
+	// nil if unknown.
+	Arch *arch.Arch
+
+	// Format is the object file format, such as "elf" or "pe".
+	Format string
+
+	// PIE indicates this object is position-independent, so it
+	// may be loaded at a different address than it was linked at.
+	PIE bool
+
+	// Relocatable indicates this object hasn't been linked, so its
+	// relocations haven't been applied and its sections may not
+	// have final addresses.
+	Relocatable bool
+}
+
+// A SymID uniquely identifies a symbol within an object file. Symbols
+// within an object file are always numbered compactly from 0.
+//
+// This does not necessarily correspond to the symbol indexing scheme
+// used by a given object format.
+//
+// Some formats can have multiple symbol tables (e.g., ELF). These
+// tables will be combined in a single global index space.
+type SymID int
+
+// Symbols represents the symbol table of an object file. If an object
+// file has more than one symbol table, they will be combined.
+type Symbols interface {
+	// Len returns the number of symbols. Symbols are numbered
+	// starting at 0.
+	Len() SymID
+
+	// Get fills *s with the ith symbol.
+	Get(i SymID, s *Sym)
+}
+
+// A Sym is a symbol from an object file.
+type Sym struct {
+	Name        string
+	Value, Size uint64
+	Kind        SymKind
+	// Local indicates this symbol's name is only meaningful
+	// within its compilation unit.
+	Local bool
+	// HasAddr indicates this symbol's Value is a meaningful
+	// address in the loaded object.
+	HasAddr bool
+	// Weak indicates this symbol has weak binding, so another
+	// definition may override it at link or load time.
+	Weak bool
+	// Visibility is the symbol's visibility outside its
+	// component.
+	Visibility SymVisibility
+	// Version is the symbol's version name (for example,
+	// "GLIBC_2.2.5"), or "" if it is unversioned.
+	Version string
+	// VersionHidden indicates Version isn't the default version
+	// of the symbol's name, so it's only used by objects that were
+	// linked against it (name@VERSION rather than name@@VERSION).
+	VersionHidden bool
+	// Library is the library expected to define an undefined
+	// symbol, from its version requirement, or "" if unknown.
+	Library string
+	// Dynamic indicates this symbol came from the dynamic symbol
+	// table rather than the static symbol table.
+	Dynamic bool
+	// Synthetic indicates this symbol doesn't appear in any
+	// symbol table, but was synthesized for an item in a section,
+	// such as a string in a mergeable string section or a PLT
+	// entry, or for a range of a section no other symbol covers.
+	Synthetic bool
+	// Section is the index in Obj.Sections of the section
+	// containing this symbol, or -1 if none.
+	Section int
+	// Info and Other are the raw ELF st_info and st_other
+	// fields. They are 0 for other formats.
+	Info, Other uint8
+}
+
+// SymKind is the kind of a symbol, using nm's type letters.
+type SymKind uint8
+
+const (
+	SymUnknown  SymKind = '?'
+	SymText             = 'T'
+	SymData             = 'D'
+	SymROData           = 'R'
+	SymBSS              = 'B'
+	SymUndef            = 'U'
+	SymAbsolute         = 'A'
+)
+
+// SymVisibility is the visibility of a symbol outside the
+// component that defines it.
+type SymVisibility uint8
+
+const (
+	SymDefault SymVisibility = iota
+	SymProtected
+	SymHidden
+	SymInternal
+)
+
+func (v SymVisibility) String() string {
+	switch v {
+	case SymDefault:
+		return "default"
+	case SymProtected:
+		return "protected"
+	case SymHidden:
+		return "hidden"
+	case SymInternal:
+		return "internal"
+	}
+	return fmt.Sprintf("SymVisibility(%d)", v)
+}
+
+// Relocs is a sequence of relocations.
+type Relocs interface {
+	// Len returns the number of relocations in this sequence.
+	Len() int
+
+	// Get fills *r with the ith relocation.
+	Get(i int, r *Reloc)
+}
+
+type noRelocsType struct{}
+
+var noRelocs Relocs = noRelocsType{}
+
+func (noRelocsType) Len() int            { return 0 }
+func (noRelocsType) Get(i int, r *Reloc) { panic("out of bounds") }
+
+// A Reloc is a relocation: a value that's computed when the object
+// is linked or loaded and stored at Offset.
+type Reloc struct {
+	// Offset is the address where this Reloc is applied.
+	Offset uint64
+	// Size is the size of the relocation target in bytes.
+	Size byte
+	// Type is the relocation type. This determines how to
+	// calculate the value that would be stored at Offset.
+	Type RelocType
+	// Symbol is the target of this Reloc, or -1 if Type does not
+	// have a symbol as an input.
+	Symbol SymID
+	// Addend is the addend input to Type, if any.
+	Addend int64
+}
+
+// RelocType is a format- and architecture-specific relocation type,
+// such as elf.R_X86_64.
+type RelocType interface {
+	String() string
+}
+
+type unknownRelocType struct {
+	val int
+}
+
+func (u unknownRelocType) String() string {
+	return fmt.Sprintf("unknown(%d)", u.val)
+}
+
+// ErrUnknownFormat is returned by Open if a file isn't in any
+// supported object file format.
+var ErrUnknownFormat = errors.New("unrecognized object file format")
+
+// ErrNoDWARF indicates that an object has no DWARF debug info.
+var ErrNoDWARF = errors.New("no DWARF debug info")
+
+// A FormatError reports that an object file is malformed.
+type FormatError struct {
+	// Off is the offset in the file of the malformed data, or -1
+	// if it isn't known.
+	Off int64
+	Msg string
+	// Err is the underlying error, if any.
+	Err error
+}
+
+func (e *FormatError) Error() string {
+	msg := e.Msg
+	if e.Err != nil {
+		if msg == "" {
+			msg = e.Err.Error()
+		} else {
+			msg += ": " + e.Err.Error()
+		}
+	}
+	if e.Off < 0 {
+		return "file appears corrupted: " + msg
+	}
+	return fmt.Sprintf("file appears corrupted at offset %#x: %s", e.Off, msg)
+}
+
+func (e *FormatError) Unwrap() error {
+	return e.Err
+}
+
+// maxDataSize limits the size of a single section or symbol's data
+// when it's copied from the file. Sizes in a malformed file can be
+// arbitrarily large, and this keeps them from exhausting memory.
+const maxDataSize = 256 << 20
+
+// readData returns size bytes, the first flen of which are read from
+// r at off and the rest of which are zero. base is the file offset of
+// r, which is used to report errors.
+//
+// If r is a MappedFile and the data is all in the file, the result
+// refers to the mapping rather than a copy.
+func readData(r io.ReaderAt, base, off int64, flen, size uint64) ([]byte, error) {
+	if m, ok := r.(*MappedFile); ok && flen >= size {
+		p, ok := m.slice(off, size)
+		if !ok {
+			return nil, &FormatError{base + off, "data extends past end of file", nil}
+		}
+		return p, nil
+	}
+	if size > maxDataSize {
+		return nil, &FormatError{base + off, fmt.Sprintf("data size %#x too large", size), nil}
+	}
+	if flen > size {
+		flen = size
+	}
+	// Check that the data is really in the file before
+	// allocating space for it.
+	var last [1]byte
+	if flen > 0 {
+		if _, err := r.ReadAt(last[:], off+int64(flen)-1); err != nil {
+			return nil, &FormatError{base + off, "data extends past end of file", nil}
+		}
+	}
+	p := make([]byte, size)
+	if flen == 0 {
+		// Reading nothing at the end of a section reports EOF.
+		return p, nil
+	}
+	if _, err := r.ReadAt(p[:flen], off); err != nil {
+		return nil, &FormatError{base + off, "", err}
+	}
+	return p, nil
+}
+
+// An IndexError reports a section or symbol index that's out of range.
+type IndexError struct {
+	// Kind is "section" or "symbol".
+	Kind  string
+	Index int
+}
+
+func (e *IndexError) Error() string {
+	return fmt.Sprintf("%s index %d out of range", e.Kind, e.Index)
+}
+
+// Open attempts to open r as a known object file format. If r starts
+// with the magic number of a known format but can't be decoded, Open
+// returns a *FormatError. If r is a *MappedFile, the Obj reads data
+// directly from the mapping and holds a reference to it until it's
+// closed with Close.
+func Open(r io.ReaderAt) (Obj, error) {
+	var magic [4]byte
+	r.ReadAt(magic[:], 0)
+	formats := []struct {
+		magic string
+		open  func(io.ReaderAt) (Obj, error)
+	}{
+		{"\x7fELF", openElf},
+		{"MZ", openPE},
+		{"VZ", openTE},
+	}
+	var firstErr error
+	for _, format := range formats {
+		f, err := format.open(r)
+		if err == nil {
+			if m, ok := r.(*MappedFile); ok {
+				m.retain(mapRefOf(f))
+			}
+			return f, nil
+		}
+		if firstErr == nil && strings.HasPrefix(string(magic[:]), format.magic) {
+			firstErr = err
+		}
+	}
+	switch firstErr.(type) {
+	case nil:
+		return nil, ErrUnknownFormat
+	case *FormatError:
+		return nil, firstErr
+	}
+	if firstErr == io.EOF || firstErr == io.ErrUnexpectedEOF {
+		return nil, &FormatError{-1, "truncated", nil}
+	}
+	return nil, &FormatError{-1, "", firstErr}
+}
+
+// mapRefOf returns the mapping reference of an Obj returned by a
+// format's open function.
+func mapRefOf(o Obj) *mapRef {
+	switch o := o.(type) {
+	case *elfFile:
+		return &o.mapRef
+	case *peFile:
+		return &o.mapRef
+	case *teFile:
+		return &o.mapRef
+	}
+	panic(fmt.Sprintf("no mapping reference in %T", o))
+}
+
+// Close releases the resources held by o: its reference to the
+// MappedFile it was opened from, and, for an Obj from WithDebug or
+// WithDebugBuild, those of both objects it combines. Data read from
+// o, including the P of Data, must not be used after Close. Closing
+// o more than once, or closing an Obj that holds no resources, does
+// nothing. Close doesn't close the reader o was opened from.
+func Close(o Obj) error {
+	switch o := o.(type) {
+	case *elfFile, *peFile, *teFile:
+		return mapRefOf(o).close()
+	case *debugObj:
+		err := Close(o.Obj)
+		if err2 := Close(o.debug); err == nil {
+			err = err2
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package obj
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/aclements/objbrowse/internal/pdb"
+)
+
+// pdbFile is the debug info for a PE image from its PDB file. Its
+// symbols and synthesized DWARF refer to the image's addresses, and
+// it reads code and data from the image.
+type pdbFile struct {
+	image Obj
+	pdb   *pdb.File
+	syms  []Sym
+}
+
+// OpenPDB returns an Obj for the PDB file in r, which holds the debug
+// info for the PE or TE image. It's meant to be paired with the image
+// using WithDebug.
+//
+// The PDB's functions and line tables are presented as DWARF, but it
+// has no type or variable information.
+func OpenPDB(r io.ReaderAt, image Obj) (Obj, error) {
+	p, err := pdb.Open(r)
+	if err != nil {
+		return nil, err
+	}
+	if h, ok := ReadPEHeaders(image); ok {
+		for _, d := range h.Debug {
+			if d.GUID != "" && d.GUID != FormatGUID(p.GUID[:]) {
+				return nil, fmt.Errorf("PDB GUID %s does not match image GUID %s", FormatGUID(p.GUID[:]), d.GUID)
+			}
+		}
+	}
+	f := &pdbFile{image: image, pdb: p}
+	f.syms = f.convertSyms()
+	return f, nil
+}
+
+// PDBGUID returns the GUID identifying the PDB file in r, in the same
+// format as PEDebugEntry.GUID. This is much cheaper than reading the
+// whole PDB.
+func PDBGUID(r io.ReaderAt) (string, error) {
+	guid, err := pdb.ReadGUID(r)
+	if err != nil {
+		return "", err
+	}
+	return FormatGUID(guid[:]), nil
+}
+
+// addr returns the image address of PDB address a.
+func (f *pdbFile) addr(a pdb.Addr) (uint64, bool) {
+	sects := f.image.Sections()
+	if a.Seg == 0 || int(a.Seg) > len(sects) {
+		return 0, false
+	}
+	return sects[a.Seg-1].Addr + uint64(a.Off), true
+}
+
+// convertSyms converts the PDB's symbols to Syms. Functions and data
+// come from the module and global symbols and have undecorated names.
+// Public symbols have decorated names, so they're only included if
+// there's no other symbol at the same address.
+func (f *pdbFile) convertSyms() []Sym {
+	// Find the kind of symbols in each section.
+	var kinds []SymKind
+	switch img := f.image.(type) {
+	case *peFile:
+		for _, sect := range img.pe.Sections {
+			kinds = append(kinds, peSectKind(sect.Characteristics))
+		}
+	case *teFile:
+		for _, sh := range img.sects {
+			kinds = append(kinds, peSectKind(sh.Characteristics))
+		}
+	}
+
+	type key struct {
+		addr uint64
+		name string
+	}
+	seen := make(map[key]bool)
+	named := make(map[uint64]bool)
+	var out []Sym
+	for pass := 0; pass < 2; pass++ {
+		for _, ps := range f.pdb.Syms {
+			public := ps.Kind == pdb.SymPublic || ps.Kind == pdb.SymPublicFunc
+			if public != (pass == 1) {
+				continue
+			}
+			addr, ok := f.addr(ps.Addr)
+			if !ok || seen[key{addr, ps.Name}] || (public && named[addr]) {
+				continue
+			}
+			seen[key{addr, ps.Name}] = true
+			named[addr] = true
+
+			sym := Sym{Name: ps.Name, Value: addr, Size: uint64(ps.Size), Local: ps.Local, HasAddr: true, Section: int(ps.Addr.Seg) - 1}
+			switch {
+			case ps.Kind == pdb.SymFunc || ps.Kind == pdb.SymPublicFunc:
+				sym.Kind = SymText
+			case sym.Section < len(kinds):
+				sym.Kind = kinds[sym.Section]
+			default:
+				sym.Kind = SymData
+			}
+			out = append(out, sym)
+		}
+	}
+
+	// Data and public symbols have no size, so extend them to the
+	// next symbol or the end of the section.
+	order := make([]int, len(out))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return out[order[i]].Value < out[order[j]].Value
+	})
+	sects := f.image.Sections()
+	for i, si := range order {
+		sym := &out[si]
+		if sym.Size != 0 {
+			continue
+		}
+		next := sects[sym.Section].Addr + sects[sym.Section].Size
+		for _, sj := range order[i+1:] {
+			if v := out[sj].Value; v > sym.Value {
+				if v < next {
+					next = v
+				}
+				break
+			}
+		}
+		if next > sym.Value {
+			sym.Size = next - sym.Value
+		}
+	}
+	return out
+}
+
+func (f *pdbFile) Info() ObjInfo {
+	info := f.image.Info()
+	info.Format = "pdb"
+	return info
+}
+
+func (f *pdbFile) Data(ptr, size uint64) (Data, error) {
+	return f.image.Data(ptr, size)
+}
+
+func (f *pdbFile) Sections() []Section {
+	return f.image.Sections()
+}
+
+func (f *pdbFile) SectionData(i int) (Data, error) {
+	return f.image.SectionData(i)
+}
+
+func (f *pdbFile) Symbols() (Symbols, error) {
+	return (*pdbSymbols)(f), nil
+}
+
+type pdbSymbols pdbFile
+
+func (f *pdbSymbols) Len() SymID {
+	return SymID(len(f.syms))
+}
+
+func (f *pdbSymbols) Get(i SymID, sym *Sym) {
+	*sym = f.syms[i]
+}
+
+func (f *pdbFile) SymbolData(i SymID) (Data, error) {
+	if i < 0 || int(i) >= len(f.syms) {
+		return Data{}, &IndexError{"symbol", int(i)}
+	}
+	sym := f.syms[i]
+	data, err := f.image.Data(sym.Value, sym.Size)
+	if err != nil {
+		return Data{}, err
+	}
+	if data.P == nil {
+		data.Addr = sym.Value
+	}
+	data.R = noRelocs
+	return data, nil
+}
+
+func (f *pdbFile) DWARF() (*dwarf.Data, error) {
+	dw, err := f.pdb.DWARF(f.addr)
+	if err == pdb.ErrNoDebugInfo {
+		return nil, fmt.Errorf("%v: %w", err, ErrNoDWARF)
+	}
+	return dw, err
+}
@@ -13,13 +13,15 @@ import (
 	"io"
 	"sort"
 
-	"github.com/aclements/objbrowse/internal/arch"
+	"github.com/aclements/objbrowse/arch"
 )
 
 type peFile struct {
 	pe        *pe.File
+	r         io.ReaderAt
 	imageBase uint64
 	sizes     []uint64
+	mapRef    mapRef
 }
 
 func openPE(r io.ReaderAt) (Obj, error) {
@@ -40,7 +42,7 @@ func openPE(r io.ReaderAt) (Obj, error) {
 
 	// Assign symbol sizes.
 	sizes := peSynthesizeSizes(f.Symbols, f.Sections)
-	return &peFile{f, imageBase, sizes}, nil
+	return &peFile{pe: f, r: r, imageBase: imageBase, sizes: sizes}, nil
 }
 
 func peSynthesizeSizes(syms []*pe.Symbol, sects []*pe.Section) []uint64 {
@@ -66,7 +68,7 @@ func peSynthesizeSizes(syms []*pe.Symbol, sects []*pe.Section) []uint64 {
 			// meaningful sizes.
 			continue
 		}
-		if i == len(addr) || sym.SectionNumber != syms[addr[i+1]].SectionNumber {
+		if i == len(addr)-1 || sym.SectionNumber != syms[addr[i+1]].SectionNumber {
 			// Cap the symbol at the end of the section.
 			if int(sym.SectionNumber)-1 < len(sects) {
 				sect := sects[int(sym.SectionNumber)-1]
@@ -88,13 +90,85 @@ var peToArch = map[uint16]*arch.Arch{
 }
 
 func (f *peFile) Info() ObjInfo {
+	const IMAGE_DLLCHARACTERISTICS_DYNAMIC_BASE = 0x40
+	var dllChars uint16
+	switch oh := f.pe.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		dllChars = oh.DllCharacteristics
+	case *pe.OptionalHeader64:
+		dllChars = oh.DllCharacteristics
+	}
 	return ObjInfo{
-		peToArch[f.pe.Machine],
+		Arch:   peToArch[f.pe.Machine],
+		Format: "pe",
+		PIE:    dllChars&IMAGE_DLLCHARACTERISTICS_DYNAMIC_BASE != 0,
 	}
 }
 
 func (f *peFile) Data(ptr, size uint64) (Data, error) {
-	panic("not implemented")
+	for i, sect := range f.Sections() {
+		end := sect.Addr + sect.Size
+		if sect.Addr <= ptr && ptr < end {
+			// Found it. Limit size.
+			if ptr+size > end {
+				size = end - ptr
+			}
+			data, err := f.SectionData(i)
+			if err != nil {
+				return Data{}, err
+			}
+			off := ptr - sect.Addr
+			return Data{Addr: ptr, P: data.P[off : off+size], R: noRelocs}, nil
+		}
+	}
+	return Data{R: noRelocs}, nil
+}
+
+func (f *peFile) Sections() []Section {
+	const IMAGE_SCN_CNT_UNINITIALIZED_DATA = 0x80
+	var align uint32
+	switch oh := f.pe.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		align = oh.SectionAlignment
+	case *pe.OptionalHeader64:
+		align = oh.SectionAlignment
+	}
+	sects := make([]Section, len(f.pe.Sections))
+	for i, sect := range f.pe.Sections {
+		addr := f.imageBase + uint64(sect.VirtualAddress)
+		zero := sect.Characteristics&IMAGE_SCN_CNT_UNINITIALIZED_DATA != 0
+		sects[i] = Section{sect.Name, addr, uint64(sect.VirtualSize), zero, uint64(align), peSectFlags(sect.Characteristics)}
+	}
+	return sects
+}
+
+// peSectFlags returns the flags of a PE section with the given
+// characteristics. The loader maps every section of an image.
+func peSectFlags(chars uint32) SectFlags {
+	const (
+		IMAGE_SCN_MEM_EXECUTE = 0x20000000
+		IMAGE_SCN_MEM_WRITE   = 0x80000000
+	)
+	flags := SectAlloc
+	if chars&IMAGE_SCN_MEM_WRITE != 0 {
+		flags |= SectWrite
+	}
+	if chars&IMAGE_SCN_MEM_EXECUTE != 0 {
+		flags |= SectExec
+	}
+	return flags
+}
+
+func (f *peFile) SectionData(i int) (Data, error) {
+	if i < 0 || i >= len(f.pe.Sections) {
+		return Data{}, &IndexError{"section", i}
+	}
+	sect := f.pe.Sections[i]
+	p, err := readData(f.r, 0, int64(sect.Offset), uint64(sect.Size), uint64(sect.VirtualSize))
+	if err != nil {
+		return Data{}, err
+	}
+	return Data{Addr: f.imageBase + uint64(sect.VirtualAddress), P: p, R: noRelocs}, nil
 }
 
 func (f *peFile) Symbols() (Symbols, error) {
@@ -113,17 +187,14 @@ func (f *peSymbols) Get(i SymID, sym *Sym) {
 		IMAGE_SYM_ABSOLUTE  = -1
 		IMAGE_SYM_DEBUG     = -2
 
-		IMAGE_SYM_CLASS_STATIC = 3
-
-		IMAGE_SCN_CNT_CODE               = 0x20
-		IMAGE_SCN_CNT_INITIALIZED_DATA   = 0x40
-		IMAGE_SCN_CNT_UNINITIALIZED_DATA = 0x80
-		IMAGE_SCN_MEM_WRITE              = 0x80000000
+		IMAGE_SYM_CLASS_STATIC        = 3
+		IMAGE_SYM_CLASS_WEAK_EXTERNAL = 105
 	)
 
 	s := f.pe.Symbols[i]
 
-	*sym = Sym{s.Name, uint64(s.Value), 0, SymUnknown, false, false}
+	*sym = Sym{Name: s.Name, Value: uint64(s.Value), Kind: SymUnknown, Section: -1}
+	sym.Weak = s.StorageClass == IMAGE_SYM_CLASS_WEAK_EXTERNAL
 	switch s.SectionNumber {
 	case IMAGE_SYM_UNDEFINED:
 		sym.Kind = SymUndef
@@ -137,26 +208,41 @@ func (f *peSymbols) Get(i SymID, sym *Sym) {
 			break
 		}
 		sect := f.pe.Sections[int(s.SectionNumber)-1]
-		c := sect.Characteristics
-		switch {
-		case c&IMAGE_SCN_CNT_CODE != 0:
-			sym.Kind = SymText
-		case c&IMAGE_SCN_CNT_INITIALIZED_DATA != 0:
-			if c&IMAGE_SCN_MEM_WRITE != 0 {
-				sym.Kind = SymData
-			} else {
-				sym.Kind = SymROData
-			}
-		case c&IMAGE_SCN_CNT_UNINITIALIZED_DATA != 0:
-			sym.Kind = SymBSS
-		}
+		sym.Kind = peSectKind(sect.Characteristics)
 		sym.Local = s.StorageClass == IMAGE_SYM_CLASS_STATIC
+		sym.Section = int(s.SectionNumber) - 1
 		sym.Value += f.imageBase + uint64(sect.VirtualAddress)
 		sym.HasAddr = true
 	}
 }
 
+// peSectKind returns the kind of symbols in a PE section with
+// characteristics c.
+func peSectKind(c uint32) SymKind {
+	const (
+		IMAGE_SCN_CNT_CODE               = 0x20
+		IMAGE_SCN_CNT_INITIALIZED_DATA   = 0x40
+		IMAGE_SCN_CNT_UNINITIALIZED_DATA = 0x80
+		IMAGE_SCN_MEM_WRITE              = 0x80000000
+	)
+	switch {
+	case c&IMAGE_SCN_CNT_CODE != 0:
+		return SymText
+	case c&IMAGE_SCN_CNT_INITIALIZED_DATA != 0:
+		if c&IMAGE_SCN_MEM_WRITE != 0 {
+			return SymData
+		}
+		return SymROData
+	case c&IMAGE_SCN_CNT_UNINITIALIZED_DATA != 0:
+		return SymBSS
+	}
+	return SymUnknown
+}
+
 func (f *peFile) SymbolData(i SymID) (Data, error) {
+	if i < 0 || int(i) >= len(f.pe.Symbols) {
+		return Data{}, &IndexError{"symbol", int(i)}
+	}
 	s := f.pe.Symbols[i]
 	if s.SectionNumber <= 0 || int(s.SectionNumber)-1 >= len(f.pe.Sections) {
 		return Data{R: noRelocs}, nil
@@ -166,20 +252,20 @@ func (f *peFile) SymbolData(i SymID) (Data, error) {
 		return Data{}, fmt.Errorf("symbol %q starts before section %q", s.Name, sect.Name)
 	}
 	value := f.imageBase + uint64(s.Value) + uint64(sect.VirtualAddress)
-	out := Data{Addr: value, P: make([]byte, f.sizes[i]), R: noRelocs}
+	var flen uint64
 	if s.Value < sect.Size {
-		flen := f.sizes[i]
-		if flen > uint64(sect.Size-s.Value) {
-			flen = uint64(sect.Size - s.Value)
-		}
-		_, err := sect.ReadAt(out.P[:flen], int64(s.Value))
-		if err != nil {
-			return Data{}, err
-		}
+		flen = uint64(sect.Size - s.Value)
 	}
-	return out, nil
+	p, err := readData(f.r, 0, int64(sect.Offset)+int64(s.Value), flen, f.sizes[i])
+	if err != nil {
+		return Data{}, err
+	}
+	return Data{Addr: value, P: p, R: noRelocs}, nil
 }
 
 func (f *peFile) DWARF() (*dwarf.Data, error) {
+	if f.pe.Section(".debug_info") == nil && f.pe.Section(".zdebug_info") == nil {
+		return nil, ErrNoDWARF
+	}
 	return f.pe.DWARF()
 }
@@ -0,0 +1,39 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package obj
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// TestPEHugeSection checks that a PE section claiming a huge virtual
+// size is rejected rather than allocated.
+func TestPEHugeSection(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("..", "testdata", "corpus", "pe-amd64"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Set the first section's VirtualSize.
+	lfanew := binary.LittleEndian.Uint32(data[0x3c:])
+	coff := lfanew + 4
+	optSize := binary.LittleEndian.Uint16(data[coff+16:])
+	sect := coff + 20 + uint32(optSize)
+	binary.LittleEndian.PutUint32(data[sect+8:], 0xf0000000)
+
+	o, err := Open(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = o.SectionData(0)
+	var fe *FormatError
+	if !errors.As(err, &fe) {
+		t.Fatalf("SectionData of huge section: got %v, want FormatError", err)
+	}
+}
@@ -0,0 +1,432 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package obj
+
+import (
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// PEHeaders describes the image headers of a PE or TE file.
+type PEHeaders struct {
+	// TE indicates this is a Terse Executable image.
+	TE bool
+
+	Machine   uint16
+	Subsystem uint16
+	ImageBase uint64
+	// Entry is the address of the entry point, or 0 if there is
+	// none.
+	Entry uint64
+
+	// Dirs lists the non-empty data directories.
+	Dirs []PEDirectory
+	// Debug lists the entries of the debug directory.
+	Debug []PEDebugEntry
+	// Resources lists the leaves of the resource tree.
+	Resources []PEResource
+	// Depex is the decoded UEFI dependency expression from a
+	// ".depex" section, or "" if there is none.
+	Depex string
+
+	// Errors lists problems found decoding the headers. Decoding
+	// continues past these where possible.
+	Errors []string
+}
+
+// PEDirectory is an entry in the optional header's data directory.
+type PEDirectory struct {
+	Name string
+	// Addr is the address of the directory. For the security
+	// directory, this is a file offset instead.
+	Addr, Size uint64
+}
+
+// PEDebugEntry is an entry in the debug directory.
+type PEDebugEntry struct {
+	Type     uint32
+	TypeName string
+	// Addr is the address of the debug data, or 0 if it isn't
+	// loaded.
+	Addr, Size uint64
+
+	// PDB, GUID, and Age are from a CodeView entry, which names
+	// the PDB file with the image's debug info.
+	PDB  string
+	GUID string
+	Age  uint32
+}
+
+// PEResource is a leaf of the resource tree.
+type PEResource struct {
+	// Path gives the type, name, and language of this resource.
+	// Numeric IDs are written in decimal and well-known types
+	// by name, such as "VERSION".
+	Path       []string
+	Addr, Size uint64
+	CodePage   uint32
+}
+
+var peDirNames = [...]string{
+	"export", "import", "resource", "exception", "security", "basereloc",
+	"debug", "architecture", "globalptr", "tls", "load config",
+	"bound import", "IAT", "delay import", "CLR runtime", "reserved",
+}
+
+var peSubsystemNames = map[uint16]string{
+	1:  "native",
+	2:  "Windows GUI",
+	3:  "Windows console",
+	7:  "POSIX console",
+	9:  "Windows CE GUI",
+	10: "EFI application",
+	11: "EFI boot service driver",
+	12: "EFI runtime driver",
+	13: "EFI ROM",
+	14: "Xbox",
+	16: "Windows boot application",
+}
+
+// SubsystemName returns a description of h.Subsystem.
+func (h *PEHeaders) SubsystemName() string {
+	if name, ok := peSubsystemNames[h.Subsystem]; ok {
+		return name
+	}
+	return fmt.Sprintf("subsystem %d", h.Subsystem)
+}
+
+// IsUEFI reports whether h is a UEFI image.
+func (h *PEHeaders) IsUEFI() bool {
+	return h.TE || 10 <= h.Subsystem && h.Subsystem <= 13
+}
+
+// ReadPEHeaders returns the image headers of o if it's a PE or TE
+// file.
+func ReadPEHeaders(o Obj) (*PEHeaders, bool) {
+	if d, ok := o.(*debugObj); ok {
+		o = d.Obj
+	}
+	var h PEHeaders
+	var dirs []pe.DataDirectory
+	switch f := o.(type) {
+	default:
+		return nil, false
+	case *peFile:
+		var entry uint32
+		h.Machine = f.pe.Machine
+		var nDirs uint32
+		switch oh := f.pe.OptionalHeader.(type) {
+		case *pe.OptionalHeader32:
+			h.Subsystem, entry = oh.Subsystem, oh.AddressOfEntryPoint
+			dirs, nDirs = oh.DataDirectory[:], oh.NumberOfRvaAndSizes
+		case *pe.OptionalHeader64:
+			h.Subsystem, entry = oh.Subsystem, oh.AddressOfEntryPoint
+			dirs, nDirs = oh.DataDirectory[:], oh.NumberOfRvaAndSizes
+		}
+		if nDirs < uint32(len(dirs)) {
+			dirs = dirs[:nDirs]
+		}
+		h.ImageBase = f.imageBase
+		if entry != 0 {
+			h.Entry = f.imageBase + uint64(entry)
+		}
+		for i, d := range dirs {
+			if d.Size == 0 || i >= len(peDirNames) {
+				continue
+			}
+			addr := f.imageBase + uint64(d.VirtualAddress)
+			if i == 4 {
+				// The security directory is not loaded.
+				addr = uint64(d.VirtualAddress)
+			}
+			h.Dirs = append(h.Dirs, PEDirectory{peDirNames[i], addr, uint64(d.Size)})
+		}
+	case *teFile:
+		h.TE = true
+		h.Machine = f.hdr.Machine
+		h.Subsystem = uint16(f.hdr.Subsystem)
+		h.ImageBase = f.hdr.ImageBase
+		if f.hdr.AddressOfEntryPoint != 0 {
+			h.Entry = f.hdr.ImageBase + uint64(f.hdr.AddressOfEntryPoint)
+		}
+		// TE keeps only the base relocation and debug
+		// directories.
+		dirs = make([]pe.DataDirectory, 7)
+		dirs[5], dirs[6] = f.hdr.DataDirectory[0], f.hdr.DataDirectory[1]
+		for i, d := range dirs {
+			if d.Size != 0 {
+				h.Dirs = append(h.Dirs, PEDirectory{peDirNames[i], f.hdr.ImageBase + uint64(d.VirtualAddress), uint64(d.Size)})
+			}
+		}
+	}
+
+	read := func(d pe.DataDirectory) ([]byte, bool) {
+		if d.Size == 0 {
+			return nil, false
+		}
+		data, err := o.Data(h.ImageBase+uint64(d.VirtualAddress), uint64(d.Size))
+		if err != nil || uint64(len(data.P)) < uint64(d.Size) {
+			h.Errors = append(h.Errors, fmt.Sprintf("directory at %#x is not in any section", h.ImageBase+uint64(d.VirtualAddress)))
+			return nil, false
+		}
+		return data.P, true
+	}
+	if len(dirs) > 6 {
+		if data, ok := read(dirs[6]); ok {
+			h.readDebug(o, data)
+		}
+	}
+	if len(dirs) > 2 {
+		if data, ok := read(dirs[2]); ok {
+			h.readResources(data)
+		}
+	}
+	for i, sect := range o.Sections() {
+		if sect.Name != ".depex" {
+			continue
+		}
+		data, err := o.SectionData(i)
+		if err != nil {
+			h.Errors = append(h.Errors, err.Error())
+			continue
+		}
+		depex, err := DecodeDepex(data.P)
+		if err != nil {
+			h.Errors = append(h.Errors, fmt.Sprintf(".depex: %v", err))
+		}
+		h.Depex = depex
+	}
+	return &h, true
+}
+
+var peDebugTypeNames = map[uint32]string{
+	1:  "COFF",
+	2:  "CodeView",
+	3:  "FPO",
+	4:  "misc",
+	5:  "exception",
+	6:  "fixup",
+	9:  "Borland",
+	12: "VC feature",
+	13: "POGO",
+	14: "ILTCG",
+	16: "repro",
+	20: "extended DLL characteristics",
+}
+
+// readDebug decodes the debug directory in data.
+func (h *PEHeaders) readDebug(o Obj, data []byte) {
+	const entrySize = 28
+	le := binary.LittleEndian
+	for ; len(data) >= entrySize; data = data[entrySize:] {
+		e := PEDebugEntry{Type: le.Uint32(data[12:]), Size: uint64(le.Uint32(data[16:]))}
+		e.TypeName = peDebugTypeNames[e.Type]
+		if e.TypeName == "" {
+			e.TypeName = fmt.Sprintf("type %d", e.Type)
+		}
+		if rva := le.Uint32(data[20:]); rva != 0 {
+			e.Addr = h.ImageBase + uint64(rva)
+		}
+		if e.Type == 2 && e.Addr != 0 {
+			cv, err := o.Data(e.Addr, e.Size)
+			if err == nil {
+				e.readCodeView(cv.P)
+			}
+		}
+		h.Debug = append(h.Debug, e)
+	}
+}
+
+// readCodeView decodes a CodeView debug record, which names the PDB
+// file.
+func (e *PEDebugEntry) readCodeView(p []byte) {
+	le := binary.LittleEndian
+	cstring := func(p []byte) string {
+		if i := strings.IndexByte(string(p), 0); i >= 0 {
+			p = p[:i]
+		}
+		return string(p)
+	}
+	switch {
+	case len(p) >= 24 && string(p[:4]) == "RSDS":
+		e.GUID = FormatGUID(p[4:20])
+		e.Age = le.Uint32(p[20:])
+		e.PDB = cstring(p[24:])
+	case len(p) >= 16 && string(p[:4]) == "NB10":
+		e.GUID = fmt.Sprintf("%08X", le.Uint32(p[8:]))
+		e.Age = le.Uint32(p[12:])
+		e.PDB = cstring(p[16:])
+	}
+}
+
+var peResourceTypeNames = map[uint32]string{
+	1: "CURSOR", 2: "BITMAP", 3: "ICON", 4: "MENU", 5: "DIALOG",
+	6: "STRING", 7: "FONTDIR", 8: "FONT", 9: "ACCELERATOR",
+	10: "RCDATA", 11: "MESSAGETABLE", 12: "GROUP_CURSOR",
+	14: "GROUP_ICON", 16: "VERSION", 17: "DLGINCLUDE", 19: "PLUGPLAY",
+	20: "VXD", 21: "ANICURSOR", 22: "ANIICON", 23: "HTML", 24: "MANIFEST",
+}
+
+// maxPEResources limits the number of resources decoded, in case of
+// a malformed or cyclic resource tree.
+const maxPEResources = 10000
+
+// readResources decodes the resource tree in data.
+func (h *PEHeaders) readResources(data []byte) {
+	le := binary.LittleEndian
+	bad := func(off uint32) {
+		h.Errors = append(h.Errors, fmt.Sprintf("resource tree entry at offset %#x is out of range", off))
+	}
+	name := func(level int, id uint32) string {
+		if id&0x80000000 == 0 {
+			if level == 0 {
+				if n, ok := peResourceTypeNames[id]; ok {
+					return n
+				}
+			}
+			return fmt.Sprint(id)
+		}
+		off := id &^ 0x80000000
+		if uint64(off)+2 > uint64(len(data)) {
+			bad(off)
+			return "?"
+		}
+		n := uint64(le.Uint16(data[off:]))
+		if uint64(off)+2+2*n > uint64(len(data)) {
+			bad(off)
+			return "?"
+		}
+		u := make([]uint16, n)
+		for i := range u {
+			u[i] = le.Uint16(data[off+2+uint32(2*i):])
+		}
+		return string(utf16.Decode(u))
+	}
+	var walk func(off uint32, path []string)
+	walk = func(off uint32, path []string) {
+		if len(path) > 3 || len(h.Resources) >= maxPEResources {
+			return
+		}
+		if uint64(off)+16 > uint64(len(data)) {
+			bad(off)
+			return
+		}
+		n := uint32(le.Uint16(data[off+12:])) + uint32(le.Uint16(data[off+14:]))
+		for i := uint32(0); i < n; i++ {
+			ent := off + 16 + 8*i
+			if uint64(ent)+8 > uint64(len(data)) {
+				bad(ent)
+				return
+			}
+			p := append(path[:len(path):len(path)], name(len(path), le.Uint32(data[ent:])))
+			target := le.Uint32(data[ent+4:])
+			if target&0x80000000 != 0 {
+				walk(target&^0x80000000, p)
+				continue
+			}
+			if uint64(target)+16 > uint64(len(data)) {
+				bad(target)
+				continue
+			}
+			h.Resources = append(h.Resources, PEResource{
+				Path:     p,
+				Addr:     h.ImageBase + uint64(le.Uint32(data[target:])),
+				Size:     uint64(le.Uint32(data[target+4:])),
+				CodePage: le.Uint32(data[target+8:]),
+			})
+		}
+	}
+	walk(0, nil)
+}
+
+// DecodeDepex decodes a UEFI dependency expression, as found in a
+// driver's DEPEX section, into a readable infix expression over
+// protocol GUIDs. If it can't decode all of data, it returns what it
+// decoded so far along with an error.
+func DecodeDepex(data []byte) (string, error) {
+	const (
+		opBefore = 0x00
+		opAfter  = 0x01
+		opPush   = 0x02
+		opAnd    = 0x03
+		opOr     = 0x04
+		opNot    = 0x05
+		opTrue   = 0x06
+		opFalse  = 0x07
+		opEnd    = 0x08
+		opSOR    = 0x09
+	)
+	var stack []string
+	var prefix string
+	pop := func() (string, bool) {
+		if len(stack) == 0 {
+			return "", false
+		}
+		x := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		return x, true
+	}
+	result := func() string {
+		return prefix + strings.Join(stack, " ")
+	}
+	for i := 0; i < len(data); {
+		op := data[i]
+		i++
+		switch op {
+		case opBefore, opAfter, opPush:
+			if i+16 > len(data) {
+				return result(), fmt.Errorf("truncated GUID at offset %d", i)
+			}
+			guid := FormatGUID(data[i : i+16])
+			i += 16
+			switch op {
+			case opBefore:
+				prefix = "BEFORE " + guid
+			case opAfter:
+				prefix = "AFTER " + guid
+			default:
+				stack = append(stack, guid)
+			}
+		case opAnd, opOr:
+			y, ok1 := pop()
+			x, ok2 := pop()
+			if !ok1 || !ok2 {
+				return result(), fmt.Errorf("stack underflow at offset %d", i-1)
+			}
+			sep := " AND "
+			if op == opOr {
+				sep = " OR "
+			}
+			stack = append(stack, "("+x+sep+y+")")
+		case opNot:
+			x, ok := pop()
+			if !ok {
+				return result(), fmt.Errorf("stack underflow at offset %d", i-1)
+			}
+			stack = append(stack, "NOT "+x)
+		case opTrue:
+			stack = append(stack, "TRUE")
+		case opFalse:
+			stack = append(stack, "FALSE")
+		case opSOR:
+			prefix = "SOR "
+		case opEnd:
+			return result(), nil
+		default:
+			return result(), fmt.Errorf("unknown opcode %#x at offset %d", op, i-1)
+		}
+	}
+	return result(), fmt.Errorf("missing END")
+}
+
+// FormatGUID formats the 16-byte EFI GUID in p in the usual
+// registry format.
+func FormatGUID(p []byte) string {
+	le := binary.LittleEndian
+	return fmt.Sprintf("%08X-%04X-%04X-%X-%X", le.Uint32(p), le.Uint16(p[4:]), le.Uint16(p[6:]), p[8:10], p[10:16])
+}
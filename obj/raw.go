@@ -0,0 +1,215 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package obj
+
+import (
+	"bufio"
+	"debug/dwarf"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aclements/objbrowse/arch"
+)
+
+// rawFile is a flat binary image with no container format, such as a
+// firmware dump. It has a single section covering the whole image.
+type rawFile struct {
+	data []byte
+	arch *arch.Arch
+	base uint64
+	syms []Sym
+}
+
+// OpenRaw returns an Obj for the flat binary image data loaded at
+// address base. Since the image has no symbol table, syms supplies
+// the symbols, if any. Symbols with no size extend to the next
+// symbol or the end of the image.
+func OpenRaw(data []byte, a *arch.Arch, base uint64, syms []Sym) Obj {
+	f := &rawFile{data, a, base, append([]Sym(nil), syms...)}
+	end := base + uint64(len(data))
+
+	// Assign sections and sizes.
+	order := make([]int, len(f.syms))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return f.syms[order[i]].Value < f.syms[order[j]].Value
+	})
+	for i, si := range order {
+		sym := &f.syms[si]
+		sym.Section = -1
+		if !sym.HasAddr || sym.Value < base || sym.Value >= end {
+			continue
+		}
+		sym.Section = 0
+		if sym.Size != 0 {
+			continue
+		}
+		next := end
+		for _, sj := range order[i+1:] {
+			if v := f.syms[sj].Value; v > sym.Value {
+				if v < next {
+					next = v
+				}
+				break
+			}
+		}
+		sym.Size = next - sym.Value
+	}
+	return f
+}
+
+func (f *rawFile) Info() ObjInfo {
+	return ObjInfo{Arch: f.arch, Format: "raw"}
+}
+
+func (f *rawFile) Data(ptr, size uint64) (Data, error) {
+	if ptr < f.base || ptr-f.base >= uint64(len(f.data)) {
+		return Data{R: noRelocs}, nil
+	}
+	off := ptr - f.base
+	if size > uint64(len(f.data))-off {
+		size = uint64(len(f.data)) - off
+	}
+	return Data{Addr: ptr, P: f.data[off : off+size], R: noRelocs}, nil
+}
+
+func (f *rawFile) Sections() []Section {
+	return []Section{{Name: "image", Addr: f.base, Size: uint64(len(f.data))}}
+}
+
+func (f *rawFile) SectionData(i int) (Data, error) {
+	if i != 0 {
+		return Data{}, &IndexError{"section", i}
+	}
+	return Data{Addr: f.base, P: f.data, R: noRelocs}, nil
+}
+
+func (f *rawFile) Symbols() (Symbols, error) {
+	return (*rawSymbols)(f), nil
+}
+
+type rawSymbols rawFile
+
+func (f *rawSymbols) Len() SymID {
+	return SymID(len(f.syms))
+}
+
+func (f *rawSymbols) Get(i SymID, sym *Sym) {
+	*sym = f.syms[i]
+}
+
+func (f *rawFile) SymbolData(i SymID) (Data, error) {
+	if i < 0 || int(i) >= len(f.syms) {
+		return Data{}, &IndexError{"symbol", int(i)}
+	}
+	sym := f.syms[i]
+	if sym.Section < 0 {
+		return Data{Addr: sym.Value, R: noRelocs}, nil
+	}
+	return f.Data(sym.Value, sym.Size)
+}
+
+func (f *rawFile) DWARF() (*dwarf.Data, error) {
+	return nil, fmt.Errorf("raw images have no DWARF: %w", ErrNoDWARF)
+}
+
+// ReadSymbolFile reads a list of symbols for a raw image from r. Each
+// line is either nm output ("addr [size] type name", in hex) or
+// comma-separated "name,addr[,size[,type]]", where addr and size may
+// be in decimal or 0x-prefixed hex and type is an nm type letter.
+// Blank lines and lines starting with "#" are ignored, as are
+// undefined symbols.
+func ReadSymbolFile(r io.Reader) ([]Sym, error) {
+	var out []Sym
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var name, addr, size, typ string
+		if strings.Contains(line, ",") {
+			f := strings.Split(line, ",")
+			for i := range f {
+				f[i] = strings.TrimSpace(f[i])
+			}
+			if len(f) > 4 {
+				return nil, fmt.Errorf("line %d: expected name,addr[,size[,type]]", lineNum)
+			}
+			f = append(f, "", "")
+			name, addr, size, typ = f[0], f[1], f[2], f[3]
+			if typ == "" {
+				typ = "T"
+			}
+			if _, err := strconv.ParseUint(addr, 0, 64); err != nil && lineNum == 1 {
+				// Assume this is a header.
+				continue
+			}
+		} else {
+			f := strings.Fields(line)
+			switch len(f) {
+			case 2:
+				// Undefined symbols have no address.
+				continue
+			case 3:
+				addr, typ, name = f[0], f[1], f[2]
+			case 4:
+				addr, size, typ, name = f[0], f[1], f[2], f[3]
+			default:
+				return nil, fmt.Errorf("line %d: expected nm output", lineNum)
+			}
+			// nm prints addresses in hex without a prefix.
+			addr, size = "0x"+addr, "0x"+size
+			if len(f) == 3 {
+				size = ""
+			}
+		}
+
+		sym := Sym{Name: name, Kind: SymUnknown, HasAddr: true}
+		var err error
+		if sym.Value, err = strconv.ParseUint(addr, 0, 64); err != nil {
+			return nil, fmt.Errorf("line %d: bad address %q", lineNum, addr)
+		}
+		if size != "" {
+			if sym.Size, err = strconv.ParseUint(size, 0, 64); err != nil {
+				return nil, fmt.Errorf("line %d: bad size %q", lineNum, size)
+			}
+		}
+		if len(typ) != 1 {
+			return nil, fmt.Errorf("line %d: bad symbol type %q", lineNum, typ)
+		}
+		c := typ[0]
+		switch c {
+		case 'U':
+			continue
+		case 'T', 't':
+			sym.Kind = SymText
+		case 'W', 'w':
+			sym.Kind, sym.Weak = SymText, true
+		case 'D', 'd', 'G', 'g':
+			sym.Kind = SymData
+		case 'V', 'v':
+			sym.Kind, sym.Weak = SymData, true
+		case 'R', 'r':
+			sym.Kind = SymROData
+		case 'B', 'b', 'S', 's':
+			sym.Kind = SymBSS
+		case 'A', 'a':
+			sym.Kind, sym.HasAddr = SymAbsolute, false
+		}
+		// Lower-case types are local, except for weak symbols.
+		sym.Local = 'a' <= c && c <= 'z' && !sym.Weak
+		out = append(out, sym)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
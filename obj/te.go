@@ -0,0 +1,133 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package obj
+
+import (
+	"debug/dwarf"
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// teFile is a Terse Executable image, the stripped-down PE format
+// UEFI uses for PEI modules. It replaces the DOS, COFF, and optional
+// headers with a small fixed header, but keeps the PE section
+// headers and the image layout. TE images have no symbols.
+type teFile struct {
+	r      io.ReaderAt
+	mapRef mapRef
+	hdr    teHeader
+	sects  []pe.SectionHeader32
+	offAdj int64 // Add to PE file offsets to get TE file offsets
+}
+
+// teHeader is EFI_TE_IMAGE_HEADER.
+type teHeader struct {
+	Signature           uint16
+	Machine             uint16
+	NumberOfSections    uint8
+	Subsystem           uint8
+	StrippedSize        uint16
+	AddressOfEntryPoint uint32
+	BaseOfCode          uint32
+	ImageBase           uint64
+	// DataDirectory holds the base relocation and debug
+	// directories.
+	DataDirectory [2]pe.DataDirectory
+}
+
+const (
+	teSignature  = 0x5a56 // "VZ"
+	teHeaderSize = 40
+)
+
+func openTE(r io.ReaderAt) (Obj, error) {
+	sr := io.NewSectionReader(r, 0, 1<<63-1)
+	f := &teFile{r: r}
+	if err := binary.Read(sr, binary.LittleEndian, &f.hdr); err != nil {
+		return nil, err
+	}
+	if f.hdr.Signature != teSignature {
+		return nil, fmt.Errorf("not a TE image")
+	}
+	f.sects = make([]pe.SectionHeader32, f.hdr.NumberOfSections)
+	if err := binary.Read(sr, binary.LittleEndian, f.sects); err != nil {
+		return nil, err
+	}
+	// Section file offsets are relative to the original PE
+	// image, before its headers were stripped.
+	f.offAdj = teHeaderSize - int64(f.hdr.StrippedSize)
+	return f, nil
+}
+
+func (f *teFile) Info() ObjInfo {
+	return ObjInfo{
+		Arch:   peToArch[f.hdr.Machine],
+		Format: "te",
+	}
+}
+
+func (f *teFile) Data(ptr, size uint64) (Data, error) {
+	for i, sect := range f.Sections() {
+		end := sect.Addr + sect.Size
+		if sect.Addr <= ptr && ptr < end {
+			if ptr+size > end {
+				size = end - ptr
+			}
+			data, err := f.SectionData(i)
+			if err != nil {
+				return Data{}, err
+			}
+			off := ptr - sect.Addr
+			return Data{Addr: ptr, P: data.P[off : off+size], R: noRelocs}, nil
+		}
+	}
+	return Data{R: noRelocs}, nil
+}
+
+func (f *teFile) Sections() []Section {
+	sects := make([]Section, len(f.sects))
+	for i, sh := range f.sects {
+		name := strings.TrimRight(string(sh.Name[:]), "\x00")
+		size := sh.VirtualSize
+		if size == 0 {
+			size = sh.SizeOfRawData
+		}
+		sects[i] = Section{Name: name, Addr: f.hdr.ImageBase + uint64(sh.VirtualAddress), Size: uint64(size), Flags: peSectFlags(sh.Characteristics)}
+	}
+	return sects
+}
+
+func (f *teFile) SectionData(i int) (Data, error) {
+	if i < 0 || i >= len(f.sects) {
+		return Data{}, &IndexError{"section", i}
+	}
+	sh := f.sects[i]
+	sect := f.Sections()[i]
+	p, err := readData(f.r, 0, int64(sh.PointerToRawData)+f.offAdj, uint64(sh.SizeOfRawData), sect.Size)
+	if err != nil {
+		return Data{}, fmt.Errorf("reading section %s: %w", sect.Name, err)
+	}
+	return Data{Addr: sect.Addr, P: p, R: noRelocs}, nil
+}
+
+func (f *teFile) Symbols() (Symbols, error) {
+	return teSymbols{}, nil
+}
+
+type teSymbols struct{}
+
+func (teSymbols) Len() SymID          { return 0 }
+func (teSymbols) Get(i SymID, s *Sym) { panic("out of bounds") }
+
+func (f *teFile) SymbolData(i SymID) (Data, error) {
+	return Data{}, &IndexError{"symbol", int(i)}
+}
+
+func (f *teFile) DWARF() (*dwarf.Data, error) {
+	return nil, fmt.Errorf("TE images have no DWARF: %w", ErrNoDWARF)
+}
@@ -0,0 +1,240 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aclements/objbrowse/internal/asm"
+	"github.com/aclements/objbrowse/internal/profile"
+	"github.com/aclements/objbrowse/obj"
+)
+
+// AllocAnalysis finds heap allocation sites in Go code: calls to the
+// runtime functions that allocate on behalf of the compiler, such as
+// for escaping variables, slice growth, and interface conversions.
+// If a heap profile is available, it attributes allocations in the
+// profile to these sites.
+type AllocAnalysis struct {
+	fi   *FileInfo
+	prof *profile.Profile
+
+	profOnce sync.Once
+	// profByRet maps from the return address of a call to an
+	// allocation function to the profiled allocations at that
+	// call.
+	profByRet map[uint64]allocProf
+
+	once  sync.Once
+	sites []AllocSiteJS
+}
+
+type allocProf struct {
+	objects, bytes int64
+}
+
+// AllocJS is a single allocation site in a function.
+type AllocJS struct {
+	PC AddrJS
+	// Func is the runtime allocation function called, such as
+	// "newobject" or "growslice".
+	Func string
+
+	// Objects and Bytes give the allocations at this site from
+	// the heap profile, if any.
+	Objects int64 `json:",omitempty"`
+	Bytes   int64 `json:",omitempty"`
+}
+
+// NewAllocAnalysis returns an allocation site analysis for fi. prof
+// is a heap profile, or nil.
+func NewAllocAnalysis(fi *FileInfo, prof *profile.Profile) *AllocAnalysis {
+	return &AllocAnalysis{fi: fi, prof: prof}
+}
+
+var allocFuncs = map[string]bool{
+	"newobject": true, "newarray": true,
+	"growslice": true, "makeslice": true, "makeslice64": true, "makeslicecopy": true,
+	"makemap": true, "makemap64": true, "makemap_small": true,
+	"makechan": true, "makechan64": true,
+	"convT": true, "convT16": true, "convT32": true, "convT64": true,
+	"convTnoptr": true, "convTslice": true, "convTstring": true,
+	"convT2E": true, "convT2I": true, "convT2Enoptr": true, "convT2Inoptr": true,
+	"rawstring": true, "rawbyteslice": true, "rawruneslice": true,
+	"slicebytetostring": true, "stringtoslicebyte": true,
+	"stringtoslicerune": true, "slicerunetostring": true, "intstring": true,
+}
+
+// allocFunc returns the short name of runtime allocation function
+// name, or "" if name isn't an allocation function.
+func allocFunc(name string) string {
+	name = strings.TrimSuffix(name, ".abi0")
+	if !strings.HasPrefix(name, "runtime.") {
+		return ""
+	}
+	name = name[len("runtime."):]
+	if allocFuncs[name] || strings.HasPrefix(name, "mallocgc") ||
+		strings.HasPrefix(name, "concatstring") || strings.HasPrefix(name, "concatbyte") {
+		return name
+	}
+	return ""
+}
+
+// analyzeFunc returns the allocation sites in the function sym.
+func (a *AllocAnalysis) analyzeFunc(sym obj.Sym, insts asm.Seq) []AllocJS {
+	a.profOnce.Do(func() {
+		if err := a.indexProfile(); err != nil {
+			logger.Warn("ignoring heap profile", "err", err)
+			a.profByRet = nil
+		}
+	})
+
+	var allocs []AllocJS
+	for i := 0; i < insts.Len(); i++ {
+		inst := insts.Get(i)
+		fn := allocFunc(a.fi.CallTarget(inst))
+		if fn == "" {
+			continue
+		}
+		alloc := AllocJS{PC: AddrJS(inst.PC()), Func: fn}
+		ret := inst.PC() + uint64(inst.Len())
+		p, ok := a.profByRet[ret]
+		if !ok {
+			// Some profilers record the return
+			// address minus 1.
+			p = a.profByRet[ret-1]
+		}
+		alloc.Objects, alloc.Bytes = p.objects, p.bytes
+		allocs = append(allocs, alloc)
+	}
+	return allocs
+}
+
+// indexProfile attributes the samples in the heap profile to the
+// calls to allocation functions.
+func (a *AllocAnalysis) indexProfile() error {
+	if a.prof == nil {
+		return nil
+	}
+	objIdx, bytesIdx := a.prof.ValueIndex("alloc_objects"), a.prof.ValueIndex("alloc_space")
+	if objIdx < 0 || bytesIdx < 0 {
+		objIdx, bytesIdx = a.prof.ValueIndex("inuse_objects"), a.prof.ValueIndex("inuse_space")
+		if objIdx < 0 || bytesIdx < 0 {
+			return nil
+		}
+	}
+
+	a.profByRet = make(map[uint64]allocProf)
+	symTab := a.fi.SymTab
+	toAddr := a.profAddrs()
+	for i, s := range a.prof.Samples {
+		if len(s.Values) <= objIdx || len(s.Values) <= bytesIdx {
+			return fmt.Errorf("heap profile sample %d has only %d values", i, len(s.Values))
+		}
+		// Walk up the stack to the first frame outside the
+		// runtime allocator. Its PC is the return address
+		// of the call to the allocation function. (The Go
+		// runtime usually omits the allocator frames
+		// entirely.)
+		for _, pc := range s.PCs {
+			pc = toAddr(pc)
+			name := ""
+			if id, ok := symTab.Addr(pc); ok {
+				name = symTab.Syms()[id].Name
+			}
+			if allocFunc(name) != "" {
+				continue
+			}
+			p := a.profByRet[pc]
+			p.objects += s.Values[objIdx]
+			p.bytes += s.Values[bytesIdx]
+			a.profByRet[pc] = p
+			break
+		}
+	}
+	return nil
+}
+
+// profAddrs returns a function that translates an address in the
+// profiled process to an address in the object file. The profile's
+// first mapping, or any mapping of a file with the same name as the
+// object, is the object, which may have been loaded at a different
+// address, such as a PIE. Other addresses are returned unchanged.
+func (a *AllocAnalysis) profAddrs() func(pc uint64) uint64 {
+	segs, _ := obj.ReadELFSegments(a.fi.Obj)
+	base := filepath.Base(a.fi.Path)
+	return func(pc uint64) uint64 {
+		m := a.prof.FindMapping(pc)
+		if m == nil || m != &a.prof.Mappings[0] && filepath.Base(m.File) != base {
+			return pc
+		}
+		off := pc - m.Start + m.Offset
+		for _, seg := range segs {
+			if seg.Type == "PT_LOAD" && seg.Offset <= off && off-seg.Offset < seg.FileSize {
+				return seg.Addr + (off - seg.Offset)
+			}
+		}
+		return pc
+	}
+}
+
+// AllocSiteJS is an allocation site in the binary-wide report.
+type AllocSiteJS struct {
+	// Sym is the name of the function containing this site.
+	Sym string
+	AllocJS
+	File string `json:",omitempty"`
+	Line int    `json:",omitempty"`
+}
+
+type AllocReportJS struct {
+	// Profile indicates that a heap profile was provided and
+	// sites are ordered by allocated bytes.
+	Profile bool
+	// Total is the total number of allocation sites in the
+	// binary.
+	Total int
+	Sites []AllocSiteJS
+}
+
+// prepare finds all allocation sites if they haven't been already,
+// reporting progress to progress, which may be nil.
+func (a *AllocAnalysis) prepare(progress progressFunc) {
+	a.once.Do(func() { a.analyzeAll(progress) })
+}
+
+func (a *AllocAnalysis) analyzeAll(progress progressFunc) {
+	a.fi.ForEachText(progress, func(id obj.SymID, sym obj.Sym, insts asm.Seq) {
+		for _, alloc := range a.analyzeFunc(sym, insts) {
+			a.sites = append(a.sites, AllocSiteJS{Sym: sym.Name, AllocJS: alloc})
+		}
+	})
+	sort.SliceStable(a.sites, func(i, j int) bool {
+		return a.sites[i].Bytes > a.sites[j].Bytes
+	})
+}
+
+// Report returns the allocation sites in the binary. If there is a
+// heap profile, sites are ordered by allocated bytes. It returns at
+// most n sites.
+func (a *AllocAnalysis) Report(n int) *AllocReportJS {
+	a.prepare(nil)
+
+	report := &AllocReportJS{Profile: a.profByRet != nil, Total: len(a.sites)}
+	sites := a.sites
+	if len(sites) > n {
+		sites = sites[:n]
+	}
+	report.Sites = make([]AllocSiteJS, len(sites))
+	for i, site := range sites {
+		site.File, site.Line = a.fi.Line(uint64(site.PC))
+		report.Sites[i] = site
+	}
+	return report
+}
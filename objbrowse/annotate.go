@@ -0,0 +1,573 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aclements/objbrowse/internal/asm"
+	"github.com/aclements/objbrowse/internal/dwexpr"
+	"github.com/aclements/objbrowse/obj"
+)
+
+// An operandAnnotator attaches notes to the operands of a function's
+// instructions, which the assembly view shows on hover and click. To
+// add a kind of note, add an annotator to operandAnnotators.
+type operandAnnotator struct {
+	name  string
+	title string
+	// annotate adds the notes for function f.
+	annotate func(f *annotateFunc) error
+}
+
+var operandAnnotators = []operandAnnotator{
+	{"reloc", "relocations applied to the operand", annotateRelocs},
+	{"var", "DWARF variables in the operand's register or stack slot", annotateVars},
+	{"string", "strings at the operand's address", annotateStrings},
+	{"profile", "overlay values, such as perf samples, at the instruction", annotateProfile},
+	{"kernel", "Linux kernel exception fixups, alternatives, static branches, and BUG sites", annotateKernel},
+}
+
+// AnnotationsJS is the operand notes of a function.
+type AnnotationsJS struct {
+	// Annotators lists all annotators, and Kinds the names of
+	// those that ran.
+	Annotators []AnnotatorJS
+	Kinds      []string
+	Notes      []OperandNoteJS
+	Errors     []string `json:",omitempty"`
+}
+
+type AnnotatorJS struct {
+	Name  string
+	Title string
+}
+
+// OperandNoteJS is a note on operand Arg of the instruction at PC,
+// where Arg indexes Disasm.Args. An Arg of -1 means the note is about
+// the instruction as a whole. Kind is the annotator's name.
+type OperandNoteJS struct {
+	PC   AddrJS
+	Arg  int
+	Kind string
+	Text string
+	// Link is the URL of a page about the note's subject, such
+	// as the symbol a relocation refers to.
+	Link string `json:",omitempty"`
+}
+
+// annotateFunc is a function being annotated, with the analyses
+// annotators share.
+type annotateFunc struct {
+	s      *state
+	sym    obj.Sym
+	insts  asm.Seq
+	tables []asm.JumpTable
+	// relocs are the relocations applied to the function's bytes.
+	relocs []obj.Reloc
+	// refs are the operand addresses formed by earlier
+	// instructions.
+	refs []asm.AddrRef
+
+	kind  string
+	notes []OperandNoteJS
+}
+
+// add adds a note of the current kind.
+func (f *annotateFunc) add(pc uint64, arg int, text, link string) {
+	f.notes = append(f.notes, OperandNoteJS{AddrJS(pc), arg, f.kind, text, link})
+}
+
+// inst returns the index of the instruction containing addr, if any.
+func (f *annotateFunc) inst(addr uint64) (int, bool) {
+	n := f.insts.Len()
+	i := sort.Search(n, func(i int) bool {
+		inst := f.insts.Get(i)
+		return inst.PC()+uint64(inst.Len()) > addr
+	})
+	if i == n || f.insts.Get(i).PC() > addr {
+		return -1, false
+	}
+	return i, true
+}
+
+// annotations runs the annotators named by kinds, or all annotators
+// if kinds is nil, on function id.
+func (s *state) annotations(id obj.SymID, kinds []string) (*AnnotationsJS, error) {
+	sym := s.symTab.Syms()[id]
+	if sym.Kind != obj.SymText {
+		return nil, fmt.Errorf("%s is not a function", sym.Name)
+	}
+	a := s.bin.Info().Arch
+	if a == nil || !asm.Supported(a) {
+		return nil, fmt.Errorf("disassembly of %s is not supported", s.bin.Info().Format)
+	}
+	data, err := s.bin.SymbolData(id)
+	if err != nil {
+		return nil, err
+	}
+	insts, err := asm.Disasm(a, data.P, sym.Value)
+	if err != nil {
+		return nil, err
+	}
+	read := func(addr, size uint64) []byte {
+		data, err := s.bin.Data(addr, size)
+		if err != nil {
+			return nil
+		}
+		return data.P
+	}
+	f := &annotateFunc{s: s, sym: sym, insts: insts}
+	f.tables = asm.JumpTables(insts, sym.Value, sym.Value+sym.Size, read)
+	f.refs = asm.AddrRefs(insts, f.tables)
+	f.relocs = make([]obj.Reloc, data.R.Len())
+	for i := range f.relocs {
+		data.R.Get(i, &f.relocs[i])
+	}
+
+	out := &AnnotationsJS{Kinds: []string{}}
+	want := make(map[string]bool)
+	for _, k := range kinds {
+		want[k] = true
+	}
+	for _, an := range operandAnnotators {
+		out.Annotators = append(out.Annotators, AnnotatorJS{an.name, an.title})
+		if kinds != nil && !want[an.name] {
+			continue
+		}
+		out.Kinds = append(out.Kinds, an.name)
+		f.kind = an.name
+		if err := an.annotate(f); err != nil {
+			out.Errors = append(out.Errors, fmt.Sprintf("%s: %v", an.name, err))
+		}
+	}
+	out.Notes = f.notes
+	if out.Notes == nil {
+		out.Notes = []OperandNoteJS{}
+	}
+	sort.SliceStable(out.Notes, func(i, j int) bool {
+		x, y := &out.Notes[i], &out.Notes[j]
+		if x.PC != y.PC {
+			return x.PC < y.PC
+		}
+		return x.Arg < y.Arg
+	})
+	return out, nil
+}
+
+// annotateRelocs notes the relocations applied to each operand.
+func annotateRelocs(f *annotateFunc) error {
+	for i := range f.relocs {
+		r := &f.relocs[i]
+		j, ok := f.inst(r.Offset)
+		if !ok {
+			continue
+		}
+		inst := f.insts.Get(j)
+		target := f.s.relocTarget(r)
+		text := r.Type.String()
+		if target != "" {
+			text += " " + target
+		}
+		if r.Addend != 0 {
+			text += fmt.Sprintf("%+#x", r.Addend)
+		}
+		link := ""
+		if target != "" && !strings.HasPrefix(target, ".") {
+			link = "/s/" + target
+		}
+		f.add(inst.PC(), asm.ArgAt(inst, int(r.Offset-inst.PC()), int(r.Size)), text, link)
+	}
+	return nil
+}
+
+// stackRegs names the stack and frame pointers of each architecture
+// StackDepths supports, as DWARF registers.
+var stackRegs = map[string][2]string{
+	"amd64": {"RSP", "RBP"},
+	"386":   {"ESP", "EBP"},
+}
+
+// annotateVars notes the DWARF variables that live in each operand's
+// register or stack slot. It evaluates the variables' locations
+// symbolically, with the stack pointer on entry at an arbitrary
+// address, so stack slots can be matched to memory operands based on
+// the stack or frame pointer.
+func annotateVars(f *annotateFunc) error {
+	if _, err := f.s.fi.DWARF(); err != nil {
+		// Without DWARF, there are no variables to note.
+		return nil
+	}
+	fv, err := f.s.varView.funcVars(f.sym.Value)
+	if fv == nil || err != nil {
+		return err
+	}
+	a := f.s.bin.Info().Arch
+	regs, ok := stackRegs[a.GoArch]
+	if !ok {
+		return nil
+	}
+	spReg, _ := a.DWARFReg(regs[0])
+	fpReg, _ := a.DWARFReg(regs[1])
+	depths := asm.StackDepths(f.insts, f.tables)
+
+	// entry is the symbolic value of the stack pointer on entry.
+	// The call pushed the return address below the CFA.
+	const entry = 1 << 40
+	for i := 0; i < f.insts.Len(); i++ {
+		inst := f.insts.Get(i)
+		pc := inst.PC()
+		ops := asm.Operands(inst)
+		fr := &dwexpr.Frame{Regs: make(map[uint64]uint64), CFA: entry + uint64(a.PtrSize), HasCFA: true}
+		fr.Addrx = func(i uint64) (uint64, bool) {
+			return fv.locs.AddrIndex(&fv.unit, i)
+		}
+		d := depths[pc]
+		if d.HasSP {
+			fr.Regs[spReg] = uint64(entry - d.SP)
+		}
+		if d.HasFP {
+			fr.Regs[fpReg] = uint64(entry - d.FP)
+		}
+		fv.setFrameBase(pc, fr)
+
+		// slot returns the address of memory operand o, if
+		// it's in the stack frame.
+		slot := func(o asm.Operand) (uint64, bool) {
+			if o.Kind != asm.OperandMem || o.Index != "" {
+				return 0, false
+			}
+			base, ok := a.DWARFReg(o.Reg)
+			if !ok || (base != spReg && base != fpReg) {
+				return 0, false
+			}
+			v, ok := fr.Regs[base]
+			return v + uint64(o.Disp), ok
+		}
+		// match notes the operands in location l, which holds
+		// bytes [off, off+size) of variable v.
+		var match func(v *funcVar, l dwexpr.Location, off, size uint64)
+		match = func(v *funcVar, l dwexpr.Location, off, size uint64) {
+			name := v.js.Name
+			if v.js.Param {
+				name = "param " + name
+			}
+			if v.js.Type != "" {
+				name += " " + v.js.Type
+			}
+			if l.Kind == dwexpr.LocPieces {
+				for _, p := range l.Pieces {
+					match(v, p.Location, off, p.BitSize/8)
+					off += p.BitSize / 8
+				}
+				return
+			}
+			for arg, o := range ops {
+				text := ""
+				switch l.Kind {
+				case dwexpr.LocReg:
+					reg := a.DWARFRegName(l.Reg)
+					switch {
+					case o.Kind == asm.OperandReg && o.Reg == reg:
+						text = name
+						if off != 0 || size != uint64(v.size) {
+							text += fmt.Sprintf(" (bytes %d–%d)", off, off+size)
+						}
+					case o.Kind == asm.OperandMem && o.Reg == reg:
+						text = "address based on " + name
+					case o.Kind == asm.OperandMem && o.Index == reg:
+						text = "address indexed by " + name
+					}
+				case dwexpr.LocMem:
+					if addr, ok := slot(o); ok && l.Addr <= addr && addr-l.Addr < size {
+						text = name
+						if at := off + addr - l.Addr; at != 0 {
+							text += fmt.Sprintf(" (at byte %d)", at)
+						}
+					}
+				}
+				if text != "" {
+					f.add(pc, arg, text, "")
+				}
+			}
+		}
+		for vi := range fv.vars {
+			v := &fv.vars[vi]
+			expr, ok := v.loc.at(pc)
+			if !ok {
+				continue
+			}
+			l, err := dwexpr.Eval(expr, fv.enc, fr)
+			if err != nil {
+				continue
+			}
+			size := uint64(v.size)
+			if v.size <= 0 {
+				size = 1
+			}
+			match(v, l, 0, size)
+		}
+	}
+	return nil
+}
+
+// maxNoteString limits the length of strings shown in notes.
+const maxNoteString = 64
+
+// annotateStrings notes the strings at the addresses of operands that
+// refer to read-only data.
+func annotateStrings(f *annotateFunc) error {
+	s := f.s
+	refs := make(map[uint64][]asm.AddrRef)
+	for _, r := range f.refs {
+		refs[r.PC] = append(refs[r.PC], r)
+	}
+	done := make(map[[2]uint64]bool)
+	note := func(i, arg int, p []byte, goStr bool) {
+		pc := f.insts.Get(i).PC()
+		if arg < 0 || done[[2]uint64{pc, uint64(arg)}] {
+			return
+		}
+		var str string
+		var ok bool
+		if goStr {
+			str, ok = goString(p, f.strLen(i))
+		} else {
+			str, ok = cString(p)
+		}
+		if ok {
+			done[[2]uint64{pc, uint64(arg)}] = true
+			f.add(pc, arg, str, "")
+		}
+	}
+
+	if s.bin.Info().Relocatable {
+		// Nothing has an address yet, so follow the
+		// relocations to the data they refer to.
+		syms := s.symTab.Syms()
+		sects := s.bin.Sections()
+		for i := range f.relocs {
+			r := &f.relocs[i]
+			j, ok := f.inst(r.Offset)
+			if !ok || r.Symbol < 0 || int(r.Symbol) >= len(syms) {
+				continue
+			}
+			inst := f.insts.Get(j)
+			target := &syms[r.Symbol]
+			if target.Section < 0 || target.Section >= len(sects) || !isRODataSection(sects[target.Section].Name) {
+				continue
+			}
+			addr := target.Value + uint64(r.Addend)
+			if off, size, _ := inst.PCRel(); size > 0 && inst.PC()+uint64(off) == r.Offset {
+				// The operand is relative to the end of
+				// the instruction, not the field.
+				addr += inst.PC() + uint64(inst.Len()) - r.Offset
+			}
+			data, err := s.bin.SectionData(target.Section)
+			if err != nil || addr < data.Addr || addr-data.Addr >= uint64(len(data.P)) {
+				continue
+			}
+			note(j, asm.ArgAt(inst, int(r.Offset-inst.PC()), int(r.Size)), data.P[addr-data.Addr:], false)
+		}
+		return nil
+	}
+
+	for i := 0; i < f.insts.Len(); i++ {
+		inst := f.insts.Get(i)
+		pc := inst.PC()
+		if inst.Control().Type != asm.ControlNone {
+			continue
+		}
+		for arg, o := range asm.Operands(inst) {
+			if (o.Kind == asm.OperandMem && o.PCRel) || o.Kind == asm.OperandImm {
+				if p, goStr, ok := s.roData(o.Value); ok {
+					note(i, arg, p, goStr)
+				}
+			}
+		}
+		for _, r := range refs[pc] {
+			if p, goStr, ok := s.roData(r.Addr); ok {
+				note(i, r.Arg, p, goStr)
+			}
+		}
+	}
+	return nil
+}
+
+// isRODataSection reports whether a section named name holds
+// read-only data, such as string literals.
+func isRODataSection(name string) bool {
+	for _, prefix := range []string{".rodata", ".rdata", "__cstring", "__const"} {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// roData returns the bytes from addr to the end of its symbol, up to
+// maxNoteString, if addr is in read-only data. goStr indicates addr is
+// in the Go linker's string data. C string literals often have no
+// symbol, so this also accepts addresses outside symbols in read-only
+// data sections.
+func (s *state) roData(addr uint64) (p []byte, goStr bool, ok bool) {
+	end := addr + maxNoteString
+	if ms := s.symTab.AddrAll(addr); len(ms) > 0 {
+		for _, m := range ms {
+			sym := &s.symTab.Syms()[m.ID]
+			if sym.Kind != obj.SymROData {
+				return nil, false, false
+			}
+			if strings.HasPrefix(sym.Name, "go:string.") || strings.HasPrefix(sym.Name, "go.string.") {
+				goStr = true
+			}
+			if sym.Size > 0 && sym.Value+sym.Size < end {
+				end = sym.Value + sym.Size
+			}
+		}
+	} else {
+		found := false
+		for _, sect := range s.bin.Sections() {
+			if sect.Addr <= addr && addr-sect.Addr < sect.Size && !sect.Zero && isRODataSection(sect.Name) {
+				found = true
+				if sect.Addr+sect.Size < end {
+					end = sect.Addr + sect.Size
+				}
+				break
+			}
+		}
+		if !found {
+			return nil, false, false
+		}
+	}
+	data, err := s.bin.Data(addr, end-addr)
+	if err != nil || len(data.P) == 0 {
+		return nil, false, false
+	}
+	return data.P, goStr, true
+}
+
+// strLen returns the length of a Go string whose data instruction i
+// loads, or -1 if it isn't apparent. Go passes a string's length
+// right after its pointer, so this looks for a small immediate in the
+// next couple of instructions.
+func (f *annotateFunc) strLen(i int) int {
+	for j := i + 1; j < f.insts.Len() && j <= i+2; j++ {
+		inst := f.insts.Get(j)
+		if inst.Control().Type != asm.ControlNone {
+			break
+		}
+		for _, o := range asm.Operands(inst) {
+			if o.Kind == asm.OperandImm && o.Value > 0 && o.Value <= maxNoteString {
+				return int(o.Value)
+			}
+		}
+	}
+	return -1
+}
+
+// printable returns the length of the printable text at the start of
+// p, up to maxNoteString bytes.
+func printable(p []byte) int {
+	n := 0
+	for n < len(p) && n < maxNoteString {
+		r, size := utf8.DecodeRune(p[n:])
+		if r == utf8.RuneError || (r < ' ' && r != '\t' && r != '\n') || r == 0x7f {
+			break
+		}
+		n += size
+	}
+	return n
+}
+
+// cString returns the NUL-terminated string at the start of p,
+// quoted, if it's printable.
+func cString(p []byte) (string, bool) {
+	n := printable(p)
+	if n < 2 || n >= len(p) || p[n] != 0 {
+		return "", false
+	}
+	return strconv.Quote(string(p[:n])), true
+}
+
+// goString returns the Go string data at the start of p, quoted, if
+// it's printable. Go strings aren't terminated, so length is the
+// string's probable length, or -1 if it isn't known, in which case
+// the string is shown with an ellipsis.
+func goString(p []byte, length int) (string, bool) {
+	n := printable(p)
+	if length > 0 && length <= n {
+		return strconv.Quote(string(p[:length])), true
+	}
+	if n < 4 {
+		return "", false
+	}
+	return strconv.Quote(string(p[:n])) + "…", true
+}
+
+// annotateProfile notes the values of overlays, such as perf sample
+// counts, at each instruction. Taken-branch counts are attached to
+// the branch target.
+func annotateProfile(f *annotateFunc) error {
+	for _, o := range overlays.forRange(f.sym.Value, f.sym.Value+f.sym.Size) {
+		for _, e := range o.Entries {
+			if e.Value == nil {
+				continue
+			}
+			text := fmt.Sprintf("%s: %g", o.Name, *e.Value)
+			if e.Label != "" {
+				text += " (" + e.Label + ")"
+			}
+			addr := uint64(e.Start)
+			if addr < f.sym.Value {
+				addr = f.sym.Value
+			}
+			for addr < uint64(e.End) {
+				i, ok := f.inst(addr)
+				if !ok {
+					break
+				}
+				inst := f.insts.Get(i)
+				arg := -1
+				if o.Name == perfBranchesOverlay {
+					for j, op := range asm.Operands(inst) {
+						if op.Kind == asm.OperandRel {
+							arg = j
+						}
+					}
+				}
+				f.add(inst.PC(), arg, text, "")
+				addr = inst.PC() + uint64(inst.Len())
+			}
+		}
+	}
+	return nil
+}
+
+// serveSymAnnotations serves the operand notes of function id as
+// JSON. The "kinds" query parameter is a comma-separated list of the
+// annotators to run; the default is all of them.
+func (s *state) serveSymAnnotations(w http.ResponseWriter, r *http.Request, id obj.SymID) {
+	var kinds []string
+	if k, ok := r.URL.Query()["kinds"]; ok {
+		kinds = []string{}
+		for _, name := range strings.Split(k[0], ",") {
+			if name != "" {
+				kinds = append(kinds, name)
+			}
+		}
+	}
+	notes, err := s.annotations(id, kinds)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	serveJSON(w, notes)
+}
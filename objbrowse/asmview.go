@@ -5,30 +5,65 @@
 package main
 
 import (
+	"fmt"
+	"io"
 	"os"
 	"strings"
 
 	"github.com/aclements/objbrowse/internal/asm"
-	"github.com/aclements/objbrowse/internal/obj"
 	"github.com/aclements/objbrowse/internal/ssa"
 	"github.com/aclements/objbrowse/internal/symtab"
+	"github.com/aclements/objbrowse/obj"
 )
 
+// ssaDump, if non-nil, receives the SSA form of each function as it's
+// disassembled. This is a debugging aid.
+var ssaDump io.Writer = os.Stdout
+
 type AsmView struct {
 	fi     *FileInfo
 	symTab *symtab.Table
 
 	liveness *LivenessOverlay
+	stack    *StackAnalysis
+	checks   *CheckAnalysis
+	allocs   *AllocAnalysis
 }
 
-func NewAsmView(fi *FileInfo, symTab *symtab.Table) (*AsmView, error) {
-	return &AsmView{fi, symTab, NewLivenessOverlay(fi, symTab)}, nil
+func NewAsmView(fi *FileInfo, symTab *symtab.Table, stack *StackAnalysis, checks *CheckAnalysis, allocs *AllocAnalysis) (*AsmView, error) {
+	return &AsmView{fi, symTab, NewLivenessOverlay(fi, symTab), stack, checks, allocs}, nil
 }
 
 type AsmViewJS struct {
 	Insts  []Disasm
 	LastPC AddrJS
 
+	// Files is the table of source file names referenced by
+	// Disasm.File. Files[0] is always "".
+	Files []string `json:",omitempty"`
+	// Stack describes the function's stack frame and stack
+	// growth check.
+	Stack *StackFuncJS `json:",omitempty"`
+	// Checks lists the bounds, nil, and other safety checks in
+	// the function.
+	Checks []CheckJS `json:",omitempty"`
+	// Allocs lists the heap allocation sites in the function.
+	Allocs []AllocJS `json:",omitempty"`
+	// JumpTables lists the tables of jump targets used by
+	// indirect jumps in the function.
+	JumpTables []JumpTableJS `json:",omitempty"`
+	// IndirectCalls lists the probable targets of indirect calls
+	// in the function.
+	IndirectCalls []IndirectCallJS `json:",omitempty"`
+
+	// HasGoInline indicates Insts[i].GoInline is populated from
+	// the Go runtime's inline tree.
+	HasGoInline bool `json:",omitempty"`
+	// Positions is where Insts[i].File and Line come from:
+	// "dwarf", "pclntab" if there's no DWARF but there is a Go
+	// function table, or "" if there are no source positions.
+	Positions string `json:",omitempty"`
+
 	Liveness interface{} `json:",omitempty"`
 }
 
@@ -37,6 +72,63 @@ type Disasm struct {
 	Op      string
 	Args    []string
 	Control ControlJS
+
+	// File and Line give the source position of this
+	// instruction. File is an index into AsmViewJS.Files, or 0
+	// if the position is unknown.
+	File int `json:",omitempty"`
+	Line int `json:",omitempty"`
+	// Inline is the stack of inlined functions at this
+	// instruction, from outermost to innermost, according to
+	// DWARF.
+	Inline []string `json:",omitempty"`
+	// GoInline is the stack of inlined functions at this
+	// instruction according to the Go runtime's inline tree.
+	GoInline []string `json:",omitempty"`
+	// Aliases lists, for each symbolized operand address
+	// covered by more than one symbol, all of the covering
+	// symbols. The symbol used in Args is first.
+	Aliases []DisasmAliasesJS `json:",omitempty"`
+	// Refs lists the operands whose addresses are formed by
+	// earlier instructions and fall in a symbol.
+	Refs []DisasmRefJS `json:",omitempty"`
+	// Data indicates this is a pseudo-instruction for bytes that
+	// couldn't be decoded, such as data in the text section.
+	Data bool `json:",omitempty"`
+}
+
+// JumpTableJS is a table of jump targets used by the indirect jump at
+// PC. Targets[i] is the target of table index i.
+type JumpTableJS struct {
+	PC      AddrJS
+	Addr    AddrJS
+	Sym     string `json:",omitempty"` // Symbol containing the table
+	Targets []AddrJS
+}
+
+// IndirectCallJS is the probable target of the indirect call at PC,
+// which loads its target from the slot at Via, such as a GOT entry,
+// a func value, or an itab method.
+type IndirectCallJS struct {
+	PC       AddrJS
+	Target   string
+	TargetPC AddrJS `json:",omitempty"` // 0 if Target is dynamic
+	Via      string
+}
+
+// DisasmRefJS is an operand whose address Addr, at offset Off in
+// symbol Sym, is formed by earlier instructions. Arg is the index of
+// the operand in Disasm.Args.
+type DisasmRefJS struct {
+	Arg  int
+	Addr AddrJS
+	Sym  string
+	Off  uint64 `json:",omitempty"`
+}
+
+type DisasmAliasesJS struct {
+	Addr AddrJS
+	Syms []string
 }
 
 type ControlJS struct {
@@ -57,14 +149,29 @@ func (v *AsmView) DecodeSym(sym obj.Sym, data []byte) (interface{}, error) {
 		return nil, err
 	}
 
-	if true { // TODO
-		bbs, err := asm.BasicBlocks(insts)
+	read := func(addr, size uint64) []byte {
+		data, err := v.fi.Obj.Data(addr, size)
+		if err != nil {
+			return nil
+		}
+		return data.P
+	}
+	tables := asm.JumpTables(insts, sym.Value, sym.Value+sym.Size, read)
+	refs := make(map[uint64][]DisasmRefJS)
+	for _, r := range asm.AddrRefs(insts, tables) {
+		if name, base := v.symTab.SymName(r.Addr); name != "" {
+			refs[r.PC] = append(refs[r.PC], DisasmRefJS{r.Arg, AddrJS(r.Addr), name, r.Addr - base})
+		}
+	}
+
+	if ssaDump != nil { // TODO
+		bbs, err := asm.BasicBlocksTables(insts, tables)
 		if err != nil {
 			return nil, err
 		}
 
 		f := ssa.SSA(insts, bbs)
-		f.Fprint(os.Stdout)
+		f.Fprint(ssaDump)
 	}
 
 	//var lines []string
@@ -77,7 +184,14 @@ func (v *AsmView) DecodeSym(sym obj.Sym, data []byte) (interface{}, error) {
 		// in a hex dump. It would be way better if we could
 		// do something like printing the string or resolving
 		// the pointer in the funcval.
-		disasm := inst.GoSyntax(v.symTab.SymName)
+		var aliases []DisasmAliasesJS
+		disasm := inst.GoSyntax(func(addr uint64) (string, uint64) {
+			name, base := v.symTab.SymName(addr)
+			if name != "" {
+				aliases = v.addAliases(aliases, addr)
+			}
+			return name, base
+		})
 		op, args := parseAsm(disasm)
 		control := inst.Control()
 		//r, w := inst.Effects()
@@ -92,10 +206,36 @@ func (v *AsmView) DecodeSym(sym obj.Sym, data []byte) (interface{}, error) {
 				Conditional: control.Conditional,
 				TargetPC:    AddrJS(control.TargetPC),
 			},
+			Aliases: aliases,
+			Refs:    refs[inst.PC()],
+			Data:    asm.IsData(op),
 		})
 		info.LastPC = AddrJS(inst.PC() + uint64(inst.Len()))
 	}
 	info.Insts = disasms
+	for _, t := range tables {
+		js := JumpTableJS{PC: AddrJS(t.PC), Addr: AddrJS(t.Addr)}
+		js.Sym, _ = v.symTab.SymName(t.Addr)
+		for _, pc := range t.Targets {
+			js.Targets = append(js.Targets, AddrJS(pc))
+		}
+		info.JumpTables = append(info.JumpTables, js)
+	}
+	for _, c := range asm.IndirectCalls(insts, read) {
+		if js, ok := v.indirectTarget(c, read); ok {
+			info.IndirectCalls = append(info.IndirectCalls, js)
+		}
+	}
+
+	// Attribute instructions to source lines. This is best
+	// effort, since there may be no DWARF.
+	v.addSourcePositions(sym, &info)
+	v.addGoInline(sym, &info)
+
+	stack, _ := v.stack.analyzeFunc(sym, insts)
+	info.Stack = &stack
+	info.Checks = v.checks.analyzeFunc(sym, insts)
+	info.Allocs = v.allocs.analyzeFunc(sym, insts)
 
 	// Process liveness information.
 	l, err := v.liveness.liveness(sym, insts)
@@ -108,6 +248,67 @@ func (v *AsmView) DecodeSym(sym obj.Sym, data []byte) (interface{}, error) {
 	return &info, nil
 }
 
+// indirectTarget resolves the target of indirect call c from its
+// slot. If the slot is relocated at load time, like a GOT entry, the
+// target is the relocation's symbol. Otherwise, it's the function the
+// slot initially points to.
+func (v *AsmView) indirectTarget(c asm.IndirectCall, read func(addr, size uint64) []byte) (IndirectCallJS, bool) {
+	js := IndirectCallJS{PC: AddrJS(c.PC), Via: v.fi.addrName(c.Slot)}
+	if js.Via == "" {
+		// GOT slots are usually unnamed.
+		js.Via = fmt.Sprintf("%#x", c.Slot)
+		for _, sect := range v.fi.Obj.Sections() {
+			if sect.Addr <= c.Slot && c.Slot-sect.Addr < sect.Size {
+				js.Via = fmt.Sprintf("%s+%#x", sect.Name, c.Slot-sect.Addr)
+				break
+			}
+		}
+	}
+	if js.Target = v.fi.RelocTarget(c.Slot); js.Target != "" {
+		return js, true
+	}
+	arch := v.fi.Obj.Info().Arch
+	data := read(c.Slot, uint64(arch.PtrSize))
+	if len(data) < arch.PtrSize {
+		return js, false
+	}
+	var target uint64
+	if arch.PtrSize == 8 {
+		target = arch.ByteOrder.Uint64(data)
+	} else {
+		target = uint64(arch.ByteOrder.Uint32(data))
+	}
+	id, ok := v.symTab.Addr(target)
+	if !ok {
+		return js, false
+	}
+	tsym := v.symTab.Syms()[id]
+	if tsym.Kind != obj.SymText || tsym.Value != target {
+		return js, false
+	}
+	js.Target, js.TargetPC = tsym.Name, AddrJS(target)
+	return js, true
+}
+
+// addAliases appends the symbols covering addr to aliases if there
+// is more than one.
+func (v *AsmView) addAliases(aliases []DisasmAliasesJS, addr uint64) []DisasmAliasesJS {
+	for _, a := range aliases {
+		if uint64(a.Addr) == addr {
+			return aliases
+		}
+	}
+	matches := v.symTab.AddrAll(addr)
+	if len(matches) < 2 {
+		return aliases
+	}
+	a := DisasmAliasesJS{Addr: AddrJS(addr)}
+	for _, m := range matches {
+		a.Syms = append(a.Syms, v.symTab.Syms()[m.ID].Name)
+	}
+	return append(aliases, a)
+}
+
 func parseAsm(disasm string) (op string, args []string) {
 	i := strings.Index(disasm, " ")
 	// Include prefixes in op. In Go syntax, these are followed by
@@ -127,3 +328,104 @@ func parseAsm(disasm string) (op string, args []string) {
 	args = strings.Split(disasm, ", ")
 	return
 }
+
+// addSourcePositions annotates the instructions in info with their
+// source positions and inlining stacks from DWARF.
+func (v *AsmView) addSourcePositions(sym obj.Sym, info *AsmViewJS) {
+	lines, err := v.fi.LineTable(sym.Value, sym.Value+sym.Size)
+	if err != nil {
+		v.addGoPositions(sym, info)
+		return
+	}
+	inlines, _ := v.fi.InlineRanges(sym.Value)
+
+	info.Positions = "dwarf"
+	info.Files = []string{""}
+	fileIdx := map[string]int{}
+	li := 0
+	for i := range info.Insts {
+		inst := &info.Insts[i]
+		pc := uint64(inst.PC)
+
+		// Advance to the last line table row at or before pc.
+		// Line table rows are in address order within a
+		// sequence.
+		for li+1 < len(lines) && lines[li+1].Address <= pc && !lines[li].EndSequence {
+			li++
+		}
+		if li < len(lines) && lines[li].Address <= pc && !lines[li].EndSequence && lines[li].File != nil {
+			name := lines[li].File.Name
+			idx, ok := fileIdx[name]
+			if !ok {
+				idx = len(info.Files)
+				info.Files = append(info.Files, name)
+				fileIdx[name] = idx
+			}
+			inst.File, inst.Line = idx, lines[li].Line
+		}
+
+		// Collect the inline stack. Inline ranges are in tree
+		// order, so outer calls come first.
+		for _, r := range inlines {
+			if r.Low <= pc && pc < r.High && r.Depth == len(inst.Inline)+1 {
+				inst.Inline = append(inst.Inline, r.Func)
+			}
+		}
+	}
+}
+
+// addGoPositions annotates the instructions in info with their source
+// positions from the Go function table. This is a reduced fallback
+// for when there's no DWARF: there are no column numbers, and
+// inlining stacks come only from addGoInline.
+func (v *AsmView) addGoPositions(sym obj.Sym, info *AsmViewJS) {
+	fn := v.fi.Func(sym.Value)
+	if fn == nil {
+		return
+	}
+	files, lines := fn.PCFile.Decode(), fn.PCLn.Decode()
+
+	info.Positions = "pclntab"
+	info.Files = []string{""}
+	fileIdx := map[string]int{}
+	for i := range info.Insts {
+		inst := &info.Insts[i]
+		pc := uint64(inst.PC)
+		file, ok1 := files.Lookup(pc)
+		line, ok2 := lines.Lookup(pc)
+		if !ok1 || !ok2 {
+			continue
+		}
+		name := fn.FileName(file)
+		if name == "" {
+			continue
+		}
+		idx, ok := fileIdx[name]
+		if !ok {
+			idx = len(info.Files)
+			info.Files = append(info.Files, name)
+			fileIdx[name] = idx
+		}
+		inst.File, inst.Line = idx, int(line)
+	}
+}
+
+// addGoInline annotates the instructions in info with their inlining
+// stacks from the Go runtime's inline tree.
+func (v *AsmView) addGoInline(sym obj.Sym, info *AsmViewJS) {
+	fn := v.fi.Func(sym.Value)
+	if fn == nil {
+		return
+	}
+	tree, err := fn.InlineTree()
+	if err != nil {
+		return
+	}
+	info.HasGoInline = true
+	for i := range info.Insts {
+		inst := &info.Insts[i]
+		for _, call := range tree.Stack(uint64(inst.PC)) {
+			inst.GoInline = append(inst.GoInline, call.Func)
+		}
+	}
+}
@@ -12,11 +12,13 @@
 // handles rows with AddrJS ranges and column groups for different
 // overlays.
 //
-// Overlays: control flow, liveness, DWARF info for variables (might
-// be better as an operand annotation that only appears for a selected
-// operand), profiling info, data flow/aliasing (might be better as an
-// operand annotation), extra information for resolved symbols (Go
-// string or func object contents, offsets in global structures).
+// Overlays: control flow, liveness, profiling info, data
+// flow/aliasing (might be better as an operand annotation), extra
+// information for resolved symbols (Go func object contents, offsets
+// in global structures).
+//
+// Operand annotations, such as DWARF variables and string contents,
+// come from the annotators in annotate.go. See loadAnnotations.
 
 const ControlJump = 1
 const ControlCall = 2
@@ -30,22 +32,89 @@ class AsmView {
         const view = this;
         const insts = data.Insts;
 
+        // Describe the stack frame.
+        if (data.Stack) {
+            let text = "frame " + (data.Stack.Frame < 0 ? "unknown" : data.Stack.Frame + " bytes");
+            if (data.Stack.Unchecked)
+                text += ", not a Go function";
+            else if (data.Stack.NoSplit)
+                text += ", nosplit";
+            else
+                text += ", stack check at 0x" + data.Stack.CheckPC + ", morestack at 0x" + data.Stack.MorestackPC;
+            $("<div>").addClass("asm-stack").text(text).appendTo(container);
+        }
+
+        // Summarize safety checks and index them by PC.
+        const checks = new Map();
+        if (data.Checks) {
+            const counts = {};
+            for (let check of data.Checks) {
+                counts[check.Kind] = (counts[check.Kind] || 0) + 1;
+                checks.set(check.PC, check.Kind + " check");
+                if (check.GuardPC)
+                    checks.set(check.GuardPC, check.Kind + " check guard");
+            }
+            const parts = Object.keys(counts).sort().map((k) => counts[k] + " " + k);
+            $("<div>").addClass("asm-stack").text("checks: " + parts.join(", ")).appendTo(container);
+        }
+        this.checks = data.Checks || [];
+
+        // Summarize allocation sites.
+        const allocs = new Map();
+        if (data.Allocs) {
+            let bytes = 0;
+            for (let alloc of data.Allocs) {
+                let title = "allocates via runtime." + alloc.Func;
+                if (alloc.Objects || alloc.Bytes)
+                    title += " (" + (alloc.Objects || 0) + " objects, " + (alloc.Bytes || 0) + " bytes)";
+                allocs.set(alloc.PC, title);
+                bytes += alloc.Bytes || 0;
+            }
+            let text = "allocation sites: " + data.Allocs.length;
+            if (bytes)
+                text += ", " + bytes + " bytes allocated";
+            $("<div>").addClass("asm-stack").text(text).appendTo(container);
+        }
+        this.allocs = data.Allocs || [];
+
+        // Index jump tables by jump PC and by target, so targets can
+        // be labeled with their cases.
+        const tableJumps = new Map();
+        const cases = new Map();
+        for (let t of data.JumpTables || []) {
+            tableJumps.set(t.PC, t);
+            t.Targets.forEach((target, i) => {
+                if (!cases.has(target))
+                    cases.set(target, []);
+                cases.get(target).push(i);
+            });
+        }
+
+        // Index the probable targets of indirect calls by call PC.
+        const indirect = new Map();
+        for (let c of data.IndirectCalls || [])
+            indirect.set(c.PC, c);
+
+        if (data.Positions == "pclntab")
+            $("<div>").addClass("asm-stack").text("no DWARF: source positions from the Go function table").appendTo(container);
+
         // Create table.
         const table = $('<table class="disasm">').appendTo(container);
         this._table = table;
 
         // Create table header.
         const groupHeader = $("<thead>").appendTo(table).
-              append($('<td colspan="5">'));
+              append($('<td colspan="6">'));
         const header = $("<thead>").appendTo(table).
-              append($('<td colspan="5">'));
+              append($('<td colspan="6">'));
         const tableInfo = {table: table, groupHeader: groupHeader, header: header};
+        this._tableInfo = tableInfo;
 
         // Create a zero-height TD at the top that will contain the
         // control flow arrows SVG.
         const arrowTD = $("<td>");
         $("<tr>").appendTo(table).
-            append($('<td colspan="4">')).
+            append($('<td colspan="5">')).
             append(arrowTD);
         var arrowSVG;
 
@@ -54,13 +123,49 @@ class AsmView {
         const pcToRow = new Map();
         const pcRanges = [];
         const basePC = new AddrJS(insts[0].PC);
+        const files = data.Files || [""];
+        let prevSrc = "";
         for (var inst of insts) {
-            const args = AsmView._formatArgs(inst.Args);
+            const args = AsmView._formatArgs(inst.Args, inst.Aliases, inst.Refs);
             const pc = new AddrJS(inst.PC);
             const pcDelta = pc.sub(basePC);
+            // Format the source position gutter. Only show the position
+            // when it changes, but always provide it as a tooltip.
+            const srcTD = $("<td>").addClass("pos asm-src");
+            let title = "";
+            if (inst.File) {
+                const path = files[inst.File];
+                const src = path.substring(path.lastIndexOf("/") + 1) + ":" + inst.Line;
+                title = path + ":" + inst.Line;
+                if (inst.Inline)
+                    title += "\ninlined (DWARF): " + inst.Inline.join(" → ");
+                if (src != prevSrc)
+                    srcTD.text(src);
+                if (inst.Inline)
+                    srcTD.addClass("asm-src-inline");
+                prevSrc = src;
+            }
+            if (inst.GoInline) {
+                title += "\ninlined (runtime): " + inst.GoInline.join(" → ");
+                srcTD.addClass("asm-src-inline");
+            }
+            // Flag disagreements between DWARF and the runtime.
+            if (data.Positions == "dwarf" && inst.File && (inst.Inline || []).join() != (inst.GoInline || []).join() &&
+                (data.HasGoInline || inst.GoInline))
+                srcTD.addClass("asm-src-mismatch");
+            if (title)
+                srcTD.attr("title", title.trim());
+            // Label jump table targets with their cases.
+            if (cases.has(inst.PC)) {
+                $("<tr>").addClass("asm-case").
+                    append($('<td colspan="3">'),
+                           $('<td colspan="2">').text("case " + AsmView._formatCases(cases.get(inst.PC)) + ":")).
+                    appendTo(table);
+            }
             // Create the row. The last TD is to extend the highlight over
             // the arrows SVG.
             const row = $("<tr>").
+                  append(srcTD).
                   append($("<td>").text("0x"+inst.PC).addClass("pos")).
                   append($("<td>").text("+0x"+pcDelta).addClass("pos")).
                   append($("<td>").text(inst.Op).addClass("asm-inst")).
@@ -79,12 +184,45 @@ class AsmView {
                     table.append($("<tr>").css({height: "1em"}));
             }
 
+            // Mark bytes that couldn't be decoded.
+            if (inst.Data)
+                row.addClass("asm-data").attr("title", "undecodable bytes, such as data in the text section");
+
+            // Describe jumps through tables.
+            if (tableJumps.has(inst.PC)) {
+                const t = tableJumps.get(inst.PC);
+                row.addClass("asm-jumptable").attr("title",
+                    "jump table at 0x" + t.Addr + (t.Sym ? " (" + t.Sym + ")" : "") + " with " + t.Targets.length + " entries");
+            }
+
+            // Annotate indirect calls with their probable target.
+            if (indirect.has(inst.PC)) {
+                const c = indirect.get(inst.PC);
+                row.addClass("asm-indirect").attr("title", "probable target, loaded from " + c.Via);
+                $("<span>").addClass("asm-indirect-target").
+                    append(" → ", $("<a>").attr("href", symURL(c.Target)).text(c.Target)).
+                    appendTo(row.children()[4]);
+            }
+
+            // Mark the stack growth check.
+            if (data.Stack && (inst.PC == data.Stack.CheckPC || inst.PC == data.Stack.MorestackPC))
+                row.addClass("asm-stackcheck");
+
+            // Mark safety checks.
+            if (checks.has(inst.PC))
+                row.addClass("asm-check").attr("title", checks.get(inst.PC));
+            // Mark allocation sites.
+            if (allocs.has(inst.PC))
+                row.addClass("asm-alloc").attr("title", allocs.get(inst.PC));
+
             // On-click handler.
-            row.click(() => {
-                highlightRanges([pcRanges[rowMeta.i]], view);
+            row.click((ev) => {
+                highlightRanges([extendSelection(pcRanges[rowMeta.i], ev)], view);
             });
         }
         this._rows = rows;
+        this._insts = insts;
+        this._pcToRow = pcToRow;
 
         // Complete the PC ranges.
         for (let i = 1; i < pcRanges.length; i++) {
@@ -99,9 +237,19 @@ class AsmView {
             if (inst.Control.Type == 0)
                 continue;
 
+            if (tableJumps.has(inst.PC)) {
+                // Draw an arrow to each distinct table target.
+                for (let target of new Set(tableJumps.get(inst.PC).Targets)) {
+                    arrows.push({0: pcToRow.get(inst.PC),
+                                 1: pcToRow.get(target),
+                                 pos: 0, control: {Type: ControlJump, Conditional: true, TargetPC: target}});
+                }
+                continue;
+            }
             arrows.push({0: pcToRow.get(inst.PC),
                          1: pcToRow.get(inst.Control.TargetPC),
-                         pos: 0, control: inst.Control});
+                         pos: 0, control: inst.Control,
+                         probable: indirect.has(inst.PC)});
         }
 
         // Sort arrows by length.
@@ -170,7 +318,8 @@ class AsmView {
                     const w = arrowWidth - markerHeight;
                     line.attr("d", "M " + (w + markerHeight) + " " + y + "h" + (-w));
                 } else if (arrow.control.Type == ControlExit || arrow.control.TargetPC != 0 ||
-                           (arrow.control.Type == ControlJump && arrow.control.TargetPC == 0)) {
+                           (arrow.control.Type == ControlJump && arrow.control.TargetPC == 0) ||
+                           arrow.probable) {
                     // Out arrow.
                     // TODO: Some other arrow for dynamic target.
                     const y = r1.elt.offset().top - tdTop + rowHeight / 2;
@@ -180,6 +329,10 @@ class AsmView {
                 }
                 line.attr({stroke: "black", "stroke-width": "2px",
                            fill: "none", "marker-end": marker});
+                // Dash the out arrows of indirect calls, whose
+                // targets are only probable.
+                if (arrow.probable)
+                    line.attr("stroke-dasharray", "3 2");
 
                 // Attach the arrow to the outgoing and incoming
                 // instructions.
@@ -195,12 +348,169 @@ class AsmView {
             new LivenessOverlay(data.Liveness).render(tableInfo, this._pcs);
     }
 
-    static _formatArgs(args) {
+    // summarize returns the number of instructions that overlap
+    // ranges and the symbols they reference, as a map from symbol
+    // name to the number of references.
+    summarize(ranges) {
+        const syms = new Map();
+        let n = 0;
+        for (let match of this._pcs.intersect(ranges)) {
+            n++;
+            for (let arg of this._insts[match.i].Args) {
+                const r = /([^+]*)(\+(0x)?[0-9]+)?\(SB\)/.exec(arg);
+                if (r)
+                    syms.set(r[1], (syms.get(r[1]) || 0) + 1);
+            }
+        }
+        return {insts: n, syms: syms};
+    }
+
+    // rowsInRange returns the table rows of the instructions that
+    // overlap range r.
+    rowsInRange(r) {
+        return this._pcs.intersect([r]).map((m) => m.tr);
+    }
+
+    // markTrace marks rows as the current trace segment and cur as
+    // the current instruction, and scrolls cur into view.
+    markTrace(rows, cur) {
+        $(".asm-trace-seg", this._table).removeClass("asm-trace-seg asm-trace-cur");
+        $(rows).addClass("asm-trace-seg");
+        $(cur).addClass("asm-trace-cur");
+        // Like scrollTo, but only if cur is out of view and without
+        // animation, since this is called repeatedly during playback.
+        const c = $(this._container);
+        const top = $(cur).position().top, height = c.height();
+        if (top < c.scrollTop() || top > c.scrollTop() + height)
+            c.scrollTop(top - height / 3);
+    }
+
+    // addOverlay adds a column for an external overlay.
+    addOverlay(overlay) {
+        new OverlayColumn(overlay).render(this._tableInfo, this._pcs);
+    }
+
+    // _formatCases formats a sorted list of table indexes, collapsing
+    // runs into ranges.
+    static _formatCases(idxs) {
+        const parts = [];
+        for (let i = 0; i < idxs.length; ) {
+            let j = i;
+            while (j + 1 < idxs.length && idxs[j + 1] == idxs[j] + 1)
+                j++;
+            parts.push(j > i ? idxs[i] + "–" + idxs[j] : String(idxs[i]));
+            i = j + 1;
+        }
+        return parts.join(", ");
+    }
+
+    // loadAnnotations fetches the operand notes of function symID
+    // from the annotators the user enabled and marks the operands.
+    loadAnnotations(symID) {
+        const self = this;
+        const kinds = settings.get("asm.annotators", null);
+        const params = kinds === null ? {} : {kinds: kinds.join(",")};
+        $.getJSON("/sym/" + symID + "/annotations", params).done((data) => {
+            self._showAnnotations(symID, data);
+        }).fail((xhr) => {
+            showError("Operand notes", xhr);
+        });
+    }
+
+    _showAnnotations(symID, data) {
+        const self = this;
+        for (let e of data.Errors || [])
+            showError("Operand notes", e);
+
+        // Let the user choose the annotators.
+        if (!this._annotators) {
+            this._annotators = $("<div>").addClass("asm-stack asm-annotators").insertBefore(this._table);
+        }
+        const bar = this._annotators.empty().text("operand notes:");
+        for (let a of data.Annotators) {
+            const box = $('<input type="checkbox">').prop("checked", data.Kinds.includes(a.Name)).change(() => {
+                const kinds = $("input", bar).filter((i, b) => b.checked).map((i, b) => $(b).data("kind")).get();
+                settings.set("asm.annotators", kinds);
+                self.loadAnnotations(symID);
+            }).data("kind", a.Name);
+            $("<label>").attr("title", a.Title).append(box, a.Name).appendTo(bar);
+        }
+
+        // Clear the previous notes.
+        $(".asm-noted", this._table).removeClass("asm-noted").removeAttr("title").off("click.notes");
+
+        // Group the notes by instruction and operand.
+        const byPC = new Map();
+        for (let n of data.Notes) {
+            if (!byPC.has(n.PC))
+                byPC.set(n.PC, []);
+            byPC.get(n.PC).push(n);
+        }
+        for (let [pc, notes] of byPC) {
+            const row = this._pcToRow.get(pc);
+            if (!row)
+                continue;
+            const argsTD = $(row.elt.children()[4]);
+            const byArg = new Map();
+            for (let n of notes) {
+                if (!byArg.has(n.Arg))
+                    byArg.set(n.Arg, []);
+                byArg.get(n.Arg).push(n);
+            }
+            for (let [arg, argNotes] of byArg) {
+                // Notes on the whole instruction go on the
+                // operands cell.
+                const elt = arg < 0 ? argsTD : $(".asm-arg", argsTD).eq(arg);
+                elt.addClass("asm-noted").
+                    attr("title", argNotes.map((n) => n.Kind + ": " + n.Text).join("\n")).
+                    on("click.notes", (ev) => {
+                        if ($(ev.target).closest("a").length)
+                            return; // Follow operand links
+                        ev.stopPropagation();
+                        AsmView._popNotes(argNotes, ev);
+                    });
+            }
+        }
+    }
+
+    // _popNotes shows notes in a box at mouse event ev, which closes
+    // on the next click elsewhere.
+    static _popNotes(notes, ev) {
+        $(".asm-notes-pop").remove();
+        const pop = $("<div>").addClass("asm-notes-pop").css({left: ev.pageX, top: ev.pageY + 12}).
+              click((ev) => { ev.stopPropagation(); }).appendTo(document.body);
+        for (let n of notes) {
+            const div = $("<div>").append($("<span>").addClass("asm-note-kind").text(n.Kind), " ");
+            if (n.Link)
+                div.append($("<a>").attr("href", n.Link).text(n.Text));
+            else
+                div.append(document.createTextNode(n.Text));
+            div.appendTo(pop);
+        }
+        $(document).one("click", () => { pop.remove(); });
+    }
+
+    static _formatArgs(args, aliases, refs) {
         const elts = [];
         var i = 0;
         for (var arg of args) {
             if (i++ > 0)
                 elts.push(document.createTextNode(", "));
+            // Wrap each operand so annotations can find it.
+            const span = $("<span>").addClass("asm-arg");
+            elts.push(span[0]);
+            // Link operands whose addresses were computed by
+            // earlier instructions, after the operand.
+            const ref = (refs || []).find((r) => r.Arg == i - 1);
+            if (ref) {
+                const off = new AddrJS(ref.Off ? ref.Off.toString(16) : "0");
+                const url = symURL(ref.Sym) + "#+" + formatRanges([{start: off, end: off.add(new AddrJS(1))}]);
+                span.append(document.createTextNode(arg + " "));
+                span.append($("<a>").addClass("asm-ref").attr("href", url).
+                          attr("title", "0x" + ref.Addr + ", computed by earlier instructions").
+                          text("⟨" + ref.Sym + (ref.Off ? "+0x" + ref.Off.toString(16) : "") + "⟩")[0]);
+                continue;
+            }
 
             var r;
             if (r = /([^+]*)(\+(0x)?[0-9]+)?\(SB\)/.exec(arg)) {
@@ -208,9 +518,14 @@ class AsmView {
                 const ranges = [{start: new AddrJS(offset),
                                  end: new AddrJS(offset+1)}];
                 const url = "/s/" + r[1] + "#+" + formatRanges(ranges);
-                elts.push($("<a>").attr("href", url).text(arg)[0]);
+                const link = $("<a>").attr("href", url).text(arg);
+                // Show other symbols covering this address.
+                const alias = (aliases || []).find((a) => a.Syms[0] == r[1]);
+                if (alias)
+                    link.attr("title", "0x" + alias.Addr + " is also in:\n" + alias.Syms.slice(1).join("\n"));
+                span.append(link[0]);
             } else {
-                elts.push(document.createTextNode(arg))
+                span.append(document.createTextNode(arg))
             }
         }
         return $(elts);
@@ -238,4 +553,14 @@ class AsmView {
             // TODO: Change color of markers (annoyingly hard without SVG 2)
         }
     }
+
+    // markPeers marks the instructions selected by the other members
+    // of the shared session. peers is a list of {name, color, ranges}.
+    markPeers(peers) {
+        $(".peer-sel", this._table).removeClass("peer-sel").css("box-shadow", "");
+        for (let p of peers) {
+            for (let match of this._pcs.intersect(p.ranges))
+                this._rows[match.i].elt.addClass("peer-sel").css("box-shadow", "inset 4px 0 " + p.color);
+        }
+    }
 }
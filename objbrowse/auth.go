@@ -0,0 +1,149 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// tokenCookie is the cookie that carries the access token once a
+// browser has presented it in the URL. EventSource can't set
+// headers, so pages rely on the cookie.
+const tokenCookie = "objbrowse-token"
+
+// An authPolicy protects the server with an access token, basic
+// auth, or both. Whatever the credentials, it only answers requests
+// addressed to the server and only accepts state-changing requests
+// from its own pages, so other sites can't reach it through the
+// browser. The zero authPolicy checks no credentials.
+type authPolicy struct {
+	token string
+	// user and password are the basic auth credentials, if
+	// user != "".
+	user, password string
+	// loopback is set if the server only listens on a loopback
+	// address, so every request must name a loopback host. This
+	// defeats DNS rebinding. Remote servers rely on credentials.
+	loopback bool
+}
+
+// parseBasicAuth parses a "user:password" basic auth flag.
+func parseBasicAuth(s string) (user, password string, err error) {
+	i := strings.IndexByte(s, ':')
+	if i <= 0 {
+		return "", "", fmt.Errorf("basic auth must be user:password")
+	}
+	return s[:i], s[i+1:], nil
+}
+
+func (p *authPolicy) enabled() bool {
+	return p.token != "" || p.user != ""
+}
+
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// wrap returns a handler that checks each request against p before
+// passing it to h.
+func (p *authPolicy) wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p.loopback && !loopbackHost(r.Host) {
+			http.Error(w, "forbidden: unexpected host "+r.Host, http.StatusForbidden)
+			return
+		}
+		if p.user != "" {
+			user, password, ok := r.BasicAuth()
+			if !ok || !secureEqual(user, p.user) || !secureEqual(password, p.password) {
+				w.Header().Set("WWW-Authenticate", `Basic realm="objbrowse"`)
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		if p.token != "" {
+			if tok := r.URL.Query().Get("token"); tok != "" && secureEqual(tok, p.token) {
+				// Remember the token and strip it from
+				// the URL so it doesn't linger in the
+				// address bar or history.
+				http.SetCookie(w, &http.Cookie{Name: tokenCookie, Value: tok, Path: "/", HttpOnly: true, SameSite: http.SameSiteStrictMode})
+				if r.Method == http.MethodGet {
+					u := *r.URL
+					q := u.Query()
+					q.Del("token")
+					u.RawQuery = q.Encode()
+					http.Redirect(w, r, u.RequestURI(), http.StatusFound)
+					return
+				}
+			} else if !p.checkToken(r) {
+				http.Error(w, "unauthorized: missing or bad access token", http.StatusUnauthorized)
+				return
+			}
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead && crossSite(r) {
+			// Browsers send cookies and basic auth with
+			// cross-site posts, so credentials alone
+			// don't show the user meant to make them.
+			http.Error(w, "forbidden: cross-origin request", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// checkToken reports whether r carries the access token in a bearer
+// Authorization header or the token cookie.
+func (p *authPolicy) checkToken(r *http.Request) bool {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return secureEqual(strings.TrimPrefix(auth, "Bearer "), p.token)
+	}
+	if c, err := r.Cookie(tokenCookie); err == nil {
+		return secureEqual(c.Value, p.token)
+	}
+	return false
+}
+
+// crossSite reports whether r came from a page other than the
+// server's own. Browsers send Origin with every cross-origin POST, and
+// "null" for opaque origins, which are foreign. Tools such as curl and
+// editor plugins send no Origin, so they get through.
+func crossSite(r *http.Request) bool {
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "cross-site", "same-site":
+		// Another port of the same host is same-site.
+		return true
+	}
+	return r.Header.Get("Origin") != "" && !sameOrigin(r)
+}
+
+// sameOrigin reports whether r's Origin header names the server.
+func sameOrigin(r *http.Request) bool {
+	u, err := url.Parse(r.Header.Get("Origin"))
+	return err == nil && u.Host != "" && u.Host == r.Host
+}
+
+// loopbackHost reports whether the Host header host names a loopback
+// address.
+func loopbackHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(host, "["), "]"))
+	return ip != nil && ip.IsLoopback()
+}
+
+// isLoopback reports whether addr is bound only to a loopback
+// interface.
+func isLoopback(addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	return ok && tcp.IP.IsLoopback()
+}
@@ -0,0 +1,114 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLoopbackHost(t *testing.T) {
+	for host, want := range map[string]bool{
+		"localhost":           true,
+		"localhost:7777":      true,
+		"127.0.0.1:7777":      true,
+		"127.1.2.3":           true,
+		"[::1]:7777":          true,
+		"::1":                 true,
+		"evil.example:7777":   false,
+		"localhost.evil:7777": false,
+		"10.0.0.1:7777":       false,
+		"[::ffff:a00:1]:7777": false,
+		"":                    false,
+		"127.0.0.1.evil:7777": false,
+		"localhost:7777:7777": false,
+		"0.0.0.0:7777":        false,
+	} {
+		if got := loopbackHost(host); got != want {
+			t.Errorf("loopbackHost(%q) = %v, want %v", host, got, want)
+		}
+	}
+}
+
+func TestSameOrigin(t *testing.T) {
+	for origin, want := range map[string]bool{
+		"http://localhost:7777":  true,
+		"https://localhost:7777": true,
+		"http://localhost:8080":  false,
+		"http://localhost":       false,
+		"http://evil.example":    false,
+		"null":                   false,
+		"":                       false,
+	} {
+		r := httptest.NewRequest("POST", "http://localhost:7777/overlay", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		if got := sameOrigin(r); got != want {
+			t.Errorf("sameOrigin with Origin %q = %v, want %v", origin, got, want)
+		}
+	}
+}
+
+func TestAuthWrap(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	type req struct {
+		method, host string
+		header       map[string]string
+		want         int
+	}
+	for _, test := range []struct {
+		name   string
+		policy authPolicy
+		reqs   []req
+	}{
+		{"loopback", authPolicy{loopback: true}, []req{
+			{"GET", "localhost:7777", nil, 200},
+			{"GET", "evil.example:7777", nil, 403},
+			// Tools send no Origin.
+			{"POST", "127.0.0.1:7777", nil, 200},
+			{"POST", "localhost:7777", map[string]string{"Origin": "http://localhost:7777"}, 200},
+			{"POST", "localhost:7777", map[string]string{"Origin": "http://evil.example"}, 403},
+			{"POST", "localhost:7777", map[string]string{"Origin": "null"}, 403},
+			{"DELETE", "localhost:7777", map[string]string{"Origin": "http://localhost:8080"}, 403},
+			{"POST", "localhost:7777", map[string]string{"Sec-Fetch-Site": "same-site"}, 403},
+			{"POST", "localhost:7777", map[string]string{"Sec-Fetch-Site": "same-origin", "Origin": "http://localhost:7777"}, 200},
+			// Cross-site GETs are harmless.
+			{"GET", "localhost:7777", map[string]string{"Origin": "http://evil.example"}, 200},
+		}},
+		{"remote", authPolicy{}, []req{
+			{"GET", "objbrowse.example", nil, 200},
+			{"POST", "objbrowse.example", map[string]string{"Origin": "http://objbrowse.example"}, 200},
+			{"POST", "objbrowse.example", map[string]string{"Origin": "http://evil.example"}, 403},
+		}},
+		{"token", authPolicy{token: "tok", loopback: true}, []req{
+			{"GET", "localhost:7777", nil, 401},
+			{"POST", "localhost:7777", map[string]string{"Authorization": "Bearer tok"}, 200},
+			{"POST", "localhost:7777", map[string]string{"Authorization": "Bearer bad"}, 401},
+			{"POST", "localhost:7777", map[string]string{"Cookie": tokenCookie + "=tok"}, 200},
+			{"POST", "localhost:7777", map[string]string{"Cookie": tokenCookie + "=tok", "Origin": "http://evil.example"}, 403},
+		}},
+		{"basic", authPolicy{user: "u", password: "p", loopback: true}, []req{
+			{"GET", "localhost:7777", nil, 401},
+			{"GET", "localhost:7777", map[string]string{"Authorization": "Basic dTpw"}, 200},
+			{"POST", "localhost:7777", map[string]string{"Authorization": "Basic dTpw", "Origin": "http://evil.example"}, 403},
+		}},
+	} {
+		h := test.policy.wrap(ok)
+		for _, rq := range test.reqs {
+			r := httptest.NewRequest(rq.method, "/overlay", nil)
+			r.Host = rq.host
+			for k, v := range rq.header {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != rq.want {
+				t.Errorf("%s: %s %s with %v: got %d, want %d", test.name, rq.method, rq.host, rq.header, w.Code, rq.want)
+			}
+		}
+	}
+}
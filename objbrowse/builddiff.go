@@ -0,0 +1,258 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/aclements/objbrowse/internal/asm"
+	"github.com/aclements/objbrowse/internal/linediff"
+	"github.com/aclements/objbrowse/obj"
+)
+
+// BuildDiff compares the functions of a build with those of the
+// previous build loaded by -watch.
+//
+// Functions are matched by name and compared by their disassembly,
+// with branch targets within the function rewritten as offsets, so
+// functions that merely moved don't count as changed.
+type BuildDiff struct {
+	old, new *FileInfo
+
+	once sync.Once
+	sum  *BuildDiffJS
+}
+
+func NewBuildDiff(old, new *FileInfo) *BuildDiff {
+	return &BuildDiff{old: old, new: new}
+}
+
+// BuildDiffJS summarizes the functions that changed between builds.
+type BuildDiffJS struct {
+	Changed []FuncChangeJS
+	Added   []FuncChangeJS
+	Removed []FuncChangeJS
+	// Same is the number of unchanged functions.
+	Same int
+}
+
+// FuncChangeJS is a function that changed, was added, or was removed.
+// Dup distinguishes functions with the same name; it's the index of
+// this function among the functions with this name. ID is the
+// function's symbol ID in the new build, or -1 if it was removed.
+type FuncChangeJS struct {
+	Name    string
+	Dup     int `json:",omitempty"`
+	ID      obj.SymID
+	OldSize uint64 `json:",omitempty"`
+	NewSize uint64 `json:",omitempty"`
+}
+
+// FuncDiffJS is the instruction-level difference of a function.
+type FuncDiffJS struct {
+	Lines []FuncDiffLineJS
+}
+
+// FuncDiffLineJS is an instruction in a FuncDiffJS. Op is " ", "-",
+// or "+". PC is the instruction's address in the new build, or in the
+// old build if Op is "-".
+type FuncDiffLineJS struct {
+	Op   string
+	PC   AddrJS
+	Text string
+}
+
+// funcKey identifies a function across builds.
+type funcKey struct {
+	name string
+	dup  int
+}
+
+type funcHash struct {
+	id   obj.SymID
+	size uint64
+	hash uint64
+}
+
+// hashFuncs returns a hash of the normalized disassembly of each
+// function in fi.
+func hashFuncs(fi *FileInfo, progress progressFunc) map[funcKey]funcHash {
+	out := make(map[funcKey]funcHash)
+	dups := make(map[string]int)
+	fi.ForEachText(progress, func(id obj.SymID, sym obj.Sym, insts asm.Seq) {
+		key := funcKey{sym.Name, dups[sym.Name]}
+		dups[sym.Name]++
+		h := fnv.New64a()
+		for _, line := range normInsts(fi, sym, insts, nil) {
+			h.Write([]byte(line))
+			h.Write([]byte{'\n'})
+		}
+		out[key] = funcHash{id, sym.Size, h.Sum64()}
+	})
+	return out
+}
+
+// aggregateOff matches an offset into a symbol that aggregates many
+// objects, like Go's "type:*" or "go:string.*". The offsets shift
+// whenever anything is added to the aggregate.
+var aggregateOff = regexp.MustCompile(`\*\+[0-9]+\(SB\)`)
+
+// normInsts returns the disassembly of sym, normalized so it doesn't
+// depend on where sym or the aggregate symbols are. If pcs is
+// non-nil, it also appends the PC of each instruction to *pcs.
+func normInsts(fi *FileInfo, sym obj.Sym, insts asm.Seq, pcs *[]uint64) []string {
+	lines := make([]string, 0, insts.Len())
+	for i := 0; i < insts.Len(); i++ {
+		inst := insts.Get(i)
+		text := inst.GoSyntax(fi.SymTab.SymName)
+		if c := inst.Control(); c.Type == asm.ControlJump && c.TargetPC-sym.Value < sym.Size {
+			op, _ := parseAsm(text)
+			text = fmt.Sprintf("%s +%#x", op, c.TargetPC-sym.Value)
+		}
+		lines = append(lines, aggregateOff.ReplaceAllString(text, "*(SB)"))
+		if pcs != nil {
+			*pcs = append(*pcs, inst.PC())
+		}
+	}
+	return lines
+}
+
+// prepare compares the builds if they haven't been already,
+// reporting progress to progress, which may be nil.
+func (d *BuildDiff) prepare(progress progressFunc) {
+	d.once.Do(func() {
+		var oldProgress, newProgress progressFunc
+		if progress != nil {
+			// Report each build as half the work.
+			oldProgress = func(done, total int) { progress(done, 2*total) }
+			newProgress = func(done, total int) { progress(total+done, 2*total) }
+		}
+		old := hashFuncs(d.old, oldProgress)
+		new := hashFuncs(d.new, newProgress)
+
+		sum := &BuildDiffJS{Changed: []FuncChangeJS{}, Added: []FuncChangeJS{}, Removed: []FuncChangeJS{}}
+		for key, n := range new {
+			c := FuncChangeJS{Name: key.name, Dup: key.dup, ID: n.id, NewSize: n.size}
+			o, ok := old[key]
+			switch {
+			case !ok:
+				sum.Added = append(sum.Added, c)
+			case o.hash != n.hash:
+				c.OldSize = o.size
+				sum.Changed = append(sum.Changed, c)
+			default:
+				sum.Same++
+			}
+		}
+		for key, o := range old {
+			if _, ok := new[key]; !ok {
+				sum.Removed = append(sum.Removed, FuncChangeJS{Name: key.name, Dup: key.dup, ID: -1, OldSize: o.size})
+			}
+		}
+		for _, list := range [][]FuncChangeJS{sum.Changed, sum.Added, sum.Removed} {
+			sort.Slice(list, func(i, j int) bool {
+				if list[i].Name != list[j].Name {
+					return list[i].Name < list[j].Name
+				}
+				return list[i].Dup < list[j].Dup
+			})
+		}
+		d.sum = sum
+	})
+}
+
+// Summary returns the functions that changed.
+func (d *BuildDiff) Summary() *BuildDiffJS {
+	d.prepare(nil)
+	return d.sum
+}
+
+// lookupFunc returns the dup'th function named name in fi, or -1.
+func lookupFunc(fi *FileInfo, name string, dup int) obj.SymID {
+	for _, id := range fi.SymTab.Name(name) {
+		if sym := fi.SymTab.Syms()[id]; sym.Kind == obj.SymText && sym.Size != 0 {
+			if dup == 0 {
+				return id
+			}
+			dup--
+		}
+	}
+	return -1
+}
+
+// funcLines returns the normalized disassembly of the dup'th function
+// named name in fi and the instructions' PCs. A missing function has
+// no lines.
+func funcLines(fi *FileInfo, name string, dup int) ([]string, []uint64, error) {
+	id := lookupFunc(fi, name, dup)
+	if id < 0 {
+		return nil, nil, nil
+	}
+	insts, err := fi.Disasm(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	var pcs []uint64
+	lines := normInsts(fi, fi.SymTab.Syms()[id], insts, &pcs)
+	return lines, pcs, nil
+}
+
+// Func returns the difference between the old and new versions of
+// the dup'th function named name.
+func (d *BuildDiff) Func(name string, dup int) (*FuncDiffJS, error) {
+	a, aPCs, err := funcLines(d.old, name, dup)
+	if err != nil {
+		return nil, err
+	}
+	b, bPCs, err := funcLines(d.new, name, dup)
+	if err != nil {
+		return nil, err
+	}
+	if a == nil && b == nil {
+		return nil, fmt.Errorf("no function %q in either build", name)
+	}
+	out := &FuncDiffJS{Lines: []FuncDiffLineJS{}}
+	for _, e := range linediff.Diff(a, b) {
+		switch e.Op {
+		case linediff.Delete:
+			out.Lines = append(out.Lines, FuncDiffLineJS{"-", AddrJS(aPCs[e.A]), a[e.A]})
+		case linediff.Insert:
+			out.Lines = append(out.Lines, FuncDiffLineJS{"+", AddrJS(bPCs[e.B]), b[e.B]})
+		default:
+			out.Lines = append(out.Lines, FuncDiffLineJS{" ", AddrJS(bPCs[e.B]), b[e.B]})
+		}
+	}
+	return out, nil
+}
+
+// httpBuildDiff serves the difference of the function selected by the
+// "name" and "dup" query parameters as JSON.
+func (s *state) httpBuildDiff(w http.ResponseWriter, r *http.Request) {
+	if s.buildDiff == nil {
+		http.Error(w, "no previous build", http.StatusNotFound)
+		return
+	}
+	dup := 0
+	if v := r.FormValue("dup"); v != "" {
+		var err error
+		dup, err = strconv.Atoi(v)
+		if err != nil || dup < 0 {
+			http.Error(w, fmt.Sprintf("bad dup %q", v), http.StatusBadRequest)
+			return
+		}
+	}
+	diff, err := s.buildDiff.Func(r.FormValue("name"), dup)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	serveJSON(w, diff)
+}
@@ -0,0 +1,70 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+"use strict";
+
+// BuildDiffView lists the functions whose code changed since the
+// previous build, with an instruction diff of each.
+class BuildDiffView {
+    constructor(container) {
+        const details = $("<details>").addClass("builddiffview").attr("open", "").appendTo(container);
+        $("<summary>").text("Changed since previous build").appendTo(details);
+        this._div = $("<div>").appendTo(details);
+        this._load();
+    }
+
+    _load() {
+        const div = this._div.text("Comparing…");
+        const onProgress = (done, total) => {
+            div.text("Comparing… " + done + "/" + total + " functions");
+        };
+        runJob("builddiff", {}, onProgress).done((data) => {
+            div.empty();
+            if (data.Changed.length + data.Added.length + data.Removed.length == 0) {
+                div.text("No functions changed.");
+                return;
+            }
+            $("<div>").addClass("sv-note").
+                text(data.Changed.length + " changed, " + data.Added.length + " added, " +
+                     data.Removed.length + " removed, " + data.Same + " unchanged").appendTo(div);
+            for (let f of data.Changed)
+                this._func(div, f, "changed");
+            for (let f of data.Added)
+                this._func(div, f, "added");
+            for (let f of data.Removed)
+                this._func(div, f, "removed");
+        }).fail((err) => {
+            showError("Build diff", err, div.empty());
+        });
+    }
+
+    // _func adds a collapsible diff of function f to div.
+    _func(div, f, kind) {
+        const details = $("<details>").appendTo(div);
+        const summary = $("<summary>").appendTo(details);
+        $("<span>").addClass("bd-" + kind).text(kind).appendTo(summary);
+        summary.append(" ");
+        if (f.ID >= 0)
+            $("<a>").attr("href", symURL(f.Name, f.ID)).text(f.Name).appendTo(summary);
+        else
+            summary.append(document.createTextNode(f.Name));
+        if (kind == "changed" && f.OldSize != f.NewSize)
+            summary.append($("<span>").addClass("sv-note").text(" " + f.OldSize + " → " + f.NewSize + " bytes"));
+        details.one("toggle", () => {
+            const pre = $("<pre>").addClass("bd-diff").text("Loading…").appendTo(details);
+            $.getJSON("/builddiff", {name: f.Name, dup: f.Dup || 0}).done((data) => {
+                pre.empty();
+                for (let l of data.Lines) {
+                    const line = $("<div>").text(l.Op + " " + l.PC + "  " + l.Text).appendTo(pre);
+                    if (l.Op == "+")
+                        line.addClass("bd-ins");
+                    else if (l.Op == "-")
+                        line.addClass("bd-del");
+                }
+            }).fail((xhr) => {
+                showError("Build diff", xhr, pre.empty());
+            });
+        });
+    }
+}
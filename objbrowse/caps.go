@@ -0,0 +1,156 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/aclements/objbrowse/internal/asm"
+	"github.com/aclements/objbrowse/obj"
+)
+
+// viewCaps is the set of per-symbol views available for a symbol.
+type viewCaps uint8
+
+const (
+	capHex viewCaps = 1 << iota
+	capAsm
+	capSource
+	capLines
+	capGoTables
+	capVars
+)
+
+// viewCapNames gives the code letter and name of each view, in display
+// order. The code letters are used in the compact symbol table
+// encoding.
+var viewCapNames = []struct {
+	c    viewCaps
+	code byte
+	name string
+}{
+	{capHex, 'h', "hex"},
+	{capAsm, 'a', "asm"},
+	{capSource, 's', "source"},
+	{capLines, 'l', "lines"},
+	{capGoTables, 'g', "gotables"},
+	{capVars, 'v', "vars"},
+}
+
+// String returns the code letters of the views in c.
+func (c viewCaps) String() string {
+	var buf []byte
+	for _, v := range viewCapNames {
+		if c&v.c != 0 {
+			buf = append(buf, v.code)
+		}
+	}
+	return string(buf)
+}
+
+// ViewCapJS describes whether a view is available for a symbol.
+type ViewCapJS struct {
+	View      string
+	Available bool
+	// Note explains why the view is unavailable, or describes
+	// how an available view is degraded.
+	Note string `json:",omitempty"`
+}
+
+// SymCaps returns the views available for sym. This is cheap enough to
+// compute for every symbol in the table.
+func (fi *FileInfo) SymCaps(sym obj.Sym) viewCaps {
+	caps, _ := fi.symCaps(sym, false)
+	return caps
+}
+
+// SymCapsDetail returns the availability of each view for sym,
+// explaining any that are unavailable or degraded.
+func (fi *FileInfo) SymCapsDetail(sym obj.Sym) []ViewCapJS {
+	caps, notes := fi.symCaps(sym, true)
+	var out []ViewCapJS
+	for _, v := range viewCapNames {
+		out = append(out, ViewCapJS{v.name, caps&v.c != 0, notes[v.c]})
+	}
+	return out
+}
+
+func (fi *FileInfo) symCaps(sym obj.Sym, explain bool) (viewCaps, map[viewCaps]string) {
+	var caps viewCaps
+	var notes map[viewCaps]string
+	note := func(c viewCaps, msg string) {
+		if explain {
+			if notes == nil {
+				notes = make(map[viewCaps]string)
+			}
+			notes[c] = msg
+		}
+	}
+
+	if sym.Kind == obj.SymUndef {
+		for _, v := range viewCapNames {
+			note(v.c, "undefined symbol")
+		}
+		return 0, notes
+	}
+	caps |= capHex
+
+	if sym.Kind != obj.SymText {
+		for _, c := range []viewCaps{capAsm, capSource, capLines, capGoTables, capVars} {
+			note(c, "not a text symbol")
+		}
+		return caps, notes
+	}
+
+	a := fi.Obj.Info().Arch
+	if a == nil {
+		note(capAsm, "unknown architecture")
+	} else if !asm.Supported(a) {
+		note(capAsm, "no disassembler for "+a.GoArch)
+	} else {
+		caps |= capAsm
+	}
+
+	goFunc := fi.Func(sym.Value) != nil
+	if goFunc {
+		caps |= capGoTables
+	} else if _, err := fi.FuncTab(); err != nil {
+		note(capGoTables, "no Go function table")
+	} else {
+		note(capGoTables, "not in the Go function table")
+	}
+
+	if fi.hasCU(sym.Value) {
+		caps |= capSource | capLines
+		if a != nil {
+			caps |= capVars
+		} else {
+			note(capVars, "unknown architecture")
+		}
+	} else {
+		msg := "no DWARF for this symbol"
+		if _, err := fi.DWARF(); err != nil {
+			msg = "no DWARF"
+		}
+		note(capLines, msg)
+		note(capVars, msg)
+		if goFunc {
+			// The Go function table provides a reduced
+			// source mapping without DWARF.
+			caps |= capSource
+			note(capSource, "lines from the Go function table")
+			if caps&capAsm != 0 {
+				note(capAsm, "source positions from the Go function table")
+			}
+		} else {
+			note(capSource, msg)
+		}
+	}
+	return caps, notes
+}
+
+// hasCU reports whether there is a DWARF compile unit containing addr.
+// Unlike AddrToCU, this never loads the full DWARF index.
+func (fi *FileInfo) hasCU(addr uint64) bool {
+	return fi.cuRange(addr) != nil
+}
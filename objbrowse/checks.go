@@ -0,0 +1,211 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aclements/objbrowse/internal/asm"
+	"github.com/aclements/objbrowse/obj"
+)
+
+// CheckAnalysis finds compiler-inserted safety checks in Go code:
+// bounds checks, nil checks, and division and shift checks.
+type CheckAnalysis struct {
+	fi *FileInfo
+
+	once  sync.Once
+	funcs map[obj.SymID][]CheckJS
+}
+
+// CheckJS is a single safety check in a function.
+type CheckJS struct {
+	// Kind is the kind of check: "index", "slice", "bounds",
+	// "nil", "divide", or "shift". Since Go 1.25, index and slice
+	// checks share a single panic function and are both reported
+	// as "bounds".
+	Kind string
+	// PC is the PC of the call to the panic function or, for
+	// nil checks, the faulting instruction.
+	PC AddrJS
+	// GuardPC is the PC of the conditional jump that guards the
+	// panic, if found.
+	GuardPC AddrJS `json:",omitempty"`
+}
+
+func NewCheckAnalysis(fi *FileInfo) *CheckAnalysis {
+	return &CheckAnalysis{fi: fi}
+}
+
+// checkPanicKind returns the kind of check that calls panic function
+// name, or "" if name isn't a check panic function.
+func checkPanicKind(name string) string {
+	name = strings.TrimSuffix(name, ".abi0")
+	if !strings.HasPrefix(name, "runtime.") {
+		return ""
+	}
+	name = strings.TrimPrefix(name[len("runtime."):], "go")
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasPrefix(lower, "panicindex"):
+		return "index"
+	case strings.HasPrefix(lower, "panicslice"), strings.HasPrefix(lower, "panicunsafeslice"):
+		return "slice"
+	case strings.HasPrefix(lower, "panicbounds"):
+		return "bounds"
+	case lower == "panicnilcheck" || lower == "panicmem" || lower == "panicmemaddr":
+		return "nil"
+	case lower == "panicdivide" || lower == "panicoverflow":
+		return "divide"
+	case lower == "panicshift":
+		return "shift"
+	}
+	return ""
+}
+
+// analyzeFunc returns the safety checks in the function sym.
+func (a *CheckAnalysis) analyzeFunc(sym obj.Sym, insts asm.Seq) []CheckJS {
+	// Index conditional jumps by target. The compiler sometimes
+	// inverts the condition and falls through to an
+	// unconditional jump to the panic, so attribute those jumps
+	// to the conditional jump just before them.
+	guards := make(map[uint64]uint64)
+	var lastCond uint64
+	for i := 0; i < insts.Len(); i++ {
+		inst := insts.Get(i)
+		switch c := inst.Control(); {
+		case c.Type == asm.ControlJump && c.Conditional:
+			guards[c.TargetPC] = inst.PC()
+			lastCond = inst.PC()
+			continue
+		case c.Type == asm.ControlJump && lastCond != 0:
+			if _, ok := guards[c.TargetPC]; !ok {
+				guards[c.TargetPC] = lastCond
+			}
+		case c.Type == asm.ControlNone && strings.HasPrefix(inst.GoSyntax(nil), "NOP"):
+			// Padding doesn't separate the jumps.
+			continue
+		}
+		lastCond = 0
+	}
+
+	var checks []CheckJS
+	// blockStart is the PC following the last control flow
+	// instruction, which approximates the start of the block
+	// containing inst.
+	blockStart := sym.Value
+	for i := 0; i < insts.Len(); i++ {
+		inst := insts.Get(i)
+		c := inst.Control()
+		if c.Type == asm.ControlCall {
+			if kind := checkPanicKind(a.fi.CallTarget(inst)); kind != "" {
+				check := CheckJS{Kind: kind, PC: AddrJS(inst.PC())}
+				// The guard is a conditional jump to the
+				// block containing the panic call (which
+				// may set up arguments before the call).
+				for pc := blockStart; pc <= inst.PC(); pc++ {
+					if guard, ok := guards[pc]; ok {
+						check.GuardPC = AddrJS(guard)
+						break
+					}
+				}
+				checks = append(checks, check)
+			}
+		} else if c.Type == asm.ControlNone {
+			// Explicit nil checks are a load that faults
+			// on nil, such as "TESTB AL, 0(AX)".
+			op, args := parseAsm(inst.GoSyntax(nil))
+			if op == "TESTB" && len(args) == 2 && strings.HasPrefix(strings.TrimPrefix(args[1], "0"), "(") {
+				checks = append(checks, CheckJS{Kind: "nil", PC: AddrJS(inst.PC())})
+			}
+		}
+		if c.Type != asm.ControlNone {
+			blockStart = inst.PC() + uint64(inst.Len())
+		}
+	}
+	return checks
+}
+
+// prepare analyzes all functions if they haven't been already,
+// reporting progress to progress, which may be nil.
+func (a *CheckAnalysis) prepare(progress progressFunc) {
+	a.once.Do(func() { a.analyzeAll(progress) })
+}
+
+func (a *CheckAnalysis) analyzeAll(progress progressFunc) {
+	a.funcs = make(map[obj.SymID][]CheckJS)
+	a.fi.ForEachText(progress, func(id obj.SymID, sym obj.Sym, insts asm.Seq) {
+		if checks := a.analyzeFunc(sym, insts); len(checks) > 0 {
+			a.funcs[id] = checks
+		}
+	})
+}
+
+type ChecksReportJS struct {
+	Packages []CheckCountsJS
+	Funcs    []CheckCountsJS
+}
+
+// CheckCountsJS counts checks by kind in a function or package.
+type CheckCountsJS struct {
+	Name   string
+	Total  int
+	Counts map[string]int
+}
+
+// Report summarizes the checks in the binary by package and by
+// function. It returns at most n functions, with the most checks
+// first.
+func (a *CheckAnalysis) Report(n int) *ChecksReportJS {
+	a.prepare(nil)
+
+	syms := a.fi.SymTab.Syms()
+	pkgs := make(map[string]*CheckCountsJS)
+	var funcs []CheckCountsJS
+	for id, checks := range a.funcs {
+		name := syms[id].Name
+		fn := CheckCountsJS{Name: name, Counts: make(map[string]int)}
+		pkgName := goPackage(name)
+		if pkgName == "" {
+			pkgName = "<other>"
+		}
+		pkg := pkgs[pkgName]
+		if pkg == nil {
+			pkg = &CheckCountsJS{Name: pkgName, Counts: make(map[string]int)}
+			pkgs[pkgName] = pkg
+		}
+		for _, c := range checks {
+			fn.Counts[c.Kind]++
+			pkg.Counts[c.Kind]++
+		}
+		fn.Total = len(checks)
+		pkg.Total += len(checks)
+		funcs = append(funcs, fn)
+	}
+
+	byTotal := func(list []CheckCountsJS) {
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].Total != list[j].Total {
+				return list[i].Total > list[j].Total
+			}
+			return list[i].Name < list[j].Name
+		})
+	}
+	report := &ChecksReportJS{Packages: []CheckCountsJS{}, Funcs: funcs}
+	for _, pkg := range pkgs {
+		report.Packages = append(report.Packages, *pkg)
+	}
+	byTotal(report.Packages)
+	byTotal(report.Funcs)
+	if len(report.Funcs) > n {
+		report.Funcs = report.Funcs[:n]
+	}
+	if report.Funcs == nil {
+		report.Funcs = []CheckCountsJS{}
+	}
+	return report
+}
@@ -0,0 +1,196 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/aclements/objbrowse/obj"
+)
+
+// CommandJS is a command in the web UI's command palette.
+type CommandJS struct {
+	// ID identifies the command. It's stable across releases, so
+	// it can be used in bookmarks and scripts.
+	ID    string
+	Title string
+	// Group is the section of the palette listing the command.
+	Group string
+	// Keys is the command's keyboard shortcut, if any, in the form
+	// described by keyBindings.
+	Keys string `json:",omitempty"`
+
+	// A command either goes to URL or runs a client-side Action
+	// with argument Arg. The actions are:
+	//
+	//	symbol   prompt for a symbol and go to it
+	//	address  prompt for an address and go to it
+	//	keys     list the keyboard shortcuts
+	//	toggle   show or hide the symbol page view named Arg
+	//	open     open and scroll to the element matching selector Arg
+	//	focus    focus the input matching selector Arg
+	//	history  show or hide the history of visited symbols
+	//	log      show or hide the server's recent warnings
+	//	file     prompt for an object file to open instead
+	//	pin      pin the symbol given by ComparePinJS Arg for comparison
+	//	snapshot add a snapshot of the active view to a notebook
+	//	lead     take or give up the lead of the shared session
+	//	follow   start or stop following the shared session's leader
+	URL    string `json:",omitempty"`
+	Action string `json:",omitempty"`
+	Arg    string `json:",omitempty"`
+}
+
+// keyBindings documents the keys the web UI understands outside of
+// text inputs. Shortcuts of other commands are in their Keys.
+//
+//	Ctrl-P, Ctrl-K, ⌘P, ⌘K   open the command palette
+//	g <key>                  a "g" followed by a key, like "g s"
+//	?                        list keyboard shortcuts
+//	/, Ctrl-F, F3            focus the page's filter or search box
+//
+// In the palette, Up and Down select, Enter runs the selected
+// command, and Escape closes the palette.
+var keyBindings = []CommandJS{
+	{ID: "palette", Title: "Command palette", Group: "Help", Keys: "Ctrl-P"},
+	{ID: "keys", Title: "Keyboard shortcuts", Group: "Help", Keys: "?", Action: "keys"},
+}
+
+// commands returns the commands available in context, which is
+// "main" for the symbol table page, "sym" for the page of symbol sym,
+// or "" for other pages. pin is the symbol pinned for comparison, if
+// any.
+func (s *state) commands(context string, sym obj.SymID, pin *ComparePinJS) []CommandJS {
+	out := append([]CommandJS(nil), keyBindings...)
+	add := func(cmds ...CommandJS) {
+		out = append(out, cmds...)
+	}
+	add(
+		CommandJS{ID: "goto.symbol", Title: "Go to symbol…", Group: "Navigate", Keys: "g s", Action: "symbol"},
+		CommandJS{ID: "goto.address", Title: "Go to address…", Group: "Navigate", Keys: "g a", Action: "address"},
+		CommandJS{ID: "goto.syms", Title: "Symbol table", Group: "Navigate", Keys: "g h", URL: "/"},
+		CommandJS{ID: "goto.treemap", Title: "Size treemap", Group: "Navigate", Keys: "g t", URL: "/treemap"},
+		CommandJS{ID: "goto.instchart", Title: "Instruction histogram", Group: "Navigate", Keys: "g i", URL: "/instchart"},
+		CommandJS{ID: "goto.tabs", Title: "Tabs", Group: "Navigate", URL: "/tabs"},
+	)
+
+	if context == "main" || context == "sym" {
+		add(CommandJS{ID: "history", Title: "History", Group: "Navigate", Keys: "g y", Action: "history"})
+		add(CommandJS{ID: "log", Title: "Server log", Group: "Help", Keys: "g l", Action: "log"})
+		if openDisabled() == "" {
+			add(CommandJS{ID: "file.open", Title: "Open file…", Group: "File", Keys: "g o", Action: "file"})
+		}
+	}
+
+	switch context {
+	case "main":
+		add(
+			CommandJS{ID: "syms.filter", Title: "Filter symbols", Group: "Symbols", Keys: "/", Action: "focus", Arg: ".symview-filter"},
+			CommandJS{ID: "analyze.scan", Title: "Scan binary", Group: "Analyze", Action: "focus", Arg: ".scanview input[type=text]"},
+			CommandJS{ID: "analyze.sizes", Title: "Largest symbols", Group: "Analyze", Action: "open", Arg: ".sizeview"},
+			CommandJS{ID: "analyze.generics", Title: "Generic instantiations", Group: "Analyze", Action: "open", Arg: ".genericsview"},
+			CommandJS{ID: "analyze.isa", Title: "Required CPU features", Group: "Analyze", Action: "open", Arg: ".isaview"},
+			CommandJS{ID: "analyze.embedded", Title: "Embedded files", Group: "Analyze", Action: "open", Arg: ".embedview"},
+			CommandJS{ID: "analyze.relocs", Title: "Relocations", Group: "Analyze", Action: "open", Arg: ".relocview"},
+			CommandJS{ID: "analyze.relocrisks", Title: "Relocation overflow", Group: "Analyze", Action: "open", Arg: ".relocriskview"},
+			CommandJS{ID: "analyze.initorder", Title: "Startup and exit functions", Group: "Analyze", Action: "open", Arg: ".initorderview"},
+			CommandJS{ID: "analyze.sections", Title: "Section permissions", Group: "Analyze", Action: "open", Arg: ".sectauditview"},
+			CommandJS{ID: "analyze.types", Title: "Type layouts", Group: "Analyze", Action: "open", Arg: ".typeview"},
+		)
+		if _, ok := obj.ReadPEHeaders(s.bin); ok {
+			add(CommandJS{ID: "analyze.pe", Title: "Image headers", Group: "Analyze", Action: "open", Arg: ".peview"})
+		}
+		if s.hasGoInit() {
+			add(CommandJS{ID: "analyze.initgraph", Title: "Go package init graph", Group: "Analyze", Action: "open", Arg: ".initgraphview"})
+		}
+		if _, ok := obj.ReadELFDynamic(s.bin); ok {
+			add(CommandJS{ID: "analyze.dynamic", Title: "Dynamic linking", Group: "Analyze", Action: "open", Arg: ".dynamicview"})
+		}
+		for _, f := range []struct{ format, name string }{{"pprof", "pprof"}, {"folded", "folded stacks"}, {"perfetto", "Perfetto trace"}} {
+			add(CommandJS{ID: "export.sizes." + f.format, Title: "Export sizes as " + f.name, Group: "Export",
+				URL: "/export?what=sizes&format=" + f.format})
+		}
+
+	case "sym":
+		syms := s.symTab.Syms()
+		if sym < 0 || int(sym) >= len(syms) {
+			break
+		}
+		ss := syms[sym]
+		tab := url.Values{"t": {ss.Name + "?id=" + strconv.Itoa(int(sym))}}
+		add(CommandJS{ID: "tabs.open", Title: "Open in tabs", Group: "Navigate", URL: "/tabs#" + tab.Encode()})
+		for _, v := range s.fi.SymCapsDetail(ss) {
+			if v.Available {
+				add(CommandJS{ID: "view." + v.View, Title: "Toggle " + v.View + " view", Group: "View", Action: "toggle", Arg: v.View})
+			}
+		}
+		if ss.Kind != obj.SymText && ss.Kind != obj.SymUndef {
+			add(CommandJS{ID: "view.values", Title: "Toggle values view", Group: "View", Action: "toggle", Arg: "values"})
+		}
+		if ss.Kind != obj.SymUndef {
+			base := "/sym/" + strconv.Itoa(int(sym))
+			if s.fi.SymCaps(ss)&capAsm != 0 {
+				add(
+					CommandJS{ID: "download.asm", Title: "Download assembly (.s)", Group: "Download", URL: base + "/asm"},
+					CommandJS{ID: "download.obj", Title: "Download object (.o)", Group: "Download", URL: base + "/obj"},
+				)
+			}
+			add(CommandJS{ID: "download.bin", Title: "Download bytes (.bin)", Group: "Download", URL: base + "/bin"})
+		}
+		if ss.Kind == obj.SymText {
+			arg, _ := json.Marshal(ComparePinJS{sym, ss.Name})
+			add(CommandJS{ID: "compare.pin", Title: "Pin for comparison", Group: "Compare", Keys: "p", Action: "pin", Arg: string(arg)})
+			if pin != nil && pin.ID != sym && int(pin.ID) < len(syms) && syms[pin.ID].Kind == obj.SymText {
+				add(CommandJS{ID: "compare.pinned", Title: "Compare with " + pin.Name, Group: "Compare", Keys: "c",
+					URL: fmt.Sprintf("/compare?a=%d&b=%d", pin.ID, sym)})
+			}
+		}
+	}
+	if context == "main" || context == "sym" {
+		add(CommandJS{ID: "notebook.snapshot", Title: "Add view to notebook…", Group: "Notebook", Keys: "g n", Action: "snapshot"})
+	}
+	if *flagShare && (context == "main" || context == "sym") {
+		add(
+			CommandJS{ID: "session.lead", Title: "Lead the shared session", Group: "Session", Action: "lead"},
+			CommandJS{ID: "session.follow", Title: "Follow the session leader", Group: "Session", Action: "follow"},
+		)
+	}
+	for _, b := range notebooks.list() {
+		title := b.Title
+		if title == "" {
+			title = "untitled " + b.ID
+		}
+		add(CommandJS{ID: "notebook.open." + b.ID, Title: "Open notebook " + title, Group: "Notebook", URL: "/notebook/" + b.ID})
+	}
+	for _, o := range overlays.list() {
+		add(CommandJS{ID: "export.overlay." + o.Name, Title: fmt.Sprintf("Export overlay %s as pprof", o.Name), Group: "Export",
+			URL: "/export?" + url.Values{"what": {"overlay"}, "name": {o.Name}}.Encode()})
+	}
+	return out
+}
+
+// httpCommands serves the command palette's commands as JSON. The
+// "context" query parameter is "main" for the symbol table page or
+// "sym" for a symbol's page, whose ID is given by "sym".
+func (s *state) httpCommands(w http.ResponseWriter, r *http.Request) {
+	sym := obj.SymID(-1)
+	if id := r.FormValue("sym"); id != "" {
+		n, err := strconv.Atoi(id)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("bad symbol ID %q", id), http.StatusBadRequest)
+			return
+		}
+		sym = obj.SymID(n)
+	}
+	var pin *ComparePinJS
+	if p, ok := pinnedSym(w, r); ok {
+		pin = &p
+	}
+	serveJSON(w, s.commands(r.FormValue("context"), sym, pin))
+}
@@ -0,0 +1,170 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+
+	"github.com/aclements/objbrowse/internal/linediff"
+	"github.com/aclements/objbrowse/obj"
+)
+
+// CompareJS is a side-by-side comparison of the code of two functions
+// in the binary, such as two instantiations of a generic function.
+// Instructions are compared in the normalized form of the build diff,
+// so branches within each function compare by offset.
+type CompareJS struct {
+	A, B CompareSymJS
+	// Rows aligns the instructions of A and B.
+	Rows []CompareRowJS
+	// Same is the number of rows whose instructions are the same.
+	Same int
+}
+
+type CompareSymJS struct {
+	Name string
+	ID   obj.SymID
+	Addr AddrJS
+	Size uint64
+}
+
+// CompareRowJS is a row of a comparison. Op is " " if A and B are the
+// same, "!" if they differ, "-" if only A has an instruction here, and
+// "+" if only B does.
+type CompareRowJS struct {
+	Op   string
+	A, B *CompareInstJS `json:",omitempty"`
+}
+
+type CompareInstJS struct {
+	PC   AddrJS
+	Text string
+}
+
+// compareFuncs compares the code of functions a and b.
+func (s *state) compareFuncs(a, b obj.SymID) (*CompareJS, error) {
+	syms := s.symTab.Syms()
+	var sides [2]CompareSymJS
+	var lines [2][]string
+	var pcs [2][]uint64
+	for i, id := range []obj.SymID{a, b} {
+		if id < 0 || int(id) >= len(syms) {
+			return nil, fmt.Errorf("no symbol %d", id)
+		}
+		sym := syms[id]
+		if sym.Kind != obj.SymText {
+			return nil, fmt.Errorf("%s is not a function", sym.Name)
+		}
+		insts, err := s.fi.Disasm(id)
+		if err != nil {
+			return nil, err
+		}
+		sides[i] = CompareSymJS{sym.Name, id, AddrJS(sym.Value), sym.Size}
+		lines[i] = normInsts(s.fi, sym, insts, &pcs[i])
+	}
+
+	out := &CompareJS{A: sides[0], B: sides[1], Rows: []CompareRowJS{}}
+	inst := func(side, i int) *CompareInstJS {
+		return &CompareInstJS{AddrJS(pcs[side][i]), lines[side][i]}
+	}
+	// Pair up the deleted and inserted lines of each changed hunk,
+	// so replaced instructions appear side by side.
+	var dels, ins []int
+	flush := func() {
+		for i := 0; i < len(dels) || i < len(ins); i++ {
+			switch {
+			case i < len(dels) && i < len(ins):
+				out.Rows = append(out.Rows, CompareRowJS{"!", inst(0, dels[i]), inst(1, ins[i])})
+			case i < len(dels):
+				out.Rows = append(out.Rows, CompareRowJS{Op: "-", A: inst(0, dels[i])})
+			default:
+				out.Rows = append(out.Rows, CompareRowJS{Op: "+", B: inst(1, ins[i])})
+			}
+		}
+		dels, ins = dels[:0], ins[:0]
+	}
+	for _, e := range linediff.Diff(lines[0], lines[1]) {
+		switch e.Op {
+		case linediff.Delete:
+			dels = append(dels, e.A)
+		case linediff.Insert:
+			ins = append(ins, e.B)
+		default:
+			flush()
+			out.Rows = append(out.Rows, CompareRowJS{" ", inst(0, e.A), inst(1, e.B)})
+			out.Same++
+		}
+	}
+	flush()
+	return out, nil
+}
+
+// comparePin is the setting holding the symbol pinned for comparison.
+const comparePin = "compare.pin"
+
+// ComparePinJS is the value of the comparePin setting.
+type ComparePinJS struct {
+	ID   obj.SymID
+	Name string
+}
+
+// pinnedSym returns the symbol the browser making request r pinned
+// for comparison, if any.
+func pinnedSym(w http.ResponseWriter, r *http.Request) (ComparePinJS, bool) {
+	var pin ComparePinJS
+	raw, ok := settings.get(clientID(w, r))[comparePin]
+	if !ok || json.Unmarshal(raw, &pin) != nil {
+		return pin, false
+	}
+	return pin, true
+}
+
+// httpCompare serves the comparison of the functions whose symbol IDs
+// are given by the "a" and "b" query parameters, as a page, or as
+// JSON if the "format" parameter is "json".
+func (s *state) httpCompare(w http.ResponseWriter, r *http.Request) {
+	var ids [2]obj.SymID
+	for i, param := range []string{"a", "b"} {
+		id, err := strconv.Atoi(r.FormValue(param))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("bad symbol ID %q", r.FormValue(param)), http.StatusBadRequest)
+			return
+		}
+		ids[i] = obj.SymID(id)
+	}
+	cmp, err := s.compareFuncs(ids[0], ids[1])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if r.FormValue("format") == "json" {
+		serveJSON(w, cmp)
+		return
+	}
+	if err := tmplCompare.Execute(w, cmp); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+var tmplCompare = template.Must(template.New("").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>Objbrowse: {{.A.Name}} vs {{.B.Name}}</title>
+<link rel="stylesheet" type="text/css" href="/objbrowse.css" />
+</head>
+<body>
+<script src="https://code.jquery.com/jquery-3.3.1.min.js"></script>
+<script src="/objbrowse.js"></script>
+<script src="/palette.js"></script>
+<script src="/compare.js"></script>
+<script>new CompareView(document.body, {{$}})</script>
+<script>new CommandPalette({})</script>
+</body>
+</html>
+`))
@@ -0,0 +1,77 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+"use strict";
+
+// CompareView shows the code of two functions side by side, from a
+// CompareJS, with synchronized scrolling and optional highlighting of
+// the differences.
+class CompareView {
+    constructor(container, data) {
+        const self = this;
+        this._data = data;
+        $(container).addClass("compare-page");
+
+        const head = $("<div>").addClass("compare-head").appendTo(container);
+        const symLink = (s) => $("<a>").attr("href", symURL(s.Name, s.ID)).text(s.Name);
+        head.append(symLink(data.A), " vs ", symLink(data.B), " ");
+        $("<a>").attr({href: "/compare?a=" + data.B.ID + "&b=" + data.A.ID, title: "swap sides"}).
+            text("⇄").appendTo(head);
+        const rows = data.Rows.length;
+        $("<span>").addClass("compare-stats").
+            text(data.Same + " of " + rows + " instructions the same" +
+                 (data.Same === rows ? " (identical)" : "")).appendTo(head);
+        const label = $("<label>").text(" highlight differences").appendTo(head);
+        this._diff = $('<input type="checkbox" checked>').prependTo(label);
+        this._diff.change(() => { self._render(); });
+
+        const panes = $("<div>").addClass("compare-panes").appendTo(container);
+        this._panes = [
+            $("<div>").addClass("compare-pane").appendTo(panes),
+            $("<div>").addClass("compare-pane").appendTo(panes),
+        ];
+
+        // Keep the panes scrolled together. Once they match, the
+        // other pane's scroll event does nothing.
+        this._panes.forEach((pane, i) => {
+            pane.scroll(() => {
+                const other = self._panes[1 - i][0];
+                if (other.scrollTop !== pane[0].scrollTop)
+                    other.scrollTop = pane[0].scrollTop;
+            });
+        });
+
+        this._render();
+    }
+
+    // _render draws both sides. With highlighting on, the rows are
+    // aligned and colored by how they differ; otherwise each side
+    // lists just its own instructions.
+    _render() {
+        const diff = this._diff.prop("checked");
+        const opClass = {" ": "compare-same", "!": "compare-changed", "-": "compare-del", "+": "compare-ins"};
+        [["A", this._data.A], ["B", this._data.B]].forEach(([side, sym], i) => {
+            const table = $("<table>").addClass("compare-table");
+            const base = new AddrJS(sym.Addr);
+            for (let row of this._data.Rows) {
+                const inst = row[side];
+                if (!inst && !diff)
+                    continue;
+                const tr = $("<tr>").appendTo(table);
+                if (diff)
+                    tr.addClass(inst ? opClass[row.Op] : "compare-gap");
+                if (!inst) {
+                    tr.append($("<td>").html("&nbsp;"), $("<td>"));
+                    continue;
+                }
+                const pc = new AddrJS(inst.PC);
+                const off = pc.sub(base);
+                const href = symURL(sym.Name, sym.ID) + "#" + pc + "-" + pc.add(new AddrJS(1));
+                tr.append($("<td>").addClass("compare-pc").append($("<a>").attr("href", href).text("+0x" + off)),
+                          $("<td>").addClass("compare-text").text(inst.Text));
+            }
+            this._panes[i].empty().append(table);
+        });
+    }
+}
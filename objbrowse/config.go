@@ -0,0 +1,136 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aclements/objbrowse/internal/config"
+)
+
+// A stringList is a flag that may be repeated. In configuration
+// files, it may be set to an array.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// pathFlags are flags whose values are paths. Relative paths in a
+// configuration file are relative to the file's directory.
+var pathFlags = map[string]bool{
+	"static":       true,
+	"heapprofile":  true,
+	"perf":         true,
+	"trace":        true,
+	"report":       true,
+	"tls-cert":     true,
+	"tls-key":      true,
+	"source-root":  true,
+	"source-roots": true,
+	"open-root":    true,
+	"plugin":       true,
+	"debug-file":   true,
+}
+
+// configFiles returns the configuration files that may supply
+// default flags for browsing objPath, from lowest to highest
+// priority: the user's config.toml, then .objbrowse files in the
+// object file's directory and the current directory.
+func configFiles(objPath string) []string {
+	var files []string
+	if dir, err := os.UserConfigDir(); err == nil {
+		files = append(files, filepath.Join(dir, "objbrowse", "config.toml"))
+	}
+	objDir, _ := filepath.Abs(filepath.Dir(objPath))
+	files = append(files, filepath.Join(objDir, ".objbrowse"))
+	if cwd, err := os.Getwd(); err == nil && cwd != objDir {
+		files = append(files, filepath.Join(cwd, ".objbrowse"))
+	}
+	return files
+}
+
+// loadConfig sets flags in fs from the configuration files, which are
+// in increasing priority. Each key in a configuration file is the
+// name of a flag. Flags set on the command line take priority over
+// all configuration files. Missing files are ignored.
+func loadConfig(fs *flag.FlagSet, files []string) error {
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	type value struct {
+		config.Setting
+		file string
+	}
+	values := make(map[string]value)
+	var keys []string
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		settings, err := config.Parse(data)
+		if err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+		for _, s := range settings {
+			f := fs.Lookup(s.Key)
+			if f == nil {
+				return fmt.Errorf("%s:%d: unknown option %q", file, s.Line, s.Key)
+			}
+			if _, ok := f.Value.(*stringList); s.IsArray && !ok {
+				return fmt.Errorf("%s:%d: option %q takes a single value", file, s.Line, s.Key)
+			}
+			if _, ok := values[s.Key]; !ok {
+				keys = append(keys, s.Key)
+			}
+			values[s.Key] = value{s, file}
+		}
+	}
+
+	for _, key := range keys {
+		if explicit[key] {
+			continue
+		}
+		v := values[key]
+		for _, val := range v.Values {
+			if pathFlags[key] && val != "" {
+				val = expandPath(val, filepath.Dir(v.file))
+			}
+			if err := fs.Set(key, val); err != nil {
+				return fmt.Errorf("%s:%d: %s: %v", v.file, v.Line, key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// expandPath expands a leading "~/" in path to the user's home
+// directory and makes relative paths relative to dir.
+func expandPath(path, dir string) string {
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[2:])
+		}
+	}
+	if !filepath.IsAbs(path) {
+		return filepath.Join(dir, path)
+	}
+	return path
+}
@@ -0,0 +1,190 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/aclements/objbrowse/internal/asm"
+	"github.com/aclements/objbrowse/obj"
+)
+
+// ConstXref finds where constant values, such as magic numbers or
+// addresses, appear in the object's code and data.
+type ConstXref struct {
+	fi *FileInfo
+
+	mu sync.Mutex
+	// code maps from constant values to the PCs of instructions
+	// that use them, if it's not kept in fi's caches.
+	code map[uint64][]uint64
+}
+
+func NewConstXref(fi *FileInfo) *ConstXref {
+	return &ConstXref{fi: fi}
+}
+
+type ConstXrefJS struct {
+	// Code lists instructions with an operand equal to the value.
+	Code []ConstRefJS
+	// Data lists pointer-aligned words in data symbols equal to
+	// the value.
+	Data []ConstRefJS
+	// Truncated indicates that there were more than
+	// maxSearchHits references of either kind.
+	Truncated bool `json:",omitempty"`
+}
+
+type ConstRefJS struct {
+	Addr    AddrJS
+	Sym     string
+	SymAddr AddrJS
+}
+
+// mask truncates v to the pointer size of the object.
+func (x *ConstXref) mask(v uint64) uint64 {
+	if arch := x.fi.Obj.Info().Arch; arch != nil && arch.PtrSize < 8 {
+		v &= 1<<(8*uint(arch.PtrSize)) - 1
+	}
+	return v
+}
+
+// prepare indexes the constants in code if they haven't been
+// already, reporting progress to progress, which may be nil.
+func (x *ConstXref) prepare(progress progressFunc) {
+	x.index(progress)
+}
+
+// index returns the index of constants in code, building it if it
+// hasn't been built or was evicted under -max-memory.
+func (x *ConstXref) index(progress progressFunc) map[uint64][]uint64 {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	caches := x.fi.caches
+	if caches == nil {
+		if x.code == nil {
+			x.code, _ = x.indexCode(progress)
+		}
+		return x.code
+	}
+	if code, ok := caches.xrefs.Get(x); ok {
+		return code.(map[uint64][]uint64)
+	}
+	code, size := x.indexCode(progress)
+	caches.xrefs.Add(x, code, size)
+	return code
+}
+
+// indexCode indexes the constants in code. It returns the index and
+// an estimate of its size in bytes.
+func (x *ConstXref) indexCode(progress progressFunc) (map[uint64][]uint64, int64) {
+	code := make(map[uint64][]uint64)
+	npcs := 0
+	x.fi.ForEachText(progress, func(id obj.SymID, sym obj.Sym, insts asm.Seq) {
+		for i := 0; i < insts.Len(); i++ {
+			inst := insts.Get(i)
+			for _, v := range inst.Consts() {
+				v = x.mask(v)
+				pcs := code[v]
+				// Don't record an instruction twice.
+				if len(pcs) == 0 || pcs[len(pcs)-1] != inst.PC() {
+					code[v] = append(pcs, inst.PC())
+					npcs++
+				}
+			}
+		}
+		// Also index addresses formed across instructions.
+		for _, r := range asm.AddrRefs(insts, nil) {
+			v := x.mask(r.Addr)
+			if pcs := code[v]; len(pcs) == 0 || pcs[len(pcs)-1] != r.PC {
+				code[v] = append(pcs, r.PC)
+				npcs++
+			}
+		}
+	})
+	// ForEachText visits overlapping symbols, such as a package's
+	// container symbol and the functions in it, so the same PC
+	// can appear more than once. Sort and compact each list.
+	npcs = 0
+	for v, pcs := range code {
+		sort.Slice(pcs, func(i, j int) bool { return pcs[i] < pcs[j] })
+		out := pcs[:1]
+		for _, pc := range pcs[1:] {
+			if pc != out[len(out)-1] {
+				out = append(out, pc)
+			}
+		}
+		code[v] = out
+		npcs += len(out)
+	}
+	// A map entry is a key and a slice header, plus overhead.
+	return code, int64(len(code))*48 + int64(npcs)*8
+}
+
+// Find returns the code and data locations where v appears.
+//
+// Code references are indexed on first use. Data is scanned on each
+// call rather than indexed, since an index of every word of data
+// would be about as large as the data itself, while a linear scan is
+// fast.
+func (x *ConstXref) Find(v uint64) *ConstXrefJS {
+	code := x.index(nil)
+	v = x.mask(v)
+
+	symTab := x.fi.SymTab
+	ref := func(addr uint64) ConstRefJS {
+		r := ConstRefJS{Addr: AddrJS(addr)}
+		if id, ok := symTab.Addr(addr); ok {
+			sym := symTab.Syms()[id]
+			r.Sym, r.SymAddr = sym.Name, AddrJS(sym.Value)
+		}
+		return r
+	}
+
+	out := &ConstXrefJS{Code: []ConstRefJS{}, Data: []ConstRefJS{}}
+	pcs := code[v]
+	if len(pcs) > maxSearchHits {
+		pcs, out.Truncated = pcs[:maxSearchHits], true
+	}
+	for _, pc := range pcs {
+		out.Code = append(out.Code, ref(pc))
+	}
+
+	arch := x.fi.Obj.Info().Arch
+	if arch == nil {
+		return out
+	}
+	ptrSize := uint64(arch.PtrSize)
+	for i, sym := range symTab.Syms() {
+		if (sym.Kind != obj.SymData && sym.Kind != obj.SymROData) || sym.Size < ptrSize {
+			continue
+		}
+		data, err := x.fi.Obj.SymbolData(obj.SymID(i))
+		if err != nil {
+			continue
+		}
+		p := data.P
+		// Start at the first pointer-aligned address.
+		for off := -data.Addr % ptrSize; off+ptrSize <= uint64(len(p)); off += ptrSize {
+			var w uint64
+			if ptrSize == 8 {
+				w = arch.ByteOrder.Uint64(p[off:])
+			} else {
+				w = uint64(arch.ByteOrder.Uint32(p[off:]))
+			}
+			if w != v {
+				continue
+			}
+			if len(out.Data) == maxSearchHits {
+				out.Truncated = true
+				break
+			}
+			out.Data = append(out.Data, ConstRefJS{AddrJS(data.Addr + off), sym.Name, AddrJS(sym.Value)})
+		}
+	}
+	sort.Slice(out.Data, func(i, j int) bool { return out.Data[i].Addr < out.Data[j].Addr })
+	return out
+}
@@ -0,0 +1,158 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"debug/dwarf"
+	"sort"
+	"sync"
+
+	"github.com/aclements/objbrowse/internal/symtab"
+)
+
+// CUView is an index of DWARF compile units, the source files in each
+// compile unit, and the functions each source file contributed to
+// the binary.
+type CUView struct {
+	fi     *FileInfo
+	symTab *symtab.Table
+
+	once sync.Once
+	cus  []CUViewCUJS
+	err  error
+}
+
+func NewCUView(fi *FileInfo, symTab *symtab.Table) *CUView {
+	return &CUView{fi: fi, symTab: symTab}
+}
+
+type CUViewJS struct {
+	CUs []CUViewCUJS
+}
+
+type CUViewCUJS struct {
+	Name     string
+	CompDir  string `json:",omitempty"`
+	Producer string `json:",omitempty"`
+	Size     uint64 // Total bytes of code in Funcs
+	Files    []CUViewFileJS
+}
+
+type CUViewFileJS struct {
+	Name  string
+	Size  uint64 // Total bytes of code in Funcs
+	Funcs []CUViewFuncJS
+}
+
+type CUViewFuncJS struct {
+	Name string
+	// Sym is the name of the symbol containing this function's
+	// entry point, or "" if there is no such symbol.
+	Sym  string `json:",omitempty"`
+	Addr AddrJS
+	Size uint64
+}
+
+// Decode returns the compile unit index. It is computed on first use
+// and cached, since it requires walking all of the DWARF.
+func (v *CUView) Decode() (interface{}, error) {
+	v.once.Do(func() {
+		v.cus, v.err = v.decode()
+	})
+	if v.err != nil {
+		return nil, v.err
+	}
+	return &CUViewJS{v.cus}, nil
+}
+
+func (v *CUView) decode() ([]CUViewCUJS, error) {
+	dw, err := v.fi.DWARF()
+	if err != nil {
+		return nil, err
+	}
+
+	var cus []CUViewCUJS
+	var cu *CUViewCUJS
+	var files map[string]*CUViewFileJS
+	var lineFiles []*dwarf.LineFile
+	flushCU := func() {
+		if cu == nil {
+			return
+		}
+		for _, f := range files {
+			sort.Slice(f.Funcs, func(i, j int) bool {
+				return f.Funcs[i].Name < f.Funcs[j].Name
+			})
+			cu.Files = append(cu.Files, *f)
+		}
+		sort.Slice(cu.Files, func(i, j int) bool {
+			return cu.Files[i].Name < cu.Files[j].Name
+		})
+		cus = append(cus, *cu)
+		cu = nil
+	}
+
+	dr := dw.Reader()
+	for {
+		ent, err := dr.Next()
+		if err != nil {
+			return nil, err
+		}
+		if ent == nil {
+			break
+		}
+
+		switch ent.Tag {
+		case dwarf.TagCompileUnit:
+			flushCU()
+			cu = &CUViewCUJS{Files: []CUViewFileJS{}}
+			cu.Name, _ = ent.Val(dwarf.AttrName).(string)
+			cu.CompDir, _ = ent.Val(dwarf.AttrCompDir).(string)
+			cu.Producer, _ = ent.Val(dwarf.AttrProducer).(string)
+			files = make(map[string]*CUViewFileJS)
+			lineFiles = nil
+			if lr, err := dw.LineReader(ent); err == nil && lr != nil {
+				lineFiles = lr.Files()
+			}
+
+		case dwarf.TagSubprogram:
+			// Don't descend into lexical blocks,
+			// parameters, and inlined subroutines.
+			dr.SkipChildren()
+			if cu == nil {
+				break
+			}
+			ranges, err := dw.Ranges(ent)
+			if err != nil || len(ranges) == 0 {
+				// Abstract or declaration-only.
+				break
+			}
+			var fn CUViewFuncJS
+			fn.Name, _ = ent.Val(dwarf.AttrName).(string)
+			fn.Addr = AddrJS(ranges[0][0])
+			for _, r := range ranges {
+				fn.Size += r[1] - r[0]
+			}
+			if sym, ok := v.symTab.Addr(ranges[0][0]); ok {
+				fn.Sym = v.symTab.Syms()[sym].Name
+			}
+			fileName := "<unknown>"
+			if idx, ok := ent.Val(dwarf.AttrDeclFile).(int64); ok && 0 <= idx && idx < int64(len(lineFiles)) && lineFiles[idx] != nil {
+				fileName = lineFiles[idx].Name
+			}
+			file := files[fileName]
+			if file == nil {
+				file = &CUViewFileJS{Name: fileName}
+				files[fileName] = file
+			}
+			file.Funcs = append(file.Funcs, fn)
+			file.Size += fn.Size
+			cu.Size += fn.Size
+		}
+	}
+	flushCU()
+
+	return cus, nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+"use strict";
+
+// CUView shows the compile units in the binary, the source files in
+// each, and the functions each file contributed.
+class CUView {
+    constructor(container) {
+        const self = this;
+        this._container = container;
+        $(container).addClass("cuview");
+
+        const search = $('<input type="text" size="40" placeholder="filter files by regexp">').appendTo(container);
+        this._list = $("<div>").text("Loading compile units…").appendTo(container);
+        search.on("input", () => {
+            let re = null;
+            if (search.val() != "") {
+                try {
+                    re = new RegExp(search.val());
+                } catch (error) {
+                    search[0].setCustomValidity(error.message);
+                    return;
+                }
+            }
+            search[0].setCustomValidity("");
+            self._populate(re);
+        });
+
+        // The CU index can be expensive to compute, so fetch it
+        // separately from the page.
+        $.getJSON("/cus").done((data) => {
+            self._cus = data.CUs || [];
+            self._populate(null);
+        }).fail((xhr) => {
+            showError("Compile units", xhr, self._list.empty());
+        });
+    }
+
+    _populate(filterRe) {
+        if (!this._cus)
+            return;
+        const list = this._list.empty();
+        for (let cu of this._cus) {
+            const files = cu.Files.filter((f) => filterRe === null || filterRe.test(f.Name));
+            if (files.length == 0)
+                continue;
+            const cuElt = $("<details>").appendTo(list);
+            $("<summary>").addClass("cuview-cu").
+                text(cu.Name + " (" + cu.Size + " bytes)").
+                attr("title", cu.Producer || "").appendTo(cuElt);
+            for (let file of files) {
+                const fileElt = $("<details>").addClass("cuview-file").appendTo(cuElt);
+                $("<summary>").text(file.Name + " (" + file.Size + " bytes)").appendTo(fileElt);
+                const table = $("<table>").appendTo(fileElt);
+                for (let fn of file.Funcs) {
+                    let name = $("<td>").text(fn.Name);
+                    if (fn.Sym) {
+                        name = $("<td>").append($("<a>").attr("href", "/s/" + fn.Sym).text(fn.Name));
+                    }
+                    $("<tr>").append(name).
+                        append($("<td>").addClass("pos").text(fn.Size)).
+                        appendTo(table);
+                }
+            }
+            if (filterRe !== null)
+                cuElt.attr("open", true);
+        }
+    }
+}
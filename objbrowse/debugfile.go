@@ -0,0 +1,229 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aclements/objbrowse/internal/pdb"
+	"github.com/aclements/objbrowse/obj"
+)
+
+// debugDirs are the global directories searched for separate debug
+// info files, in order.
+var debugDirs = []string{"/usr/lib/debug"}
+
+// findDebugFile returns the path of the separate debug info file for
+// bin, which was loaded from path, or "" if there is none.
+//
+// It follows the GDB conventions: first it looks up bin's build ID
+// under .build-id in each debug directory, and then it looks for the
+// file named by bin's .gnu_debuglink next to bin, in a .debug
+// subdirectory, and under each debug directory. For a PE image, it
+// looks for the image's PDB file.
+func findDebugFile(path string, bin obj.Obj, warn *warnings) string {
+	if *flagDebug != "" {
+		return *flagDebug
+	}
+
+	dirs := debugDirs
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs[:len(dirs):len(dirs)], filepath.Join(home, ".debug"))
+	}
+
+	if id, ok := obj.BuildID(bin); ok && len(id) >= 2 {
+		h := hex.EncodeToString(id)
+		for _, dir := range dirs {
+			for _, cand := range []string{
+				filepath.Join(dir, ".build-id", h[:2], h[2:]+".debug"),
+				// perf's build-id cache layout.
+				filepath.Join(dir, ".build-id", h[:2], h[2:], "debug"),
+			} {
+				if isFile(cand) {
+					return cand
+				}
+			}
+		}
+	}
+
+	if name, crc, ok := obj.DebugLink(bin); ok {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			abs = path
+		}
+		binDir := filepath.Dir(abs)
+		cands := []string{
+			filepath.Join(binDir, name),
+			filepath.Join(binDir, ".debug", name),
+		}
+		for _, dir := range dirs {
+			cands = append(cands, filepath.Join(dir, binDir, name))
+		}
+		for _, cand := range cands {
+			if cand == abs || !isFile(cand) {
+				continue
+			}
+			data, err := ioutil.ReadFile(cand)
+			if err != nil {
+				continue
+			}
+			if crc32.ChecksumIEEE(data) != crc {
+				warn.warnf("ignoring debug file %s: CRC mismatch", cand)
+				continue
+			}
+			return cand
+		}
+	}
+
+	if h, ok := obj.ReadPEHeaders(bin); ok {
+		return findPDB(path, h, warn)
+	}
+	return ""
+}
+
+// findPDB returns the path of the PDB file for the PE image at path,
+// or "" if there is none. It looks for the PDB named in the image's
+// debug directory at that path and next to the image, and then for
+// the image's name with a .pdb extension next to the image. If the
+// debug directory identifies the PDB, the PDB must match.
+func findPDB(path string, h *obj.PEHeaders, warn *warnings) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	binDir := filepath.Dir(abs)
+	stem := strings.TrimSuffix(abs, filepath.Ext(abs)) + ".pdb"
+
+	var cands []string
+	guid := ""
+	for _, d := range h.Debug {
+		if d.PDB == "" {
+			continue
+		}
+		guid = d.GUID
+		// The path was recorded on the build machine,
+		// which was probably Windows.
+		base := d.PDB[strings.LastIndexAny(d.PDB, `/\`)+1:]
+		cands = append(cands, d.PDB, filepath.Join(binDir, base))
+		break
+	}
+	cands = append(cands, stem)
+	for _, cand := range cands {
+		if !isFile(cand) {
+			continue
+		}
+		if guid == "" {
+			return cand
+		}
+		f, err := os.Open(cand)
+		if err != nil {
+			continue
+		}
+		candGUID, err := obj.PDBGUID(f)
+		f.Close()
+		if err != nil {
+			warn.warnf("ignoring debug file %s: %v", cand, err)
+			continue
+		}
+		if candGUID != guid {
+			warn.warnf("ignoring debug file %s: GUID mismatch", cand)
+			continue
+		}
+		return cand
+	}
+	return ""
+}
+
+func isFile(path string) bool {
+	st, err := os.Stat(path)
+	return err == nil && st.Mode().IsRegular()
+}
+
+// attachDebugFile pairs bin with its separate debug info file, if it
+// has one. If bin has no static symbol table, it also takes symbols
+// from the debug file.
+//
+// Unless -debug-file is given, this only searches for a debug file if
+// bin has no DWARF of its own. If -debug-build is given, it uses that
+// instead of a debug file. Files that the result reads from are added
+// to files.
+func attachDebugFile(path string, bin obj.Obj, warn *warnings, files *closers) (obj.Obj, string, error) {
+	if *flagDebugBuild != "" {
+		return attachDebugBuild(bin, *flagDebugBuild, warn, files)
+	}
+	if *flagDebug == "" {
+		if _, err := bin.DWARF(); err == nil {
+			return bin, "", nil
+		}
+	}
+	dpath := findDebugFile(path, bin, warn)
+	if dpath == "" {
+		return bin, "", nil
+	}
+	f, err := os.Open(dpath)
+	if err != nil {
+		return nil, "", err
+	}
+	var debug obj.Obj
+	if pdb.IsPDB(f) {
+		files.add(f)
+		debug, err = obj.OpenPDB(f, bin)
+	} else {
+		debug, err = openObj(f, files)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %v", dpath, err)
+	}
+
+	stripped := true
+	if syms, err := bin.Symbols(); err == nil {
+		var sym obj.Sym
+		for i := obj.SymID(0); i < syms.Len(); i++ {
+			syms.Get(i, &sym)
+			if !sym.Dynamic && !sym.Synthetic {
+				stripped = false
+				break
+			}
+		}
+	}
+	return obj.WithDebug(bin, debug, stripped), dpath, nil
+}
+
+// attachDebugBuild pairs bin with the unstripped build of the same
+// source at dpath, which provides bin's symbols and, if the builds'
+// code is laid out the same, its DWARF.
+func attachDebugBuild(bin obj.Obj, dpath string, warn *warnings, files *closers) (obj.Obj, string, error) {
+	f, err := os.Open(dpath)
+	if err != nil {
+		return nil, "", err
+	}
+	files.add(f)
+	debug, err := obj.Open(f)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %v", dpath, err)
+	}
+	o, m, err := obj.WithDebugBuild(bin, debug)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %v", dpath, err)
+	}
+	if m.Matched < m.Checked {
+		warn.warnf("debug build %s: only %d of %d sampled functions match; symbols may be wrong", dpath, m.Matched, m.Checked)
+	}
+	if moved := strings.Join(m.Moved, ", "); !m.DWARF {
+		warn.warnf("debug build %s: code is laid out differently (%s moved); using its symbols, but not its DWARF", dpath, moved)
+	} else if moved != "" {
+		warn.warnf("debug build %s: data is laid out differently (%s moved); DWARF locations of global variables may be wrong", dpath, moved)
+	}
+	if len(m.Missing) > 0 {
+		warn.warnf("debug build %s has sections missing from this build (%s); ignoring their symbols", dpath, strings.Join(m.Missing, ", "))
+	}
+	return o, dpath, nil
+}
@@ -0,0 +1,206 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// A compression is a compressed file format.
+type compression struct {
+	name  string
+	magic string
+	// cmd decompresses standard input to standard output, for
+	// formats the standard library doesn't support.
+	cmd []string
+	// payloadOnly indicates the magic is too weak to identify a
+	// whole file, so the format is only recognized as the payload
+	// of a kernel image.
+	payloadOnly bool
+}
+
+// compressions are the formats of compressed files and of the
+// payloads of Linux kernel images.
+var compressions = []*compression{
+	{name: "gzip", magic: "\x1f\x8b"},
+	{name: "bzip2", magic: "BZh"},
+	{name: "xz", magic: "\xfd7zXZ\x00", cmd: []string{"xz", "-dc"}},
+	{name: "zstd", magic: "\x28\xb5\x2f\xfd", cmd: []string{"zstd", "-dc"}},
+	{name: "lzma", magic: "\x5d\x00\x00", cmd: []string{"xz", "--format=lzma", "-dc"}, payloadOnly: true},
+	{name: "lz4", magic: "\x02\x21\x4c\x18", cmd: []string{"lz4", "-dc"}, payloadOnly: true},
+	{name: "lzo", magic: "\x89LZO\x00", cmd: []string{"lzop", "-dc"}, payloadOnly: true},
+	// Kernels built with CONFIG_KERNEL_UNCOMPRESSED.
+	{name: "uncompressed", magic: "\x7fELF", payloadOnly: true},
+}
+
+// maxCompressionLayers bounds how many times openDecompressed unwraps
+// a file, such as a gzipped kernel image.
+const maxCompressionLayers = 4
+
+// openDecompressed opens the file at path. If the file is compressed
+// or is a compressed Linux kernel image (vmlinuz), it instead returns
+// a temporary file holding the decompressed contents.
+func openDecompressed(path string) (*os.File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < maxCompressionLayers; i++ {
+		c, r, err := findCompressed(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if c == nil {
+			break
+		}
+		tmp, err := ioutil.TempFile("", "objbrowse-")
+		if err == nil {
+			err = c.decompress(tmp, r)
+		}
+		f.Close()
+		if tmp != nil {
+			// The caller reads the object from the open
+			// file, so this only removes its name. Where
+			// open files can't be removed, it's left for
+			// the OS to clean up.
+			os.Remove(tmp.Name())
+		}
+		if err != nil {
+			if tmp != nil {
+				tmp.Close()
+			}
+			return nil, fmt.Errorf("%s: decompressing %s: %v", path, c.name, err)
+		}
+		f = tmp
+	}
+	return f, nil
+}
+
+// findCompressed returns the compression format of f and the
+// compressed data, or nil if f isn't compressed.
+func findCompressed(f *os.File) (*compression, *io.SectionReader, error) {
+	st, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	var hdr [0x300]byte
+	n, _ := f.ReadAt(hdr[:], 0)
+	k, ok := kernelPayload(hdr[:n])
+	if !ok {
+		for _, c := range compressions {
+			if !c.payloadOnly && bytes.HasPrefix(hdr[:n], []byte(c.magic)) {
+				return c, io.NewSectionReader(f, 0, st.Size()), nil
+			}
+		}
+		return nil, nil, nil
+	}
+
+	if k.off < 0 || k.size < 0 || k.off+k.size > st.Size() {
+		return nil, nil, fmt.Errorf("kernel image payload is out of bounds")
+	}
+	// Both kinds of image record the compression format, but
+	// Kbuild's names for the formats vary, so identify it from
+	// the payload.
+	var c *compression
+	var magic [8]byte
+	n, _ = f.ReadAt(magic[:], k.off)
+	for _, c1 := range compressions {
+		if bytes.HasPrefix(magic[:n], []byte(c1.magic)) {
+			c = c1
+			break
+		}
+	}
+	if c == nil {
+		return nil, nil, fmt.Errorf("kernel image has unknown compression")
+	}
+	size := k.size
+	if k.sizeTrailer && c.name != "gzip" && c.name != "uncompressed" && size >= 4 {
+		// Kbuild appends the decompressed size to all
+		// compression formats but gzip, which records it
+		// itself.
+		size -= 4
+	}
+	return c, io.NewSectionReader(f, k.off, size), nil
+}
+
+// kernelImage describes the compressed kernel in a Linux kernel image.
+type kernelImage struct {
+	off, size int64
+	// sizeTrailer indicates the payload may end with the
+	// decompressed size, which isn't part of the compressed data.
+	sizeTrailer bool
+}
+
+// kernelPayload locates the compressed kernel in a Linux kernel image
+// with header hdr. It returns false if hdr isn't a kernel image.
+func kernelPayload(hdr []byte) (kernelImage, bool) {
+	le := binary.LittleEndian
+	switch {
+	case len(hdr) >= 0x250 && string(hdr[0x202:0x206]) == "HdrS" && le.Uint16(hdr[0x206:]) >= 0x208:
+		// An x86 bzImage. The payload follows the real-mode
+		// setup code. See Documentation/arch/x86/boot.rst.
+		setupSects := int64(hdr[0x1f1])
+		if setupSects == 0 {
+			setupSects = 4
+		}
+		return kernelImage{
+			off:         (setupSects+1)*512 + int64(le.Uint32(hdr[0x248:])),
+			size:        int64(le.Uint32(hdr[0x24c:])),
+			sizeTrailer: true,
+		}, true
+
+	case len(hdr) >= 0x20 && string(hdr[:2]) == "MZ" && string(hdr[4:8]) == "zimg":
+		// An EFI zboot image, as used on arm64 and riscv. The
+		// payload size excludes any trailer. See
+		// drivers/firmware/efi/libstub/zboot-header.S.
+		return kernelImage{
+			off:  int64(le.Uint32(hdr[8:])),
+			size: int64(le.Uint32(hdr[12:])),
+		}, true
+	}
+	return kernelImage{}, false
+}
+
+// decompress decompresses r to w.
+func (c *compression) decompress(w io.Writer, r io.Reader) error {
+	switch c.name {
+	case "gzip":
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(w, zr)
+		return err
+	case "bzip2":
+		_, err := io.Copy(w, bzip2.NewReader(r))
+		return err
+	case "uncompressed":
+		_, err := io.Copy(w, r)
+		return err
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command(c.cmd[0], c.cmd[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = r, w, &stderr
+	if err := cmd.Run(); err != nil {
+		if _, ok := err.(*exec.Error); ok {
+			return fmt.Errorf("%v (install %s to open %s-compressed files)", err, c.cmd[0], c.name)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%s: %s", c.cmd[0], msg)
+		}
+		return fmt.Errorf("%s: %v", c.cmd[0], err)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/aclements/objbrowse/obj"
+)
+
+// setDownload sets the headers of w so browsers save the response as
+// a file named name, after making name safe to use as a file name.
+func setDownload(w http.ResponseWriter, name, contentType string) {
+	safe := strings.Map(func(r rune) rune {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, name)
+	// Don't produce hidden files, like ".text.bin".
+	safe = strings.TrimLeft(safe, ".")
+	if safe == "" {
+		safe = "download"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": safe}))
+}
+
+// writeAsm writes an assembly listing of function id to w, in the
+// style of go tool objdump: each instruction's source line, address,
+// encoding, and Go syntax.
+func (s *state) writeAsm(w io.Writer, id obj.SymID) error {
+	sym := s.symTab.Syms()[id]
+	if sym.Kind != obj.SymText {
+		return fmt.Errorf("%s is not a function", sym.Name)
+	}
+	insts, err := s.fi.Disasm(id)
+	if err != nil {
+		return err
+	}
+	data, err := s.bin.SymbolData(id)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	file, _ := s.fi.Line(sym.Value)
+	fmt.Fprintf(bw, "TEXT %s(SB) %s\n", sym.Name, file)
+	for i := 0; i < insts.Len(); i++ {
+		inst := insts.Get(i)
+		pos := "?"
+		if file, line := s.fi.Line(inst.PC()); file != "" {
+			pos = fmt.Sprintf("%s:%d", filepath.Base(file), line)
+		}
+		var enc []byte
+		if off := inst.PC() - data.Addr; off < uint64(len(data.P)) {
+			end := off + uint64(inst.Len())
+			if end > uint64(len(data.P)) {
+				end = uint64(len(data.P))
+			}
+			enc = data.P[off:end]
+		}
+		fmt.Fprintf(bw, "  %s\t%#x\t%x\t%s\n", pos, inst.PC(), enc, inst.GoSyntax(s.fi.SymTab.SymName))
+	}
+	return bw.Flush()
+}
+
+// serveSymAsm serves the assembly listing of function id as a .s
+// file.
+func (s *state) serveSymAsm(w http.ResponseWriter, id obj.SymID) {
+	// Produce the whole listing before writing headers so
+	// failures are reported as errors rather than truncated files.
+	var buf strings.Builder
+	if err := s.writeAsm(&buf, id); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	setDownload(w, s.symTab.Syms()[id].Name+".s", "text/plain; charset=utf-8")
+	io.WriteString(w, buf.String())
+}
+
+// serveSymBin serves the raw bytes of symbol id as a .bin file.
+func (s *state) serveSymBin(w http.ResponseWriter, id obj.SymID) {
+	data, err := s.bin.SymbolData(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	setDownload(w, s.symTab.Syms()[id].Name+".bin", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data.P)))
+	w.Write(data.P)
+}
+
+// httpSection serves the raw bytes of the section named by the "name"
+// query parameter as a .bin file. If several sections have the name,
+// it serves the first.
+func (s *state) httpSection(w http.ResponseWriter, r *http.Request) {
+	name := r.FormValue("name")
+	for i, sect := range s.bin.Sections() {
+		if sect.Name != name {
+			continue
+		}
+		data, err := s.bin.SectionData(i)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		setDownload(w, name+".bin", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.Itoa(len(data.P)))
+		w.Write(data.P)
+		return
+	}
+	http.Error(w, fmt.Sprintf("unknown section %q", name), http.StatusNotFound)
+}
+
+// serveSymsCSV serves syms as a CSV file with the same columns as the
+// syms query.
+func (s *state) serveSymsCSV(w http.ResponseWriter, syms []obj.Sym) {
+	setDownload(w, filepath.Base(s.path)+".syms.csv", "text/csv; charset=utf-8")
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"name", "kind", "addr", "size", "local", "attrs", "version"})
+	for _, sym := range syms {
+		cw.Write([]string{
+			sym.Name,
+			string(rune(sym.Kind)),
+			fmt.Sprintf("%#x", sym.Value),
+			strconv.FormatUint(sym.Size, 10),
+			strconv.FormatBool(sym.Local),
+			symAttrs(sym),
+			sym.Version,
+		})
+	}
+	cw.Flush()
+}
@@ -0,0 +1,147 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/sha256"
+	"debug/dwarf"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/aclements/objbrowse/internal/dwindex"
+	"github.com/aclements/objbrowse/obj"
+)
+
+// DWIndex returns the accelerated DWARF index for Obj, or nil if Obj
+// has no DWARF.
+//
+// It prefers the producer-generated .debug_names or .gdb_index
+// tables. Otherwise, it builds an index by walking the DWARF and
+// persists it in the user's cache directory so later runs on the
+// same binary can skip the walk.
+func (fi *FileInfo) DWIndex() *dwindex.Index {
+	fi.dwIndexOnce.Do(func() {
+		fi.dwIndex = fi.loadDWIndex()
+	})
+	return fi.dwIndex
+}
+
+func (fi *FileInfo) loadDWIndex() *dwindex.Index {
+	dw, err := fi.DWARF()
+	if err != nil {
+		return nil
+	}
+
+	if info, order, ok := obj.DWARFSection(fi.Obj, ".debug_info"); ok {
+		if names, _, ok := obj.DWARFSection(fi.Obj, ".debug_names"); ok {
+			str, _, _ := obj.DWARFSection(fi.Obj, ".debug_str")
+			aranges, _, _ := obj.DWARFSection(fi.Obj, ".debug_aranges")
+			x, err := dwindex.ParseDebugNames(names, str, aranges, info, order)
+			if err == nil {
+				return x
+			}
+			logger.Warn("ignoring .debug_names", "err", err)
+		}
+		if data, _, ok := obj.DWARFSection(fi.Obj, ".gdb_index"); ok {
+			x, err := dwindex.ParseGdbIndex(data, info, order)
+			if err == nil {
+				return x
+			}
+			logger.Warn("ignoring .gdb_index", "err", err)
+		}
+	}
+
+	cache := fi.dwIndexCachePath()
+	if cache != "" {
+		if f, err := os.Open(cache); err == nil {
+			x, err := dwindex.Decode(f)
+			f.Close()
+			if err == nil {
+				return x
+			}
+		}
+	}
+
+	x, err := dwindex.Build(dw)
+	if err != nil {
+		logger.Warn("indexing DWARF", "err", err)
+		return nil
+	}
+	if cache != "" {
+		if err := writeDWIndex(cache, x); err != nil {
+			logger.Warn("caching DWARF index", "path", cache, "err", err)
+		}
+	}
+	return x
+}
+
+// dwIndexCachePath returns the path of the cached DWARF index for
+// this file, or "" if there's no cache directory. The cache is keyed
+// by build ID if the file has one, and otherwise by the path, size,
+// and modification time of the file and its debug file.
+func (fi *FileInfo) dwIndexCachePath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	var key string
+	if id, ok := obj.BuildID(fi.Obj); ok {
+		key = "buildid-" + hex.EncodeToString(id)
+	} else {
+		h := sha256.New()
+		for _, path := range []string{fi.Path, fi.DebugFile} {
+			if path == "" {
+				continue
+			}
+			abs, err := filepath.Abs(path)
+			if err != nil {
+				return ""
+			}
+			st, err := os.Stat(abs)
+			if err != nil {
+				return ""
+			}
+			fmt.Fprintf(h, "%s\x00%d\x00%d\x00", abs, st.Size(), st.ModTime().UnixNano())
+		}
+		key = "file-" + hex.EncodeToString(h.Sum(nil))
+	}
+	return filepath.Join(dir, "objbrowse", "dwindex", key)
+}
+
+// writeDWIndex atomically writes x to path.
+func writeDWIndex(path string, x *dwindex.Index) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(dir, filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if err := x.Encode(f); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// entryAt returns the DWARF entry at off, or nil if it can't be read.
+func entryAt(dw *dwarf.Data, off dwarf.Offset) *dwarf.Entry {
+	dr := dw.Reader()
+	dr.Seek(off)
+	ent, err := dr.Next()
+	if err != nil {
+		return nil
+	}
+	return ent
+}
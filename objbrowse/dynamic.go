@@ -0,0 +1,108 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+
+	"github.com/aclements/objbrowse/obj"
+)
+
+// DynamicJS describes how an ELF file is dynamically linked.
+type DynamicJS struct {
+	SOName  string   `json:",omitempty"`
+	RPath   []string `json:",omitempty"`
+	RunPath []string `json:",omitempty"`
+	// Needed lists the needed libraries in load order, with the
+	// versions required of each.
+	Needed []DynNeededJS
+	// Defs lists the versions the file defines.
+	Defs   []DynVersionDefJS
+	Errors []string `json:",omitempty"`
+}
+
+type DynNeededJS struct {
+	Name     string
+	Versions []DynVersionJS
+	// Unlisted indicates the library has version requirements
+	// but isn't in DT_NEEDED.
+	Unlisted bool `json:",omitempty"`
+}
+
+// DynVersionJS is a version required of a library. Syms is the number
+// of undefined symbols bound to it.
+type DynVersionJS struct {
+	Name string
+	Weak bool `json:",omitempty"`
+	Syms int
+}
+
+// DynVersionDefJS is a version defined by the file. Syms is the number
+// of symbols defined with it.
+type DynVersionDefJS struct {
+	Name    string
+	Base    bool     `json:",omitempty"`
+	Weak    bool     `json:",omitempty"`
+	Parents []string `json:",omitempty"`
+	Syms    int
+}
+
+// dynamic returns the dynamic linking information of the object, or
+// nil if it isn't an ELF file.
+func (s *state) dynamic() *DynamicJS {
+	d, ok := obj.ReadELFDynamic(s.bin)
+	if !ok {
+		return nil
+	}
+
+	// Count the dynamic symbols using each version.
+	type needKey struct{ lib, vers string }
+	needSyms := make(map[needKey]int)
+	defSyms := make(map[string]int)
+	for _, sym := range s.symTab.Syms() {
+		if !sym.Dynamic || sym.Version == "" {
+			continue
+		}
+		if sym.Library != "" {
+			needSyms[needKey{sym.Library, sym.Version}]++
+		} else {
+			defSyms[sym.Version]++
+		}
+	}
+
+	out := &DynamicJS{SOName: d.SOName, RPath: d.RPath, RunPath: d.RunPath,
+		Needed: []DynNeededJS{}, Defs: []DynVersionDefJS{}, Errors: d.Errors}
+	needs := make(map[string][]DynVersionJS)
+	for _, need := range d.VersionNeeds {
+		for _, v := range need.Versions {
+			needs[need.File] = append(needs[need.File], DynVersionJS{v.Name, v.Weak, needSyms[needKey{need.File, v.Name}]})
+		}
+	}
+	listed := make(map[string]bool)
+	for _, lib := range d.Needed {
+		listed[lib] = true
+		out.Needed = append(out.Needed, DynNeededJS{Name: lib, Versions: needs[lib]})
+	}
+	for _, need := range d.VersionNeeds {
+		if !listed[need.File] {
+			listed[need.File] = true
+			out.Needed = append(out.Needed, DynNeededJS{Name: need.File, Versions: needs[need.File], Unlisted: true})
+		}
+	}
+	for _, def := range d.VersionDefs {
+		out.Defs = append(out.Defs, DynVersionDefJS{def.Name, def.Base, def.Weak, def.Parents, defSyms[def.Name]})
+	}
+	return out
+}
+
+// httpDynamic serves the dynamic linking information as JSON.
+func (s *state) httpDynamic(w http.ResponseWriter, r *http.Request) {
+	d := s.dynamic()
+	if d == nil {
+		http.Error(w, "not an ELF file", http.StatusNotFound)
+		return
+	}
+	serveJSON(w, d)
+}
@@ -0,0 +1,81 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+"use strict";
+
+// DynamicView shows how an ELF file is dynamically linked: its
+// SONAME and search paths, the libraries it needs with the symbol
+// versions it requires of each, and the versions it defines.
+class DynamicView {
+    constructor(container) {
+        const details = $("<details>").addClass("dynamicview").appendTo(container);
+        $("<summary>").text("Dynamic linking").appendTo(details);
+        const div = $("<div>").appendTo(details);
+
+        details.one("toggle", () => {
+            div.text("Loading…");
+            $.getJSON("/dynamic").done((data) => {
+                div.empty();
+                const table = $("<table>").appendTo(div);
+                const row = (key, val) => {
+                    $("<tr>").append($("<th>").text(key)).append($("<td>").append(val)).appendTo(table);
+                };
+                if (data.SOName)
+                    row("SONAME", data.SOName);
+                if (data.RPath)
+                    row("RPATH", data.RPath.join(":"));
+                if (data.RunPath)
+                    row("RUNPATH", data.RunPath.join(":"));
+                if (data.Needed.length == 0 && data.Defs.length == 0 && table.children().length == 0)
+                    div.append("Not dynamically linked.");
+
+                if (data.Needed.length > 0) {
+                    $("<h4>").text("Needed libraries").appendTo(div);
+                    const needed = $("<table>").addClass("dyn-table").appendTo(div);
+                    $("<tr>").append(["library", "version", "symbols"].map((h) => $("<th>").text(h))).appendTo(needed);
+                    for (let lib of data.Needed) {
+                        const name = $("<td>").text(lib.Name);
+                        if (lib.Unlisted)
+                            name.append($("<span>").addClass("dyn-note").text(" (not in DT_NEEDED)"));
+                        const vers = lib.Versions || [];
+                        if (vers.length == 0) {
+                            $("<tr>").append(name, $("<td>").text("(unversioned)"), $("<td>")).appendTo(needed);
+                            continue;
+                        }
+                        name.attr("rowspan", vers.length);
+                        vers.forEach((v, i) => {
+                            const tr = $("<tr>").appendTo(needed);
+                            if (i == 0)
+                                tr.append(name);
+                            tr.append($("<td>").text(v.Name + (v.Weak ? " (weak)" : "")),
+                                      $("<td>").addClass("pos").text(v.Syms));
+                        });
+                    }
+                }
+
+                if (data.Defs.length > 0) {
+                    $("<h4>").text("Defined versions").appendTo(div);
+                    const defs = $("<table>").addClass("dyn-table").appendTo(div);
+                    $("<tr>").append(["version", "inherits", "symbols"].map((h) => $("<th>").text(h))).appendTo(defs);
+                    for (let d of data.Defs) {
+                        let name = d.Name;
+                        if (d.Base)
+                            name += " (file)";
+                        else if (d.Weak)
+                            name += " (weak)";
+                        $("<tr>").append(
+                            $("<td>").text(name),
+                            $("<td>").text((d.Parents || []).join(", ")),
+                            $("<td>").addClass("pos").text(d.Base ? "" : d.Syms)).
+                            appendTo(defs);
+                    }
+                }
+                for (let err of data.Errors || [])
+                    $("<div>").addClass("dyn-error").text(err).appendTo(div);
+            }).fail((xhr) => {
+                showError("Dynamic linking", xhr, div.empty());
+            });
+        });
+    }
+}
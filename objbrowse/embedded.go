@@ -0,0 +1,330 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/aclements/objbrowse/obj"
+)
+
+// EmbedScan finds files embedded in the object's data: common file
+// formats identified by their signatures, and files embedded in Go
+// binaries with go:embed.
+type EmbedScan struct {
+	fi *FileInfo
+
+	once  sync.Once
+	found []EmbeddedJS
+	err   error
+}
+
+func NewEmbedScan(fi *FileInfo) *EmbedScan {
+	return &EmbedScan{fi: fi}
+}
+
+type EmbedScanJS struct {
+	Files []EmbeddedJS
+}
+
+// EmbeddedJS is an embedded file.
+type EmbeddedJS struct {
+	// Kind is the format of the file: "zip", "gzip", "png",
+	// "elf", "pem", or "embed" for go:embed files.
+	Kind string
+	Addr AddrJS
+	Size uint64
+	// Name is the file name of go:embed files or the block type
+	// of PEM files.
+	Name string `json:",omitempty"`
+
+	Sym     string `json:",omitempty"`
+	SymAddr AddrJS `json:",omitempty"`
+}
+
+// An embedDetector recognizes a file format. Given data starting
+// with the format's signature, it returns the size of the file, or 0
+// if data isn't actually a file of that format. It may also return
+// a name for the file.
+type embedDetector func(data []byte) (size uint64, name string)
+
+var embedDetectors = []struct {
+	kind   string
+	sig    []byte
+	detect embedDetector
+}{
+	{"zip", []byte("PK\x03\x04"), detectZip},
+	{"gzip", []byte("\x1f\x8b\x08"), detectGzip},
+	{"png", []byte("\x89PNG\r\n\x1a\n"), detectPNG},
+	{"elf", []byte("\x7fELF"), detectELF},
+	{"pem", []byte("-----BEGIN "), detectPEM},
+}
+
+// Files returns the embedded files found in the object. The object
+// is scanned on first use.
+func (e *EmbedScan) Files() ([]EmbeddedJS, error) {
+	e.once.Do(func() {
+		e.found, e.err = e.scan()
+	})
+	return e.found, e.err
+}
+
+func (e *EmbedScan) scan() ([]EmbeddedJS, error) {
+	found := []EmbeddedJS{}
+	for _, si := range e.fi.DataSections() {
+		data, err := e.fi.Obj.SectionData(si)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range embedDetectors {
+			p := data.P
+			off := 0
+			for {
+				i := bytes.Index(p[off:], d.sig)
+				if i < 0 {
+					break
+				}
+				off += i
+				size, name := d.detect(p[off:])
+				if size == 0 {
+					off++
+					continue
+				}
+				found = append(found, EmbeddedJS{Kind: d.kind, Addr: AddrJS(data.Addr + uint64(off)), Size: size, Name: name})
+				// Don't report signatures within this
+				// file, such as the entries of a zip.
+				off += int(size)
+			}
+		}
+		found = append(found, e.scanGoEmbed(data)...)
+	}
+
+	// Attribute files to symbols.
+	symTab := e.fi.SymTab
+	for i := range found {
+		f := &found[i]
+		if id, ok := symTab.Addr(uint64(f.Addr)); ok {
+			sym := symTab.Syms()[id]
+			if uint64(f.Addr) < sym.Value+sym.Size {
+				f.Sym, f.SymAddr = sym.Name, AddrJS(sym.Value)
+			}
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Addr < found[j].Addr })
+	return found, nil
+}
+
+// Data returns the contents of the i'th embedded file.
+func (e *EmbedScan) Data(i int) (EmbeddedJS, []byte, error) {
+	files, err := e.Files()
+	if err != nil {
+		return EmbeddedJS{}, nil, err
+	}
+	if i < 0 || i >= len(files) {
+		return EmbeddedJS{}, nil, fmt.Errorf("no embedded file %d", i)
+	}
+	f := files[i]
+	data, err := e.fi.Obj.Data(uint64(f.Addr), f.Size)
+	if err != nil {
+		return f, nil, err
+	}
+	return f, data.P, nil
+}
+
+// scanGoEmbed finds go:embed file systems in data. The compiler lays
+// out each embed.FS's file list as a slice header pointing just past
+// itself, followed by the files:
+//
+//	struct {
+//		ptr      *file // == &files[0]
+//		len, cap int
+//		files    [len]struct {
+//			name, data string
+//			hash       [16]byte
+//		}
+//	}
+func (e *EmbedScan) scanGoEmbed(data obj.Data) []EmbeddedJS {
+	arch := e.fi.Obj.Info().Arch
+	if arch == nil {
+		return nil
+	}
+	ptrSize := uint64(arch.PtrSize)
+	word := func(p []byte) uint64 {
+		if ptrSize == 8 {
+			return arch.ByteOrder.Uint64(p)
+		}
+		return uint64(arch.ByteOrder.Uint32(p))
+	}
+	fileSize := 4*ptrSize + 16
+
+	var found []EmbeddedJS
+	p := data.P
+	for off := -data.Addr % ptrSize; off+3*ptrSize <= uint64(len(p)); off += ptrSize {
+		addr := data.Addr + off
+		if word(p[off:]) != addr+3*ptrSize {
+			continue
+		}
+		n := word(p[off+ptrSize:])
+		if n == 0 || n != word(p[off+2*ptrSize:]) || n > (uint64(len(p))-off)/fileSize {
+			continue
+		}
+		// Validate and collect the files.
+		var files []EmbeddedJS
+		for i := uint64(0); i < n; i++ {
+			f := p[off+3*ptrSize+i*fileSize:]
+			name, ok := e.readString(word(f), word(f[ptrSize:]))
+			if !ok || name == "" || !utf8.ValidString(name) {
+				files = nil
+				break
+			}
+			dataPtr, dataLen := word(f[2*ptrSize:]), word(f[3*ptrSize:])
+			if name[len(name)-1] == '/' {
+				// Directory entry.
+				continue
+			}
+			files = append(files, EmbeddedJS{Kind: "embed", Addr: AddrJS(dataPtr), Size: dataLen, Name: name})
+		}
+		found = append(found, files...)
+	}
+	return found
+}
+
+// readString reads a string of length n at address ptr.
+func (e *EmbedScan) readString(ptr, n uint64) (string, bool) {
+	if ptr == 0 || n > 4096 {
+		return "", false
+	}
+	data, err := e.fi.Obj.Data(ptr, n)
+	if err != nil || uint64(len(data.P)) != n {
+		return "", false
+	}
+	return string(data.P), true
+}
+
+func detectZip(data []byte) (uint64, string) {
+	// Find the end of central directory record that refers back
+	// to this archive.
+	const eocdLen = 22
+	for off := 0; ; {
+		i := bytes.Index(data[off:], []byte("PK\x05\x06"))
+		if i < 0 || off+i+eocdLen > len(data) {
+			return 0, ""
+		}
+		off += i
+		eocd := data[off:]
+		cdSize := binary.LittleEndian.Uint32(eocd[12:])
+		cdOff := binary.LittleEndian.Uint32(eocd[16:])
+		commentLen := int(binary.LittleEndian.Uint16(eocd[20:]))
+		if uint64(cdOff)+uint64(cdSize) == uint64(off) && off+eocdLen+commentLen <= len(data) {
+			return uint64(off + eocdLen + commentLen), ""
+		}
+		off++
+	}
+}
+
+// maxGzip limits how much detectGzip will decompress to find the end
+// of a gzip stream.
+const maxGzip = 256 << 20
+
+func detectGzip(data []byte) (uint64, string) {
+	// bytes.Reader is an io.ByteReader, so the gzip reader
+	// consumes exactly the compressed stream.
+	r := bytes.NewReader(data)
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return 0, ""
+	}
+	gz.Multistream(false)
+	n, err := io.Copy(ioutil.Discard, io.LimitReader(gz, maxGzip))
+	if err != nil || n == maxGzip {
+		return 0, ""
+	}
+	return uint64(len(data) - r.Len()), gz.Name
+}
+
+func detectPNG(data []byte) (uint64, string) {
+	off := 8
+	for off+12 <= len(data) {
+		n := int(binary.BigEndian.Uint32(data[off:]))
+		typ := data[off+4 : off+8]
+		for _, c := range typ {
+			if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z') {
+				return 0, ""
+			}
+		}
+		if n < 0 || off+12+n > len(data) {
+			return 0, ""
+		}
+		off += 12 + n
+		if string(typ) == "IEND" {
+			return uint64(off), ""
+		}
+	}
+	return 0, ""
+}
+
+func detectELF(data []byte) (uint64, string) {
+	if len(data) < 0x34 {
+		return 0, ""
+	}
+	var order binary.ByteOrder
+	switch data[5] {
+	case 1:
+		order = binary.LittleEndian
+	case 2:
+		order = binary.BigEndian
+	default:
+		return 0, ""
+	}
+	// The section header table is conventionally at the end of
+	// the file.
+	var shoff, shentsize, shnum uint64
+	switch data[4] {
+	case 1:
+		shoff = uint64(order.Uint32(data[0x20:]))
+		shentsize, shnum = uint64(order.Uint16(data[0x2e:])), uint64(order.Uint16(data[0x30:]))
+	case 2:
+		if len(data) < 0x40 {
+			return 0, ""
+		}
+		shoff = order.Uint64(data[0x28:])
+		shentsize, shnum = uint64(order.Uint16(data[0x3a:])), uint64(order.Uint16(data[0x3c:]))
+	default:
+		return 0, ""
+	}
+	size := shoff + shentsize*shnum
+	if shoff == 0 || size > uint64(len(data)) {
+		return 0, ""
+	}
+	return size, ""
+}
+
+func detectPEM(data []byte) (uint64, string) {
+	// Get the block type from the BEGIN line.
+	line := data[len("-----BEGIN "):]
+	end := bytes.Index(line, []byte("-----"))
+	if end <= 0 || end > 64 {
+		return 0, ""
+	}
+	typ := string(line[:end])
+	endLine := []byte("-----END " + typ + "-----")
+	i := bytes.Index(data, endLine)
+	if i < 0 {
+		return 0, ""
+	}
+	size := i + len(endLine)
+	if size < len(data) && data[size] == '\n' {
+		size++
+	}
+	return uint64(size), typ
+}
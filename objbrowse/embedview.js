@@ -0,0 +1,45 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+"use strict";
+
+// EmbedView lists the files embedded in the binary, with links to
+// download each one.
+class EmbedView {
+    constructor(container) {
+        const self = this;
+        const details = $("<details>").addClass("embedview").appendTo(container);
+        $("<summary>").text("Embedded files").appendTo(details);
+        const list = $("<table>").appendTo(details);
+
+        // Scanning can be slow, so only do it when opened.
+        details.one("toggle", () => {
+            list.text("Scanning…");
+            $.getJSON("/embedded").done((data) => {
+                list.empty();
+                if (data.Files.length == 0)
+                    list.text("none found");
+                data.Files.forEach((f, i) => {
+                    const addr = new AddrJS(f.Addr);
+                    let loc = $("<td>");
+                    if (f.Sym) {
+                        const off = addr.sub(new AddrJS(f.SymAddr));
+                        const range = {start: off, end: off.add(new AddrJS(1))};
+                        loc.append($("<a>").attr("href", "/s/" + f.Sym + "#+" + formatRanges([range])).
+                                   text(f.Sym + "+0x" + off));
+                    }
+                    $("<tr>").
+                        append($("<td>").addClass("pos").text("0x" + addr)).
+                        append($("<td>").text(f.Kind)).
+                        append($("<td>").append($("<a>").attr("href", "/embedded/" + i).
+                                                text(f.Name || "download"))).
+                        append($("<td>").addClass("pos").text(f.Size + " bytes")).
+                        append(loc).appendTo(list);
+                });
+            }).fail((xhr) => {
+                showError("Embedded files", xhr, list.empty());
+            });
+        });
+    }
+}
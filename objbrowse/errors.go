@@ -0,0 +1,62 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aclements/objbrowse/internal/functab"
+	"github.com/aclements/objbrowse/internal/logging"
+	"github.com/aclements/objbrowse/obj"
+)
+
+// ViewErrorJS reports that a view failed, so the page can show the
+// error instead of silently omitting the view.
+type ViewErrorJS struct {
+	// View names the view or stage that failed, such as
+	// "Disassembly" or "DWARF".
+	View  string
+	Error string
+}
+
+// viewErrors collects the errors for a page.
+type viewErrors []ViewErrorJS
+
+// add records that view failed with err. It also logs err to lg,
+// since it may indicate a bug.
+func (e *viewErrors) add(lg *logging.Logger, view string, err error) {
+	lg.Warn("view failed", "view", view, "err", err)
+	*e = append(*e, ViewErrorJS{view, err.Error()})
+}
+
+// fileErrors adds problems with the object file as a whole to e: the
+// warnings from loading it and any error loading its DWARF or Go
+// function table.
+func (s *state) fileErrors(e *viewErrors) {
+	for _, w := range s.warnings {
+		*e = append(*e, ViewErrorJS{"Loading", w})
+	}
+	if _, err := s.fi.DWARF(); err != nil && !errors.Is(err, obj.ErrNoDWARF) {
+		*e = append(*e, ViewErrorJS{"DWARF", err.Error()})
+	}
+	// Most binaries that have no Go function table aren't Go
+	// binaries, so only report a table that's there but broken.
+	var fe *functab.FormatError
+	if _, err := s.fi.FuncTab(); errors.As(err, &fe) {
+		*e = append(*e, ViewErrorJS{"Go function table", err.Error()})
+	}
+}
+
+// warnings collects non-fatal problems found while loading the
+// object file.
+type warnings []string
+
+// warnf logs and records a warning.
+func (w *warnings) warnf(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	logger.Warn(msg)
+	*w = append(*w, msg)
+}
@@ -0,0 +1,280 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aclements/objbrowse/internal/profile"
+)
+
+// stackData is a set of weighted stacks exported to external
+// visualization tools, such as the size tree or an overlay.
+type stackData struct {
+	// Type describes the values.
+	Type   profile.ValueType
+	Stacks []weightedStack
+}
+
+type weightedStack struct {
+	// Frames is the stack, outermost first.
+	Frames []profile.Frame
+	Value  int64
+}
+
+// sizeStacks returns the size tree as stacks, with one stack per
+// leaf of the tree.
+func (s *state) sizeStacks() *stackData {
+	d := &stackData{Type: profile.ValueType{Type: "size", Unit: "bytes"}}
+	var walk func(n *SizeNodeJS, frames []profile.Frame)
+	walk = func(n *SizeNodeJS, frames []profile.Frame) {
+		name := n.Name
+		if n.Sym != "" {
+			name = n.Sym
+		}
+		frames = append(frames, profile.Frame{Func: name})
+		if len(n.Children) == 0 {
+			if id, ok := s.symTab.Lookup(n.Sym); ok && n.Sym != "" {
+				// Give pprof the symbol's address and file,
+				// but not a line, since the size is the
+				// whole symbol's.
+				leaf := &frames[len(frames)-1]
+				leaf.Addr = s.symTab.Syms()[id].Value
+				leaf.File, _ = s.fi.Line(leaf.Addr)
+			}
+			d.Stacks = append(d.Stacks, weightedStack{append([]profile.Frame(nil), frames...), int64(n.Value)})
+			return
+		}
+		for _, k := range n.Children {
+			walk(k, frames)
+		}
+	}
+	root := s.symView.SizeTree(0)
+	for _, k := range root.Children {
+		walk(k, nil)
+	}
+	return d
+}
+
+// overlayStacks returns the entries of overlay o as stacks of the Go
+// package or section, the symbol, and the source line of each entry.
+// Entry values are rounded to integers, and entries without a value
+// count as 1.
+func (s *state) overlayStacks(o *OverlayJS) *stackData {
+	d := &stackData{Type: profile.ValueType{Type: "value", Unit: "count"}}
+	sects := s.fi.Obj.Sections()
+	syms := s.symTab.Syms()
+	for _, e := range o.Entries {
+		value := int64(1)
+		if e.Value != nil {
+			value = int64(math.Round(*e.Value))
+		}
+		if value == 0 {
+			continue
+		}
+		pc := uint64(e.Start)
+		file, line := s.fi.Line(pc)
+		leaf := profile.Frame{File: file, Line: int64(line), Addr: pc}
+		var frames []profile.Frame
+		if id, ok := s.symTab.Addr(pc); ok {
+			leaf.Func = syms[id].Name
+			pkg := s.symView.origins.Pkg(id)
+			if pkg == "" {
+				pkg = goPackage(leaf.Func)
+			}
+			if pkg != "" {
+				frames = append(frames, profile.Frame{Func: pkg})
+			}
+		} else {
+			leaf.Func = "(unknown)"
+			for _, sect := range sects {
+				if sect.Addr <= pc && pc-sect.Addr < sect.Size {
+					frames = append(frames, profile.Frame{Func: sect.Name})
+					break
+				}
+			}
+		}
+		frames = append(frames, leaf)
+		d.Stacks = append(d.Stacks, weightedStack{frames, value})
+	}
+	return d
+}
+
+// writePprof writes d as a gzipped pprof profile.
+func (d *stackData) writePprof(w io.Writer) error {
+	b := profile.NewBuilder(d.Type)
+	for _, st := range d.Stacks {
+		// pprof stacks are leaf first.
+		stack := make([]profile.Frame, len(st.Frames))
+		for i, f := range st.Frames {
+			stack[len(stack)-1-i] = f
+		}
+		b.Add(stack, st.Value)
+	}
+	_, err := b.WriteTo(w)
+	return err
+}
+
+// foldedNames returns the names of the frames of a stack in folded
+// stacks and traces. A frame with a line is split into the function
+// and a "file:line" frame, so each line is its own frame.
+func foldedNames(frames []profile.Frame) []string {
+	var names []string
+	for _, f := range frames {
+		names = append(names, f.Func)
+		if f.Line != 0 {
+			names = append(names, fmt.Sprintf("%s:%d", filepath.Base(f.File), f.Line))
+		}
+	}
+	return names
+}
+
+// foldedEscaper removes the separators of the folded stack format
+// from frame names: semicolons separate frames and newlines separate
+// stacks.
+var foldedEscaper = strings.NewReplacer(";", ",", "\n", " ")
+
+// writeFolded writes d in the folded stack format read by
+// flamegraph.pl and most flame graph tools: one line per distinct
+// stack, with frames separated by ";" and followed by the total value.
+func (d *stackData) writeFolded(w io.Writer) error {
+	totals := make(map[string]int64)
+	var keys []string
+	for _, st := range d.Stacks {
+		names := foldedNames(st.Frames)
+		for i, name := range names {
+			names[i] = foldedEscaper.Replace(name)
+		}
+		key := strings.Join(names, ";")
+		if _, ok := totals[key]; !ok {
+			keys = append(keys, key)
+		}
+		totals[key] += st.Value
+	}
+	sort.Strings(keys)
+	bw := bufio.NewWriter(w)
+	for _, key := range keys {
+		fmt.Fprintf(bw, "%s %d\n", key, totals[key])
+	}
+	return bw.Flush()
+}
+
+// traceNode is a node in the tree of stacks laid out as a trace.
+type traceNode struct {
+	name  string
+	value int64
+	kids  []*traceNode
+	byKey map[string]*traceNode
+}
+
+// traceEventJS is a complete ("X") event in the Chrome trace event
+// format.
+type traceEventJS struct {
+	Name string `json:"name"`
+	Ph   string `json:"ph"`
+	Ts   int64  `json:"ts"`
+	Dur  int64  `json:"dur"`
+	Pid  int    `json:"pid"`
+	Tid  int    `json:"tid"`
+}
+
+// writePerfetto writes d in the Chrome trace event JSON format, which
+// Perfetto and chrome://tracing display. The stacks are merged into a
+// tree and each node becomes a slice whose duration is its value, so
+// the trace viewer shows the tree like a flame graph, with one
+// microsecond per unit.
+func (d *stackData) writePerfetto(w io.Writer) error {
+	root := &traceNode{}
+	for _, st := range d.Stacks {
+		n := root
+		n.value += st.Value
+		for _, name := range foldedNames(st.Frames) {
+			k := n.byKey[name]
+			if k == nil {
+				if n.byKey == nil {
+					n.byKey = make(map[string]*traceNode)
+				}
+				k = &traceNode{name: name}
+				n.byKey[name] = k
+				n.kids = append(n.kids, k)
+			}
+			k.value += st.Value
+			n = k
+		}
+	}
+	events := []traceEventJS{}
+	var walk func(n *traceNode, ts int64)
+	walk = func(n *traceNode, ts int64) {
+		sort.SliceStable(n.kids, func(i, j int) bool {
+			return n.kids[i].value > n.kids[j].value
+		})
+		for _, k := range n.kids {
+			if k.value <= 0 {
+				continue
+			}
+			events = append(events, traceEventJS{Name: k.name, Ph: "X", Ts: ts, Dur: k.value, Pid: 1, Tid: 1})
+			walk(k, ts)
+			ts += k.value
+		}
+	}
+	walk(root, 0)
+	return json.NewEncoder(w).Encode(struct {
+		TraceEvents []traceEventJS `json:"traceEvents"`
+	}{events})
+}
+
+// httpExport serves the size tree or an overlay in a format for
+// external visualization tools.
+//
+//	what=sizes             the size tree (default)
+//	what=overlay&name=N    overlay N
+//	format=pprof           a gzipped pprof profile (default)
+//	format=folded          folded stacks for flame graph tools
+//	format=perfetto        Chrome trace event JSON for Perfetto
+func (s *state) httpExport(w http.ResponseWriter, r *http.Request) {
+	var d *stackData
+	name := filepath.Base(s.path)
+	switch what := r.FormValue("what"); what {
+	case "", "sizes":
+		d = s.sizeStacks()
+		name += ".sizes"
+	case "overlay":
+		o := overlays.get(r.FormValue("name"))
+		if o == nil {
+			http.Error(w, "no such overlay", http.StatusNotFound)
+			return
+		}
+		d = s.overlayStacks(o)
+		name += "." + o.Name
+	default:
+		http.Error(w, fmt.Sprintf("unknown export %q", what), http.StatusBadRequest)
+		return
+	}
+
+	var write func(io.Writer) error
+	switch format := r.FormValue("format"); format {
+	case "", "pprof":
+		write = d.writePprof
+		setDownload(w, name+".pb.gz", "application/octet-stream")
+	case "folded":
+		write = d.writeFolded
+		setDownload(w, name+".folded", "text/plain; charset=utf-8")
+	case "perfetto":
+		write = d.writePerfetto
+		setDownload(w, name+".json", "application/json")
+	default:
+		http.Error(w, fmt.Sprintf("unknown format %q", format), http.StatusBadRequest)
+		return
+	}
+	write(w)
+}
@@ -0,0 +1,227 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/aclements/objbrowse/internal/asm"
+	"github.com/aclements/objbrowse/internal/elfobj"
+	"github.com/aclements/objbrowse/obj"
+)
+
+// extractObj returns a relocatable ELF object containing just
+// function id, so it can be linked into other programs.
+//
+// The object defines the function as a global symbol in .text, and
+// every symbol it refers to is undefined. Its relocations are the
+// object's relocations in the function, if any, plus a relocation for
+// each PC-relative operand that refers outside the function, which
+// recovers the references of functions from linked binaries. References
+// to unnamed addresses refer to an undefined symbol named after the
+// section containing the address. Absolute
+// addresses in linked binaries can't be recovered, so they're left
+// as is.
+func (s *state) extractObj(id obj.SymID) (*elfobj.File, error) {
+	sym := s.symTab.Syms()[id]
+	if sym.Kind != obj.SymText {
+		return nil, fmt.Errorf("%s is not a function", sym.Name)
+	}
+	f := &elfobj.File{Data: elf.ELFDATA2LSB}
+	var pc32, plt32, pc8 uint32
+	switch arch := s.fi.Obj.Info().Arch; {
+	case arch == nil:
+		return nil, fmt.Errorf("unknown architecture")
+	case arch.GoArch == "amd64":
+		f.Class, f.Machine = elf.ELFCLASS64, elf.EM_X86_64
+		pc32, plt32, pc8 = uint32(elf.R_X86_64_PC32), uint32(elf.R_X86_64_PLT32), uint32(elf.R_X86_64_PC8)
+	case arch.GoArch == "386":
+		// Calls through the PLT need EBX set up, so use plain
+		// PC-relative relocations.
+		f.Class, f.Machine = elf.ELFCLASS32, elf.EM_386
+		pc32, plt32, pc8 = uint32(elf.R_386_PC32), uint32(elf.R_386_PC32), uint32(elf.R_386_PC8)
+	default:
+		return nil, fmt.Errorf("extracting %s objects is not supported", arch)
+	}
+
+	data, err := s.bin.SymbolData(id)
+	if err != nil {
+		return nil, err
+	}
+	insts, err := s.fi.Disasm(id)
+	if err != nil {
+		return nil, err
+	}
+
+	text := &elfobj.Section{
+		Name:  ".text",
+		Type:  elf.SHT_PROGBITS,
+		Flags: elf.SHF_ALLOC | elf.SHF_EXECINSTR,
+		Align: 16,
+		Data:  append([]byte(nil), data.P...),
+	}
+	fn := &elfobj.Symbol{Name: sym.Name, Bind: elf.STB_GLOBAL, Type: elf.STT_FUNC, Section: text, Size: uint64(len(data.P))}
+	// Mark the stack non-executable, as compilers do.
+	noteStack := &elfobj.Section{Name: ".note.GNU-stack", Type: elf.SHT_PROGBITS, Align: 1}
+	f.Sections = []*elfobj.Section{text, noteStack}
+	f.Symbols = []*elfobj.Symbol{fn}
+	undef := make(map[string]*elfobj.Symbol)
+	symbol := func(name string) *elfobj.Symbol {
+		if name == sym.Name {
+			return fn
+		}
+		if u := undef[name]; u != nil {
+			return u
+		}
+		u := &elfobj.Symbol{Name: name, Bind: elf.STB_GLOBAL}
+		undef[name] = u
+		f.Symbols = append(f.Symbols, u)
+		return u
+	}
+
+	// Copy the object's own relocations.
+	covered := make(map[uint64]bool)
+	sects := s.bin.Sections()
+	var r obj.Reloc
+	for i := 0; i < data.R.Len(); i++ {
+		data.R.Get(i, &r)
+		if r.Offset < data.Addr || r.Offset-data.Addr >= uint64(len(data.P)) {
+			continue
+		}
+		var typ uint32
+		switch t := r.Type.(type) {
+		case elf.R_X86_64:
+			typ = uint32(t)
+		case elf.R_386:
+			typ = uint32(t)
+		default:
+			return nil, fmt.Errorf("unsupported relocation type %s", r.Type)
+		}
+		var target *elfobj.Symbol
+		if r.Symbol >= 0 {
+			tsym := s.symTab.Syms()[r.Symbol]
+			name := tsym.Name
+			if name == "" && 0 <= tsym.Section && tsym.Section < len(sects) {
+				// Section symbols are unnamed.
+				name = sects[tsym.Section].Name
+			}
+			target = symbol(name)
+		}
+		off := r.Offset - data.Addr
+		text.Relocs = append(text.Relocs, elfobj.Reloc{Offset: off, Type: typ, Sym: target, Addend: r.Addend})
+		covered[off] = true
+	}
+
+	// Add relocations for references that were resolved when
+	// the function was linked or assembled.
+	for i := 0; i < insts.Len(); i++ {
+		inst := insts.Get(i)
+		off, size, target := inst.PCRel()
+		if size == 0 || target-sym.Value < sym.Size {
+			continue
+		}
+		fieldOff := inst.PC() - data.Addr + uint64(off)
+		if covered[fieldOff] {
+			continue
+		}
+		name, base := s.fi.SymTab.SymName(target)
+		if name == "" {
+			// Calls to dynamic symbols go through unnamed
+			// PLT stubs.
+			name, base = s.pltTarget(target), target
+		}
+		if name == "" {
+			// Fall back to the section, like references
+			// to section symbols above.
+			for _, sect := range sects {
+				if sect.Addr <= target && target-sect.Addr < sect.Size {
+					name, base = sect.Name, sect.Addr
+					break
+				}
+			}
+		}
+		if name == "" {
+			return nil, fmt.Errorf("no symbol at %#x, referenced at %#x", target, inst.PC())
+		}
+		// The CPU adds the displacement to the address of
+		// the next instruction, not of the field.
+		addend := int64(target-base) - int64(inst.Len()-off)
+		var typ uint32
+		switch size {
+		case 4:
+			typ = pc32
+			if inst.Control().Type == asm.ControlCall || inst.Control().Type == asm.ControlJump {
+				typ = plt32
+			}
+		case 1:
+			typ = pc8
+		default:
+			return nil, fmt.Errorf("unsupported %d-byte PC-relative operand at %#x", size, inst.PC())
+		}
+		if f.Class == elf.ELFCLASS32 {
+			// 32-bit relocations take their addend from the
+			// relocated field.
+			field := text.Data[fieldOff : fieldOff+uint64(size)]
+			if size == 4 {
+				binary.LittleEndian.PutUint32(field, uint32(addend))
+			} else {
+				field[0] = byte(addend)
+			}
+		}
+		text.Relocs = append(text.Relocs, elfobj.Reloc{Offset: fieldOff, Type: typ, Sym: symbol(name), Addend: addend})
+	}
+	return f, nil
+}
+
+// pltTarget returns the name of the dynamic symbol that the PLT stub
+// at addr jumps to, or "" if addr isn't a recognizable PLT stub.
+func (s *state) pltTarget(addr uint64) string {
+	const maxStub = 16
+	data, err := s.bin.Data(addr, maxStub)
+	if err != nil || data.P == nil {
+		return ""
+	}
+	insts, err := asm.Disasm(s.fi.Obj.Info().Arch, data.P, addr)
+	if err != nil {
+		return ""
+	}
+	// The stub may start with an ENDBR instruction, but jumps
+	// through a GOT slot with a jump slot relocation soon after.
+	for i := 0; i < insts.Len() && i < 2; i++ {
+		inst := insts.Get(i)
+		if inst.Control().Type != asm.ControlJump {
+			continue
+		}
+		for _, slot := range inst.Consts() {
+			if name := s.fi.RelocTarget(slot); name != "" {
+				return name
+			}
+		}
+		break
+	}
+	return ""
+}
+
+// serveSymObj serves function id as a relocatable object file.
+func (s *state) serveSymObj(w http.ResponseWriter, id obj.SymID) {
+	f, err := s.extractObj(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	var buf bytes.Buffer
+	if _, err := f.WriteTo(&buf); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	setDownload(w, s.symTab.Syms()[id].Name+".o", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.Write(buf.Bytes())
+}
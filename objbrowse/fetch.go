@@ -0,0 +1,157 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// isRemote reports whether the objfile argument names something other
+// than a local file: "-" for stdin, or an HTTP or HTTPS URL.
+func isRemote(arg string) bool {
+	return arg == "-" || strings.HasPrefix(arg, "http://") || strings.HasPrefix(arg, "https://")
+}
+
+// fetchObj copies the object named by arg, which must satisfy
+// isRemote, to a temporary file and returns the file's path. The file
+// is named after the object so it's recognizable in the UI. The
+// temporary directory is removed if the process is interrupted.
+func fetchObj(arg string) (string, error) {
+	name := "stdin"
+	if arg != "-" {
+		u, err := url.Parse(arg)
+		if err != nil {
+			return "", err
+		}
+		if base := path.Base(u.Path); base != "/" && base != "." {
+			name = base
+		} else {
+			name = u.Host
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "objbrowse")
+	if err != nil {
+		return "", err
+	}
+	atExit(func() { os.RemoveAll(dir) })
+	dst := filepath.Join(dir, name)
+	if arg == "-" {
+		err = copyToFile(dst, os.Stdin)
+	} else {
+		err = download(dst, arg)
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return dst, nil
+}
+
+const (
+	// downloadTimeout bounds how long download waits for a URL,
+	// including reading the body.
+	downloadTimeout = 10 * time.Minute
+
+	// maxDownloadSize is the largest object download accepts.
+	maxDownloadSize = 4 << 30
+)
+
+var downloadClient = &http.Client{Timeout: downloadTimeout}
+
+// download fetches the URL src to the file dst, reporting progress
+// on stderr.
+func download(dst, src string) error {
+	resp, err := downloadClient.Get(src)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching %s: %s", src, resp.Status)
+	}
+	if resp.ContentLength > maxDownloadSize {
+		return fmt.Errorf("fetching %s: %s exceeds limit of %s", src, formatBytes(resp.ContentLength), formatBytes(maxDownloadSize))
+	}
+	p := &progress{name: src, total: resp.ContentLength}
+	// Read one byte past the limit to detect a body that exceeds
+	// it.
+	err = copyToFile(dst, io.TeeReader(io.LimitReader(resp.Body, maxDownloadSize+1), p))
+	p.done()
+	if err == nil && p.n > maxDownloadSize {
+		err = fmt.Errorf("exceeds limit of %s", formatBytes(maxDownloadSize))
+	}
+	if err != nil {
+		return fmt.Errorf("fetching %s: %v", src, err)
+	}
+	return nil
+}
+
+func copyToFile(dst string, r io.Reader) error {
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// progress reports the progress of a download on stderr. It's an
+// io.Writer that counts the bytes written to it.
+type progress struct {
+	name  string
+	total int64 // Or -1 if unknown
+	n     int64
+	last  time.Time
+}
+
+func (p *progress) Write(b []byte) (int, error) {
+	p.n += int64(len(b))
+	if now := time.Now(); now.Sub(p.last) >= 200*time.Millisecond {
+		p.last = now
+		p.print()
+	}
+	return len(b), nil
+}
+
+func (p *progress) print() {
+	if p.total > 0 {
+		fmt.Fprintf(os.Stderr, "\rfetching %s: %s of %s (%d%%)", p.name, formatBytes(p.n), formatBytes(p.total), p.n*100/p.total)
+	} else {
+		fmt.Fprintf(os.Stderr, "\rfetching %s: %s", p.name, formatBytes(p.n))
+	}
+}
+
+// done prints the final progress and ends the progress line.
+func (p *progress) done() {
+	p.print()
+	fmt.Fprintln(os.Stderr)
+}
+
+// formatBytes formats n using binary units.
+func formatBytes(n int64) string {
+	const units = "KMGT"
+	if n < 1024 {
+		return fmt.Sprintf("%d bytes", n)
+	}
+	v, i := float64(n)/1024, 0
+	for v >= 1024 && i < len(units)-1 {
+		v /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f %ciB", v, units[i])
+}
@@ -0,0 +1,625 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"sync"
+
+	"github.com/aclements/objbrowse/internal/asm"
+	"github.com/aclements/objbrowse/internal/btf"
+	"github.com/aclements/objbrowse/internal/dwindex"
+	"github.com/aclements/objbrowse/internal/functab"
+	"github.com/aclements/objbrowse/internal/symtab"
+	"github.com/aclements/objbrowse/obj"
+)
+
+// FileInfo is the object file being browsed, plus derived information
+// that's shared between views.
+type FileInfo struct {
+	Obj    obj.Obj
+	SymTab *symtab.Table
+	// Path is the path Obj was loaded from.
+	Path string
+	// DebugFile is the path of the separate debug info file
+	// paired with Obj, or "".
+	DebugFile string
+	// BTFPath is the path of a file of BTF type information to
+	// use instead of Obj's .BTF section, or "".
+	BTFPath string
+
+	// caches holds data decoded from Obj that can be rebuilt.
+	caches *fileCaches
+
+	dwarfOnce sync.Once
+	dwarf     *dwarf.Data
+	dwarfErr  error
+
+	btfOnce sync.Once
+	btf     *btf.Spec
+	btfErr  error
+
+	dwIndexOnce sync.Once
+	dwIndex     *dwindex.Index
+
+	cuOnce   sync.Once
+	cuRanges []CURange
+
+	dieOnce sync.Once
+	dieAddr map[uint64]symDIE
+
+	funcTabOnce sync.Once
+	funcTab     *functab.FuncTab
+	funcTabErr  error
+	pcToFunc    map[uint64]*functab.Func
+
+	fingerprintOnce sync.Once
+	fingerprint     *FingerprintJS
+}
+
+type CURange struct {
+	Low, High uint64
+	CU        *dwarf.Entry
+}
+
+// DWARF returns the DWARF data for Obj. It is loaded on first use and
+// shared by all views.
+func (fi *FileInfo) DWARF() (*dwarf.Data, error) {
+	fi.dwarfOnce.Do(func() {
+		fi.dwarf, fi.dwarfErr = fi.Obj.DWARF()
+	})
+	return fi.dwarf, fi.dwarfErr
+}
+
+// BTF returns the BTF type information from BTFPath or, if that's
+// not set, from Obj's .BTF section. It is loaded on first use.
+func (fi *FileInfo) BTF() (*btf.Spec, error) {
+	fi.btfOnce.Do(func() {
+		var data []byte
+		if fi.BTFPath != "" {
+			data, fi.btfErr = ioutil.ReadFile(fi.BTFPath)
+		} else {
+			fi.btfErr = fmt.Errorf("no .BTF section")
+			for i, sect := range fi.Obj.Sections() {
+				if sect.Name == ".BTF" {
+					var d obj.Data
+					d, fi.btfErr = fi.Obj.SectionData(i)
+					data = d.P
+					break
+				}
+			}
+		}
+		if fi.btfErr == nil {
+			fi.btf, fi.btfErr = btf.Parse(data)
+		}
+	})
+	return fi.btf, fi.btfErr
+}
+
+// FuncTab returns the decoded Go function table, or an error if there
+// is no Go function table or it can't be decoded.
+func (fi *FileInfo) FuncTab() (*functab.FuncTab, error) {
+	fi.funcTabOnce.Do(func() {
+		data, err := fi.pclntab()
+		if err != nil {
+			fi.funcTabErr = err
+			return
+		}
+		fi.funcTab, fi.funcTabErr = functab.NewFuncTab(data, fi.Obj)
+		if fi.funcTabErr != nil {
+			return
+		}
+		fi.pcToFunc = make(map[uint64]*functab.Func)
+		for _, fn := range fi.funcTab.Funcs {
+			fi.pcToFunc[fn.PC] = fn
+		}
+	})
+	return fi.funcTab, fi.funcTabErr
+}
+
+// pclntab returns the contents of the Go function table. It prefers
+// the .gopclntab section because, since Go 1.16, the runtime.pclntab
+// symbol has no size, and stripped binaries have no symbol at all.
+func (fi *FileInfo) pclntab() ([]byte, error) {
+	for i, sect := range fi.Obj.Sections() {
+		if sect.Name == ".gopclntab" {
+			data, err := fi.Obj.SectionData(i)
+			if err != nil {
+				return nil, err
+			}
+			return data.P, nil
+		}
+	}
+
+	pclntab, ok := fi.SymTab.Lookup("runtime.pclntab")
+	if !ok {
+		return nil, fmt.Errorf("no runtime.pclntab symbol")
+	}
+	sym := fi.SymTab.Syms()[pclntab]
+	if sym.Size == 0 {
+		// Find the end from runtime.epclntab.
+		if end, ok := fi.SymTab.Lookup("runtime.epclntab"); ok {
+			if endSym := fi.SymTab.Syms()[end]; endSym.Value > sym.Value {
+				data, err := fi.Obj.Data(sym.Value, endSym.Value-sym.Value)
+				return data.P, err
+			}
+		}
+	}
+	data, err := fi.Obj.SymbolData(pclntab)
+	if err != nil {
+		return nil, err
+	}
+	// TODO: What if data has relocations (e.g., in a .so)?
+	return data.P, nil
+}
+
+// Func returns the Go function table entry for the function starting
+// at pc, or nil if there is none.
+func (fi *FileInfo) Func(pc uint64) *functab.Func {
+	if _, err := fi.FuncTab(); err != nil {
+		return nil
+	}
+	return fi.pcToFunc[pc]
+}
+
+// FuncAt returns the Go function table entry for the function
+// containing pc, or nil if there is none.
+func (fi *FileInfo) FuncAt(pc uint64) *functab.Func {
+	ft, err := fi.FuncTab()
+	if err != nil || pc >= ft.EndPC {
+		return nil
+	}
+	i := sort.Search(len(ft.Funcs), func(i int) bool {
+		return pc < ft.Funcs[i].PC
+	}) - 1
+	if i < 0 {
+		return nil
+	}
+	return ft.Funcs[i]
+}
+
+// GoLine returns the source position of pc from the Go function
+// table, or "", 0 if it's unknown. This works even without DWARF.
+func (fi *FileInfo) GoLine(pc uint64) (file string, line int) {
+	fn := fi.FuncAt(pc)
+	if fn == nil {
+		return "", 0
+	}
+	fileNum, ok1 := fn.PCFile.Decode().Lookup(pc)
+	lineNum, ok2 := fn.PCLn.Decode().Lookup(pc)
+	if !ok1 || !ok2 {
+		return "", 0
+	}
+	return fn.FileName(fileNum), int(lineNum)
+}
+
+// instBytes estimates the memory of one disassembled instruction,
+// including its decoded arguments.
+const instBytes = 256
+
+// Disasm disassembles text symbol id. The result is cached until it's
+// evicted under -max-memory.
+func (fi *FileInfo) Disasm(id obj.SymID) (asm.Seq, error) {
+	return fi.disasm(id, true)
+}
+
+// disasm disassembles text symbol id, using a cached disassembly if
+// there is one. If add is false, a new disassembly isn't cached.
+func (fi *FileInfo) disasm(id obj.SymID, add bool) (asm.Seq, error) {
+	if fi.caches != nil {
+		if insts, ok := fi.caches.disasm.Get(id); ok {
+			return insts.(asm.Seq), nil
+		}
+	}
+	arch := fi.Obj.Info().Arch
+	if arch == nil {
+		return nil, fmt.Errorf("unknown architecture")
+	}
+	data, err := fi.Obj.SymbolData(id)
+	if err != nil {
+		return nil, err
+	}
+	insts, err := asm.Disasm(arch, data.P, data.Addr)
+	if err == nil && add && fi.caches != nil {
+		fi.caches.disasm.Add(id, insts, int64(insts.Len())*instBytes)
+	}
+	return insts, err
+}
+
+// ForEachText calls fn with the disassembly of each text symbol in
+// the object. Symbols that can't be disassembled are skipped. If
+// progress is non-nil, ForEachText reports the number of symbols
+// processed to it. ForEachText uses cached disassemblies, but doesn't
+// cache its own, which would evict everything else.
+func (fi *FileInfo) ForEachText(progress progressFunc, fn func(id obj.SymID, sym obj.Sym, insts asm.Seq)) {
+	syms := fi.SymTab.Syms()
+	isText := func(sym obj.Sym) bool {
+		return sym.Kind == obj.SymText && sym.Size != 0
+	}
+	total, done := 0, 0
+	if progress != nil {
+		for _, sym := range syms {
+			if isText(sym) {
+				total++
+			}
+		}
+	}
+	for i, sym := range syms {
+		if !isText(sym) {
+			continue
+		}
+		if progress != nil {
+			progress(done, total)
+			done++
+		}
+		insts, err := fi.disasm(obj.SymID(i), false)
+		if err != nil {
+			continue
+		}
+		fn(obj.SymID(i), sym, insts)
+	}
+	if progress != nil {
+		progress(total, total)
+	}
+}
+
+// CallTarget returns the name of the symbol directly called by inst,
+// or "" if inst is not a direct call to the start of a symbol.
+func (fi *FileInfo) CallTarget(inst asm.Inst) string {
+	c := inst.Control()
+	if c.Type != asm.ControlCall || c.TargetPC == 0 {
+		return ""
+	}
+	id, ok := fi.SymTab.Addr(c.TargetPC)
+	if !ok {
+		return ""
+	}
+	sym := fi.SymTab.Syms()[id]
+	if sym.Value != c.TargetPC {
+		return ""
+	}
+	return sym.Name
+}
+
+// RelocTarget returns the name of the symbol referred to by a
+// relocation at addr, such as a GOT slot's dynamic relocation, or ""
+// if there's no such relocation.
+func (fi *FileInfo) RelocTarget(addr uint64) string {
+	data, err := fi.Obj.Data(addr, 1)
+	if err != nil {
+		return ""
+	}
+	var r obj.Reloc
+	for i := 0; i < data.R.Len(); i++ {
+		data.R.Get(i, &r)
+		if r.Offset == addr && r.Symbol >= 0 {
+			return fi.SymTab.Syms()[r.Symbol].Name
+		}
+	}
+	return ""
+}
+
+// Line returns the source position of pc from DWARF, or "", 0 if
+// it's unknown. If there's no DWARF for pc, it falls back to the Go
+// function table.
+func (fi *FileInfo) Line(pc uint64) (file string, line int) {
+	rows, err := fi.LineTable(pc, pc+1)
+	if err != nil {
+		return fi.GoLine(pc)
+	}
+	if len(rows) == 0 || rows[0].EndSequence || rows[0].File == nil {
+		return "", 0
+	}
+	return rows[0].File.Name, rows[0].Line
+}
+
+// DataSections returns the indexes of the sections in Obj that have
+// contents in the file. In a linked object, it omits sections that
+// aren't loaded, like debug info, since their addresses are
+// meaningless.
+func (fi *FileInfo) DataSections() []int {
+	sects := fi.Obj.Sections()
+	linked := false
+	for _, sect := range sects {
+		linked = linked || sect.Addr != 0
+	}
+	var out []int
+	for i, sect := range sects {
+		if sect.Zero || sect.Size == 0 || (linked && sect.Addr == 0) {
+			continue
+		}
+		out = append(out, i)
+	}
+	return out
+}
+
+// AddrToCU returns the DWARF compile unit containing addr, or nil if
+// there is no such compile unit or no DWARF.
+func (fi *FileInfo) AddrToCU(addr uint64) *dwarf.Entry {
+	if x := fi.DWIndex(); x != nil && x.HasCUs() {
+		if off, ok := x.AddrToCU(addr); ok {
+			dw, _ := fi.DWARF()
+			if cu := entryAt(dw, off); cu != nil {
+				return cu
+			}
+		}
+		// .debug_aranges may not cover every CU, so fall
+		// back to our own index.
+	}
+
+	if r := fi.cuRange(addr); r != nil {
+		return r.CU
+	}
+	return nil
+}
+
+// cuRange returns the range of the compile unit containing addr
+// according to a walk of the compile units, or nil if none does.
+func (fi *FileInfo) cuRange(addr uint64) *CURange {
+	fi.cuOnce.Do(fi.indexCUs)
+
+	ranges := fi.cuRanges
+	i := sort.Search(len(ranges), func(i int) bool {
+		return addr < ranges[i].Low
+	}) - 1
+	if i < 0 {
+		return nil
+	}
+	cu := &ranges[i]
+	if cu.Low <= addr && addr < cu.High {
+		return cu
+	}
+	return nil
+}
+
+// indexCUs creates an address index for the CUs.
+func (fi *FileInfo) indexCUs() {
+	dw, err := fi.DWARF()
+	if err != nil {
+		return
+	}
+
+	var ranges []CURange
+	dr := dw.Reader()
+	for {
+		ent, err := dr.Next()
+		if ent == nil || err != nil {
+			break
+		}
+
+		if ent.Tag != dwarf.TagCompileUnit {
+			dr.SkipChildren()
+			continue
+		}
+
+		rs, err := dw.Ranges(ent)
+		if err != nil {
+			continue
+		}
+
+		for _, r := range rs {
+			ranges = append(ranges, CURange{r[0], r[1], ent})
+		}
+	}
+
+	// Sort address index.
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].Low < ranges[j].Low
+	})
+
+	fi.cuRanges = ranges
+}
+
+// LineTable returns the DWARF line table rows covering PCs [low,
+// high). The result includes the row that ends the range, which is
+// often an end_sequence row.
+func (fi *FileInfo) LineTable(low, high uint64) ([]dwarf.LineEntry, error) {
+	dw, err := fi.DWARF()
+	if err != nil {
+		return nil, err
+	}
+	cu := fi.AddrToCU(low)
+	if cu == nil {
+		return nil, fmt.Errorf("no DWARF data for address %#x", low)
+	}
+	lr, err := dw.LineReader(cu)
+	if err != nil {
+		return nil, err
+	}
+	if lr == nil {
+		return nil, fmt.Errorf("no line table for address %#x", low)
+	}
+
+	var line dwarf.LineEntry
+	if err = lr.SeekPC(low, &line); err == dwarf.ErrUnknownPC {
+		return nil, fmt.Errorf("no line table for address %#x", low)
+	} else if err != nil {
+		return nil, err
+	}
+
+	var rows []dwarf.LineEntry
+	for {
+		rows = append(rows, line)
+		if line.Address >= high || line.EndSequence {
+			break
+		}
+		if err = lr.Next(&line); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return rows, nil
+}
+
+// An InlineRange is a PC range of an inlined call.
+type InlineRange struct {
+	Low, High uint64
+	// Func is the name of the inlined function.
+	Func string
+	// Depth is the inlining depth of this range. Calls inlined
+	// directly into the outermost function have depth 1.
+	Depth int
+}
+
+// AddrToSubprogram returns the DWARF subprogram entry containing pc,
+// or nil if there is none.
+func (fi *FileInfo) AddrToSubprogram(pc uint64) (*dwarf.Entry, error) {
+	dw, err := fi.DWARF()
+	if err != nil {
+		return nil, err
+	}
+	if x := fi.DWIndex(); x != nil && x.HasFuncs() {
+		off, ok := x.AddrToFunc(pc)
+		if !ok {
+			return nil, nil
+		}
+		ent := entryAt(dw, off)
+		if ent == nil {
+			return nil, fmt.Errorf("reading DWARF entry at %#x", off)
+		}
+		return ent, nil
+	}
+
+	// The index doesn't map addresses to subprograms, so search
+	// the subprograms in the CU.
+	cu := fi.AddrToCU(pc)
+	if cu == nil {
+		return nil, fmt.Errorf("no DWARF data for address %#x", pc)
+	}
+	dr := dw.Reader()
+	dr.Seek(cu.Offset)
+	if _, err := dr.Next(); err != nil {
+		return nil, err
+	}
+	nesting := 0
+	for {
+		ent, err := dr.Next()
+		if err != nil {
+			return nil, err
+		}
+		if ent == nil || (ent.Tag == 0 && nesting == 0) {
+			// End of CU.
+			return nil, nil
+		}
+		if ent.Tag == 0 {
+			nesting--
+			continue
+		}
+		if ent.Tag != dwarf.TagSubprogram {
+			// Subprograms may be nested in namespaces
+			// and classes.
+			switch ent.Tag {
+			case dwarf.TagNamespace, dwarf.TagClassType, dwarf.TagStructType:
+				if ent.Children {
+					nesting++
+				}
+			default:
+				dr.SkipChildren()
+			}
+			continue
+		}
+		ranges, err := dw.Ranges(ent)
+		if err != nil || !rangesContain(ranges, pc) {
+			dr.SkipChildren()
+			continue
+		}
+		return ent, nil
+	}
+}
+
+// InlineRanges returns the PC ranges of calls inlined into the
+// function containing pc. The result is in DWARF tree order, so
+// outer calls precede the calls inlined into them.
+func (fi *FileInfo) InlineRanges(pc uint64) ([]InlineRange, error) {
+	dw, err := fi.DWARF()
+	if err != nil {
+		return nil, err
+	}
+	sub, err := fi.AddrToSubprogram(pc)
+	if sub == nil || err != nil || !sub.Children {
+		return nil, err
+	}
+	dr := dw.Reader()
+	dr.Seek(sub.Offset)
+	if _, err := dr.Next(); err != nil {
+		return nil, err
+	}
+
+	// Collect inlined subroutines in this subprogram. open tracks
+	// whether each enclosing DIE is an inlined subroutine.
+	var out []InlineRange
+	var open []bool
+	depth := 0
+	for {
+		ent, err := dr.Next()
+		if err != nil {
+			return nil, err
+		}
+		if ent == nil {
+			break
+		}
+		if ent.Tag == 0 {
+			if len(open) == 0 {
+				// End of the subprogram.
+				break
+			}
+			if open[len(open)-1] {
+				depth--
+			}
+			open = open[:len(open)-1]
+			continue
+		}
+		inline := ent.Tag == dwarf.TagInlinedSubroutine
+		if inline {
+			name := fi.abstractName(dw, ent)
+			ranges, _ := dw.Ranges(ent)
+			for _, r := range ranges {
+				out = append(out, InlineRange{r[0], r[1], name, depth + 1})
+			}
+		}
+		if ent.Children {
+			open = append(open, inline)
+			if inline {
+				depth++
+			}
+		}
+	}
+	return out, nil
+}
+
+func rangesContain(ranges [][2]uint64, pc uint64) bool {
+	for _, r := range ranges {
+		if r[0] <= pc && pc < r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// abstractName returns the name of ent, following
+// DW_AT_abstract_origin and DW_AT_specification if necessary.
+func (fi *FileInfo) abstractName(dw *dwarf.Data, ent *dwarf.Entry) string {
+	for i := 0; i < 4 && ent != nil; i++ {
+		if name, ok := ent.Val(dwarf.AttrName).(string); ok {
+			return name
+		}
+		off, ok := ent.Val(dwarf.AttrAbstractOrigin).(dwarf.Offset)
+		if !ok {
+			off, ok = ent.Val(dwarf.AttrSpecification).(dwarf.Offset)
+		}
+		if !ok {
+			break
+		}
+		r := dw.Reader()
+		r.Seek(off)
+		ent, _ = r.Next()
+	}
+	return "?"
+}
@@ -0,0 +1,260 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+
+	"github.com/aclements/objbrowse/obj"
+)
+
+// FingerprintJS describes the toolchain and build configuration of a
+// binary.
+type FingerprintJS struct {
+	// GoVersion is the Go version that built the binary, such as
+	// "go1.14.2", or "" if this doesn't appear to be a Go binary.
+	GoVersion string `json:",omitempty"`
+	// GoVersionSource is where GoVersion came from: "buildinfo"
+	// or "runtime.buildVersion".
+	GoVersionSource string `json:",omitempty"`
+	// PclntabVersion is the earliest Go version that uses this
+	// binary's pclntab format, such as "go1.2" or "go1.20".
+	PclntabVersion string `json:",omitempty"`
+
+	// Path and Main are the main package path and main module
+	// from the build info.
+	Path string `json:",omitempty"`
+	Main string `json:",omitempty"`
+	// Settings are the build settings from the build info, such
+	// as "-gcflags" and "CGO_ENABLED", in order.
+	Settings []BuildSettingJS `json:",omitempty"`
+
+	Format   string
+	Arch     string
+	PIE      bool
+	Stripped bool // No symbol table
+	DWARF    bool
+	// DebugFile is the separate debug info file providing DWARF,
+	// if any.
+	DebugFile string `json:",omitempty"`
+	Race      bool
+	CGO       bool
+}
+
+type BuildSettingJS struct {
+	Key, Value string
+}
+
+// buildInfoMagic starts the Go build info blob.
+var buildInfoMagic = []byte("\xff Go buildinf:")
+
+// Fingerprint identifies the toolchain and build configuration of
+// the object. It's computed on first use, and the result is shared,
+// so callers must not modify it.
+func (fi *FileInfo) Fingerprint() *FingerprintJS {
+	fi.fingerprintOnce.Do(func() {
+		fi.fingerprint = fi.computeFingerprint()
+	})
+	return fi.fingerprint
+}
+
+func (fi *FileInfo) computeFingerprint() *FingerprintJS {
+	info := fi.Obj.Info()
+	f := &FingerprintJS{
+		Format: info.Format,
+		Arch:   info.Arch.String(),
+		PIE:    info.PIE,
+	}
+	f.Stripped = len(fi.SymTab.Syms()) == 0
+	f.DebugFile = fi.DebugFile
+	_, err := fi.DWARF()
+	f.DWARF = err == nil
+
+	if vers, mod := fi.buildInfo(); vers != "" {
+		f.GoVersion, f.GoVersionSource = vers, "buildinfo"
+		f.parseModInfo(mod)
+	} else if vers := fi.stringSym("runtime.buildVersion"); vers != "" {
+		f.GoVersion, f.GoVersionSource = vers, "runtime.buildVersion"
+	}
+	f.PclntabVersion = fi.pclntabVersion()
+
+	_, f.Race = fi.SymTab.Lookup("runtime.racefuncenter")
+	_, f.CGO = fi.SymTab.Lookup("x_cgo_init")
+	for _, s := range f.Settings {
+		if s.Key == "-race" && s.Value == "true" {
+			f.Race = true
+		}
+	}
+	return f
+}
+
+// readString reads a Go string header at addr and returns the
+// string, or "" if it can't be read.
+func (fi *FileInfo) readString(addr uint64) string {
+	arch := fi.Obj.Info().Arch
+	if arch == nil {
+		return ""
+	}
+	ptrSize := uint64(arch.PtrSize)
+	hdr, err := fi.Obj.Data(addr, 2*ptrSize)
+	if err != nil || uint64(len(hdr.P)) != 2*ptrSize {
+		return ""
+	}
+	var ptr, n uint64
+	if ptrSize == 8 {
+		ptr, n = arch.ByteOrder.Uint64(hdr.P), arch.ByteOrder.Uint64(hdr.P[8:])
+	} else {
+		ptr, n = uint64(arch.ByteOrder.Uint32(hdr.P)), uint64(arch.ByteOrder.Uint32(hdr.P[4:]))
+	}
+	if n > 1<<20 {
+		return ""
+	}
+	data, err := fi.Obj.Data(ptr, n)
+	if err != nil || uint64(len(data.P)) != n {
+		return ""
+	}
+	return string(data.P)
+}
+
+// stringSym returns the value of Go string variable name, or "".
+func (fi *FileInfo) stringSym(name string) string {
+	id, ok := fi.SymTab.Lookup(name)
+	if !ok {
+		return ""
+	}
+	return fi.readString(fi.SymTab.Syms()[id].Value)
+}
+
+// buildInfo returns the Go version and module info strings from the
+// object's build info blob.
+func (fi *FileInfo) buildInfo() (vers, mod string) {
+	// The build info is in its own section in ELF and in the
+	// data section in PE, so search for it.
+	var data obj.Data
+	for _, si := range fi.DataSections() {
+		d, err := fi.Obj.SectionData(si)
+		if err != nil {
+			continue
+		}
+		if i := bytes.Index(d.P, buildInfoMagic); i >= 0 {
+			data = obj.Data{Addr: d.Addr + uint64(i), P: d.P[i:]}
+			break
+		}
+	}
+	const hdrSize = 32
+	if len(data.P) < hdrSize {
+		return "", ""
+	}
+	ptrSize, flags := int(data.P[14]), data.P[15]
+	if flags&2 != 0 {
+		// Since Go 1.18, the strings are inline and
+		// varint-prefixed.
+		p := data.P[hdrSize:]
+		readStr := func() string {
+			n, k := binary.Uvarint(p)
+			if k <= 0 || n > uint64(len(p)-k) {
+				p = nil
+				return ""
+			}
+			s := string(p[k : k+int(n)])
+			p = p[k+int(n):]
+			return s
+		}
+		vers = readStr()
+		mod = readStr()
+	} else {
+		// Before Go 1.18, the header is followed by pointers
+		// to the version and module info strings.
+		if ptrSize != 4 && ptrSize != 8 {
+			return "", ""
+		}
+		var order binary.ByteOrder = binary.LittleEndian
+		if flags&1 != 0 {
+			order = binary.BigEndian
+		}
+		ptr := func(off int) uint64 {
+			if ptrSize == 8 {
+				return order.Uint64(data.P[off:])
+			}
+			return uint64(order.Uint32(data.P[off:]))
+		}
+		vers = fi.readString(ptr(16))
+		mod = fi.readString(ptr(16 + ptrSize))
+	}
+	// The module info is wrapped in 16 byte sentinels.
+	if len(mod) >= 33 && mod[len(mod)-17] == '\n' {
+		mod = mod[16 : len(mod)-16]
+	} else {
+		mod = ""
+	}
+	return vers, mod
+}
+
+// parseModInfo fills in f from the module info in a Go build info
+// blob.
+func (f *FingerprintJS) parseModInfo(mod string) {
+	for _, line := range strings.Split(mod, "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "path":
+			f.Path = fields[1]
+		case "mod":
+			// Path and version, omitting the sum.
+			f.Main = fields[1]
+			if len(fields) > 2 {
+				f.Main += " " + fields[2]
+			}
+		case "build":
+			kv := strings.SplitN(fields[1], "=", 2)
+			if len(kv) == 2 {
+				// Values containing spaces are quoted.
+				f.Settings = append(f.Settings, BuildSettingJS{kv[0], strings.Trim(kv[1], `"`)})
+			}
+		}
+	}
+}
+
+// pclntabVersion returns the first Go version that used the
+// object's pclntab format, or "" if there's no pclntab.
+func (fi *FileInfo) pclntabVersion() string {
+	var hdr []byte
+	if id, ok := fi.SymTab.Lookup("runtime.pclntab"); ok {
+		if d, err := fi.Obj.SymbolData(id); err == nil {
+			hdr = d.P
+		}
+	} else {
+		for i, sect := range fi.Obj.Sections() {
+			if sect.Name == ".gopclntab" {
+				if d, err := fi.Obj.SectionData(i); err == nil {
+					hdr = d.P
+				}
+			}
+		}
+	}
+	if len(hdr) < 8 {
+		return ""
+	}
+	// The magic number may be in either byte order.
+	magic := binary.LittleEndian.Uint32(hdr)
+	if hdr[0] == 0xff {
+		magic = binary.BigEndian.Uint32(hdr)
+	}
+	switch magic {
+	case 0xfffffffb:
+		return "go1.2"
+	case 0xfffffffa:
+		return "go1.16"
+	case 0xfffffff0:
+		return "go1.18"
+	case 0xfffffff1:
+		return "go1.20"
+	}
+	return ""
+}
@@ -0,0 +1,504 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aclements/objbrowse/internal/asm"
+	"github.com/aclements/objbrowse/obj"
+)
+
+// GenericsScan groups the functions instantiated from the same Go
+// generic function or C++ template into families, to measure how much
+// code instantiation costs and how much of it is duplicated.
+type GenericsScan struct {
+	fi *FileInfo
+
+	once     sync.Once
+	families []*GenericFamilyJS
+}
+
+func NewGenericsScan(fi *FileInfo) *GenericsScan {
+	return &GenericsScan{fi: fi}
+}
+
+type GenericsReportJS struct {
+	// Families lists the largest families, largest first, and
+	// More counts those omitted.
+	Families []*GenericFamilyJS
+	More     int `json:",omitempty"`
+	// Insts and Total are the number of instantiations and their
+	// total size across all families.
+	Insts int
+	Total uint64
+	// Mergeable is the total size of instantiations whose code is
+	// identical to another instantiation in the same family.
+	Mergeable uint64
+}
+
+// GenericFamilyJS is the set of instantiations of one generic
+// function or template.
+type GenericFamilyJS struct {
+	// Name is the family's name, with type arguments elided as
+	// "[...]" in Go and "<…>" in C++.
+	Name string
+	// Insts lists the instantiations, largest first.
+	Insts []GenericInstJS
+	// Total is the size of the family's code. Instantiations that
+	// share an address, because the linker already merged them,
+	// are only counted once.
+	Total uint64
+	// Shaped counts the Go instantiations on GC shapes, which
+	// are shared by all type arguments with the same shape.
+	Shaped int `json:",omitempty"`
+	// Bodies is the number of distinct instantiation bodies, and
+	// OpBodies is the number of distinct sequences of operations,
+	// ignoring operands. If OpBodies < len(Insts), some
+	// instantiations differ only in their operands, such as type
+	// sizes or referenced type descriptors.
+	Bodies, OpBodies int
+	// Mergeable is the size of instantiations whose code is
+	// identical to a larger or earlier one in the family, and
+	// could be merged.
+	Mergeable uint64 `json:",omitempty"`
+}
+
+type GenericInstJS struct {
+	Name string
+	ID   obj.SymID
+	Size uint64
+	// Shape indicates a Go instantiation on GC shapes.
+	Shape bool `json:",omitempty"`
+	// Body identifies the instantiation's code within the family:
+	// instantiations with the same Body are identical.
+	Body int
+	// Folded indicates the instantiation shares its address with
+	// an earlier one.
+	Folded bool `json:",omitempty"`
+}
+
+// prepare finds and compares the instantiation families if it hasn't
+// been already, reporting progress to progress, which may be nil.
+func (g *GenericsScan) prepare(progress progressFunc) {
+	g.once.Do(func() {
+		syms := g.fi.SymTab.Syms()
+		byKey := make(map[string]*GenericFamilyJS)
+		for i, sym := range syms {
+			if sym.Kind != obj.SymText || sym.Size == 0 || sym.Synthetic {
+				continue
+			}
+			key, name, ok := genericFamily(sym.Name)
+			if !ok {
+				continue
+			}
+			f := byKey[key]
+			if f == nil {
+				f = &GenericFamilyJS{Name: name}
+				byKey[key] = f
+			}
+			f.Insts = append(f.Insts, GenericInstJS{
+				Name:  sym.Name,
+				ID:    obj.SymID(i),
+				Size:  sym.Size,
+				Shape: isGoShape(sym.Name),
+			})
+		}
+
+		// Only families with several instantiations are
+		// interesting.
+		total := 0
+		for _, f := range byKey {
+			if len(f.Insts) > 1 {
+				g.families = append(g.families, f)
+				total += len(f.Insts)
+			}
+		}
+		done := 0
+		for _, f := range g.families {
+			g.compare(f)
+			done += len(f.Insts)
+			if progress != nil {
+				progress(done, total)
+			}
+		}
+		sort.Slice(g.families, func(i, j int) bool {
+			if g.families[i].Total != g.families[j].Total {
+				return g.families[i].Total > g.families[j].Total
+			}
+			return g.families[i].Name < g.families[j].Name
+		})
+	})
+}
+
+// compare fills in the sizes and body comparison of family f.
+func (g *GenericsScan) compare(f *GenericFamilyJS) {
+	sort.Slice(f.Insts, func(i, j int) bool {
+		if f.Insts[i].Size != f.Insts[j].Size {
+			return f.Insts[i].Size > f.Insts[j].Size
+		}
+		return f.Insts[i].Name < f.Insts[j].Name
+	})
+	syms := g.fi.SymTab.Syms()
+	addrs := make(map[uint64]int)
+	bodies := make(map[uint64]int)
+	ops := make(map[uint64]bool)
+	for i := range f.Insts {
+		inst := &f.Insts[i]
+		if inst.Shape {
+			f.Shaped++
+		}
+		addr := syms[inst.ID].Value
+		if j, ok := addrs[addr]; ok {
+			inst.Folded, inst.Body = true, f.Insts[j].Body
+			continue
+		}
+		addrs[addr] = i
+		f.Total += inst.Size
+
+		code, op, ok := g.bodyKeys(inst.ID)
+		if !ok {
+			// Give undecodable bodies their own key.
+			code, op = uint64(addr), uint64(addr)
+		}
+		ops[op] = true
+		body, ok := bodies[code]
+		if ok {
+			f.Mergeable += inst.Size
+		} else {
+			body = len(bodies)
+			bodies[code] = body
+		}
+		inst.Body = body
+	}
+	f.Bodies, f.OpBodies = len(bodies), len(ops)
+}
+
+// bodyKeys returns hashes of the code of function id. code is equal
+// for functions with the same instructions and references, and ops is
+// equal for functions with the same sequence of operations.
+func (g *GenericsScan) bodyKeys(id obj.SymID) (code, ops uint64, ok bool) {
+	data, err := g.fi.Obj.SymbolData(id)
+	if err != nil {
+		return 0, 0, false
+	}
+	insts, err := asm.Disasm(g.fi.Obj.Info().Arch, data.P, data.Addr)
+	if err != nil {
+		return 0, 0, false
+	}
+	hc, ho := fnv.New64a(), fnv.New64a()
+	end := data.Addr + uint64(len(data.P))
+	for i := 0; i < insts.Len(); i++ {
+		inst := insts.Get(i)
+		raw := data.P[inst.PC()-data.Addr:][:inst.Len()]
+		off, size, target := inst.PCRel()
+		if size > 0 && (target < data.Addr || target >= end) {
+			// The displacement to a target outside the
+			// function depends on the function's address, so
+			// compare the target instead.
+			hc.Write(raw[:off])
+			fmt.Fprintf(hc, "<%s>", g.targetName(target))
+			hc.Write(raw[off+size:])
+		} else {
+			hc.Write(raw)
+		}
+		op, _ := parseAsm(inst.GoSyntax(nil))
+		io.WriteString(ho, op+";")
+	}
+	// In object files, references are in relocations.
+	var r obj.Reloc
+	syms := g.fi.SymTab.Syms()
+	for i := 0; i < data.R.Len(); i++ {
+		data.R.Get(i, &r)
+		name := ""
+		if r.Symbol >= 0 {
+			name = syms[r.Symbol].Name
+		}
+		fmt.Fprintf(hc, "%d:%s%+d;", r.Offset-data.Addr, name, r.Addend)
+	}
+	return hc.Sum64(), ho.Sum64(), true
+}
+
+// targetName returns addr as a symbol and offset, or as a number if
+// there's no symbol there.
+func (g *GenericsScan) targetName(addr uint64) string {
+	if name := g.fi.addrName(addr); name != "" {
+		return name
+	}
+	return strconv.FormatUint(addr, 16)
+}
+
+// Report returns the largest n families.
+func (g *GenericsScan) Report(n int) *GenericsReportJS {
+	g.prepare(nil)
+	out := &GenericsReportJS{Families: []*GenericFamilyJS{}}
+	for _, f := range g.families {
+		out.Insts += len(f.Insts)
+		out.Total += f.Total
+		out.Mergeable += f.Mergeable
+		out.Families = append(out.Families, f)
+	}
+	if len(out.Families) > n {
+		out.Families, out.More = out.Families[:n], len(out.Families)-n
+	}
+	return out
+}
+
+// genericFamily returns a key identifying the generic function or
+// template that the function name instantiates, and the readable name
+// of that function. It returns false if name isn't an instantiation.
+func genericFamily(name string) (key, family string, ok bool) {
+	if strings.HasPrefix(name, "_Z") {
+		return cxxFamily(name)
+	}
+	if !strings.Contains(name, "[") || isGoLinkerSym(name) {
+		// Linker-generated functions like "type:.eq.[2]string"
+		// aren't instantiations.
+		return "", "", false
+	}
+	var b strings.Builder
+	depth := 0
+	for i := 0; i < len(name); i++ {
+		switch name[i] {
+		case '[':
+			if depth == 0 {
+				b.WriteString("[...]")
+			}
+			depth++
+			continue
+		case ']':
+			depth--
+			if depth < 0 {
+				return "", "", false
+			}
+			continue
+		}
+		if depth == 0 {
+			b.WriteByte(name[i])
+		}
+	}
+	if depth != 0 {
+		return "", "", false
+	}
+	return b.String(), b.String(), true
+}
+
+// isGoShape reports whether name is a Go instantiation on GC shapes.
+func isGoShape(name string) bool {
+	return strings.Contains(name, "go.shape.")
+}
+
+// cxxFamily is genericFamily for Itanium-mangled C++ names. The key
+// is name without its template arguments, which still distinguishes
+// overloads, and the family is a readable name like
+// "std::vector<…>::push_back". This only understands enough of the
+// mangling to find and remove template argument lists.
+func cxxFamily(name string) (key, family string, ok bool) {
+	// Keep clone suffixes like ".isra.0" out of the parse.
+	suffix := ""
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		name, suffix = name[:i], name[i:]
+	}
+
+	// Build up the family's key, which is the mangled name
+	// without template arguments, and the parts of its readable
+	// name.
+	var k strings.Builder
+	var parts []string
+	var stack []byte // Open constructs that end with 'E'
+	args := 0        // Number of 'I' on stack
+	stripped := false
+	nested := len(name) > 2 && name[2] == 'N'
+	nameDone, std := false, false
+	emit := func(s string) {
+		if args == 0 {
+			k.WriteString(s)
+		}
+	}
+	addPart := func(p string) {
+		if nameDone || args > 0 {
+			return
+		}
+		if std {
+			p, std = "std::"+p, false
+		}
+		parts = append(parts, p)
+	}
+	k.WriteString("_Z")
+	for i := 2; i < len(name); {
+		c := name[i]
+		if !nested && !nameDone && args == 0 && len(parts) > 0 && c != 'I' {
+			// The name of an unscoped function is one
+			// identifier and its template arguments.
+			nameDone = true
+		}
+		switch {
+		case '0' <= c && c <= '9':
+			// <source-name> ::= <length> <identifier>
+			j := i
+			for j < len(name) && '0' <= name[j] && name[j] <= '9' {
+				j++
+			}
+			n, err := strconv.Atoi(name[i:j])
+			if err != nil || j+n > len(name) {
+				return "", "", false
+			}
+			addPart(name[j : j+n])
+			emit(name[i : j+n])
+			i = j + n
+			continue
+
+		case (c == 'C' || c == 'D') && i+1 < len(name) && '0' <= name[i+1] && name[i+1] <= '9':
+			// Constructor or destructor of the enclosing
+			// class.
+			if len(parts) > 0 {
+				class := strings.TrimPrefix(strings.TrimSuffix(parts[len(parts)-1], "<…>"), "std::")
+				if c == 'D' {
+					class = "~" + class
+				}
+				addPart(class)
+			}
+			// Complete and base object variants are often
+			// aliases, so put them in the same family. The
+			// deleting destructor D0 differs.
+			if name[i:i+2] == "D0" {
+				emit("D0")
+			} else {
+				emit(name[i : i+1])
+			}
+			i += 2
+			continue
+
+		case !nameDone && args == 0 && (nested && len(stack) == 1 || !nested && len(parts) == 0) &&
+			'a' <= c && c <= 'z' && !(nested && c == 'r') && i+1 < len(name) && 'a' <= name[i+1] && name[i+1] <= 'z':
+			// <operator-name>, where a name is expected. In
+			// nested names, r is the restrict qualifier.
+			op, ok := cxxOperators[name[i:i+2]]
+			if !ok {
+				op = " " + name[i:i+2]
+			}
+			addPart("operator" + op)
+			emit(name[i : i+2])
+			i += 2
+			continue
+
+		case c == 'S' && i+1 < len(name) && 'a' <= name[i+1] && name[i+1] <= 'z':
+			// Standard abbreviations like St (std::) and Sa
+			// (std::allocator).
+			if name[i+1] == 't' && !nameDone && args == 0 {
+				std = true
+			} else if abbr, ok := cxxAbbrevs[name[i+1]]; ok {
+				addPart(abbr)
+			}
+			emit(name[i : i+2])
+			i += 2
+			continue
+
+		case c == 'S' || c == 'T':
+			// <substitution> ::= S [<seq-id>] _
+			// <template-param> ::= T [<number>] _
+			j := strings.IndexByte(name[i:], '_')
+			if j < 0 {
+				return "", "", false
+			}
+			emit(name[i : i+j+1])
+			i += j + 1
+			continue
+
+		case c == 'L':
+			// <expr-primary> ::= L <type> <value> E
+			//                ::= L _Z <encoding> E
+			if strings.HasPrefix(name[i+1:], "_Z") {
+				stack = append(stack, 'L')
+				emit("L_Z")
+				i += 3
+				continue
+			}
+			j := strings.IndexByte(name[i:], 'E')
+			if j < 0 {
+				return "", "", false
+			}
+			emit(name[i : i+j+1])
+			i += j + 1
+			continue
+
+		case c == 'I':
+			// <template-args> ::= I <template-arg>+ E
+			if args == 0 && !nameDone && len(parts) > 0 {
+				parts[len(parts)-1] += "<…>"
+			}
+			stack = append(stack, 'I')
+			args++
+			stripped = true
+			i++
+			continue
+
+		case c == 'U' && i+1 < len(name) && name[i+1] == 'l':
+			// <closure-type-name> ::= Ul <type>+ E [<number>] _
+			stack = append(stack, 'U')
+			emit("Ul")
+			i += 2
+			continue
+
+		case c == 'N' || c == 'Z' || c == 'J' || c == 'X':
+			stack = append(stack, c)
+
+		case c == 'E':
+			if len(stack) == 0 {
+				return "", "", false
+			}
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			switch {
+			case top == 'I':
+				args--
+				i++
+				continue
+			case top == 'N' && nested && len(stack) == 0:
+				nameDone = true
+			case top == 'U':
+				j := strings.IndexByte(name[i:], '_')
+				if j < 0 {
+					return "", "", false
+				}
+				emit(name[i : i+j+1])
+				i += j + 1
+				continue
+			}
+		}
+		emit(string(c))
+		i++
+	}
+	if !stripped || len(stack) != 0 {
+		return "", "", false
+	}
+	key = k.String() + suffix
+	if len(parts) == 0 {
+		return key, key, true
+	}
+	return key, strings.Join(parts, "::") + suffix, true
+}
+
+// cxxOperators maps common mangled operator names to operators.
+var cxxOperators = map[string]string{
+	"nw": " new", "na": " new[]", "dl": " delete", "da": " delete[]",
+	"pl": "+", "mi": "-", "ml": "*", "dv": "/", "rm": "%",
+	"an": "&", "or": "|", "eo": "^", "ls": "<<", "rs": ">>",
+	"eq": "==", "ne": "!=", "lt": "<", "gt": ">", "le": "<=", "ge": ">=",
+	"nt": "!", "aa": "&&", "oo": "||", "pp": "++", "mm": "--",
+	"cl": "()", "ix": "[]", "pt": "->",
+}
+
+// cxxAbbrevs maps the standard substitutions S<c> to their names.
+var cxxAbbrevs = map[byte]string{
+	'a': "std::allocator", 'b': "std::basic_string", 's': "std::string",
+	'i': "std::istream", 'o': "std::ostream", 'd': "std::iostream",
+}
@@ -0,0 +1,80 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+"use strict";
+
+// GenericsView reports the code size of each Go generic function or
+// C++ template's instantiations and how much of it is duplicated.
+class GenericsView {
+    constructor(container) {
+        const self = this;
+        const details = $("<details>").addClass("genericsview").appendTo(container);
+        $("<summary>").text("Generic instantiations").appendTo(details);
+        this._div = $("<div>").appendTo(details);
+
+        // Comparing instantiations disassembles them, so only do it
+        // when opened.
+        details.one("toggle", () => { self._load(); });
+    }
+
+    _load() {
+        const div = this._div.text("Comparing…");
+        const onProgress = (done, total) => {
+            div.text("Comparing… " + done + "/" + total + " instantiations");
+        };
+        runJob("generics", {n: 50}, onProgress).done((data) => {
+            div.empty();
+            if (data.Families.length == 0) {
+                div.text("No functions with several instantiations.");
+                return;
+            }
+            const nFamilies = data.Families.length + (data.More || 0);
+            $("<div>").text(formatSize(data.Total) + " in " + data.Insts + " instantiations of " +
+                            nFamilies + " generic functions").appendTo(div);
+            if (data.Mergeable)
+                $("<div>").addClass("sv-note").
+                    text(formatSize(data.Mergeable) + " is in instantiations identical to another of the same function").appendTo(div);
+            for (let f of data.Families)
+                this._family(div, f);
+            if (data.More)
+                $("<div>").addClass("sv-note").text("(" + data.More + " smaller families)").appendTo(div);
+        }).fail((err) => {
+            showError("Generic instantiations", err, div.empty());
+        });
+    }
+
+    // _family adds a collapsible list of the instantiations of
+    // family f to div.
+    _family(div, f) {
+        const details = $("<details>").appendTo(div);
+        $("<summary>").text(f.Name + ": " + formatSize(f.Total) + " in " + f.Insts.length + " instantiations").
+            appendTo(details);
+        const notes = [];
+        if (f.Shaped)
+            notes.push(f.Shaped + " on GC shapes");
+        notes.push(f.Bodies + " distinct bodies");
+        if (f.Mergeable)
+            notes.push(formatSize(f.Mergeable) + " could be merged");
+        else if (f.OpBodies < f.Bodies)
+            notes.push("some differ only in operands, so a shared shape could deduplicate them");
+        $("<div>").addClass("sv-note").text(notes.join("; ")).appendTo(details);
+        const table = $("<table>").appendTo(details);
+        const first = f.Insts[0];
+        for (let inst of f.Insts) {
+            let note = "body " + (inst.Body + 1);
+            if (inst.Folded)
+                note += ", already merged";
+            const cmp = $("<td>");
+            if (inst.Body !== first.Body)
+                $("<a>").attr({href: "/compare?a=" + first.ID + "&b=" + inst.ID, title: "compare with the largest instantiation"}).
+                    text("compare").appendTo(cmp);
+            $("<tr>").
+                append($("<td>").addClass("pos").text(inst.Size)).
+                append($("<td>").addClass("generics-body").text(note)).
+                append(cmp).
+                append($("<td>").append($("<a>").attr("href", symURL(inst.Name, inst.ID)).text(inst.Name))).
+                appendTo(table);
+        }
+    }
+}
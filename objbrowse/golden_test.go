@@ -0,0 +1,95 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/aclements/objbrowse/internal/golden"
+	"github.com/aclements/objbrowse/obj"
+)
+
+// goldenFile is what TestGolden records about an object file: the
+// index the main page shows and each symbol's views, as the server
+// would send them.
+type goldenFile struct {
+	Error  string        `json:",omitempty"`
+	Index  interface{}   `json:",omitempty"`
+	Errors []ViewErrorJS `json:",omitempty"`
+	Syms   []goldenSym   `json:",omitempty"`
+}
+
+type goldenSym struct {
+	Name   string
+	ID     obj.SymID
+	Hex    interface{}   `json:",omitempty"`
+	Asm    interface{}   `json:",omitempty"`
+	Source interface{}   `json:",omitempty"`
+	Errors []ViewErrorJS `json:",omitempty"`
+}
+
+// TestGolden checks the views of each file of the object file corpus
+// against testdata/golden.
+func TestGolden(t *testing.T) {
+	corpus := filepath.Join("..", "testdata", "corpus")
+	// The corpus's debug info names sources relative to the
+	// testdata directory.
+	saved := sources
+	defer func() { sources = saved }()
+	sources = &sourcePolicy{substs: []pathSubst{{"corpus", corpus}}}
+
+	for _, path := range golden.Files(t, corpus) {
+		name := filepath.Base(path)
+		t.Run(name, func(t *testing.T) {
+			golden.CheckJSON(t, filepath.Join("testdata", "golden", name+".json"), goldenViews(path))
+		})
+	}
+}
+
+func goldenViews(path string) *goldenFile {
+	s, err := open(path)
+	if err != nil {
+		return &goldenFile{Error: err.Error()}
+	}
+
+	var g goldenFile
+	var errs viewErrors
+	s.fileErrors(&errs)
+	g.Errors = errs
+	if g.Index, err = s.symView.Decode(); err != nil {
+		g.Errors = append(g.Errors, ViewErrorJS{"Symbols", err.Error()})
+	}
+
+	for i, sym := range s.symTab.Syms() {
+		id := obj.SymID(i)
+		gs := goldenSym{Name: sym.Name, ID: id}
+		fail := func(view string, err error) {
+			gs.Errors = append(gs.Errors, ViewErrorJS{view, err.Error()})
+		}
+		data, err := s.bin.SymbolData(id)
+		if err != nil {
+			fail("Data", err)
+			g.Syms = append(g.Syms, gs)
+			continue
+		}
+		if gs.Hex, err = s.hexView.DecodeSym(sym, data); err != nil {
+			fail("Hex", err)
+		}
+		caps := s.fi.SymCaps(sym)
+		if caps&capAsm != 0 {
+			if gs.Asm, err = s.asmView.DecodeSym(sym, data.P); err != nil {
+				fail("Disassembly", err)
+			}
+		}
+		if caps&capSource != 0 {
+			if gs.Source, err = s.sourceView.DecodeSym(s.fi, sym); err != nil {
+				fail("Source", err)
+			}
+		}
+		g.Syms = append(g.Syms, gs)
+	}
+	return &g
+}
@@ -0,0 +1,148 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/aclements/objbrowse/internal/functab"
+	"github.com/aclements/objbrowse/obj"
+)
+
+// GoTablesView shows the raw Go runtime metadata tables for a
+// function: all PCDATA tables and all FUNCDATA blobs, with decoded
+// forms where the format is known.
+type GoTablesView struct {
+	fi *FileInfo
+}
+
+func NewGoTablesView(fi *FileInfo) *GoTablesView {
+	return &GoTablesView{fi}
+}
+
+type GoTablesViewJS struct {
+	Args        int32
+	Deferreturn uint32
+	FuncID      uint8
+
+	PCData   []GoTablesPCDataJS
+	FuncData []GoTablesFuncDataJS
+}
+
+type GoTablesPCDataJS struct {
+	Name   string
+	Ranges []LivenessRangeJS
+}
+
+type GoTablesFuncDataJS struct {
+	Index int
+	Name  string
+	Addr  AddrJS
+	// Raw is a hex dump of the first bytes of the FUNCDATA. The
+	// size of a FUNCDATA isn't recorded, so this may include
+	// bytes past its end.
+	Raw string `json:",omitempty"`
+	// Decoded is a human-readable decoding of this FUNCDATA, if
+	// its format is known.
+	Decoded []string `json:",omitempty"`
+	Error   string   `json:",omitempty"`
+}
+
+// goTablesRawBytes is the number of bytes of each FUNCDATA to show.
+const goTablesRawBytes = 64
+
+func (v *GoTablesView) DecodeSym(sym obj.Sym) (interface{}, error) {
+	if sym.Kind != obj.SymText {
+		return nil, nil
+	}
+	ft, err := v.fi.FuncTab()
+	if err != nil {
+		// Not a Go binary or unsupported table format.
+		return nil, nil
+	}
+	fn := v.fi.Func(sym.Value)
+	if fn == nil {
+		return nil, nil
+	}
+
+	info := GoTablesViewJS{Args: fn.Args, Deferreturn: fn.Deferreturn, FuncID: fn.FuncID}
+
+	// Decode PC-value tables.
+	addTable := func(name string, t functab.PCTable) {
+		info.PCData = append(info.PCData, GoTablesPCDataJS{name, pcTableToJS(t)})
+	}
+	addTable("pcsp", fn.PCSP.Decode())
+	addTable("pcfile", fn.PCFile.Decode())
+	addTable("pcln", fn.PCLn.Decode())
+	for i, pcd := range fn.PCData {
+		name := ft.PCDataName(i)
+		if name == "" {
+			name = fmt.Sprintf("PCDATA %d", i)
+		}
+		addTable(name, pcd.Decode())
+	}
+
+	// Decode FUNCDATA.
+	for i, fd := range fn.FuncData {
+		js := GoTablesFuncDataJS{Index: i, Name: ft.FuncDataName(i), Addr: AddrJS(fd.Ptr())}
+		if fd.Ptr() == 0 {
+			// nil FUNCDATA.
+			info.FuncData = append(info.FuncData, js)
+			continue
+		}
+		if raw, err := fd.Read(goTablesRawBytes); err != nil {
+			js.Error = err.Error()
+		} else {
+			js.Raw = fmt.Sprintf("%x", raw)
+		}
+		js.Decoded, err = decodeFuncData(fn, js.Name, fd)
+		if err != nil {
+			js.Error = err.Error()
+		}
+		info.FuncData = append(info.FuncData, js)
+	}
+
+	return info, nil
+}
+
+// decodeFuncData returns a human-readable decoding of fd, which is a
+// FUNCDATA of fn with index name "name". If the format of name isn't
+// known, it returns nil, nil.
+func decodeFuncData(fn *functab.Func, name string, fd functab.FuncData) ([]string, error) {
+	var out []string
+	switch name {
+	case "_FUNCDATA_ArgsPointerMaps", "_FUNCDATA_LocalsPointerMaps", "_FUNCDATA_RegPointerMaps":
+		bitmaps, err := fd.StackMap()
+		if err != nil {
+			return nil, err
+		}
+		for i, bm := range bitmaps {
+			out = append(out, fmt.Sprintf("%d: %s", i, bm))
+		}
+
+	case "_FUNCDATA_InlTree":
+		tree, err := fn.InlineTree()
+		if err != nil {
+			return nil, err
+		}
+		for i, call := range tree.Calls {
+			out = append(out, fmt.Sprintf("%d: %s called from %s:%d (parent %d, parentPC %#x, funcID %d)", i, call.Func, call.File, call.Line, call.Parent, call.ParentPC, call.FuncID))
+		}
+
+	case "_FUNCDATA_OpenCodedDeferInfo":
+		info, err := fd.OpenCodedDeferInfo()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, fmt.Sprintf("deferBits at frame offset %d", info.DeferBitsOffset))
+		for i, d := range info.Defers {
+			out = append(out, fmt.Sprintf("defer %d: fn at %d, args size %d", i, d.FnOffset, d.ArgsSize))
+			for _, arg := range d.Args {
+				out = append(out, fmt.Sprintf("  arg at %d, len %d, call offset %d", arg.Offset, arg.Len, arg.CallOffset))
+			}
+		}
+	}
+	return out, nil
+}
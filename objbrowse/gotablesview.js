@@ -0,0 +1,65 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+"use strict";
+
+// GoTablesView shows the raw PCDATA and FUNCDATA tables of a Go
+// function.
+class GoTablesView {
+    constructor(data, container) {
+        this._container = container;
+        const view = this;
+        const div = $("<div>").addClass("gotables").appendTo(container);
+
+        $("<div>").text("args " + data.Args + ", deferreturn " + data.Deferreturn +
+                        ", funcID " + data.FuncID).appendTo(div);
+
+        // PC-value tables.
+        const pcRanges = [];
+        for (let tab of data.PCData) {
+            const details = $("<details>").appendTo(div);
+            $("<summary>").text(tab.Name + " (" + (tab.Ranges || []).length + " entries)").appendTo(details);
+            const table = $("<table>").appendTo(details);
+            for (let r of tab.Ranges || []) {
+                const range = {start: new AddrJS(r.start), end: new AddrJS(r.end)};
+                const tr = $("<tr>").append(
+                    $("<td>").addClass("pos").text("0x" + r.start + "-0x" + r.end),
+                    $("<td>").text(r.val),
+                ).appendTo(table);
+                tr.click(() => { highlightRanges([range], view); });
+                range.tr = tr;
+                pcRanges.push(range);
+            }
+        }
+        this._pcRanges = pcRanges;
+
+        // FUNCDATA.
+        for (let fd of data.FuncData) {
+            const details = $("<details>").appendTo(div);
+            let label = "FUNCDATA " + fd.Index;
+            if (fd.Name)
+                label += " " + fd.Name;
+            label += fd.Addr == "0" ? " (nil)" : " @ 0x" + fd.Addr;
+            $("<summary>").text(label).appendTo(details);
+            if (fd.Error)
+                $("<div>").addClass("sv-error").text(fd.Error).appendTo(details);
+            if (fd.Decoded)
+                $("<pre>").text(fd.Decoded.join("\n")).appendTo(details);
+            if (fd.Raw)
+                $("<pre>").addClass("gotables-raw").text(fd.Raw.replace(/(..)/g, "$1 ").replace(/((.. ){16})/g, "$1\n")).appendTo(details);
+        }
+    }
+
+    highlightRanges(ranges, scroll) {
+        $(".highlight", this._container).removeClass("highlight");
+        for (let r of this._pcRanges) {
+            for (let h of ranges) {
+                if (IntervalMap.overlap(r, h)) {
+                    r.tr.addClass("highlight");
+                    break;
+                }
+            }
+        }
+    }
+}
@@ -5,10 +5,12 @@
 package main
 
 import (
+	"encoding/binary"
 	"fmt"
 
-	"github.com/aclements/objbrowse/internal/obj"
+	"github.com/aclements/objbrowse/arch"
 	"github.com/aclements/objbrowse/internal/symtab"
+	"github.com/aclements/objbrowse/obj"
 )
 
 type HexView struct {
@@ -25,6 +27,21 @@ type HexViewJS struct {
 	Data   string
 	Relocs []HexViewRelocJS
 	RTypes []string
+	// Items are the offsets within Data of the starts of items
+	// in mergeable string or constant sections.
+	Items []uint64 `json:",omitempty"`
+
+	// Ptrs are the pointer-sized words in a data symbol that
+	// point into other symbols, excluding words with relocations.
+	Ptrs []HexViewPtrJS `json:",omitempty"`
+
+	// ByteOrder is the target's byte order, "little" or "big", or
+	// "" if unknown. This is the default for rendering grouped
+	// words.
+	ByteOrder string `json:",omitempty"`
+	// PtrSize is the target's pointer size in bytes, or 0 if
+	// unknown.
+	PtrSize int `json:",omitempty"`
 }
 
 type HexViewRelocJS struct {
@@ -35,7 +52,13 @@ type HexViewRelocJS struct {
 	Addend int64  `json:"A,omitempty"`
 }
 
-func (v *HexView) DecodeSym(data obj.Data) (interface{}, error) {
+type HexViewPtrJS struct {
+	Offset uint64 `json:"O"`           // Offset within data
+	Sym    string `json:"S"`           // Target symbol
+	Off    uint64 `json:"A,omitempty"` // Offset within Sym
+}
+
+func (v *HexView) DecodeSym(sym obj.Sym, data obj.Data) (interface{}, error) {
 	// TODO: Return just the length and fetch the raw data on
 	// demand using XHR.
 
@@ -65,5 +88,78 @@ func (v *HexView) DecodeSym(data obj.Data) (interface{}, error) {
 		relocs[i] = HexViewRelocJS{r.Offset - data.Addr, r.Size, typei, sym, r.Addend}
 	}
 
-	return HexViewJS{AddrJS(data.Addr), fmt.Sprintf("%x", data.P), relocs, rtypes}, nil
+	// Find item boundaries.
+	var items []uint64
+	for _, id := range v.symTab.InRange(data.Addr, data.Addr+uint64(len(data.P))) {
+		if !syms[id].Synthetic || syms[id].Section != sym.Section {
+			continue
+		}
+		off := syms[id].Value - data.Addr
+		if len(items) == 0 || items[len(items)-1] != off {
+			items = append(items, off)
+		}
+	}
+
+	js := HexViewJS{Addr: AddrJS(data.Addr), Data: fmt.Sprintf("%x", data.P), Relocs: relocs, RTypes: rtypes, Items: items}
+	if arch := v.fi.Obj.Info().Arch; arch != nil {
+		if sym.Kind != obj.SymText {
+			js.Ptrs = v.findPtrs(data, relocs, arch)
+		}
+		js.PtrSize = arch.PtrSize
+		if arch.ByteOrder == binary.BigEndian {
+			js.ByteOrder = "big"
+		} else {
+			js.ByteOrder = "little"
+		}
+	}
+	return js, nil
+}
+
+// findPtrs returns the aligned pointer-sized words in data that point
+// into a symbol in a mapped section. Words covered by relocations are
+// skipped, since the relocation already says what they point to.
+func (v *HexView) findPtrs(data obj.Data, relocs []HexViewRelocJS, a *arch.Arch) []HexViewPtrJS {
+	// Find the range of mapped addresses to quickly reject most
+	// non-pointers.
+	var lo, hi uint64
+	for _, sect := range v.fi.Obj.Sections() {
+		if sect.Addr == 0 || sect.Size == 0 {
+			continue
+		}
+		if lo == 0 || sect.Addr < lo {
+			lo = sect.Addr
+		}
+		if end := sect.Addr + sect.Size; end > hi {
+			hi = end
+		}
+	}
+
+	var ptrs []HexViewPtrJS
+	size := uint64(a.PtrSize)
+	off := (size - data.Addr%size) % size
+	ri := 0
+	for ; off+size <= uint64(len(data.P)); off += size {
+		// Skip words overlapping a relocation. Relocations
+		// are sorted by offset, which may be negative.
+		for ri < len(relocs) && int64(relocs[ri].Offset)+int64(relocs[ri].Bytes) <= int64(off) {
+			ri++
+		}
+		if ri < len(relocs) && int64(relocs[ri].Offset) < int64(off+size) {
+			continue
+		}
+
+		var val uint64
+		if size == 8 {
+			val = a.ByteOrder.Uint64(data.P[off:])
+		} else {
+			val = uint64(a.ByteOrder.Uint32(data.P[off:]))
+		}
+		if val < lo || val >= hi {
+			continue
+		}
+		if p := v.fi.ResolvePtr(val, 0); p.Sym != "" && p.Section != "" {
+			ptrs = append(ptrs, HexViewPtrJS{off, p.Sym, p.Off})
+		}
+	}
+	return ptrs
 }
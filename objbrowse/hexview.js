@@ -5,43 +5,106 @@
 "use strict";
 
 class HexView {
-    constructor(data, container) {
+    // overlays, if provided, are external overlays to show on the
+    // data rows.
+    constructor(data, container, overlays) {
         this._container = container;
         this._addr = new AddrJS(data.Addr);
         this._data = data;
+        this._dataLen = data.Data.length / 2;
+        this._overlays = (overlays || []).map((o) => ({name: o.Name, ranges: parseOverlay(o)}));
+        this._items = new Set(data.Items || []);
+        this._ranges = [];
+        this._sel = null;       // Byte offset shown in the details strip
         const view = this;
 
-        // Construct string offsets index.
-        this._offsets = this._makeOffsets();
-
         // Construct the interleaving of data lines and relocations.
         [this._rowMeta, this._rowIndex] = this._makeRowMeta();
 
-        if (this._data.Data.length == 0) {
+        if (this._dataLen == 0) {
             $(container).text("(no data to display)");
         }
 
+        // Create the formatting controls and details strip.
+        Object.assign(HexView.prefs, settings.get("hexview", {}));
+        const header = $("<div>").addClass("hv-header").appendTo(container);
+        const form = $("<form>").addClass("hv-controls").appendTo(header);
+        this._groupSel = $("<select>").appendTo(form);
+        for (let g of [1, 2, 4, 8])
+            $("<option>").attr("value", g).text(g == 1 ? "bytes" : (g * 8) + "-bit words").appendTo(this._groupSel);
+        this._orderSel = $("<select>").appendTo(form);
+        for (let order of ["little", "big"])
+            $("<option>").attr("value", order).text(order + " endian" + (order == data.ByteOrder ? " (target)" : "")).appendTo(this._orderSel);
+        this._groupSel.val(HexView.prefs.group);
+        this._orderSel.val(HexView.prefs.byteOrder || data.ByteOrder || "little");
+        this._groupSel.add(this._orderSel).change(() => {
+            HexView.prefs.group = parseInt(view._groupSel.val());
+            const order = view._orderSel.val();
+            HexView.prefs.byteOrder = order == (data.ByteOrder || "little") ? null : order;
+            settings.set("hexview", HexView.prefs);
+            view._render();
+        });
+        $("<span>").addClass("hv-controls-label").text("interpret as").appendTo(form);
+        this._interpSel = $("<select>").appendTo(form);
+        for (let [mode, label] of HexView.interps)
+            $("<option>").attr("value", mode).text(label).appendTo(this._interpSel);
+        this._interpSel.val(HexView.prefs.interp);
+        this._interpSel.change(() => {
+            HexView.prefs.interp = view._interpSel.val();
+            settings.set("hexview", HexView.prefs);
+            view._showDetails();
+        });
+        this._details = $("<div>").addClass("hv-details").appendTo(header);
+
+        this._table = $('<table>').appendTo(container);
+        this._render();
+    }
+
+    // _render (re)creates the data table using the current formatting
+    // settings.
+    _render() {
+        this._group = parseInt(this._groupSel.val());
+        this._bigEndian = this._orderSel.val() == "big";
+
+        // Construct string offsets index.
+        this._offsets = this._makeOffsets();
+        this._asciiOffsets = [];
+        for (let i = 0; i < 16; i++)
+            this._asciiOffsets.push([i, i+1]);
+
         // Create blocks for every 4K. It takes about 25ms to fill a
         // 4K block (most of which is the browser doing layout), which
         // is unnoticable.
-        const table = $('<table>').appendTo(container);
+        this._table.empty();
         const blockBytes = 4 * 1024;
         const lines = this._rowMeta.length;
         const blockLines = blockBytes / 16;
-        this._lazyTable = new LazyTable(table, lines, blockLines, this._makeRows.bind(this));
+        this._lazyTable = new LazyTable(this._table, lines, blockLines, this._makeRows.bind(this));
+
+        this.highlightRanges(this._ranges, false);
+        this._showDetails();
     }
 
     _makeRowMeta() {
-        // Interleave rows for data and relocations.
+        // Interleave rows for data, relocations, and pointers.
+        // Pointers never overlap relocations.
         const data = this._data.Data;
         const relocs = this._data.Relocs;
+        const ptrs = this._data.Ptrs || [];
         let rowMeta = [], rowIndex = [];
-        let relI = 0;
+        let relI = 0, ptrI = 0;
         for (let i = 0; i < data.length / 2; i += 16) {
             rowIndex.push(rowMeta.length);
             rowMeta.push({off: i}); // Data offset
-            for (; relI < relocs.length && relocs[relI].O < i + 16; relI++) {
-                rowMeta.push({relI: relI, dataOff: i}); // Reloc index
+            while (true) {
+                const haveRel = relI < relocs.length && relocs[relI].O < i + 16;
+                const havePtr = ptrI < ptrs.length && ptrs[ptrI].O < i + 16;
+                if (haveRel && (!havePtr || relocs[relI].O < ptrs[ptrI].O))
+                    rowMeta.push({relI: relI++, dataOff: i}); // Reloc index
+                else if (havePtr)
+                    rowMeta.push({ptrI: ptrI++, dataOff: i}); // Pointer index
+                else
+                    break;
             }
         }
         return [rowMeta, rowIndex];
@@ -70,13 +133,35 @@ class HexView {
                 const rowAddr = this._addr.add(new AddrJS(rowMeta.off));
 
                 tdPos.textContent = "0x" + rowAddr;
-                tdData.setAttribute("class", "hv-data");
+                tdData.setAttribute("class", this._items.has(rowMeta.off) ? "hv-data hv-item-start" : "hv-data");
                 tdData.textContent = this._formatLine(rowMeta.off);
+                const tdASCII = document.createElement("td");
+                tdASCII.setAttribute("class", "hv-ascii");
+                tdASCII.textContent = this._formatASCII(rowMeta.off);
+                tr.appendChild(tdASCII);
 
-                tr.addEventListener("click", () => {
-                    const endAddr = rowAddr.add(new AddrJS(16));
-                    highlightRanges([{start: rowAddr, end: endAddr}], view);
+                tr.addEventListener("click", (ev) => {
+                    // Select the word under the mouse, or the
+                    // whole row if there isn't one.
+                    const b = view._byteAt(tr, ev);
+                    let start = rowMeta.off, end = rowMeta.off + 16;
+                    if (b >= 0) {
+                        start = rowMeta.off + b - b % view._group;
+                        end = start + view._group;
+                    }
+                    end = Math.min(end, view._dataLen);
+                    view._sel = start;
+                    view._showDetails();
+                    highlightRanges([extendSelection({start: view._addr.add(new AddrJS(start)),
+                                                      end: view._addr.add(new AddrJS(end))}, ev)], view);
                 });
+                this._markOverlays(tr, rowAddr);
+            } else if (rowMeta.ptrI !== undefined) {
+                // Pointer row.
+                const ptr = this._data.Ptrs[rowMeta.ptrI];
+
+                tdData.appendChild(this._formatIndent(ptr.O - rowMeta.dataOff, this._data.PtrSize));
+                tdData.appendChild(formatPtr({Sym: ptr.S, Off: ptr.A}));
             } else {
                 // Relocation row.
                 const reloc = this._data.Relocs[rowMeta.relI];
@@ -88,40 +173,222 @@ class HexView {
         return rows;
     }
 
+    // _markOverlays colors data row tr at rowAddr with the overlay
+    // entries that overlap it.
+    _markOverlays(tr, rowAddr) {
+        const row = {start: rowAddr, end: rowAddr.add(new AddrJS(16))};
+        const titles = [];
+        for (let o of this._overlays) {
+            for (let e of overlayEntries(o.ranges, row)) {
+                titles.push(o.name + ": " + overlayText(e));
+                if (e.Color)
+                    tr.style.backgroundColor = e.Color;
+            }
+        }
+        if (titles.length > 0)
+            tr.setAttribute("title", titles.join("\n"));
+    }
+
     // _formatLine returns one line of text representation of data,
-    // starting at offset "start".
+    // starting at offset "start". Bytes are grouped into words of
+    // this._group bytes, each shown most significant byte first.
     _formatLine(start) {
-        const dataLen = this._data.Data.length / 2;
+        const g = this._group;
         // Keep this in sync with _makeOffsets.
         let line = "";
-        for (let i = 0; i < 16 && start + i < dataLen; i++) {
-            if (i == 8)
-                line += "  ";
-            else if (i > 0)
-                line += " ";
-            line += this._data.Data.substr((start+i) * 2, 2);
+        for (let i = 0; i < 16 && start + i < this._dataLen; i += g) {
+            if (i > 0) {
+                // Mark item boundaries in place of the separating
+                // space, so this stays in sync with _makeOffsets.
+                const sep = this._items.has(start + i) ? "|" : " ";
+                line += (i == 8 ? " " : "") + sep;
+            }
+            for (let k = 0; k < g; k++) {
+                const b = start + i + (this._bigEndian ? k : g - 1 - k);
+                line += b < this._dataLen ? this._data.Data.substr(b * 2, 2) : "  ";
+            }
         }
         return line;
     }
 
-    // _makeOffsets string offsets of each byte in a formatted line.
+    // _makeOffsets returns the string offsets [start, end) of each
+    // byte in a formatted line.
     _makeOffsets() {
+        const g = this._group;
         const offsets = [];
         let offset = 0;
-        for (let i = 0; i < 16; i++) {
+        for (let i = 0; i < 16; i += g) {
             if (i == 8)
                 offset += 2;
             else if (i > 0)
                 offset += 1;
-            const start = offset;
-            offset += 2;
-            offsets.push([start, offset]);
+            for (let k = 0; k < g; k++) {
+                const b = i + (this._bigEndian ? k : g - 1 - k);
+                offsets[b] = [offset, offset + 2];
+                offset += 2;
+            }
         }
-        offsets.push([offset]);
-        offsets[-1] = [undefined, 0];
         return offsets;
     }
 
+    // _formatASCII returns the ASCII sidebar text of data starting at
+    // offset "start", with non-printable bytes shown as ".".
+    _formatASCII(start) {
+        let line = "";
+        for (let i = start; i < start + 16 && i < this._dataLen; i++) {
+            const c = parseInt(this._data.Data.substr(i * 2, 2), 16);
+            line += (c >= 0x20 && c < 0x7f) ? String.fromCharCode(c) : ".";
+        }
+        return line;
+    }
+
+    // _byteAt returns the index within its row of the byte under
+    // mouse event ev in data row tr, or -1 if there isn't one.
+    _byteAt(tr, ev) {
+        const td = ev.target.closest("td");
+        let offsets;
+        if (td === tr.childNodes[1])
+            offsets = this._offsets;
+        else if (td === tr.childNodes[2])
+            offsets = this._asciiOffsets;
+        else
+            return -1;
+        const c = charOffsetAt(td, ev.clientX, ev.clientY);
+        if (c < 0)
+            return -1;
+        // The caret may fall on either side of the clicked
+        // character.
+        for (let c2 of [c, c - 1])
+            for (let i = 0; i < 16; i++)
+                if (offsets[i][0] <= c2 && c2 < offsets[i][1])
+                    return i;
+        return -1;
+    }
+
+    // _showDetails fills the details strip with the selected
+    // interpretation of the bytes at the selected offset.
+    _showDetails() {
+        const div = this._details.empty();
+        const off = this._sel;
+        // Drop the results of any outstanding pointer lookups.
+        this._detailsToken = {};
+        if (off === null || off >= this._dataLen) {
+            div.text("Click a byte to interpret it.");
+            return;
+        }
+        const bytes = [];
+        for (let i = off; i < off + 32 && i < this._dataLen; i++)
+            bytes.push(parseInt(this._data.Data.substr(i * 2, 2), 16));
+
+        $("<span>").addClass("hv-details-field").
+            append($("<span>").addClass("hv-details-key").text("addr ")).
+            append(document.createTextNode("0x" + this._addr.add(new AddrJS(off)) + " (+0x" + off.toString(16) + ")")).
+            appendTo(div);
+        const mode = this._interpSel.val();
+        switch (mode) {
+        case "int":
+            this._showInts(div, bytes);
+            break;
+        case "float":
+            this._showFloats(div, bytes);
+            break;
+        default:
+            this._showGoValue(div, bytes, mode);
+            break;
+        }
+    }
+
+    // _showInts shows bytes as signed and unsigned integers of each
+    // width in both byte orders.
+    _showInts(div, bytes) {
+        const table = $("<table>").addClass("hv-interp").appendTo(div);
+        $("<tr>").append(["", "unsigned LE", "signed LE", "unsigned BE", "signed BE"].map((h) => $("<th>").text(h))).appendTo(table);
+        for (let size of [1, 2, 4, 8]) {
+            if (size > bytes.length)
+                break;
+            const tr = $("<tr>").appendTo(table);
+            if (size == this._group)
+                tr.addClass("hv-details-group");
+            $("<td>").text(size * 8 + "-bit").appendTo(tr);
+            for (let le of [true, false]) {
+                const u = readWord(bytes, 0, size, le);
+                $("<td>").text(u + " (0x" + u.toString(16) + ")").appendTo(tr);
+                $("<td>").text(BigInt.asIntN(size * 8, u).toString()).appendTo(tr);
+            }
+        }
+    }
+
+    // _showFloats shows bytes as 32- and 64-bit floats in both byte
+    // orders.
+    _showFloats(div, bytes) {
+        const table = $("<table>").addClass("hv-interp").appendTo(div);
+        $("<tr>").append(["", "LE", "BE"].map((h) => $("<th>").text(h))).appendTo(table);
+        const dv = new DataView(new Uint8Array(bytes).buffer);
+        for (let size of [4, 8]) {
+            if (size > bytes.length)
+                break;
+            const tr = $("<tr>").appendTo(table);
+            $("<td>").text("float" + size * 8).appendTo(tr);
+            for (let le of [true, false]) {
+                const f = size == 4 ? dv.getFloat32(0, le) : dv.getFloat64(0, le);
+                $("<td>").text(f.toString()).appendTo(tr);
+            }
+        }
+    }
+
+    // _showGoValue shows bytes as a pointer or a Go string, slice, or
+    // interface header in the target byte order, resolving pointers
+    // using the server.
+    _showGoValue(div, bytes, mode) {
+        const ptrSize = this._data.PtrSize;
+        if (!ptrSize) {
+            div.append(document.createTextNode("unknown pointer size"));
+            return;
+        }
+        const le = this._data.ByteOrder != "big";
+        const words = {ptr: ["ptr"], string: ["ptr", "len"], slice: ["ptr", "len", "cap"], iface: ["type", "data"]}[mode];
+        if (words.length * ptrSize > bytes.length) {
+            div.append(document.createTextNode("not enough data for " + words.length + " words"));
+            return;
+        }
+        const vals = words.map((w, i) => readWord(bytes, i * ptrSize, ptrSize, le));
+
+        // Show the values, then fill in the pointers once they're
+        // resolved.
+        const fields = {};
+        words.forEach((w, i) => {
+            fields[w] = $("<span>").addClass("hv-details-field").
+                append($("<span>").addClass("hv-details-key").text(w + " ")).
+                append(document.createTextNode(w == "len" || w == "cap" ? vals[i].toString() : "0x" + vals[i].toString(16))).
+                appendTo(div);
+        });
+        const ptrs = words.filter((w) => w != "len" && w != "cap");
+        const params = {a: ptrs.map((w) => vals[words.indexOf(w)].toString(16)).join(",")};
+        if (mode == "string")
+            params.n = vals[1] < 256n ? Number(vals[1]) : 256;
+        const token = this._detailsToken;
+        $.getJSON("/resolve", params).done((res) => {
+            if (this._detailsToken !== token)
+                return;
+            ptrs.forEach((w, i) => {
+                fields[w].append(document.createTextNode(" ")).append(formatPtr(res[i]));
+            });
+            if (mode == "string" && res[0].Data !== undefined) {
+                const data = res[0].Data;
+                const sbytes = new Uint8Array(data.length / 2);
+                for (let i = 0; i < sbytes.length; i++)
+                    sbytes[i] = parseInt(data.substr(i * 2, 2), 16);
+                let text = JSON.stringify(new TextDecoder().decode(sbytes));
+                if (BigInt(sbytes.length) < vals[1])
+                    text += "…";
+                $("<span>").addClass("hv-details-field").text(text).appendTo(div);
+            }
+        }).fail((xhr) => {
+            if (this._detailsToken === token)
+                div.append(document.createTextNode(" (resolving failed: " + xhr.statusText + ")"));
+        });
+    }
+
     // _formatIndent returns a DOM node that highlights byte offsets
     // [start, start+length).
     _formatIndent(start, length) {
@@ -134,7 +401,11 @@ class HexView {
         if (start < 0) {
             var text = "< ";
         } else {
-            const charOff = this._offsets[start][0];
+            // With grouping, the lowest byte of the relocation
+            // may not be the leftmost.
+            let charOff = this._offsets[start][0];
+            for (let b = start + 1; b < start + length && b < 16; b++)
+                charOff = Math.min(charOff, this._offsets[b][0]);
             var text = " ".repeat(charOff) + "^ ";
         }
         const span = document.createElement("span");
@@ -179,37 +450,66 @@ class HexView {
         return span;
     }
 
-    // _highlightTD highlights the bytes in data TD "td" according to
-    // the boolean vector "marks". The data in TD must start at
-    // "start".
-    _highlightTD(td, start, marks) {
-        const line = this._formatLine(start);
+    // _highlightTD highlights the bytes in TD "td", which contains
+    // text "line", according to the boolean vector "marks". offsets
+    // gives the string offsets of each byte in line.
+    _highlightTD(td, line, offsets, marks) {
+        // Mark characters, then extend marks over the separators
+        // between marked bytes.
+        const charMarks = new Array(line.length).fill(false);
+        for (let i = 0; i < marks.length; i++) {
+            if (!marks[i])
+                continue;
+            for (let c = offsets[i][0]; c < offsets[i][1] && c < line.length; c++)
+                charMarks[c] = true;
+        }
+        for (let i = 0, j = 0; i < line.length; i = j) {
+            for (j = i + 1; j < line.length && charMarks[i] == charMarks[j]; j++) {}
+            if (!charMarks[i] && i > 0 && j < line.length && /^[ |]*$/.test(line.substring(i, j)))
+                charMarks.fill(true, i, j);
+        }
+
         td.textContent = "";    // Clear TD
-        for (let i = 0, j = 0; i < marks.length; i = j) {
+        for (let i = 0, j = 0; i < line.length; i = j) {
             // Find the end of the mark run.
-            for (j = i + 1; j < marks.length && marks[i] == marks[j]; j++) {}
+            for (j = i + 1; j < line.length && charMarks[i] == charMarks[j]; j++) {}
 
             // Mark [i, j) run.
-            if (marks[i]) {
-                const subline = line.substring(
-                    this._offsets[i][0],
-                    this._offsets[j-1][1]
-                );
+            const subline = line.substring(i, j);
+            if (charMarks[i]) {
                 const span = document.createElement("span");
                 span.setAttribute("class", "highlight");
                 span.textContent = subline;
                 td.appendChild(span);
             } else {
-                const subline = line.substring(
-                    this._offsets[i-1][1],
-                    this._offsets[j][0]
-                )
                 td.appendChild(document.createTextNode(subline));
             }
         }
     }
 
+    // referencedSyms returns the symbols referenced by relocations
+    // and pointers that overlap ranges, as a map from symbol name to
+    // the number of references.
+    referencedSyms(ranges) {
+        const syms = new Map();
+        const add = (off, size, sym) => {
+            if (!sym)
+                return;
+            const start = this._addr.add(new AddrJS(off));
+            const r = {start: start, end: start.add(new AddrJS(size))};
+            if (ranges.some((h) => IntervalMap.overlap(r, h)))
+                syms.set(sym, (syms.get(sym) || 0) + 1);
+        };
+        for (let reloc of this._data.Relocs)
+            add(reloc.O, reloc.B, reloc.S);
+        for (let ptr of this._data.Ptrs || [])
+            add(ptr.O, this._data.PtrSize, ptr.S);
+        return syms;
+    }
+
     highlightRanges(ranges, scroll) {
+        this._ranges = ranges;
+
         // Clear highlights.
         $(".highlight", this._lazyTable.tableElt).removeClass("highlight");
 
@@ -221,9 +521,6 @@ class HexView {
         let markLine = undefined;
         const marks = [];
         const view = this;
-        function getDataTD(tr) {
-            return tr.childNodes[1]
-        }
         function openLine(newLine) {
             if (markLine === newLine)
                 return;
@@ -232,8 +529,9 @@ class HexView {
                 const tr = view._lazyTable.getRow(markLine);
                 if (firstTR === undefined)
                     firstTR = tr;
-                const td = getDataTD(tr);
-                view._highlightTD(td, view._rowMeta[markLine].off, marks);
+                const start = view._rowMeta[markLine].off;
+                view._highlightTD(tr.childNodes[1], view._formatLine(start), view._offsets, marks);
+                view._highlightTD(tr.childNodes[2], view._formatASCII(start), view._asciiOffsets, marks);
             }
             // Clear marks
             for (let i = 0; i < 16; i++)
@@ -261,3 +559,78 @@ class HexView {
             scrollTo(this._container, firstTR);
     }
 }
+
+// prefs are the formatting settings shared by all hex views. They're
+// saved in settings, so they persist across pages and sessions. A
+// null byteOrder uses the target's.
+HexView.prefs = {group: 1, byteOrder: null, interp: "int"};
+
+// interps are the ways the details strip can interpret the selected
+// bytes.
+HexView.interps = [
+    ["int", "integers"],
+    ["float", "floats"],
+    ["ptr", "pointer"],
+    ["string", "Go string"],
+    ["slice", "Go slice"],
+    ["iface", "Go interface"],
+];
+
+// readWord returns the size-byte unsigned integer at offset off in
+// the byte array bytes as a BigInt.
+function readWord(bytes, off, size, le) {
+    let v = 0n;
+    for (let i = 0; i < size; i++) {
+        const b = bytes[off + (le ? size - 1 - i : i)];
+        v = (v << 8n) | BigInt(b);
+    }
+    return v;
+}
+
+// formatPtr returns a DOM node describing PtrJS p, linking to the
+// symbol it points into if there is one.
+function formatPtr(p) {
+    const span = document.createElement("span");
+    span.setAttribute("class", "hv-ptr");
+    if (p.Sym === undefined) {
+        span.textContent = p.Section !== undefined ? "(" + p.Section + ")" : "(unmapped)";
+        return span;
+    }
+    const off = new AddrJS(p.Off || 0);
+    const a = document.createElement("a");
+    a.setAttribute("href", "/s/" + p.Sym + "#+" + formatRanges([{start: off, end: off.add(new AddrJS(1))}]));
+    a.textContent = "→ " + p.Sym + (p.Off ? "+0x" + off : "");
+    span.appendChild(a);
+    return span;
+}
+
+// charOffsetAt returns the offset within the text of elt of the
+// caret position at client coordinates (x, y), or -1 if that isn't
+// in elt.
+function charOffsetAt(elt, x, y) {
+    let node, offset;
+    if (document.caretPositionFromPoint) {
+        const pos = document.caretPositionFromPoint(x, y);
+        if (!pos)
+            return -1;
+        [node, offset] = [pos.offsetNode, pos.offset];
+    } else if (document.caretRangeFromPoint) {
+        const r = document.caretRangeFromPoint(x, y);
+        if (!r)
+            return -1;
+        [node, offset] = [r.startContainer, r.startOffset];
+    } else {
+        return -1;
+    }
+    if (!elt.contains(node))
+        return -1;
+    // Add up the text preceding node.
+    const walk = document.createTreeWalker(elt, NodeFilter.SHOW_TEXT);
+    let total = 0;
+    for (let n = walk.nextNode(); n; n = walk.nextNode()) {
+        if (n === node)
+            return total + offset;
+        total += n.textContent.length;
+    }
+    return -1;
+}
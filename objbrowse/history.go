@@ -0,0 +1,152 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aclements/objbrowse/obj"
+)
+
+// history is the symbols each browser has visited, so users can
+// retrace their path through the binary. Browsers are identified by
+// the settings cookie. Unlike settings, history is only kept in
+// memory.
+var history historyStore
+
+// Limits on the history store.
+const (
+	maxHistoryEntries = 500 // Per browser
+	maxHistoryClients = 1000
+)
+
+// HistoryEntryJS is a visit to a symbol page.
+type HistoryEntryJS struct {
+	Time time.Time
+	Sym  string
+	ID   obj.SymID
+	Addr AddrJS
+	// View is the view the user last worked in on the page, if
+	// known.
+	View string `json:",omitempty"`
+}
+
+type historyStore struct {
+	mu      sync.Mutex
+	clients map[string]*clientHistory
+}
+
+type clientHistory struct {
+	used    time.Time
+	entries []HistoryEntryJS
+}
+
+// visit records that browser id visited symbol sym.
+func (h *historyStore) visit(id string, sym obj.SymID, s obj.Sym) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.clients == nil {
+		h.clients = make(map[string]*clientHistory)
+	}
+	c := h.clients[id]
+	if c == nil {
+		c = new(clientHistory)
+		h.clients[id] = c
+	}
+	now := time.Now()
+	c.used = now
+	if n := len(c.entries); n > 0 && c.entries[n-1].ID == sym && c.entries[n-1].Sym == s.Name {
+		// Reloading a page isn't a new visit.
+		c.entries[n-1].Time = now
+		return
+	}
+	c.entries = append(c.entries, HistoryEntryJS{Time: now, Sym: s.Name, ID: sym, Addr: AddrJS(s.Value)})
+	if len(c.entries) > maxHistoryEntries {
+		c.entries = append(c.entries[:0], c.entries[len(c.entries)-maxHistoryEntries:]...)
+	}
+
+	// Forget the least recently active browser.
+	if len(h.clients) > maxHistoryClients {
+		var oldest string
+		for id, c := range h.clients {
+			if oldest == "" || c.used.Before(h.clients[oldest].used) {
+				oldest = id
+			}
+		}
+		delete(h.clients, oldest)
+	}
+}
+
+// setView records that browser id is using view in its most recent
+// visit to symbol sym.
+func (h *historyStore) setView(id string, sym obj.SymID, view string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	c := h.clients[id]
+	if c == nil {
+		return
+	}
+	for i := len(c.entries) - 1; i >= 0; i-- {
+		if c.entries[i].ID == sym {
+			c.entries[i].View = view
+			return
+		}
+	}
+}
+
+// get returns the history of browser id, most recent first.
+func (h *historyStore) get(id string) []HistoryEntryJS {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := []HistoryEntryJS{}
+	if c := h.clients[id]; c != nil {
+		for i := len(c.entries) - 1; i >= 0; i-- {
+			out = append(out, c.entries[i])
+		}
+	}
+	return out
+}
+
+func (h *historyStore) clear(id string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.clients, id)
+}
+
+// httpHistory manages the requesting browser's history of visited
+// symbols. Symbol pages add to the history when they're served.
+//
+//	GET    /history    serves the history as JSON, most recent first
+//	POST   /history    records the view in use, given by a JSON
+//	                   object {"ID": symbol ID, "View": view name}
+//	DELETE /history    clears the history
+func httpHistory(w http.ResponseWriter, r *http.Request) {
+	id := clientID(w, r)
+	switch r.Method {
+	case http.MethodGet:
+		serveJSON(w, history.get(id))
+
+	case http.MethodPost:
+		var req struct {
+			ID   obj.SymID
+			View string
+		}
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<10))
+		if err := dec.Decode(&req); err != nil {
+			http.Error(w, "bad history update: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		history.setView(id, req.ID, req.View)
+
+	case http.MethodDelete:
+		history.clear(id)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
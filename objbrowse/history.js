@@ -0,0 +1,71 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+"use strict";
+
+// HistoryPanel is a drawer listing the symbols this browser visited,
+// from /history, and the view used in each. On a symbol page, it
+// reports the view in use back to the server.
+class HistoryPanel {
+    // symID is the ID of the page's symbol, or undefined.
+    constructor(symID) {
+        const self = this;
+        this._panel = $("<div>").addClass("history-panel").hide().appendTo(document.body);
+        const head = $("<div>").addClass("history-head").text("History ").appendTo(this._panel);
+        $("<a>").attr({href: "#", title: "forget visited symbols"}).text("clear").appendTo(head).
+            click((ev) => {
+                ev.preventDefault();
+                $.ajax({url: "/history", method: "DELETE"}).done(() => {
+                    self._load();
+                }).fail((xhr) => { showError("History", xhr, self._list.empty()); });
+            });
+        $("<a>").attr({href: "#", title: "close"}).addClass("history-close").text("×").appendTo(head).
+            click((ev) => {
+                ev.preventDefault();
+                self.toggle();
+            });
+        this._list = $("<table>").addClass("history-list").appendTo(this._panel);
+
+        if (symID !== undefined) {
+            let view = null;
+            $(document).on("mousedown focusin", ".panel-col", (ev) => {
+                const v = $(ev.currentTarget).data("view");
+                if (!v || v === view)
+                    return;
+                view = v;
+                $.ajax({url: "/history", method: "POST", contentType: "application/json",
+                        data: JSON.stringify({ID: symID, View: v})});
+            });
+        }
+    }
+
+    // toggle shows or hides the panel.
+    toggle() {
+        this._panel.toggle();
+        if (this._panel.is(":visible"))
+            this._load();
+    }
+
+    _load() {
+        const list = this._list;
+        list.empty().append($("<tr>").append($("<td>").text("Loading…")));
+        $.getJSON("/history").done((entries) => {
+            list.empty();
+            if (entries.length === 0)
+                list.append($("<tr>").append($("<td>").text("No symbols visited yet.")));
+            const today = new Date().toDateString();
+            for (let e of entries) {
+                const t = new Date(e.Time);
+                const time = t.toDateString() === today ? t.toLocaleTimeString() : t.toLocaleString();
+                $("<tr>").
+                    append($("<td>").addClass("history-time").text(time)).
+                    append($("<td>").append($("<a>").attr("href", symURL(e.Sym) + "?addr=" + e.Addr).text(e.Sym))).
+                    append($("<td>").addClass("history-view").text(e.View || "")).
+                    appendTo(list);
+            }
+        }).fail((xhr) => {
+            showError("History", xhr, list.empty());
+        });
+    }
+}
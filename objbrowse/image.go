@@ -0,0 +1,645 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Media types of image indexes and manifests. Docker's types predate
+// the OCI's, but the documents have the same structure.
+var imageManifestTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// An imageStore fetches the manifests and blobs of a container image,
+// either from a registry or from an OCI image layout on disk.
+type imageStore interface {
+	// manifest returns the index or manifest named by ref, which
+	// is a tag or a digest. If ref is "", it returns the store's
+	// default index or manifest.
+	manifest(ref string) ([]byte, error)
+
+	// blobFile returns the path of a local file containing the
+	// blob d, downloading it if necessary.
+	blobFile(d imageDescriptor) (string, error)
+}
+
+// imageManifest has the fields of an image index or an image manifest
+// that we need. An index has Manifests and a manifest has Layers.
+type imageManifest struct {
+	Manifests []imageDescriptor `json:"manifests"`
+	Layers    []imageDescriptor `json:"layers"`
+}
+
+type imageDescriptor struct {
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Platform    *imagePlatform    `json:"platform"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+type imagePlatform struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+	Variant      string `json:"variant"`
+}
+
+func (p *imagePlatform) String() string {
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
+
+// maxLinkHops is the number of symbolic and hard links extractImage
+// follows before giving up.
+const maxLinkHops = 40
+
+// extractImage extracts a file from a container image to a temporary
+// file and returns the file's path. arg has the form image:/path,
+// where image is either a registry reference like alpine:latest or
+// the path of an OCI image layout directory, optionally followed by
+// :tag.
+func extractImage(arg string) (string, error) {
+	i := strings.LastIndex(arg, ":/")
+	if i <= 0 {
+		return "", fmt.Errorf("-image %s: want image:/path/to/file", arg)
+	}
+	ref, file := arg[:i], path.Clean(arg[i+1:])
+
+	dir, err := ioutil.TempDir("", "objbrowse")
+	if err != nil {
+		return "", err
+	}
+	atExit(func() { os.RemoveAll(dir) })
+	dst := filepath.Join(dir, path.Base(file))
+	if err := extractFile(ref, file, dst); err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("-image %s: %v", arg, err)
+	}
+	return dst, nil
+}
+
+// extractFile extracts file from the image ref to dst. Downloaded
+// layers are kept next to dst until the file is found.
+func extractFile(ref, file, dst string) error {
+	blobDir, err := ioutil.TempDir(filepath.Dir(dst), "layers")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(blobDir)
+
+	store, tag, err := openImageStore(ref, blobDir)
+	if err != nil {
+		return err
+	}
+	layers, err := imageLayers(store, tag)
+	if err != nil {
+		return err
+	}
+
+	// Search the layers from the top, since upper layers replace
+	// files in lower layers. Layers are fetched only as needed,
+	// and links restart the search with the link's target.
+	name := strings.TrimPrefix(file, "/")
+	paths := make([]string, len(layers))
+links:
+	for hops := 0; hops <= maxLinkHops; hops++ {
+		for i := len(layers) - 1; i >= 0; i-- {
+			if paths[i] == "" {
+				paths[i], err = store.blobFile(layers[i])
+				if err != nil {
+					return err
+				}
+			}
+			res, link, err := searchLayer(paths[i], name, dst)
+			if err != nil {
+				return fmt.Errorf("layer %s: %v", layers[i].Digest, err)
+			}
+			switch res {
+			case layerFound:
+				return nil
+			case layerLink:
+				name = link
+				continue links
+			case layerDeleted:
+				return notFound(file, name)
+			}
+		}
+		return notFound(file, name)
+	}
+	return fmt.Errorf("%s: too many links", file)
+}
+
+func notFound(file, name string) error {
+	if name != strings.TrimPrefix(file, "/") {
+		return fmt.Errorf("%s (linked to /%s) not found in image", file, name)
+	}
+	return fmt.Errorf("%s not found in image", file)
+}
+
+// openImageStore returns the store for image reference ref and the
+// tag or digest to look up in it. If ref names a directory, possibly
+// followed by :tag, it's an OCI image layout. Otherwise, it's a
+// registry reference, and blobs are downloaded to blobDir.
+func openImageStore(ref, blobDir string) (imageStore, string, error) {
+	if isDir(ref) {
+		return ociLayout(ref), "", nil
+	}
+	if i := strings.LastIndex(ref, ":"); i > 0 && isDir(ref[:i]) {
+		return ociLayout(ref[:i]), ref[i+1:], nil
+	}
+	return newRegistry(ref, blobDir)
+}
+
+func isDir(path string) bool {
+	st, err := os.Stat(path)
+	return err == nil && st.IsDir()
+}
+
+// imageLayers returns the layers of the image tagged tag in store,
+// from bottom to top. If tag names an index of images for several
+// platforms, it picks the image for -image-platform.
+func imageLayers(store imageStore, tag string) ([]imageDescriptor, error) {
+	ref := tag
+	// Indexes may nest, but not deeply in practice.
+	for depth := 0; depth < 4; depth++ {
+		data, err := store.manifest(ref)
+		if err != nil {
+			return nil, err
+		}
+		var m imageManifest
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, fmt.Errorf("parsing manifest %s: %v", ref, err)
+		}
+		if len(m.Manifests) == 0 {
+			if m.Layers == nil {
+				return nil, fmt.Errorf("manifest %s is not an image index or manifest", ref)
+			}
+			return m.Layers, nil
+		}
+		d, err := pickPlatform(m.Manifests)
+		if err != nil {
+			return nil, err
+		}
+		ref = d.Digest
+	}
+	return nil, errors.New("image indexes nested too deeply")
+}
+
+// pickPlatform returns the image in an index that matches
+// -image-platform. A platform without a variant matches any variant.
+func pickPlatform(ds []imageDescriptor) (imageDescriptor, error) {
+	if len(ds) == 1 {
+		return ds[0], nil
+	}
+	want := *flagImagePlatform
+	var have []string
+	for _, d := range ds {
+		if d.Platform == nil {
+			continue
+		}
+		p := d.Platform.String()
+		if p == want || d.Platform.OS+"/"+d.Platform.Architecture == want {
+			return d, nil
+		}
+		have = append(have, p)
+	}
+	return imageDescriptor{}, fmt.Errorf("no image for platform %s (have %s); use -image-platform", want, strings.Join(have, ", "))
+}
+
+type layerResult int
+
+const (
+	layerMissing layerResult = iota // The layer doesn't have the file
+	layerFound                      // The file was extracted
+	layerLink                       // The file or a parent is a link
+	layerDeleted                    // The layer hides the file in lower layers
+)
+
+// searchLayer looks for the file name, relative to the image root, in
+// the layer tarball at layer. If the layer has it, searchLayer
+// extracts it to dst. If the file or one of its parent directories is
+// a link, it returns the name the link resolves to.
+func searchLayer(layer, name, dst string) (layerResult, string, error) {
+	f, err := os.Open(layer)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+	r, err := decompressLayer(f)
+	if err != nil {
+		return 0, "", err
+	}
+
+	deleted := false
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return 0, "", err
+		}
+		ent := cleanImagePath(hdr.Name)
+		dir, base := pathSplit(ent)
+		if strings.HasPrefix(base, ".wh.") {
+			// A whiteout deletes a file from lower layers. An
+			// opaque whiteout deletes everything in its
+			// directory from lower layers.
+			gone := pathJoin(dir, base[len(".wh."):])
+			if base == ".wh..wh..opq" {
+				gone = dir
+			}
+			if isUnder(name, gone) {
+				deleted = true
+			}
+			continue
+		}
+		if !isUnder(name, ent) {
+			continue
+		}
+		rest := name[len(ent):]
+		switch hdr.Typeflag {
+		case tar.TypeSymlink:
+			target := hdr.Linkname
+			if !strings.HasPrefix(target, "/") {
+				target = pathJoin(dir, target)
+			}
+			return layerLink, cleanImagePath(target + rest), nil
+		case tar.TypeLink:
+			// Hard link targets are relative to the root.
+			return layerLink, cleanImagePath(hdr.Linkname + rest), nil
+		case tar.TypeReg:
+			if rest == "" {
+				return layerFound, "", copyToFile(dst, tr)
+			}
+		default:
+			if rest == "" {
+				return 0, "", fmt.Errorf("/%s is not a regular file", name)
+			}
+		}
+	}
+	if deleted {
+		return layerDeleted, "", nil
+	}
+	return layerMissing, "", nil
+}
+
+// cleanImagePath returns p cleaned and relative to the image root.
+// Paths can't escape the root.
+func cleanImagePath(p string) string {
+	return strings.TrimPrefix(path.Clean("/"+p), "/")
+}
+
+// pathSplit splits a cleaned image path into its directory, without
+// a trailing slash, and its last element.
+func pathSplit(p string) (dir, base string) {
+	i := strings.LastIndex(p, "/")
+	if i < 0 {
+		return "", p
+	}
+	return p[:i], p[i+1:]
+}
+
+func pathJoin(dir, p string) string {
+	if dir == "" {
+		return p
+	}
+	return dir + "/" + p
+}
+
+// isUnder reports whether image path name is dir or is in dir. The
+// root, "", contains everything.
+func isUnder(name, dir string) bool {
+	return dir == "" || name == dir || strings.HasPrefix(name, dir+"/")
+}
+
+// decompressLayer returns a reader for the tarball in a layer blob,
+// which may be gzip-compressed.
+func decompressLayer(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(4)
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		return gzip.NewReader(br)
+	case bytes.Equal(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return nil, errors.New("zstd-compressed layers are not supported")
+	}
+	return br, nil
+}
+
+// An ociLayout is an image store in an OCI image layout directory.
+type ociLayout string
+
+func (l ociLayout) manifest(ref string) ([]byte, error) {
+	if strings.Contains(ref, ":") {
+		path, err := l.blobPath(ref)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.ReadFile(path)
+	}
+	index, err := ioutil.ReadFile(filepath.Join(string(l), "index.json"))
+	if err != nil || ref == "" {
+		return index, err
+	}
+	var m imageManifest
+	if err := json.Unmarshal(index, &m); err != nil {
+		return nil, fmt.Errorf("parsing %s index: %v", l, err)
+	}
+	for _, d := range m.Manifests {
+		if d.Annotations["org.opencontainers.image.ref.name"] == ref {
+			return l.manifest(d.Digest)
+		}
+	}
+	return nil, fmt.Errorf("no image tagged %s in %s", ref, l)
+}
+
+func (l ociLayout) blobFile(d imageDescriptor) (string, error) {
+	return l.blobPath(d.Digest)
+}
+
+// blobPath returns the path of the blob with the given digest.
+func (l ociLayout) blobPath(digest string) (string, error) {
+	alg, hash, ok := splitDigest(digest)
+	if !ok {
+		return "", fmt.Errorf("malformed digest %q", digest)
+	}
+	return filepath.Join(string(l), "blobs", alg, hash), nil
+}
+
+// splitDigest splits a digest like sha256:abcd into its algorithm
+// and hash, both of which are safe to use as file names.
+func splitDigest(digest string) (alg, hash string, ok bool) {
+	i := strings.Index(digest, ":")
+	if i <= 0 || i == len(digest)-1 {
+		return "", "", false
+	}
+	alg, hash = digest[:i], digest[i+1:]
+	for _, c := range alg {
+		if !('a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '+' || c == '.' || c == '_' || c == '-') {
+			return "", "", false
+		}
+	}
+	for _, c := range hash {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '=' || c == '_' || c == '-') {
+			return "", "", false
+		}
+	}
+	return alg, hash, true
+}
+
+// A registry is an image store for one repository in a registry that
+// speaks the OCI distribution API. It supports anonymous access,
+// including registries like Docker Hub that require an anonymous
+// bearer token.
+type registry struct {
+	host, repo string
+	base       string // URL of the repository's API
+	blobDir    string
+	token      string
+}
+
+// newRegistry returns the registry store for a reference like
+// alpine, alpine:3.12, ghcr.io/owner/image@sha256:..., or
+// localhost:5000/image, and the tag or digest to look up.
+func newRegistry(ref, blobDir string) (*registry, string, error) {
+	name, tag := ref, "latest"
+	if i := strings.Index(ref, "@"); i >= 0 {
+		name, tag = ref[:i], ref[i+1:]
+	} else if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		name, tag = ref[:i], ref[i+1:]
+	}
+	if name == "" || tag == "" {
+		return nil, "", fmt.Errorf("malformed image reference %q", ref)
+	}
+
+	// Like docker, treat the first element as a registry host if it
+	// looks like one, and default to Docker Hub.
+	host, repo := "docker.io", name
+	if i := strings.Index(name, "/"); i >= 0 {
+		if first := name[:i]; strings.ContainsAny(first, ".:") || first == "localhost" {
+			host, repo = first, name[i+1:]
+		}
+	}
+	if host == "docker.io" || host == "index.docker.io" {
+		host = "registry-1.docker.io"
+		if !strings.Contains(repo, "/") {
+			repo = "library/" + repo
+		}
+	}
+	scheme := "https"
+	if h := (&url.URL{Host: host}).Hostname(); h == "localhost" || h == "127.0.0.1" || h == "::1" {
+		scheme = "http"
+	}
+	r := &registry{
+		host:    host,
+		repo:    repo,
+		base:    scheme + "://" + host + "/v2/" + repo,
+		blobDir: blobDir,
+	}
+	return r, tag, nil
+}
+
+func (r *registry) manifest(ref string) ([]byte, error) {
+	resp, err := r.get("/manifests/"+ref, strings.Join(imageManifestTypes, ", "))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(io.LimitReader(resp.Body, 4<<20))
+}
+
+func (r *registry) blobFile(d imageDescriptor) (string, error) {
+	alg, hash, ok := splitDigest(d.Digest)
+	if !ok {
+		return "", fmt.Errorf("malformed digest %q", d.Digest)
+	}
+	// The descriptor gives the layer's size, which bounds what the
+	// registry may send.
+	if d.Size > maxDownloadSize {
+		return "", fmt.Errorf("layer %s: %s exceeds limit of %s", d.Digest, formatBytes(d.Size), formatBytes(maxDownloadSize))
+	}
+	limit := d.Size
+	if limit <= 0 {
+		limit = maxDownloadSize
+	}
+	resp, err := r.get("/blobs/"+d.Digest, "")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.ContentLength > limit {
+		return "", fmt.Errorf("layer %s: registry sent %s, more than %s", d.Digest, formatBytes(resp.ContentLength), formatBytes(limit))
+	}
+
+	total := resp.ContentLength
+	if total < 0 {
+		total = d.Size
+	}
+	short := d.Digest
+	if len(short) > 19 {
+		short = short[:19]
+	}
+	p := &progress{name: "layer " + short, total: total}
+	h := sha256.New()
+	dst := filepath.Join(r.blobDir, hash)
+	// Read one byte past the limit to detect a body that exceeds
+	// it.
+	err = copyToFile(dst, io.TeeReader(io.LimitReader(resp.Body, limit+1), io.MultiWriter(h, p)))
+	p.done()
+	if err == nil && p.n > limit {
+		err = fmt.Errorf("more than %s", formatBytes(limit))
+	}
+	if err != nil {
+		return "", fmt.Errorf("fetching layer %s: %v", d.Digest, err)
+	}
+	if alg == "sha256" && hex.EncodeToString(h.Sum(nil)) != hash {
+		return "", fmt.Errorf("layer %s: digest mismatch", d.Digest)
+	}
+	return dst, nil
+}
+
+// get fetches path under the repository's API URL. If the registry
+// asks for a bearer token, get fetches an anonymous one and retries.
+func (r *registry) get(path, accept string) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest("GET", r.base+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		if r.token != "" {
+			req.Header.Set("Authorization", "Bearer "+r.token)
+		}
+		resp, err := downloadClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			challenge := resp.Header.Get("WWW-Authenticate")
+			resp.Body.Close()
+			if err := r.login(challenge); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("fetching %s: %s", r.base+path, resp.Status)
+		}
+		return resp, nil
+	}
+}
+
+// login gets an anonymous pull token from the token service named by
+// challenge, the WWW-Authenticate header of an unauthorized response.
+func (r *registry) login(challenge string) error {
+	params, ok := parseBearerChallenge(challenge)
+	if !ok {
+		return fmt.Errorf("%s requires unsupported authentication %q", r.host, challenge)
+	}
+	u, err := url.Parse(params["realm"])
+	if err != nil {
+		return fmt.Errorf("%s: bad token realm: %v", r.host, err)
+	}
+	q := u.Query()
+	if s, ok := params["service"]; ok {
+		q.Set("service", s)
+	}
+	scope, ok := params["scope"]
+	if !ok {
+		scope = "repository:" + r.repo + ":pull"
+	}
+	q.Set("scope", scope)
+	u.RawQuery = q.Encode()
+
+	resp, err := downloadClient.Get(u.String())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("getting token for %s: %s", r.host, resp.Status)
+	}
+	var tok struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return fmt.Errorf("getting token for %s: %v", r.host, err)
+	}
+	r.token = tok.Token
+	if r.token == "" {
+		r.token = tok.AccessToken
+	}
+	if r.token == "" {
+		return fmt.Errorf("getting token for %s: empty token", r.host)
+	}
+	return nil
+}
+
+// parseBearerChallenge parses a WWW-Authenticate header like
+// Bearer realm="https://auth.example.com/token",service="example".
+func parseBearerChallenge(h string) (map[string]string, bool) {
+	const prefix = "bearer "
+	if len(h) < len(prefix) || !strings.EqualFold(h[:len(prefix)], prefix) {
+		return nil, false
+	}
+	params := make(map[string]string)
+	s := h[len(prefix):]
+	for {
+		s = strings.TrimLeft(s, " ,")
+		if s == "" {
+			break
+		}
+		eq := strings.Index(s, "=")
+		if eq < 0 {
+			return nil, false
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = s[eq+1:]
+		var val string
+		if strings.HasPrefix(s, `"`) {
+			end := strings.Index(s[1:], `"`)
+			if end < 0 {
+				return nil, false
+			}
+			val, s = s[1:1+end], s[2+end:]
+		} else {
+			end := strings.Index(s, ",")
+			if end < 0 {
+				end = len(s)
+			}
+			val, s = s[:end], s[end:]
+		}
+		params[key] = val
+	}
+	return params, params["realm"] != ""
+}
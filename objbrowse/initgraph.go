@@ -0,0 +1,191 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+	"os"
+
+	"github.com/aclements/objbrowse/internal/inittrace"
+)
+
+// InitGraphJS is the graph of Go package initialization tasks. Each
+// node depends on the packages that must be initialized before it.
+type InitGraphJS struct {
+	// Recorded indicates the edges are the dependencies recorded
+	// in the tasks, as before Go 1.21. Otherwise, they're
+	// inferred from the packages the init functions refer to.
+	Recorded bool
+	// Nodes are the tasks, in the order they run.
+	Nodes []InitNodeJS
+	// Trace is the path of the -inittrace file, if any.
+	Trace string `json:",omitempty"`
+	// Unmatched lists packages in the trace that aren't in the
+	// graph.
+	Unmatched []string `json:",omitempty"`
+	Errors    []string `json:",omitempty"`
+}
+
+type InitNodeJS struct {
+	Package string
+	Runtime bool `json:",omitempty"`
+	Funcs   []PtrJS
+	// Deps are the indexes of the nodes this node depends on,
+	// leaving out dependencies implied by others.
+	Deps []int
+	// Level is the length of the longest chain of dependencies
+	// below this node.
+	Level int
+	// Time is this package's initialization in the trace, if
+	// any.
+	Time *inittrace.Init `json:",omitempty"`
+}
+
+// loadInitTrace reads a GODEBUG=inittrace=1 trace from path.
+func loadInitTrace(path string) ([]inittrace.Init, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return inittrace.Parse(f)
+}
+
+// hasGoInit reports whether the object has Go package
+// initialization tasks.
+func (s *state) hasGoInit() bool {
+	for _, name := range []string{"go:main.inittasks", "go.main.inittasks", "main..inittask"} {
+		if _, ok := s.symTab.Lookup(name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// initGraph returns the Go package initialization graph, or nil if
+// the object has no Go init tasks.
+func (s *state) initGraph() *InitGraphJS {
+	arch := s.bin.Info().Arch
+	if arch == nil {
+		return nil
+	}
+	r := &initReader{s: s, ptrSize: uint64(arch.PtrSize)}
+	g := s.goInit(r)
+	if g == nil {
+		return nil
+	}
+	out := &InitGraphJS{Recorded: g.Deps, Nodes: []InitNodeJS{}, Trace: *flagInitTrace}
+	index := make(map[string]int)
+	for i, t := range g.Tasks {
+		index[t.Package] = i
+	}
+
+	// deps[i] are the direct dependencies of node i. Since the
+	// tasks are in the order they run, these all come before i.
+	deps := make([][]int, len(g.Tasks))
+	for i, t := range g.Tasks {
+		seen := make(map[int]bool)
+		addDep := func(pkg string) {
+			if j, ok := index[pkg]; ok && j < i && !seen[j] {
+				seen[j] = true
+				deps[i] = append(deps[i], j)
+			}
+		}
+		if g.Deps {
+			for _, d := range t.Deps {
+				addDep(d)
+			}
+			continue
+		}
+		for _, f := range t.Funcs {
+			for _, pkg := range s.initRefs(uint64(f.Addr)) {
+				addDep(pkg)
+			}
+		}
+	}
+
+	// Drop the dependencies implied by others. reach[i] is the set
+	// of nodes i depends on, directly or not.
+	reach := make([][]bool, len(g.Tasks))
+	for i, t := range g.Tasks {
+		reach[i] = make([]bool, len(g.Tasks))
+		for _, d := range deps[i] {
+			reach[i][d] = true
+			for j, ok := range reach[d] {
+				if ok {
+					reach[i][j] = true
+				}
+			}
+		}
+		node := InitNodeJS{Package: t.Package, Runtime: t.Runtime, Funcs: t.Funcs, Deps: []int{}}
+		for _, d := range deps[i] {
+			implied := false
+			for _, d2 := range deps[i] {
+				if d2 != d && reach[d2][d] {
+					implied = true
+					break
+				}
+			}
+			if !implied {
+				node.Deps = append(node.Deps, d)
+			}
+			if l := out.Nodes[d].Level + 1; l > node.Level {
+				node.Level = l
+			}
+		}
+		out.Nodes = append(out.Nodes, node)
+	}
+
+	for i := range s.initTrace {
+		in := &s.initTrace[i]
+		if j, ok := index[in.Package]; ok {
+			out.Nodes[j].Time = in
+		} else {
+			out.Unmatched = append(out.Unmatched, in.Package)
+		}
+	}
+	out.Errors = r.errors
+	return out
+}
+
+// initRefs returns the Go packages referred to by the function at pc,
+// by calls or by operands that point into other symbols.
+func (s *state) initRefs(pc uint64) []string {
+	id, ok := s.symTab.Addr(pc)
+	if !ok || s.symTab.Syms()[id].Value != pc {
+		return nil
+	}
+	insts, err := s.fi.Disasm(id)
+	if err != nil {
+		return nil
+	}
+	var pkgs []string
+	syms := s.symTab.Syms()
+	for i := 0; i < insts.Len(); i++ {
+		inst := insts.Get(i)
+		targets := inst.Consts()
+		if c := inst.Control(); c.TargetPC != 0 {
+			targets = append(targets, c.TargetPC)
+		}
+		for _, v := range targets {
+			if tid, ok := s.symTab.Addr(v); ok && syms[tid].Value != 0 {
+				if pkg := goPackage(syms[tid].Name); pkg != "" {
+					pkgs = append(pkgs, pkg)
+				}
+			}
+		}
+	}
+	return pkgs
+}
+
+// httpInitGraph serves the Go package initialization graph as JSON.
+func (s *state) httpInitGraph(w http.ResponseWriter, r *http.Request) {
+	g := s.initGraph()
+	if g == nil {
+		http.Error(w, "no Go package initialization tasks", http.StatusNotFound)
+		return
+	}
+	serveJSON(w, g)
+}
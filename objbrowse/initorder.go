@@ -0,0 +1,369 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/aclements/objbrowse/obj"
+)
+
+// InitOrderJS lists the functions that run before and after main, in
+// the order they run.
+type InitOrderJS struct {
+	Steps []InitStepJS
+	// Go describes the Go package initialization tasks, if this
+	// is a Go binary.
+	Go     *GoInitJS `json:",omitempty"`
+	Errors []string  `json:",omitempty"`
+}
+
+// InitStepJS is a function run during startup or exit. Phase is where
+// it comes from: an ELF array or function (such as "init_array" or
+// "init"), "go runtime" or "go" for Go package initializers, "main",
+// or "fini_array" or "fini" at exit.
+type InitStepJS struct {
+	Phase string
+	Func  PtrJS
+	// Package is the Go package being initialized, if any.
+	Package string `json:",omitempty"`
+}
+
+// GoInitJS describes the Go package initialization tasks.
+type GoInitJS struct {
+	// Deps indicates the tasks record their dependencies, as they
+	// do before Go 1.21. Later linkers sort the tasks themselves,
+	// so only the order remains.
+	Deps  bool
+	Tasks []GoInitTaskJS
+}
+
+// GoInitTaskJS is the initialization task of a Go package, in the
+// order the tasks run.
+type GoInitTaskJS struct {
+	Package string
+	Addr    AddrJS
+	// Runtime indicates the task is run while the runtime starts,
+	// before the others.
+	Runtime bool `json:",omitempty"`
+	Funcs   []PtrJS
+	// Deps are the packages that must be initialized first, if
+	// GoInitJS.Deps is set.
+	Deps []string `json:",omitempty"`
+}
+
+// maxInitFuncs bounds the entries read from an init array or Go init
+// task, in case the file is malformed.
+const maxInitFuncs = 1 << 16
+
+// initReader reads pointers from the object, applying relocations.
+type initReader struct {
+	s       *state
+	ptrSize uint64
+	errors  []string
+}
+
+// ptrs reads n pointers at addr. For pointers that have a
+// relocation, it returns the relocation's target, since the file may
+// not contain the final value. In a relocatable object, sect is the
+// section containing addr; otherwise it's -1.
+func (r *initReader) ptrs(sect int, addr, n uint64) []PtrJS {
+	if n > maxInitFuncs {
+		r.errors = append(r.errors, fmt.Sprintf("%d pointers at %#x is too many", n, addr))
+		return nil
+	}
+	var data obj.Data
+	var err error
+	if sect >= 0 {
+		data, err = r.s.bin.SectionData(sect)
+	} else {
+		data, err = r.s.bin.Data(addr, n*r.ptrSize)
+	}
+	if err != nil {
+		r.errors = append(r.errors, err.Error())
+		return nil
+	}
+	if uint64(len(data.P)) < addr-data.Addr+n*r.ptrSize {
+		r.errors = append(r.errors, fmt.Sprintf("%d pointers at %#x are out of bounds", n, addr))
+		return nil
+	}
+	relocs := make(map[uint64]obj.Reloc)
+	var rel obj.Reloc
+	for i := 0; i < data.R.Len(); i++ {
+		data.R.Get(i, &rel)
+		relocs[rel.Offset] = rel
+	}
+
+	order := r.s.bin.Info().Arch.ByteOrder
+	out := make([]PtrJS, 0, n)
+	for i := uint64(0); i < n; i++ {
+		at := addr + i*r.ptrSize
+		p := data.P[at-data.Addr:]
+		var v uint64
+		if r.ptrSize == 8 {
+			v = order.Uint64(p)
+		} else {
+			v = uint64(order.Uint32(p))
+		}
+		if rel, ok := relocs[at]; ok {
+			out = append(out, r.relocPtr(&rel))
+			continue
+		}
+		out = append(out, r.s.fi.ResolvePtr(v, 0))
+	}
+	return out
+}
+
+// relocPtr returns the pointer relocation rel stores.
+func (r *initReader) relocPtr(rel *obj.Reloc) PtrJS {
+	syms := r.s.symTab.Syms()
+	if rel.Symbol < 0 || int(rel.Symbol) >= len(syms) {
+		// A relative relocation stores the addend.
+		return r.s.fi.ResolvePtr(uint64(rel.Addend), 0)
+	}
+	target := &syms[rel.Symbol]
+	addr := target.Value + uint64(rel.Addend)
+	if !r.s.bin.Info().Relocatable {
+		if target.Kind == obj.SymUndef {
+			return PtrJS{Sym: target.Name, Off: uint64(rel.Addend)}
+		}
+		return r.s.fi.ResolvePtr(addr, 0)
+	}
+	// Addresses in a relocatable object are only meaningful
+	// within a section, so find the target in its section.
+	if target.Name != "" {
+		return PtrJS{Addr: AddrJS(addr), Sym: target.Name, Off: uint64(rel.Addend)}
+	}
+	p := PtrJS{Addr: AddrJS(addr)}
+	if id, ok := r.s.relocSym(target.Section, addr); ok {
+		sym := &syms[id]
+		p.Sym, p.Off = sym.Name, addr-sym.Value
+	}
+	return p
+}
+
+// ptr reads the pointer at addr.
+func (r *initReader) ptr(addr uint64) (uint64, bool) {
+	ps := r.ptrs(-1, addr, 1)
+	if len(ps) == 0 {
+		return 0, false
+	}
+	return uint64(ps[0].Addr), true
+}
+
+// initOrder returns the functions the object runs before and after
+// main.
+func (s *state) initOrder() *InitOrderJS {
+	out := &InitOrderJS{Steps: []InitStepJS{}}
+	arch := s.bin.Info().Arch
+	if arch == nil {
+		out.Errors = append(out.Errors, "unknown architecture")
+		return out
+	}
+	r := &initReader{s: s, ptrSize: uint64(arch.PtrSize)}
+	relocatable := s.bin.Info().Relocatable
+	sects := s.bin.Sections()
+
+	// ELF startup runs the preinit array, the init function, and
+	// the init array, in that order. At exit, it runs the fini
+	// array backwards and then the fini function.
+	array := func(name string) []PtrJS {
+		var funcs []PtrJS
+		for i, sect := range sects {
+			// Relocatable objects may have several sections
+			// named like .init_array.00100.
+			if sect.Name != name && !(relocatable && strings.HasPrefix(sect.Name, name+".")) {
+				continue
+			}
+			si := -1
+			if relocatable {
+				si = i
+			}
+			for _, p := range r.ptrs(si, sect.Addr, sect.Size/r.ptrSize) {
+				// Legacy .ctors arrays use 0 and -1 as
+				// terminators.
+				if p.Sym != "" || (p.Addr != 0 && uint64(p.Addr) != 1<<(8*r.ptrSize)-1) {
+					funcs = append(funcs, p)
+				}
+			}
+		}
+		return funcs
+	}
+	fn := func(sectName string) (PtrJS, bool) {
+		for _, sect := range sects {
+			if sect.Name == sectName && sect.Size > 0 {
+				p := s.fi.ResolvePtr(sect.Addr, 0)
+				if relocatable {
+					p = PtrJS{Addr: AddrJS(sect.Addr), Section: sect.Name}
+				}
+				return p, true
+			}
+		}
+		return PtrJS{}, false
+	}
+	add := func(phase string, funcs ...PtrJS) {
+		for _, f := range funcs {
+			out.Steps = append(out.Steps, InitStepJS{Phase: phase, Func: f})
+		}
+	}
+	if s.bin.Info().Format == "elf" {
+		add("preinit_array", array(".preinit_array")...)
+		if p, ok := fn(".init"); ok {
+			add("init", p)
+		}
+		// Legacy .ctors run from the init function, backwards.
+		ctors := array(".ctors")
+		for i, j := 0, len(ctors)-1; i < j; i, j = i+1, j-1 {
+			ctors[i], ctors[j] = ctors[j], ctors[i]
+		}
+		add("ctors", ctors...)
+		add("init_array", array(".init_array")...)
+	}
+
+	if g := s.goInit(r); g != nil {
+		out.Go = g
+		for _, t := range g.Tasks {
+			phase := "go"
+			if t.Runtime {
+				phase = "go runtime"
+			}
+			for _, f := range t.Funcs {
+				out.Steps = append(out.Steps, InitStepJS{Phase: phase, Func: f, Package: t.Package})
+			}
+		}
+	}
+
+	for _, name := range []string{"main.main", "main"} {
+		if id, ok := s.symTab.Lookup(name); ok {
+			if sym := s.symTab.Syms()[id]; sym.Kind != obj.SymUndef {
+				p := PtrJS{Addr: AddrJS(sym.Value), Sym: sym.Name}
+				add("main", p)
+				break
+			}
+		}
+	}
+
+	if s.bin.Info().Format == "elf" {
+		fini := array(".fini_array")
+		for i := len(fini) - 1; i >= 0; i-- {
+			add("fini_array", fini[i])
+		}
+		// Legacy .dtors run from the fini function.
+		add("dtors", array(".dtors")...)
+		if p, ok := fn(".fini"); ok {
+			add("fini", p)
+		}
+	}
+	out.Errors = append(out.Errors, r.errors...)
+	return out
+}
+
+// goInit decodes the Go package initialization tasks, or returns nil
+// if there are none.
+//
+// Since Go 1.21, the linker lists the tasks in the order they run in
+// go:runtime.inittasks and go:main.inittasks. Each task is
+//
+//	struct { state, nfns uint32; fns [nfns]uintptr }
+//
+// where each fn is a function's entry PC. Before that, the runtime
+// walked the tasks' dependencies from runtime..inittask and then
+// main..inittask, running each task after its dependencies. Each task
+// is
+//
+//	struct { state, ndeps, nfns uintptr; deps [ndeps]*task; fns [nfns]*funcval }
+func (s *state) goInit(r *initReader) *GoInitJS {
+	lookup := func(names ...string) (obj.Sym, bool) {
+		for _, name := range names {
+			if id, ok := s.symTab.Lookup(name); ok {
+				return s.symTab.Syms()[id], true
+			}
+		}
+		return obj.Sym{}, false
+	}
+	pkgOf := func(addr uint64) string {
+		if id, ok := s.symTab.Addr(addr); ok {
+			if sym := s.symTab.Syms()[id]; sym.Value == addr && strings.HasSuffix(sym.Name, "..inittask") {
+				return strings.TrimSuffix(sym.Name, "..inittask")
+			}
+		}
+		return fmt.Sprintf("task@%#x", addr)
+	}
+
+	mainTasks, ok := lookup("go:main.inittasks", "go.main.inittasks")
+	if ok {
+		g := &GoInitJS{Tasks: []GoInitTaskJS{}}
+		done := make(map[AddrJS]bool)
+		list := func(sym obj.Sym, runtime bool) {
+			for _, p := range r.ptrs(-1, sym.Value, sym.Size/r.ptrSize) {
+				// The runtime skips tasks that already ran.
+				if done[p.Addr] {
+					continue
+				}
+				done[p.Addr] = true
+				t := GoInitTaskJS{Package: pkgOf(uint64(p.Addr)), Addr: p.Addr, Runtime: runtime, Funcs: []PtrJS{}}
+				hdr, err := s.bin.Data(uint64(p.Addr), 8)
+				if err != nil || len(hdr.P) < 8 {
+					r.errors = append(r.errors, fmt.Sprintf("reading init task of %s: bad address", t.Package))
+					continue
+				}
+				nfns := uint64(s.bin.Info().Arch.ByteOrder.Uint32(hdr.P[4:]))
+				t.Funcs = append(t.Funcs, r.ptrs(-1, uint64(p.Addr)+8, nfns)...)
+				g.Tasks = append(g.Tasks, t)
+			}
+		}
+		if rt, ok := lookup("go:runtime.inittasks", "go.runtime.inittasks"); ok {
+			list(rt, true)
+		}
+		list(mainTasks, false)
+		return g
+	}
+
+	mainTask, ok := lookup("main..inittask")
+	if !ok {
+		return nil
+	}
+	g := &GoInitJS{Deps: true, Tasks: []GoInitTaskJS{}}
+	done := make(map[uint64]bool)
+	var visit func(addr uint64, runtime bool, depth int)
+	visit = func(addr uint64, runtime bool, depth int) {
+		if done[addr] || depth > 1000 {
+			return
+		}
+		done[addr] = true
+		hdr := r.ptrs(-1, addr, 3)
+		if len(hdr) < 3 {
+			return
+		}
+		ndeps, nfns := uint64(hdr[1].Addr), uint64(hdr[2].Addr)
+		deps := r.ptrs(-1, addr+3*r.ptrSize, ndeps)
+		t := GoInitTaskJS{Package: pkgOf(addr), Addr: AddrJS(addr), Runtime: runtime, Funcs: []PtrJS{}, Deps: []string{}}
+		for _, d := range deps {
+			visit(uint64(d.Addr), runtime, depth+1)
+			t.Deps = append(t.Deps, pkgOf(uint64(d.Addr)))
+		}
+		// Each function is a pointer to a closure whose first
+		// word is the entry PC.
+		for _, fv := range r.ptrs(-1, addr+(3+ndeps)*r.ptrSize, nfns) {
+			if pc, ok := r.ptr(uint64(fv.Addr)); ok {
+				t.Funcs = append(t.Funcs, s.fi.ResolvePtr(pc, 0))
+			}
+		}
+		g.Tasks = append(g.Tasks, t)
+	}
+	if rt, ok := lookup("runtime..inittask"); ok {
+		visit(rt.Value, true, 0)
+	}
+	visit(mainTask.Value, false, 0)
+	return g
+}
+
+// httpInitOrder serves the functions run before and after main as
+// JSON.
+func (s *state) httpInitOrder(w http.ResponseWriter, r *http.Request) {
+	serveJSON(w, s.initOrder())
+}
@@ -0,0 +1,213 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+"use strict";
+
+// InitOrderView lists the functions that run before and after main,
+// from the ELF init and fini arrays and Go's package initialization
+// tasks, in the order they run.
+class InitOrderView {
+    constructor(container) {
+        const details = $("<details>").addClass("initorderview").appendTo(container);
+        $("<summary>").text("Startup and exit").appendTo(details);
+        const div = $("<div>").appendTo(details);
+
+        details.one("toggle", () => {
+            div.text("Loading…");
+            $.getJSON("/initorder").done((data) => {
+                div.empty();
+                InitOrderView._render(data, div);
+            }).fail((xhr) => {
+                showError("Startup and exit", xhr, div.empty());
+            });
+        });
+    }
+
+    static _render(data, div) {
+        if (data.Steps.length == 0)
+            div.text("No startup or exit functions found.");
+        else {
+            const table = $("<table>").addClass("init-table").appendTo(div);
+            $("<tr>").append(["", "phase", "function", "package"].map((h) => $("<th>").text(h))).appendTo(table);
+            data.Steps.forEach((step, i) => {
+                $("<tr>").toggleClass("init-main", step.Phase == "main").append(
+                    $("<td>").addClass("pos").text(i + 1),
+                    $("<td>").text(step.Phase),
+                    $("<td>").append(InitOrderView._ptr(step.Func)),
+                    $("<td>").text(step.Package || "")).appendTo(table);
+            });
+        }
+
+        const g = data.Go;
+        if (g && g.Tasks.length > 0) {
+            $("<h4>").text("Go package initialization").appendTo(div);
+            if (!g.Deps)
+                $("<div>").addClass("sv-note").
+                    text("The linker sorted these packages so each follows its imports, and didn't record the imports themselves.").
+                    appendTo(div);
+            const tasks = $("<table>").addClass("init-table").appendTo(div);
+            $("<tr>").append(["package", "functions"].concat(g.Deps ? ["depends on"] : []).
+                             map((h) => $("<th>").text(h))).appendTo(tasks);
+            for (let t of g.Tasks) {
+                const tr = $("<tr>").attr("id", "init-" + t.Package).append(
+                    $("<td>").text(t.Package + (t.Runtime ? " (runtime)" : "")),
+                    $("<td>").text(t.Funcs.length)).appendTo(tasks);
+                if (g.Deps) {
+                    const deps = $("<td>").appendTo(tr);
+                    t.Deps.forEach((d, i) => {
+                        if (i > 0)
+                            deps.append(", ");
+                        $("<a>").attr("href", "#init-" + d).text(d).appendTo(deps);
+                    });
+                }
+            }
+        }
+        for (let err of data.Errors || [])
+            $("<div>").addClass("init-error").text(err).appendTo(div);
+    }
+
+    // _ptr returns a link to the function at PtrJS p.
+    static _ptr(p) {
+        if (!p.Sym)
+            return $("<span>").text("0x" + p.Addr + (p.Section ? " (" + p.Section + ")" : ""));
+        const name = p.Sym + (p.Off ? "+0x" + p.Off.toString(16) : "");
+        let url = symURL(p.Sym);
+        if (p.Off) {
+            const off = new AddrJS(p.Off.toString(16));
+            url += "#+" + formatRanges([{start: off, end: off.add(new AddrJS(1))}]);
+        }
+        return $("<a>").attr("href", url).text(name);
+    }
+}
+
+// InitGraphView draws the Go package initialization graph, with the
+// packages that initialize first on the left. With -inittrace, each
+// package is shaded by how long it took to initialize.
+class InitGraphView {
+    constructor(container) {
+        const self = this;
+        const details = $("<details>").addClass("initgraphview").appendTo(container);
+        $("<summary>").text("Go package init graph").appendTo(details);
+        this._div = $("<div>").appendTo(details);
+
+        details.one("toggle", () => {
+            self._div.text("Loading…");
+            $.getJSON("/initgraph").done((data) => {
+                self._render(data);
+            }).fail((xhr) => {
+                showError("Go package init graph", xhr, self._div.empty());
+            });
+        });
+    }
+
+    _render(data) {
+        const self = this;
+        const div = this._div.empty();
+        const nodes = data.Nodes;
+        const traced = nodes.some((n) => n.Time);
+        $("<div>").addClass("sv-note").text(data.Recorded ?
+            "Edges are the imports recorded in the init tasks, leaving out those implied by others." :
+            "Edges are inferred from the packages each package's init functions refer to, leaving out those implied by others.").
+            appendTo(div);
+        if (data.Trace && !traced)
+            $("<div>").addClass("sv-note").text("No packages in " + data.Trace + " match this binary.").appendTo(div);
+
+        // Lay out the nodes in columns by level.
+        const boxW = 180, boxH = 18, gapX = 50, gapY = 6;
+        const cols = [];
+        for (let n of nodes) {
+            while (cols.length <= n.Level)
+                cols.push([]);
+            n.row = cols[n.Level].length;
+            cols[n.Level].push(n);
+        }
+        const x = (n) => n.Level * (boxW + gapX);
+        const y = (n) => n.row * (boxH + gapY);
+        const width = cols.length * (boxW + gapX) - gapX;
+        const height = Math.max(...cols.map((c) => c.length)) * (boxH + gapY);
+        const maxClock = Math.max(0, ...nodes.map((n) => n.Time ? n.Time.Clock : 0));
+
+        const svgNS = "http://www.w3.org/2000/svg";
+        const elt = (name, attrs) => $(document.createElementNS(svgNS, name)).attr(attrs || {});
+        const svg = elt("svg", {width: width, height: height}).addClass("initgraph");
+        $("<div>").addClass("initgraph-scroll").append(svg).appendTo(div);
+        const edges = elt("g").appendTo(svg);
+        const info = $("<div>").addClass("initgraph-info").appendTo(div);
+
+        nodes.forEach((n, i) => {
+            for (let d of n.Deps) {
+                const dep = nodes[d];
+                const x1 = x(dep) + boxW, y1 = y(dep) + boxH / 2, x2 = x(n), y2 = y(n) + boxH / 2;
+                const mid = (x1 + x2) / 2;
+                n.edges = n.edges || [];
+                n.edges.push(elt("path", {d: `M${x1},${y1} C${mid},${y1} ${mid},${y2} ${x2},${y2}`}).
+                             addClass("initgraph-edge").appendTo(edges));
+            }
+            const g = elt("g", {transform: `translate(${x(n)},${y(n)})`}).addClass("initgraph-node").appendTo(svg);
+            const rect = elt("rect", {width: boxW, height: boxH, rx: 3}).appendTo(g);
+            if (n.Runtime)
+                rect.addClass("initgraph-runtime");
+            if (n.Time && maxClock > 0)
+                rect.css("fill", `rgba(220, 60, 40, ${0.1 + 0.9 * n.Time.Clock / maxClock})`);
+            let label = n.Package;
+            if (label.length > 26)
+                label = "…" + label.slice(-25);
+            elt("text", {x: 4, y: boxH - 5}).text(label).appendTo(g);
+            let title = n.Package + "\n" + n.Funcs.length + " init functions";
+            if (n.Time)
+                title += "\n" + InitGraphView._time(n.Time);
+            elt("title").text(title).appendTo(g);
+            g.click(() => { self._select(n, nodes, info); });
+        });
+
+        if (traced) {
+            // List the slowest packages.
+            const slow = nodes.filter((n) => n.Time).sort((a, b) => b.Time.Clock - a.Time.Clock).slice(0, 10);
+            $("<h4>").text("Slowest packages").appendTo(div);
+            const table = $("<table>").addClass("init-table").appendTo(div);
+            $("<tr>").append(["package", "start", "clock", "bytes", "allocs"].map((h) => $("<th>").text(h))).appendTo(table);
+            for (let n of slow) {
+                $("<tr>").append(
+                    $("<td>").append($("<a>").attr("href", "#").text(n.Package).click((ev) => {
+                        ev.preventDefault();
+                        self._select(n, nodes, info);
+                    })),
+                    $("<td>").addClass("pos").text("@" + n.Time.Start + " ms"),
+                    $("<td>").addClass("pos").text(n.Time.Clock + " ms"),
+                    $("<td>").addClass("pos").text(n.Time.Bytes),
+                    $("<td>").addClass("pos").text(n.Time.Allocs)).appendTo(table);
+            }
+        }
+        if (data.Unmatched)
+            $("<div>").addClass("sv-note").text("Traced packages not in this binary: " + data.Unmatched.join(", ")).appendTo(div);
+        for (let err of data.Errors || [])
+            $("<div>").addClass("init-error").text(err).appendTo(div);
+    }
+
+    // _select highlights node n and its dependencies and shows its
+    // init functions in info.
+    _select(n, nodes, info) {
+        this._div.find(".initgraph-selected").removeClass("initgraph-selected");
+        for (let m of nodes)
+            for (let e of m.edges || [])
+                e.removeClass("initgraph-selected");
+        for (let e of n.edges || [])
+            e.addClass("initgraph-selected");
+
+        info.empty();
+        $("<b>").text(n.Package).appendTo(info);
+        if (n.Time)
+            info.append(" " + InitGraphView._time(n.Time));
+        if (n.Deps.length > 0)
+            $("<div>").text("after " + n.Deps.map((d) => nodes[d].Package).join(", ")).appendTo(info);
+        const list = $("<ul>").appendTo(info);
+        for (let f of n.Funcs)
+            $("<li>").append(InitOrderView._ptr(f)).appendTo(list);
+        info[0].scrollIntoView({block: "nearest"});
+    }
+
+    static _time(t) {
+        return "@" + t.Start + " ms, " + t.Clock + " ms clock, " + t.Bytes + " bytes, " + t.Allocs + " allocs";
+    }
+}
@@ -0,0 +1,188 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/aclements/objbrowse/internal/asm"
+	"github.com/aclements/objbrowse/obj"
+)
+
+// InstHist counts instruction mnemonics across the object's text
+// symbols.
+type InstHist struct {
+	fi *FileInfo
+
+	once sync.Once
+	// counts maps from package to mnemonic to count. Symbols
+	// outside Go packages are under "".
+	counts map[string]map[string]int
+	// users maps from mnemonic to the symbols that use it and
+	// how many times.
+	users map[string]map[obj.SymID]int
+}
+
+func NewInstHist(fi *FileInfo) *InstHist {
+	return &InstHist{fi: fi}
+}
+
+type InstHistJS struct {
+	// Pkg is the package the histogram is restricted to, or "".
+	Pkg   string `json:",omitempty"`
+	Total int
+	Ops   []OpCountJS
+	// Packages lists the Go packages with code, for choosing a
+	// package.
+	Packages []string
+}
+
+type OpCountJS struct {
+	Op    string
+	Count int
+}
+
+// prepare counts the instructions in code if they haven't been
+// already, reporting progress to progress, which may be nil.
+func (h *InstHist) prepare(progress progressFunc) {
+	h.once.Do(func() {
+		h.counts = make(map[string]map[string]int)
+		h.users = make(map[string]map[obj.SymID]int)
+		h.fi.ForEachText(progress, func(id obj.SymID, sym obj.Sym, insts asm.Seq) {
+			pkg := goPackage(sym.Name)
+			counts := h.counts[pkg]
+			if counts == nil {
+				counts = make(map[string]int)
+				h.counts[pkg] = counts
+			}
+			for i := 0; i < insts.Len(); i++ {
+				op, _ := parseAsm(insts.Get(i).GoSyntax(nil))
+				counts[op]++
+				users := h.users[op]
+				if users == nil {
+					users = make(map[obj.SymID]int)
+					h.users[op] = users
+				}
+				users[id]++
+			}
+		})
+	})
+}
+
+// Histogram returns the instruction counts of package pkg, or of the
+// whole object if pkg is "".
+func (h *InstHist) Histogram(pkg string) *InstHistJS {
+	h.prepare(nil)
+	total := make(map[string]int)
+	out := &InstHistJS{Pkg: pkg, Ops: []OpCountJS{}, Packages: []string{}}
+	for p, counts := range h.counts {
+		if p != "" {
+			out.Packages = append(out.Packages, p)
+		}
+		if pkg != "" && p != pkg {
+			continue
+		}
+		for op, n := range counts {
+			total[op] += n
+		}
+	}
+	for op, n := range total {
+		out.Ops = append(out.Ops, OpCountJS{op, n})
+		out.Total += n
+	}
+	sort.Slice(out.Ops, func(i, j int) bool {
+		if out.Ops[i].Count != out.Ops[j].Count {
+			return out.Ops[i].Count > out.Ops[j].Count
+		}
+		return out.Ops[i].Op < out.Ops[j].Op
+	})
+	sort.Strings(out.Packages)
+	return out
+}
+
+// InstUsersJS lists the symbols that use a mnemonic.
+type InstUsersJS struct {
+	Op   string
+	Syms []InstUserJS
+	// Truncated indicates that there were more than the
+	// requested number of symbols.
+	Truncated bool `json:",omitempty"`
+}
+
+type InstUserJS struct {
+	Name  string
+	ID    obj.SymID
+	Count int
+}
+
+// Users returns up to n symbols in package pkg (or any package if pkg
+// is "") that use mnemonic op, most uses first.
+func (h *InstHist) Users(op, pkg string, n int) *InstUsersJS {
+	h.prepare(nil)
+	syms := h.fi.SymTab.Syms()
+	out := &InstUsersJS{Op: op, Syms: []InstUserJS{}}
+	for id, count := range h.users[op] {
+		name := syms[id].Name
+		if pkg != "" && goPackage(name) != pkg {
+			continue
+		}
+		out.Syms = append(out.Syms, InstUserJS{name, id, count})
+	}
+	sort.Slice(out.Syms, func(i, j int) bool {
+		if out.Syms[i].Count != out.Syms[j].Count {
+			return out.Syms[i].Count > out.Syms[j].Count
+		}
+		return out.Syms[i].Name < out.Syms[j].Name
+	})
+	if len(out.Syms) > n {
+		out.Syms, out.Truncated = out.Syms[:n], true
+	}
+	return out
+}
+
+// httpInstHist serves the instruction histogram as JSON. The "pkg"
+// query parameter restricts it to a Go package. If the "op" query
+// parameter is given, it instead serves the symbols that use that
+// mnemonic, limited to "n" symbols.
+func (s *state) httpInstHist(w http.ResponseWriter, r *http.Request) {
+	pkg := r.FormValue("pkg")
+	if op := r.FormValue("op"); op != "" {
+		n, err := strconv.Atoi(r.FormValue("n"))
+		if err != nil || n <= 0 {
+			n = 100
+		}
+		serveJSON(w, s.instHist.Users(op, pkg, n))
+		return
+	}
+	serveJSON(w, s.instHist.Histogram(pkg))
+}
+
+// httpInstChart serves the instruction histogram page.
+func (s *state) httpInstChart(w http.ResponseWriter, r *http.Request) {
+	if err := tmplInstChart.Execute(w, nil); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+var tmplInstChart = template.Must(template.New("").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>Objbrowse: instruction histogram</title>
+<link rel="stylesheet" type="text/css" href="/objbrowse.css" />
+</head>
+<body>
+<script src="https://code.jquery.com/jquery-3.3.1.min.js"></script>
+<script src="/objbrowse.js"></script>
+<script src="/palette.js"></script>
+<script src="/insthist.js"></script>
+<script>new InstHistView(document.body)</script>
+<script>new CommandPalette({})</script>
+</body>
+</html>
+`))
@@ -0,0 +1,105 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+"use strict";
+
+// InstHistView charts the instruction mnemonics used across the
+// binary, optionally restricted to one Go package.
+class InstHistView {
+    constructor(container) {
+        const self = this;
+        const div = $("<div>").addClass("insthist").appendTo(container);
+        $("<h3>").text("Instruction histogram").appendTo(div);
+        const form = $("<form>").addClass("search").appendTo(div);
+        this._pkg = $("<select>").append($("<option>").attr("value", "").text("all packages"));
+        this._filter = $("<input>").attr({size: 20, placeholder: "mnemonic regexp, e.g. ^CMOV"});
+        form.append(this._pkg).append(" ").append(this._filter);
+        form.submit((ev) => { ev.preventDefault(); });
+        this._pkg.change(() => { self._load(); });
+        this._filter.on("input", () => { self._draw(); });
+        this._status = $("<div>").addClass("sv-note").appendTo(div);
+        this._chart = $("<table>").addClass("ih-chart").appendTo(div);
+        this._users = $("<div>").addClass("ih-users").appendTo(div);
+        this._data = null;
+        this._load();
+    }
+
+    _load() {
+        const self = this;
+        const pkg = this._pkg.val();
+        this._status.text("Counting instructions…");
+        this._users.empty();
+        const onProgress = (done, total) => {
+            self._status.text("Counting instructions… " + done + "/" + total + " symbols");
+        };
+        runJob("insthist", {pkg: pkg}, onProgress).done((data) => {
+            if (self._pkg.val() !== pkg)
+                return;
+            self._data = data;
+            if (self._pkg.children().length == 1) {
+                for (let p of data.Packages)
+                    $("<option>").attr("value", p).text(p).appendTo(self._pkg);
+            }
+            self._draw();
+        }).fail((err) => {
+            showError("Instruction histogram", err, self._status.empty());
+        });
+    }
+
+    _draw() {
+        const self = this;
+        const data = this._data;
+        if (!data)
+            return;
+        let re = null;
+        try {
+            re = new RegExp(this._filter.val(), "i");
+            this._filter.removeClass("ih-bad");
+        } catch (e) {
+            this._filter.addClass("ih-bad");
+        }
+        const ops = data.Ops.filter((o) => !re || re.test(o.Op));
+        let matched = 0;
+        for (let o of ops)
+            matched += o.Count;
+        let status = data.Total + " instructions, " + data.Ops.length + " mnemonics";
+        if (ops.length != data.Ops.length)
+            status += "; " + matched + " instructions in " + ops.length + " matching mnemonics";
+        this._status.text(status);
+
+        const chart = this._chart.empty();
+        const max = ops.length > 0 ? ops[0].Count : 1;
+        for (let o of ops) {
+            const pct = (100 * o.Count / data.Total).toFixed(2) + "%";
+            const bar = $("<div>").addClass("ih-bar").css("width", (100 * o.Count / max) + "%");
+            $("<tr>").
+                append($("<td>").addClass("ih-op").text(o.Op)).
+                append($("<td>").addClass("pos").text(o.Count)).
+                append($("<td>").addClass("pos").text(pct)).
+                append($("<td>").addClass("ih-cell").append(bar)).
+                click(() => { self._showUsers(o.Op); }).
+                appendTo(chart);
+        }
+    }
+
+    // _showUsers lists the symbols that use mnemonic op.
+    _showUsers(op) {
+        const users = this._users.text("Loading…");
+        $.getJSON("/insthist", {op: op, pkg: this._pkg.val()}).done((data) => {
+            users.empty();
+            $("<h4>").text("Symbols using " + op).appendTo(users);
+            const table = $("<table>").appendTo(users);
+            for (let s of data.Syms)
+                $("<tr>").
+                    append($("<td>").addClass("pos").text(s.Count)).
+                    append($("<td>").append($("<a>").attr("href", symURL(s.Name, s.ID)).text(s.Name))).
+                    appendTo(table);
+            if (data.Truncated)
+                $("<div>").addClass("sv-note").text("(more symbols not shown)").appendTo(users);
+            $("html, body").scrollTop(users.offset().top);
+        }).fail((xhr) => {
+            showError("Instruction users", xhr, users.empty());
+        });
+    }
+}
@@ -0,0 +1,234 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aclements/objbrowse/arch"
+	"github.com/aclements/objbrowse/internal/asm"
+	"github.com/aclements/objbrowse/obj"
+)
+
+// ISAScan finds the instruction set extensions used by the object's
+// code and the code that checks for CPU features at run time.
+type ISAScan struct {
+	fi *FileInfo
+
+	once sync.Once
+	// users maps from extension to the symbols that use it and how
+	// many instructions they use.
+	users map[string]map[obj.SymID]int
+	// checks maps from symbol to the feature-detection symbols it
+	// refers to. "CPUID" and "XGETBV" stand for executing those
+	// instructions directly.
+	checks map[obj.SymID]map[string]bool
+	// unknown counts instructions that couldn't be decoded.
+	unknown int
+}
+
+func NewISAScan(fi *FileInfo) *ISAScan {
+	return &ISAScan{fi: fi}
+}
+
+type ISAReportJS struct {
+	Arch string
+	// Supported indicates that ISA detection is implemented for
+	// Arch. If not, the rest of the report is empty.
+	Supported bool
+	// Level is the highest x86-64 microarchitecture level of the
+	// extensions used, such as "x86-64-v3", or "" if not
+	// applicable.
+	Level string `json:",omitempty"`
+	// GOAMD64 is the GOAMD64 build setting, if recorded.
+	GOAMD64 string `json:",omitempty"`
+	// MinLevel is the microarchitecture level the object requires,
+	// or "" if it can't be determined. Code using extensions
+	// beyond this level must be guarded by run-time checks.
+	MinLevel string `json:",omitempty"`
+	// Features lists the extensions used, by level and then name.
+	Features []ISAFeatureJS
+	// Checks lists the symbols that perform run-time CPU feature
+	// detection, since code using an extension may be guarded by
+	// these checks rather than required.
+	Checks []ISACheckJS
+	// Unknown is the number of instructions that couldn't be
+	// decoded, which may hide additional extensions.
+	Unknown int
+}
+
+type ISAFeatureJS struct {
+	Name string
+	// Level is the x86-64 microarchitecture level that includes
+	// this extension, or 0.
+	Level int `json:",omitempty"`
+	Insts int
+	// Syms lists the symbols using this extension, most uses
+	// first, and More counts those omitted.
+	Syms []InstUserJS
+	More int `json:",omitempty"`
+}
+
+type ISACheckJS struct {
+	Name string
+	ID   obj.SymID
+	// Uses lists the feature-detection symbols or instructions
+	// this symbol uses.
+	Uses []string
+}
+
+// prepare scans code if it hasn't been already, reporting progress to
+// progress, which may be nil.
+func (s *ISAScan) prepare(progress progressFunc) {
+	s.once.Do(func() {
+		s.users = make(map[string]map[obj.SymID]int)
+		s.checks = make(map[obj.SymID]map[string]bool)
+		if !s.supported() {
+			return
+		}
+		check := func(id obj.SymID, what string) {
+			if s.checks[id] == nil {
+				s.checks[id] = make(map[string]bool)
+			}
+			s.checks[id][what] = true
+		}
+		s.fi.ForEachText(progress, func(id obj.SymID, sym obj.Sym, insts asm.Seq) {
+			for i := 0; i < insts.Len(); i++ {
+				inst := insts.Get(i)
+				disasm := inst.GoSyntax(func(addr uint64) (string, uint64) {
+					name, base := s.fi.SymTab.SymName(addr)
+					if isFeatureSym(name) {
+						check(id, name)
+					}
+					return name, base
+				})
+				if ext := inst.ISA(); ext != "" {
+					if s.users[ext] == nil {
+						s.users[ext] = make(map[obj.SymID]int)
+					}
+					s.users[ext][id]++
+				}
+				switch op, _ := parseAsm(disasm); {
+				case asm.IsData(op):
+					s.unknown++
+				case op == "CPUID", op == "XGETBV":
+					check(id, op)
+				}
+			}
+		})
+	})
+}
+
+func (s *ISAScan) supported() bool {
+	switch s.fi.Obj.Info().Arch {
+	case arch.AMD64, arch.I386:
+		return true
+	}
+	return false
+}
+
+// isFeatureSym reports whether name is a variable used for CPU
+// feature detection by the Go runtime or C runtime.
+func isFeatureSym(name string) bool {
+	switch {
+	case strings.HasPrefix(name, "runtime.x86Has"),
+		strings.HasPrefix(name, "internal/cpu.X86"),
+		strings.HasPrefix(name, "golang.org/x/sys/cpu.X86"),
+		strings.HasPrefix(name, "__cpu_model"),
+		strings.HasPrefix(name, "__cpu_features"):
+		return true
+	}
+	return false
+}
+
+// Report returns the extensions used by the object, listing up to n
+// symbols for each extension.
+func (s *ISAScan) Report(n int) *ISAReportJS {
+	s.prepare(nil)
+	a := s.fi.Obj.Info().Arch
+	out := &ISAReportJS{
+		Arch:      a.String(),
+		Supported: s.supported(),
+		Features:  []ISAFeatureJS{},
+		Checks:    []ISACheckJS{},
+		Unknown:   s.unknown,
+	}
+	syms := s.fi.SymTab.Syms()
+	level := 1
+	for ext, users := range s.users {
+		f := ISAFeatureJS{Name: ext, Syms: []InstUserJS{}}
+		if a == arch.AMD64 {
+			f.Level = asm.X86Level(ext)
+		}
+		for id, count := range users {
+			f.Insts += count
+			f.Syms = append(f.Syms, InstUserJS{syms[id].Name, id, count})
+		}
+		sort.Slice(f.Syms, func(i, j int) bool {
+			if f.Syms[i].Count != f.Syms[j].Count {
+				return f.Syms[i].Count > f.Syms[j].Count
+			}
+			return f.Syms[i].Name < f.Syms[j].Name
+		})
+		if len(f.Syms) > n {
+			f.Syms, f.More = f.Syms[:n], len(f.Syms)-n
+		}
+		if f.Level > level {
+			level = f.Level
+		}
+		out.Features = append(out.Features, f)
+	}
+	sort.Slice(out.Features, func(i, j int) bool {
+		fi, fj := &out.Features[i], &out.Features[j]
+		if fi.Level != fj.Level {
+			return fi.Level < fj.Level
+		}
+		return fi.Name < fj.Name
+	})
+	if a == arch.AMD64 {
+		out.Level = fmt.Sprintf("x86-64-v%d", level)
+		for _, set := range s.fi.Fingerprint().Settings {
+			if set.Key == "GOAMD64" {
+				out.GOAMD64 = set.Value
+			}
+		}
+		// The Go compiler only uses extensions beyond GOAMD64
+		// behind feature checks. Otherwise, without any feature
+		// checks, everything used is required.
+		if out.GOAMD64 != "" {
+			out.MinLevel = "x86-64-" + out.GOAMD64
+		} else if len(s.checks) == 0 {
+			out.MinLevel = out.Level
+		}
+	}
+
+	for id, uses := range s.checks {
+		c := ISACheckJS{Name: syms[id].Name, ID: id}
+		for use := range uses {
+			c.Uses = append(c.Uses, use)
+		}
+		sort.Strings(c.Uses)
+		out.Checks = append(out.Checks, c)
+	}
+	sort.Slice(out.Checks, func(i, j int) bool {
+		return out.Checks[i].Name < out.Checks[j].Name
+	})
+	return out
+}
+
+// httpISA serves the ISA extension report as JSON, listing up to "n"
+// symbols per extension.
+func (s *state) httpISA(w http.ResponseWriter, r *http.Request) {
+	n, err := strconv.Atoi(r.FormValue("n"))
+	if err != nil || n <= 0 {
+		n = 20
+	}
+	serveJSON(w, s.isa.Report(n))
+}
@@ -0,0 +1,86 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+"use strict";
+
+// ISAView reports the instruction set extensions the binary uses,
+// the minimum CPU it needs, and the code that detects CPU features
+// at run time.
+class ISAView {
+    constructor(container) {
+        const self = this;
+        const details = $("<details>").addClass("isaview").appendTo(container);
+        $("<summary>").text("Required CPU features").appendTo(details);
+        this._div = $("<div>").appendTo(details);
+
+        // Scanning disassembles everything, so only do it when
+        // opened.
+        details.one("toggle", () => { self._load(); });
+    }
+
+    _load() {
+        const div = this._div.text("Scanning…");
+        const onProgress = (done, total) => {
+            div.text("Scanning… " + done + "/" + total + " symbols");
+        };
+        runJob("isa", {}, onProgress).done((data) => {
+            div.empty();
+            if (!data.Supported) {
+                div.text("CPU feature detection is not supported for " + data.Arch + ".");
+                return;
+            }
+            if (data.Level) {
+                const min = $("<div>").addClass("isa-level").appendTo(div);
+                if (data.MinLevel)
+                    min.text("Minimum CPU: " + data.MinLevel);
+                else
+                    min.text("Minimum CPU: at most " + data.Level);
+                if (data.GOAMD64)
+                    min.append($("<span>").addClass("sv-note").text(" (built with GOAMD64=" + data.GOAMD64 + ")"));
+                if (data.MinLevel != data.Level)
+                    $("<div>").addClass("sv-note").
+                        text("Uses extensions up to " + data.Level + " behind run-time feature checks").appendTo(div);
+            }
+            if (data.Features.length == 0)
+                $("<div>").text("No extensions beyond the baseline.").appendTo(div);
+            for (let f of data.Features)
+                this._feature(div, f);
+            if (data.Unknown > 0)
+                $("<div>").addClass("sv-note").
+                    text(data.Unknown + " undecodable instructions may use other extensions").appendTo(div);
+
+            if (data.Checks.length > 0) {
+                $("<h4>").text("Run-time feature checks").appendTo(div);
+                $("<div>").addClass("sv-note").
+                    text("Extensions used only behind these checks aren't required.").appendTo(div);
+                const table = $("<table>").appendTo(div);
+                for (let c of data.Checks)
+                    $("<tr>").
+                        append($("<td>").append($("<a>").attr("href", symURL(c.Name, c.ID)).text(c.Name))).
+                        append($("<td>").addClass("isa-uses").text(c.Uses.join(", "))).
+                        appendTo(table);
+            }
+        }).fail((err) => {
+            showError("CPU features", err, div.empty());
+        });
+    }
+
+    // _feature adds a collapsible list of the symbols using
+    // extension f to div.
+    _feature(div, f) {
+        const details = $("<details>").appendTo(div);
+        const summary = $("<summary>").text(f.Name + " ").appendTo(details);
+        if (f.Level)
+            summary.append($("<span>").addClass("isa-badge").text("v" + f.Level));
+        summary.append(" " + f.Insts + " instructions in " + (f.Syms.length + (f.More || 0)) + " symbols");
+        const table = $("<table>").appendTo(details);
+        for (let s of f.Syms)
+            $("<tr>").
+                append($("<td>").addClass("pos").text(s.Count)).
+                append($("<td>").append($("<a>").attr("href", symURL(s.Name, s.ID)).text(s.Name))).
+                appendTo(table);
+        if (f.More)
+            $("<div>").addClass("sv-note").text("(" + f.More + " more symbols)").appendTo(details);
+    }
+}
@@ -0,0 +1,247 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// progressFunc reports that done of total units of work are
+// complete.
+type progressFunc func(done, total int)
+
+// jobs is the table of running and recently finished jobs.
+//
+// Jobs run analyses that may take too long for a single request.
+// Their progress is sent to pages as "job" events on /events, and
+// their results can be fetched from /jobs/<id> when they finish.
+var jobs jobTable
+
+// maxFinishedJobs is the number of finished jobs whose results are
+// retained.
+const maxFinishedJobs = 32
+
+type jobTable struct {
+	mu       sync.Mutex
+	next     int
+	jobs     map[int]*job
+	finished []int // IDs of finished jobs, oldest first
+}
+
+type job struct {
+	mu          sync.Mutex
+	status      JobJS
+	result      interface{}
+	lastPublish time.Time
+}
+
+// JobJS is the status of a job.
+type JobJS struct {
+	ID       int
+	Kind     string
+	Done     int
+	Total    int
+	Finished bool
+	Error    string `json:",omitempty"`
+	// Result is the result of a finished job. It's only included
+	// when fetching the job.
+	Result interface{} `json:",omitempty"`
+}
+
+// start runs fn in a new job and returns the job's initial status.
+func (t *jobTable) start(kind string, fn func(progress progressFunc) (interface{}, error)) JobJS {
+	t.mu.Lock()
+	if t.jobs == nil {
+		t.jobs = make(map[int]*job)
+	}
+	t.next++
+	j := &job{status: JobJS{ID: t.next, Kind: kind}}
+	t.jobs[j.status.ID] = j
+	t.mu.Unlock()
+	status := j.status
+
+	go func() {
+		result, err := fn(j.progress)
+		j.mu.Lock()
+		j.result = result
+		j.status.Finished = true
+		if err != nil {
+			j.status.Error = err.Error()
+		}
+		j.mu.Unlock()
+		j.publish()
+		t.retire(status.ID)
+	}()
+	return status
+}
+
+// retire records that job id finished and discards the oldest
+// finished jobs.
+func (t *jobTable) retire(id int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.finished = append(t.finished, id)
+	for len(t.finished) > maxFinishedJobs {
+		delete(t.jobs, t.finished[0])
+		t.finished = t.finished[1:]
+	}
+}
+
+func (t *jobTable) get(id int) *job {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.jobs[id]
+}
+
+// progress updates the job's progress and publishes it, limiting
+// the rate of events.
+func (j *job) progress(done, total int) {
+	j.mu.Lock()
+	j.status.Done, j.status.Total = done, total
+	now := time.Now()
+	publish := now.Sub(j.lastPublish) >= 100*time.Millisecond || done == total
+	if publish {
+		j.lastPublish = now
+	}
+	j.mu.Unlock()
+	if publish {
+		j.publish()
+	}
+}
+
+func (j *job) publish() {
+	j.mu.Lock()
+	buf, err := json.Marshal(j.status)
+	j.mu.Unlock()
+	if err == nil {
+		events.publish("job", string(buf))
+	}
+}
+
+// httpJobs starts a job of the kind given by the "kind" query
+// parameter and serves its initial status as JSON. Other parameters
+// depend on the kind of job:
+//
+//	nosplit:  n
+//	checks:   n
+//	allocs:   n
+//	consts:   v
+//	generics: n
+//	scan:     mode, q
+func (s *state) httpJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "starting a job requires POST", http.StatusMethodNotAllowed)
+		return
+	}
+	n, err := strconv.Atoi(r.FormValue("n"))
+	if err != nil || n <= 0 {
+		n = 100
+	}
+	var fn func(progress progressFunc) (interface{}, error)
+	switch kind := r.FormValue("kind"); kind {
+	case "nosplit":
+		fn = func(progress progressFunc) (interface{}, error) {
+			s.stack.prepare(progress)
+			return s.stack.NosplitReport(n), nil
+		}
+	case "checks":
+		fn = func(progress progressFunc) (interface{}, error) {
+			s.checks.prepare(progress)
+			return s.checks.Report(n), nil
+		}
+	case "allocs":
+		fn = func(progress progressFunc) (interface{}, error) {
+			s.allocs.prepare(progress)
+			return s.allocs.Report(n), nil
+		}
+	case "consts":
+		v, ok := parseImm(r.FormValue("v"))
+		if !ok {
+			http.Error(w, fmt.Sprintf("bad value %q", r.FormValue("v")), http.StatusBadRequest)
+			return
+		}
+		fn = func(progress progressFunc) (interface{}, error) {
+			s.consts.prepare(progress)
+			return s.consts.Find(v), nil
+		}
+	case "insthist":
+		pkg := r.FormValue("pkg")
+		fn = func(progress progressFunc) (interface{}, error) {
+			s.instHist.prepare(progress)
+			return s.instHist.Histogram(pkg), nil
+		}
+	case "isa":
+		fn = func(progress progressFunc) (interface{}, error) {
+			s.isa.prepare(progress)
+			return s.isa.Report(n), nil
+		}
+	case "generics":
+		fn = func(progress progressFunc) (interface{}, error) {
+			s.generics.prepare(progress)
+			return s.generics.Report(n), nil
+		}
+	case "builddiff":
+		if s.buildDiff == nil {
+			http.Error(w, "no previous build", http.StatusNotFound)
+			return
+		}
+		fn = func(progress progressFunc) (interface{}, error) {
+			s.buildDiff.prepare(progress)
+			return s.buildDiff.Summary(), nil
+		}
+	case "scripts":
+		fn = func(progress progressFunc) (interface{}, error) {
+			s.scripts.prepare(progress)
+			return s.scripts.Results(), nil
+		}
+	case "scan":
+		mode, q := r.FormValue("mode"), r.FormValue("q")
+		// Check the query before starting the job.
+		if _, err := parseSearch(mode, q); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fn = func(progress progressFunc) (interface{}, error) {
+			return s.search.Search(-1, "", mode, q, progress)
+		}
+	default:
+		http.Error(w, fmt.Sprintf("unknown job kind %q", kind), http.StatusBadRequest)
+		return
+	}
+	// Keep s open until the job finishes.
+	s.retain()
+	serveJSON(w, jobs.start(r.FormValue("kind"), func(progress progressFunc) (interface{}, error) {
+		defer s.release()
+		return fn(progress)
+	}))
+}
+
+// httpJob serves the status of job /jobs/<id> as JSON, including its
+// result if it has finished.
+func (s *state) httpJob(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/jobs/"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	j := jobs.get(id)
+	if j == nil {
+		http.Error(w, "no such job", http.StatusNotFound)
+		return
+	}
+	j.mu.Lock()
+	status := j.status
+	if status.Finished {
+		status.Result = j.result
+	}
+	j.mu.Unlock()
+	serveJSON(w, status)
+}
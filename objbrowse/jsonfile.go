@@ -0,0 +1,96 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// A jsonFile is the file a store, such as the settings or notebooks,
+// persists in as JSON. The store rewrites the whole file on each
+// change, holding its own lock around jsonFile's methods.
+type jsonFile struct {
+	// what describes the contents in log messages, such as
+	// "settings".
+	what string
+	// path is the file, or "" to keep the contents only in
+	// memory.
+	path string
+	// unsaved indicates the last save failed, so the file is
+	// out of date.
+	unsaved bool
+}
+
+// configPath returns the default path of the file called name in
+// objbrowse's configuration directory, or "" if there's no such
+// directory.
+func configPath(name string) string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "objbrowse", name)
+}
+
+// load reads the file into v, which later saves will write back. A
+// missing file is not an error and leaves v unchanged.
+func (f *jsonFile) load(v interface{}) error {
+	if f.path == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s: %v", f.path, err)
+	}
+	return nil
+}
+
+// save writes v to the file. Changes still apply in memory if they
+// can't be saved, so this just complains.
+func (f *jsonFile) save(v interface{}) {
+	err := f.write(v)
+	f.unsaved = err != nil
+	if err != nil {
+		logger.Error("saving "+f.what, "err", err)
+	}
+}
+
+// flush retries saving v if the last save failed. Saves are otherwise
+// synchronous, so once the store's lock is held, the file is up to
+// date.
+func (f *jsonFile) flush(v interface{}) {
+	if f.unsaved {
+		f.save(v)
+	}
+}
+
+func (f *jsonFile) write(v interface{}) error {
+	if f.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(f.path), 0700); err != nil {
+		return err
+	}
+	// Write a new file and rename it so a crash can't leave a
+	// partial file.
+	tmp := f.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.path)
+}
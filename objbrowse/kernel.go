@@ -0,0 +1,298 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aclements/objbrowse/obj"
+)
+
+// KernelTables decodes the tables a linked Linux kernel keeps of
+// instructions it treats specially: exception fixups, alternatives
+// and paravirt patch sites, static branches, and BUG() sites.
+type KernelTables struct {
+	fi *FileInfo
+
+	once   sync.Once
+	sites  []kernelSite // Sorted by pc
+	errors []string
+}
+
+// A kernelSite is an instruction recorded in a kernel table.
+type kernelSite struct {
+	pc   uint64
+	text string
+	// link is the page of the symbol the site refers to, if any.
+	link string
+}
+
+func NewKernelTables(fi *FileInfo) *KernelTables {
+	return &KernelTables{fi: fi}
+}
+
+// A kernelTable is a table section and the layouts its entries have
+// had across kernel versions and architectures.
+type kernelTable struct {
+	sect    string
+	layouts []kernelLayout
+}
+
+// A kernelLayout decodes one layout of a kernel table entry.
+type kernelLayout struct {
+	size int
+	// arch restricts the layout to a GOARCH, if not "".
+	arch string
+	// decode decodes entry e, returning the address of the
+	// instruction it describes and its description.
+	decode func(t *KernelTables, e kernelEntry) (pc uint64, text, link string)
+}
+
+// Layouts are listed newest first, since the newest layout wins
+// ties. Fields relative to their own address are "rel".
+var kernelTableLayouts = []kernelTable{
+	{"__ex_table", []kernelLayout{
+		// struct exception_table_entry { int insn, fixup; short type, data; }
+		{12, "arm64", func(t *KernelTables, e kernelEntry) (uint64, string, string) {
+			return e.rel(0), fmt.Sprintf("exception fixup at %s, type %d", t.name(e.rel(4)), e.u16(8)), t.link(e.rel(4))
+		}},
+		// struct exception_table_entry { int insn, fixup, data; },
+		// or, before Linux 5.16, with a relative handler in place
+		// of data.
+		{12, "", func(t *KernelTables, e kernelEntry) (uint64, string, string) {
+			text := "exception fixup at " + t.name(e.rel(4))
+			if h := t.name(e.rel(8)); strings.HasPrefix(h, "ex_handler_") {
+				text += ", handler " + h
+			} else {
+				text += fmt.Sprintf(", type %d", e.u32(8)&0xff)
+			}
+			return e.rel(0), text, t.link(e.rel(4))
+		}},
+		// struct exception_table_entry { int insn, fixup; }
+		{8, "", func(t *KernelTables, e kernelEntry) (uint64, string, string) {
+			return e.rel(0), "exception fixup at " + t.name(e.rel(4)), t.link(e.rel(4))
+		}},
+	}},
+	{".altinstructions", []kernelLayout{
+		// struct alt_instr { s32 instr_offset, repl_offset;
+		// u32 ft_flags; u8 instrlen, replacementlen; }
+		{14, "amd64", func(t *KernelTables, e kernelEntry) (uint64, string, string) {
+			ft := e.u32(8)
+			return e.rel(0), altText(t, e.rel(4), ft&0xffff, ft>>16, e.u8(12), e.u8(13)), ""
+		}},
+		// struct alt_instr { s32 instr_offset, repl_offset;
+		// u16 cpuid; u8 instrlen, replacementlen; }, which
+		// arm64 also uses.
+		{12, "", func(t *KernelTables, e kernelEntry) (uint64, string, string) {
+			return e.rel(0), altText(t, e.rel(4), uint32(e.u16(8)), 0, e.u8(10), e.u8(11)), ""
+		}},
+		// Before Linux 5.13, with a trailing padlen.
+		{13, "amd64", func(t *KernelTables, e kernelEntry) (uint64, string, string) {
+			return e.rel(0), altText(t, e.rel(4), uint32(e.u16(8)), 0, e.u8(10), e.u8(11)), ""
+		}},
+	}},
+	{".parainstructions", []kernelLayout{
+		// struct paravirt_patch_site { s32 instr_offset; u8 type, len; }
+		{6, "amd64", func(t *KernelTables, e kernelEntry) (uint64, string, string) {
+			return e.rel(0), fmt.Sprintf("paravirt patch site, %d bytes, op %d", e.u8(5), e.u8(4)), ""
+		}},
+		// struct paravirt_patch_site { u8 *instr; u8 type, len; }
+		{16, "amd64", func(t *KernelTables, e kernelEntry) (uint64, string, string) {
+			return e.u64(0), fmt.Sprintf("paravirt patch site, %d bytes, op %d", e.u8(9), e.u8(8)), ""
+		}},
+	}},
+	{"__jump_table", []kernelLayout{
+		// struct jump_entry { s32 code, target; long key; }
+		{16, "", func(t *KernelTables, e kernelEntry) (uint64, string, string) {
+			key := e.rel64(8) &^ 3
+			return e.rel(0), jumpText(t, e.rel(4), key), t.link(key)
+		}},
+		// struct jump_entry { u64 code, target, key; }
+		{24, "", func(t *KernelTables, e kernelEntry) (uint64, string, string) {
+			key := e.u64(16) &^ 3
+			return e.u64(0), jumpText(t, e.u64(8), key), t.link(key)
+		}},
+	}},
+	{"__bug_table", []kernelLayout{
+		// struct bug_entry { s32 bug_addr_disp, file_disp;
+		// u16 line, flags; } with CONFIG_DEBUG_BUGVERBOSE.
+		{12, "", func(t *KernelTables, e kernelEntry) (uint64, string, string) {
+			return e.rel(0), bugText(e.u16(10)) + fmt.Sprintf(" at %s:%d", t.cString(e.rel(4)), e.u16(8)), ""
+		}},
+		// struct bug_entry { s32 bug_addr_disp; u16 flags; }
+		{8, "", func(t *KernelTables, e kernelEntry) (uint64, string, string) {
+			return e.rel(0), bugText(e.u16(4)), ""
+		}},
+	}},
+}
+
+// A kernelEntry is an entry of a kernel table at address addr.
+type kernelEntry struct {
+	p     []byte
+	addr  uint64
+	order binary.ByteOrder
+}
+
+func (e kernelEntry) u8(off int) uint8   { return e.p[off] }
+func (e kernelEntry) u16(off int) uint16 { return e.order.Uint16(e.p[off:]) }
+func (e kernelEntry) u32(off int) uint32 { return e.order.Uint32(e.p[off:]) }
+func (e kernelEntry) u64(off int) uint64 { return e.order.Uint64(e.p[off:]) }
+func (e kernelEntry) rel(off int) uint64 {
+	return e.addr + uint64(off) + uint64(int64(int32(e.u32(off))))
+}
+func (e kernelEntry) rel64(off int) uint64 { return e.addr + uint64(off) + e.u64(off) }
+
+func altText(t *KernelTables, repl uint64, feature, flags uint32, instrLen, replLen uint8) string {
+	const altFlagNot = 1 << 0
+	cond := "has"
+	if flags&altFlagNot != 0 {
+		cond = "lacks"
+	}
+	return fmt.Sprintf("alternative: %d bytes replaced by %d bytes at %s if CPU %s feature %d*32+%d",
+		instrLen, replLen, t.name(repl), cond, feature/32, feature%32)
+}
+
+func jumpText(t *KernelTables, target, key uint64) string {
+	return fmt.Sprintf("static branch on %s, target %s", t.name(key), t.name(target))
+}
+
+func bugText(flags uint16) string {
+	const bugflagWarning = 1 << 0
+	if flags&bugflagWarning != 0 {
+		return "WARN()"
+	}
+	return "BUG()"
+}
+
+// name symbolizes addr as "sym+off", or returns it in hex if it isn't
+// in a symbol.
+func (t *KernelTables) name(addr uint64) string {
+	p := t.fi.ResolvePtr(addr, 0)
+	switch {
+	case p.Sym == "":
+		return fmt.Sprintf("%#x", addr)
+	case p.Off == 0:
+		return p.Sym
+	}
+	return fmt.Sprintf("%s+%#x", p.Sym, p.Off)
+}
+
+// link returns the page of the symbol containing addr, if any.
+func (t *KernelTables) link(addr uint64) string {
+	if p := t.fi.ResolvePtr(addr, 0); p.Sym != "" {
+		return "/s/" + p.Sym
+	}
+	return ""
+}
+
+// cString returns the NUL-terminated string at addr.
+func (t *KernelTables) cString(addr uint64) string {
+	data, err := t.fi.Obj.Data(addr, 256)
+	if err != nil {
+		return "?"
+	}
+	p := data.P
+	if i := bytes.IndexByte(p, 0); i >= 0 {
+		p = p[:i]
+	}
+	return string(p)
+}
+
+// prepare decodes the tables if they haven't been already.
+func (t *KernelTables) prepare() {
+	t.once.Do(t.decodeAll)
+}
+
+func (t *KernelTables) decodeAll() {
+	info := t.fi.Obj.Info()
+	if info.Arch == nil || info.Relocatable {
+		// Table entries in modules are only resolved by
+		// relocations.
+		return
+	}
+	sects := t.fi.Obj.Sections()
+	inText := func(addr uint64) bool {
+		for _, sect := range sects {
+			if sect.Flags&obj.SectExec != 0 && sect.Addr <= addr && addr-sect.Addr < sect.Size {
+				return true
+			}
+		}
+		return false
+	}
+	for _, table := range kernelTableLayouts {
+		for i, sect := range sects {
+			if sect.Name != table.sect || sect.Zero || sect.Size == 0 {
+				continue
+			}
+			data, err := t.fi.Obj.SectionData(i)
+			if err != nil {
+				t.errors = append(t.errors, fmt.Sprintf("%s: %v", sect.Name, err))
+				continue
+			}
+			t.decodeTable(table, sect, data.P, info.Arch.GoArch, info.Arch.ByteOrder, inText)
+		}
+	}
+	sort.SliceStable(t.sites, func(i, j int) bool { return t.sites[i].pc < t.sites[j].pc })
+}
+
+// decodeTable decodes the entries of a table section. The layout of
+// the entries isn't recorded anywhere outside DWARF, so this picks
+// the layout that places the most entries in executable code.
+func (t *KernelTables) decodeTable(table kernelTable, sect obj.Section, p []byte, goarch string, order binary.ByteOrder, inText func(uint64) bool) {
+	var best []kernelSite
+	bestScore := 0
+	for _, l := range table.layouts {
+		if l.arch != "" && l.arch != goarch || len(p)%l.size != 0 {
+			continue
+		}
+		var sites []kernelSite
+		score := 0
+		for off := 0; off < len(p); off += l.size {
+			e := kernelEntry{p[off : off+l.size], sect.Addr + uint64(off), order}
+			pc, text, link := l.decode(t, e)
+			if inText(pc) {
+				score++
+				sites = append(sites, kernelSite{pc, text, link})
+			}
+		}
+		if score > bestScore {
+			best, bestScore = sites, score
+		}
+	}
+	if best == nil {
+		t.errors = append(t.errors, fmt.Sprintf("%s: unknown entry layout", sect.Name))
+		return
+	}
+	t.sites = append(t.sites, best...)
+}
+
+// Sites returns the sites in [lo, hi).
+func (t *KernelTables) Sites(lo, hi uint64) []kernelSite {
+	t.prepare()
+	i := sort.Search(len(t.sites), func(i int) bool { return t.sites[i].pc >= lo })
+	j := i
+	for j < len(t.sites) && t.sites[j].pc < hi {
+		j++
+	}
+	return t.sites[i:j]
+}
+
+// annotateKernel notes the instructions recorded in the Linux kernel's
+// exception, alternatives, paravirt, static branch, and BUG tables.
+func annotateKernel(f *annotateFunc) error {
+	t := f.s.kernel
+	for _, site := range t.Sites(f.sym.Value, f.sym.Value+f.sym.Size) {
+		f.add(site.pc, -1, site.text, site.link)
+	}
+	if len(t.errors) > 0 {
+		return fmt.Errorf("%s", strings.Join(t.errors, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/aclements/objbrowse/obj"
+)
+
+// LineTableView shows the raw DWARF line table rows for a symbol.
+type LineTableView struct {
+	fi *FileInfo
+}
+
+func NewLineTableView(fi *FileInfo) *LineTableView {
+	return &LineTableView{fi}
+}
+
+type LineTableViewJS struct {
+	Rows []LineTableRowJS
+}
+
+type LineTableRowJS struct {
+	PC            AddrJS
+	File          string
+	Line          int
+	Column        int
+	IsStmt        bool `json:",omitempty"`
+	BasicBlock    bool `json:",omitempty"`
+	PrologueEnd   bool `json:",omitempty"`
+	EpilogueBegin bool `json:",omitempty"`
+	EndSequence   bool `json:",omitempty"`
+	Discriminator int  `json:",omitempty"`
+}
+
+func (v *LineTableView) DecodeSym(sym obj.Sym) (interface{}, error) {
+	if sym.Kind != obj.SymText {
+		return nil, nil
+	}
+
+	lines, err := v.fi.LineTable(sym.Value, sym.Value+sym.Size)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []LineTableRowJS
+	for _, line := range lines {
+		var file string
+		if line.File != nil {
+			file = line.File.Name
+		}
+		rows = append(rows, LineTableRowJS{
+			PC:            AddrJS(line.Address),
+			File:          file,
+			Line:          line.Line,
+			Column:        line.Column,
+			IsStmt:        line.IsStmt,
+			BasicBlock:    line.BasicBlock,
+			PrologueEnd:   line.PrologueEnd,
+			EpilogueBegin: line.EpilogueBegin,
+			EndSequence:   line.EndSequence,
+			Discriminator: line.Discriminator,
+		})
+	}
+
+	return LineTableViewJS{rows}, nil
+}
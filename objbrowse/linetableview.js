@@ -0,0 +1,106 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+"use strict";
+
+// LineTableView shows the raw DWARF line table rows for a symbol.
+class LineTableView {
+    constructor(data, container) {
+        this._container = container;
+        const view = this;
+        const rows = data.Rows;
+
+        // Compute the PC range of each row. A row covers PCs up to
+        // the next row with a higher PC, in line table order.
+        this._rows = [];
+        for (let i = 0; i < rows.length; i++) {
+            const start = new AddrJS(rows[i].PC);
+            let end = start;
+            for (let j = i + 1; j < rows.length; j++) {
+                const pc = new AddrJS(rows[j].PC);
+                if (pc.compare(start) > 0) {
+                    end = pc;
+                    break;
+                }
+            }
+            this._rows.push({row: rows[i], i: i, start: start, end: end, tr: null});
+        }
+
+        this._table = $('<table class="linetable">').appendTo(container);
+        this._sortCol = "i";
+        this._populate();
+    }
+
+    _populate() {
+        const view = this;
+        const t = this._table.empty();
+        const cols = [
+            ["PC", "i"], ["File", "File"], ["Line", "Line"], ["Col", "Column"], ["Flags", null],
+        ];
+        const header = $("<thead>").appendTo(t);
+        for (let [label, key] of cols) {
+            const th = $("<th>").text(label).appendTo(header);
+            if (key === null)
+                continue;
+            if (key == this._sortCol)
+                th.text(label + " ↓");
+            th.css({cursor: "pointer"}).click(() => {
+                view._sortCol = key;
+                view._populate();
+            });
+        }
+
+        // Sort rows. Ties keep line table order.
+        const key = this._sortCol;
+        const sorted = this._rows.slice();
+        sorted.sort((a, b) => {
+            if (key != "i") {
+                const x = a.row[key], y = b.row[key];
+                if (x < y) return -1;
+                if (x > y) return 1;
+            }
+            return a.i - b.i;
+        });
+
+        for (let r of sorted) {
+            const row = r.row;
+            const flags = [];
+            if (row.IsStmt) flags.push("stmt");
+            if (row.BasicBlock) flags.push("bb");
+            if (row.PrologueEnd) flags.push("prologue_end");
+            if (row.EpilogueBegin) flags.push("epilogue_begin");
+            if (row.EndSequence) flags.push("end_sequence");
+            if (row.Discriminator) flags.push("disc=" + row.Discriminator);
+            const tr = $("<tr>").append(
+                $("<td>").addClass("pos").text("0x" + row.PC),
+                $("<td>").text(row.File),
+                $("<td>").addClass("pos").text(row.Line),
+                $("<td>").addClass("pos").text(row.Column),
+                $("<td>").text(flags.join(" ")),
+            ).appendTo(t);
+            tr.click(() => {
+                highlightRanges([{start: r.start, end: r.end}], view);
+            });
+            r.tr = tr;
+        }
+    }
+
+    highlightRanges(ranges, scroll) {
+        $(".highlight", this._table).removeClass("highlight");
+        let first = true;
+        for (let r of this._rows) {
+            if (r.start.compare(r.end) == 0)
+                continue;
+            for (let h of ranges) {
+                if (IntervalMap.overlap(r, h)) {
+                    r.tr.addClass("highlight");
+                    if (first && scroll)
+                        scrollTo(this._container, r.tr);
+                    first = false;
+                    break;
+                }
+            }
+        }
+    }
+}
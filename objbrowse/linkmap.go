@@ -0,0 +1,226 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aclements/objbrowse/internal/linkmap"
+	"github.com/aclements/objbrowse/obj"
+)
+
+// maxLinkMapItems limits the length of each list of discrepancies.
+const maxLinkMapItems = 500
+
+// LinkMapJS is the result of cross-checking a linker map against the
+// object's sections and symbols.
+type LinkMapJS struct {
+	Path   string
+	Format string
+	// Sections, Inputs, and Symbols count the entries in the map.
+	Sections, Inputs, Symbols int
+	// Matched is the number of map symbols found at the same
+	// address in the object.
+	Matched int
+
+	// SectionDiffs are output sections whose address or size
+	// differ from the object's, or that the object lacks.
+	SectionDiffs []LinkMapSectJS
+	// Missing are map symbols the object doesn't define.
+	Missing []LinkMapSymJS
+	// Moved are map symbols the object defines at a different
+	// address.
+	Moved []LinkMapSymJS
+	// Unlisted are object symbols the map doesn't list.
+	Unlisted []LinkMapSymJS
+	// Discarded are input sections the linker removed, largest
+	// first. Empty sections are left out.
+	Discarded     []LinkMapInputJS
+	DiscardedSize uint64
+
+	// Truncated is the number of entries left out of the lists
+	// above because of their length limit.
+	Truncated int `json:",omitempty"`
+}
+
+type LinkMapSectJS struct {
+	Name             string
+	MapAddr, MapSize AddrJS
+	// Addr and Size are from the object, if it has the section.
+	Addr, Size AddrJS
+	Missing    bool `json:",omitempty"`
+}
+
+type LinkMapSymJS struct {
+	Name string
+	// MapAddr is the symbol's address in the map, if it's in
+	// the map.
+	MapAddr AddrJS `json:",omitempty"`
+	// Addr is the symbol's address in the object, if it's in the
+	// object.
+	Addr AddrJS `json:",omitempty"`
+	// File and Section are the input file and section that
+	// define the symbol, according to the map.
+	File    string `json:",omitempty"`
+	Section string `json:",omitempty"`
+}
+
+type LinkMapInputJS struct {
+	Section string
+	File    string
+	Size    uint64
+}
+
+// loadLinkMap reads the linker map at path and compares it with fi.
+func loadLinkMap(fi *FileInfo, path string) (*LinkMapJS, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	m, err := linkmap.Parse(f)
+	f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return compareLinkMap(fi, m, path), nil
+}
+
+// compareLinkMap cross-checks map m against fi.
+func compareLinkMap(fi *FileInfo, m *linkmap.Map, path string) *LinkMapJS {
+	out := &LinkMapJS{
+		Path:     path,
+		Format:   m.Format,
+		Sections: len(m.Sections),
+		Inputs:   len(m.Inputs),
+		Symbols:  len(m.Symbols),
+	}
+	// fits reports whether a list of length n has room for
+	// another entry, and counts the entry as truncated if not.
+	fits := func(n int) bool {
+		if n >= maxLinkMapItems {
+			out.Truncated++
+			return false
+		}
+		return true
+	}
+
+	// Sections.
+	sects := make(map[string]obj.Section)
+	for _, s := range fi.Obj.Sections() {
+		sects[s.Name] = s
+	}
+	for _, ms := range m.Sections {
+		if ms.Size == 0 {
+			continue
+		}
+		s, ok := sects[ms.Name]
+		if ok && s.Addr == ms.Addr && s.Size == ms.Size {
+			continue
+		}
+		if fits(len(out.SectionDiffs)) {
+			out.SectionDiffs = append(out.SectionDiffs, LinkMapSectJS{
+				Name:    ms.Name,
+				MapAddr: AddrJS(ms.Addr), MapSize: AddrJS(ms.Size),
+				Addr: AddrJS(s.Addr), Size: AddrJS(s.Size),
+				Missing: !ok,
+			})
+		}
+	}
+
+	// Map symbols.
+	syms := fi.SymTab.Syms()
+	inMap := make(map[string]bool)
+	for _, ms := range m.Symbols {
+		// Versioned names like "puts@@GLIBC_2.2.5" are
+		// references to dynamic symbols through the PLT.
+		if strings.Contains(ms.Name, "@") {
+			continue
+		}
+		inMap[ms.Name] = true
+		js := LinkMapSymJS{Name: ms.Name, MapAddr: AddrJS(ms.Addr)}
+		if ms.Input >= 0 {
+			js.File, js.Section = m.Inputs[ms.Input].File, m.Inputs[ms.Input].Section
+		}
+		var def *obj.Sym
+		found := false
+		for _, id := range fi.SymTab.Name(ms.Name) {
+			sym := &syms[id]
+			if sym.Kind == obj.SymUndef {
+				continue
+			}
+			if sym.Value == ms.Addr {
+				found = true
+				break
+			}
+			if def == nil {
+				def = sym
+			}
+		}
+		switch {
+		case found:
+			out.Matched++
+		case def == nil:
+			if fits(len(out.Missing)) {
+				out.Missing = append(out.Missing, js)
+			}
+		default:
+			js.Addr = AddrJS(def.Value)
+			if fits(len(out.Moved)) {
+				out.Moved = append(out.Moved, js)
+			}
+		}
+	}
+
+	// Object symbols the map should list. GNU maps only list
+	// global symbols.
+	for _, sym := range syms {
+		if inMap[sym.Name] || sym.Synthetic || sym.Dynamic || !sym.HasAddr || sym.Size == 0 {
+			continue
+		}
+		if m.Format == "gnu" && sym.Local {
+			continue
+		}
+		switch sym.Kind {
+		case obj.SymText, obj.SymData, obj.SymROData, obj.SymBSS:
+		default:
+			continue
+		}
+		if fits(len(out.Unlisted)) {
+			out.Unlisted = append(out.Unlisted, LinkMapSymJS{Name: sym.Name, Addr: AddrJS(sym.Value)})
+		}
+	}
+
+	// Discarded sections.
+	var discarded []LinkMapInputJS
+	for _, in := range m.Discarded {
+		if in.Size == 0 {
+			continue
+		}
+		discarded = append(discarded, LinkMapInputJS{in.Section, in.File, in.Size})
+		out.DiscardedSize += in.Size
+	}
+	sort.SliceStable(discarded, func(i, j int) bool {
+		return discarded[i].Size > discarded[j].Size
+	})
+	if len(discarded) > maxLinkMapItems {
+		out.Truncated += len(discarded) - maxLinkMapItems
+		discarded = discarded[:maxLinkMapItems]
+	}
+	out.Discarded = discarded
+	return out
+}
+
+// httpLinkMap serves the linker map comparison as JSON.
+func (s *state) httpLinkMap(w http.ResponseWriter, r *http.Request) {
+	if s.linkMap == nil {
+		http.Error(w, "no linker map; use -linkmap", http.StatusNotFound)
+		return
+	}
+	serveJSON(w, s.linkMap)
+}
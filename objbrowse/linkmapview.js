@@ -0,0 +1,81 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+"use strict";
+
+// LinkMapView shows where the linker map given by -linkmap disagrees
+// with the object, and which input sections the linker discarded.
+class LinkMapView {
+    constructor(container) {
+        $(container).addClass("linkmapview");
+        $("<h2>").text("Linker map").appendTo(container);
+        const body = $("<div>").text("Loading linker map…").appendTo(container);
+
+        $.getJSON("/linkmap").done((lm) => {
+            body.empty();
+            $("<div>").addClass("lm-summary").text(
+                lm.Path + " (" + lm.Format + "): " + lm.Sections + " sections, " +
+                    lm.Symbols + " symbols, " + lm.Matched + " matched").appendTo(body);
+            if (lm.Truncated)
+                $("<div>").addClass("sv-note").text(lm.Truncated + " more discrepancies not shown").appendTo(body);
+
+            const hex = (a) => "0x" + a;
+            this._list(body, "Sections that differ", lm.SectionDiffs, ["Section", "Map", "Object"], (s) => [
+                s.Name,
+                hex(s.MapAddr) + " size " + hex(s.MapSize),
+                s.Missing ? "missing" : hex(s.Addr) + " size " + hex(s.Size),
+            ]);
+            this._list(body, "Symbols missing from the object", lm.Missing, ["Symbol", "Map", "Defined in"], (s) => [
+                s.Name, hex(s.MapAddr), this._where(s),
+            ]);
+            this._list(body, "Symbols at different addresses", lm.Moved, ["Symbol", "Map", "Object"], (s) => [
+                this._symLink(s.Name), hex(s.MapAddr), hex(s.Addr),
+            ]);
+            this._list(body, "Symbols not in the map", lm.Unlisted, ["Symbol", "Object"], (s) => [
+                this._symLink(s.Name), hex(s.Addr),
+            ]);
+            const dtitle = "Discarded input sections (" + formatSize(lm.DiscardedSize || 0) + ")";
+            this._list(body, dtitle, lm.Discarded, ["Section", "File", "Size"], (d) => [
+                d.Section, d.File, formatSize(d.Size),
+            ]);
+        }).fail((xhr) => {
+            showError("Linker map", xhr, body.empty());
+        });
+    }
+
+    // _list adds a collapsible table of items to body. row returns the
+    // cells of an item's row.
+    _list(body, title, items, headers, row) {
+        items = items || [];
+        const details = $("<details>").appendTo(body);
+        $("<summary>").text(title + ": " + items.length).appendTo(details);
+        if (items.length == 0)
+            return;
+        details.addClass("lm-bad");
+        const table = $("<table>").appendTo(details);
+        const hr = $("<tr>").appendTo(table);
+        for (let h of headers)
+            $("<th>").text(h).appendTo(hr);
+        for (let item of items) {
+            const tr = $("<tr>").appendTo(table);
+            for (let cell of row(item)) {
+                const td = $("<td>").appendTo(tr);
+                if (typeof cell == "string")
+                    td.text(cell);
+                else
+                    td.append(cell);
+            }
+        }
+    }
+
+    _symLink(name) {
+        return $("<a>").attr("href", symURL(name)).text(name);
+    }
+
+    _where(s) {
+        if (!s.File)
+            return "";
+        return s.File + (s.Section ? ":(" + s.Section + ")" : "");
+    }
+}
@@ -5,39 +5,18 @@
 package main
 
 import (
-	"log"
-
 	"github.com/aclements/objbrowse/internal/asm"
 	"github.com/aclements/objbrowse/internal/functab"
-	"github.com/aclements/objbrowse/internal/obj"
 	"github.com/aclements/objbrowse/internal/symtab"
+	"github.com/aclements/objbrowse/obj"
 )
 
 type LivenessOverlay struct {
-	fi       *FileInfo
-	pcToFunc map[uint64]*functab.Func
+	fi *FileInfo
 }
 
 func NewLivenessOverlay(fi *FileInfo, symTab *symtab.Table) *LivenessOverlay {
-	// Collect function info.
-	pcToFunc := make(map[uint64]*functab.Func)
-	pclntab, ok := symTab.Name("runtime.pclntab")
-	if ok {
-		data, err := fi.Obj.SymbolData(pclntab)
-		if err != nil {
-			log.Fatal(err)
-		}
-		// TODO: What if data has relocations (e.g., in a .so)?
-		funcTab, err := functab.NewFuncTab(data.P, fi.Obj)
-		if err != nil {
-			log.Fatal(err)
-		}
-		for _, fn := range funcTab.Funcs {
-			pcToFunc[fn.PC] = fn
-		}
-	}
-
-	return &LivenessOverlay{fi, pcToFunc}
+	return &LivenessOverlay{fi}
 }
 
 type LivenessJS struct {
@@ -75,7 +54,7 @@ func pcTableToJS(t functab.PCTable) []LivenessRangeJS {
 }
 
 func (o *LivenessOverlay) liveness(sym obj.Sym, insts asm.Seq) (interface{}, error) {
-	fn := o.pcToFunc[sym.Value]
+	fn := o.fi.Func(sym.Value)
 	if fn == nil {
 		return nil, nil
 	}
@@ -6,25 +6,104 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"html/template"
-	"log"
+	"io"
+	"io/ioutil"
+	"mime"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"runtime"
 	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
-	"github.com/aclements/objbrowse/internal/obj"
+	"github.com/aclements/objbrowse/internal/inittrace"
+	"github.com/aclements/objbrowse/internal/logging"
+	"github.com/aclements/objbrowse/internal/profile"
 	"github.com/aclements/objbrowse/internal/symtab"
+	"github.com/aclements/objbrowse/obj"
 )
 
 var (
 	httpFlag   = flag.String("http", "localhost:0", "HTTP service address (e.g., ':6060')")
 	flagStatic = flag.String("static", defaultStatic(), "`path` to static files")
+	flagHeap   = flag.String("heapprofile", "", "attribute allocations in heap profile at `path` to allocation sites")
+	flagPerf   = flag.String("perf", "", "overlay samples and branch counts from perf.data or perf script output at `path`")
+	flagTrace  = flag.String("trace", "", "play back the branch trace at `path` (perf script --itrace=b output or JSON)")
+	flagWatch  = flag.Bool("watch", false, "reload the object file when it changes")
+	flagBuild  = flag.String("build", "", "shell `command` to build the object file at startup and on request")
+	flagDebug  = flag.String("debug-file", "", "read DWARF or PDB debug info (and symbols, if stripped) from the separate debug info file at `path`")
+	flagBTF    = flag.String("btf", "", "read BTF type information from the file at `path`, such as /sys/kernel/btf/vmlinux")
+	flagMmap   = flag.Bool("mmap", true, "map object files into memory rather than copying their sections, except when -watch, -pkg, or -open-root may rewrite them")
+
+	flagDebugBuild = flag.String("debug-build", "", "borrow symbols and DWARF from the unstripped build of the same source at `path`")
+
+	flagPkg     = flag.String("pkg", "", "build the Go main `package` and browse the result, rebuilding when its sources change")
+	flagGCFlags = flag.String("gcflags", "", "pass -gcflags=`flags` when building -pkg")
+
+	flagImage         = flag.String("image", "", "open the file at `image:/path` in a container image, where image is a registry reference like alpine:latest or an OCI image layout directory")
+	flagImagePlatform = flag.String("image-platform", "linux/"+runtime.GOARCH, "open the `os/arch` image of a multi-platform -image")
+
+	flagRaw     = flag.Bool("raw", false, "load the object file as a flat binary image with no container format, such as a firmware dump")
+	flagRawArch = flag.String("arch", "", "the `GOARCH` of a -raw image")
+	flagRawBase = flag.String("base", "0", "load a -raw image at `address`")
+	flagRawSyms = flag.String("syms", "", "read symbols for a -raw image from nm output or name,addr[,size[,type]] lines at `path`")
+
+	flagAllowRemote = flag.Bool("allow-remote", false, "permit -http to bind a non-loopback address")
+	flagRPCStdio    = flag.Bool("rpc-stdio", false, "also serve editor JSON-RPC requests on standard input and output")
+	flagToken       = flag.String("token", "", "require access `token`, passed once as ?token= or as a bearer token")
+	flagBasicAuth   = flag.String("basic-auth", "", "require HTTP basic auth with `user:password`")
+	flagTLSCert     = flag.String("tls-cert", "", "serve HTTPS using the certificate at `path`")
+	flagTLSKey      = flag.String("tls-key", "", "serve HTTPS using the private key at `path`")
+
+	flagSourceRoots     stringList
+	flagOpenRoots       stringList
+	flagSourceSubsts    stringList
+	flagPlugins         stringList
+	flagScripts         stringList
+	flagReports         stringList
+	flagMaxMemory       byteSize
+	flagSourceRootsFile = flag.String("source-roots", "", "read source roots from the file at `path`, one per line")
+	flagSourceAllowAll  = flag.Bool("source-allow-all", false, "permit reading any source file, even with -allow-remote")
+	flagLinkMap         = flag.String("linkmap", "", "cross-check the symbols and sections against the GNU ld or LLD linker map at `path`")
+	flagInitTrace       = flag.String("inittrace", "", "overlay Go package init times from GODEBUG=inittrace=1 output at `path`")
+	flagSettings        = flag.String("settings", configPath("settings.json"), "persist browser settings in the file at `path`, or in memory if empty")
+	flagNotebooks       = flag.String("notebooks", configPath("notebooks.json"), "persist notebooks in the file at `path`, or in memory if empty")
+	flagShare           = flag.Bool("share", false, "let browsers join a shared session, where they see each other's pages and selections and can follow a leader")
+	flagVerbose         = flag.Bool("verbose", false, "also log each request and how long each view took to decode")
+	flagIdleTimeout     = flag.Duration("timeout-idle", 0, "exit after `duration` with no requests in progress or pages open, such as 30m (0 means never)")
+	flagMetrics         = flag.Bool("metrics", false, "serve Prometheus metrics about objbrowse itself, such as request latency and cache hit rates, at /metrics")
+	flagPprof           = flag.Bool("pprof", false, "serve Go profiles of objbrowse itself at /debug/pprof/")
 )
 
+// sources is the policy for reading source files named by debug info.
+var sources *sourcePolicy
+
+// plugins are the external views loaded by -plugin.
+var plugins []*Plugin
+
+// scripts are the analysis scripts loaded by -script.
+var scripts []*Script
+
+func init() {
+	flag.Var(&flagSourceRoots, "source-root", "permit reading source files under `dir` (may be repeated)")
+	flag.Var(&flagOpenRoots, "open-root", "permit the web UI to open other object files under `dir` (may be repeated)")
+	flag.Var(&flagReports, "report", "link the frames of AddressSanitizer or Valgrind reports in the log at `path` (may be repeated)")
+	flag.Var(&flagPlugins, "plugin", "load a plugin view from `dir` (may be repeated)")
+	flag.Var(&flagScripts, "script", "run the Starlark analysis script at `path` (may be repeated)")
+	flag.Var(&flagSourceSubsts, "source-subst", "read source files under `from=to` from directory to instead (may be repeated)")
+	flag.Var(&flagMaxMemory, "max-memory", "limit caches of decoded relocations, disassembly, source lines, and indexes to about `size` bytes, such as 2G, evicting the least recently used (0 means no limit)")
+}
+
 func defaultStatic() string {
 	path, err := os.Executable()
 	if err != nil {
@@ -40,87 +119,705 @@ func defaultStatic() string {
 func main() {
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s [flags] objfile\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s [flags] -image image:/path\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s [flags] -pkg package\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s [flags] query objfile 'query'\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s [flags] render objfile symbol [render flags]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\nobjfile may be a path, - to read standard input, or an http or https URL.\n")
+		fmt.Fprintf(os.Stderr, "It may be compressed with gzip, bzip2, xz, or zstd, or be a compressed Linux\nkernel image (vmlinuz), which is decompressed to a temporary file.\n")
+		fmt.Fprintf(os.Stderr, "The query form prints the result of a query without starting the server,\nand the render form renders a view of a symbol.\n\n")
 		flag.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\n%s", queryUsage)
+		fmt.Fprintf(os.Stderr, "\n%s", renderUsage)
 	}
 	flag.Parse()
-	if flag.NArg() != 1 {
+	noArg := *flagImage != "" || *flagPkg != ""
+	query := !noArg && flag.NArg() == 3 && flag.Arg(0) == "query"
+	render := !noArg && flag.NArg() >= 3 && flag.Arg(0) == "render"
+	if !query && !render && (!noArg && flag.NArg() != 1 || noArg && flag.NArg() != 0) {
 		flag.Usage()
 		os.Exit(2)
 	}
-	if *flagStatic == "" {
+	objPath := flag.Arg(0)
+	if query || render {
+		objPath = flag.Arg(1)
+	}
+	// Remote, image, and -pkg objects have no directory to look
+	// for a config in, so just use the current directory.
+	cfgPath := objPath
+	if noArg || isRemote(objPath) {
+		cfgPath = ""
+	}
+	if err := loadConfig(flag.CommandLine, configFiles(cfgPath)); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+	memBudget.SetLimit(int64(flagMaxMemory))
+	if *flagVerbose {
+		serverLog.min = logging.LevelDebug
+	}
+	handleSignals()
+	if *flagDebug != "" && *flagDebugBuild != "" {
+		fmt.Fprintf(os.Stderr, "-debug-file and -debug-build are mutually exclusive\n")
+		os.Exit(2)
+	}
+	if *flagPkg != "" && (*flagImage != "" || *flagBuild != "" || *flagRaw) {
+		fmt.Fprintf(os.Stderr, "-pkg can't be used with -image, -build, or -raw\n")
+		os.Exit(2)
+	}
+	if query {
+		exit(queryMain(objPath, flag.Arg(2)))
+	}
+
+	if *flagStatic == "" && !render {
 		fmt.Fprintf(os.Stderr, "Unable to find static resources.\nPlease provide -static flag.\n")
 		os.Exit(2)
 	}
 
-	state := open()
-	state.serve()
+	if (*flagTLSCert == "") != (*flagTLSKey == "") {
+		fmt.Fprintf(os.Stderr, "-tls-cert and -tls-key must be given together\n")
+		os.Exit(2)
+	}
+	var auth authPolicy
+	auth.token = *flagToken
+	if *flagBasicAuth != "" {
+		var err error
+		auth.user, auth.password, err = parseBasicAuth(*flagBasicAuth)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "-basic-auth: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	var pkg *pkgBuild
+	if *flagPkg != "" {
+		var err error
+		pkg, err = newPkgBuild(*flagPkg)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		objPath = pkg.out
+	}
+
+	roots := []string(flagSourceRoots)
+	if *flagSourceRootsFile != "" {
+		more, err := readSourceRoots(*flagSourceRootsFile)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		roots = append(roots, more...)
+	}
+	// When serving remotely, default to denying source access.
+	denyAll := *flagAllowRemote && !*flagSourceAllowAll
+	if pkg != nil && (len(roots) > 0 || denyAll) {
+		// The sources of the package being built are always
+		// readable.
+		roots = append(roots, pkg.sourceRoots()...)
+	}
+	var err error
+	sources, err = newSourcePolicy(roots, denyAll)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	for _, s := range flagSourceSubsts {
+		subst, err := parsePathSubst(s)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		sources.substs = append(sources.substs, subst)
+	}
+	openRoots, err = newSourcePolicy(flagOpenRoots, true)
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	if render {
+		exit(renderMain(objPath, flag.Args()[2:]))
+	}
+
+	if err := settings.load(*flagSettings); err != nil {
+		logger.Warn("ignoring saved settings", "err", err)
+	}
+	if err := notebooks.load(*flagNotebooks); err != nil {
+		logger.Warn("ignoring saved notebooks", "err", err)
+	}
+	atExit(settings.flush)
+	atExit(notebooks.flush)
+
+	for _, dir := range flagPlugins {
+		p, err := loadPlugin(dir)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		for _, p2 := range plugins {
+			if p2.Name == p.Name {
+				fatalf("duplicate plugin %q in %s and %s", p.Name, p2.dir, p.dir)
+			}
+		}
+		plugins = append(plugins, p)
+	}
+	for _, path := range flagScripts {
+		sc, err := loadScript(path)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		scripts = append(scripts, sc)
+	}
+
+	if *flagRPCStdio && objPath == "-" {
+		fmt.Fprintf(os.Stderr, "-rpc-stdio can't read the objfile from standard input\n")
+		os.Exit(2)
+	}
+	if *flagImage != "" || isRemote(objPath) {
+		if *flagWatch || *flagBuild != "" {
+			fmt.Fprintf(os.Stderr, "-watch and -build require a local objfile\n")
+			os.Exit(2)
+		}
+		if *flagImage != "" {
+			objPath, err = extractImage(*flagImage)
+		} else {
+			objPath, err = fetchObj(objPath)
+		}
+		if err != nil {
+			fatalf("%v", err)
+		}
+	}
+
+	srv := &server{path: objPath, auth: auth, pkg: pkg}
+	if srv.canBuild() {
+		if out, err := srv.build(); err != nil {
+			os.Stderr.Write(out)
+			fatalf("build failed: %v", err)
+		}
+	}
+	st, err := open(srv.path)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	srv.state = st
+	addRecentFile(srv.path)
+	if *flagWatch || pkg != nil {
+		go srv.watch()
+	}
+	if pkg != nil {
+		go srv.watchSources()
+	}
+	srv.serve()
 }
 
 type state struct {
+	path   string
 	bin    obj.Obj
+	fi     *FileInfo
 	symTab *symtab.Table
 
 	symView    *SymView
+	cuView     *CUView
 	hexView    *HexView
 	asmView    *AsmView
 	sourceView *SourceView
+	stack      *StackAnalysis
+	checks     *CheckAnalysis
+	allocs     *AllocAnalysis
+	search     *Search
+	consts     *ConstXref
+	instHist   *InstHist
+	isa        *ISAScan
+	generics   *GenericsScan
+	embeds     *EmbedScan
+	kernel     *KernelTables
+	lineView   *LineTableView
+	goTables   *GoTablesView
+	valueView  *ValueView
+	varView    *VarView
+	trace      *Trace
+	scripts    *ScriptRunner
+	reports    []ReportJS
+	linkMap    *LinkMapJS
+	initTrace  []inittrace.Init
+
+	// warnings are non-fatal problems found while loading the
+	// object file.
+	warnings warnings
+
+	// buildDiff compares with the previous build, if -watch
+	// reloaded the object file.
+	buildDiff *BuildDiff
+
+	// refs counts the state's users: the server while it's the
+	// current state, and requests and jobs in progress. When it
+	// drops to zero, the state is closed.
+	refs int32
+	// files are the object files the state reads: its own and,
+	// with a build diff, the previous build's.
+	files []*objFile
 }
 
-type FileInfo struct {
-	Obj obj.Obj
+// An objFile is a loaded object file. It's reference counted
+// separately from states because a state's build diff reads the
+// previous state's file.
+type objFile struct {
+	bin obj.Obj
+	// files are the open files bin reads from.
+	files closers
+	refs  int32
 }
 
-func open() *state {
-	f, err := os.Open(flag.Arg(0))
-	if err != nil {
-		log.Fatal(err)
+// closers are open files to close together.
+type closers []io.Closer
+
+func (c *closers) add(f io.Closer) {
+	*c = append(*c, f)
+}
+
+func (c closers) close() {
+	for _, f := range c {
+		f.Close()
+	}
+}
+
+func (f *objFile) retain() {
+	atomic.AddInt32(&f.refs, 1)
+}
+
+// release drops a reference to f and closes it if that was the last.
+func (f *objFile) release() {
+	if atomic.AddInt32(&f.refs, -1) == 0 {
+		obj.Close(f.bin)
+		f.files.close()
 	}
+}
+
+func (s *state) retain() {
+	atomic.AddInt32(&s.refs, 1)
+}
+
+// release drops a reference to s. Releasing the last reference
+// releases the state's share of the memory budget and its object
+// files.
+func (s *state) release() {
+	if atomic.AddInt32(&s.refs, -1) != 0 {
+		return
+	}
+	s.fi.caches.close()
+	for _, f := range s.files {
+		f.release()
+	}
+}
 
-	bin, err := obj.Open(f)
+// diffWith compares s with the previous build, old, keeping old's
+// object file open as long as s needs it.
+func (s *state) diffWith(old *state) {
+	s.buildDiff = NewBuildDiff(old.fi, s.fi)
+	old.files[0].retain()
+	s.files = append(s.files, old.files[0])
+}
+
+// open loads the object file at path. The result has one reference,
+// which the caller must eventually release.
+func open(path string) (_ *state, err error) {
+	defer func(start time.Time) {
+		loadDuration.Observe(time.Since(start).Seconds())
+	}(time.Now())
+	var bin obj.Obj
+	var files closers
+	defer func() {
+		if err != nil {
+			if bin != nil {
+				obj.Close(bin)
+			}
+			files.close()
+		}
+	}()
+	if *flagRaw {
+		bin, err = openRaw(path)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		f, err := openDecompressed(path)
+		if err != nil {
+			return nil, err
+		}
+		bin, err = openObj(f, &files)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var warn warnings
+	withDebug, debugPath, err := attachDebugFile(path, bin, &warn, &files)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
+	bin = withDebug
+	caches := newFileCaches()
+	obj.SetCache(bin, caches.relocs)
 
 	syms, err := bin.Symbols()
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	symTab := symtab.NewTable(syms)
 
+	var heapProf *profile.Profile
+	if *flagHeap != "" {
+		data, err := ioutil.ReadFile(*flagHeap)
+		if err != nil {
+			return nil, err
+		}
+		heapProf, err = profile.Parse(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", *flagHeap, err)
+		}
+	}
+
 	// TODO: Do something with the error.
-	fi := &FileInfo{bin}
-	symView := NewSymView(fi, symTab)
+	fi := &FileInfo{Obj: bin, SymTab: symTab, Path: path, DebugFile: debugPath, BTFPath: *flagBTF, caches: caches}
+
+	if *flagPerf != "" {
+		samples, err := readPerf(*flagPerf)
+		if err != nil {
+			return nil, err
+		}
+		overlays.remove(perfSamplesOverlay)
+		overlays.remove(perfBranchesOverlay)
+		for _, o := range perfOverlays(fi, path, samples) {
+			overlays.put(o)
+		}
+	}
+	cuView := NewCUView(fi, symTab)
+	symView := NewSymView(fi, symTab, NewSymOrigins(fi, symTab, cuView))
 	hexView := NewHexView(fi, symTab)
-	asmView, _ := NewAsmView(fi, symTab)
-	sourceView, _ := NewSourceView(fi)
+	stack := NewStackAnalysis(fi)
+	checks := NewCheckAnalysis(fi)
+	allocs := NewAllocAnalysis(fi, heapProf)
+	asmView, _ := NewAsmView(fi, symTab, stack, checks, allocs)
+	sourceView := NewSourceView(fi, sources)
+	lineView := NewLineTableView(fi)
+	goTables := NewGoTablesView(fi)
+	valueView := NewValueView(fi)
+
+	reports, err := loadReports(fi, path, flagReports)
+	if err != nil {
+		return nil, err
+	}
 
-	return &state{bin, symTab, symView, hexView, asmView, sourceView}
+	var linkMap *LinkMapJS
+	if *flagLinkMap != "" {
+		linkMap, err = loadLinkMap(fi, *flagLinkMap)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var initTrace []inittrace.Init
+	if *flagInitTrace != "" {
+		initTrace, err = loadInitTrace(*flagInitTrace)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", *flagInitTrace, err)
+		}
+	}
+
+	var trace *Trace
+	if *flagTrace != "" {
+		trace, err = loadTrace(fi, path, *flagTrace)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	st := &state{
+		path:       path,
+		bin:        bin,
+		fi:         fi,
+		symTab:     symTab,
+		symView:    symView,
+		cuView:     cuView,
+		hexView:    hexView,
+		asmView:    asmView,
+		sourceView: sourceView,
+		stack:      stack,
+		checks:     checks,
+		allocs:     allocs,
+		search:     NewSearch(fi),
+		consts:     NewConstXref(fi),
+		instHist:   NewInstHist(fi),
+		isa:        NewISAScan(fi),
+		generics:   NewGenericsScan(fi),
+		kernel:     NewKernelTables(fi),
+		embeds:     NewEmbedScan(fi),
+		lineView:   lineView,
+		goTables:   goTables,
+		valueView:  valueView,
+		varView:    NewVarView(fi),
+		trace:      trace,
+		scripts:    NewScriptRunner(fi, scripts),
+		reports:    reports,
+		linkMap:    linkMap,
+		initTrace:  initTrace,
+		warnings:   warn,
+		refs:       1,
+		files:      []*objFile{{bin: bin, files: files, refs: 1}},
+	}
+	if len(scripts) > 0 {
+		// Scripts may publish overlays, so run them right
+		// away rather than waiting for the main page to ask.
+		st.retain()
+		go func() {
+			defer st.release()
+			st.scripts.prepare(nil)
+		}()
+	}
+	return st, nil
+}
+
+// openObj reads the object file f. Unless -mmap is off, it maps f
+// into memory, so sections are read from the mapping as they're used
+// rather than copied. Rewriting a mapped file in place would crash
+// objbrowse, so files aren't mapped when -watch or -pkg may rebuild
+// them, or when -open-root lets the web UI open files that are being
+// rebuilt. If the result reads from f, f is added to files, which
+// the caller must close after the result.
+func openObj(f *os.File, files *closers) (obj.Obj, error) {
+	if !*flagMmap || *flagWatch || *flagPkg != "" || len(openRoots.roots) > 0 {
+		files.add(f)
+		return obj.Open(f)
+	}
+	m, err := obj.Mmap(f)
+	if err != nil {
+		logger.Info("reading instead of mapping", "err", err)
+		files.add(f)
+		return obj.Open(f)
+	}
+	f.Close()
+	// The Obj holds its own reference to the mapping.
+	defer m.Close()
+	return obj.Open(m)
 }
 
-func (s *state) serve() {
-	ln, err := net.Listen("tcp", *httpFlag)
+func (srv *server) serve() {
+	ln, err := listen(*httpFlag)
 	if err != nil {
-		log.Fatalf("failed to create server socket: %v", err)
+		fatalf("failed to create server socket: %v", err)
+	}
+	srv.auth.loopback = isLoopback(ln.Addr())
+	if !srv.auth.loopback {
+		if !*flagAllowRemote {
+			fatalf("refusing to serve on non-loopback address %s without -allow-remote", ln.Addr())
+		}
+		if !srv.auth.enabled() {
+			logger.Warn("serving without -token or -basic-auth; anyone who can reach it can browse the object file", "addr", ln.Addr())
+		}
 	}
-	http.HandleFunc("/", s.httpMain)
+	srv.handle("/", (*state).httpMain)
 	fs := http.FileServer(http.Dir(*flagStatic))
 	http.Handle("/objbrowse.css", fs)
 	http.Handle("/objbrowse.js", fs)
 	http.Handle("/symview.js", fs)
+	http.Handle("/cuview.js", fs)
 	http.Handle("/hexview.js", fs)
 	http.Handle("/asmview.js", fs)
 	http.Handle("/sourceview.js", fs)
+	http.Handle("/linetableview.js", fs)
+	http.Handle("/gotablesview.js", fs)
+	http.Handle("/valueview.js", fs)
+	http.Handle("/varview.js", fs)
+	http.Handle("/regtimeline.js", fs)
+	http.Handle("/selectioninfo.js", fs)
 	http.Handle("/liveness.js", fs)
-	http.HandleFunc("/s/", s.httpSym)
-	addr := "http://" + ln.Addr().String()
-	fmt.Printf("Listening on %s\n", addr)
-	err = http.Serve(ln, nil)
-	log.Fatalf("failed to start HTTP server: %v", err)
+	http.Handle("/search.js", fs)
+	http.Handle("/scanview.js", fs)
+	http.Handle("/embedview.js", fs)
+	http.Handle("/peview.js", fs)
+	http.Handle("/dynamicview.js", fs)
+	http.Handle("/sectauditview.js", fs)
+	http.Handle("/typeview.js", fs)
+	http.Handle("/initorderview.js", fs)
+	http.Handle("/sizeview.js", fs)
+	http.Handle("/treemap.js", fs)
+	http.Handle("/insthist.js", fs)
+	http.Handle("/isaview.js", fs)
+	http.Handle("/genericsview.js", fs)
+	http.Handle("/scriptview.js", fs)
+	http.Handle("/builddiffview.js", fs)
+	http.Handle("/palette.js", fs)
+	http.Handle("/tabs.js", fs)
+	http.Handle("/history.js", fs)
+	http.Handle("/serverlog.js", fs)
+	http.Handle("/notebook.js", fs)
+	http.Handle("/session.js", fs)
+	http.Handle("/compare.js", fs)
+	http.Handle("/relocview.js", fs)
+	srv.handle("/s/", (*state).httpSym)
+	srv.handle("/syms", (*state).httpSyms)
+	srv.handle("/sym/", (*state).httpSymInfo)
+	srv.handle("/section", (*state).httpSection)
+	srv.handle("/cus", (*state).httpCUs)
+	srv.handle("/origins", (*state).httpOrigins)
+	srv.handle("/nosplit", (*state).httpNosplit)
+	srv.handle("/checks", (*state).httpChecks)
+	srv.handle("/allocs", (*state).httpAllocs)
+	srv.handle("/search", (*state).httpSearch)
+	srv.handle("/scan", (*state).httpScan)
+	srv.handle("/consts", (*state).httpConsts)
+	srv.handle("/resolve", (*state).httpResolve)
+	srv.handle("/largest", (*state).httpLargest)
+	srv.handle("/sizes", (*state).httpSizeTree)
+	srv.handle("/treemap", (*state).httpTreemap)
+	srv.handle("/export", (*state).httpExport)
+	srv.handle("/commands", (*state).httpCommands)
+	srv.handle("/tabs", (*state).httpTabs)
+	srv.handle("/compare", (*state).httpCompare)
+	srv.handle("/relocs", (*state).httpRelocs)
+	srv.handle("/reloc-risks", (*state).httpRelocRisks)
+	srv.handle("/insthist", (*state).httpInstHist)
+	srv.handle("/instchart", (*state).httpInstChart)
+	srv.handle("/isa", (*state).httpISA)
+	srv.handle("/embedded", (*state).httpEmbedded)
+	srv.handle("/embedded/", (*state).httpEmbeddedData)
+	srv.handle("/fingerprint", (*state).httpFingerprint)
+	srv.handle("/pe", (*state).httpPE)
+	srv.handle("/dynamic", (*state).httpDynamic)
+	srv.handle("/section-audit", (*state).httpSectionAudit)
+	srv.handle("/probe", (*state).httpProbe)
+	srv.handle("/types", (*state).httpTypes)
+	srv.handle("/value", (*state).httpValue)
+	srv.handle("/initorder", (*state).httpInitOrder)
+	srv.handle("/initgraph", (*state).httpInitGraph)
+	srv.handle("/jobs", (*state).httpJobs)
+	srv.handle("/jobs/", (*state).httpJob)
+	srv.handle("/trace", (*state).httpTrace)
+	srv.handle("/reports", (*state).httpReports)
+	srv.handle("/linkmap", (*state).httpLinkMap)
+	srv.handle("/vars", (*state).httpVars)
+	srv.handle("/range-stats", (*state).httpRangeStats)
+	http.HandleFunc("/rpc", srv.httpRPC)
+	srv.handle("/builddiff", (*state).httpBuildDiff)
+	http.Handle("/events", &events)
+	http.HandleFunc("/rebuild", srv.httpRebuild)
+	http.HandleFunc("/open", srv.httpOpen)
+	http.Handle("/pluginview.js", fs)
+	http.Handle("/overlay.js", fs)
+	http.Handle("/traceview.js", fs)
+	http.Handle("/reportview.js", fs)
+	http.Handle("/linkmapview.js", fs)
+	http.HandleFunc("/overlay", httpOverlay)
+	http.HandleFunc("/settings", httpSettings)
+	http.HandleFunc("/history", httpHistory)
+	http.HandleFunc("/log", httpLog)
+	srv.handle("/notebooks", (*state).httpNotebooks)
+	srv.handle("/notebook/", (*state).httpNotebook)
+	if *flagShare {
+		http.HandleFunc("/session", httpSession)
+		http.HandleFunc("/session/events", httpSessionEvents)
+	}
+	for _, p := range plugins {
+		p.handleStatic()
+	}
+	handleMetrics()
+	scheme := "http"
+	if *flagTLSCert != "" {
+		scheme = "https"
+	}
+	addr := scheme + "://" + ln.Addr().String()
+	if srv.auth.token != "" {
+		addr += "/?token=" + url.QueryEscape(srv.auth.token)
+	}
+	if *flagRPCStdio {
+		// Standard output carries the protocol.
+		fmt.Fprintf(os.Stderr, "Listening on %s\n", addr)
+		go srv.serveRPCStdio(rpcLinks{base: scheme + "://" + ln.Addr().String(), token: srv.auth.token})
+	} else {
+		fmt.Printf("Listening on %s\n", addr)
+	}
+	h := srv.auth.wrap(withPprof(http.DefaultServeMux))
+	if *flagIdleTimeout > 0 {
+		h = exitWhenIdle(h, *flagIdleTimeout)
+	}
+	hs := &http.Server{Handler: h}
+	ctx := shutdownOnExit(hs)
+	hs.BaseContext = func(net.Listener) context.Context { return ctx }
+	if *flagTLSCert != "" {
+		err = hs.ServeTLS(ln, *flagTLSCert, *flagTLSKey)
+	} else {
+		err = hs.Serve(ln)
+	}
+	if err == http.ErrServerClosed {
+		// exit is shutting down the server.
+		select {}
+	}
+	fatalf("failed to start HTTP server: %v", err)
 }
 
 type SymsInfo struct {
 	SymView interface{} `json:",omitempty"`
+
+	// CUView is true if the compile unit index is available. The
+	// index itself is fetched on demand from /cus.
+	CUView bool `json:",omitempty"`
+
+	// Fingerprint describes the toolchain that built the binary.
+	Fingerprint *FingerprintJS
+
+	// Reports is the number of sanitizer reports available from
+	// /reports.
+	Reports int `json:",omitempty"`
+
+	// Settings are the browser's preferences, as from /settings.
+	Settings map[string]json.RawMessage
+
+	// LinkMap indicates a linker map comparison is available
+	// from /linkmap.
+	LinkMap bool `json:",omitempty"`
+
+	// PE indicates PE or TE image headers are available from /pe.
+	PE bool `json:",omitempty"`
+
+	// Dynamic indicates ELF dynamic linking information is
+	// available from /dynamic.
+	Dynamic bool `json:",omitempty"`
+
+	// GoInit indicates the Go package initialization graph is
+	// available from /initgraph.
+	GoInit bool `json:",omitempty"`
+
+	// TypeSources lists the sources of types available from
+	// /types: "dwarf" and "btf".
+	TypeSources []string `json:",omitempty"`
+
+	// BuildDiff indicates the functions that changed since the
+	// previous build are available from the "builddiff" job.
+	BuildDiff bool `json:",omitempty"`
+
+	// Scripts lists the names of the -script analyses, whose
+	// results are available from the "scripts" job.
+	Scripts []string `json:",omitempty"`
+
+	// Errors lists the views that failed and any problems
+	// loading the object file.
+	Errors viewErrors `json:",omitempty"`
+
+	Watch WatchJS
+	// Share indicates pages join the shared session at /session.
+	Share bool `json:",omitempty"`
+}
+
+// WatchJS tells pages how the server is watching the object file.
+type WatchJS struct {
+	// Watch indicates the server reloads the object when it
+	// changes and sends events to /events.
+	Watch bool
+	// Build indicates the server has a build command that can
+	// be run by posting to /rebuild.
+	Build bool
+	// Open indicates other object files can be opened by posting
+	// to /open, which sends an "open" event.
+	Open bool
+}
+
+func watchInfo() WatchJS {
+	return WatchJS{*flagWatch || *flagPkg != "", *flagBuild != "" || *flagPkg != "", openDisabled() == ""}
 }
 
 func (s *state) httpMain(w http.ResponseWriter, r *http.Request) {
@@ -136,10 +833,28 @@ func (s *state) httpMain(w http.ResponseWriter, r *http.Request) {
 	var info SymsInfo
 	sv, err := s.symView.Decode()
 	if err != nil {
-		log.Print(err)
+		info.Errors.add(reqLog(r), "Symbols", err)
 	} else {
 		info.SymView = sv
 	}
+	if _, err := s.fi.DWARF(); err == nil {
+		info.CUView = true
+	}
+	info.Fingerprint = s.fi.Fingerprint()
+	info.Reports = len(s.reports)
+	info.LinkMap = s.linkMap != nil
+	_, info.PE = obj.ReadPEHeaders(s.bin)
+	_, info.Dynamic = obj.ReadELFDynamic(s.bin)
+	info.GoInit = s.hasGoInit()
+	info.TypeSources = s.valueView.Sources()
+	info.BuildDiff = s.buildDiff != nil
+	for _, sc := range s.scripts.scripts {
+		info.Scripts = append(info.Scripts, sc.Name)
+	}
+	info.Watch = watchInfo()
+	info.Share = *flagShare
+	info.Settings = settings.get(clientID(w, r))
+	s.fileErrors(&info.Errors)
 
 	if err := tmplMain.Execute(w, info); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -147,6 +862,169 @@ func (s *state) httpMain(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// httpSyms serves the symbols selected by the query parameters as
+// JSON, or as a CSV file if the "format" parameter is "csv". See
+// parseSymQuery for the other parameters.
+func (s *state) httpSyms(w http.ResponseWriter, r *http.Request) {
+	q, err := parseSymQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	switch format := r.FormValue("format"); format {
+	case "", "json":
+		serveJSON(w, s.symView.Query(q))
+	case "csv":
+		s.serveSymsCSV(w, s.symView.Query(q).Syms.Syms)
+	default:
+		http.Error(w, fmt.Sprintf("bad format %q", format), http.StatusBadRequest)
+	}
+}
+
+// httpCUs serves the compile unit index as JSON.
+func (s *state) httpCUs(w http.ResponseWriter, r *http.Request) {
+	cus, err := s.cuView.Decode()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	serveJSON(w, cus)
+}
+
+// httpOrigins serves the compile unit, package, and source file of
+// each symbol as JSON.
+func (s *state) httpOrigins(w http.ResponseWriter, r *http.Request) {
+	serveJSON(w, s.symView.origins.Decode())
+}
+
+// httpNosplit serves a report of the deepest nosplit call chains as
+// JSON. The "n" query parameter limits the number of chains.
+func (s *state) httpNosplit(w http.ResponseWriter, r *http.Request) {
+	n, err := strconv.Atoi(r.FormValue("n"))
+	if err != nil || n <= 0 {
+		n = 20
+	}
+	serveJSON(w, s.stack.NosplitReport(n))
+}
+
+// httpChecks serves a summary of the safety checks in the binary by
+// package and function as JSON. The "n" query parameter limits the
+// number of functions.
+func (s *state) httpChecks(w http.ResponseWriter, r *http.Request) {
+	n, err := strconv.Atoi(r.FormValue("n"))
+	if err != nil || n <= 0 {
+		n = 50
+	}
+	serveJSON(w, s.checks.Report(n))
+}
+
+// httpAllocs serves the heap allocation sites in the binary as JSON.
+// The "n" query parameter limits the number of sites.
+func (s *state) httpAllocs(w http.ResponseWriter, r *http.Request) {
+	n, err := strconv.Atoi(r.FormValue("n"))
+	if err != nil || n <= 0 {
+		n = 100
+	}
+	serveJSON(w, s.allocs.Report(n))
+}
+
+// httpSearch serves the results of a search as JSON. The "mode" and
+// "q" query parameters give the search mode and query, and the "sym"
+// or "section" parameters limit the search to a symbol or section.
+func (s *state) httpSearch(w http.ResponseWriter, r *http.Request) {
+	sym := obj.SymID(-1)
+	if name := r.FormValue("sym"); name != "" {
+		var err error
+		if sym, err = s.lookupSym(name, r.Form); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	res, err := s.search.Search(sym, r.FormValue("section"), r.FormValue("mode"), r.FormValue("q"), nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	serveJSON(w, res)
+}
+
+// httpScan serves the results of a search over the whole binary as
+// JSON. It takes the same "mode" and "q" parameters as httpSearch.
+func (s *state) httpScan(w http.ResponseWriter, r *http.Request) {
+	res, err := s.search.Search(-1, "", r.FormValue("mode"), r.FormValue("q"), nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	serveJSON(w, res)
+}
+
+// httpConsts serves the code and data locations where the constant
+// given by the "v" query parameter appears as JSON.
+func (s *state) httpConsts(w http.ResponseWriter, r *http.Request) {
+	v, ok := parseImm(r.FormValue("v"))
+	if !ok {
+		http.Error(w, fmt.Sprintf("bad value %q", r.FormValue("v")), http.StatusBadRequest)
+		return
+	}
+	serveJSON(w, s.consts.Find(v))
+}
+
+// httpEmbedded serves the list of files embedded in the object as
+// JSON.
+func (s *state) httpEmbedded(w http.ResponseWriter, r *http.Request) {
+	files, err := s.embeds.Files()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	serveJSON(w, EmbedScanJS{files})
+}
+
+// httpEmbeddedData serves the contents of embedded file
+// /embedded/<i> as a download.
+func (s *state) httpEmbeddedData(w http.ResponseWriter, r *http.Request) {
+	i, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/embedded/"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	f, data, err := s.embeds.Data(i)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	name := path.Base(f.Name)
+	if f.Name == "" {
+		name = fmt.Sprintf("%x.%s", uint64(f.Addr), f.Kind)
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	w.Write(data)
+}
+
+// httpReports serves the sanitizer reports as JSON.
+func (s *state) httpReports(w http.ResponseWriter, r *http.Request) {
+	serveJSON(w, s.reports)
+}
+
+// httpFingerprint serves the toolchain fingerprint of the binary as
+// JSON.
+func (s *state) httpFingerprint(w http.ResponseWriter, r *http.Request) {
+	serveJSON(w, s.fi.Fingerprint())
+}
+
+// serveJSON writes v to w as a JSON response.
+func serveJSON(w http.ResponseWriter, v interface{}) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(buf)
+}
+
 var tmplMain = template.Must(template.New("").Parse(`<!DOCTYPE html>
 <html>
 <head>
@@ -156,7 +1034,28 @@ var tmplMain = template.Must(template.New("").Parse(`<!DOCTYPE html>
 <body>
 <script src="https://code.jquery.com/jquery-3.3.1.min.js"></script>
 <script src="/objbrowse.js"></script>
+<script src="/palette.js"></script>
+<script src="/history.js"></script>
+<script src="/serverlog.js"></script>
+<script src="/notebook.js"></script>
+<script src="/session.js"></script>
 <script src="/symview.js"></script>
+<script src="/cuview.js"></script>
+<script src="/scanview.js"></script>
+<script src="/embedview.js"></script>
+<script src="/peview.js"></script>
+<script src="/dynamicview.js"></script>
+<script src="/sectauditview.js"></script>
+<script src="/typeview.js"></script>
+<script src="/initorderview.js"></script>
+<script src="/sizeview.js"></script>
+<script src="/isaview.js"></script>
+<script src="/relocview.js"></script>
+<script src="/genericsview.js"></script>
+<script src="/scriptview.js"></script>
+<script src="/builddiffview.js"></script>
+<script src="/reportview.js"></script>
+<script src="/linkmapview.js"></script>
 <script>render(document.body, {{$}})</script>
 </body>
 </html>
@@ -173,6 +1072,26 @@ func (a AddrJS) MarshalJSON() ([]byte, error) {
 	return append(buf, '"'), nil
 }
 
+// UnmarshalJSON accepts a hex string, with or without a leading
+// "0x", or a number.
+func (a *AddrJS) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		var n uint64
+		if err := json.Unmarshal(data, &n); err != nil {
+			return fmt.Errorf("address must be a hex string or number")
+		}
+		*a = AddrJS(n)
+		return nil
+	}
+	v, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X"), 16, 64)
+	if err != nil {
+		return fmt.Errorf("bad address %q", s)
+	}
+	*a = AddrJS(v)
+	return nil
+}
+
 func (a AddrJS) MarshalJSONTo(buf *bytes.Buffer) error {
 	buf.WriteByte('"')
 	ubuf := make([]byte, 0, 18)
@@ -185,10 +1104,33 @@ func (a AddrJS) MarshalJSONTo(buf *bytes.Buffer) error {
 type SymInfo struct {
 	Title string
 	Base  AddrJS
+	SymID obj.SymID
+
+	HexView    interface{}     `json:",omitempty"`
+	AsmView    interface{}     `json:",omitempty"`
+	SourceView interface{}     `json:",omitempty"`
+	LineView   interface{}     `json:",omitempty"`
+	GoTables   interface{}     `json:",omitempty"`
+	ValueView  interface{}     `json:",omitempty"`
+	VarView    interface{}     `json:",omitempty"`
+	RegAlloc   interface{}     `json:",omitempty"`
+	Plugins    []*PluginViewJS `json:",omitempty"`
+	Overlays   []OverlayJS     `json:",omitempty"`
+	// Trace is true if a branch trace is available from /trace.
+	Trace bool `json:",omitempty"`
+	// TypeSources lists the sources of types the symbol's data
+	// can be decoded as with /value.
+	TypeSources []string `json:",omitempty"`
 
-	HexView    interface{} `json:",omitempty"`
-	AsmView    interface{} `json:",omitempty"`
-	SourceView interface{} `json:",omitempty"`
+	// Settings are the browser's preferences, as from /settings.
+	Settings map[string]json.RawMessage
+
+	// Errors lists the views that failed.
+	Errors viewErrors `json:",omitempty"`
+
+	Watch WatchJS
+	// Share indicates pages join the shared session at /session.
+	Share bool `json:",omitempty"`
 }
 
 func (s *state) httpSym(w http.ResponseWriter, r *http.Request) {
@@ -207,13 +1149,6 @@ func (s *state) httpSym(w http.ResponseWriter, r *http.Request) {
 	// further parallel views, too, like decoding hex values using
 	// DWARF type information.
 
-	// TODO: Allow selecting a range of lines and highlighting all
-	// of them.
-
-	// TODO: Support for overlaying things like profile
-	// information? (Could also use this for liveness, etc.) Would
-	// be nice if this were "pluggable".
-
 	// TODO: Have a way to navigate control flow, leaving behind
 	// "breadcrumbs" of sequential control flow. E.g., clicking on
 	// a jump adds instructions between current position and jump
@@ -230,20 +1165,27 @@ func (s *state) httpSym(w http.ResponseWriter, r *http.Request) {
 
 	symName := r.URL.Path[3:]
 	info.Title = symName
+	info.Watch = watchInfo()
+	info.Share = *flagShare
+	client := clientID(w, r)
+	info.Settings = settings.get(client)
 
-	// TODO: Name isn't unique for local symbols, though it's
-	// *usually* unique and this makes for useful URLs. The
-	// address isn't necessarily unique either for symbols in
-	// different sections. Maybe we want something like
-	// /s/<name>[/num] to distinguish when necessary? This is also
-	// a problem for links created from symbolized assembly.
-	symID, ok := s.symTab.Name(symName)
-	if !ok {
-		fmt.Fprintln(w, "unknown symbol")
+	// Names aren't unique, but they usually are and make for
+	// useful URLs, so the "id" and "addr" query parameters
+	// disambiguate only when necessary.
+	//
+	// TODO: Links created from symbolized assembly still use
+	// just the name.
+	symID, err := s.lookupSym(symName, r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
 	sym := s.symTab.Syms()[symID]
 	info.Base = AddrJS(sym.Value)
+	info.SymID = symID
+	lg := reqLog(r).With("sym", symID, "name", sym.Name)
+	history.visit(client, symID, sym)
 
 	data, err := s.bin.SymbolData(symID)
 	if err != nil {
@@ -252,30 +1194,115 @@ func (s *state) httpSym(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Process HexView.
-	hv, err := s.hexView.DecodeSym(data)
+	start := time.Now()
+	hv, err := s.hexView.DecodeSym(sym, data)
+	observeView(lg, "Hex", start)
 	if err != nil {
-		// TODO: Display this to the user.
-		log.Print(err)
+		info.Errors.add(lg, "Hex", err)
 	} else {
 		info.HexView = hv
 	}
 
+	// Only run the views that can work for this symbol, so
+	// missing debug info hides views rather than producing
+	// errors.
+	caps := s.fi.SymCaps(sym)
+
 	// Process AsmView.
-	av, err := s.asmView.DecodeSym(sym, data.P)
-	if err != nil {
-		// TODO: Display this to the user.
-		log.Print(err)
-	} else {
-		info.AsmView = av
+	if caps&capAsm != 0 {
+		start := time.Now()
+		av, err := s.asmView.DecodeSym(sym, data.P)
+		observeView(lg, "Disassembly", start)
+		if err != nil {
+			info.Errors.add(lg, "Disassembly", err)
+		} else {
+			info.AsmView = av
+		}
 	}
 
 	// Process SourceView.
-	sv, err := s.sourceView.DecodeSym(&FileInfo{s.bin}, sym)
-	if err != nil {
-		// TODO: Display this to the user.
-		log.Print(err)
-	} else {
-		info.SourceView = sv
+	if caps&capSource != 0 {
+		start := time.Now()
+		sv, err := s.sourceView.DecodeSym(s.fi, sym)
+		observeView(lg, "Source", start)
+		if err != nil {
+			info.Errors.add(lg, "Source", err)
+		} else {
+			info.SourceView = sv
+		}
+	}
+
+	// Process LineTableView.
+	if caps&capLines != 0 {
+		start := time.Now()
+		lv, err := s.lineView.DecodeSym(sym)
+		observeView(lg, "Line table", start)
+		if err != nil {
+			info.Errors.add(lg, "Line table", err)
+		} else {
+			info.LineView = lv
+		}
+	}
+
+	// Process GoTablesView.
+	if caps&capGoTables != 0 {
+		start := time.Now()
+		gt, err := s.goTables.DecodeSym(sym)
+		observeView(lg, "Go tables", start)
+		if err != nil {
+			info.Errors.add(lg, "Go tables", err)
+		} else {
+			info.GoTables = gt
+		}
+	}
+
+	// Process ValueView.
+	if sym.Kind != obj.SymText && sym.Kind != obj.SymUndef {
+		info.TypeSources = s.valueView.Sources()
+		start := time.Now()
+		vv, err := s.valueView.DecodeSym(sym, data)
+		observeView(lg, "Value", start)
+		if err != nil {
+			info.Errors.add(lg, "Value", err)
+		} else if vv != nil {
+			info.ValueView = vv
+		}
+	}
+
+	// Process VarView.
+	if caps&capVars != 0 {
+		start := time.Now()
+		vv, err := s.varView.DecodeSym(sym)
+		observeView(lg, "Variables", start)
+		if err != nil {
+			info.Errors.add(lg, "Variables", err)
+		} else if vv != nil {
+			info.VarView = vv
+		}
+	}
+
+	// Process register allocation timeline.
+	if caps&capVars != 0 {
+		start := time.Now()
+		rt, err := s.varView.RegTimeline(sym)
+		observeView(lg, "Register allocation", start)
+		if err != nil {
+			info.Errors.add(lg, "Register allocation", err)
+		} else if rt != nil {
+			info.RegAlloc = rt
+		}
+	}
+
+	info.Trace = s.trace != nil
+
+	// Collect overlays pushed to /overlay.
+	info.Overlays = overlays.forRange(sym.Value, sym.Value+sym.Size)
+
+	// Run plugin views.
+	for _, p := range plugins {
+		if pv := p.run(s.path, sym, data.P); pv != nil {
+			info.Plugins = append(info.Plugins, pv)
+		}
 	}
 
 	if err := tmplSym.Execute(w, info); err != nil {
@@ -284,6 +1311,43 @@ func (s *state) httpSym(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// lookupSym returns the symbol named name. If there are several such
+// symbols, the "id" query parameter selects one by SymID, or the
+// "addr" query parameter selects one by address. Since SymIDs can
+// change when the object is rebuilt, an "id" that doesn't match name
+// is ignored. Otherwise, it picks the best match.
+func (s *state) lookupSym(name string, vals url.Values) (obj.SymID, error) {
+	ids := s.symTab.Name(name)
+	if len(ids) == 0 {
+		return -1, fmt.Errorf("unknown symbol %q", name)
+	}
+	if v := vals.Get("id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return -1, fmt.Errorf("bad symbol ID %q", v)
+		}
+		for _, match := range ids {
+			if match == obj.SymID(id) {
+				return match, nil
+			}
+		}
+	}
+	if v := vals.Get("addr"); v != "" {
+		addr, err := strconv.ParseUint(strings.TrimPrefix(v, "0x"), 16, 64)
+		if err != nil {
+			return -1, fmt.Errorf("bad address %q", v)
+		}
+		for _, match := range ids {
+			if s.symTab.Syms()[match].Value == addr {
+				return match, nil
+			}
+		}
+		return -1, fmt.Errorf("no symbol %q at %#x", name, addr)
+	}
+	id, _ := s.symTab.Lookup(name)
+	return id, nil
+}
+
 var tmplSym = template.Must(template.New("").Parse(`<!DOCTYPE html>
 <html>
 <head>
@@ -307,10 +1371,26 @@ var tmplSym = template.Must(template.New("").Parse(`<!DOCTYPE html>
 </svg>
 <script src="https://code.jquery.com/jquery-3.3.1.min.js"></script>
 <script src="/objbrowse.js"></script>
+<script src="/palette.js"></script>
+<script src="/history.js"></script>
+<script src="/serverlog.js"></script>
+<script src="/notebook.js"></script>
+<script src="/session.js"></script>
 <script src="/hexview.js"></script>
 <script src="/asmview.js"></script>
 <script src="/sourceview.js"></script>
+<script src="/linetableview.js"></script>
+<script src="/gotablesview.js"></script>
+<script src="/valueview.js"></script>
+<script src="/varview.js"></script>
+<script src="/regtimeline.js"></script>
+<script src="/selectioninfo.js"></script>
 <script src="/liveness.js"></script>
-<script>render(document.body, {{$}})</script>
+<script src="/search.js"></script>
+<script src="/pluginview.js"></script>
+<script src="/overlay.js"></script>
+<script src="/traceview.js"></script>
+{{range $.Plugins}}{{if .Script}}<script src="{{.Script}}"></script>
+{{end}}{{end}}<script>render(document.body, {{$}})</script>
 </body></html>
 `))
@@ -0,0 +1,74 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aclements/objbrowse/internal/lru"
+)
+
+// memBudget is shared by the caches of decoded data, which views
+// rebuild on demand. It's limited by -max-memory.
+var memBudget = lru.NewBudget(0)
+
+// fileCaches are the caches of data decoded from one object file.
+// They're closed when the file is reloaded, which releases their
+// share of memBudget.
+type fileCaches struct {
+	// relocs caches decoded relocations. It's installed in the
+	// Obj with obj.SetCache.
+	relocs *lru.Cache
+	// disasm caches the asm.Seq of text symbols, by obj.SymID.
+	disasm *lru.Cache
+	// srcLines caches the sourceIndex of source files, by
+	// sourceKey.
+	srcLines *lru.Cache
+	// xrefs caches ConstXref's index of constants in code.
+	xrefs *lru.Cache
+}
+
+func newFileCaches() *fileCaches {
+	return &fileCaches{
+		relocs:   memBudget.NewCache("relocations"),
+		disasm:   memBudget.NewCache("disassembly"),
+		srcLines: memBudget.NewCache("source lines"),
+		xrefs:    memBudget.NewCache("xref index"),
+	}
+}
+
+func (c *fileCaches) close() {
+	c.relocs.Close()
+	c.disasm.Close()
+	c.srcLines.Close()
+	c.xrefs.Close()
+}
+
+// A byteSize is a flag giving a number of bytes, optionally with a
+// unit suffix such as "512M" or "2GiB". Units are powers of 1024.
+type byteSize int64
+
+func (b *byteSize) String() string {
+	return strconv.FormatInt(int64(*b), 10)
+}
+
+func (b *byteSize) Set(s string) error {
+	num := strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B"), "I")
+	shift := uint(0)
+	if n := len(num); n > 0 {
+		if i := strings.IndexByte("KMGT", num[n-1]); i >= 0 {
+			shift = 10 * uint(i+1)
+			num = num[:n-1]
+		}
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(num), 64)
+	if err != nil || v < 0 || v*float64(uint64(1)<<shift) >= 1<<63 {
+		return fmt.Errorf("bad size %q", s)
+	}
+	*b = byteSize(v * float64(uint64(1)<<shift))
+	return nil
+}
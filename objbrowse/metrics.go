@@ -0,0 +1,110 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/aclements/objbrowse/internal/logging"
+	"github.com/aclements/objbrowse/internal/lru"
+	"github.com/aclements/objbrowse/internal/metrics"
+)
+
+// metricsRegistry holds objbrowse's own performance metrics, which
+// are served at /metrics with -metrics.
+var metricsRegistry = metrics.NewRegistry()
+
+var (
+	requestDuration = metricsRegistry.NewHistogram("objbrowse_http_request_duration_seconds",
+		"Time to serve a request, by handler.", metrics.DefBuckets, "handler")
+	viewDuration = metricsRegistry.NewHistogram("objbrowse_view_decode_duration_seconds",
+		"Time for a view to decode a symbol.", metrics.DefBuckets, "view")
+	loadDuration = metricsRegistry.NewHistogram("objbrowse_object_load_duration_seconds",
+		"Time to load the object file.", []float64{.1, .25, .5, 1, 2.5, 5, 10, 25, 50, 100})
+)
+
+func init() {
+	cacheStat := func(f func(st lru.Stats) float64) func() []metrics.Sample {
+		return func() []metrics.Sample {
+			var out []metrics.Sample
+			for _, st := range memBudget.Stats() {
+				out = append(out, metrics.Sample{Labels: []string{st.Name}, Value: f(st)})
+			}
+			return out
+		}
+	}
+	cache := []string{"cache"}
+	r := metricsRegistry
+	r.NewCounterFunc("objbrowse_cache_hits_total", "Lookups that found a cached value.", cache,
+		cacheStat(func(st lru.Stats) float64 { return float64(st.Hits) }))
+	r.NewCounterFunc("objbrowse_cache_misses_total", "Lookups that found no cached value.", cache,
+		cacheStat(func(st lru.Stats) float64 { return float64(st.Misses) }))
+	r.NewCounterFunc("objbrowse_cache_evictions_total", "Cached values evicted to stay within -max-memory.", cache,
+		cacheStat(func(st lru.Stats) float64 { return float64(st.Evictions) }))
+	r.NewGaugeFunc("objbrowse_cache_entries", "Values in the cache.", cache,
+		cacheStat(func(st lru.Stats) float64 { return float64(st.Entries) }))
+	r.NewGaugeFunc("objbrowse_cache_bytes", "Estimated memory used by the cache.", cache,
+		cacheStat(func(st lru.Stats) float64 { return float64(st.Bytes) }))
+	r.NewGaugeFunc("objbrowse_cache_limit_bytes", "The -max-memory limit of all caches, or 0 if unlimited.", nil,
+		func() []metrics.Sample { return []metrics.Sample{{Value: float64(memBudget.Limit())}} })
+
+	// The Go runtime's memory is the total that the caches
+	// are a part of. ReadMemStats stops the world, so read it
+	// once per collection.
+	var ms runtime.MemStats
+	r.OnCollect(func() { runtime.ReadMemStats(&ms) })
+	r.NewGaugeFunc("go_memstats_heap_inuse_bytes", "Bytes in in-use heap spans.", nil, func() []metrics.Sample {
+		return []metrics.Sample{{Value: float64(ms.HeapInuse)}}
+	})
+	r.NewGaugeFunc("go_memstats_sys_bytes", "Bytes of memory obtained from the OS.", nil, func() []metrics.Sample {
+		return []metrics.Sample{{Value: float64(ms.Sys)}}
+	})
+	r.NewGaugeFunc("go_goroutines", "Number of goroutines.", nil, func() []metrics.Sample {
+		return []metrics.Sample{{Value: float64(runtime.NumGoroutine())}}
+	})
+}
+
+// observeView records that view took since start to decode a symbol,
+// logging the time to lg.
+func observeView(lg *logging.Logger, view string, start time.Time) {
+	d := time.Since(start)
+	viewDuration.Observe(d.Seconds(), view)
+	lg.Debug("decoded view", "view", view, "dur", d)
+}
+
+// handleMetrics registers the Prometheus metrics at /metrics if
+// -metrics is set. It goes through the same authentication as
+// everything else.
+func handleMetrics() {
+	if *flagMetrics {
+		http.Handle("/metrics", metricsRegistry)
+	}
+}
+
+// withPprof wraps h to serve the profiling endpoints under
+// /debug/pprof/ if -pprof is set, and nothing there otherwise.
+// Importing net/http/pprof registers them with http.DefaultServeMux,
+// so h never sees these paths.
+func withPprof(h http.Handler) http.Handler {
+	mux := http.NewServeMux()
+	if *flagPprof {
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/debug/pprof") {
+			mux.ServeHTTP(w, r)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
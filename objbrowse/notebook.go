@@ -0,0 +1,433 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aclements/objbrowse/internal/sanitize"
+)
+
+// notebooks are the reports users assemble from snapshots of views,
+// such as a function's assembly or the size chart, and notes. Unlike
+// settings, notebooks aren't tied to a browser: each has a page at
+// /notebook/ID that can be bookmarked or shared. They persist in the
+// -notebooks file.
+var notebooks notebookStore
+
+// Limits on the notebook store, since any browser that can reach the
+// server can add to it.
+const (
+	maxNotebooks      = 200
+	maxNotebookCells  = 200
+	maxSnapshotBytes  = 2 << 20 // Per snapshot, before sanitizing
+	maxNotebookBytes  = 8 << 20
+	maxNotebooksBytes = 32 << 20 // All together, since each change rewrites them all
+	maxNotebookTitle  = 200
+	maxNotebookEdit   = maxSnapshotBytes + 64<<10
+)
+
+var notebookIDRe = regexp.MustCompile(`^[0-9a-f]{16}$`)
+
+// NotebookJS is a notebook and its cells.
+type NotebookJS struct {
+	ID    string
+	Title string
+	// Object is the path of the object file the notebook was
+	// started on.
+	Object  string
+	Created time.Time
+	Updated time.Time
+	Cells   []*NotebookCellJS
+}
+
+// NotebookCellJS is a snapshot of a view or a note in a notebook.
+type NotebookCellJS struct {
+	ID    string
+	Title string `json:",omitempty"`
+	// URL is the page the snapshot was taken from.
+	URL string `json:",omitempty"`
+	// HTML is the sanitized markup of the snapshot, if this is a
+	// snapshot cell.
+	HTML string `json:",omitempty"`
+	// Text is the user's note on the cell, or the text of a note
+	// cell.
+	Text string `json:",omitempty"`
+	Time time.Time
+}
+
+// NotebookSummaryJS describes a notebook in the list of notebooks.
+type NotebookSummaryJS struct {
+	ID      string
+	Title   string
+	Object  string
+	Cells   int
+	Updated time.Time
+}
+
+// NotebookEditJS is a change to a notebook. Fields that are unset
+// are left unchanged.
+type NotebookEditJS struct {
+	Title *string
+	// Add appends a cell. Its HTML is snapshot markup in XHTML,
+	// as from XMLSerializer, which is sanitized before it's kept.
+	Add *NotebookCellJS
+	// Cell selects the cell to Delete, Move, or set the Text of.
+	Cell   string
+	Delete bool
+	// Move moves Cell by this many places.
+	Move int
+	Text *string
+}
+
+type notebookStore struct {
+	mu    sync.Mutex
+	file  jsonFile
+	books map[string]*NotebookJS
+}
+
+// load reads the notebooks persisted at path, which later changes
+// will write back to. A missing file is not an error.
+func (s *notebookStore) load(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.file = jsonFile{what: "notebooks", path: path}
+	s.books = make(map[string]*NotebookJS)
+	if err := s.file.load(&s.books); err != nil {
+		s.books = make(map[string]*NotebookJS)
+		return err
+	}
+	return nil
+}
+
+// flush retries saving the notebooks if the last save failed.
+func (s *notebookStore) flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.file.flush(s.books)
+}
+
+func newNotebookID() string {
+	var buf [8]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf[:])
+}
+
+// copyNotebook returns a copy of b that's safe to use without s.mu.
+func copyNotebook(b *NotebookJS) *NotebookJS {
+	c := *b
+	c.Cells = append([]*NotebookCellJS{}, b.Cells...)
+	return &c
+}
+
+func (s *notebookStore) list() []NotebookSummaryJS {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []NotebookSummaryJS{}
+	for _, b := range s.books {
+		out = append(out, NotebookSummaryJS{b.ID, b.Title, b.Object, len(b.Cells), b.Updated})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Updated.After(out[j].Updated) })
+	return out
+}
+
+func (s *notebookStore) get(id string) *NotebookJS {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if b := s.books[id]; b != nil {
+		return copyNotebook(b)
+	}
+	return nil
+}
+
+func (s *notebookStore) create(title, object string) (*NotebookJS, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.books == nil {
+		s.books = make(map[string]*NotebookJS)
+	}
+	if len(s.books) >= maxNotebooks {
+		return nil, fmt.Errorf("too many notebooks")
+	}
+	now := time.Now()
+	b := &NotebookJS{ID: newNotebookID(), Title: clipTitle(title), Object: object, Created: now, Updated: now, Cells: []*NotebookCellJS{}}
+	s.books[b.ID] = b
+	s.file.save(s.books)
+	return copyNotebook(b), nil
+}
+
+func (s *notebookStore) delete(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.books[id] == nil {
+		return false
+	}
+	delete(s.books, id)
+	s.file.save(s.books)
+	return true
+}
+
+// edit applies e to notebook id.
+func (s *notebookStore) edit(id string, e *NotebookEditJS) (*NotebookJS, error) {
+	// Sanitize outside the lock, since it can take a while.
+	var add *NotebookCellJS
+	if e.Add != nil {
+		c := *e.Add
+		if c.HTML != "" {
+			html, err := sanitize.HTML(strings.NewReader(c.HTML))
+			if err != nil {
+				return nil, fmt.Errorf("bad snapshot: %v", err)
+			}
+			c.HTML = html
+		}
+		c.ID, c.Title, c.Time = newNotebookID(), clipTitle(c.Title), time.Now()
+		add = &c
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := s.books[id]
+	if b == nil {
+		return nil, fmt.Errorf("no notebook %s", id)
+	}
+	// Edit a copy, so a failed edit leaves b unchanged.
+	nb := copyNotebook(b)
+	if e.Title != nil {
+		nb.Title = clipTitle(*e.Title)
+	}
+	if add != nil {
+		if len(nb.Cells) >= maxNotebookCells {
+			return nil, fmt.Errorf("too many cells")
+		}
+		nb.Cells = append(nb.Cells, add)
+	}
+	if e.Cell != "" {
+		i := 0
+		for i < len(nb.Cells) && nb.Cells[i].ID != e.Cell {
+			i++
+		}
+		if i == len(nb.Cells) {
+			return nil, fmt.Errorf("no cell %s", e.Cell)
+		}
+		if e.Text != nil {
+			c := *nb.Cells[i]
+			c.Text = *e.Text
+			nb.Cells[i] = &c
+		}
+		c := nb.Cells[i]
+		rest := append(nb.Cells[:i:i], nb.Cells[i+1:]...)
+		switch j := i + e.Move; {
+		case e.Delete:
+			nb.Cells = rest
+		case e.Move != 0 && j >= 0 && j < len(nb.Cells):
+			nb.Cells = append(rest[:j:j], append([]*NotebookCellJS{c}, rest[j:]...)...)
+		}
+	}
+	size := notebookSize(nb)
+	if size > maxNotebookBytes {
+		return nil, fmt.Errorf("notebook would exceed %d bytes", maxNotebookBytes)
+	}
+	if size > notebookSize(b) {
+		total := size
+		for _, b2 := range s.books {
+			if b2 != b {
+				total += notebookSize(b2)
+			}
+		}
+		if total > maxNotebooksBytes {
+			return nil, fmt.Errorf("notebooks would exceed %d bytes", maxNotebooksBytes)
+		}
+	}
+	nb.Updated = time.Now()
+	s.books[id] = nb
+	s.file.save(s.books)
+	return copyNotebook(nb), nil
+}
+
+func notebookSize(b *NotebookJS) int {
+	n := len(b.Title)
+	for _, c := range b.Cells {
+		n += len(c.Title) + len(c.URL) + len(c.HTML) + len(c.Text)
+	}
+	return n
+}
+
+func clipTitle(t string) string {
+	if len(t) > maxNotebookTitle {
+		t = t[:maxNotebookTitle]
+	}
+	return t
+}
+
+// httpNotebooks lists and creates notebooks.
+//
+//	GET  /notebooks    serves the notebooks as a JSON list of
+//	                   NotebookSummaryJS, most recently updated first
+//	POST /notebooks    creates a notebook titled by the JSON object
+//	                   {"Title": title} and serves it as NotebookJS
+func (s *state) httpNotebooks(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		serveJSON(w, notebooks.list())
+
+	case http.MethodPost:
+		var req struct{ Title string }
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10))
+		if err := dec.Decode(&req); err != nil {
+			http.Error(w, "bad notebook: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		b, err := notebooks.create(req.Title, s.path)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		serveJSON(w, b)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// httpNotebook manages notebook ID.
+//
+//	GET    /notebook/ID                serves the notebook's page
+//	GET    /notebook/ID?format=json    serves the notebook as NotebookJS
+//	GET    /notebook/ID?format=html    serves the notebook as a single
+//	                                   HTML file to download
+//	POST   /notebook/ID                applies the NotebookEditJS in the
+//	                                   body and serves the notebook
+//	DELETE /notebook/ID                deletes the notebook
+func (s *state) httpNotebook(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/notebook/")
+	if !notebookIDRe.MatchString(id) {
+		http.NotFound(w, r)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		b := notebooks.get(id)
+		if b == nil {
+			http.NotFound(w, r)
+			return
+		}
+		switch format := r.FormValue("format"); format {
+		case "":
+			s.serveNotebook(w, b, false)
+		case "json":
+			serveJSON(w, b)
+		case "html":
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", notebookFileName(b)))
+			s.serveNotebook(w, b, true)
+		default:
+			http.Error(w, fmt.Sprintf("bad format %q", format), http.StatusBadRequest)
+		}
+
+	case http.MethodPost:
+		var e NotebookEditJS
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxNotebookEdit))
+		if err := dec.Decode(&e); err != nil {
+			http.Error(w, "bad notebook edit: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		b, err := notebooks.edit(id, &e)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		serveJSON(w, b)
+
+	case http.MethodDelete:
+		if !notebooks.delete(id) {
+			http.NotFound(w, r)
+		}
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// notebookFileName returns the name of the file to export b as.
+func notebookFileName(b *NotebookJS) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' {
+			return r
+		}
+		return '-'
+	}, b.Title)
+	if name == "" {
+		name = "notebook-" + b.ID
+	}
+	return name + ".html"
+}
+
+// serveNotebook serves the page of notebook b. An exported page is
+// self-contained: it has the style sheet inline and no scripts.
+func (s *state) serveNotebook(w http.ResponseWriter, b *NotebookJS, export bool) {
+	type cell struct {
+		*NotebookCellJS
+		Snapshot template.HTML
+	}
+	data := struct {
+		*NotebookJS
+		Cells  []cell
+		Export bool
+		CSS    template.CSS
+	}{NotebookJS: b, Export: export}
+	for _, c := range b.Cells {
+		// Snapshots are sanitized when they're added.
+		data.Cells = append(data.Cells, cell{c, template.HTML(c.HTML)})
+	}
+	if export {
+		css, err := ioutil.ReadFile(filepath.Join(*flagStatic, "objbrowse.css"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		data.CSS = template.CSS(css)
+	}
+	if err := tmplNotebook.Execute(w, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+var tmplNotebook = template.Must(template.New("").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{if .Title}}{{.Title}}{{else}}Notebook{{end}}</title>
+{{if .Export}}<style>{{.CSS}}</style>{{else}}<link rel="stylesheet" type="text/css" href="/objbrowse.css" />{{end}}
+</head>
+<body class="notebook{{if .Export}} notebook-export{{end}}" data-id="{{.ID}}">
+<h1 class="nb-title">{{if .Title}}{{.Title}}{{else}}Untitled notebook{{end}}</h1>
+<div class="nb-meta">{{.Object}} · updated {{.Updated.Format "2006-01-02 15:04"}}</div>
+{{range .Cells}}<div class="nb-cell" data-id="{{.ID}}">
+{{if .Title}}<h3 class="nb-cell-title">{{if and .URL (not $.Export)}}<a href="{{.URL}}">{{.Title}}</a>{{else}}{{.Title}}{{end}}</h3>{{end}}
+<div class="nb-text">{{.Text}}</div>
+{{if .Snapshot}}<div class="nb-snapshot">{{.Snapshot}}</div>{{end}}
+</div>
+{{else}}<div class="nb-empty">This notebook is empty. Add snapshots of views from the command palette.</div>
+{{end}}
+{{if not .Export}}<script src="https://code.jquery.com/jquery-3.3.1.min.js"></script>
+<script src="/objbrowse.js"></script>
+<script src="/notebook.js"></script>
+<script>new NotebookPage(document.body)</script>
+{{end}}</body>
+</html>
+`))
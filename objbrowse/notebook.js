@@ -0,0 +1,128 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+"use strict";
+
+// notebookEdit applies a NotebookEditJS to notebook id.
+function notebookEdit(id, edit) {
+    return $.ajax({url: "/notebook/" + id, method: "POST", contentType: "application/json",
+                   data: JSON.stringify(edit)});
+}
+
+// snapshotToNotebook prompts for a notebook and adds a snapshot of
+// the active view column to it.
+function snapshotToNotebook() {
+    let col = $(".panel-col.panel-active:visible").first();
+    if (!col.length)
+        col = $(".panel-col:visible").first();
+    if (!col.length) {
+        showError("Notebook", "no view to snapshot");
+        return;
+    }
+    // Controls don't mean anything in a snapshot.
+    const clone = col.clone();
+    clone.find("input, select, textarea, button, script, form.search").remove();
+    clone.find("details:not([open])").children(":not(summary)").remove();
+    const html = new XMLSerializer().serializeToString(clone[0]);
+    const view = col.data("view");
+
+    $(".nb-dialog").remove();
+    const dialog = $("<form>").addClass("nb-dialog").appendTo(document.body);
+    $("<div>").addClass("history-head").text("Add to notebook").appendTo(dialog);
+    const book = $("<select>").appendTo($("<label>").text("Notebook ").appendTo(dialog));
+    $("<option>").attr("value", "").text("New notebook…").appendTo(book);
+    const newTitle = $('<input type="text" size="30" placeholder="new notebook title">').appendTo(dialog);
+    const title = $('<input type="text" size="40">').val(document.title.replace(/^Objbrowse: /, "") + (view ? " (" + view + ")" : "")).
+        appendTo($("<label>").text("Title ").appendTo(dialog));
+    const text = $('<textarea rows="4" cols="40" placeholder="notes">').appendTo(dialog);
+    const status = $("<div>").appendTo(dialog);
+    $('<button type="submit">').text("Add").appendTo(dialog);
+    $('<button type="button">').text("Cancel").click(() => dialog.remove()).appendTo(dialog);
+    dialog.find("label").css("display", "block");
+
+    $.getJSON("/notebooks").done((books) => {
+        for (let b of books)
+            $("<option>").attr("value", b.ID).text(b.Title || "untitled " + b.ID).appendTo(book);
+        // Default to the most recently updated notebook.
+        if (books.length) {
+            book.val(books[0].ID);
+            newTitle.hide();
+        }
+    });
+    book.change(() => newTitle.toggle(book.val() === ""));
+
+    dialog.submit((ev) => {
+        ev.preventDefault();
+        const add = (id) => {
+            const cell = {Title: title.val(), URL: location.pathname + location.search + location.hash, HTML: html, Text: text.val()};
+            notebookEdit(id, {Add: cell}).done((b) => {
+                dialog.empty().append($("<div>").addClass("history-head").text("Added to ").
+                    append($("<a>").attr("href", "/notebook/" + b.ID).text(b.Title || "untitled notebook")));
+                $('<button type="button">').text("Close").click(() => dialog.remove()).appendTo(dialog);
+            }).fail((xhr) => { showError("Notebook", xhr, status.empty()); });
+        };
+        if (book.val()) {
+            add(book.val());
+            return;
+        }
+        $.ajax({url: "/notebooks", method: "POST", contentType: "application/json",
+                data: JSON.stringify({Title: newTitle.val()})}).
+            done((b) => add(b.ID)).
+            fail((xhr) => { showError("Notebook", xhr, status.empty()); });
+    });
+}
+
+// NotebookPage adds editing controls to the page of a notebook, which
+// the server renders.
+class NotebookPage {
+    constructor(body) {
+        const id = $(body).attr("data-id");
+        const edit = (e) => {
+            notebookEdit(id, e).done(() => location.reload()).
+                fail((xhr) => { showError("Notebook", xhr); });
+        };
+        errorArea = $("<div>").addClass("error-area").prependTo(body);
+
+        const bar = $("<div>").addClass("nb-bar").insertAfter($(".nb-meta", body));
+        const button = (label, title, fn) => $('<button type="button">').text(label).attr("title", title).click(fn);
+        bar.append(
+            button("Rename", "change the notebook's title", () => {
+                const t = prompt("Notebook title", $(".nb-title", body).text());
+                if (t !== null)
+                    edit({Title: t});
+            }),
+            button("Add note", "add a text cell", () => {
+                const t = prompt("Note");
+                if (t)
+                    edit({Add: {Text: t}});
+            }),
+            $("<a>").attr({href: "/notebook/" + id + "?format=html", title: "download as a single HTML file"}).text("Export HTML"),
+            button("Delete notebook", "delete this notebook", () => {
+                if (!confirm("Delete this notebook?"))
+                    return;
+                $.ajax({url: "/notebook/" + id, method: "DELETE"}).
+                    done(() => { location = "/"; }).
+                    fail((xhr) => { showError("Notebook", xhr); });
+            }));
+
+        $(".nb-cell", body).each((i, cell) => {
+            const cid = $(cell).attr("data-id");
+            const note = $(".nb-text", cell);
+            $("<div>").addClass("nb-cell-bar").append(
+                button("↑", "move up", () => edit({Cell: cid, Move: -1})),
+                button("↓", "move down", () => edit({Cell: cid, Move: 1})),
+                button("Edit note", "edit the note on this cell", () => {
+                    if (note.children("textarea").length)
+                        return;
+                    const ta = $('<textarea rows="4" cols="80">').val(note.text().trim());
+                    note.empty().append(ta, button("Save", "save the note", () => edit({Cell: cid, Text: ta.val()})));
+                    ta.focus();
+                }),
+                button("Delete", "delete this cell", () => {
+                    if (confirm("Delete this cell?"))
+                        edit({Cell: cid, Delete: true});
+                })).prependTo(cell);
+        });
+    }
+}
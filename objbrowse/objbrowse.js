@@ -351,21 +351,27 @@ class LazyTable {
 
 class Panels {
     constructor(container) {
-        this._c = $("<div>").css({position: "relative", height: "100%", display: "flex"});
+        this._c = $("<div>").css({position: "relative", flex: "1", minHeight: "0", display: "flex"});
         this._c.appendTo(container);
         this._cols = [];
     }
 
     // addCol adds a column to the right and returns a container
-    // element.
-    addCol() {
-        const div = $("<div>").css({
+    // element. view, if given, names the column's view so the
+    // command palette can toggle it.
+    addCol(view) {
+        const div = $("<div>").addClass("panel-col").data("view", view).css({
             overflow: "auto", height: "100%", boxSizing: "border-box",
             padding: "8px", flex: "1",
         });
         if (this._cols.length >= 0) {
             div.css({borderLeft: "2px solid #888"});
         }
+        // Track the last column used, so tabs can remember it.
+        div.on("mousedown focusin", () => {
+            this._c.children(".panel-active").removeClass("panel-active");
+            div.addClass("panel-active");
+        });
         this._c.append(div);
         this._cols.push({div: div});
         return div[0];
@@ -381,18 +387,145 @@ function scrollTo(container, elt) {
 var asmView;
 var sourceView;
 var hexView;
+var lineView;
+var goTablesView;
+var valueView;
+var varView;
+var regTimeline;
+var selectionInfo;
+var historyPanel;
+var serverLogPanel;
 var baseAddr;
+var errorArea;
+
+// settings are the browser's preferences, which the server persists.
+// Pages get them with their info; views read them with get and save
+// changes with set.
+const settings = {
+    _values: {},
+
+    get(key, def) {
+        return key in this._values ? this._values[key] : def;
+    },
+
+    // set changes a setting and returns the request saving it.
+    set(key, value) {
+        this._values[key] = value;
+        return $.ajax({url: "/settings", method: "POST", contentType: "application/json",
+                data: JSON.stringify({[key]: value === undefined ? null : value})}).
+            fail((xhr) => { showError("Settings", xhr); });
+    },
+};
 
 function render(container, info) {
+    settings._values = info.Settings || {};
+    errorArea = $("<div>").addClass("error-area").appendTo(container);
+    for (let e of info.Errors || [])
+        showError(e.View, e.Error);
+    if (info.SymID !== undefined)
+        new SymCard(info.SymID, container);
+    if (info.Base)
+        selectionInfo = new SelectionInfo(info.Title, container);
     const panels = new Panels(container);
-    if (info.SymView)
-        new SymView(info.SymView, panels.addCol());
-    if (info.HexView)
-        hexView = new HexView(info.HexView, panels.addCol());
-    if (info.AsmView)
-        asmView = new AsmView(info.AsmView, panels.addCol());
+    if (info.Watch && (info.Watch.Watch || info.Watch.Build || info.Watch.Open))
+        watchForUpdates(info.Watch);
+    if (info.SymView) {
+        const col = panels.addCol();
+        if (info.Fingerprint)
+            renderFingerprint(info.Fingerprint, col);
+        if (info.BuildDiff)
+            new BuildDiffView(col);
+        new SymView(info.SymView, col);
+    }
+    if (info.CUView)
+        new CUView(panels.addCol());
+    if (info.Reports)
+        new ReportView(panels.addCol());
+    if (info.LinkMap)
+        new LinkMapView(panels.addCol());
+    if (info.SymView) {
+        const col = panels.addCol();
+        new ScanView(col);
+        new EmbedView(col);
+        if (info.PE)
+            new PEView(col);
+        if (info.Dynamic)
+            new DynamicView(col);
+        new SectionAuditView(col);
+        if (info.TypeSources)
+            new TypeView(info.TypeSources, col);
+        new InitOrderView(col);
+        if (info.GoInit)
+            new InitGraphView(col);
+        new SizeView(col);
+        new GenericsView(col);
+        new ISAView(col);
+        new RelocView(col);
+        new RelocRiskView(col);
+        if (info.Scripts)
+            new ScriptView(info.Scripts, col);
+    }
+    if (info.HexView) {
+        const col = panels.addCol("hex");
+        new SearchBar(info.Title, info.SymID, col);
+        if (info.TypeSources)
+            new TypeDecoder(info.TypeSources, new AddrJS(info.Base), col);
+        hexView = new HexView(info.HexView, col, info.Overlays);
+    }
+    if (info.AsmView) {
+        const col = panels.addCol("asm");
+        const traceDiv = $("<div>").appendTo(col);
+        asmView = new AsmView(info.AsmView, col);
+        if (info.SymID !== undefined)
+            asmView.loadAnnotations(info.SymID);
+        if (info.Trace)
+            new TraceView(info.Title, asmView, traceDiv);
+    }
     if (info.SourceView)
-        sourceView = new SourceView(info.SourceView, panels.addCol());
+        sourceView = new SourceView(info.SourceView, panels.addCol("source"));
+    if (info.LineView)
+        lineView = new LineTableView(info.LineView, panels.addCol("lines"));
+    if (info.GoTables)
+        goTablesView = new GoTablesView(info.GoTables, panels.addCol("gotables"));
+    if (info.ValueView)
+        valueView = new ValueView(info.ValueView, panels.addCol("values"));
+    if (info.VarView)
+        varView = new VarView(info.VarView, panels.addCol("vars"));
+    if (info.RegAlloc)
+        regTimeline = new RegTimelineView(info.RegAlloc, panels.addCol());
+    for (let plugin of info.Plugins || []) {
+        const cls = pluginViews[plugin.Name];
+        if (cls && !plugin.Error)
+            new cls(plugin.Data, panels.addCol());
+        else
+            new PluginView(plugin, panels.addCol());
+    }
+
+    // Mark source lines containing safety checks and allocations.
+    if (asmView && sourceView) {
+        for (let check of asmView.checks) {
+            const pc = new AddrJS(check.PC);
+            sourceView.markRanges([{start: pc, end: pc.add(new AddrJS(1))}],
+                                  "sv-check", check.Kind + " check");
+        }
+        for (let alloc of asmView.allocs) {
+            const pc = new AddrJS(alloc.PC);
+            sourceView.markRanges([{start: pc, end: pc.add(new AddrJS(1))}],
+                                  "sv-alloc", "allocates via runtime." + alloc.Func);
+        }
+    }
+
+    if (info.Overlays)
+        applyOverlays(info.Overlays);
+
+    if (info.SymID !== undefined)
+        new CommandPalette({context: "sym", sym: info.SymID});
+    else
+        new CommandPalette({context: info.SymView ? "main" : ""});
+    historyPanel = new HistoryPanel(info.SymID);
+    serverLogPanel = new ServerLogPanel(info.SymID);
+    if (info.Share)
+        sessionBar = new SessionBar();
 
     if (info.Base) {
         baseAddr = new AddrJS(info.Base);
@@ -404,6 +537,246 @@ function render(container, info) {
     }
 }
 
+// errorText returns the message for err, which is either a string or
+// a failed jQuery XHR.
+function errorText(err) {
+    if (typeof err === "string")
+        return err;
+    if (err.responseText)
+        return err.responseText.trim();
+    return err.statusText || "request failed";
+}
+
+// showError adds a dismissible banner reporting that view failed with
+// err. If container is omitted, the banner goes at the top of the page.
+function showError(view, err, container) {
+    const banner = $("<div>").addClass("error-banner").
+          appendTo(container || errorArea || document.body);
+    $('<button type="button">').addClass("error-dismiss").attr("title", "Dismiss").
+        text("\u00d7").click(() => banner.remove()).appendTo(banner);
+    $("<b>").text(view + ": ").appendTo(banner);
+    $("<span>").text(errorText(err)).appendTo(banner);
+    return banner;
+}
+
+// eventSource returns the page's connection to the server's event
+// stream, opening it on first use.
+function eventSource() {
+    if (!eventSource.source)
+        eventSource.source = new EventSource("/events");
+    return eventSource.source;
+}
+
+// runJob starts a background job of the given kind on the server and
+// returns a promise for its result. onProgress, if provided, is
+// called with (done, total) as the job makes progress.
+function runJob(kind, params, onProgress) {
+    const result = $.Deferred();
+    const source = eventSource();
+    let id = null;
+    const finish = () => {
+        source.removeEventListener("job", listener);
+        $.getJSON("/jobs/" + id).done((job) => {
+            if (job.Error)
+                result.reject(job.Error);
+            else
+                result.resolve(job.Result);
+        }).fail((xhr) => {
+            result.reject(xhr.responseText.trim());
+        });
+    };
+    const listener = (ev) => {
+        const job = JSON.parse(ev.data);
+        if (job.ID !== id)
+            return;
+        if (job.Finished)
+            finish();
+        else if (onProgress)
+            onProgress(job.Done, job.Total);
+    };
+    source.addEventListener("job", listener);
+    $.post("/jobs", Object.assign({kind: kind}, params), null, "json").done((job) => {
+        id = job.ID;
+        // The job may have finished before we knew its ID.
+        $.getJSON("/jobs/" + id).done((job) => {
+            if (job.Finished && result.state() == "pending")
+                finish();
+        });
+    }).fail((xhr) => {
+        source.removeEventListener("job", listener);
+        result.reject(xhr.responseText.trim());
+    });
+    return result.promise();
+}
+
+// watchForUpdates shows a notice when the server reloads the binary
+// or opens another one and, if the server has a build command, a
+// button to rebuild it.
+function watchForUpdates(watch) {
+    const notice = $("<div>").addClass("watch-notice").appendTo(document.body);
+    const status = $("<span>").appendTo(notice);
+    if (watch.Build) {
+        $('<button type="button">').text("Rebuild").click(() => {
+            $.post("/rebuild").fail((xhr) => {
+                alert("Build failed:\n" + xhr.responseText);
+            });
+        }).appendTo(notice);
+    }
+    if (!watch.Watch && !watch.Open)
+        return;
+    if (!watch.Watch && !watch.Build)
+        notice.hide();
+    const source = eventSource();
+    // This page's symbol IDs and addresses belong to the old binary.
+    source.addEventListener("open", (ev) => {
+        status.empty().append("Opened " + ev.data + ". ").
+            append($("<a>").attr("href", "/").text("Go to symbol table"));
+        notice.addClass("watch-updated").show();
+    });
+    source.addEventListener("reload", () => {
+        status.empty().append("Binary updated. ").
+            append($("<a>").attr("href", "").text("Reload page"));
+        notice.addClass("watch-updated");
+    });
+    source.addEventListener("reload-error", (ev) => {
+        status.text("Reload failed: " + ev.data);
+    });
+    source.addEventListener("build", (ev) => {
+        status.text("Build " + ev.data);
+    });
+}
+
+// renderFingerprint adds a banner describing the toolchain that built
+// the binary to container.
+function renderFingerprint(fp, container) {
+    const parts = [];
+    if (fp.GoVersion)
+        parts.push(fp.GoVersion);
+    else if (fp.PclntabVersion)
+        parts.push("Go (pclntab ≥ " + fp.PclntabVersion + ")");
+    parts.push(fp.Format + "/" + fp.Arch);
+    for (let [flag, label] of [[fp.PIE, "PIE"], [fp.Stripped, "stripped"], [!fp.DWARF, "no DWARF"],
+                               [fp.Race, "race"], [fp.CGO, "cgo"], [fp.DebugFile, "separate debug info"]]) {
+        if (flag)
+            parts.push(label);
+    }
+    for (let s of fp.Settings || []) {
+        if (s.Key == "-gcflags" || s.Key == "-ldflags" || s.Key == "-tags")
+            parts.push(s.Key + "=" + s.Value);
+    }
+    const banner = $("<div>").addClass("fingerprint").text(parts.join(", ")).appendTo(container);
+
+    // Show the build details as a tooltip.
+    const details = [];
+    if (fp.Path)
+        details.push("path " + fp.Path);
+    if (fp.Main)
+        details.push("mod " + fp.Main);
+    if (fp.DebugFile)
+        details.push("debug info " + fp.DebugFile);
+    for (let s of fp.Settings || [])
+        details.push(s.Key + "=" + s.Value);
+    if (details.length > 0)
+        banner.attr("title", details.join("\n"));
+}
+
+// symURL returns the URL of the page for the symbol with the given
+// name. If id is given, it selects among symbols with the same name.
+function symURL(name, id) {
+    let url = "/s/" + name;
+    if (id !== undefined)
+        url += "?id=" + id;
+    return url;
+}
+
+// SymCard is a header card showing everything known about a symbol,
+// fetched from /sym/<id>/info.
+class SymCard {
+    constructor(symID, container) {
+        this._card = $("<div>").addClass("symcard").text("Loading symbol info…").appendTo(container);
+        $.getJSON("/sym/" + symID + "/info").done((sym) => {
+            this._render(sym);
+        }).fail((xhr) => {
+            this._card.remove();
+            showError("Symbol info", xhr);
+        });
+    }
+
+    _render(sym) {
+        const card = this._card.empty();
+        const hex = (v) => "0x" + v.toString(16).padStart(2, "0");
+        const fields = [
+            ["value", sym.Value],
+            ["size", sym.Size],
+            ["type", sym.Kind],
+            ["binding", sym.Binding],
+            ["visibility", sym.Visibility],
+            ["table", sym.BothTables ? "static+dynamic" : sym.Table],
+            ["st_info", hex(sym.Info)],
+            ["st_other", hex(sym.Other)],
+        ];
+        if (sym.Version)
+            fields.push(["version", sym.Version + (sym.VersionHidden ? " (hidden)" : "")]);
+        if (sym.Library)
+            fields.push(["library", sym.Library]);
+        if (sym.Section)
+            fields.push(["section", sym.Section]);
+        if (sym.Align)
+            fields.push(["align", sym.Align]);
+        if (sym.CU)
+            fields.push(["CU", sym.CU]);
+        if (sym.DIE !== undefined)
+            fields.push(["DIE", hex(sym.DIE)]);
+        $("<span>").addClass("symcard-name").text(sym.Name).appendTo(card);
+        for (let [key, val] of fields) {
+            $("<span>").addClass("symcard-field").
+                append($("<span>").addClass("symcard-key").text(key + " "), document.createTextNode(val)).
+                appendTo(card);
+        }
+        if (sym.Views) {
+            const field = $("<span>").addClass("symcard-field").
+                append($("<span>").addClass("symcard-key").text("views ")).appendTo(card);
+            sym.Views.forEach((v, i) => {
+                if (i > 0)
+                    field.append(" ");
+                const span = $("<span>").text(v.View).appendTo(field);
+                if (!v.Available)
+                    span.addClass("symcard-unavailable");
+                if (v.Note)
+                    span.attr("title", v.Note).addClass("symcard-note");
+            });
+        }
+        if (sym.Kind != "U") {
+            const field = $("<span>").addClass("symcard-field").
+                append($("<span>").addClass("symcard-key").text("download ")).appendTo(card);
+            const link = (path, text) =>
+                  $("<a>").attr({href: path, download: ""}).text(text).appendTo(field);
+            if (sym.Views && sym.Views.some((v) => v.View == "asm" && v.Available)) {
+                link("/sym/" + sym.ID + "/asm", ".s");
+                field.append(" ");
+                link("/sym/" + sym.ID + "/obj", ".o");
+                field.append(" ");
+            }
+            link("/sym/" + sym.ID + "/bin", ".bin");
+            if (sym.Section) {
+                field.append(" ");
+                link("/section?name=" + encodeURIComponent(sym.Section), sym.Section + ".bin");
+            }
+        }
+        for (let [key, list] of [["aliases", sym.Aliases], ["same name", sym.SameName]]) {
+            if (!list)
+                continue;
+            const field = $("<span>").addClass("symcard-field").
+                append($("<span>").addClass("symcard-key").text(key + " ")).appendTo(card);
+            list.forEach((alias, i) => {
+                if (i > 0)
+                    field.append(", ");
+                $("<a>").attr("href", symURL(alias.Name, alias.ID)).text(alias.Name + " #" + alias.ID).appendTo(field);
+            });
+        }
+    }
+}
+
 function onHashChange() {
     let hash = window.location.hash;
     if (onHashChange.lastHash === hash)
@@ -432,12 +805,40 @@ function highlightRanges(ranges, cause) {
         asmView.highlightRanges(ranges, cause !== asmView);
     if (sourceView)
         sourceView.highlightRanges(ranges, cause !== sourceView);
+    if (lineView)
+        lineView.highlightRanges(ranges, cause !== lineView);
+    if (goTablesView)
+        goTablesView.highlightRanges(ranges, cause !== goTablesView);
+    if (valueView)
+        valueView.highlightRanges(ranges, cause !== valueView);
+    if (varView)
+        varView.highlightRanges(ranges, cause !== varView);
+    if (regTimeline)
+        regTimeline.highlightRanges(ranges, cause !== regTimeline);
+    if (selectionInfo)
+        selectionInfo.update(ranges);
 
     const newHash = "#" + formatRanges(ranges);
     onHashChange.lastHash = newHash; // Inhibit hashchange listener
     window.location.hash = newHash
 }
 
+// extendSelection returns the selection made by clicking range r
+// with mouse event ev. A shift-click extends the selection from the
+// range of the previous plain click to r; otherwise, r becomes the
+// new anchor for later shift-clicks.
+function extendSelection(r, ev) {
+    const a = extendSelection.anchor;
+    if (ev && ev.shiftKey && a) {
+        // Don't also select text.
+        window.getSelection().removeAllRanges();
+        return {start: a.start.compare(r.start) < 0 ? a.start : r.start,
+                end: a.end.compare(r.end) > 0 ? a.end : r.end};
+    }
+    extendSelection.anchor = r;
+    return r;
+}
+
 function formatRanges(ranges) {
     let out = "";
     for (let r of ranges) {
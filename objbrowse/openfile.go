@@ -0,0 +1,159 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// openRoots is the policy for object files the web UI may open in
+// place of the current one, from -open-root. With no roots, it
+// permits none.
+var openRoots = &sourcePolicy{denyAll: true}
+
+// maxRecentFiles is the number of recently opened files listed.
+const maxRecentFiles = 20
+
+// recentFiles lists the object files the server has browsed, most
+// recent first. Like history, it's only kept in memory.
+var recentFiles struct {
+	mu    sync.Mutex
+	paths []string
+}
+
+// addRecentFile moves path to the front of recentFiles.
+func addRecentFile(path string) {
+	recentFiles.mu.Lock()
+	defer recentFiles.mu.Unlock()
+	paths := []string{path}
+	for _, p := range recentFiles.paths {
+		if p != path && len(paths) < maxRecentFiles {
+			paths = append(paths, p)
+		}
+	}
+	recentFiles.paths = paths
+}
+
+// fileFlags are the flags that describe the object file named on the
+// command line rather than object files in general, so they can't be
+// applied to another file.
+var fileFlags = []string{"debug-file", "debug-build", "btf", "heapprofile", "perf", "trace", "report", "linkmap", "inittrace", "syms"}
+
+// openDisabled returns why the web UI can't open other object files,
+// or "" if it can.
+func openDisabled() string {
+	if len(openRoots.roots) == 0 {
+		return "no -open-root"
+	}
+	if *flagBuild != "" || *flagPkg != "" {
+		return "the object file is built by -build or -pkg"
+	}
+	var set []string
+	flag.Visit(func(f *flag.Flag) {
+		for _, name := range fileFlags {
+			if f.Name == name {
+				set = append(set, "-"+name)
+			}
+		}
+	})
+	if len(set) > 0 {
+		sort.Strings(set)
+		return strings.Join(set, ", ") + " only applies to the first object file"
+	}
+	return ""
+}
+
+// OpenJS describes the object files the web UI can open.
+type OpenJS struct {
+	// Path is the object file being browsed.
+	Path string
+	// Disabled, if not "", is why other files can't be opened.
+	Disabled string `json:",omitempty"`
+	// Roots are the directories under which files may be opened.
+	Roots []string
+	// Recent are recently browsed files, most recent first,
+	// including Path.
+	Recent []string
+}
+
+func (srv *server) openInfo() OpenJS {
+	recentFiles.mu.Lock()
+	recent := append([]string(nil), recentFiles.paths...)
+	recentFiles.mu.Unlock()
+	return OpenJS{
+		Path:     srv.cur().path,
+		Disabled: openDisabled(),
+		Roots:    openRoots.roots,
+		Recent:   recent,
+	}
+}
+
+// openFile replaces the object file being browsed with the one at
+// path, which is relative to the current file's directory.
+func (srv *server) openFile(path string) error {
+	if why := openDisabled(); why != "" {
+		return fmt.Errorf("can't open other files: %s", why)
+	}
+	srv.openMu.Lock()
+	defer srv.openMu.Unlock()
+
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(srv.cur().path), path)
+	}
+	path = filepath.Clean(path)
+	if !openRoots.allowed(path) {
+		logger.Warn("denied opening object file", "path", path)
+		return fmt.Errorf("%s: access denied (see -open-root)", path)
+	}
+	st, err := open(path)
+	if err != nil {
+		return err
+	}
+	srv.mu.Lock()
+	srv.replace(st)
+	srv.mu.Unlock()
+	addRecentFile(path)
+	logger.Info("opened", "path", path)
+	events.publish("open", path)
+	return nil
+}
+
+// httpOpen lists or opens object files.
+//
+//	GET  /open    serves an OpenJS
+//	POST /open    opens the file given by the "path" parameter and
+//	              serves the new OpenJS; open pages get an "open"
+//	              event with the path
+//
+// Since POST /open reads files from disk, authPolicy rejects it from
+// other sites' pages. The replaced
+// file is closed once requests using it finish.
+func (srv *server) httpOpen(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		serveJSON(w, srv.openInfo())
+
+	case http.MethodPost:
+		path := r.FormValue("path")
+		if path == "" {
+			http.Error(w, "missing path", http.StatusBadRequest)
+			return
+		}
+		if err := srv.openFile(path); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		serveJSON(w, srv.openInfo())
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"debug/dwarf"
+	"strings"
+	"sync"
+
+	"github.com/aclements/objbrowse/internal/symtab"
+	"github.com/aclements/objbrowse/obj"
+)
+
+// SymOrigins attributes text symbols to the compile unit, Go package,
+// and source file they come from. It uses DWARF where possible, and
+// otherwise falls back to the Go function table for files and to
+// symbol names for packages.
+type SymOrigins struct {
+	fi     *FileInfo
+	symTab *symtab.Table
+	cuView *CUView
+
+	once sync.Once
+	js   *SymOriginsJS
+}
+
+func NewSymOrigins(fi *FileInfo, symTab *symtab.Table, cuView *CUView) *SymOrigins {
+	return &SymOrigins{fi: fi, symTab: symTab, cuView: cuView}
+}
+
+// SymOriginsJS is the origin of each symbol, in a compact form.
+type SymOriginsJS struct {
+	// CUs, Pkgs, and Files are tables of names. Index 0 of each
+	// is always "", meaning unknown.
+	CUs, Pkgs, Files []string
+	// Syms gives the indexes into CUs, Pkgs, and Files of the
+	// origin of each symbol in the symbol table, by symbol ID.
+	// Symbols other than text symbols have no origin.
+	Syms [][3]int
+	// ExactPkgs indicates that Pkgs come from DWARF rather than
+	// from symbol names.
+	ExactPkgs bool `json:",omitempty"`
+}
+
+// Decode returns the origins of all symbols. It is computed on first
+// use and cached.
+func (o *SymOrigins) Decode() *SymOriginsJS {
+	o.once.Do(o.decode)
+	return o.js
+}
+
+// Pkg returns the Go package of symbol id, or "" if it's unknown or
+// not Go code.
+func (o *SymOrigins) Pkg(id obj.SymID) string {
+	js := o.Decode()
+	return js.Pkgs[js.Syms[id][1]]
+}
+
+func (o *SymOrigins) decode() {
+	js := &SymOriginsJS{CUs: []string{""}, Pkgs: []string{""}, Files: []string{""}}
+	o.js = js
+	idx := func(table *[]string, m map[string]int, name string) int {
+		if name == "" {
+			return 0
+		}
+		i, ok := m[name]
+		if !ok {
+			i = len(*table)
+			*table = append(*table, name)
+			m[name] = i
+		}
+		return i
+	}
+	cuIdx, pkgIdx, fileIdx := make(map[string]int), make(map[string]int), make(map[string]int)
+
+	// Index the DWARF functions by entry point.
+	type origin struct{ cu, pkg, file int }
+	byAddr := make(map[uint64]origin)
+	goCU := make(map[string]bool)
+	if cus, err := o.cuView.Decode(); err == nil {
+		js.ExactPkgs = true
+		for _, cu := range cus.(*CUViewJS).CUs {
+			var org origin
+			org.cu = idx(&js.CUs, cuIdx, cu.Name)
+			if isGoProducer(cu.Producer) {
+				// Go compile units are packages.
+				goCU[cu.Name] = true
+				org.pkg = idx(&js.Pkgs, pkgIdx, cu.Name)
+			}
+			for _, f := range cu.Files {
+				org.file = idx(&js.Files, fileIdx, f.Name)
+				for _, fn := range f.Funcs {
+					byAddr[uint64(fn.Addr)] = org
+				}
+			}
+		}
+	}
+
+	syms := o.symTab.Syms()
+	js.Syms = make([][3]int, len(syms))
+	for i, sym := range syms {
+		if sym.Kind != obj.SymText {
+			continue
+		}
+		org, ok := byAddr[sym.Value]
+		if !ok {
+			// Functions without DWARF subprograms, like
+			// assembly functions, may still be in a compile
+			// unit with a line table.
+			if cu := o.fi.AddrToCU(sym.Value); cu != nil {
+				name, _ := cu.Val(dwarf.AttrName).(string)
+				org.cu = idx(&js.CUs, cuIdx, name)
+				if goCU[name] {
+					org.pkg = idx(&js.Pkgs, pkgIdx, name)
+				}
+			}
+			file, _ := o.fi.Line(sym.Value)
+			org.file = idx(&js.Files, fileIdx, file)
+		}
+		if org.pkg == 0 && !js.ExactPkgs {
+			org.pkg = idx(&js.Pkgs, pkgIdx, goPackage(sym.Name))
+		}
+		js.Syms[i] = [3]int{org.cu, org.pkg, org.file}
+	}
+}
+
+// isGoProducer reports whether a DWARF producer string is the Go
+// compiler's.
+func isGoProducer(producer string) bool {
+	return strings.HasPrefix(producer, "Go cmd/compile")
+}
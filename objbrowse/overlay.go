@@ -0,0 +1,197 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// overlays is the set of overlays pushed by external tools. Overlays
+// are keyed by address, so they persist across reloads of the object
+// file.
+var overlays overlayStore
+
+// maxOverlayBytes limits the size of a posted overlay.
+const maxOverlayBytes = 64 << 20
+
+// OverlayJS is a named set of annotations on address ranges, such as
+// coverage from a fuzzer or hit counts from a tracer.
+type OverlayJS struct {
+	Name    string
+	Entries []OverlayEntryJS
+}
+
+// OverlayEntryJS annotates the address range [Start, End). If End is
+// omitted, the entry covers the single byte at Start.
+type OverlayEntryJS struct {
+	Start AddrJS
+	End   AddrJS   `json:",omitempty"`
+	Value *float64 `json:",omitempty"`
+	// Color is a CSS color, either "#rgb", "#rrggbb", "#rrggbbaa",
+	// or a color name.
+	Color string `json:",omitempty"`
+	Label string `json:",omitempty"`
+}
+
+// OverlaySummaryJS describes an overlay without its entries.
+type OverlaySummaryJS struct {
+	Name    string
+	Entries int
+}
+
+var overlayColorRe = regexp.MustCompile(`^(#[0-9a-fA-F]{3,8}|[a-zA-Z]+)$`)
+
+type overlayStore struct {
+	mu       sync.Mutex
+	overlays map[string]*OverlayJS
+}
+
+// check validates o and fills in default End addresses.
+func (o *OverlayJS) check() error {
+	if o.Name == "" {
+		return fmt.Errorf("overlay has no name")
+	}
+	for i := range o.Entries {
+		e := &o.Entries[i]
+		if e.End == 0 {
+			e.End = e.Start + 1
+		}
+		if e.End <= e.Start {
+			return fmt.Errorf("entry %d: end 0x%x is not after start 0x%x", i, uint64(e.End), uint64(e.Start))
+		}
+		if e.Color != "" && !overlayColorRe.MatchString(e.Color) {
+			return fmt.Errorf("entry %d: bad color %q", i, e.Color)
+		}
+	}
+	sort.SliceStable(o.Entries, func(i, j int) bool {
+		return o.Entries[i].Start < o.Entries[j].Start
+	})
+	return nil
+}
+
+// put adds o, replacing any overlay with the same name.
+func (s *overlayStore) put(o *OverlayJS) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.overlays == nil {
+		s.overlays = make(map[string]*OverlayJS)
+	}
+	s.overlays[o.Name] = o
+}
+
+func (s *overlayStore) remove(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.overlays[name]
+	delete(s.overlays, name)
+	return ok
+}
+
+func (s *overlayStore) get(name string) *OverlayJS {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.overlays[name]
+}
+
+// names returns the names of all overlays in sorted order.
+func (s *overlayStore) names() []string {
+	names := make([]string, 0, len(s.overlays))
+	for name := range s.overlays {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *overlayStore) list() []OverlaySummaryJS {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []OverlaySummaryJS{}
+	for _, name := range s.names() {
+		out = append(out, OverlaySummaryJS{name, len(s.overlays[name].Entries)})
+	}
+	return out
+}
+
+// forRange returns the entries of each overlay that overlap [lo, hi).
+// Overlays with no such entries are omitted.
+func (s *overlayStore) forRange(lo, hi uint64) []OverlayJS {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []OverlayJS
+	for _, name := range s.names() {
+		var entries []OverlayEntryJS
+		for _, e := range s.overlays[name].Entries {
+			if uint64(e.Start) >= hi {
+				// Entries are sorted by Start.
+				break
+			}
+			if uint64(e.End) > lo {
+				entries = append(entries, e)
+			}
+		}
+		if entries != nil {
+			out = append(out, OverlayJS{name, entries})
+		}
+	}
+	return out
+}
+
+// httpOverlay manages overlays.
+//
+//	GET    /overlay             lists overlays
+//	GET    /overlay?name=N      serves overlay N
+//	POST   /overlay             adds or replaces the overlay in the body
+//	DELETE /overlay?name=N      removes overlay N
+//
+// Changes are announced to pages by an "overlay" event on /events.
+func httpOverlay(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		name := r.FormValue("name")
+		if name == "" {
+			serveJSON(w, overlays.list())
+			return
+		}
+		o := overlays.get(name)
+		if o == nil {
+			http.Error(w, "no such overlay", http.StatusNotFound)
+			return
+		}
+		serveJSON(w, o)
+
+	case http.MethodPost:
+		var o OverlayJS
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxOverlayBytes))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&o); err != nil {
+			http.Error(w, "bad overlay: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := o.check(); err != nil {
+			http.Error(w, "bad overlay: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		overlays.put(&o)
+		events.publish("overlay", o.Name)
+		serveJSON(w, OverlaySummaryJS{o.Name, len(o.Entries)})
+
+	case http.MethodDelete:
+		name := r.FormValue("name")
+		if !overlays.remove(name) {
+			http.Error(w, "no such overlay", http.StatusNotFound)
+			return
+		}
+		events.publish("overlay", name)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+"use strict";
+
+// parseOverlay converts the addresses in an overlay from JSON to
+// AddrJS and returns a list of ranges with an "entry" property. Unlike
+// an IntervalMap, the ranges may overlap.
+function parseOverlay(overlay) {
+    return overlay.Entries.map((e) => ({
+        start: new AddrJS(e.Start), end: new AddrJS(e.End), entry: e,
+    }));
+}
+
+// overlayEntries returns the entries of parsed overlay ranges that
+// overlap range r.
+function overlayEntries(ranges, r) {
+    return ranges.filter((o) => IntervalMap.overlap(o, r)).map((o) => o.entry);
+}
+
+// overlayText returns the text to display for an overlay entry.
+function overlayText(entry) {
+    if (entry.Label)
+        return entry.Label;
+    if (entry.Value !== undefined)
+        return String(entry.Value);
+    return "●";
+}
+
+// OverlayColumn adds a column showing an external overlay to a table.
+class OverlayColumn {
+    constructor(overlay) {
+        this._name = overlay.Name;
+        this._ranges = parseOverlay(overlay);
+    }
+
+    // render adds the column to a table, like LivenessOverlay.render.
+    render(table, rowMap) {
+        $(table.groupHeader).append($("<th>"));
+        $(table.header).append($("<th>").text(this._name).addClass("flag"));
+        for (let r of rowMap.ranges) {
+            const td = $("<td>").addClass("overlay-cell").appendTo(r.tr);
+            const entries = overlayEntries(this._ranges, r);
+            if (entries.length == 0)
+                continue;
+            td.text(entries.map(overlayText).join(" "));
+            td.attr("title", entries.map((e) => this._name + ": " + overlayText(e)).join("\n"));
+            const color = entries.find((e) => e.Color);
+            if (color)
+                td.css("background-color", color.Color);
+        }
+    }
+}
+
+// applyOverlays renders external overlays in the symbol's views.
+function applyOverlays(overlays) {
+    for (let overlay of overlays) {
+        if (asmView)
+            asmView.addOverlay(overlay);
+        if (sourceView) {
+            for (let e of overlay.Entries) {
+                const range = {start: new AddrJS(e.Start), end: new AddrJS(e.End)};
+                sourceView.markRanges([range], "sv-overlay", overlay.Name + ": " + overlayText(e), e.Color);
+            }
+        }
+    }
+
+    // Offer to reload when overlays change.
+    eventSource().addEventListener("overlay", (ev) => {
+        $(".overlay-notice").remove();
+        $("<div>").addClass("watch-notice overlay-notice watch-updated").
+            append("Overlay " + ev.data + " changed. ").
+            append($("<a>").attr("href", "").text("Reload page")).
+            appendTo(document.body);
+    });
+}
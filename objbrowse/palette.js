@@ -0,0 +1,312 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+"use strict";
+
+// CommandPalette is a Ctrl-P style palette for running the commands
+// served by /commands and jumping to symbols and addresses. It also
+// binds the commands' keyboard shortcuts.
+class CommandPalette {
+    // params are the /commands query parameters for this page.
+    constructor(params) {
+        const self = this;
+        this._commands = [];
+        this._pending = null;   // First key of a two-key shortcut
+        // onGoto, if set, is called with the URL of a symbol page
+        // chosen in the palette instead of going to it.
+        this.onGoto = null;
+        this._params = params;
+        $.getJSON("/commands", params).done((cmds) => {
+            self._commands = cmds;
+        }).fail((xhr) => {
+            showError("Commands", xhr);
+        });
+
+        this._overlay = $("<div>").addClass("palette-overlay").hide().appendTo(document.body);
+        const box = $("<div>").addClass("palette").appendTo(this._overlay);
+        this._input = $('<input type="text">').addClass("palette-input").appendTo(box);
+        this._list = $("<div>").addClass("palette-list").appendTo(box);
+        this._overlay.mousedown((ev) => {
+            if (ev.target === self._overlay[0])
+                self.close();
+        });
+        this._input.on("input", () => { self._update(); });
+        this._input.keydown((ev) => { self._inputKey(ev); });
+
+        $(window).keydown((ev) => { self._globalKey(ev); });
+    }
+
+    // open opens the palette. mode is "" to list commands, "symbol"
+    // or "address" to prompt for a symbol or address, "file" to
+    // prompt for an object file to open, or "keys" to list keyboard
+    // shortcuts.
+    open(mode) {
+        this._mode = mode || "";
+        const placeholders = {
+            "": "command, symbol, or 0x address",
+            symbol: "symbol regexp",
+            address: "hex address",
+            file: "object file path",
+            keys: "filter shortcuts",
+        };
+        if (this._mode === "file") {
+            this._files = null;
+            $.getJSON("/open").done((info) => {
+                this._files = info;
+                if (this._mode === "file")
+                    this._update();
+            }).fail((xhr) => {
+                showError("Open file", xhr);
+            });
+        }
+        this._input.val("").attr("placeholder", placeholders[this._mode]);
+        this._overlay.show();
+        this._input.focus();
+        this._update();
+    }
+
+    close() {
+        this._overlay.hide();
+        if (this._xhr)
+            this._xhr.abort();
+    }
+
+    // _globalKey handles keys outside the palette.
+    _globalKey(ev) {
+        if ((ev.ctrlKey || ev.metaKey) && (ev.key === "p" || ev.key === "k")) {
+            ev.preventDefault();
+            this.open("");
+            return;
+        }
+        if (ev.ctrlKey || ev.metaKey || ev.altKey || $(ev.target).is("input, textarea, select"))
+            return;
+        let keys = ev.key;
+        if (this._pending !== null) {
+            keys = this._pending + " " + ev.key;
+            this._pending = null;
+        } else if (ev.key === "g") {
+            this._pending = "g";
+            return;
+        }
+        const cmd = this._commands.find((c) => c.Keys === keys);
+        if (cmd) {
+            ev.preventDefault();
+            this._run(cmd);
+        }
+    }
+
+    // _inputKey handles keys in the palette's input.
+    _inputKey(ev) {
+        const items = this._list.children(".palette-item");
+        let sel = items.index(items.filter(".palette-selected"));
+        switch (ev.key) {
+        case "Escape":
+            this.close();
+            break;
+        case "ArrowDown":
+        case "ArrowUp":
+            if (items.length === 0)
+                break;
+            sel = (sel + (ev.key === "ArrowDown" ? 1 : items.length - 1)) % items.length;
+            this._select($(items[sel]));
+            break;
+        case "Enter":
+            if (sel >= 0)
+                $(items[sel]).data("run")();
+            break;
+        default:
+            return;
+        }
+        ev.preventDefault();
+    }
+
+    _select(item) {
+        this._list.children(".palette-selected").removeClass("palette-selected");
+        item.addClass("palette-selected");
+        item[0].scrollIntoView({block: "nearest"});
+    }
+
+    // _item adds an entry to the list that calls run when chosen.
+    _item(title, detail, run) {
+        const self = this;
+        const item = $("<div>").addClass("palette-item").text(title).appendTo(this._list);
+        if (detail)
+            $("<span>").addClass("palette-detail").text(detail).appendTo(item);
+        item.data("run", () => {
+            self.close();
+            run();
+        });
+        item.click(() => { item.data("run")(); });
+        if (this._list.children(".palette-selected").length === 0)
+            item.addClass("palette-selected");
+        return item;
+    }
+
+    // _update lists the entries matching the input.
+    _update() {
+        const self = this;
+        const q = this._input.val().trim();
+        this._list.empty();
+        if (this._xhr) {
+            this._xhr.abort();
+            this._xhr = null;
+        }
+
+        if (this._mode === "keys") {
+            for (let c of this._commands) {
+                if (c.Keys && matches(c.Title + " " + c.Keys))
+                    this._item(c.Title, c.Keys, () => { self._run(c); });
+            }
+            return;
+        }
+        if (this._mode === "file") {
+            if (q !== "")
+                this._item("Open " + q, "", () => { self._openFile(q); });
+            const info = this._files;
+            if (!info)
+                return;
+            $("<div>").addClass("palette-group").text("Recent files").appendTo(this._list);
+            for (let path of info.Recent) {
+                if (matches(path))
+                    this._item(path, path === info.Path ? "current" : "", () => { self._openFile(path); });
+            }
+            return;
+        }
+        if (this._mode === "" || this._mode === "address") {
+            const addr = q.replace(/^0x/i, "");
+            if (/^[0-9a-f]+$/i.test(addr) && (this._mode === "address" || /^0x/i.test(q)))
+                this._item("Go to address 0x" + addr, "", () => { self._gotoAddr(addr); });
+        }
+        if (this._mode === "") {
+            let group = null;
+            for (let c of this._commands) {
+                if (!matches(c.Group + " " + c.Title))
+                    continue;
+                if (c.Group !== group) {
+                    group = c.Group;
+                    $("<div>").addClass("palette-group").text(group).appendTo(this._list);
+                }
+                this._item(c.Title, c.Keys, () => { self._run(c); });
+            }
+        }
+        if ((this._mode === "" || this._mode === "symbol") && q !== "")
+            this._findSyms(q);
+
+        // matches reports whether s contains all words of the query.
+        function matches(s) {
+            s = s.toLowerCase();
+            return q.toLowerCase().split(/\s+/).every((w) => s.includes(w));
+        }
+    }
+
+    // _findSyms lists the symbols matching q from /syms. In symbol
+    // mode q is a regexp; otherwise it's a literal substring.
+    _findSyms(q) {
+        const self = this;
+        const limit = 20;
+        let re = q;
+        if (this._mode !== "symbol")
+            re = "(?i)" + q.replace(/[\\^$.*+?()[\]{}|]/g, "\\$&");
+        const header = $("<div>").addClass("palette-group").text("Symbols…").appendTo(this._list);
+        this._xhr = $.getJSON("/syms", {re: re, limit: limit, sort: "name", defined: 1});
+        this._xhr.done((res) => {
+            header.text(res.Total > limit ? "Symbols (" + limit + " of " + res.Total + ")" : "Symbols");
+            for (let sym of res.Syms)
+                self._item(sym[0], "", () => { self._goto(symURL(sym[0])); });
+        }).fail((xhr) => {
+            if (xhr.statusText !== "abort")
+                header.text("Symbols: " + errorText(xhr));
+        });
+    }
+
+    // _gotoAddr goes to the symbol containing hex address addr and
+    // highlights addr.
+    _gotoAddr(addr) {
+        const self = this;
+        $.getJSON("/resolve", {a: addr}).done((ptrs) => {
+            const p = ptrs[0];
+            if (!p.Sym) {
+                showError("Go to address", "no symbol at 0x" + addr + (p.Section ? " in " + p.Section : ""));
+                return;
+            }
+            const off = new AddrJS(p.Off || 0);
+            const start = new AddrJS(p.Addr).sub(off);
+            self._goto(symURL(p.Sym) + "?addr=" + start + "#+" + off + "-" + off.add(new AddrJS(1)));
+        }).fail((xhr) => {
+            showError("Go to address", xhr);
+        });
+    }
+
+    // _openFile asks the server to browse the object file at path
+    // and goes to its symbol table.
+    _openFile(path) {
+        $.post("/open", {path: path}).done(() => {
+            window.location = "/";
+        }).fail((xhr) => {
+            showError("Open file", xhr);
+        });
+    }
+
+    // _goto goes to the symbol page at url, or passes it to onGoto
+    // if the page set it.
+    _goto(url) {
+        if (this.onGoto)
+            this.onGoto(url);
+        else
+            window.location = url;
+    }
+
+    // _run runs command c.
+    _run(c) {
+        if (c.URL) {
+            window.location = c.URL;
+            return;
+        }
+        switch (c.Action) {
+        case "symbol":
+        case "address":
+        case "file":
+        case "keys":
+            this.open(c.Action);
+            break;
+        case "toggle":
+            $(".panel-col").filter((i, col) => $(col).data("view") === c.Arg).toggle();
+            break;
+        case "open": {
+            const elt = $(c.Arg).first();
+            // Opening a <details> fires its toggle event, which
+            // lazily loads most views.
+            if (elt.is("details"))
+                elt.prop("open", true);
+            if (elt.length)
+                elt[0].scrollIntoView();
+            break;
+        }
+        case "focus":
+            $(c.Arg).first().focus();
+            break;
+        case "history":
+            historyPanel.toggle();
+            break;
+        case "log":
+            serverLogPanel.toggle();
+            break;
+        case "snapshot":
+            snapshotToNotebook();
+            break;
+        case "lead":
+            sessionBar.toggleLead();
+            break;
+        case "follow":
+            sessionBar.toggleFollow();
+            break;
+        case "pin":
+            settings.set("compare.pin", JSON.parse(c.Arg)).done(() => {
+                // Refresh the comparison commands.
+                $.getJSON("/commands", this._params).done((cmds) => { this._commands = cmds; });
+            });
+            break;
+        }
+    }
+}
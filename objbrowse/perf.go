@@ -0,0 +1,241 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aclements/objbrowse/internal/perfscript"
+	"github.com/aclements/objbrowse/obj"
+)
+
+// Names of the overlays derived from perf samples.
+const (
+	perfSamplesOverlay  = "perf samples"
+	perfBranchesOverlay = "perf branches"
+)
+
+// readPerf reads the samples from a perf.data file or the output of
+// "perf script" at path. Reading perf.data requires perf.
+func readPerf(path string) ([]perfscript.Sample, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(data, []byte("PERFILE2")) {
+		// Try with branch stacks first, since perf fails if
+		// the profile doesn't have them.
+		data, err = runPerfScript(path, "-F", "comm,tid,time,period,event,ip,sym,symoff,dso,brstack")
+		if err != nil {
+			data, err = runPerfScript(path, "-F", "comm,tid,time,period,event,ip,sym,symoff,dso")
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	samples, err := perfscript.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return samples, nil
+}
+
+// runPerfScript runs "perf script" on the perf.data file at path and
+// returns its output.
+func runPerfScript(path string, args ...string) ([]byte, error) {
+	args = append([]string{"script", "-i", path}, args...)
+	out, err := exec.Command("perf", args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s: running perf script: %v (or pass perf script output instead)", path, err)
+	}
+	return out, nil
+}
+
+// perfResolver maps perf locations to addresses in the object file.
+type perfResolver struct {
+	fi      *FileInfo
+	objBase string
+	// bias is the difference between runtime addresses in the
+	// samples and addresses in the object, which is non-zero for
+	// position-independent executables.
+	bias uint64
+}
+
+func newPerfResolver(fi *FileInfo, objPath string, samples []perfscript.Sample) *perfResolver {
+	r := &perfResolver{fi: fi, objBase: filepath.Base(objPath)}
+	// Infer the load bias from samples that have both an address
+	// and a symbol.
+	biases := make(map[uint64]int)
+	for _, s := range samples {
+		if s.IP.HasAddr && s.IP.Sym != "" && r.inObj(s.IP) {
+			if id, ok := fi.SymTab.Lookup(s.IP.Sym); ok {
+				biases[s.IP.Addr-(fi.SymTab.Syms()[id].Value+s.IP.Off)]++
+			}
+		}
+	}
+	best := 0
+	for bias, n := range biases {
+		if n > best || n == best && bias < r.bias {
+			r.bias, best = bias, n
+		}
+	}
+	return r
+}
+
+// inObj reports whether loc may be in the object file.
+func (r *perfResolver) inObj(loc perfscript.Loc) bool {
+	return loc.DSO == "" || filepath.Base(loc.DSO) == r.objBase
+}
+
+// resolve returns the address of loc in the object, if loc is in a
+// text symbol of the object.
+func (r *perfResolver) resolve(loc perfscript.Loc) (uint64, bool) {
+	if !r.inObj(loc) {
+		return 0, false
+	}
+	var pc uint64
+	if loc.Sym != "" {
+		id, ok := r.fi.SymTab.Lookup(loc.Sym)
+		if !ok {
+			return 0, false
+		}
+		pc = r.fi.SymTab.Syms()[id].Value + loc.Off
+	} else if loc.HasAddr {
+		pc = loc.Addr - r.bias
+	} else {
+		return 0, false
+	}
+	id, ok := r.fi.SymTab.Addr(pc)
+	if !ok {
+		return 0, false
+	}
+	sym := r.fi.SymTab.Syms()[id]
+	if sym.Kind != obj.SymText || pc >= sym.Value+sym.Size {
+		return 0, false
+	}
+	return pc, true
+}
+
+// heatColor returns a CSS color for a fraction in [0, 1] of the
+// hottest count.
+func heatColor(frac float64) string {
+	gb := int(255 - 200*frac)
+	return fmt.Sprintf("#ff%02x%02x", gb, gb)
+}
+
+// perfOverlays returns overlays of sample counts and taken-branch
+// counts at each PC.
+func perfOverlays(fi *FileInfo, objPath string, samples []perfscript.Sample) []*OverlayJS {
+	r := newPerfResolver(fi, objPath, samples)
+
+	counts := make(map[uint64]int)
+	total := 0
+	type branchCounts struct {
+		taken, mispredict int
+		targets           map[uint64]int
+	}
+	branches := make(map[uint64]*branchCounts)
+	for _, s := range samples {
+		if pc, ok := r.resolve(s.IP); ok {
+			counts[pc]++
+			total++
+		}
+		for _, br := range s.Branches {
+			from, ok := r.resolve(br.From)
+			if !ok {
+				continue
+			}
+			bc := branches[from]
+			if bc == nil {
+				bc = &branchCounts{targets: make(map[uint64]int)}
+				branches[from] = bc
+			}
+			bc.taken++
+			if br.Mispredict {
+				bc.mispredict++
+			}
+			if to, ok := r.resolve(br.To); ok {
+				bc.targets[to]++
+			}
+		}
+	}
+
+	var out []*OverlayJS
+	if len(counts) > 0 {
+		max := 0
+		for _, n := range counts {
+			if n > max {
+				max = n
+			}
+		}
+		o := &OverlayJS{Name: perfSamplesOverlay}
+		for pc, n := range counts {
+			v := float64(n)
+			o.Entries = append(o.Entries, OverlayEntryJS{
+				Start: AddrJS(pc),
+				Value: &v,
+				Color: heatColor(float64(n) / float64(max)),
+				Label: fmt.Sprintf("%d (%.1f%%)", n, 100*float64(n)/float64(total)),
+			})
+		}
+		out = append(out, o)
+	}
+	if len(branches) > 0 {
+		max := 0
+		for _, bc := range branches {
+			if bc.taken > max {
+				max = bc.taken
+			}
+		}
+		o := &OverlayJS{Name: perfBranchesOverlay}
+		for pc, bc := range branches {
+			// List the most frequent targets.
+			type target struct {
+				pc uint64
+				n  int
+			}
+			var targets []target
+			for to, n := range bc.targets {
+				targets = append(targets, target{to, n})
+			}
+			sort.Slice(targets, func(i, j int) bool {
+				return targets[i].n > targets[j].n || targets[i].n == targets[j].n && targets[i].pc < targets[j].pc
+			})
+			label := fmt.Sprintf("taken %d", bc.taken)
+			if bc.mispredict > 0 {
+				label += fmt.Sprintf(", %d mispredicted", bc.mispredict)
+			}
+			var parts []string
+			for i, t := range targets {
+				if i == 3 {
+					parts = append(parts, "…")
+					break
+				}
+				parts = append(parts, fmt.Sprintf("→%#x ×%d", t.pc, t.n))
+			}
+			if len(parts) > 0 {
+				label += ": " + strings.Join(parts, " ")
+			}
+			v := float64(bc.taken)
+			o.Entries = append(o.Entries, OverlayEntryJS{
+				Start: AddrJS(pc),
+				Value: &v,
+				Color: heatColor(float64(bc.taken) / float64(max)),
+				Label: label,
+			})
+		}
+		out = append(out, o)
+	}
+	for _, o := range out {
+		o.check()
+	}
+	return out
+}
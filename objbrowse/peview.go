@@ -0,0 +1,105 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+
+	"github.com/aclements/objbrowse/obj"
+)
+
+// PEViewJS describes the image headers of a PE or TE file.
+type PEViewJS struct {
+	Format    string
+	Subsystem string
+	// UEFI indicates this is a UEFI image.
+	UEFI      bool
+	ImageBase AddrJS
+	Entry     *PtrJS `json:",omitempty"`
+	Dirs      []PEDirJS
+	Debug     []PEDebugJS
+	Resources []PEResourceJS
+	Depex     string   `json:",omitempty"`
+	Errors    []string `json:",omitempty"`
+}
+
+type PEDirJS struct {
+	Name string
+	// Ptr is the location of the directory, or nil for the
+	// security directory, which isn't loaded.
+	Ptr  *PtrJS `json:",omitempty"`
+	Size uint64
+}
+
+type PEDebugJS struct {
+	Type string
+	Ptr  *PtrJS `json:",omitempty"`
+	Size uint64
+	PDB  string `json:",omitempty"`
+	GUID string `json:",omitempty"`
+	Age  uint32 `json:",omitempty"`
+}
+
+type PEResourceJS struct {
+	Path     []string
+	Ptr      PtrJS
+	Size     uint64
+	CodePage uint32 `json:",omitempty"`
+}
+
+// PEView returns the image headers of the object, or nil if it isn't
+// a PE or TE file.
+func (fi *FileInfo) PEView() *PEViewJS {
+	h, ok := obj.ReadPEHeaders(fi.Obj)
+	if !ok {
+		return nil
+	}
+	ptr := func(addr uint64) *PtrJS {
+		p := fi.ResolvePtr(addr, 0)
+		return &p
+	}
+	out := &PEViewJS{
+		Format:    fi.Obj.Info().Format,
+		Subsystem: h.SubsystemName(),
+		UEFI:      h.IsUEFI(),
+		ImageBase: AddrJS(h.ImageBase),
+		Dirs:      []PEDirJS{},
+		Debug:     []PEDebugJS{},
+		Resources: []PEResourceJS{},
+		Depex:     h.Depex,
+		Errors:    h.Errors,
+	}
+	if h.Entry != 0 {
+		out.Entry = ptr(h.Entry)
+	}
+	for _, d := range h.Dirs {
+		js := PEDirJS{Name: d.Name, Size: d.Size}
+		if d.Name != "security" {
+			js.Ptr = ptr(d.Addr)
+		}
+		out.Dirs = append(out.Dirs, js)
+	}
+	for _, d := range h.Debug {
+		js := PEDebugJS{Type: d.TypeName, Size: d.Size, PDB: d.PDB, GUID: d.GUID, Age: d.Age}
+		if d.Addr != 0 {
+			js.Ptr = ptr(d.Addr)
+		}
+		out.Debug = append(out.Debug, js)
+	}
+	for _, r := range h.Resources {
+		out.Resources = append(out.Resources, PEResourceJS{r.Path, fi.ResolvePtr(r.Addr, 0), r.Size, r.CodePage})
+	}
+	return out
+}
+
+// httpPE serves the PE or TE image headers as JSON.
+func (s *state) httpPE(w http.ResponseWriter, r *http.Request) {
+	view := s.fi.PEView()
+	if view == nil {
+		http.Error(w, "not a PE or TE file", http.StatusNotFound)
+		return
+	}
+	serveJSON(w, view)
+}
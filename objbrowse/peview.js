@@ -0,0 +1,77 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+"use strict";
+
+// PEView shows the image headers of a PE or TE file: the entry point,
+// data directories, debug directory (including the PDB path),
+// resources, and UEFI dependency expression.
+class PEView {
+    constructor(container) {
+        const details = $("<details>").addClass("peview").appendTo(container);
+        $("<summary>").text("Image headers").appendTo(details);
+        const div = $("<div>").appendTo(details);
+
+        details.one("toggle", () => {
+            div.text("Loading…");
+            $.getJSON("/pe").done((data) => {
+                div.empty();
+                const table = $("<table>").appendTo(div);
+                const row = (key, val) => {
+                    $("<tr>").append($("<th>").text(key)).append($("<td>").append(val)).appendTo(table);
+                };
+                row("format", data.Format == "te" ? "TE (Terse Executable)" : "PE");
+                row("subsystem", data.Subsystem);
+                row("image base", "0x" + data.ImageBase);
+                if (data.Entry)
+                    row("entry point", PEView._ptr(data.Entry));
+                if (data.Depex)
+                    row("depex", $("<code>").text(data.Depex));
+
+                PEView._table(div, "Data directories", ["directory", "address", "size"],
+                              data.Dirs.map((d) => [d.Name, d.Ptr ? PEView._ptr(d.Ptr) : "(not loaded)", d.Size]));
+                PEView._table(div, "Debug directory", ["type", "address", "size", "PDB"],
+                              data.Debug.map((d) => {
+                                  const pdb = $("<span>");
+                                  if (d.PDB)
+                                      pdb.text(d.PDB).attr("title", "GUID " + d.GUID + ", age " + d.Age);
+                                  return [d.Type, d.Ptr ? PEView._ptr(d.Ptr) : "(not loaded)", d.Size, pdb];
+                              }));
+                PEView._table(div, "Resources", ["type / name / language", "address", "size"],
+                              data.Resources.map((r) => [r.Path.join(" / "), PEView._ptr(r.Ptr), r.Size]));
+                for (let err of data.Errors || [])
+                    $("<div>").addClass("pe-error").text(err).appendTo(div);
+            }).fail((xhr) => {
+                showError("Image headers", xhr, div.empty());
+            });
+        });
+    }
+
+    // _table adds a table with a heading to div, or nothing if rows is
+    // empty.
+    static _table(div, title, headers, rows) {
+        if (rows.length == 0)
+            return;
+        $("<h4>").text(title).appendTo(div);
+        const table = $("<table>").addClass("pe-table").appendTo(div);
+        $("<tr>").append(headers.map((h) => $("<th>").text(h))).appendTo(table);
+        for (let r of rows)
+            $("<tr>").append(r.map((v) => $("<td>").append(v))).appendTo(table);
+    }
+
+    // _ptr returns a node describing PtrJS p, linking to the symbol
+    // containing it if there is one.
+    static _ptr(p) {
+        const span = $("<span>").text("0x" + p.Addr);
+        if (p.Sym) {
+            const off = new AddrJS(p.Off ? p.Off.toString(16) : "0");
+            const range = {start: off, end: off.add(new AddrJS(1))};
+            span.append(" ").append($("<a>").attr("href", "/s/" + p.Sym + "#+" + formatRanges([range])).
+                                    text(p.Sym + (p.Off ? "+0x" + p.Off.toString(16) : "")));
+        } else if (p.Section) {
+            span.append(" (" + p.Section + ")");
+        }
+        return span;
+    }
+}
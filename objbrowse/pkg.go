@@ -0,0 +1,221 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// A pkgBuild builds the -pkg main package into a temporary directory
+// and tracks the workspace sources it depends on, so the server can
+// rebuild when they change.
+type pkgBuild struct {
+	pkg string
+	out string
+
+	// files are the workspace source files and directories of
+	// the last successful listing.
+	files []string
+	// roots are the workspace module (or GOPATH package)
+	// directories.
+	roots []string
+}
+
+// listPkg is the subset of go list -json output pkgBuild uses.
+type listPkg struct {
+	Dir        string
+	ImportPath string
+	Name       string
+	DepOnly    bool
+	Standard   bool
+	Module     *struct {
+		Path    string
+		Main    bool
+		GoMod   string
+		Replace *struct {
+			Version string
+		}
+	}
+}
+
+// pkgSourceExts are the extensions of files that go build reads.
+var pkgSourceExts = map[string]bool{
+	".go": true, ".s": true, ".c": true, ".h": true, ".cc": true, ".cpp": true, ".syso": true,
+}
+
+// newPkgBuild checks that pkg is a single main package and prepares
+// to build it.
+func newPkgBuild(pkg string) (*pkgBuild, error) {
+	b := &pkgBuild{pkg: pkg}
+	pkgs, err := b.list()
+	if err != nil {
+		return nil, err
+	}
+	var roots []listPkg
+	for _, p := range pkgs {
+		if !p.DepOnly {
+			roots = append(roots, p)
+		}
+	}
+	if len(roots) != 1 {
+		return nil, fmt.Errorf("-pkg %s matches %d packages; want one", pkg, len(roots))
+	}
+	if roots[0].Name != "main" {
+		return nil, fmt.Errorf("-pkg %s is package %s, not a main package", pkg, roots[0].Name)
+	}
+
+	dir, err := ioutil.TempDir("", "objbrowse")
+	if err != nil {
+		return nil, err
+	}
+	atExit(func() { os.RemoveAll(dir) })
+	b.out = filepath.Join(dir, filepath.Base(roots[0].ImportPath))
+	return b, nil
+}
+
+// list runs go list on the package and its dependencies and records
+// the workspace files to watch.
+func (b *pkgBuild) list() ([]listPkg, error) {
+	cmd := exec.Command("go", "list", "-deps", "-json", b.pkg)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("go list %s: %v\n%s", b.pkg, err, stderr.Bytes())
+	}
+	var pkgs []listPkg
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for {
+		var p listPkg
+		if err := dec.Decode(&p); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("go list %s: %v", b.pkg, err)
+		}
+		pkgs = append(pkgs, p)
+	}
+
+	// Watch packages in the workspace. Other modules come from
+	// the read-only module cache.
+	var files, roots []string
+	seen := make(map[string]bool)
+	add := func(list *[]string, path string) {
+		if path != "" && !seen[path] {
+			seen[path] = true
+			*list = append(*list, path)
+		}
+	}
+	for _, p := range pkgs {
+		if p.Standard {
+			continue
+		}
+		if m := p.Module; m == nil {
+			add(&files, p.Dir)
+			add(&roots, p.Dir)
+		} else if m.Main || m.Replace != nil && m.Replace.Version == "" {
+			add(&files, p.Dir)
+			add(&files, m.GoMod)
+			if m.GoMod != "" {
+				add(&roots, filepath.Dir(m.GoMod))
+			}
+		}
+	}
+	b.files, b.roots = files, roots
+	return pkgs, nil
+}
+
+// command returns the command that builds the package.
+func (b *pkgBuild) command() *exec.Cmd {
+	args := []string{"build", "-o", b.out}
+	if *flagGCFlags != "" {
+		args = append(args, "-gcflags="+*flagGCFlags)
+	}
+	return exec.Command("go", append(args, b.pkg)...)
+}
+
+// sourceRoots returns the directories containing the workspace
+// sources, and GOROOT's, for the source policy.
+func (b *pkgBuild) sourceRoots() []string {
+	roots := append([]string(nil), b.roots...)
+	if out, err := exec.Command("go", "env", "GOROOT").Output(); err == nil {
+		if goroot := strings.TrimSpace(string(out)); goroot != "" {
+			roots = append(roots, filepath.Join(goroot, "src"))
+		}
+	}
+	return roots
+}
+
+// hashSources returns a hash of the names, sizes, and modification
+// times of the workspace source files.
+func (b *pkgBuild) hashSources() uint64 {
+	h := fnv.New64a()
+	stat := func(path string, fi os.FileInfo) {
+		fmt.Fprintf(h, "%s %d %d\n", path, fi.Size(), fi.ModTime().UnixNano())
+	}
+	for _, path := range b.files {
+		fi, err := os.Stat(path)
+		if err != nil {
+			fmt.Fprintf(h, "%s missing\n", path)
+			continue
+		}
+		if !fi.IsDir() {
+			stat(path, fi)
+			continue
+		}
+		ents, err := ioutil.ReadDir(path)
+		if err != nil {
+			continue
+		}
+		for _, ent := range ents {
+			if !ent.IsDir() && pkgSourceExts[filepath.Ext(ent.Name())] {
+				stat(filepath.Join(path, ent.Name()), ent)
+			}
+		}
+	}
+	return h.Sum64()
+}
+
+// watchSources polls the -pkg workspace sources and rebuilds the
+// package when they change. The object watcher then reloads the new
+// binary. It never returns.
+func (srv *server) watchSources() {
+	b := srv.pkg
+	last := b.hashSources()
+	var pending uint64
+	for range time.Tick(time.Second) {
+		h := b.hashSources()
+		if h == last {
+			pending = 0
+			continue
+		}
+		// Wait for the editor to finish saving.
+		if h != pending {
+			pending = h
+			continue
+		}
+		last, pending = h, 0
+
+		logger.Info("sources changed; rebuilding", "pkg", b.pkg)
+		if out, err := srv.build(); err != nil {
+			logger.Error("build failed", "pkg", b.pkg, "err", err, "output", string(out))
+			continue
+		}
+		// The change may have added imports or files.
+		if _, err := b.list(); err != nil {
+			logger.Warn("listing package", "pkg", b.pkg, "err", err)
+		}
+		last = b.hashSources()
+	}
+}
@@ -0,0 +1,214 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/aclements/objbrowse/internal/config"
+	"github.com/aclements/objbrowse/obj"
+)
+
+// A Plugin is a symbol view implemented by an external program, so
+// views can be added without modifying objbrowse.
+//
+// A plugin is a directory containing a plugin.toml file with these
+// keys:
+//
+//	name     the view's name, which must be unique
+//	command  the program to run and its arguments, as an array;
+//	         a relative program path is relative to the directory
+//	kinds    optionally, the symbol kinds to run on, as an array of
+//	         "text", "data", "rodata", and "bss"; the default is all
+//	script   optionally, a JavaScript file in the directory that
+//	         renders the view
+//	timeout  optionally, the time limit for each run in seconds;
+//	         the default is 10
+//
+// For each symbol page, objbrowse runs the command with the path of
+// the object file and the symbol name as two additional arguments and
+// a PluginRequestJS on stdin. The command must write a JSON value to
+// stdout, which is passed to the page.
+//
+// If the plugin has a script, the page loads it from
+// /plugins/<name>/<script> and the script should call
+//
+//	registerPluginView(name, class)
+//
+// where the class constructor takes the JSON value and a container
+// element. Otherwise, the page renders the value with PluginView,
+// which understands objects with a "Text" string and/or a "Columns"
+// and "Rows" table. Other files in the directory are also served
+// under /plugins/<name>/.
+type Plugin struct {
+	Name    string
+	dir     string
+	command []string
+	kinds   map[obj.SymKind]bool
+	script  string
+	timeout time.Duration
+}
+
+// PluginRequestJS is the input to a plugin.
+type PluginRequestJS struct {
+	Path string
+	Sym  PluginSymJS
+}
+
+type PluginSymJS struct {
+	Name string
+	Addr AddrJS
+	Size uint64
+	Kind string // "text", "data", "rodata", "bss", or "other"
+	Data []byte // Base64 in JSON
+}
+
+// PluginViewJS is the output of a plugin for a symbol.
+type PluginViewJS struct {
+	Name   string
+	Script string          `json:",omitempty"`
+	Data   json.RawMessage `json:",omitempty"`
+	Error  string          `json:",omitempty"`
+}
+
+var pluginKinds = map[string]obj.SymKind{
+	"text":   obj.SymText,
+	"data":   obj.SymData,
+	"rodata": obj.SymROData,
+	"bss":    obj.SymBSS,
+}
+
+func pluginKindName(kind obj.SymKind) string {
+	for name, k := range pluginKinds {
+		if k == kind {
+			return name
+		}
+	}
+	return "other"
+}
+
+// loadPlugin loads the plugin in directory dir.
+func loadPlugin(dir string) (*Plugin, error) {
+	file := filepath.Join(dir, "plugin.toml")
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	settings, err := config.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	p := &Plugin{dir: dir, timeout: 10 * time.Second}
+	for _, s := range settings {
+		bad := func(msg string) error {
+			return fmt.Errorf("%s:%d: %s %s", file, s.Line, s.Key, msg)
+		}
+		if !s.IsArray && len(s.Values) != 1 {
+			return nil, bad("must have a value")
+		}
+		switch s.Key {
+		case "name":
+			p.Name = s.Values[0]
+		case "command":
+			if !s.IsArray || len(s.Values) == 0 {
+				return nil, bad("must be a non-empty array")
+			}
+			p.command = s.Values
+		case "kinds":
+			p.kinds = make(map[obj.SymKind]bool)
+			for _, k := range s.Values {
+				kind, ok := pluginKinds[k]
+				if !ok {
+					return nil, bad(fmt.Sprintf("has unknown kind %q", k))
+				}
+				p.kinds[kind] = true
+			}
+		case "script":
+			p.script = s.Values[0]
+		case "timeout":
+			secs, err := strconv.Atoi(s.Values[0])
+			if err != nil || secs <= 0 {
+				return nil, bad("must be a positive number of seconds")
+			}
+			p.timeout = time.Duration(secs) * time.Second
+		default:
+			return nil, fmt.Errorf("%s:%d: unknown key %q", file, s.Line, s.Key)
+		}
+	}
+	if p.Name == "" || p.command == nil {
+		return nil, fmt.Errorf("%s: name and command are required", file)
+	}
+	if !validPluginName(p.Name) {
+		return nil, fmt.Errorf("%s: bad plugin name %q", file, p.Name)
+	}
+	if prog := p.command[0]; filepath.Base(prog) != prog && !filepath.IsAbs(prog) {
+		p.command[0] = filepath.Join(dir, prog)
+	}
+	return p, nil
+}
+
+func validPluginName(name string) bool {
+	for _, c := range name {
+		if !(c == '-' || c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z') {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// handleStatic serves the plugin's directory under /plugins/<name>/.
+func (p *Plugin) handleStatic() {
+	prefix := "/plugins/" + p.Name + "/"
+	http.Handle(prefix, http.StripPrefix(prefix, http.FileServer(http.Dir(p.dir))))
+}
+
+// run runs the plugin on sym, whose contents are data, in the object
+// file at path. It returns nil if the plugin doesn't apply to sym.
+func (p *Plugin) run(path string, sym obj.Sym, data []byte) *PluginViewJS {
+	if p.kinds != nil && !p.kinds[sym.Kind] {
+		return nil
+	}
+	view := &PluginViewJS{Name: p.Name}
+	if p.script != "" {
+		view.Script = "/plugins/" + p.Name + "/" + p.script
+	}
+
+	req, err := json.Marshal(PluginRequestJS{path, PluginSymJS{sym.Name, AddrJS(sym.Value), sym.Size, pluginKindName(sym.Kind), data}})
+	if err != nil {
+		view.Error = err.Error()
+		return view
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+	args := append(p.command[1:len(p.command):len(p.command)], path, sym.Name)
+	cmd := exec.CommandContext(ctx, p.command[0], args...)
+	cmd.Dir = p.dir
+	cmd.Stdin = bytes.NewReader(req)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		view.Error = fmt.Sprintf("%v\n%s", err, stderr.Bytes())
+		return view
+	}
+	if !json.Valid(out) {
+		view.Error = "plugin output is not valid JSON"
+		return view
+	}
+	view.Data = out
+	return view
+}
@@ -0,0 +1,52 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+"use strict";
+
+// pluginViews maps plugin names to the view classes registered by
+// their scripts.
+const pluginViews = {};
+
+// registerPluginView registers cls as the view for plugin name. The
+// constructor of cls takes the plugin's output and a container
+// element.
+function registerPluginView(name, cls) {
+    pluginViews[name] = cls;
+}
+
+// PluginView shows the output of a plugin that doesn't have its own
+// script. It displays a "Text" string and a table of "Columns" and
+// "Rows", or the raw JSON if the output has neither.
+class PluginView {
+    constructor(plugin, container) {
+        $(container).addClass("pluginview");
+        $("<h2>").text(plugin.Name).appendTo(container);
+        if (plugin.Error) {
+            $("<pre>").addClass("plugin-error").text(plugin.Error).appendTo(container);
+            return;
+        }
+        const data = plugin.Data;
+        let shown = false;
+        if (data && typeof data.Text == "string") {
+            $("<pre>").text(data.Text).appendTo(container);
+            shown = true;
+        }
+        if (data && Array.isArray(data.Rows)) {
+            const table = $("<table>").appendTo(container);
+            if (Array.isArray(data.Columns)) {
+                const tr = $("<tr>").appendTo(table);
+                for (let col of data.Columns)
+                    $("<th>").text(col).appendTo(tr);
+            }
+            for (let row of data.Rows) {
+                const tr = $("<tr>").appendTo(table);
+                for (let cell of row)
+                    $("<td>").text(cell).appendTo(tr);
+            }
+            shown = true;
+        }
+        if (!shown)
+            $("<pre>").text(JSON.stringify(data, null, 2)).appendTo(container);
+    }
+}
@@ -0,0 +1,129 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/aclements/objbrowse/obj"
+)
+
+// ProbeJS is how to attach a kprobe or uprobe to an instruction.
+type ProbeJS struct {
+	Addr AddrJS
+	// Sym and Off locate Addr in its function, if any.
+	Sym string `json:",omitempty"`
+	Off uint64 `json:",omitempty"`
+	// Kernel indicates the object looks like a Linux kernel, so
+	// the instruction takes a kprobe rather than a uprobe.
+	Kernel bool `json:",omitempty"`
+	// Location is Addr as kprobe_events or uprobe_events takes
+	// it: "sym+0xoff" for kprobes or "path:0xoffset" for uprobes,
+	// where offset is the offset in the file.
+	Location string `json:",omitempty"`
+	// Event is a probe definition line for kprobe_events or
+	// uprobe_events.
+	Event string `json:",omitempty"`
+	// Bpftrace is the bpftrace probe for Addr.
+	Bpftrace string `json:",omitempty"`
+	// Warnings are reasons the probe may not attach as expected.
+	Warnings []string `json:",omitempty"`
+}
+
+// isKernel reports whether the object looks like a Linux kernel.
+func (s *state) isKernel() bool {
+	_, ok := s.symTab.Lookup("linux_banner")
+	return ok
+}
+
+// fileOffset returns the offset in the object's file of the bytes
+// loaded at addr, or false if addr isn't loaded from the file.
+func (s *state) fileOffset(addr uint64) (uint64, bool) {
+	segs, _ := obj.ReadELFSegments(s.bin)
+	for _, seg := range segs {
+		if seg.Type == "PT_LOAD" && seg.Addr <= addr && addr-seg.Addr < seg.FileSize {
+			return seg.Offset + (addr - seg.Addr), true
+		}
+	}
+	return 0, false
+}
+
+// probeEventName returns a tracefs event name for a probe at sym+off.
+// Event names may only contain letters, digits, and underscores.
+func probeEventName(sym string, off uint64) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '_' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' {
+			return r
+		}
+		return '_'
+	}, sym)
+	if name == "" || '0' <= name[0] && name[0] <= '9' {
+		name = "p_" + name
+	}
+	return fmt.Sprintf("%s_%x", name, off)
+}
+
+// probe returns how to probe the instruction at addr.
+func (s *state) probe(addr uint64) ProbeJS {
+	p := ProbeJS{Addr: AddrJS(addr), Kernel: s.isKernel()}
+	id, ok := s.symTab.Addr(addr)
+	if ok {
+		if sym := s.symTab.Syms()[id]; sym.Kind == obj.SymText && sym.Value != 0 {
+			p.Sym, p.Off = sym.Name, addr-sym.Value
+			if len(s.symTab.Name(sym.Name)) > 1 {
+				p.Warnings = append(p.Warnings, fmt.Sprintf("more than one symbol is named %s, so the probe may attach to another", sym.Name))
+			}
+		}
+	}
+	symOff := fmt.Sprintf("%s+%#x", p.Sym, p.Off)
+	event := "objbrowse/" + probeEventName("addr", addr)
+	if p.Sym != "" {
+		event = "objbrowse/" + probeEventName(p.Sym, p.Off)
+	}
+
+	if p.Kernel {
+		if p.Sym == "" {
+			p.Warnings = append(p.Warnings, "kprobes need a function symbol")
+			return p
+		}
+		p.Location = symOff
+		p.Event = "p:" + event + " " + symOff
+		p.Bpftrace = "kprobe:" + symOff
+		return p
+	}
+
+	path, err := filepath.Abs(s.fi.Path)
+	if err != nil {
+		path = s.fi.Path
+	}
+	off, ok := s.fileOffset(addr)
+	if !ok {
+		p.Warnings = append(p.Warnings, "uprobes need an address loaded from an ELF file")
+		return p
+	}
+	p.Location = fmt.Sprintf("%s:%#x", path, off)
+	p.Event = "p:" + event + " " + p.Location
+	if p.Sym != "" {
+		p.Bpftrace = fmt.Sprintf("uprobe:%s:%s", path, symOff)
+	} else {
+		p.Bpftrace = fmt.Sprintf("uprobe:%s:%#x", path, addr)
+	}
+	return p
+}
+
+// httpProbe serves how to probe the instruction at the hex address in
+// the "a" parameter as a ProbeJS.
+func (s *state) httpProbe(w http.ResponseWriter, r *http.Request) {
+	addr, err := strconv.ParseUint(strings.TrimPrefix(r.FormValue("a"), "0x"), 16, 64)
+	if err != nil {
+		http.Error(w, "bad address", http.StatusBadRequest)
+		return
+	}
+	serveJSON(w, s.probe(addr))
+}
@@ -0,0 +1,275 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/aclements/objbrowse/obj"
+)
+
+// queryUsage describes the queries understood by runQuery.
+const queryUsage = `Queries:
+  syms [regexp] [key=value...]
+	list symbols whose names match regexp, as JSON; keys are sort,
+	kind, minsize, maxsize, defined, local, weak, dynamic, pkg,
+	offset, and limit, as in the /syms API
+  disasm symbol [id=N | addr=HEX]
+	disassemble a function, as JSON
+  object symbol [id=N | addr=HEX]
+	write a function as a relocatable ELF object to standard output
+  section name
+	write the raw contents of a section to standard output
+  addr hex...
+	resolve addresses to symbols, sections, and source lines, as JSON
+  probe hex...
+	show how to attach a kprobe or uprobe to instructions, as JSON
+  section-audit [bss=BYTES] [fail=error|warning|none]
+	audit section permissions and RELRO coverage, as JSON; fails if
+	there are findings of at least the fail severity (default error)
+  type dwarf|btf name
+	show the memory layout of a type, such as "struct task_struct",
+	as JSON
+`
+
+// QuerySymJS is a symbol in the result of a syms query. Unlike
+// SymViewSymsJS, it's meant to be easy to consume from scripts.
+type QuerySymJS struct {
+	Name    string
+	Kind    string
+	Addr    AddrJS
+	Size    uint64
+	Local   bool   `json:",omitempty"`
+	Attrs   string `json:",omitempty"`
+	Version string `json:",omitempty"`
+}
+
+// QueryAddrJS is a resolved address in the result of an addr query.
+type QueryAddrJS struct {
+	PtrJS
+	File string `json:",omitempty"`
+	Line int    `json:",omitempty"`
+}
+
+// queryMain evaluates query against the object at path without
+// starting the server, writes the result to standard output, and
+// returns the process exit status.
+func queryMain(path, query string) int {
+	if isRemote(path) {
+		var err error
+		path, err = fetchObj(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+		defer os.RemoveAll(filepath.Dir(path))
+	}
+	// Don't mix SSA dumps into query results.
+	ssaDump = nil
+	s, err := open(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	if err := s.runQuery(query); err != nil {
+		fmt.Fprintf(os.Stderr, "query %q: %v\n", query, err)
+		return 1
+	}
+	return 0
+}
+
+// runQuery evaluates query and writes its result to standard output.
+// See queryUsage for the queries.
+func (s *state) runQuery(query string) error {
+	args := strings.Fields(query)
+	if len(args) == 0 {
+		return fmt.Errorf("empty query")
+	}
+	enc := json.NewEncoder(os.Stdout)
+	switch op, args := args[0], args[1:]; op {
+	default:
+		return fmt.Errorf("unknown query %q\n\n%s", op, queryUsage)
+
+	case "syms":
+		vals := url.Values{}
+		for _, arg := range args {
+			if i := strings.Index(arg, "="); i >= 0 {
+				vals.Set(arg[:i], arg[i+1:])
+			} else if vals.Get("re") == "" {
+				vals.Set("re", arg)
+			} else {
+				return fmt.Errorf("more than one regexp")
+			}
+		}
+		q, err := parseSymQuery(vals)
+		if err != nil {
+			return err
+		}
+		out := []QuerySymJS{}
+		for _, sym := range s.symView.Query(q).Syms.Syms {
+			out = append(out, QuerySymJS{
+				Name:    sym.Name,
+				Kind:    string(rune(sym.Kind)),
+				Addr:    AddrJS(sym.Value),
+				Size:    sym.Size,
+				Local:   sym.Local,
+				Attrs:   symAttrs(sym),
+				Version: sym.Version,
+			})
+		}
+		return enc.Encode(out)
+
+	case "disasm":
+		id, err := s.querySym(args)
+		if err != nil {
+			return err
+		}
+		sym := s.symTab.Syms()[id]
+		data, err := s.bin.SymbolData(id)
+		if err != nil {
+			return err
+		}
+		info, err := s.asmView.DecodeSym(sym, data.P)
+		if err != nil {
+			return err
+		}
+		if info == nil {
+			return fmt.Errorf("%s is not a function", sym.Name)
+		}
+		return enc.Encode(info)
+
+	case "object":
+		id, err := s.querySym(args)
+		if err != nil {
+			return err
+		}
+		f, err := s.extractObj(id)
+		if err != nil {
+			return err
+		}
+		_, err = f.WriteTo(os.Stdout)
+		return err
+
+	case "section":
+		if len(args) != 1 {
+			return fmt.Errorf("want one section name")
+		}
+		for i, sect := range s.bin.Sections() {
+			if sect.Name != args[0] {
+				continue
+			}
+			data, err := s.bin.SectionData(i)
+			if err != nil {
+				return err
+			}
+			_, err = os.Stdout.Write(data.P)
+			return err
+		}
+		return fmt.Errorf("unknown section %q", args[0])
+
+	case "probe":
+		out := []ProbeJS{}
+		for _, arg := range args {
+			addr, err := strconv.ParseUint(strings.TrimPrefix(arg, "0x"), 16, 64)
+			if err != nil {
+				return fmt.Errorf("bad address %q", arg)
+			}
+			out = append(out, s.probe(addr))
+		}
+		return enc.Encode(out)
+
+	case "section-audit":
+		bssLimit, fail := uint64(defaultBSSLimit), "error"
+		for _, arg := range args {
+			i := strings.Index(arg, "=")
+			if i < 0 {
+				return fmt.Errorf("bad argument %q", arg)
+			}
+			switch key, val := arg[:i], arg[i+1:]; key {
+			case "bss":
+				var err error
+				bssLimit, err = strconv.ParseUint(val, 0, 64)
+				if err != nil {
+					return fmt.Errorf("bad bss limit %q", val)
+				}
+			case "fail":
+				if _, ok := auditSeverities[val]; !ok && val != "none" {
+					return fmt.Errorf("bad fail severity %q", val)
+				}
+				fail = val
+			default:
+				return fmt.Errorf("unknown argument %q", key)
+			}
+		}
+		out := s.auditSections(bssLimit)
+		if err := enc.Encode(out); err != nil {
+			return err
+		}
+		n := 0
+		for _, f := range out.Findings {
+			if fail != "none" && auditSeverities[f.Severity] >= auditSeverities[fail] {
+				n++
+			}
+		}
+		if n > 0 {
+			return fmt.Errorf("%d findings at or above %s", n, fail)
+		}
+		return nil
+
+	case "type":
+		if len(args) < 2 {
+			return fmt.Errorf("want a type source and a type name")
+		}
+		src, ok := s.valueView.sources[args[0]]
+		if !ok {
+			return fmt.Errorf("unknown type source %q", args[0])
+		}
+		name := strings.Join(args[1:], " ")
+		typ, err := src.Type(name)
+		if err != nil {
+			return err
+		}
+		if typ == nil {
+			return fmt.Errorf("no type %q", name)
+		}
+		return enc.Encode(typeLayout(name, typ))
+
+	case "addr":
+		out := []QueryAddrJS{}
+		for _, arg := range args {
+			addr, err := strconv.ParseUint(strings.TrimPrefix(arg, "0x"), 16, 64)
+			if err != nil {
+				return fmt.Errorf("bad address %q", arg)
+			}
+			a := QueryAddrJS{PtrJS: s.fi.ResolvePtr(addr, 0)}
+			a.File, a.Line = s.fi.Line(addr)
+			out = append(out, a)
+		}
+		return enc.Encode(out)
+	}
+}
+
+// querySym looks up the symbol named by query arguments of the form
+// "symbol [id=N | addr=HEX]".
+func (s *state) querySym(args []string) (obj.SymID, error) {
+	if len(args) == 0 {
+		return 0, fmt.Errorf("missing symbol name")
+	}
+	vals := url.Values{}
+	for _, arg := range args[1:] {
+		i := strings.Index(arg, "=")
+		if i < 0 {
+			return 0, fmt.Errorf("bad argument %q", arg)
+		}
+		vals.Set(arg[:i], arg[i+1:])
+	}
+	return s.lookupSym(args[0], vals)
+}
@@ -0,0 +1,175 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aclements/objbrowse/internal/asm"
+	"github.com/aclements/objbrowse/obj"
+)
+
+// maxRangeStats limits the total bytes a range stats request may
+// cover.
+const maxRangeStats = 1 << 20
+
+// RangeStatsJS summarizes the instructions in a set of PC ranges.
+type RangeStatsJS struct {
+	Insts int
+	// Loads, Stores, Branches, Calls, and SIMD count the
+	// instructions of each class. An instruction may be in more
+	// than one class.
+	Loads, Stores, Branches, Calls, SIMD int
+	// Cycles is a rough static estimate of the cycles to execute
+	// each instruction once: the sum of their reciprocal
+	// throughputs. It ignores dependencies, so it's a lower
+	// bound for straight-line code.
+	Cycles float64
+	// Ops counts instructions by mnemonic, most frequent first.
+	Ops []RangeCountJS
+	// Syms counts operand references to symbols, and CallTargets
+	// counts direct calls, most frequent first.
+	Syms        []RangeCountJS
+	CallTargets []RangeCountJS
+}
+
+type RangeCountJS struct {
+	Name  string
+	Count int
+}
+
+// RangeStats computes statistics over the instructions that start in
+// ranges, each of which is [start, end).
+func (fi *FileInfo) RangeStats(ranges [][2]uint64) (*RangeStatsJS, error) {
+	var out RangeStatsJS
+	ops := make(map[string]int)
+	syms := make(map[string]int)
+	calls := make(map[string]int)
+	for _, r := range ranges {
+		// Find the text symbols overlapping r, including the
+		// one containing its start.
+		ids := fi.SymTab.InRange(r[0], r[1])
+		if id, ok := fi.SymTab.Addr(r[0]); ok {
+			ids = append([]obj.SymID{id}, ids...)
+		}
+		seen := make(map[uint64]bool)
+		for _, id := range ids {
+			sym := fi.SymTab.Syms()[id]
+			if sym.Kind != obj.SymText || sym.Size == 0 || seen[sym.Value] {
+				continue
+			}
+			seen[sym.Value] = true
+			insts, err := fi.Disasm(id)
+			if err != nil {
+				return nil, err
+			}
+			for i := 0; i < insts.Len(); i++ {
+				inst := insts.Get(i)
+				if inst.PC() < r[0] || inst.PC() >= r[1] {
+					continue
+				}
+				out.Insts++
+				c := inst.Class()
+				if c&asm.ClassLoad != 0 {
+					out.Loads++
+				}
+				if c&asm.ClassStore != 0 {
+					out.Stores++
+				}
+				if c&asm.ClassBranch != 0 {
+					out.Branches++
+				}
+				if c&asm.ClassCall != 0 {
+					out.Calls++
+				}
+				if c&asm.ClassSIMD != 0 {
+					out.SIMD++
+				}
+				out.Cycles += inst.Cycles()
+				// Count operand references, but not
+				// branch targets.
+				target := inst.Control().TargetPC
+				disasm := inst.GoSyntax(func(addr uint64) (string, uint64) {
+					name, base := fi.SymTab.SymName(addr)
+					if name != "" && addr != target {
+						syms[name]++
+					}
+					return name, base
+				})
+				op, _ := parseAsm(disasm)
+				ops[op]++
+				if callee := fi.CallTarget(inst); callee != "" {
+					calls[callee]++
+				}
+			}
+		}
+	}
+	out.Ops = sortCounts(ops)
+	out.Syms = sortCounts(syms)
+	out.CallTargets = sortCounts(calls)
+	return &out, nil
+}
+
+// sortCounts returns the entries of m, most frequent first.
+func sortCounts(m map[string]int) []RangeCountJS {
+	out := []RangeCountJS{}
+	for name, n := range m {
+		out = append(out, RangeCountJS{name, n})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+// parseRanges parses address ranges in the URL fragment syntax,
+// "start-end,start-end", where addresses are in hex.
+func parseRanges(s string) ([][2]uint64, error) {
+	var out [][2]uint64
+	for _, r := range strings.Split(s, ",") {
+		i := strings.Index(r, "-")
+		if i < 0 {
+			return nil, fmt.Errorf("bad range %q", r)
+		}
+		start, err1 := strconv.ParseUint(r[:i], 16, 64)
+		end, err2 := strconv.ParseUint(r[i+1:], 16, 64)
+		if err1 != nil || err2 != nil || end < start {
+			return nil, fmt.Errorf("bad range %q", r)
+		}
+		out = append(out, [2]uint64{start, end})
+	}
+	return out, nil
+}
+
+// httpRangeStats serves statistics for the PC ranges in the "r" query
+// parameter.
+func (s *state) httpRangeStats(w http.ResponseWriter, r *http.Request) {
+	ranges, err := parseRanges(r.FormValue("r"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var total uint64
+	for _, r := range ranges {
+		total += r[1] - r[0]
+	}
+	if total > maxRangeStats {
+		http.Error(w, fmt.Sprintf("ranges cover more than %d bytes", maxRangeStats), http.StatusBadRequest)
+		return
+	}
+	stats, err := s.fi.RangeStats(ranges)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	serveJSON(w, stats)
+}
@@ -0,0 +1,50 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	"github.com/aclements/objbrowse/arch"
+	"github.com/aclements/objbrowse/obj"
+)
+
+// openRaw loads the flat binary image at path as described by the
+// -arch, -base, and -syms flags.
+func openRaw(path string) (obj.Obj, error) {
+	a := arch.Lookup(*flagRawArch)
+	if a == nil {
+		return nil, fmt.Errorf("-raw requires -arch to be a known GOARCH, not %q", *flagRawArch)
+	}
+	base, err := strconv.ParseUint(*flagRawBase, 0, 64)
+	if err != nil {
+		return nil, fmt.Errorf("bad -base %q", *flagRawBase)
+	}
+	f, err := openDecompressed(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	var syms []obj.Sym
+	if *flagRawSyms != "" {
+		f, err := os.Open(*flagRawSyms)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		syms, err = obj.ReadSymbolFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", *flagRawSyms, err)
+		}
+	}
+	return obj.OpenRaw(data, a, base, syms), nil
+}
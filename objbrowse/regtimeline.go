@@ -0,0 +1,161 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"sort"
+
+	"github.com/aclements/objbrowse/internal/dwexpr"
+	"github.com/aclements/objbrowse/obj"
+)
+
+// RegTimelineJS shows where each variable of a function lives across
+// the function's PCs.
+type RegTimelineJS struct {
+	Start, End AddrJS
+	Rows       []RegRowJS
+}
+
+type RegRowJS struct {
+	Name  string
+	Param bool `json:",omitempty"`
+	Depth int  `json:",omitempty"`
+	// Segs are the PC ranges where the variable has a location,
+	// in PC order. The variable is optimized out elsewhere.
+	Segs []RegSegJS
+	// Spills is the number of times the variable moves from a
+	// register to the stack.
+	Spills int `json:",omitempty"`
+}
+
+// RegSegJS is a PC range where a variable has a single location.
+type RegSegJS struct {
+	Start, End AddrJS
+	// Kind is "reg", "stack", "mem" (other memory), "value" (a
+	// computed or constant value), or "split" (in pieces).
+	Kind string
+	// Where is the register name or location expression.
+	Where string
+}
+
+// RegTimeline returns the location timeline of the variables of
+// function sym.
+func (v *VarView) RegTimeline(sym obj.Sym) (*RegTimelineJS, error) {
+	a := v.fi.Obj.Info().Arch
+	if sym.Kind != obj.SymText || a == nil {
+		return nil, nil
+	}
+	fv, err := v.funcVars(sym.Value)
+	if fv == nil || err != nil {
+		return nil, err
+	}
+	f := v.formatter(fv.enc)
+	start, end := sym.Value, sym.Value+sym.Size
+
+	// seg classifies location expression expr over [lo, hi).
+	seg := func(lo, hi uint64, expr []byte) RegSegJS {
+		s := RegSegJS{Start: AddrJS(lo), End: AddrJS(hi), Where: f.Format(expr)}
+		ops, err := dwexpr.Decode(expr, fv.enc)
+		if err != nil {
+			s.Kind = "value"
+			return s
+		}
+		shape := dwexpr.ShapeOf(ops)
+		switch shape.Kind {
+		case dwexpr.LocReg:
+			s.Kind = "reg"
+			if name := a.DWARFRegName(shape.Reg); name != "" {
+				s.Where = name
+			}
+		case dwexpr.LocMem:
+			if shape.Frame || (shape.HasBase && a.IsDWARFStackReg(shape.Reg)) {
+				s.Kind = "stack"
+			} else {
+				s.Kind = "mem"
+			}
+		case dwexpr.LocPieces:
+			s.Kind = "split"
+		default:
+			s.Kind = "value"
+		}
+		return s
+	}
+
+	out := &RegTimelineJS{Start: AddrJS(start), End: AddrJS(end), Rows: []RegRowJS{}}
+	for _, fvar := range fv.vars {
+		row := RegRowJS{Name: fvar.js.Name, Param: fvar.js.Param, Depth: fvar.js.Depth, Segs: []RegSegJS{}}
+		l := fvar.loc
+		switch {
+		case !l.ok && fvar.js.Const != "":
+			row.Segs = append(row.Segs, RegSegJS{AddrJS(start), AddrJS(end), "value", "const " + fvar.js.Const})
+		case !l.ok:
+		case !l.isList:
+			if len(l.expr) > 0 {
+				row.Segs = append(row.Segs, seg(start, end, l.expr))
+			}
+		default:
+			row.Segs = listSegs(l.list, start, end, seg)
+		}
+		for i := 1; i < len(row.Segs); i++ {
+			if row.Segs[i-1].Kind == "reg" && row.Segs[i].Kind == "stack" {
+				row.Spills++
+			}
+		}
+		out.Rows = append(out.Rows, row)
+	}
+	return out, nil
+}
+
+// listSegs converts location list list to segments within [start,
+// end), using the list's default entry to fill gaps. It merges
+// adjacent segments with the same location.
+func listSegs(list []dwexpr.LocEntry, start, end uint64, seg func(lo, hi uint64, expr []byte) RegSegJS) []RegSegJS {
+	var ents []dwexpr.LocEntry
+	var def []byte
+	for _, e := range list {
+		if e.Default {
+			def = e.Expr
+			continue
+		}
+		if e.Low < start {
+			e.Low = start
+		}
+		if e.High > end {
+			e.High = end
+		}
+		if e.Low < e.High && len(e.Expr) > 0 {
+			ents = append(ents, e)
+		}
+	}
+	sort.Slice(ents, func(i, j int) bool { return ents[i].Low < ents[j].Low })
+
+	segs := []RegSegJS{}
+	add := func(s RegSegJS) {
+		if n := len(segs); n > 0 && segs[n-1].End == s.Start && segs[n-1].Where == s.Where && segs[n-1].Kind == s.Kind {
+			segs[n-1].End = s.End
+			return
+		}
+		segs = append(segs, s)
+	}
+	pc := start
+	for _, e := range ents {
+		if def != nil && pc < e.Low {
+			add(seg(pc, e.Low, def))
+		}
+		if e.Low < pc {
+			// Overlapping entry. Keep the earlier one.
+			if e.High <= pc {
+				continue
+			}
+			e.Low = pc
+		}
+		add(seg(e.Low, e.High, e.Expr))
+		pc = e.High
+	}
+	if def != nil && pc < end {
+		add(seg(pc, end, def))
+	}
+	return segs
+}
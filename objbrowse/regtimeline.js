@@ -0,0 +1,77 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+"use strict";
+
+// RegTimelineView shows where each variable of a function lives
+// across the function's PCs, with PCs on the x axis and variables on
+// the y axis.
+class RegTimelineView {
+    constructor(data, container) {
+        const view = this;
+        this._container = container;
+        this._start = new AddrJS(data.Start);
+        this._end = new AddrJS(data.End);
+        const div = $("<div>").addClass("regtimeline").appendTo(container);
+
+        const legend = $("<div>").addClass("rt-legend").appendTo(div);
+        for (let [kind, label] of [["reg", "register"], ["stack", "stack"], ["mem", "memory"],
+                                   ["value", "value"], ["split", "pieces"]])
+            legend.append($("<span>").addClass("rt-" + kind).text(label)).append(" ");
+        legend.append($("<span>").addClass("rt-none").text("optimized out"));
+
+        if (data.Rows.length == 0)
+            $("<div>").addClass("sv-note").text("no variables").appendTo(div);
+        const table = $("<table>").appendTo(div);
+        this._bars = [];
+        for (let row of data.Rows) {
+            const name = $("<td>").addClass("var-name").
+                  css("padding-left", (row.Depth || 0) * 1.5 + "em").text(row.Name);
+            if (row.Param)
+                name.addClass("var-param");
+            if (row.Spills)
+                name.append($("<span>").addClass("rt-spills").
+                            text(" " + row.Spills + " spill" + (row.Spills > 1 ? "s" : "")));
+            const bar = $("<div>").addClass("rt-bar");
+            this._bars.push(bar);
+            for (let s of row.Segs) {
+                const range = {start: new AddrJS(s.Start), end: new AddrJS(s.End)};
+                $("<div>").addClass("rt-seg rt-" + s.Kind).
+                    css({left: this._pos(range.start), width: this._width(range)}).
+                    attr("title", "[0x" + range.start + ", 0x" + range.end + ") " + s.Where).
+                    click(() => highlightRanges([range], view)).
+                    appendTo(bar);
+            }
+            $("<tr>").append(name).append($("<td>").addClass("rt-cell").append(bar)).appendTo(table);
+        }
+    }
+
+    // _pos returns the CSS position of pc as a percentage of the
+    // function.
+    _pos(pc) {
+        const len = this._end.sub(this._start).toNumber();
+        return (100 * pc.sub(this._start).toNumber() / len) + "%";
+    }
+
+    // _width returns the CSS width of range r as a percentage of the
+    // function, with a minimum so tiny ranges stay visible.
+    _width(r) {
+        const len = this._end.sub(this._start).toNumber();
+        return "max(2px, " + (100 * r.end.sub(r.start).toNumber() / len) + "%)";
+    }
+
+    highlightRanges(ranges, scroll) {
+        $(".rt-cursor", this._container).remove();
+        for (let r of ranges) {
+            if (r.end.compare(this._start) <= 0 || r.start.compare(this._end) >= 0)
+                continue;
+            // Clip to the function.
+            const c = {start: r.start.compare(this._start) < 0 ? this._start : r.start,
+                       end: r.end.compare(this._end) > 0 ? this._end : r.end};
+            for (let bar of this._bars)
+                $("<div>").addClass("rt-cursor").
+                    css({left: this._pos(c.start), width: this._width(c)}).appendTo(bar);
+        }
+    }
+}
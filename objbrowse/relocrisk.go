@@ -0,0 +1,292 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/aclements/objbrowse/obj"
+)
+
+// relocRisksOverlay is the name of the overlay marking relocations
+// near or over their limits.
+const relocRisksOverlay = "reloc-risks"
+
+// maxRelocRisks limits the number of relocations listed in a risk
+// report.
+const maxRelocRisks = 1000
+
+// relocRange describes the value a relocation type stores and the
+// range of values its field can hold.
+type relocRange struct {
+	form  relocForm
+	bits  uint // Width of the field
+	shift uint // Low bits of the value that aren't stored
+	check relocCheck
+}
+
+type relocForm uint8
+
+const (
+	relocAbs relocForm = iota // S + A
+	relocPC                   // S + A - P
+)
+
+// relocCheck is how the linker checks a relocated value for
+// overflow.
+type relocCheck uint8
+
+const (
+	checkSigned relocCheck = iota
+	checkUnsigned
+	checkBitfield // Fits either signed or unsigned
+)
+
+// relocRanges gives the ranges of the relocation types that can
+// overflow, by name. GOT- and TLS-relative types are left out because
+// their values depend on the layout of tables the linker builds.
+var relocRanges = map[string]relocRange{
+	"R_X86_64_PC32":  {relocPC, 32, 0, checkSigned},
+	"R_X86_64_PLT32": {relocPC, 32, 0, checkSigned},
+	"R_X86_64_PC16":  {relocPC, 16, 0, checkSigned},
+	"R_X86_64_PC8":   {relocPC, 8, 0, checkSigned},
+	"R_X86_64_32":    {relocAbs, 32, 0, checkUnsigned},
+	"R_X86_64_32S":   {relocAbs, 32, 0, checkSigned},
+	"R_X86_64_16":    {relocAbs, 16, 0, checkBitfield},
+	"R_X86_64_8":     {relocAbs, 8, 0, checkBitfield},
+
+	"R_LARCH_B16":        {relocPC, 16, 2, checkSigned},
+	"R_LARCH_B21":        {relocPC, 21, 2, checkSigned},
+	"R_LARCH_B26":        {relocPC, 26, 2, checkSigned},
+	"R_LARCH_PCREL20_S2": {relocPC, 20, 2, checkSigned},
+	"R_LARCH_32_PCREL":   {relocPC, 32, 0, checkSigned},
+}
+
+// bounds returns the smallest and largest values the field can hold.
+func (rr relocRange) bounds() (lo, hi int64) {
+	n := rr.bits + rr.shift
+	switch rr.check {
+	case checkSigned:
+		return -1 << (n - 1), 1<<(n-1) - 1
+	case checkUnsigned:
+		return 0, 1<<n - 1
+	}
+	return -1 << (n - 1), 1<<n - 1
+}
+
+// RelocRisksJS reports the relocations whose values come close to not
+// fitting their fields, which the linker reports as "relocation
+// truncated to fit".
+type RelocRisksJS struct {
+	// Near is the fraction of a field's range beyond which a
+	// value is reported.
+	Near float64
+	// Relocatable indicates the object isn't linked, so only
+	// PC-relative relocations within a section can be checked.
+	Relocatable bool
+	// Span is the distance from the lowest to the highest loaded
+	// address, which bounds the PC-relative distances in a linked
+	// file.
+	Span  uint64 `json:",omitempty"`
+	Types []RelocRiskTypeJS
+	// Unchecked is the number of relocations whose types can't
+	// overflow or aren't known.
+	Unchecked int
+	// Risks are the relocations near or over their limits,
+	// closest to overflowing first.
+	Risks []RelocRiskJS
+	// More is the number of risks omitted from Risks.
+	More int `json:",omitempty"`
+}
+
+// RelocRiskTypeJS summarizes the relocations of a type.
+type RelocRiskTypeJS struct {
+	Type string
+	// PCRel indicates the type stores a PC-relative distance.
+	PCRel bool
+	// Min and Max are the range of values the type can hold.
+	Min, Max int64
+	// Checked is the number of relocations whose value is known.
+	// Unknown relocations depend on the final layout or on
+	// dynamic linking.
+	Checked, Unknown int
+	Near, Overflow   int
+	// Worst is the largest fraction of the range used by a
+	// checked relocation.
+	Worst float64
+}
+
+// RelocRiskJS is a relocation near or over its limit. Usage is the
+// fraction of its range Value uses, which is over 1 if it overflows.
+type RelocRiskJS struct {
+	RelocJS
+	Value    int64
+	Usage    float64
+	Overflow bool
+}
+
+// relocValue returns the value relocation r in section sect stores
+// in its field, before dropping any low bits, if it can be computed
+// from the file.
+func (s *state) relocValue(sect int, r *obj.Reloc, rr relocRange) (int64, bool) {
+	syms := s.symTab.Syms()
+	if r.Symbol < 0 || int(r.Symbol) >= len(syms) {
+		return 0, false
+	}
+	target := &syms[r.Symbol]
+	if target.Kind == obj.SymUndef {
+		return 0, false
+	}
+	if s.bin.Info().Relocatable && (rr.form == relocAbs || target.Section != sect) {
+		// Only distances within a section are fixed before
+		// linking.
+		return 0, false
+	}
+	v := int64(target.Value) + r.Addend
+	if rr.form == relocPC {
+		v -= int64(r.Offset)
+	}
+	return v, true
+}
+
+// relocRisks checks the relocations against the ranges of their
+// fields and reports those using more than fraction near of their
+// range.
+func (s *state) relocRisks(near float64) (*RelocRisksJS, error) {
+	out := &RelocRisksJS{Near: near, Relocatable: s.bin.Info().Relocatable, Types: []RelocRiskTypeJS{}, Risks: []RelocRiskJS{}}
+	if !out.Relocatable {
+		var lo, hi uint64
+		for _, sect := range s.bin.Sections() {
+			if sect.Addr == 0 || sect.Size == 0 {
+				continue
+			}
+			if lo == 0 || sect.Addr < lo {
+				lo = sect.Addr
+			}
+			if end := sect.Addr + sect.Size; end > hi {
+				hi = end
+			}
+		}
+		out.Span = hi - lo
+	}
+
+	types := make(map[string]*RelocRiskTypeJS)
+	err := s.forEachReloc(func(sect int, r *obj.Reloc) {
+		name := r.Type.String()
+		rr, ok := relocRanges[name]
+		if !ok {
+			out.Unchecked++
+			return
+		}
+		t := types[name]
+		if t == nil {
+			t = &RelocRiskTypeJS{Type: name, PCRel: rr.form == relocPC}
+			t.Min, t.Max = rr.bounds()
+			types[name] = t
+		}
+		v, ok := s.relocValue(sect, r, rr)
+		if !ok {
+			t.Unknown++
+			return
+		}
+		t.Checked++
+		var usage float64
+		if v >= 0 {
+			usage = float64(v) / float64(t.Max)
+		} else {
+			usage = float64(v) / float64(t.Min)
+		}
+		if usage > t.Worst {
+			t.Worst = usage
+		}
+		if usage <= near {
+			return
+		}
+		risk := RelocRiskJS{s.relocJS(sect, r), v, usage, v < t.Min || v > t.Max}
+		if risk.Overflow {
+			t.Overflow++
+		} else {
+			t.Near++
+		}
+		out.Risks = append(out.Risks, risk)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, t := range types {
+		out.Types = append(out.Types, *t)
+	}
+	sort.Slice(out.Types, func(i, j int) bool {
+		return out.Types[i].Type < out.Types[j].Type
+	})
+	sort.SliceStable(out.Risks, func(i, j int) bool {
+		return out.Risks[i].Usage > out.Risks[j].Usage
+	})
+	if len(out.Risks) > maxRelocRisks {
+		out.More = len(out.Risks) - maxRelocRisks
+		out.Risks = out.Risks[:maxRelocRisks]
+	}
+	return out, nil
+}
+
+// overlay returns an overlay marking the risky relocations, or nil if
+// they don't have final addresses.
+func (rs *RelocRisksJS) overlay() *OverlayJS {
+	if rs.Relocatable {
+		return nil
+	}
+	o := &OverlayJS{Name: relocRisksOverlay}
+	for _, r := range rs.Risks {
+		usage := r.Usage * 100
+		e := OverlayEntryJS{Start: r.Addr, End: r.Addr + AddrJS(r.Size), Value: &usage, Color: "#ffd080"}
+		e.Label = fmt.Sprintf("%s to %s uses %.1f%% of its range", r.Type, r.Target, usage)
+		if r.Overflow {
+			e.Color = "#ffb0b0"
+			e.Label = fmt.Sprintf("%s to %s overflows (%.1f%% of its range)", r.Type, r.Target, usage)
+		}
+		o.Entries = append(o.Entries, e)
+	}
+	o.check()
+	return o
+}
+
+// httpRelocRisks serves the relocation overflow report as JSON. The
+// "near" query parameter is the fraction of a field's range beyond
+// which relocations are reported (default 0.9). A POST also
+// publishes the reported relocations as an overlay, so the hex and
+// assembly views mark them.
+func (s *state) httpRelocRisks(w http.ResponseWriter, r *http.Request) {
+	near := 0.9
+	if n := r.FormValue("near"); n != "" {
+		var err error
+		near, err = strconv.ParseFloat(n, 64)
+		if err != nil || near < 0 {
+			http.Error(w, fmt.Sprintf("bad near %q", n), http.StatusBadRequest)
+			return
+		}
+	}
+	risks, err := s.relocRisks(near)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if r.Method == http.MethodPost {
+		o := risks.overlay()
+		if o == nil {
+			http.Error(w, "relocations in an unlinked object have no addresses to mark", http.StatusBadRequest)
+			return
+		}
+		overlays.remove(relocRisksOverlay)
+		if len(o.Entries) > 0 {
+			overlays.put(o)
+		}
+		events.publish("overlay", relocRisksOverlay)
+	}
+	serveJSON(w, risks)
+}
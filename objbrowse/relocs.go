@@ -0,0 +1,202 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/aclements/objbrowse/obj"
+)
+
+// RelocsJS lists the relocations of a section or the whole file, like
+// readelf -r.
+type RelocsJS struct {
+	// Sections are the sections that have relocations, in file
+	// order.
+	Sections []RelocCountJS
+	// Types counts the relocations of each type that match the
+	// section and target filters, most common first.
+	Types []RelocCountJS
+	// Total is the number of relocations matching all filters.
+	// Relocs may be limited to fewer.
+	Total  int
+	Relocs []RelocJS
+}
+
+type RelocCountJS struct {
+	Name  string
+	Count int
+}
+
+// RelocJS is a relocation. It's applied to the Size bytes at Addr in
+// Section, which are at offset Off in symbol In, if any.
+type RelocJS struct {
+	Section string
+	Addr    AddrJS
+	Size    byte
+	Type    string
+	Target  string    `json:",omitempty"`
+	Addend  int64     `json:",omitempty"`
+	In      string    `json:",omitempty"`
+	InID    obj.SymID `json:",omitempty"`
+	Off     uint64    `json:",omitempty"`
+}
+
+// relocQuery selects relocations. Empty fields match everything.
+type relocQuery struct {
+	section string
+	typ     string
+	target  *regexp.Regexp
+	limit   int // < 0 for no limit
+}
+
+// forEachReloc calls fn for each relocation in the file, in section
+// order and then address order.
+func (s *state) forEachReloc(fn func(sect int, r *obj.Reloc)) error {
+	var r obj.Reloc
+	for i, sect := range s.bin.Sections() {
+		if sect.Zero {
+			// Zero-filled sections can't be relocated, and
+			// reading them may be expensive.
+			continue
+		}
+		data, err := s.bin.SectionData(i)
+		if err != nil {
+			return err
+		}
+		for j := 0; j < data.R.Len(); j++ {
+			data.R.Get(j, &r)
+			fn(i, &r)
+		}
+	}
+	return nil
+}
+
+// relocSym returns the symbol in section sect containing addr. In
+// relocatable objects every section may start at 0, so this only
+// considers symbols in the same section. It skips unnamed symbols,
+// such as ELF section symbols.
+func (s *state) relocSym(sect int, addr uint64) (obj.SymID, bool) {
+	syms := s.symTab.Syms()
+	for _, m := range s.symTab.AddrAll(addr) {
+		if sym := &syms[m.ID]; sym.Section == sect && sym.Name != "" {
+			return m.ID, true
+		}
+	}
+	return -1, false
+}
+
+// relocTarget returns the name of the target of r, or "" if it has
+// none.
+func (s *state) relocTarget(r *obj.Reloc) string {
+	syms := s.symTab.Syms()
+	if r.Symbol < 0 || int(r.Symbol) >= len(syms) {
+		return ""
+	}
+	sym := &syms[r.Symbol]
+	if sects := s.bin.Sections(); sym.Name == "" && sym.Section >= 0 && sym.Section < len(sects) {
+		// A section symbol. Name it like readelf.
+		return sects[sym.Section].Name
+	}
+	return sym.Name
+}
+
+// relocJS returns relocation r in section sect as JSON.
+func (s *state) relocJS(sect int, r *obj.Reloc) RelocJS {
+	js := RelocJS{Section: s.bin.Sections()[sect].Name, Addr: AddrJS(r.Offset), Size: r.Size, Type: r.Type.String(),
+		Target: s.relocTarget(r), Addend: r.Addend}
+	if id, ok := s.relocSym(sect, r.Offset); ok {
+		sym := &s.symTab.Syms()[id]
+		js.In, js.InID, js.Off = sym.Name, id, r.Offset-sym.Value
+	}
+	return js
+}
+
+// relocs returns the relocations selected by q.
+func (s *state) relocs(q relocQuery) (*RelocsJS, error) {
+	sects := s.bin.Sections()
+	sectCounts := make([]int, len(sects))
+	typeCounts := make(map[string]int)
+	out := &RelocsJS{Sections: []RelocCountJS{}, Types: []RelocCountJS{}, Relocs: []RelocJS{}}
+	err := s.forEachReloc(func(sect int, r *obj.Reloc) {
+		sectCounts[sect]++
+		if q.section != "" && sects[sect].Name != q.section {
+			return
+		}
+		target := s.relocTarget(r)
+		if q.target != nil && !q.target.MatchString(target) {
+			return
+		}
+		typ := r.Type.String()
+		typeCounts[typ]++
+		if q.typ != "" && typ != q.typ {
+			return
+		}
+		out.Total++
+		if q.limit >= 0 && len(out.Relocs) >= q.limit {
+			return
+		}
+		out.Relocs = append(out.Relocs, s.relocJS(sect, r))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, n := range sectCounts {
+		if n > 0 {
+			out.Sections = append(out.Sections, RelocCountJS{sects[i].Name, n})
+		}
+	}
+	for typ, n := range typeCounts {
+		out.Types = append(out.Types, RelocCountJS{typ, n})
+	}
+	sort.Slice(out.Types, func(i, j int) bool {
+		a, b := out.Types[i], out.Types[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Name < b.Name
+	})
+	return out, nil
+}
+
+// httpRelocs serves the relocations selected by the query parameters
+// as JSON.
+//
+//	section=NAME   only relocations applied to section NAME
+//	type=TYPE      only relocations of type TYPE, such as R_X86_64_PC32
+//	target=RE      only relocations whose target symbol matches RE
+//	limit=N        list at most N relocations (default 1000)
+//
+// The type counts ignore the type filter, so they can be used to
+// choose a type.
+func (s *state) httpRelocs(w http.ResponseWriter, r *http.Request) {
+	q := relocQuery{section: r.FormValue("section"), typ: r.FormValue("type"), limit: 1000}
+	if re := r.FormValue("target"); re != "" {
+		var err error
+		if q.target, err = regexp.Compile(re); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if l := r.FormValue("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("bad limit %q", l), http.StatusBadRequest)
+			return
+		}
+		q.limit = n
+	}
+	relocs, err := s.relocs(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	serveJSON(w, relocs)
+}
@@ -0,0 +1,220 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+"use strict";
+
+// RelocView lists the relocations of a section or the whole file,
+// like readelf -r, with filters by type and target symbol. Each
+// relocation links to the bytes it applies to.
+class RelocView {
+    constructor(container) {
+        const self = this;
+        const details = $("<details>").addClass("relocview").appendTo(container);
+        $("<summary>").text("Relocations").appendTo(details);
+        const form = $("<div>").addClass("reloc-filters").appendTo(details);
+        this._section = $("<select>").append($("<option>").val("").text("all sections"));
+        this._type = $("<select>").append($("<option>").val("").text("all types"));
+        this._target = $('<input type="text" placeholder="target regexp">');
+        form.append(this._section, " ", this._type, " ", this._target);
+        this._counts = $("<div>").addClass("reloc-counts").appendTo(details);
+        this._div = $("<div>").appendTo(details);
+
+        this._section.change(() => { self._load(); });
+        this._type.change(() => { self._load(); });
+        let timer = null;
+        this._target.on("input", () => {
+            clearTimeout(timer);
+            timer = setTimeout(() => { self._load(); }, 300);
+        });
+
+        details.one("toggle", () => { self._load(); });
+    }
+
+    _load() {
+        const self = this;
+        if (this._xhr)
+            this._xhr.abort();
+        const params = {section: this._section.val(), type: this._type.val(), target: this._target.val()};
+        this._div.text("Loading…");
+        this._xhr = $.getJSON("/relocs", params).done((data) => {
+            self._render(data, params);
+        }).fail((xhr) => {
+            if (xhr.statusText !== "abort")
+                showError("Relocations", xhr, self._div.empty());
+        });
+    }
+
+    _render(data, params) {
+        const self = this;
+        // Refill the filters, keeping the selections.
+        RelocView._options(this._section, "all sections", data.Sections, params.section);
+        RelocView._options(this._type, "all types", data.Types, params.type);
+
+        // Counts per type, which filter by type when clicked.
+        this._counts.empty();
+        for (let t of data.Types) {
+            $("<a>").attr("href", "#").addClass("reloc-count").
+                toggleClass("reloc-count-selected", t.Name === params.type).
+                text(t.Name + " " + t.Count).
+                click((ev) => {
+                    ev.preventDefault();
+                    self._type.val(t.Name === params.type ? "" : t.Name);
+                    self._load();
+                }).appendTo(this._counts);
+        }
+
+        const div = this._div.empty();
+        if (data.Total == 0) {
+            div.text("No relocations.");
+            return;
+        }
+        if (data.Relocs.length < data.Total)
+            $("<div>").addClass("sv-note").
+                text("Showing " + data.Relocs.length + " of " + data.Total + " relocations.").appendTo(div);
+        const table = $("<table>").addClass("reloc-table").appendTo(div);
+        $("<tr>").append(["address", "section", "type", "target", "in"].map((h) => $("<th>").text(h))).appendTo(table);
+        for (let r of data.Relocs) {
+            let target = r.Target || "";
+            if (r.Addend)
+                target += (r.Addend < 0 ? " - 0x" : " + 0x") + Math.abs(r.Addend).toString(16);
+            const where = $("<td>");
+            if (r.In) {
+                const off = new AddrJS(r.Off ? r.Off.toString(16) : "0");
+                const range = {start: off, end: off.add(new AddrJS(Math.max(r.Size, 1).toString(16)))};
+                where.append($("<a>").attr("href", symURL(r.In, r.InID || 0) + "#+" + formatRanges([range])).
+                             text(r.In + (r.Off ? "+0x" + r.Off.toString(16) : "")));
+            }
+            $("<tr>").
+                append($("<td>").addClass("pos").text("0x" + r.Addr)).
+                append($("<td>").text(r.Section)).
+                append($("<td>").text(r.Type)).
+                append($("<td>").text(target)).
+                append(where).appendTo(table);
+        }
+    }
+
+    // _options replaces the options of select with "all" and counts,
+    // selecting val.
+    static _options(select, all, counts, val) {
+        select.empty().append($("<option>").val("").text(all));
+        for (let c of counts)
+            $("<option>").val(c.Name).text(c.Name + " (" + c.Count + ")").appendTo(select);
+        select.val(val);
+        if (select.val() === null)
+            select.val("");
+    }
+}
+
+// RelocRiskView reports the relocations whose values come close to
+// not fitting their fields, which the linker would report as
+// "relocation truncated to fit".
+class RelocRiskView {
+    constructor(container) {
+        const self = this;
+        const details = $("<details>").addClass("relocriskview").appendTo(container);
+        $("<summary>").text("Relocation overflow").appendTo(details);
+        this._div = $("<div>").appendTo(details);
+        details.one("toggle", () => { self._load("GET"); });
+    }
+
+    // _load fetches the report. A POST also marks the reported
+    // relocations in the hex and assembly views.
+    _load(method) {
+        const self = this;
+        this._div.text("Checking…");
+        $.ajax({url: "/reloc-risks", method: method, dataType: "json"}).done((data) => {
+            self._render(data);
+        }).fail((xhr) => {
+            showError("Relocation overflow", xhr, self._div.empty());
+        });
+    }
+
+    _render(data) {
+        const self = this;
+        const div = this._div.empty();
+        const pct = (f) => (f * 100).toFixed(1) + "%";
+        if (data.Relocatable)
+            $("<div>").addClass("sv-note").
+                text("This object isn't linked, so only PC-relative relocations within a section can be checked.").appendTo(div);
+        if (data.Types.length == 0) {
+            div.append("No relocations of types that can overflow" +
+                       (data.Unchecked ? " (" + data.Unchecked + " of other types)." : "."));
+            return;
+        }
+
+        const table = $("<table>").addClass("reloc-table").appendTo(div);
+        $("<tr>").append(["type", "range", "checked", "unknown", "near", "overflow", "worst"].
+                         map((h) => $("<th>").text(h))).appendTo(table);
+        for (let t of data.Types) {
+            const tr = $("<tr>").append(
+                $("<td>").text(t.Type),
+                $("<td>").text(RelocRiskView._range(t.Min, t.Max)),
+                $("<td>").addClass("pos").text(t.Checked),
+                $("<td>").addClass("pos").text(t.Unknown),
+                $("<td>").addClass("pos").text(t.Near),
+                $("<td>").addClass("pos").text(t.Overflow),
+                $("<td>").append(RelocRiskView._bar(t.Worst)).append(" " + pct(t.Worst))).appendTo(table);
+            if (t.Overflow)
+                tr.addClass("reloc-overflow");
+        }
+        if (data.Span) {
+            // A linked file's PC-relative distances can't exceed
+            // its span, so compare it to the shortest PC-relative
+            // reach.
+            let note = "Loaded sections span 0x" + data.Span.toString(16) + " bytes";
+            const pcrel = data.Types.filter((t) => t.PCRel).sort((a, b) => a.Max - b.Max);
+            if (pcrel.length > 0)
+                note += ", " + pct(data.Span / pcrel[0].Max) + " of the reach of " + pcrel[0].Type;
+            $("<div>").addClass("sv-note").text(note + ".").appendTo(div);
+        }
+        if (data.Unchecked)
+            $("<div>").addClass("sv-note").
+                text(data.Unchecked + " relocations of other types can't overflow or aren't checked.").appendTo(div);
+
+        if (data.Risks.length == 0) {
+            $("<div>").text("No relocations use more than " + pct(data.Near) + " of their range.").appendTo(div);
+            return;
+        }
+        $("<h4>").text("Relocations using more than " + pct(data.Near) + " of their range").appendTo(div);
+        if (!data.Relocatable)
+            $("<a>").attr("href", "#").text("Mark in hex and assembly views").click((ev) => {
+                ev.preventDefault();
+                self._load("POST");
+            }).appendTo(div);
+        const risks = $("<table>").addClass("reloc-table").appendTo(div);
+        $("<tr>").append(["address", "type", "target", "value", "usage", "in"].map((h) => $("<th>").text(h))).appendTo(risks);
+        for (let r of data.Risks) {
+            const where = $("<td>");
+            if (r.In) {
+                const off = new AddrJS(r.Off ? r.Off.toString(16) : "0");
+                const range = {start: off, end: off.add(new AddrJS(r.Size.toString(16)))};
+                where.append($("<a>").attr("href", symURL(r.In, r.InID || 0) + "#+" + formatRanges([range])).
+                             text(r.In + (r.Off ? "+0x" + r.Off.toString(16) : "")));
+            }
+            $("<tr>").toggleClass("reloc-overflow", r.Overflow).append(
+                $("<td>").addClass("pos").text("0x" + r.Addr),
+                $("<td>").text(r.Type),
+                $("<td>").text(r.Target || ""),
+                $("<td>").addClass("pos").text((r.Value < 0 ? "-0x" : "0x") + Math.abs(r.Value).toString(16)),
+                $("<td>").append(RelocRiskView._bar(r.Usage)).append(" " + pct(r.Usage)),
+                where).appendTo(risks);
+        }
+        if (data.More)
+            $("<div>").addClass("sv-note").text("and " + data.More + " more").appendTo(div);
+    }
+
+    // _range formats the range [min, max] of a field.
+    static _range(min, max) {
+        const hex = (v) => (v < 0 ? "-0x" : "0x") + Math.abs(v).toString(16);
+        return "[" + hex(min) + ", " + hex(max) + "]";
+    }
+
+    // _bar returns a bar showing fraction f of a field's range.
+    static _bar(f) {
+        const bar = $("<span>").addClass("reloc-bar");
+        $("<span>").addClass("reloc-bar-fill").toggleClass("reloc-bar-over", f > 1).
+            css("width", Math.min(f, 1) * 100 + "%").appendTo(bar);
+        return bar;
+    }
+}
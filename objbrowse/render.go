@@ -0,0 +1,546 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"html"
+	"html/template"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/aclements/objbrowse/internal/asm"
+	"github.com/aclements/objbrowse/internal/bitmapfont"
+	"github.com/aclements/objbrowse/obj"
+)
+
+// renderUsage describes the render command.
+const renderUsage = `Render:
+  render objfile symbol [id=N | addr=HEX] [-view asm|hex|source]
+         [-format html|svg|png] [-o path]
+	render a view of a symbol without starting the server, for
+	embedding in documents; the format defaults to the extension of
+	-o, or html
+`
+
+// maxRenderLines limits the length of a rendering, so an enormous
+// symbol doesn't produce an enormous image.
+const maxRenderLines = 5000
+
+// A renderDoc is a view of a symbol laid out as lines of styled text,
+// which can be written as HTML, SVG, or PNG. It's a static form of
+// what the web UI's views show.
+type renderDoc struct {
+	Title string
+	Lines []renderLine
+}
+
+type renderLine struct {
+	Spans []renderSpan
+	// Marked highlights the line, like source lines that have
+	// code.
+	Marked bool
+}
+
+type renderSpan struct {
+	Text  string
+	Style renderStyle
+}
+
+// A renderStyle is the style of a span of text. The styles follow
+// the CSS of the web UI's views.
+type renderStyle int
+
+const (
+	styleText renderStyle = iota
+	styleAddr
+	styleHeader
+	styleControl
+	stylePos
+	styleData
+	styleReloc
+	styleError
+	styleKeyword
+	styleType
+	styleComment
+	styleString
+	styleNumber
+	stylePreproc
+)
+
+var renderStyles = [...]struct {
+	Name  string
+	Color string
+	Bold  bool
+}{
+	styleText:    {"text", "#000000", false},
+	styleAddr:    {"addr", "#707070", false},
+	styleHeader:  {"header", "#000000", true},
+	styleControl: {"control", "#2060a0", false},
+	stylePos:     {"pos", "#707070", false},
+	styleData:    {"data", "#888888", false},
+	styleReloc:   {"reloc", "#a03000", false},
+	styleError:   {"error", "#ff0000", false},
+	styleKeyword: {"kw", "#0000a0", true},
+	styleType:    {"type", "#006060", false},
+	styleComment: {"com", "#808080", false},
+	styleString:  {"str", "#a03000", false},
+	styleNumber:  {"num", "#008000", false},
+	stylePreproc: {"pp", "#800080", false},
+}
+
+// markColor is the background of marked lines.
+const markColor = "#ffffd0"
+
+// tokenStyles maps the syntax highlighting classes of SourceViewToken
+// to styles.
+var tokenStyles = map[string]renderStyle{
+	"kw": styleKeyword, "type": styleType, "com": styleComment,
+	"str": styleString, "num": styleNumber, "pp": stylePreproc,
+}
+
+// add appends text in style to the last line of d.
+func (d *renderDoc) add(text string, style renderStyle) {
+	if text == "" {
+		return
+	}
+	l := &d.Lines[len(d.Lines)-1]
+	if n := len(l.Spans); n > 0 && l.Spans[n-1].Style == style {
+		l.Spans[n-1].Text += text
+		return
+	}
+	l.Spans = append(l.Spans, renderSpan{text, style})
+}
+
+// newLine starts a line in d.
+func (d *renderDoc) newLine() {
+	d.Lines = append(d.Lines, renderLine{})
+}
+
+// trim cuts d to maxRenderLines, noting how much it left out.
+func (d *renderDoc) trim() {
+	if len(d.Lines) <= maxRenderLines {
+		return
+	}
+	more := len(d.Lines) - maxRenderLines
+	d.Lines = d.Lines[:maxRenderLines]
+	d.newLine()
+	d.add(fmt.Sprintf("... %d more lines", more), styleComment)
+}
+
+// cols returns the width of line l in characters.
+func (l renderLine) cols() int {
+	n := 0
+	for _, s := range l.Spans {
+		n += utf8.RuneCountInString(s.Text)
+	}
+	return n
+}
+
+// expandTabs expands the tabs in s, which starts at column col, to
+// 8-column tab stops.
+func expandTabs(s string, col int) string {
+	if !strings.Contains(s, "\t") {
+		return s
+	}
+	var buf strings.Builder
+	for _, r := range s {
+		if r == '\t' {
+			n := 8 - col%8
+			buf.WriteString(strings.Repeat(" ", n))
+			col += n
+			continue
+		}
+		buf.WriteRune(r)
+		col++
+	}
+	return buf.String()
+}
+
+// renderAsm lays out the disassembly of sym, like AsmView.
+func renderAsm(sym obj.Sym, v *AsmViewJS) *renderDoc {
+	d := &renderDoc{Title: sym.Name}
+	for _, inst := range v.Insts {
+		d.newLine()
+		d.add(fmt.Sprintf("%#x  ", uint64(inst.PC)), styleAddr)
+		style := styleText
+		if inst.Data {
+			style = styleData
+		} else if inst.Control.Type != asm.ControlNone {
+			style = styleControl
+		}
+		d.add(fmt.Sprintf("%-8s %s", inst.Op, strings.Join(inst.Args, ", ")), style)
+		if inst.File != 0 {
+			d.add(fmt.Sprintf("  %s:%d", filepath.Base(v.Files[inst.File]), inst.Line), stylePos)
+		}
+	}
+	return d
+}
+
+// renderHex lays out the bytes of sym and their relocations, like
+// HexView.
+func renderHex(sym obj.Sym, v HexViewJS) (*renderDoc, error) {
+	d := &renderDoc{Title: sym.Name}
+	data := make([]byte, len(v.Data)/2)
+	for i := range data {
+		b, err := strconv.ParseUint(v.Data[2*i:2*i+2], 16, 8)
+		if err != nil {
+			return nil, err
+		}
+		data[i] = byte(b)
+	}
+	// Mark the bytes covered by relocations.
+	reloc := make([]bool, len(data))
+	for _, r := range v.Relocs {
+		for i := r.Offset; i < r.Offset+uint64(r.Bytes) && i < uint64(len(reloc)); i++ {
+			reloc[i] = true
+		}
+	}
+	relI := 0
+	for off := 0; off < len(data); off += 16 {
+		d.newLine()
+		d.add(fmt.Sprintf("%#x  ", uint64(v.Addr)+uint64(off)), styleAddr)
+		var ascii strings.Builder
+		for i := off; i < off+16; i++ {
+			if i == off+8 {
+				d.add(" ", styleText)
+			}
+			if i >= len(data) {
+				d.add("   ", styleText)
+				continue
+			}
+			style := styleText
+			if reloc[i] {
+				style = styleReloc
+			}
+			d.add(fmt.Sprintf("%02x ", data[i]), style)
+			if c := data[i]; c >= ' ' && c <= '~' {
+				ascii.WriteByte(c)
+			} else {
+				ascii.WriteByte('.')
+			}
+		}
+		d.add(" "+ascii.String(), styleData)
+
+		// Relocations before the symbol have wrapped offsets,
+		// so list them after the first row.
+		for ; relI < len(v.Relocs) && (v.Relocs[relI].Offset < uint64(off+16) || v.Relocs[relI].Offset >= uint64(len(data))); relI++ {
+			r := v.Relocs[relI]
+			d.newLine()
+			target := r.Sym
+			if r.Addend != 0 {
+				target += fmt.Sprintf("%+#x", r.Addend)
+			}
+			d.add(fmt.Sprintf("    +%#x %s %s", r.Offset, v.RTypes[r.Type], target), styleReloc)
+		}
+	}
+	return d, nil
+}
+
+// renderSource lays out the source lines of sym, like SourceView.
+func renderSource(sym obj.Sym, v SourceViewJS) *renderDoc {
+	d := &renderDoc{Title: sym.Name}
+	for _, b := range v.Blocks {
+		d.newLine()
+		d.add(b.Path, styleHeader)
+		if b.Error != "" {
+			d.newLine()
+			d.add(b.Error, styleError)
+			continue
+		}
+		for i, text := range b.Text {
+			d.newLine()
+			prefix := fmt.Sprintf("%5d  ", b.Start+i)
+			d.add(prefix, styleAddr)
+			d.Lines[len(d.Lines)-1].Marked = len(b.PCs[i]) > 0
+			// Token offsets are in UTF-16 code units.
+			u := utf16.Encode([]rune(text))
+			pos, col := 0, 0
+			span := func(end int, style renderStyle) {
+				s := expandTabs(string(utf16.Decode(u[pos:end])), col)
+				col += utf8.RuneCountInString(s)
+				d.add(s, style)
+				pos = end
+			}
+			if b.Tokens != nil {
+				for _, tok := range b.Tokens[i] {
+					span(tok.Start, styleText)
+					span(tok.End, tokenStyles[tok.Class])
+				}
+			}
+			span(len(u), styleText)
+		}
+	}
+	return d
+}
+
+// renderView lays out the view named view of symbol id.
+func (s *state) renderView(id obj.SymID, view string) (*renderDoc, error) {
+	sym := s.symTab.Syms()[id]
+	data, err := s.bin.SymbolData(id)
+	if err != nil {
+		return nil, err
+	}
+	caps := s.fi.SymCaps(sym)
+	switch view {
+	case "asm":
+		if caps&capAsm == 0 {
+			return nil, fmt.Errorf("%s has no disassembly", sym.Name)
+		}
+		v, err := s.asmView.DecodeSym(sym, data.P)
+		if err != nil {
+			return nil, err
+		}
+		return renderAsm(sym, v.(*AsmViewJS)), nil
+	case "hex":
+		v, err := s.hexView.DecodeSym(sym, data)
+		if err != nil {
+			return nil, err
+		}
+		return renderHex(sym, v.(HexViewJS))
+	case "source":
+		if caps&capSource == 0 {
+			return nil, fmt.Errorf("%s has no source", sym.Name)
+		}
+		v, err := s.sourceView.DecodeSym(s.fi, sym)
+		if err != nil {
+			return nil, err
+		}
+		return renderSource(sym, v.(SourceViewJS)), nil
+	}
+	return nil, fmt.Errorf("unknown view %q; want asm, hex, or source", view)
+}
+
+var tmplRender = template.Must(template.New("render").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Title}}</title>
+<style>
+.render-view { font-family: monospace; font-size: 13px; line-height: 16px; margin: 0; }
+.render-view .mark { background: {{.Mark}}; }
+{{range .Styles}}.render-view .r-{{.Name}} { color: {{.Color}};{{if .Bold}} font-weight: bold;{{end}} }
+{{end}}</style></head>
+<body><pre class="render-view">{{range .Lines}}<span{{if .Marked}} class="mark"{{end}}>{{range .Spans}}<span class="r-{{.Class}}">{{.Text}}</span>{{end}}</span>
+{{end}}</pre></body></html>
+`))
+
+// writeHTML writes d as a standalone HTML page.
+func (d *renderDoc) writeHTML(w io.Writer) error {
+	type span struct{ Class, Text string }
+	type line struct {
+		Marked bool
+		Spans  []span
+	}
+	lines := make([]line, len(d.Lines))
+	for i, l := range d.Lines {
+		lines[i].Marked = l.Marked
+		for _, s := range l.Spans {
+			lines[i].Spans = append(lines[i].Spans, span{renderStyles[s.Style].Name, s.Text})
+		}
+	}
+	return tmplRender.Execute(w, map[string]interface{}{
+		"Title":  d.Title,
+		"Mark":   template.CSS(markColor),
+		"Styles": renderStyles,
+		"Lines":  lines,
+	})
+}
+
+// Metrics of SVG renderings, assuming a monospace font whose
+// characters are 0.6em wide.
+const (
+	svgFontSize   = 13
+	svgLineHeight = 16
+	svgCharWidth  = 0.6 * svgFontSize
+	svgPad        = 4
+)
+
+// writeSVG writes d as an SVG image.
+func (d *renderDoc) writeSVG(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	cols := 0
+	for _, l := range d.Lines {
+		if n := l.cols(); n > cols {
+			cols = n
+		}
+	}
+	width := int(float64(cols)*svgCharWidth) + 2*svgPad
+	height := len(d.Lines)*svgLineHeight + 2*svgPad
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="monospace" font-size="%d">`+"\n", width, height, width, height, svgFontSize)
+	fmt.Fprintf(bw, "<title>%s</title>\n", html.EscapeString(d.Title))
+	fmt.Fprintf(bw, `<rect width="100%%" height="100%%" fill="#ffffff"/>`+"\n")
+	for i, l := range d.Lines {
+		y := svgPad + i*svgLineHeight
+		if l.Marked {
+			fmt.Fprintf(bw, `<rect x="0" y="%d" width="%d" height="%d" fill="%s"/>`+"\n", y, width, svgLineHeight, markColor)
+		}
+		if len(l.Spans) == 0 {
+			continue
+		}
+		// Place the baseline about 3/4 of the way down the line.
+		fmt.Fprintf(bw, `<text x="%d" y="%d" xml:space="preserve">`, svgPad, y+svgLineHeight*3/4)
+		for _, s := range l.Spans {
+			st := renderStyles[s.Style]
+			fmt.Fprintf(bw, `<tspan fill="%s"`, st.Color)
+			if st.Bold {
+				fmt.Fprintf(bw, ` font-weight="bold"`)
+			}
+			fmt.Fprintf(bw, ">%s</tspan>", html.EscapeString(s.Text))
+		}
+		fmt.Fprintf(bw, "</text>\n")
+	}
+	fmt.Fprintf(bw, "</svg>\n")
+	return bw.Flush()
+}
+
+// pngScale is the size of a pixel of the bitmap font in PNG
+// renderings.
+const pngScale = 2
+
+// parseColor parses a "#rrggbb" color.
+func parseColor(s string) color.RGBA {
+	v, _ := strconv.ParseUint(strings.TrimPrefix(s, "#"), 16, 32)
+	return color.RGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 0xff}
+}
+
+// writePNG writes d as a PNG image, drawn with a bitmap font.
+func (d *renderDoc) writePNG(w io.Writer) error {
+	const (
+		adv    = bitmapfont.Advance * pngScale
+		lineHt = bitmapfont.LineHeight * pngScale
+		pad    = 4 * pngScale
+	)
+	cols := 0
+	for _, l := range d.Lines {
+		if n := l.cols(); n > cols {
+			cols = n
+		}
+	}
+	img := image.NewRGBA(image.Rect(0, 0, cols*adv+2*pad, len(d.Lines)*lineHt+2*pad))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	mark := image.NewUniform(parseColor(markColor))
+	for i, l := range d.Lines {
+		y := pad + i*lineHt
+		if l.Marked {
+			draw.Draw(img, image.Rect(0, y, img.Bounds().Dx(), y+lineHt), mark, image.Point{}, draw.Src)
+		}
+		// Center the glyphs in the line.
+		y += (lineHt - bitmapfont.GlyphHeight*pngScale) / 2
+		x := pad
+		for _, s := range l.Spans {
+			st := renderStyles[s.Style]
+			c := parseColor(st.Color)
+			if st.Bold {
+				// Overstrike, like a line printer.
+				bitmapfont.Draw(img, x+1, y, pngScale, s.Text, c)
+			}
+			x = bitmapfont.Draw(img, x, y, pngScale, s.Text, c)
+		}
+	}
+	return png.Encode(w, img)
+}
+
+// renderMain renders a view of a symbol in the object at path without
+// starting the server and returns the process exit status. args are
+// the arguments following the object path, which mix the symbol and
+// its id= or addr= selectors with the render flags.
+func renderMain(path string, args []string) int {
+	fs := flag.NewFlagSet("render", flag.ContinueOnError)
+	view := fs.String("view", "asm", "render the `view`: asm, hex, or source")
+	format := fs.String("format", "", "write `format` html, svg, or png (default from -o, or html)")
+	out := fs.String("o", "", "write to the file at `path` instead of standard output")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "%s", renderUsage)
+	}
+	// Go's flag parsing stops at the first argument, so parse
+	// around each positional argument.
+	var pos []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return 2
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		pos = append(pos, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(pos) == 0 {
+		fs.Usage()
+		return 2
+	}
+	if *format == "" {
+		*format = "html"
+		if ext := strings.TrimPrefix(filepath.Ext(*out), "."); ext == "svg" || ext == "png" {
+			*format = ext
+		}
+	}
+	var write func(*renderDoc, io.Writer) error
+	switch *format {
+	case "html":
+		write = (*renderDoc).writeHTML
+	case "svg":
+		write = (*renderDoc).writeSVG
+	case "png":
+		write = (*renderDoc).writePNG
+	default:
+		fmt.Fprintf(os.Stderr, "unknown format %q; want html, svg, or png\n", *format)
+		return 2
+	}
+
+	if isRemote(path) {
+		var err error
+		path, err = fetchObj(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+		defer os.RemoveAll(filepath.Dir(path))
+	}
+	ssaDump = nil
+	s, err := open(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	id, err := s.querySym(pos)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	d, err := s.renderView(id, *view)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	d.trim()
+
+	if *out == "" {
+		err = write(d, os.Stdout)
+	} else {
+		var f *os.File
+		f, err = os.Create(*out)
+		if err == nil {
+			err = write(d, f)
+			if err1 := f.Close(); err == nil {
+				err = err1
+			}
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	return 0
+}
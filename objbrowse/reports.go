@@ -0,0 +1,184 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/aclements/objbrowse/internal/sanitizer"
+	"github.com/aclements/objbrowse/obj"
+)
+
+// reportsOverlay is the name of the overlay marking report frames.
+const reportsOverlay = "reports"
+
+// ReportJS is an AddressSanitizer or Valgrind report with its frames
+// resolved to the object file.
+type ReportJS struct {
+	Tool    string
+	Kind    string
+	Summary string
+	Stacks  []ReportStackJS
+}
+
+type ReportStackJS struct {
+	Title  string
+	Frames []ReportFrameJS
+}
+
+type ReportFrameJS struct {
+	Func string `json:",omitempty"`
+	File string `json:",omitempty"`
+	Line int    `json:",omitempty"`
+	// Module is the binary containing the frame, if known and not
+	// the object file.
+	Module string `json:",omitempty"`
+	// Sym and Addr locate the frame in the object file, if it's
+	// in the object file.
+	Sym     string `json:",omitempty"`
+	SymAddr AddrJS `json:",omitempty"`
+	Addr    AddrJS `json:",omitempty"`
+}
+
+// loadReports reads the sanitizer or Valgrind reports in the files
+// at paths and resolves their frames to the object at objPath.
+func loadReports(fi *FileInfo, objPath string, paths []string) ([]ReportJS, error) {
+	var reports []sanitizer.Report
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		rs, err := sanitizer.Parse(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		reports = append(reports, rs...)
+	}
+
+	r := &reportResolver{fi: fi, objBase: filepath.Base(objPath)}
+	// Resolve frames by module offset or symbol first to learn
+	// the load bias, then resolve the remaining frames by PC.
+	addrs := make(map[*sanitizer.Frame]uint64)
+	for i := range reports {
+		for j := range reports[i].Stacks {
+			for k := range reports[i].Stacks[j].Frames {
+				f := &reports[i].Stacks[j].Frames[k]
+				if addr, ok := r.resolve(f); ok {
+					addrs[f] = addr
+				}
+			}
+		}
+	}
+	for i := range reports {
+		for j := range reports[i].Stacks {
+			for k := range reports[i].Stacks[j].Frames {
+				f := &reports[i].Stacks[j].Frames[k]
+				if _, ok := addrs[f]; !ok && r.haveBias && f.Module == "" && f.Func == "" {
+					if addr, ok := r.textAddr(f.PC - r.bias); ok {
+						addrs[f] = addr
+					}
+				}
+			}
+		}
+	}
+
+	out := []ReportJS{}
+	overlay := &OverlayJS{Name: reportsOverlay}
+	for i, rep := range reports {
+		rj := ReportJS{Tool: rep.Tool, Kind: rep.Kind, Summary: rep.Summary}
+		for j, st := range rep.Stacks {
+			sj := ReportStackJS{Title: st.Title}
+			for k := range st.Frames {
+				f := &rep.Stacks[j].Frames[k]
+				fj := ReportFrameJS{Func: f.Func, File: f.File, Line: f.Line}
+				if addr, ok := addrs[f]; ok {
+					id, _ := fi.SymTab.Addr(addr)
+					sym := fi.SymTab.Syms()[id]
+					fj.Sym, fj.SymAddr, fj.Addr = sym.Name, AddrJS(sym.Value), AddrJS(addr)
+					e := OverlayEntryJS{Start: AddrJS(addr), Label: fmt.Sprintf("report %d: %s (%s, frame %d)", i+1, rep.Kind, st.Title, k)}
+					if j == 0 && k == 0 {
+						e.Color = "#ffb0b0"
+					}
+					overlay.Entries = append(overlay.Entries, e)
+				} else {
+					fj.Module = f.Module
+				}
+				sj.Frames = append(sj.Frames, fj)
+			}
+			rj.Stacks = append(rj.Stacks, sj)
+		}
+		out = append(out, rj)
+	}
+	overlays.remove(reportsOverlay)
+	if len(overlay.Entries) > 0 {
+		overlay.check()
+		overlays.put(overlay)
+	}
+	return out, nil
+}
+
+// reportResolver maps report frames to addresses in the object.
+type reportResolver struct {
+	fi      *FileInfo
+	objBase string
+	// bias is the load bias of the object, learned from frames
+	// resolved by symbol.
+	bias     uint64
+	haveBias bool
+}
+
+// textAddr returns pc if it's in a text symbol of the object.
+func (r *reportResolver) textAddr(pc uint64) (uint64, bool) {
+	id, ok := r.fi.SymTab.Addr(pc)
+	if !ok {
+		return 0, false
+	}
+	sym := r.fi.SymTab.Syms()[id]
+	if sym.Kind != obj.SymText || pc >= sym.Value+sym.Size {
+		return 0, false
+	}
+	return pc, true
+}
+
+// resolve returns the address of frame f in the object, using its
+// module offset or function name.
+func (r *reportResolver) resolve(f *sanitizer.Frame) (uint64, bool) {
+	if f.HasOff {
+		if filepath.Base(f.Module) != r.objBase {
+			return 0, false
+		}
+		return r.textAddr(f.ModuleOff)
+	}
+	if f.Func == "" {
+		return 0, false
+	}
+	id, ok := r.fi.SymTab.Lookup(f.Func)
+	if !ok {
+		return 0, false
+	}
+	sym := r.fi.SymTab.Syms()[id]
+	if sym.Kind != obj.SymText {
+		return 0, false
+	}
+	if sym.Value <= f.PC && f.PC < sym.Value+sym.Size {
+		// Not relocated.
+		return f.PC, true
+	}
+	// The object was loaded at a page-aligned bias, so the PC's
+	// offset within its page identifies the address, at least
+	// in functions smaller than a page.
+	addr := sym.Value + (f.PC-sym.Value)&0xfff
+	if addr >= sym.Value+sym.Size {
+		return 0, false
+	}
+	if !r.haveBias {
+		r.bias, r.haveBias = f.PC-addr, true
+	}
+	return addr, true
+}
@@ -0,0 +1,56 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+"use strict";
+
+// ReportView lists AddressSanitizer and Valgrind reports, linking
+// each frame in the binary to its symbol.
+class ReportView {
+    constructor(container) {
+        const self = this;
+        $(container).addClass("reportview");
+        $("<h2>").text("Reports").appendTo(container);
+        const list = $("<div>").text("Loading reports…").appendTo(container);
+
+        $.getJSON("/reports").done((reports) => {
+            list.empty();
+            reports.forEach((rep, i) => {
+                const details = $("<details>").appendTo(list);
+                $("<summary>").text((i + 1) + ". " + rep.Tool + ": " + rep.Kind).
+                    attr("title", rep.Summary).appendTo(details);
+                for (let st of rep.Stacks) {
+                    $("<div>").addClass("report-stack").text(st.Title).appendTo(details);
+                    const table = $("<table>").appendTo(details);
+                    st.Frames.forEach((f, k) => {
+                        table.append(self._frameRow(f, k));
+                    });
+                }
+                // Open the first report.
+                if (i == 0)
+                    details.attr("open", true);
+            });
+        }).fail((xhr) => {
+            showError("Reports", xhr, list.empty());
+        });
+    }
+
+    _frameRow(f, k) {
+        let fn = $("<td>").text(f.Func || "??");
+        if (f.Sym) {
+            const off = new AddrJS(f.Addr).sub(new AddrJS(f.SymAddr));
+            const range = {start: off, end: off.add(new AddrJS(1))};
+            fn = $("<td>").append($("<a>").attr("href", "/s/" + f.Sym + "#+" + formatRanges([range])).
+                                  text((f.Func || f.Sym) + "+0x" + off));
+        }
+        let where = "";
+        if (f.File)
+            where = f.File + (f.Line ? ":" + f.Line : "");
+        else if (f.Module)
+            where = f.Module;
+        return $("<tr>").
+            append($("<td>").addClass("pos").text("#" + k)).
+            append(fn).
+            append($("<td>").addClass("report-loc").text(where));
+    }
+}
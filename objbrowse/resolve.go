@@ -0,0 +1,90 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxResolve and maxResolveData limit the number of addresses and the
+// bytes of data per address a single resolve request may ask for.
+const (
+	maxResolve     = 256
+	maxResolveData = 256
+)
+
+// PtrJS describes what a pointer value points to.
+type PtrJS struct {
+	Addr AddrJS
+	// Sym is the symbol containing Addr and Off is Addr's offset
+	// within it, if Addr is in a symbol.
+	Sym string `json:",omitempty"`
+	Off uint64 `json:",omitempty"`
+	// Section is the section containing Addr, if any.
+	Section string `json:",omitempty"`
+	// Data is the hex-encoded data at Addr, if requested. It may
+	// be shorter than requested if Addr is near the end of the
+	// mapped data.
+	Data string `json:",omitempty"`
+}
+
+// ResolvePtr symbolizes addr. If n > 0, it also returns up to n bytes
+// of data at addr.
+func (fi *FileInfo) ResolvePtr(addr uint64, n int) PtrJS {
+	p := PtrJS{Addr: AddrJS(addr)}
+	// Like SymName, ignore symbols at 0 so small integers don't
+	// get symbolized.
+	if id, ok := fi.SymTab.Addr(addr); ok {
+		if sym := fi.SymTab.Syms()[id]; sym.Value != 0 {
+			p.Sym, p.Off = sym.Name, addr-sym.Value
+		}
+	}
+	for _, sect := range fi.Obj.Sections() {
+		if sect.Addr != 0 && sect.Addr <= addr && addr-sect.Addr < sect.Size {
+			p.Section = sect.Name
+			break
+		}
+	}
+	if n > 0 && p.Section != "" {
+		if n > maxResolveData {
+			n = maxResolveData
+		}
+		if data, err := fi.Obj.Data(addr, uint64(n)); err == nil {
+			p.Data = fmt.Sprintf("%x", data.P)
+		}
+	}
+	return p
+}
+
+// httpResolve symbolizes the comma-separated hex addresses in the "a"
+// query parameter and serves the results as a JSON list of PtrJS. If
+// the "n" parameter is given, it also returns up to that many bytes
+// of data at each address.
+func (s *state) httpResolve(w http.ResponseWriter, r *http.Request) {
+	n, _ := strconv.Atoi(r.FormValue("n"))
+	var addrs []uint64
+	if a := r.FormValue("a"); a != "" {
+		for _, x := range strings.Split(a, ",") {
+			addr, err := strconv.ParseUint(strings.TrimPrefix(x, "0x"), 16, 64)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("bad address %q", x), http.StatusBadRequest)
+				return
+			}
+			addrs = append(addrs, addr)
+		}
+	}
+	if len(addrs) > maxResolve {
+		http.Error(w, fmt.Sprintf("too many addresses (max %d)", maxResolve), http.StatusBadRequest)
+		return
+	}
+	out := []PtrJS{}
+	for _, addr := range addrs {
+		out = append(out, s.fi.ResolvePtr(addr, n))
+	}
+	serveJSON(w, out)
+}
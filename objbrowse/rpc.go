@@ -0,0 +1,517 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aclements/objbrowse/obj"
+)
+
+// The editor protocol is JSON-RPC 2.0, served by POSTing to /rpc and,
+// with -rpc-stdio, on standard input and output. Results that name a
+// location include a URL that opens it in the web UI. Like any other
+// POST, a request to /rpc from a browser must come from the server's
+// own pages.
+//
+// Methods:
+//
+//	initialize {}                     RPCInfoJS
+//	symbols {re, kind, limit, ...}    []RPCSymJS; params as in /syms
+//	disassemble {name, id, addr}      RPCDisasmJS
+//	symbolAt {addr}                   RPCAddrJS
+//	xrefs {name, id, addr}            RPCXrefsJS
+//
+// id and addr in the symbol parameters pick among symbols with the
+// same name, as in the query form. Addresses may be numbers or hex
+// strings.
+var rpcMethods = []string{"initialize", "symbols", "disassemble", "symbolAt", "xrefs"}
+
+// JSON-RPC error codes.
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcInternalError  = -32603
+)
+
+// rpcNullID is the ID of responses to requests whose ID couldn't be
+// determined.
+var rpcNullID = json.RawMessage("null")
+
+type rpcRequest struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+type rpcResponse struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return e.Message
+}
+
+// RPCInfoJS is the result of initialize.
+type RPCInfoJS struct {
+	Path    string
+	Arch    string `json:",omitempty"`
+	URL     string
+	Methods []string
+}
+
+// RPCSymJS is a symbol in an editor protocol result.
+type RPCSymJS struct {
+	QuerySymJS
+	ID  obj.SymID
+	URL string
+}
+
+// RPCDisasmJS is the result of disassemble. Disasm is in the same
+// form as a symbol page's assembly view.
+type RPCDisasmJS struct {
+	Sym    RPCSymJS
+	Disasm interface{}
+}
+
+// RPCAddrJS is the result of symbolAt. URL is empty if the address
+// isn't in a symbol.
+type RPCAddrJS struct {
+	QueryAddrJS
+	ID  *obj.SymID `json:",omitempty"`
+	URL string     `json:",omitempty"`
+}
+
+// RPCXrefsJS is the result of xrefs.
+type RPCXrefsJS struct {
+	Sym RPCSymJS
+	// Code lists instructions that refer to the symbol's address,
+	// including calls and jumps, and Data lists pointers to it.
+	Code      []RPCAddrJS
+	Data      []RPCAddrJS
+	Truncated bool `json:",omitempty"`
+}
+
+// rpcLinks builds web UI URLs for editor protocol results.
+type rpcLinks struct {
+	// base is the server's URL, without a trailing slash.
+	base  string
+	token string
+}
+
+// sym returns the URL of symbol id's page, highlighting addresses
+// [lo, hi) if hi > lo.
+func (l rpcLinks) sym(name string, id obj.SymID, lo, hi uint64) string {
+	u := l.base + "/s/" + url.PathEscape(name) + "?id=" + strconv.Itoa(int(id))
+	if l.token != "" {
+		u += "&token=" + url.QueryEscape(l.token)
+	}
+	if hi > lo {
+		u += fmt.Sprintf("#%x-%x", lo, hi)
+	}
+	return u
+}
+
+// rpcAddr is an address parameter, which may be a number or a hex
+// string.
+type rpcAddr uint64
+
+func (a *rpcAddr) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		var n uint64
+		if err := json.Unmarshal(b, &n); err != nil {
+			return fmt.Errorf("bad address %s", b)
+		}
+		*a = rpcAddr(n)
+		return nil
+	}
+	n, err := strconv.ParseUint(strings.TrimPrefix(s, "0x"), 16, 64)
+	if err != nil {
+		return fmt.Errorf("bad address %q", s)
+	}
+	*a = rpcAddr(n)
+	return nil
+}
+
+// rpcSymParams selects a symbol, like the query parameters of a
+// symbol page.
+type rpcSymParams struct {
+	Name string
+	ID   *int
+	Addr *rpcAddr
+}
+
+func (s *state) rpcLookupSym(raw json.RawMessage) (obj.SymID, error) {
+	var p rpcSymParams
+	if err := rpcParams(raw, &p); err != nil {
+		return -1, err
+	}
+	if p.Name == "" {
+		return -1, &rpcError{rpcInvalidParams, "missing symbol name"}
+	}
+	vals := url.Values{}
+	if p.ID != nil {
+		vals.Set("id", strconv.Itoa(*p.ID))
+	}
+	if p.Addr != nil {
+		vals.Set("addr", fmt.Sprintf("%x", uint64(*p.Addr)))
+	}
+	id, err := s.lookupSym(p.Name, vals)
+	if err != nil {
+		return -1, &rpcError{rpcInvalidParams, err.Error()}
+	}
+	return id, nil
+}
+
+func rpcParams(raw json.RawMessage, p interface{}) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(raw, p); err != nil {
+		return &rpcError{rpcInvalidParams, err.Error()}
+	}
+	return nil
+}
+
+func (s *state) rpcSym(id obj.SymID, links rpcLinks) RPCSymJS {
+	sym := s.symTab.Syms()[id]
+	return RPCSymJS{
+		QuerySymJS: QuerySymJS{
+			Name:    sym.Name,
+			Kind:    string(rune(sym.Kind)),
+			Addr:    AddrJS(sym.Value),
+			Size:    sym.Size,
+			Local:   sym.Local,
+			Attrs:   symAttrs(sym),
+			Version: sym.Version,
+		},
+		ID:  id,
+		URL: links.sym(sym.Name, id, 0, 0),
+	}
+}
+
+// rpcAddr resolves addr and links to it. If n > 0, the link
+// highlights the n bytes at addr.
+func (s *state) rpcAddr(addr uint64, n uint64, links rpcLinks) RPCAddrJS {
+	a := RPCAddrJS{QueryAddrJS: QueryAddrJS{PtrJS: s.fi.ResolvePtr(addr, 0)}}
+	a.File, a.Line = s.fi.Line(addr)
+	if id, ok := s.symTab.Addr(addr); ok && a.Sym != "" {
+		a.ID = &id
+		if n == 0 {
+			n = 1
+		}
+		a.URL = links.sym(a.Sym, id, addr, addr+n)
+	}
+	return a
+}
+
+// rpcCall runs one editor protocol method.
+func (s *state) rpcCall(method string, params json.RawMessage, links rpcLinks) (interface{}, error) {
+	switch method {
+	case "initialize":
+		info := RPCInfoJS{Path: s.path, URL: links.base, Methods: rpcMethods}
+		if arch := s.bin.Info().Arch; arch != nil {
+			info.Arch = arch.GoArch
+		}
+		return info, nil
+
+	case "symbols":
+		// Decode numbers as written so large limits and sizes
+		// don't turn into floats.
+		var p map[string]interface{}
+		if len(params) > 0 {
+			dec := json.NewDecoder(bytes.NewReader(params))
+			dec.UseNumber()
+			if err := dec.Decode(&p); err != nil {
+				return nil, &rpcError{rpcInvalidParams, err.Error()}
+			}
+		}
+		vals := url.Values{}
+		for k, v := range p {
+			vals.Set(k, fmt.Sprint(v))
+		}
+		q, err := parseSymQuery(vals)
+		if err != nil {
+			return nil, &rpcError{rpcInvalidParams, err.Error()}
+		}
+		out := []RPCSymJS{}
+		for _, sym := range s.symView.Query(q).Syms.Syms {
+			out = append(out, s.rpcSym(s.symID(sym), links))
+		}
+		return out, nil
+
+	case "disassemble":
+		id, err := s.rpcLookupSym(params)
+		if err != nil {
+			return nil, err
+		}
+		sym := s.symTab.Syms()[id]
+		data, err := s.bin.SymbolData(id)
+		if err != nil {
+			return nil, err
+		}
+		info, err := s.asmView.DecodeSym(sym, data.P)
+		if err != nil {
+			return nil, err
+		}
+		if info == nil {
+			return nil, &rpcError{rpcInvalidParams, fmt.Sprintf("%s is not a function", sym.Name)}
+		}
+		return RPCDisasmJS{s.rpcSym(id, links), info}, nil
+
+	case "symbolAt":
+		var p struct{ Addr *rpcAddr }
+		if err := rpcParams(params, &p); err != nil {
+			return nil, err
+		}
+		if p.Addr == nil {
+			return nil, &rpcError{rpcInvalidParams, "missing addr"}
+		}
+		return s.rpcAddr(uint64(*p.Addr), 0, links), nil
+
+	case "xrefs":
+		id, err := s.rpcLookupSym(params)
+		if err != nil {
+			return nil, err
+		}
+		sym := s.symTab.Syms()[id]
+		refs := s.consts.Find(sym.Value)
+		out := RPCXrefsJS{Sym: s.rpcSym(id, links), Code: []RPCAddrJS{}, Data: []RPCAddrJS{}, Truncated: refs.Truncated}
+		for _, r := range refs.Code {
+			// Skip branches within the symbol itself.
+			if uint64(r.Addr)-sym.Value < sym.Size {
+				continue
+			}
+			out.Code = append(out.Code, s.rpcAddr(uint64(r.Addr), s.instLen(uint64(r.Addr)), links))
+		}
+		ptrSize := uint64(8)
+		if arch := s.bin.Info().Arch; arch != nil {
+			ptrSize = uint64(arch.PtrSize)
+		}
+		for _, r := range refs.Data {
+			out.Data = append(out.Data, s.rpcAddr(uint64(r.Addr), ptrSize, links))
+		}
+		return out, nil
+	}
+	return nil, &rpcError{rpcMethodNotFound, fmt.Sprintf("unknown method %q", method)}
+}
+
+// symID returns the ID of sym, which must be in the symbol table.
+func (s *state) symID(sym obj.Sym) obj.SymID {
+	for _, id := range s.symTab.Name(sym.Name) {
+		if s.symTab.Syms()[id] == sym {
+			return id
+		}
+	}
+	return -1
+}
+
+// instLen returns the length of the instruction at pc, or 0 if it
+// can't be decoded.
+func (s *state) instLen(pc uint64) uint64 {
+	id, ok := s.symTab.Addr(pc)
+	if !ok {
+		return 0
+	}
+	insts, err := s.fi.Disasm(id)
+	if err != nil {
+		return 0
+	}
+	for i := 0; i < insts.Len(); i++ {
+		if inst := insts.Get(i); inst.PC() == pc {
+			return uint64(inst.Len())
+		}
+	}
+	return 0
+}
+
+// handleRPC decodes a JSON-RPC request or batch of requests in body,
+// runs them, and returns the encoded response, or nil if the request
+// was only notifications.
+func (srv *server) handleRPC(body []byte, links rpcLinks) []byte {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(body, &batch); err != nil {
+			return rpcEncode(rpcResponse{Version: "2.0", ID: rpcNullID, Error: &rpcError{rpcParseError, err.Error()}})
+		}
+		if len(batch) == 0 {
+			return rpcEncode(rpcResponse{Version: "2.0", ID: rpcNullID, Error: &rpcError{rpcInvalidRequest, "empty batch"}})
+		}
+		var out []rpcResponse
+		for _, req := range batch {
+			if resp, ok := srv.rpcOne(req, links); ok {
+				out = append(out, resp)
+			}
+		}
+		if out == nil {
+			return nil
+		}
+		return rpcEncode(out)
+	}
+	if resp, ok := srv.rpcOne(body, links); ok {
+		return rpcEncode(resp)
+	}
+	return nil
+}
+
+// rpcOne runs a single request. It returns false if the request was
+// a notification, which gets no response.
+func (srv *server) rpcOne(body []byte, links rpcLinks) (rpcResponse, bool) {
+	var req rpcRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return rpcResponse{Version: "2.0", ID: rpcNullID, Error: &rpcError{rpcParseError, err.Error()}}, true
+	}
+	resp := rpcResponse{Version: "2.0", ID: req.ID}
+	if req.ID == nil {
+		resp.ID = rpcNullID
+	}
+	if req.Version != "2.0" || req.Method == "" {
+		resp.Error = &rpcError{rpcInvalidRequest, "not a JSON-RPC 2.0 request"}
+		return resp, true
+	}
+	st := srv.acquire()
+	result, err := st.rpcCall(req.Method, req.Params, links)
+	st.release()
+	if req.ID == nil {
+		// A notification.
+		return resp, false
+	}
+	if err != nil {
+		if rerr, ok := err.(*rpcError); ok {
+			resp.Error = rerr
+		} else {
+			resp.Error = &rpcError{rpcInternalError, err.Error()}
+		}
+	} else {
+		resp.Result = result
+	}
+	return resp, true
+}
+
+func rpcEncode(v interface{}) []byte {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		buf, _ = json.Marshal(rpcResponse{Version: "2.0", ID: rpcNullID, Error: &rpcError{rpcInternalError, err.Error()}})
+	}
+	return buf
+}
+
+// httpRPC serves editor protocol requests POSTed to /rpc.
+func (srv *server) httpRPC(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "JSON-RPC requires POST", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	links := rpcLinks{base: scheme + "://" + r.Host, token: srv.auth.token}
+	resp := srv.handleRPC(body, links)
+	if resp == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+// serveRPCStdio serves editor protocol requests on standard input
+// and output until standard input is closed, and then exits, since
+// that means the editor is done with the server.
+//
+// Requests may be newline-delimited, or framed with Content-Length
+// headers as in the Language Server Protocol. Responses use the
+// framing of the request.
+func (srv *server) serveRPCStdio(links rpcLinks) {
+	r := bufio.NewReader(os.Stdin)
+	for {
+		body, framed, err := readRPCMessage(r)
+		if err == io.EOF {
+			exit(0)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "rpc: %v\n", err)
+			exit(1)
+		}
+		if len(bytes.TrimSpace(body)) == 0 {
+			continue
+		}
+		resp := srv.handleRPC(body, links)
+		if resp == nil {
+			continue
+		}
+		if framed {
+			fmt.Fprintf(os.Stdout, "Content-Length: %d\r\n\r\n", len(resp))
+			os.Stdout.Write(resp)
+		} else {
+			os.Stdout.Write(append(resp, '\n'))
+		}
+	}
+}
+
+// readRPCMessage reads one message from r. framed indicates the
+// message had a Content-Length header.
+func readRPCMessage(r *bufio.Reader) (body []byte, framed bool, err error) {
+	line, err := r.ReadString('\n')
+	if err == io.EOF && len(line) > 0 {
+		err = nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if !strings.HasPrefix(strings.ToLower(line), "content-length:") {
+		return []byte(line), false, nil
+	}
+	n := -1
+	for {
+		if i := strings.Index(line, ":"); i >= 0 && strings.EqualFold(line[:i], "Content-Length") {
+			n, err = strconv.Atoi(strings.TrimSpace(line[i+1:]))
+			if err != nil || n < 0 {
+				return nil, false, fmt.Errorf("bad Content-Length %q", strings.TrimSpace(line[i+1:]))
+			}
+		}
+		line, err = r.ReadString('\n')
+		if err != nil {
+			return nil, false, err
+		}
+		if strings.TrimSpace(line) == "" {
+			break
+		}
+	}
+	body = make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, false, err
+	}
+	return body, true, nil
+}
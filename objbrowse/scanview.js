@@ -0,0 +1,78 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+"use strict";
+
+// ScanView scans the whole binary for a byte pattern, instruction
+// pattern, or constant value and lists the matches.
+class ScanView {
+    constructor(container) {
+        const self = this;
+        $(container).addClass("scanview");
+
+        const form = $("<form>").addClass("search").appendTo(container);
+        this._mode = $("<select>").appendTo(form);
+        for (let [mode, label] of [["re", "instructions"], ["bytes", "bytes"], ["op", "mnemonic"], ["arg", "operand"], ["imm", "immediate"], ["const", "constant xref"]])
+            $("<option>").attr("value", mode).text(label).appendTo(this._mode);
+        this._query = $('<input type="text" size="40" placeholder="scan binary">').
+            attr("title", "instructions: regexps separated by \";\", e.g. \"^XORL;^RET\"\nbytes: hex with ?? wildcards, e.g. \"0f 0b ?? c3\"\nconstant xref: a value or address, e.g. \"0xdeadbeef\"").
+            appendTo(form);
+        this._status = $("<span>").addClass("search-status").appendTo(form);
+        this._progress = $("<progress>").hide().appendTo(form);
+        this._list = $("<table>").appendTo(container);
+
+        form.submit((ev) => {
+            ev.preventDefault();
+            self._scan();
+        });
+    }
+
+    _scan() {
+        const self = this;
+        this._status.text("Scanning…");
+        this._list.empty();
+        this._progress.removeAttr("value").show();
+        const onProgress = (done, total) => {
+            self._progress.attr({value: done, max: total});
+        };
+        const fail = (msg) => {
+            self._status.text(msg);
+        };
+        const always = () => {
+            self._progress.hide();
+        };
+        if (this._mode.val() == "const") {
+            runJob("consts", {v: this._query.val()}, onProgress).done((data) => {
+                const n = data.Code.length + data.Data.length;
+                self._status.text(n + (data.Truncated ? "+" : "") + " references");
+                for (let ref of data.Code)
+                    self._addRow(ref, 1, "code");
+                for (let ref of data.Data)
+                    self._addRow(ref, 1, "data");
+            }).fail(fail).always(always);
+            return;
+        }
+        runJob("scan", {mode: this._mode.val(), q: this._query.val()}, onProgress).done((data) => {
+            self._status.text(data.Hits.length + (data.Truncated ? "+" : "") + " matches");
+            for (let hit of data.Hits)
+                self._addRow(hit, hit.Len, "");
+        }).fail(fail).always(always);
+    }
+
+    // _addRow adds a result for a match of length len at hit.Addr,
+    // linking to the containing symbol if any.
+    _addRow(hit, len, kind) {
+        const addr = new AddrJS(hit.Addr);
+        let loc = $("<td>");
+        if (hit.Sym) {
+            const off = addr.sub(new AddrJS(hit.SymAddr));
+            const range = {start: off, end: off.add(new AddrJS(len))};
+            loc.append($("<a>").attr("href", "/s/" + hit.Sym + "#+" + formatRanges([range])).
+                       text(hit.Sym + "+0x" + off));
+        }
+        $("<tr>").append($("<td>").addClass("pos").text("0x" + addr)).
+            append($("<td>").text(kind)).
+            append(loc).appendTo(this._list);
+    }
+}
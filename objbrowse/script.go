@@ -0,0 +1,635 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/aclements/objbrowse/internal/asm"
+	"github.com/aclements/objbrowse/obj"
+	"go.starlark.net/resolve"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// A Script is an analysis written in Starlark, a dialect of Python,
+// and loaded by -script. Scripts run in the server each time the
+// object file is loaded, and publish their results as overlays on
+// symbol pages or as tables on the main page.
+//
+// Scripts can use these built-in functions:
+//
+//	symbols(kind="", re="")  list of symbols, optionally only those
+//	                         whose kind letter is in kind and whose
+//	                         name matches regexp re
+//	lookup(name)             the symbol named name, or None
+//	symbol_at(addr)          the symbol containing addr, or None
+//	disasm(sym)              list of sym's instructions
+//	relocs(sym)              list of sym's relocations
+//	data(addr, size)         string of up to size bytes at addr
+//	line(pc)                 (file, line) of pc, or None
+//	dwarf(tag)               list of DWARF entries with tag, such as
+//	                         "subprogram" or "variable"
+//	overlay(name, entries)   publish an overlay; entries are dicts
+//	                         with keys start, end, value, color,
+//	                         and label, as in OverlayEntryJS
+//	table(name, columns, rows)
+//	                         publish a table; a cell that's a symbol
+//	                         links to the symbol
+//
+// Functions that take a symbol also accept a symbol name. A symbol has
+// fields id, name, kind, addr, size, local, weak, and dynamic. An
+// instruction has fields pc, len, op, args, text, control (one of "",
+// "jump", "call", "ret", "jump?", or "exit"), conditional, target,
+// and target_sym. A relocation has fields offset, size, type, symbol,
+// and addend. A DWARF entry has fields offset, tag, name, and attrs,
+// a dict keyed by lower-case attribute names as in debug/dwarf, such
+// as "lowpc" and "declfile".
+//
+// Output from print is shown with the script's results.
+type Script struct {
+	Name string
+	path string
+	prog *starlark.Program
+}
+
+// scriptBuiltins lists the names of the functions scripts can call.
+var scriptBuiltins = []string{"symbols", "lookup", "symbol_at", "disasm", "relocs", "data", "line", "dwarf", "overlay", "table"}
+
+func init() {
+	// Scripts are analyses the user chose to run, not untrusted
+	// configuration, so enable the whole language, including
+	// top-level loops.
+	resolve.AllowNestedDef = true
+	resolve.AllowLambda = true
+	resolve.AllowFloat = true
+	resolve.AllowSet = true
+	resolve.AllowGlobalReassign = true
+	resolve.AllowRecursion = true
+}
+
+// maxScriptData limits the bytes a single data call may read.
+const maxScriptData = 64 << 20
+
+// loadScript loads and compiles the script at path.
+func loadScript(path string) (*Script, error) {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	isPredeclared := func(name string) bool {
+		for _, b := range scriptBuiltins {
+			if b == name {
+				return true
+			}
+		}
+		return false
+	}
+	_, prog, err := starlark.SourceProgram(path, src, isPredeclared)
+	if err != nil {
+		return nil, err
+	}
+	return &Script{Name: filepath.Base(path), path: path, prog: prog}, nil
+}
+
+// ScriptResultJS is the result of running a script.
+type ScriptResultJS struct {
+	Name   string
+	Output string `json:",omitempty"`
+	Error  string `json:",omitempty"`
+	// Overlays lists the names of the overlays the script
+	// published.
+	Overlays []string        `json:",omitempty"`
+	Tables   []ScriptTableJS `json:",omitempty"`
+}
+
+// ScriptTableJS is a table published by a script. Each cell is either
+// a string or a ScriptSymJS.
+type ScriptTableJS struct {
+	Name    string
+	Columns []string
+	Rows    [][]interface{}
+}
+
+// ScriptSymJS is a table cell that links to a symbol.
+type ScriptSymJS struct {
+	Sym string
+	ID  obj.SymID
+}
+
+// ScriptRunner runs the -script scripts against the object file.
+type ScriptRunner struct {
+	fi      *FileInfo
+	scripts []*Script
+
+	once    sync.Once
+	results []ScriptResultJS
+}
+
+func NewScriptRunner(fi *FileInfo, scripts []*Script) *ScriptRunner {
+	return &ScriptRunner{fi: fi, scripts: scripts}
+}
+
+// prepare runs the scripts if they haven't been already, reporting
+// progress to progress, which may be nil.
+func (r *ScriptRunner) prepare(progress progressFunc) {
+	r.once.Do(func() {
+		r.results = []ScriptResultJS{}
+		for i, s := range r.scripts {
+			if progress != nil {
+				progress(i, len(r.scripts))
+			}
+			r.results = append(r.results, r.run(s))
+		}
+		if progress != nil {
+			progress(len(r.scripts), len(r.scripts))
+		}
+	})
+}
+
+// Results returns the results of each script, running them if
+// necessary.
+func (r *ScriptRunner) Results() []ScriptResultJS {
+	r.prepare(nil)
+	return r.results
+}
+
+func (r *ScriptRunner) run(s *Script) ScriptResultJS {
+	res := ScriptResultJS{Name: s.Name}
+	var out strings.Builder
+	thread := &starlark.Thread{
+		Name: s.Name,
+		Print: func(_ *starlark.Thread, msg string) {
+			out.WriteString(msg)
+			out.WriteByte('\n')
+		},
+	}
+	b := &scriptBuiltinsEnv{fi: r.fi, res: &res}
+	predeclared := starlark.StringDict{
+		"symbols":   starlark.NewBuiltin("symbols", b.symbols),
+		"lookup":    starlark.NewBuiltin("lookup", b.lookup),
+		"symbol_at": starlark.NewBuiltin("symbol_at", b.symbolAt),
+		"disasm":    starlark.NewBuiltin("disasm", b.disasm),
+		"relocs":    starlark.NewBuiltin("relocs", b.relocs),
+		"data":      starlark.NewBuiltin("data", b.data),
+		"line":      starlark.NewBuiltin("line", b.line),
+		"dwarf":     starlark.NewBuiltin("dwarf", b.dwarf),
+		"overlay":   starlark.NewBuiltin("overlay", b.overlay),
+		"table":     starlark.NewBuiltin("table", b.table),
+	}
+	if _, err := s.prog.Init(thread, predeclared); err != nil {
+		if evalErr, ok := err.(*starlark.EvalError); ok {
+			res.Error = evalErr.Backtrace()
+		} else {
+			res.Error = err.Error()
+		}
+	}
+	res.Output = out.String()
+	return res
+}
+
+// scriptBuiltinsEnv implements the built-in functions for one run of
+// a script.
+type scriptBuiltinsEnv struct {
+	fi  *FileInfo
+	res *ScriptResultJS
+}
+
+// Struct constructors, which identify the kind of a struct.
+var (
+	scriptSymbol = starlark.String("symbol")
+	scriptInst   = starlark.String("inst")
+	scriptReloc  = starlark.String("reloc")
+	scriptDIE    = starlark.String("dwarf_entry")
+)
+
+func (b *scriptBuiltinsEnv) symValue(id obj.SymID) starlark.Value {
+	sym := b.fi.SymTab.Syms()[id]
+	return starlarkstruct.FromStringDict(scriptSymbol, starlark.StringDict{
+		"id":      starlark.MakeInt(int(id)),
+		"name":    starlark.String(sym.Name),
+		"kind":    starlark.String(string(rune(sym.Kind))),
+		"addr":    starlark.MakeUint64(sym.Value),
+		"size":    starlark.MakeUint64(sym.Size),
+		"local":   starlark.Bool(sym.Local),
+		"weak":    starlark.Bool(sym.Weak),
+		"dynamic": starlark.Bool(sym.Dynamic),
+	})
+}
+
+// symArg returns the ID of the symbol v, which is either a symbol
+// struct or a symbol name.
+func (b *scriptBuiltinsEnv) symArg(fn string, v starlark.Value) (obj.SymID, error) {
+	switch v := v.(type) {
+	case starlark.String:
+		id, ok := b.fi.SymTab.Lookup(string(v))
+		if !ok {
+			return 0, fmt.Errorf("%s: unknown symbol %q", fn, string(v))
+		}
+		return id, nil
+	case *starlarkstruct.Struct:
+		if v.Constructor() == scriptSymbol {
+			idv, err := v.Attr("id")
+			if err != nil {
+				return 0, err
+			}
+			id, err := starlark.AsInt32(idv)
+			if err != nil || id < 0 || id >= len(b.fi.SymTab.Syms()) {
+				return 0, fmt.Errorf("%s: bad symbol id", fn)
+			}
+			return obj.SymID(id), nil
+		}
+	}
+	return 0, fmt.Errorf("%s: want symbol or name, got %s", fn, v.Type())
+}
+
+func uint64Arg(fn string, v starlark.Value) (uint64, error) {
+	i, ok := v.(starlark.Int)
+	if !ok {
+		return 0, fmt.Errorf("%s: want int, got %s", fn, v.Type())
+	}
+	x, ok := i.Uint64()
+	if !ok {
+		return 0, fmt.Errorf("%s: %s out of range", fn, i)
+	}
+	return x, nil
+}
+
+func (b *scriptBuiltinsEnv) symbols(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var kind, re string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "kind?", &kind, "re?", &re); err != nil {
+		return nil, err
+	}
+	var rx *regexp.Regexp
+	if re != "" {
+		var err error
+		if rx, err = regexp.Compile(re); err != nil {
+			return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+		}
+	}
+	var out []starlark.Value
+	for i, sym := range b.fi.SymTab.Syms() {
+		if kind != "" && !strings.ContainsRune(kind, rune(sym.Kind)) {
+			continue
+		}
+		if rx != nil && !rx.MatchString(sym.Name) {
+			continue
+		}
+		out = append(out, b.symValue(obj.SymID(i)))
+	}
+	return starlark.NewList(out), nil
+}
+
+func (b *scriptBuiltinsEnv) lookup(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name string
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &name); err != nil {
+		return nil, err
+	}
+	id, ok := b.fi.SymTab.Lookup(name)
+	if !ok {
+		return starlark.None, nil
+	}
+	return b.symValue(id), nil
+}
+
+func (b *scriptBuiltinsEnv) symbolAt(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var addrV starlark.Value
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &addrV); err != nil {
+		return nil, err
+	}
+	addr, err := uint64Arg(fn.Name(), addrV)
+	if err != nil {
+		return nil, err
+	}
+	id, ok := b.fi.SymTab.Addr(addr)
+	if !ok {
+		return starlark.None, nil
+	}
+	return b.symValue(id), nil
+}
+
+var scriptControlNames = map[asm.ControlType]string{
+	asm.ControlNone:        "",
+	asm.ControlJump:        "jump",
+	asm.ControlCall:        "call",
+	asm.ControlRet:         "ret",
+	asm.ControlJumpUnknown: "jump?",
+	asm.ControlExit:        "exit",
+}
+
+func (b *scriptBuiltinsEnv) disasm(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var symV starlark.Value
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &symV); err != nil {
+		return nil, err
+	}
+	id, err := b.symArg(fn.Name(), symV)
+	if err != nil {
+		return nil, err
+	}
+	if b.fi.SymTab.Syms()[id].Kind != obj.SymText {
+		return nil, fmt.Errorf("%s: %s is not a function", fn.Name(), b.fi.SymTab.Syms()[id].Name)
+	}
+	insts, err := b.fi.Disasm(id)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	out := make([]starlark.Value, 0, insts.Len())
+	for i := 0; i < insts.Len(); i++ {
+		inst := insts.Get(i)
+		text := inst.GoSyntax(b.fi.SymTab.SymName)
+		op, instArgs := parseAsm(text)
+		argVals := make(starlark.Tuple, len(instArgs))
+		for j, a := range instArgs {
+			argVals[j] = starlark.String(a)
+		}
+		control := inst.Control()
+		var target, targetSym starlark.Value = starlark.None, starlark.None
+		if control.TargetPC != 0 {
+			target = starlark.MakeUint64(control.TargetPC)
+			if name, _ := b.fi.SymTab.SymName(control.TargetPC); name != "" {
+				targetSym = starlark.String(name)
+			}
+		}
+		out = append(out, starlarkstruct.FromStringDict(scriptInst, starlark.StringDict{
+			"pc":          starlark.MakeUint64(inst.PC()),
+			"len":         starlark.MakeInt(inst.Len()),
+			"op":          starlark.String(op),
+			"args":        argVals,
+			"text":        starlark.String(text),
+			"control":     starlark.String(scriptControlNames[control.Type]),
+			"conditional": starlark.Bool(control.Conditional),
+			"target":      target,
+			"target_sym":  targetSym,
+		}))
+	}
+	return starlark.NewList(out), nil
+}
+
+func (b *scriptBuiltinsEnv) relocs(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var symV starlark.Value
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &symV); err != nil {
+		return nil, err
+	}
+	id, err := b.symArg(fn.Name(), symV)
+	if err != nil {
+		return nil, err
+	}
+	syms := b.fi.SymTab.Syms()
+	sym := syms[id]
+	data, err := b.fi.Obj.SymbolData(id)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	var out []starlark.Value
+	var rel obj.Reloc
+	for i := 0; i < data.R.Len(); i++ {
+		data.R.Get(i, &rel)
+		// R may include relocations outside the symbol.
+		if rel.Offset < sym.Value || rel.Offset-sym.Value >= sym.Size {
+			continue
+		}
+		var target starlark.Value = starlark.None
+		if rel.Symbol >= 0 && int(rel.Symbol) < len(syms) {
+			target = starlark.String(syms[rel.Symbol].Name)
+		}
+		out = append(out, starlarkstruct.FromStringDict(scriptReloc, starlark.StringDict{
+			"offset": starlark.MakeUint64(rel.Offset),
+			"size":   starlark.MakeInt(int(rel.Size)),
+			"type":   starlark.String(rel.Type.String()),
+			"symbol": target,
+			"addend": starlark.MakeInt64(rel.Addend),
+		}))
+	}
+	return starlark.NewList(out), nil
+}
+
+func (b *scriptBuiltinsEnv) data(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var addrV, sizeV starlark.Value
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 2, &addrV, &sizeV); err != nil {
+		return nil, err
+	}
+	addr, err := uint64Arg(fn.Name(), addrV)
+	if err != nil {
+		return nil, err
+	}
+	size, err := uint64Arg(fn.Name(), sizeV)
+	if err != nil {
+		return nil, err
+	}
+	if size > maxScriptData {
+		return nil, fmt.Errorf("%s: size %d is too large", fn.Name(), size)
+	}
+	d, err := b.fi.Obj.Data(addr, size)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	return starlark.String(d.P), nil
+}
+
+func (b *scriptBuiltinsEnv) line(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var pcV starlark.Value
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &pcV); err != nil {
+		return nil, err
+	}
+	pc, err := uint64Arg(fn.Name(), pcV)
+	if err != nil {
+		return nil, err
+	}
+	file, line := b.fi.Line(pc)
+	if file == "" {
+		return starlark.None, nil
+	}
+	return starlark.Tuple{starlark.String(file), starlark.MakeInt(line)}, nil
+}
+
+func (b *scriptBuiltinsEnv) dwarf(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var tag string
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &tag); err != nil {
+		return nil, err
+	}
+	tag = strings.ToLower(tag)
+	dw, err := b.fi.DWARF()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	var out []starlark.Value
+	r := dw.Reader()
+	for {
+		ent, err := r.Next()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+		}
+		if ent == nil {
+			break
+		}
+		if dwarfName(ent.Tag.String(), "Tag") != tag {
+			continue
+		}
+		attrs := starlark.NewDict(len(ent.Field))
+		for _, f := range ent.Field {
+			key := dwarfName(f.Attr.String(), "Attr")
+			attrs.SetKey(starlark.String(key), dwarfValue(f.Val))
+		}
+		name, _ := ent.Val(dwarf.AttrName).(string)
+		out = append(out, starlarkstruct.FromStringDict(scriptDIE, starlark.StringDict{
+			"offset": starlark.MakeUint64(uint64(ent.Offset)),
+			"tag":    starlark.String(tag),
+			"name":   starlark.String(name),
+			"attrs":  attrs,
+		}))
+	}
+	return starlark.NewList(out), nil
+}
+
+// dwarfName returns the script name of a DWARF tag or attribute
+// given its debug/dwarf name, such as "TagSubprogram" or
+// "AttrLowpc", and that name's prefix.
+func dwarfName(name, prefix string) string {
+	return strings.ToLower(strings.TrimPrefix(name, prefix))
+}
+
+// dwarfValue converts a DWARF attribute value to a Starlark value.
+func dwarfValue(v interface{}) starlark.Value {
+	switch v := v.(type) {
+	case int64:
+		return starlark.MakeInt64(v)
+	case uint64:
+		return starlark.MakeUint64(v)
+	case dwarf.Offset:
+		return starlark.MakeUint64(uint64(v))
+	case bool:
+		return starlark.Bool(v)
+	case string:
+		return starlark.String(v)
+	case []byte:
+		return starlark.String(v)
+	}
+	return starlark.String(fmt.Sprint(v))
+}
+
+func (b *scriptBuiltinsEnv) overlay(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name string
+	var entries starlark.Iterable
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 2, &name, &entries); err != nil {
+		return nil, err
+	}
+	o := &OverlayJS{Name: name, Entries: []OverlayEntryJS{}}
+	iter := entries.Iterate()
+	defer iter.Done()
+	var x starlark.Value
+	for i := 0; iter.Next(&x); i++ {
+		d, ok := x.(*starlark.Dict)
+		if !ok {
+			return nil, fmt.Errorf("%s: entry %d: want dict, got %s", fn.Name(), i, x.Type())
+		}
+		var e OverlayEntryJS
+		for _, item := range d.Items() {
+			key, _ := starlark.AsString(item[0])
+			v := item[1]
+			var err error
+			switch key {
+			case "start", "end":
+				var addr uint64
+				addr, err = uint64Arg(fn.Name(), v)
+				if key == "start" {
+					e.Start = AddrJS(addr)
+				} else {
+					e.End = AddrJS(addr)
+				}
+			case "value":
+				f, ok := starlark.AsFloat(v)
+				if !ok {
+					err = fmt.Errorf("value must be a number")
+				}
+				e.Value = &f
+			case "color", "label":
+				s, ok := starlark.AsString(v)
+				if !ok {
+					err = fmt.Errorf("%s must be a string", key)
+				} else if key == "color" {
+					e.Color = s
+				} else {
+					e.Label = s
+				}
+			default:
+				err = fmt.Errorf("unknown key %s", item[0])
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: entry %d: %v", fn.Name(), i, err)
+			}
+		}
+		o.Entries = append(o.Entries, e)
+	}
+	if err := o.check(); err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	overlays.put(o)
+	events.publish("overlay", o.Name)
+	b.res.Overlays = append(b.res.Overlays, o.Name)
+	return starlark.None, nil
+}
+
+func (b *scriptBuiltinsEnv) table(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name string
+	var columns, rows starlark.Iterable
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 3, &name, &columns, &rows); err != nil {
+		return nil, err
+	}
+	t := ScriptTableJS{Name: name, Columns: []string{}, Rows: [][]interface{}{}}
+	forEach(columns, func(v starlark.Value) {
+		t.Columns = append(t.Columns, scriptCell(v).(string))
+	})
+	var err error
+	forEach(rows, func(row starlark.Value) {
+		cells, ok := row.(starlark.Iterable)
+		if !ok {
+			if err == nil {
+				err = fmt.Errorf("%s: want row list, got %s", fn.Name(), row.Type())
+			}
+			return
+		}
+		var r []interface{}
+		forEach(cells, func(v starlark.Value) {
+			r = append(r, scriptCell(v))
+		})
+		t.Rows = append(t.Rows, r)
+	})
+	if err != nil {
+		return nil, err
+	}
+	b.res.Tables = append(b.res.Tables, t)
+	return starlark.None, nil
+}
+
+func forEach(it starlark.Iterable, fn func(v starlark.Value)) {
+	iter := it.Iterate()
+	defer iter.Done()
+	var x starlark.Value
+	for iter.Next(&x) {
+		fn(x)
+	}
+}
+
+// scriptCell converts v to a table cell: a ScriptSymJS for a symbol,
+// and otherwise a string.
+func scriptCell(v starlark.Value) interface{} {
+	if s, ok := v.(*starlarkstruct.Struct); ok && s.Constructor() == scriptSymbol {
+		name, _ := s.Attr("name")
+		idv, _ := s.Attr("id")
+		id, _ := starlark.AsInt32(idv)
+		str, _ := starlark.AsString(name)
+		return ScriptSymJS{str, obj.SymID(id)}
+	}
+	if s, ok := starlark.AsString(v); ok {
+		return s
+	}
+	return v.String()
+}
@@ -0,0 +1,60 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+"use strict";
+
+// ScriptView shows the output, tables, and overlays of the -script
+// analyses.
+class ScriptView {
+    constructor(names, container) {
+        const self = this;
+        const details = $("<details>").addClass("scriptview").appendTo(container);
+        $("<summary>").text("Scripts (" + names.join(", ") + ")").appendTo(details);
+        this._div = $("<div>").appendTo(details);
+        details.one("toggle", () => { self._load(); });
+    }
+
+    _load() {
+        const div = this._div.text("Running…");
+        const onProgress = (done, total) => {
+            div.text("Running… " + done + "/" + total + " scripts");
+        };
+        runJob("scripts", {}, onProgress).done((results) => {
+            div.empty();
+            for (let r of results)
+                this._result(div, r);
+        }).fail((err) => {
+            showError("Scripts", err, div.empty());
+        });
+    }
+
+    _result(div, r) {
+        $("<h4>").text(r.Name).appendTo(div);
+        if (r.Output)
+            $("<pre>").addClass("script-output").text(r.Output).appendTo(div);
+        if (r.Error)
+            showError(r.Name, r.Error, div);
+        if (r.Overlays)
+            $("<div>").addClass("sv-note").
+                text("Published overlays: " + r.Overlays.join(", ")).appendTo(div);
+        for (let t of r.Tables || []) {
+            const details = $("<details>").appendTo(div);
+            $("<summary>").text(t.Name + " (" + t.Rows.length + " rows)").appendTo(details);
+            const table = $("<table>").appendTo(details);
+            const head = $("<tr>").appendTo(table);
+            for (let col of t.Columns)
+                $("<th>").text(col).appendTo(head);
+            for (let row of t.Rows) {
+                const tr = $("<tr>").appendTo(table);
+                for (let cell of row) {
+                    const td = $("<td>").appendTo(tr);
+                    if (typeof cell == "string")
+                        td.text(cell);
+                    else
+                        td.append($("<a>").attr("href", symURL(cell.Sym, cell.ID)).text(cell.Sym));
+                }
+            }
+        }
+    }
+}
@@ -0,0 +1,358 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aclements/objbrowse/obj"
+)
+
+// Search finds instructions and byte patterns in a symbol, a
+// section, or the whole object.
+type Search struct {
+	fi *FileInfo
+}
+
+func NewSearch(fi *FileInfo) *Search {
+	return &Search{fi}
+}
+
+// maxSearchHits is the maximum number of hits returned by a search.
+const maxSearchHits = 1000
+
+type SearchJS struct {
+	Hits []SearchHitJS
+	// Truncated indicates that there were more than
+	// maxSearchHits hits and only the first are returned.
+	Truncated bool `json:",omitempty"`
+}
+
+type SearchHitJS struct {
+	Addr AddrJS
+	Len  int
+
+	// Sym and SymAddr give the name and address of the symbol
+	// containing the hit, if any.
+	Sym     string `json:",omitempty"`
+	SymAddr AddrJS `json:",omitempty"`
+}
+
+// A searchQuery matches instructions or bytes. Exactly one of the
+// match fields is set, depending on the search mode.
+type searchQuery struct {
+	op    string  // Mnemonic, case-insensitive
+	arg   string  // Operand substring, lower case
+	imm   *uint64 // Immediate operand value
+	bytes []int   // Byte pattern; -1 is a wildcard
+	// Instruction sequence, matched against consecutive
+	// instructions in Go syntax.
+	seq []*regexp.Regexp
+}
+
+// parseSearch parses query q in the given mode: "op" for instruction
+// mnemonics, "arg" for operand substrings, "imm" for immediate
+// values, "bytes" for hex byte patterns where "??" matches any byte,
+// or "re" for a sequence of instruction regexps separated by ";".
+func parseSearch(mode, q string) (*searchQuery, error) {
+	q = strings.TrimSpace(q)
+	if q == "" {
+		return nil, fmt.Errorf("empty search")
+	}
+	switch mode {
+	case "op":
+		return &searchQuery{op: q}, nil
+	case "arg":
+		return &searchQuery{arg: strings.ToLower(q)}, nil
+	case "imm":
+		v, ok := parseImm(q)
+		if !ok {
+			return nil, fmt.Errorf("bad immediate value %q", q)
+		}
+		return &searchQuery{imm: &v}, nil
+	case "bytes":
+		pat, err := parseBytePattern(q)
+		if err != nil {
+			return nil, err
+		}
+		return &searchQuery{bytes: pat}, nil
+	case "re":
+		var seq []*regexp.Regexp
+		for i, part := range strings.Split(q, ";") {
+			// An empty part would match any instruction.
+			part = strings.TrimSpace(part)
+			if part == "" {
+				return nil, fmt.Errorf("empty instruction pattern %d in sequence", i+1)
+			}
+			re, err := regexp.Compile("(?i)" + part)
+			if err != nil {
+				return nil, err
+			}
+			seq = append(seq, re)
+		}
+		return &searchQuery{seq: seq}, nil
+	}
+	return nil, fmt.Errorf("unknown search mode %q", mode)
+}
+
+// parseImm parses a signed or unsigned integer in Go syntax and
+// returns its 64-bit representation.
+func parseImm(s string) (uint64, bool) {
+	if v, err := strconv.ParseInt(s, 0, 64); err == nil {
+		return uint64(v), true
+	}
+	if v, err := strconv.ParseUint(s, 0, 64); err == nil {
+		return v, true
+	}
+	return 0, false
+}
+
+// parseBytePattern parses a hex byte pattern such as "48 8b ?? 24".
+// Spaces are optional.
+func parseBytePattern(s string) ([]int, error) {
+	s = strings.Join(strings.Fields(s), "")
+	if len(s)%2 != 0 {
+		return nil, fmt.Errorf("byte pattern has odd number of digits")
+	}
+	pat := make([]int, len(s)/2)
+	for i := range pat {
+		digits := s[2*i : 2*i+2]
+		if digits == "??" {
+			pat[i] = -1
+			continue
+		}
+		b, err := strconv.ParseUint(digits, 16, 8)
+		if err != nil {
+			return nil, fmt.Errorf("bad byte %q in pattern", digits)
+		}
+		pat[i] = int(b)
+	}
+	return pat, nil
+}
+
+// matchInst returns whether the Go syntax instruction op args
+// matches q.
+func (q *searchQuery) matchInst(op string, args []string) bool {
+	switch {
+	case q.op != "":
+		// op may include prefixes, like "LOCK; XADDL".
+		for _, f := range strings.Fields(op) {
+			if strings.EqualFold(strings.TrimSuffix(f, ";"), q.op) {
+				return true
+			}
+		}
+	case q.arg != "":
+		for _, arg := range args {
+			if strings.Contains(strings.ToLower(arg), q.arg) {
+				return true
+			}
+		}
+	case q.imm != nil:
+		for _, arg := range args {
+			if !strings.HasPrefix(arg, "$") {
+				continue
+			}
+			if v, ok := parseImm(arg[1:]); ok && v == *q.imm {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// searchBytes appends the hits for byte pattern pat in data to hits.
+func searchBytes(data obj.Data, pat []int, hits []SearchHitJS) []SearchHitJS {
+	p := data.P
+outer:
+	for i := 0; i+len(pat) <= len(p); i++ {
+		for j, b := range pat {
+			if b >= 0 && int(p[i+j]) != b {
+				continue outer
+			}
+		}
+		hits = append(hits, SearchHitJS{Addr: AddrJS(data.Addr + uint64(i)), Len: len(pat)})
+		if len(hits) > maxSearchHits {
+			break
+		}
+	}
+	return hits
+}
+
+// matchInsts returns the number of instructions at the beginning of
+// texts that match q, or 0 if q doesn't match there. texts are
+// instructions in Go syntax.
+func (q *searchQuery) matchInsts(texts []string) int {
+	if q.seq == nil {
+		if q.matchInst(parseAsm(texts[0])) {
+			return 1
+		}
+		return 0
+	}
+	if len(texts) < len(q.seq) {
+		return 0
+	}
+	for i, re := range q.seq {
+		if !re.MatchString(texts[i]) {
+			return 0
+		}
+	}
+	return len(q.seq)
+}
+
+// searchInsts appends the instructions in symbol sym matching q to
+// hits.
+func (s *Search) searchInsts(id obj.SymID, q *searchQuery, hits []SearchHitJS) ([]SearchHitJS, error) {
+	insts, err := s.fi.Disasm(id)
+	if err != nil {
+		return hits, err
+	}
+	sym := s.fi.SymTab.Syms()[id]
+	texts := make([]string, insts.Len())
+	for i := range texts {
+		texts[i] = insts.Get(i).GoSyntax(s.fi.SymTab.SymName)
+	}
+	for i := range texts {
+		n := q.matchInsts(texts[i:])
+		if n == 0 {
+			continue
+		}
+		first, last := insts.Get(i), insts.Get(i+n-1)
+		end := last.PC() + uint64(last.Len())
+		hits = append(hits, SearchHitJS{
+			Addr: AddrJS(first.PC()), Len: int(end - first.PC()),
+			Sym: sym.Name, SymAddr: AddrJS(sym.Value),
+		})
+		if len(hits) > maxSearchHits {
+			break
+		}
+	}
+	return hits, nil
+}
+
+// searchText appends the instructions matching q in all text
+// symbols in [lo, hi) to hits.
+func (s *Search) searchText(lo, hi uint64, q *searchQuery, hits []SearchHitJS, progress progressFunc) []SearchHitJS {
+	var ids []obj.SymID
+	for i, sym := range s.fi.SymTab.Syms() {
+		if sym.Kind == obj.SymText && sym.Size != 0 && lo <= sym.Value && sym.Value < hi {
+			ids = append(ids, obj.SymID(i))
+		}
+	}
+	for i, id := range ids {
+		if progress != nil {
+			progress(i, len(ids))
+		}
+		// Skip symbols that can't be disassembled.
+		hits, _ = s.searchInsts(id, q, hits)
+		if len(hits) > maxSearchHits {
+			break
+		}
+	}
+	if progress != nil {
+		progress(len(ids), len(ids))
+	}
+	return hits
+}
+
+// Search runs a search in the given mode for q. If sym is not -1, it
+// searches only that symbol. Otherwise, if section is not "",
+// it searches only that section. Otherwise, it searches the whole
+// object: all loaded sections for byte patterns, or all text symbols
+// for instruction searches. If progress is non-nil, Search reports
+// its progress through the text symbols to it.
+func (s *Search) Search(sym obj.SymID, section, mode, q string, progress progressFunc) (*SearchJS, error) {
+	query, err := parseSearch(mode, q)
+	if err != nil {
+		return nil, err
+	}
+	symTab := s.fi.SymTab
+	var hits []SearchHitJS
+
+	switch {
+	case sym != -1:
+		if query.bytes != nil {
+			data, err := s.fi.Obj.SymbolData(sym)
+			if err != nil {
+				return nil, err
+			}
+			hits = searchBytes(data, query.bytes, hits)
+			break
+		}
+		if symTab.Syms()[sym].Kind != obj.SymText {
+			return nil, fmt.Errorf("%s is not a text symbol", symTab.Syms()[sym].Name)
+		}
+		hits, err = s.searchInsts(sym, query, hits)
+		if err != nil {
+			return nil, err
+		}
+
+	case section != "":
+		sects := s.fi.Obj.Sections()
+		si := -1
+		for i, sect := range sects {
+			if sect.Name == section {
+				si = i
+				break
+			}
+		}
+		if si < 0 {
+			return nil, fmt.Errorf("unknown section %q", section)
+		}
+		if query.bytes != nil {
+			data, err := s.fi.Obj.SectionData(si)
+			if err != nil {
+				return nil, err
+			}
+			hits = searchBytes(data, query.bytes, hits)
+			break
+		}
+		sect := sects[si]
+		hits = s.searchText(sect.Addr, sect.Addr+sect.Size, query, hits, progress)
+
+	default:
+		if query.bytes == nil {
+			hits = s.searchText(0, ^uint64(0), query, hits, progress)
+			break
+		}
+		for _, i := range s.fi.DataSections() {
+			data, err := s.fi.Obj.SectionData(i)
+			if err != nil {
+				return nil, err
+			}
+			hits = searchBytes(data, query.bytes, hits)
+			if len(hits) > maxSearchHits {
+				break
+			}
+		}
+	}
+
+	// Attribute byte pattern hits to symbols.
+	for i := range hits {
+		hit := &hits[i]
+		if hit.Sym != "" {
+			continue
+		}
+		if id, ok := symTab.Addr(uint64(hit.Addr)); ok {
+			sym := symTab.Syms()[id]
+			if uint64(hit.Addr) < sym.Value+sym.Size {
+				hit.Sym, hit.SymAddr = sym.Name, AddrJS(sym.Value)
+			}
+		}
+	}
+
+	sort.Slice(hits, func(i, j int) bool { return hits[i].Addr < hits[j].Addr })
+	out := &SearchJS{Hits: hits}
+	if len(hits) > maxSearchHits {
+		out.Hits, out.Truncated = hits[:maxSearchHits], true
+	}
+	if out.Hits == nil {
+		out.Hits = []SearchHitJS{}
+	}
+	return out, nil
+}
@@ -0,0 +1,59 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+"use strict";
+
+// SearchBar searches a symbol's instructions or bytes on the server
+// and steps through the hits by highlighting them in all views.
+class SearchBar {
+    constructor(sym, symID, container) {
+        const self = this;
+        this._sym = sym;
+        this._symID = symID;
+        this._hits = [];
+        this._cur = -1;
+
+        const form = $("<form>").addClass("search").appendTo(container);
+        this._mode = $("<select>").appendTo(form);
+        for (let [mode, label] of [["op", "mnemonic"], ["arg", "operand"], ["imm", "immediate"], ["bytes", "bytes"], ["re", "regexp"]])
+            $("<option>").attr("value", mode).text(label).appendTo(this._mode);
+        this._query = $('<input type="text" size="20" placeholder="search">').appendTo(form);
+        $('<button type="button">').text("◀").click(() => self._step(-1)).appendTo(form);
+        $('<button type="button">').text("▶").click(() => self._step(1)).appendTo(form);
+        this._status = $("<span>").addClass("search-status").appendTo(form);
+
+        form.submit((ev) => {
+            ev.preventDefault();
+            self._search();
+        });
+    }
+
+    _search() {
+        const self = this;
+        const params = {sym: this._sym, id: this._symID, mode: this._mode.val(), q: this._query.val()};
+        $.getJSON("/search", params).done((data) => {
+            self._hits = data.Hits.map((hit) => {
+                const start = new AddrJS(hit.Addr);
+                return {start: start, end: start.add(new AddrJS(hit.Len))};
+            });
+            self._truncated = data.Truncated;
+            self._cur = -1;
+            if (self._hits.length == 0)
+                self._status.text("no matches");
+            else
+                self._step(1);
+        }).fail((xhr) => {
+            self._status.text(xhr.responseText.trim());
+        });
+    }
+
+    _step(delta) {
+        const n = this._hits.length;
+        if (n == 0)
+            return;
+        this._cur = (this._cur + delta + n) % n;
+        this._status.text((this._cur + 1) + " of " + n + (this._truncated ? "+" : ""));
+        highlightRanges([this._hits[this._cur]], null);
+    }
+}
@@ -0,0 +1,225 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aclements/objbrowse/obj"
+)
+
+// SectionAuditJS lists how each section is loaded and the findings of
+// auditing those permissions.
+type SectionAuditJS struct {
+	Sections []AuditSectionJS
+	// Segments are the ELF program headers, if any.
+	Segments []AuditSegmentJS `json:",omitempty"`
+	// RELRO is "full", "partial", or "none" for linked ELF files,
+	// or "" if it doesn't apply.
+	RELRO    string `json:",omitempty"`
+	Findings []AuditFindingJS
+	Errors   []string `json:",omitempty"`
+}
+
+type AuditSectionJS struct {
+	Name string
+	Addr AddrJS
+	Size uint64
+	// Flags is some combination of "A", "W", and "X", like
+	// readelf, or "" if unknown.
+	Flags string
+	Zero  bool `json:",omitempty"`
+	// RELRO indicates the section is made read-only after
+	// relocation.
+	RELRO bool `json:",omitempty"`
+}
+
+type AuditSegmentJS struct {
+	Type     string
+	Addr     AddrJS
+	MemSize  uint64
+	FileSize uint64
+	// Flags is some combination of "R", "W", and "E", like
+	// readelf.
+	Flags string
+}
+
+// AuditFindingJS is a problem found by the audit. Severity is
+// "error" or "warning". Kind is one of "wx-section", "wx-segment",
+// "exec-stack", "exec-data", "relro-gap", "lazy-binding", or
+// "large-bss".
+type AuditFindingJS struct {
+	Kind     string
+	Severity string
+	// Section or Segment names what the finding is about.
+	Section string `json:",omitempty"`
+	Segment string `json:",omitempty"`
+	Message string
+}
+
+// auditSeverities orders the finding severities.
+var auditSeverities = map[string]int{"warning": 1, "error": 2}
+
+// defaultBSSLimit is the size above which a zero-initialized section
+// is reported as unusually large.
+const defaultBSSLimit = 16 << 20
+
+// relroSections are the sections that hold pointers the dynamic
+// linker only writes during relocation, so RELRO should protect them.
+// .got.plt is handled separately because it's only protected with
+// BIND_NOW.
+var relroSections = map[string]bool{
+	".got": true, ".data.rel.ro": true, ".dynamic": true,
+	".init_array": true, ".fini_array": true, ".preinit_array": true,
+}
+
+// isDataSection reports whether name is a section that should never
+// be executable.
+func isDataSection(name string) bool {
+	for _, p := range []string{".data", ".rodata", ".bss", ".tdata", ".tbss", ".noptr", ".got", ".dynamic", ".init_array", ".fini_array", ".preinit_array"} {
+		if name == p || strings.HasPrefix(name, p+".") {
+			return true
+		}
+	}
+	return name == ".noptrdata" || name == ".noptrbss"
+}
+
+// auditSections audits the permissions of the object's sections.
+// Zero-initialized sections larger than bssLimit are reported.
+func (s *state) auditSections(bssLimit uint64) *SectionAuditJS {
+	out := &SectionAuditJS{Sections: []AuditSectionJS{}, Findings: []AuditFindingJS{}}
+	add := func(f AuditFindingJS) {
+		out.Findings = append(out.Findings, f)
+	}
+	segs, _ := obj.ReadELFSegments(s.bin)
+
+	// Index the segments.
+	var loads []obj.ELFSegment
+	var relro *obj.ELFSegment
+	var stack *obj.ELFSegment
+	for i := range segs {
+		seg := &segs[i]
+		flags := ""
+		for _, f := range []struct {
+			set bool
+			c   string
+		}{{seg.Read, "R"}, {seg.Write, "W"}, {seg.Exec, "E"}} {
+			if f.set {
+				flags += f.c
+			}
+		}
+		out.Segments = append(out.Segments, AuditSegmentJS{seg.Type, AddrJS(seg.Addr), seg.MemSize, seg.FileSize, flags})
+		name := fmt.Sprintf("%s at %#x", seg.Type, seg.Addr)
+		switch seg.Type {
+		case "PT_LOAD":
+			loads = append(loads, *seg)
+			if seg.Write && seg.Exec {
+				add(AuditFindingJS{Kind: "wx-segment", Severity: "error", Segment: name,
+					Message: "segment is both writable and executable"})
+			}
+		case "PT_GNU_RELRO":
+			relro = seg
+		case "PT_GNU_STACK":
+			stack = seg
+			if seg.Exec {
+				add(AuditFindingJS{Kind: "exec-stack", Severity: "error", Segment: seg.Type,
+					Message: "stack is executable"})
+			}
+		}
+	}
+	linked := len(loads) > 0
+	if linked && stack == nil {
+		add(AuditFindingJS{Kind: "exec-stack", Severity: "warning",
+			Message: "no PT_GNU_STACK header, so the stack may be executable"})
+	}
+	inSeg := func(seg *obj.ELFSegment, sect obj.Section) bool {
+		return seg.Addr <= sect.Addr && sect.Addr+sect.Size <= seg.Addr+seg.MemSize
+	}
+	loadOf := func(sect obj.Section) *obj.ELFSegment {
+		for i := range loads {
+			if inSeg(&loads[i], sect) {
+				return &loads[i]
+			}
+		}
+		return nil
+	}
+
+	var bindNow bool
+	if linked {
+		d, _ := obj.ReadELFDynamic(s.bin)
+		bindNow = d.BindNow
+		out.Errors = append(out.Errors, d.Errors...)
+		switch {
+		case relro == nil:
+			out.RELRO = "none"
+		case bindNow:
+			out.RELRO = "full"
+		default:
+			out.RELRO = "partial"
+		}
+	}
+
+	for _, sect := range s.bin.Sections() {
+		as := AuditSectionJS{Name: sect.Name, Addr: AddrJS(sect.Addr), Size: sect.Size, Flags: sect.Flags.String(), Zero: sect.Zero}
+		as.RELRO = relro != nil && sect.Size > 0 && inSeg(relro, sect)
+		out.Sections = append(out.Sections, as)
+		if sect.Flags&obj.SectAlloc == 0 || sect.Size == 0 {
+			continue
+		}
+		write, exec := sect.Flags&obj.SectWrite != 0, sect.Flags&obj.SectExec != 0
+
+		if write && exec {
+			add(AuditFindingJS{Kind: "wx-section", Severity: "error", Section: sect.Name,
+				Message: "section is both writable and executable"})
+		} else if exec && (sect.Zero || isDataSection(sect.Name)) {
+			add(AuditFindingJS{Kind: "exec-data", Severity: "error", Section: sect.Name,
+				Message: "data section is executable"})
+		} else if !exec && !write && !sect.Zero && !strings.HasPrefix(sect.Name, ".note") {
+			// Older linkers put read-only data in the text
+			// segment, where it can be executed. Notes are
+			// only read by the loader.
+			if seg := loadOf(sect); seg != nil && seg.Exec {
+				add(AuditFindingJS{Kind: "exec-data", Severity: "warning", Section: sect.Name,
+					Message: fmt.Sprintf("non-executable section is mapped by executable segment at %#x", seg.Addr)})
+			}
+		}
+
+		if linked && write && !as.RELRO {
+			switch {
+			case relroSections[sect.Name]:
+				add(AuditFindingJS{Kind: "relro-gap", Severity: "warning", Section: sect.Name,
+					Message: "section stays writable because RELRO doesn't cover it"})
+			case sect.Name == ".got.plt" && relro != nil && !bindNow:
+				add(AuditFindingJS{Kind: "lazy-binding", Severity: "warning", Section: sect.Name,
+					Message: "section stays writable because symbols are bound lazily; link with -z now for full RELRO"})
+			}
+		}
+
+		if sect.Zero && sect.Size > bssLimit {
+			add(AuditFindingJS{Kind: "large-bss", Severity: "warning", Section: sect.Name,
+				Message: fmt.Sprintf("zero-initialized section is %d bytes", sect.Size)})
+		}
+	}
+	return out
+}
+
+// httpSectionAudit serves the section permission audit as JSON. The
+// optional "bss" parameter is the size in bytes above which
+// zero-initialized sections are reported.
+func (s *state) httpSectionAudit(w http.ResponseWriter, r *http.Request) {
+	bssLimit := uint64(defaultBSSLimit)
+	if v := r.FormValue("bss"); v != "" {
+		var err error
+		bssLimit, err = strconv.ParseUint(v, 0, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("bad bss limit %q", v), http.StatusBadRequest)
+			return
+		}
+	}
+	serveJSON(w, s.auditSections(bssLimit))
+}
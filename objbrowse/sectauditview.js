@@ -0,0 +1,70 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+"use strict";
+
+// SectionAuditView lists the sections with their load permissions and
+// highlights writable and executable memory, RELRO gaps, and large
+// zero-initialized sections.
+class SectionAuditView {
+    constructor(container) {
+        const details = $("<details>").addClass("sectauditview").appendTo(container);
+        $("<summary>").text("Section permissions").appendTo(details);
+        const div = $("<div>").appendTo(details);
+
+        details.one("toggle", () => {
+            div.text("Loading…");
+            $.getJSON("/section-audit").done((data) => {
+                div.empty();
+                if (data.RELRO)
+                    $("<div>").text("RELRO: " + data.RELRO).appendTo(div);
+
+                const findings = $("<table>").addClass("audit-table").appendTo(div);
+                if (data.Findings.length == 0)
+                    findings.append($("<tr>").append($("<td>").text("No findings.")));
+                const flagged = new Set();
+                for (let f of data.Findings) {
+                    if (f.Section)
+                        flagged.add(f.Section);
+                    $("<tr>").append(
+                        $("<td>").addClass("audit-" + f.Severity).text(f.Severity),
+                        $("<td>").text(f.Section || f.Segment || ""),
+                        $("<td>").text(f.Message)).appendTo(findings);
+                }
+
+                $("<h4>").text("Sections").appendTo(div);
+                const sects = $("<table>").addClass("audit-table").appendTo(div);
+                $("<tr>").append(["name", "address", "size", "flags", "RELRO"].map((h) => $("<th>").text(h))).appendTo(sects);
+                for (let s of data.Sections) {
+                    const tr = $("<tr>").append(
+                        $("<td>").text(s.Name),
+                        $("<td>").text("0x" + s.Addr),
+                        $("<td>").addClass("pos").text(s.Size + (s.Zero ? " (zero)" : "")),
+                        $("<td>").text(s.Flags),
+                        $("<td>").text(s.RELRO ? "yes" : "")).appendTo(sects);
+                    if (flagged.has(s.Name))
+                        tr.addClass("audit-flagged");
+                }
+
+                if (data.Segments) {
+                    $("<h4>").text("Segments").appendTo(div);
+                    const segs = $("<table>").addClass("audit-table").appendTo(div);
+                    $("<tr>").append(["type", "address", "memory size", "file size", "flags"].map((h) => $("<th>").text(h))).appendTo(segs);
+                    for (let s of data.Segments) {
+                        $("<tr>").append(
+                            $("<td>").text(s.Type),
+                            $("<td>").text("0x" + s.Addr),
+                            $("<td>").addClass("pos").text(s.MemSize),
+                            $("<td>").addClass("pos").text(s.FileSize),
+                            $("<td>").text(s.Flags)).appendTo(segs);
+                    }
+                }
+                for (let err of data.Errors || [])
+                    $("<div>").addClass("audit-error").text(err).appendTo(div);
+            }).fail((xhr) => {
+                showError("Section permissions", xhr, div.empty());
+            });
+        });
+    }
+}
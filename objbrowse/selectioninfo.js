@@ -0,0 +1,145 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+"use strict";
+
+// SelectionInfo is a strip that summarizes the selected address
+// ranges of a symbol and offers a link to share the selection.
+class SelectionInfo {
+    constructor(title, container) {
+        this._title = title;
+        this._div = $("<div>").addClass("selinfo").hide().appendTo(container);
+    }
+
+    update(ranges) {
+        const div = this._div.empty();
+        if (ranges.length == 0 || baseAddr === undefined) {
+            div.hide();
+            return;
+        }
+        div.show();
+
+        let bytes = 0;
+        for (let r of ranges)
+            bytes += r.end.sub(r.start).toNumber();
+        const field = (key, val) => {
+            $("<span>").addClass("selinfo-field").
+                append($("<span>").addClass("selinfo-key").text(key + " ")).
+                append(val).appendTo(div);
+        };
+        const rs = ranges.map((r) => "0x" + r.start + "–0x" + r.end).join(", ");
+        field("selection", document.createTextNode(rs));
+        field("bytes", document.createTextNode(bytes));
+
+        // Collect referenced symbols from the views.
+        const syms = new Map();
+        const merge = (m) => {
+            for (let [name, n] of m)
+                syms.set(name, (syms.get(name) || 0) + n);
+        };
+        if (asmView) {
+            const sum = asmView.summarize(ranges);
+            field("instructions", document.createTextNode(sum.insts));
+            merge(sum.syms);
+        }
+        if (hexView)
+            merge(hexView.referencedSyms(ranges));
+        if (syms.size > 0) {
+            const list = $("<span>");
+            for (let name of Array.from(syms.keys()).sort()) {
+                if (list.children().length > 0)
+                    list.append(", ");
+                const n = syms.get(name);
+                list.append($("<a>").attr("href", symURL(name)).text(name + (n > 1 ? " ×" + n : "")));
+            }
+            field("references", list);
+        }
+
+        // Share the selection relative to the symbol so the link
+        // survives relinking.
+        const rel = ranges.map((r) => ({start: r.start.sub(baseAddr), end: r.end.sub(baseAddr)}));
+        const url = window.location.origin + window.location.pathname + window.location.search +
+              "#+" + formatRanges(rel);
+        const link = $("<a>").attr("href", url).text("link");
+        const share = $("<span>").append(link);
+        if (navigator.clipboard) {
+            share.append(" ").append($("<button>").text("Copy").click(function() {
+                const button = $(this);
+                navigator.clipboard.writeText(url).then(() => button.text("Copied"));
+            }));
+        }
+        field("share", share);
+
+        if (asmView) {
+            this._fetchProbe(ranges[0].start);
+            this._fetchStats(ranges);
+        }
+    }
+
+    // _fetchProbe adds how to attach a kprobe or uprobe at addr.
+    _fetchProbe(addr) {
+        const probeToken = this._probeToken = {};
+        const span = $("<span>").addClass("selinfo-field").appendTo(this._div);
+        $.getJSON("/probe", {a: addr.toString()}).done((probe) => {
+            if (probeToken !== this._probeToken || !probe.Location)
+                return;
+            const copy = (text) => {
+                const code = $("<code>").text(text);
+                if (!navigator.clipboard)
+                    return code;
+                return $("<span>").append(code, " ", $("<button>").text("Copy").click(function() {
+                    const button = $(this);
+                    navigator.clipboard.writeText(text).then(() => button.text("Copied"));
+                }));
+            };
+            span.append($("<span>").addClass("selinfo-key").text((probe.Kernel ? "kprobe" : "uprobe") + " "),
+                        copy(probe.Location));
+            if (probe.Bpftrace)
+                span.append(" ", copy(probe.Bpftrace));
+            if (probe.Warnings)
+                span.attr("title", probe.Warnings.join("\n")).addClass("selinfo-warn");
+        });
+    }
+
+    // _fetchStats adds the instruction statistics of ranges from
+    // the server.
+    _fetchStats(ranges) {
+        const token = this._token = {};
+        const div = $("<div>").addClass("selinfo-stats").text("Computing statistics…").appendTo(this._div);
+        $.getJSON("/range-stats", {r: formatRanges(ranges)}).done((stats) => {
+            if (token !== this._token)
+                return;
+            div.empty();
+            const field = (key, val) =>
+                  $("<span>").addClass("selinfo-field").
+                  append($("<span>").addClass("selinfo-key").text(key + " ")).
+                  append(val).appendTo(div);
+            const mix = ["Loads", "Stores", "Branches", "Calls", "SIMD"].
+                  map((k) => k.toLowerCase() + " " + stats[k]).join(", ");
+            field("mix", document.createTextNode(mix));
+            field("est. cycles", document.createTextNode(stats.Cycles.toFixed(2))).
+                attr("title", "sum of reciprocal throughputs; ignores dependencies");
+            const counts = (list) => {
+                const span = $("<span>");
+                list.slice(0, 10).forEach((c, i) => {
+                    if (i > 0)
+                        span.append(", ");
+                    span.append($("<a>").attr("href", symURL(c.Name)).text(c.Name)).
+                        append(c.Count > 1 ? " ×" + c.Count : "");
+                });
+                if (list.length > 10)
+                    span.append(", …");
+                return span;
+            };
+            if (stats.CallTargets.length > 0)
+                field("calls", counts(stats.CallTargets));
+            const ops = stats.Ops.slice(0, 10).map((c) => c.Name + " " + c.Count).join(", ");
+            if (ops)
+                field("ops", document.createTextNode(ops + (stats.Ops.length > 10 ? ", …" : "")));
+        }).fail((xhr) => {
+            if (token === this._token)
+                showError("Statistics", xhr, div.empty());
+        });
+    }
+}
@@ -0,0 +1,134 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aclements/objbrowse/internal/logging"
+)
+
+// logger is the server's log. Handlers should log to their request's
+// logger, from reqLog, so records carry the request ID.
+var logger = logging.New(&serverLog)
+
+// serverLog writes records to standard error and keeps the recent
+// warnings and errors for the server log panel.
+var serverLog = logHandler{
+	text: logging.NewTextHandler(os.Stderr, logging.LevelDebug),
+	min:  logging.LevelInfo,
+}
+
+// maxRecentLogs is the number of warnings and errors kept for the
+// server log panel.
+const maxRecentLogs = 200
+
+type logHandler struct {
+	text *logging.TextHandler
+	// min is the minimum level written to standard error. It's
+	// lowered to LevelDebug by -verbose.
+	min logging.Level
+
+	mu     sync.Mutex
+	seq    int
+	recent []LogRecordJS
+}
+
+// LogRecordJS is a warning or error from the server log, as shown in
+// the server log panel.
+type LogRecordJS struct {
+	// Seq numbers the records in the order they were logged.
+	Seq   int
+	Time  time.Time
+	Level string
+	Msg   string
+	Attrs []LogAttrJS `json:",omitempty"`
+}
+
+type LogAttrJS struct {
+	Key, Value string
+}
+
+func (h *logHandler) Enabled(level logging.Level) bool {
+	return level >= h.min || level >= logging.LevelWarn
+}
+
+func (h *logHandler) Handle(r logging.Record) {
+	if r.Level >= h.min {
+		h.text.Handle(r)
+	}
+	if r.Level < logging.LevelWarn {
+		return
+	}
+	rec := LogRecordJS{Time: r.Time, Level: r.Level.String(), Msg: r.Msg}
+	for _, a := range r.Attrs {
+		rec.Attrs = append(rec.Attrs, LogAttrJS{a.Key, a.String()})
+	}
+	h.mu.Lock()
+	h.seq++
+	rec.Seq = h.seq
+	if len(h.recent) == maxRecentLogs {
+		h.recent = append(h.recent[:0], h.recent[1:]...)
+	}
+	h.recent = append(h.recent, rec)
+	h.mu.Unlock()
+
+	data, err := json.Marshal(rec)
+	if err == nil {
+		events.publish("log", string(data))
+	}
+}
+
+// forSym returns the recent records that are about symbol sym or
+// about no particular symbol. If sym is "", it returns them all.
+func (h *logHandler) forSym(sym string) []LogRecordJS {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := []LogRecordJS{}
+recs:
+	for _, rec := range h.recent {
+		for _, a := range rec.Attrs {
+			if a.Key == "sym" && sym != "" && a.Value != sym {
+				continue recs
+			}
+		}
+		out = append(out, rec)
+	}
+	return out
+}
+
+// httpLog serves the recent warnings and errors relevant to the
+// symbol given by the "sym" parameter, as a JSON []LogRecordJS. New
+// records are sent to /events as "log" events.
+func httpLog(w http.ResponseWriter, r *http.Request) {
+	serveJSON(w, serverLog.forSym(r.FormValue("sym")))
+}
+
+// reqSeq numbers requests for their "req" log attribute.
+var reqSeq uint64
+
+type logKey struct{}
+
+// withReqLog returns r with a logger that tags records with a new
+// request ID.
+func withReqLog(r *http.Request) (*http.Request, *logging.Logger) {
+	lg := logger.With("req", atomic.AddUint64(&reqSeq, 1))
+	return r.WithContext(context.WithValue(r.Context(), logKey{}, lg)), lg
+}
+
+// reqLog returns the logger of request r, or the server's logger if r
+// has none.
+func reqLog(r *http.Request) *logging.Logger {
+	if lg, ok := r.Context().Value(logKey{}).(*logging.Logger); ok {
+		return lg
+	}
+	return logger
+}
@@ -0,0 +1,80 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+"use strict";
+
+// ServerLogPanel is a drawer listing the server's recent warnings and
+// errors, from /log, such as problems parsing DWARF. On a symbol
+// page, it lists only those about the page's symbol or about no
+// particular symbol. While it's open, new records stream in from the
+// server's "log" events.
+class ServerLogPanel {
+    // symID is the ID of the page's symbol, or undefined.
+    constructor(symID) {
+        this._symID = symID;
+        this._panel = $("<div>").addClass("history-panel").hide().appendTo(document.body);
+        const head = $("<div>").addClass("history-head").text("Server log").appendTo(this._panel);
+        $("<a>").attr({href: "#", title: "close"}).addClass("history-close").text("×").appendTo(head).
+            click((ev) => {
+                ev.preventDefault();
+                this.toggle();
+            });
+        this._list = $("<table>").addClass("log-list").appendTo(this._panel);
+        this._lastSeq = 0;
+        this._listening = false;
+    }
+
+    // toggle shows or hides the panel.
+    toggle() {
+        this._panel.toggle();
+        if (!this._panel.is(":visible"))
+            return;
+        if (!this._listening) {
+            this._listening = true;
+            eventSource().addEventListener("log", (ev) => {
+                const rec = JSON.parse(ev.data);
+                if (this._relevant(rec))
+                    this._add(rec);
+            });
+        }
+        this._load();
+    }
+
+    // _relevant reports whether rec is about the page's symbol or
+    // about no particular symbol.
+    _relevant(rec) {
+        if (this._symID === undefined)
+            return true;
+        const sym = (rec.Attrs || []).find((a) => a.Key === "sym");
+        return !sym || sym.Value === String(this._symID);
+    }
+
+    _load() {
+        const params = this._symID === undefined ? {} : {sym: this._symID};
+        $.getJSON("/log", params).done((recs) => {
+            this._list.empty();
+            this._lastSeq = 0;
+            for (let rec of recs)
+                this._add(rec);
+            if (recs.length === 0)
+                this._list.append($("<tr>").addClass("log-empty").append($("<td>").text("No warnings.")));
+        }).fail((xhr) => {
+            showError("Server log", xhr, this._list.empty());
+        });
+    }
+
+    _add(rec) {
+        // A record may arrive both as an event and from _load.
+        if (rec.Seq <= this._lastSeq)
+            return;
+        this._lastSeq = rec.Seq;
+        this._list.find(".log-empty").remove();
+        const attrs = (rec.Attrs || []).map((a) => a.Key + "=" + a.Value).join(" ");
+        $("<tr>").addClass("log-" + rec.Level).
+            append($("<td>").addClass("log-time").text(new Date(rec.Time).toLocaleTimeString())).
+            append($("<td>").addClass("log-level").text(rec.Level)).
+            append($("<td>").text(rec.Msg).append($("<div>").addClass("log-attrs").text(attrs))).
+            appendTo(this._list);
+    }
+}
@@ -0,0 +1,275 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// shareSession is the shared session of -share, which lets several
+// browsers walk through the object together. Each page that joins is
+// a member. Members see each other's pages and selections, and one
+// member at a time may lead, which the pages of members who follow
+// track.
+//
+// A page joins by opening the event stream at /session/events and
+// stays a member while it's connected. Changes are announced to
+// members as "session" events carrying a SessionJS.
+var shareSession sessionHub
+
+// Limits on session members, so a misbehaving client can't grow the
+// session without bound.
+const (
+	maxSessionMembers = 64
+	maxSessionName    = 64
+	maxSessionField   = 4 << 10
+)
+
+// sessionGrace is how long a member that disconnects stays in the
+// session. Navigating to another page reconnects, and the leader
+// shouldn't lose the lead by following a link.
+const sessionGrace = 5 * time.Second
+
+// sessionColors are the colors of members, assigned in turn.
+var sessionColors = []string{"#e6194b", "#3cb44b", "#4363d8", "#f58231", "#911eb4", "#42d4f4", "#f032e6", "#9a6324"}
+
+type sessionHub struct {
+	events eventHub
+
+	mu      sync.Mutex
+	members map[string]*sessionMember
+	lead    string
+	joined  int
+}
+
+type sessionMember struct {
+	SessionMemberJS
+	// joined orders members by when they joined.
+	joined int
+	// conns is the number of the member's open event streams.
+	conns int
+}
+
+// SessionJS is the state of the shared session.
+type SessionJS struct {
+	// Members are the members of the session, in the order they
+	// joined.
+	Members []SessionMemberJS
+	// Lead is the ID of the member leading the session, if any.
+	Lead string `json:",omitempty"`
+}
+
+// SessionMemberJS is one member of the shared session.
+type SessionMemberJS struct {
+	// ID identifies the member's page. Pages choose their own
+	// IDs and keep them across navigation.
+	ID    string
+	Name  string
+	Color string
+	// Page is the path and query of the member's page. Selection
+	// is the page's selected ranges, in the form of its location
+	// hash.
+	Page      string
+	Selection string `json:",omitempty"`
+}
+
+// SessionUpdateJS changes a member of the session. Fields that are
+// nil are left unchanged.
+type SessionUpdateJS struct {
+	ID        string
+	Name      *string
+	Page      *string
+	Selection *string
+	// Lead takes the lead if true and gives it up if false.
+	Lead *bool
+}
+
+// state returns the session. s.mu must be held.
+func (s *sessionHub) state() SessionJS {
+	members := make([]*sessionMember, 0, len(s.members))
+	for _, m := range s.members {
+		members = append(members, m)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].joined < members[j].joined
+	})
+	out := SessionJS{Members: []SessionMemberJS{}, Lead: s.lead}
+	for _, m := range members {
+		out.Members = append(out.Members, m.SessionMemberJS)
+	}
+	return out
+}
+
+// announce sends the session to its members. s.mu must be held, so
+// members see changes in order.
+func (s *sessionHub) announce() {
+	buf, err := json.Marshal(s.state())
+	if err != nil {
+		panic(err)
+	}
+	s.events.publish("session", string(buf))
+}
+
+// join adds the page with the given ID to the session, or reconnects
+// it if it's already a member.
+func (s *sessionHub) join(id, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if m, ok := s.members[id]; ok {
+		m.conns++
+		return nil
+	}
+	if len(s.members) >= maxSessionMembers {
+		return fmt.Errorf("session has %d members", maxSessionMembers)
+	}
+	if s.members == nil {
+		s.members = make(map[string]*sessionMember)
+	}
+	s.joined++
+	if name == "" {
+		name = fmt.Sprintf("Guest %d", s.joined)
+	}
+	s.members[id] = &sessionMember{
+		SessionMemberJS: SessionMemberJS{
+			ID:    id,
+			Name:  name,
+			Color: sessionColors[(s.joined-1)%len(sessionColors)],
+		},
+		joined: s.joined,
+		conns:  1,
+	}
+	s.announce()
+	return nil
+}
+
+// leave closes one of member id's connections. The member leaves
+// the session if it doesn't reconnect within sessionGrace.
+func (s *sessionHub) leave(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.members[id]
+	if !ok {
+		return
+	}
+	m.conns--
+	if m.conns > 0 {
+		return
+	}
+	time.AfterFunc(sessionGrace, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.members[id] != m || m.conns > 0 {
+			return
+		}
+		delete(s.members, id)
+		if s.lead == id {
+			s.lead = ""
+		}
+		s.announce()
+	})
+}
+
+// localPage reports whether page is an absolute path on this server.
+// Browsers strip tabs and newlines from URLs and treat backslashes as
+// slashes, so a page containing either could name another host.
+func localPage(page string) bool {
+	if strings.Contains(page, `\`) || strings.IndexFunc(page, unicode.IsControl) >= 0 {
+		return false
+	}
+	u, err := url.Parse(page)
+	return err == nil && u.Scheme == "" && u.Host == "" && strings.HasPrefix(page, "/") && !strings.HasPrefix(page, "//")
+}
+
+// update applies u to its member.
+func (s *sessionHub) update(u SessionUpdateJS) error {
+	if u.Name != nil && (*u.Name == "" || len(*u.Name) > maxSessionName) {
+		return fmt.Errorf("name must be 1 to %d bytes", maxSessionName)
+	}
+	// Other members link to and follow Page, so it must be a page
+	// of this server.
+	if u.Page != nil && !localPage(*u.Page) {
+		return fmt.Errorf("page must be a path on this server")
+	}
+	for _, f := range []*string{u.Page, u.Selection} {
+		if f != nil && len(*f) > maxSessionField {
+			return fmt.Errorf("field longer than %d bytes", maxSessionField)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.members[u.ID]
+	if !ok {
+		return fmt.Errorf("no session member %q", u.ID)
+	}
+	if u.Name != nil {
+		m.Name = *u.Name
+	}
+	if u.Page != nil {
+		m.Page = *u.Page
+	}
+	if u.Selection != nil {
+		m.Selection = *u.Selection
+	}
+	if u.Lead != nil {
+		if *u.Lead {
+			s.lead = u.ID
+		} else if s.lead == u.ID {
+			s.lead = ""
+		}
+	}
+	s.announce()
+	return nil
+}
+
+// httpSession serves the session as a SessionJS on GET and applies a
+// SessionUpdateJS on POST.
+func httpSession(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		shareSession.mu.Lock()
+		st := shareSession.state()
+		shareSession.mu.Unlock()
+		serveJSON(w, st)
+	case http.MethodPost:
+		var u SessionUpdateJS
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4*maxSessionField)).Decode(&u); err != nil {
+			http.Error(w, "bad session update: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := shareSession.update(u); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// httpSessionEvents joins the page whose ID is the "id" parameter to
+// the session, under the name in the "name" parameter, and streams
+// the session's events to it until it disconnects.
+func httpSessionEvents(w http.ResponseWriter, r *http.Request) {
+	id, name := r.FormValue("id"), r.FormValue("name")
+	if id == "" || len(id) > maxSessionName || len(name) > maxSessionName {
+		http.Error(w, "bad session member", http.StatusBadRequest)
+		return
+	}
+	if err := shareSession.join(id, name); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer shareSession.leave(id)
+	shareSession.events.ServeHTTP(w, r)
+}
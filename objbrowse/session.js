@@ -0,0 +1,160 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+"use strict";
+
+var sessionBar;
+
+// sessionURL returns the URL of member m's page and selection, or null
+// if m has no page or its page isn't on this server.
+function sessionURL(m) {
+    if (!m.Page)
+        return null;
+    const url = new URL(m.Page + (m.Selection ? "#" + m.Selection : ""), location.origin);
+    if (url.origin !== location.origin)
+        return null;
+    return url.href;
+}
+
+// sessionRanges parses a member's selection, which is in the form of a
+// location hash, relative to the symbol at baseAddr if it starts with
+// "+".
+function sessionRanges(sel) {
+    if (!sel || baseAddr === undefined)
+        return [];
+    const relative = sel[0] == "+";
+    const ranges = parseRanges(relative ? sel.substr(1) : sel);
+    if (relative) {
+        for (let r of ranges) {
+            r.start = r.start.add(baseAddr);
+            r.end = r.end.add(baseAddr);
+        }
+    }
+    return ranges.sort((a, b) => a.start.compare(b.start));
+}
+
+// SessionBar joins this page to the server's shared session and shows
+// its members. It marks the selections of members on the same page
+// and, when following, takes this page wherever the leader goes.
+class SessionBar {
+    constructor() {
+        // The page keeps its identity and whether it follows as
+        // it navigates, but each tab is its own member.
+        this._id = sessionStorage.getItem("objbrowse.session.id");
+        if (!this._id) {
+            const buf = new Uint8Array(8);
+            crypto.getRandomValues(buf);
+            this._id = Array.from(buf, (b) => b.toString(16).padStart(2, "0")).join("");
+            sessionStorage.setItem("objbrowse.session.id", this._id);
+        }
+        this._following = sessionStorage.getItem("objbrowse.session.follow") === "1";
+        this._page = location.pathname + location.search;
+        this._session = {Members: []};
+
+        this._bar = $("<div>").addClass("session-bar").appendTo(document.body);
+        const params = {id: this._id, name: settings.get("session.name", "")};
+        const source = new EventSource("/session/events?" + $.param(params));
+        // Announcing where this page is also sends it the session.
+        source.addEventListener("open", () => {
+            this._post({Page: this._page, Selection: this._selection()});
+        });
+        source.addEventListener("session", (ev) => this._update(JSON.parse(ev.data)));
+        source.addEventListener("error", () => {
+            this._bar.addClass("session-lost").attr("title", "reconnecting to the session…");
+        });
+        window.addEventListener("hashchange", () => {
+            this._post({Selection: this._selection()});
+        });
+    }
+
+    _selection() {
+        return location.hash.replace(/^#/, "");
+    }
+
+    _post(update) {
+        update.ID = this._id;
+        return $.ajax({url: "/session", method: "POST", contentType: "application/json",
+                       data: JSON.stringify(update)}).
+            fail((xhr) => { showError("Session", xhr); });
+    }
+
+    _leading() {
+        return this._session.Lead === this._id;
+    }
+
+    // toggleLead takes the lead of the session or gives it up.
+    toggleLead() {
+        this._post({Lead: !this._leading()});
+    }
+
+    // toggleFollow starts or stops following the leader.
+    toggleFollow() {
+        this._following = !this._following;
+        sessionStorage.setItem("objbrowse.session.follow", this._following ? "1" : "");
+        this._update(this._session);
+    }
+
+    _rename() {
+        const me = this._session.Members.find((m) => m.ID === this._id);
+        const name = prompt("Your name in the session", me ? me.Name : "");
+        if (!name)
+            return;
+        settings.set("session.name", name);
+        this._post({Name: name});
+    }
+
+    _update(s) {
+        this._session = s;
+        this._bar.removeClass("session-lost").removeAttr("title");
+        this._render();
+
+        // Mark the selections of the others on this page.
+        const peers = [];
+        for (let m of s.Members) {
+            if (m.ID !== this._id && m.Page === this._page)
+                peers.push({name: m.Name, color: m.Color, ranges: sessionRanges(m.Selection)});
+        }
+        if (asmView)
+            asmView.markPeers(peers);
+        if (sourceView)
+            sourceView.markPeers(peers);
+
+        // Go where the leader is.
+        const lead = s.Members.find((m) => m.ID === s.Lead);
+        if (!this._following || !lead || this._leading() || !lead.Page)
+            return;
+        if (lead.Page !== this._page) {
+            const url = sessionURL(lead);
+            if (url)
+                location = url;
+        } else if (lead.Selection && lead.Selection !== this._selection()) {
+            const ranges = sessionRanges(lead.Selection);
+            if (ranges.length)
+                highlightRanges(ranges, null);
+        }
+    }
+
+    _render() {
+        const bar = this._bar.empty();
+        const s = this._session;
+        $("<span>").addClass("session-head").text("Session").appendTo(bar);
+        for (let m of s.Members) {
+            const item = $("<span>").addClass("session-member").appendTo(bar);
+            $("<span>").addClass("session-dot").css("background-color", m.Color).appendTo(item);
+            const href = sessionURL(m);
+            const name = $(href ? "<a>" : "<span>").text(m.Name).appendTo(item);
+            if (href)
+                name.attr({href: href, title: "go to " + href});
+            if (m.ID === this._id)
+                item.addClass("session-me").append(" (you)");
+            if (m.ID === s.Lead)
+                $("<span>").addClass("session-lead").text("leads").appendTo(item);
+        }
+        const button = (label, title, fn) => $('<button type="button">').text(label).attr("title", title).click(fn).appendTo(bar);
+        button(this._leading() ? "Stop leading" : "Lead", "others who follow go where you go", () => this.toggleLead());
+        if (!this._leading())
+            button(this._following ? "Stop following" : "Follow", "go where the leader goes", () => this.toggleFollow());
+        button("Rename", "change your name in the session", () => this._rename());
+    }
+}
@@ -0,0 +1,182 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// settings are the user preferences of each browser, such as hex
+// view formatting. Browsers are identified by a cookie, and the
+// settings persist in the -settings file.
+var settings settingsStore
+
+// settingsCookie identifies a browser to the settings store.
+const settingsCookie = "objbrowse-client"
+
+// Limits on the settings store, since any browser that can reach the
+// server can add to it.
+const (
+	maxSettingsBytes   = 64 << 10 // Per update
+	maxSettingsKeys    = 256      // Per browser
+	maxSettingsClients = 1000
+)
+
+var settingKeyRe = regexp.MustCompile(`^[a-zA-Z0-9_.-]{1,64}$`)
+
+type settingsStore struct {
+	mu      sync.Mutex
+	file    jsonFile
+	clients map[string]*clientSettings
+}
+
+type clientSettings struct {
+	Used   time.Time
+	Values map[string]json.RawMessage
+}
+
+// load reads the settings persisted at path, which later updates
+// will write back to. A missing file is not an error.
+func (s *settingsStore) load(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.file = jsonFile{what: "settings", path: path}
+	s.clients = make(map[string]*clientSettings)
+	if err := s.file.load(&s.clients); err != nil {
+		s.clients = make(map[string]*clientSettings)
+		return err
+	}
+	return nil
+}
+
+// get returns the settings of browser id.
+func (s *settingsStore) get(id string) map[string]json.RawMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]json.RawMessage)
+	if c := s.clients[id]; c != nil {
+		for k, v := range c.Values {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// update applies changes to the settings of browser id. A null value
+// deletes a setting.
+func (s *settingsStore) update(id string, changes map[string]json.RawMessage) error {
+	for k := range changes {
+		if !settingKeyRe.MatchString(k) {
+			return fmt.Errorf("bad setting name %q", k)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.clients == nil {
+		s.clients = make(map[string]*clientSettings)
+	}
+	c := s.clients[id]
+	if c == nil {
+		c = &clientSettings{Values: make(map[string]json.RawMessage)}
+	}
+	values := make(map[string]json.RawMessage, len(c.Values))
+	for k, v := range c.Values {
+		values[k] = v
+	}
+	for k, v := range changes {
+		if string(v) == "null" {
+			delete(values, k)
+		} else {
+			values[k] = v
+		}
+	}
+	if len(values) > maxSettingsKeys {
+		return fmt.Errorf("too many settings")
+	}
+	c.Values, c.Used = values, time.Now()
+	s.clients[id] = c
+
+	// Forget the least recently used browser.
+	if len(s.clients) > maxSettingsClients {
+		var oldest string
+		for id, c := range s.clients {
+			if oldest == "" || c.Used.Before(s.clients[oldest].Used) {
+				oldest = id
+			}
+		}
+		delete(s.clients, oldest)
+	}
+	s.file.save(s.clients)
+	return nil
+}
+
+// flush retries saving the settings if the last save failed.
+func (s *settingsStore) flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.file.flush(s.clients)
+}
+
+// clientID returns the settings ID of the browser making request r,
+// issuing a new ID cookie if it doesn't have one.
+func clientID(w http.ResponseWriter, r *http.Request) string {
+	if c, err := r.Cookie(settingsCookie); err == nil && len(c.Value) == 32 {
+		if _, err := hex.DecodeString(c.Value); err == nil {
+			return c.Value
+		}
+	}
+	var buf [16]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		panic(err)
+	}
+	id := hex.EncodeToString(buf[:])
+	http.SetCookie(w, &http.Cookie{
+		Name:     settingsCookie,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   5 * 365 * 24 * 60 * 60,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return id
+}
+
+// httpSettings manages the requesting browser's settings. Pages also
+// get the settings with their info.
+//
+//	GET  /settings    serves the settings as a JSON object
+//	POST /settings    merges the JSON object in the body into the
+//	                  settings; null values delete settings
+func httpSettings(w http.ResponseWriter, r *http.Request) {
+	id := clientID(w, r)
+	switch r.Method {
+	case http.MethodGet:
+		serveJSON(w, settings.get(id))
+
+	case http.MethodPost:
+		var changes map[string]json.RawMessage
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSettingsBytes))
+		if err := dec.Decode(&changes); err != nil {
+			http.Error(w, "bad settings: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := settings.update(id, changes); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		serveJSON(w, settings.get(id))
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// shutdownTimeout is how long exiting waits for requests in progress
+// to finish.
+const shutdownTimeout = 5 * time.Second
+
+// listenRetry is how long listen waits for an address that's in use.
+const listenRetry = 5 * time.Second
+
+var cleanups struct {
+	mu  sync.Mutex
+	fns []func()
+}
+
+// atExit registers f to run when objbrowse exits by calling exit,
+// including when it's interrupted or terminated. Functions run in the
+// reverse of the order they were registered.
+func atExit(f func()) {
+	cleanups.mu.Lock()
+	defer cleanups.mu.Unlock()
+	cleanups.fns = append(cleanups.fns, f)
+}
+
+// exit runs the atExit functions and exits with code. If exit is
+// called again while they run, the second call waits for the first
+// to exit.
+func exit(code int) {
+	// Never unlock, so atExit can't add functions that won't run
+	// and later exits wait.
+	cleanups.mu.Lock()
+	for i := len(cleanups.fns) - 1; i >= 0; i-- {
+		cleanups.fns[i]()
+	}
+	os.Exit(code)
+}
+
+// fatalf is like log.Fatalf, but exits with exit so the atExit
+// functions run.
+func fatalf(format string, args ...interface{}) {
+	log.Printf(format, args...)
+	exit(1)
+}
+
+// handleSignals exits cleanly when objbrowse is interrupted or
+// terminated. A second signal exits immediately.
+func handleSignals() {
+	c := make(chan os.Signal, 2)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-c
+		logger.Info("shutting down", "signal", sig)
+		go func() {
+			<-c
+			os.Exit(1)
+		}()
+		exit(1)
+	}()
+}
+
+// shutdownOnExit stops hs from accepting connections when objbrowse
+// exits and waits up to shutdownTimeout for requests in progress. It
+// returns the base context for hs's requests, which is canceled at
+// exit so that event streams and other long-running requests end.
+func shutdownOnExit(hs *http.Server) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	atExit(func() {
+		cancel()
+		sctx, scancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer scancel()
+		if err := hs.Shutdown(sctx); err != nil {
+			logger.Warn("shutting down HTTP server", "err", err)
+		}
+	})
+	return ctx
+}
+
+// exitWhenIdle wraps h to exit objbrowse once it has had no requests
+// in progress for timeout. Requests in progress include the event
+// streams of open pages, so objbrowse doesn't exit while a page is
+// open.
+func exitWhenIdle(h http.Handler, timeout time.Duration) http.Handler {
+	var mu sync.Mutex
+	active := 0        // Requests in progress
+	idle := time.Now() // When active last became 0
+	go func() {
+		tick := timeout / 10
+		if tick < time.Second {
+			tick = time.Second
+		}
+		for range time.Tick(tick) {
+			mu.Lock()
+			exiting := active == 0 && time.Since(idle) >= timeout
+			mu.Unlock()
+			if exiting {
+				logger.Info("exiting after no requests", "timeout", timeout)
+				exit(0)
+			}
+		}
+	}()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		active++
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			if active--; active == 0 {
+				idle = time.Now()
+			}
+			mu.Unlock()
+		}()
+		h.ServeHTTP(w, r)
+	})
+}
+
+// listen listens on TCP address addr. Go sets SO_REUSEADDR on
+// listening sockets on Unix, so connections left over from a server
+// that exited don't hold the address. A server that hasn't finished
+// exiting still does, so if addr is in use, listen retries for up to
+// listenRetry, which lets a restart reuse the previous server's port.
+func listen(addr string) (net.Listener, error) {
+	deadline := time.Now().Add(listenRetry)
+	for logged := false; ; logged = true {
+		ln, err := net.Listen("tcp", addr)
+		if err == nil || !errors.Is(err, syscall.EADDRINUSE) || time.Now().After(deadline) {
+			return ln, err
+		}
+		if !logged {
+			logger.Info("address in use; retrying", "addr", addr)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
@@ -0,0 +1,269 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aclements/objbrowse/obj"
+)
+
+// LargestJS lists the largest symbols by kind and by section.
+type LargestJS struct {
+	ByKind    []SizeGroupJS
+	BySection []SizeGroupJS
+}
+
+// SizeGroupJS is a group of symbols and the largest symbols in it.
+type SizeGroupJS struct {
+	// Name is the kind letter or section name of this group.
+	Name string
+	// Count and Total are the number and total size of symbols
+	// in the group.
+	Count int
+	Total uint64
+	// Syms are the largest symbols in the group, largest first.
+	Syms SymViewSymsJS
+}
+
+// sizedSyms returns the IDs of the symbols that should count toward
+// size totals. This leaves out undefined symbols, synthesized symbols
+// (which subdivide other symbols), and dynamic symbols that
+// duplicate a static symbol.
+func (v *SymView) sizedSyms() []obj.SymID {
+	syms := v.symTab.Syms()
+	var out []obj.SymID
+	for id, sym := range syms {
+		if sym.Kind == obj.SymUndef || sym.Synthetic {
+			continue
+		}
+		if sym.Dynamic {
+			dup := false
+			for _, id := range v.symTab.Name(sym.Name) {
+				if o := &syms[id]; !o.Dynamic && o.Value == sym.Value {
+					dup = true
+					break
+				}
+			}
+			if dup {
+				continue
+			}
+		}
+		out = append(out, obj.SymID(id))
+	}
+	return out
+}
+
+// Largest returns the n largest symbols of each kind and in each
+// section.
+func (v *SymView) Largest(n int) *LargestJS {
+	var syms []obj.Sym
+	for _, id := range v.sizedSyms() {
+		syms = append(syms, v.symTab.Syms()[id])
+	}
+	sort.SliceStable(syms, func(i, j int) bool {
+		return syms[i].Size > syms[j].Size
+	})
+
+	sects := v.fi.Obj.Sections()
+	var byKind, bySection []SizeGroupJS
+	kindIdx := make(map[obj.SymKind]int)
+	sectIdx := make(map[int]int)
+	add := func(groups *[]SizeGroupJS, i int, sym obj.Sym) {
+		g := &(*groups)[i]
+		g.Count++
+		g.Total += sym.Size
+		if len(g.Syms.Syms) < n {
+			g.Syms.Syms = append(g.Syms.Syms, sym)
+		}
+	}
+	for _, sym := range syms {
+		i, ok := kindIdx[sym.Kind]
+		if !ok {
+			i = len(byKind)
+			kindIdx[sym.Kind] = i
+			byKind = append(byKind, SizeGroupJS{Name: string(rune(sym.Kind)), Syms: SymViewSymsJS{fi: v.fi}})
+		}
+		add(&byKind, i, sym)
+
+		if sym.Section < 0 || sym.Section >= len(sects) {
+			continue
+		}
+		i, ok = sectIdx[sym.Section]
+		if !ok {
+			i = len(bySection)
+			sectIdx[sym.Section] = i
+			bySection = append(bySection, SizeGroupJS{Name: sects[sym.Section].Name, Syms: SymViewSymsJS{fi: v.fi}})
+		}
+		add(&bySection, i, sym)
+	}
+
+	// Put the biggest groups first.
+	for _, groups := range [][]SizeGroupJS{byKind, bySection} {
+		sort.SliceStable(groups, func(i, j int) bool {
+			return groups[i].Total > groups[j].Total
+		})
+	}
+	return &LargestJS{byKind, bySection}
+}
+
+// httpLargest serves the largest symbols by kind and section as JSON.
+// The "n" query parameter limits the number of symbols per group.
+func (s *state) httpLargest(w http.ResponseWriter, r *http.Request) {
+	n, err := strconv.Atoi(r.FormValue("n"))
+	if err != nil || n <= 0 {
+		n = 20
+	}
+	serveJSON(w, s.symView.Largest(n))
+}
+
+// SizeNodeJS is a node in the size rollup tree, in a form suitable
+// for drawing a treemap.
+type SizeNodeJS struct {
+	Name string
+	// Value is the total size of the symbols under this node.
+	Value uint64
+	// Sym is the full symbol name of a leaf node, or "" if this
+	// leaf aggregates several small symbols.
+	Sym      string        `json:",omitempty"`
+	Children []*SizeNodeJS `json:",omitempty"`
+}
+
+// sizeGroup is a node of the size tree under construction.
+type sizeGroup struct {
+	node   SizeNodeJS
+	kids   map[string]*sizeGroup
+	syms   []*SizeNodeJS
+	nSmall int
+	small  uint64
+}
+
+func (g *sizeGroup) kid(name string) *sizeGroup {
+	if g.kids == nil {
+		g.kids = make(map[string]*sizeGroup)
+	}
+	k := g.kids[name]
+	if k == nil {
+		k = &sizeGroup{node: SizeNodeJS{Name: name}}
+		g.kids[name] = k
+	}
+	return k
+}
+
+// SizeTree returns the sizes of symbols rolled up by Go package path,
+// with symbols that aren't in a Go package grouped by section.
+// Symbols smaller than min are combined into one leaf per group.
+// Functions are attributed to packages by DWARF if possible, and other
+// symbols by name.
+func (v *SymView) SizeTree(min uint64) *SizeNodeJS {
+	sects := v.fi.Obj.Sections()
+	root := &sizeGroup{node: SizeNodeJS{Name: "all"}}
+	for _, id := range v.sizedSyms() {
+		sym := v.symTab.Syms()[id]
+		if sym.Size == 0 {
+			continue
+		}
+		g, leaf := root, sym.Name
+		pkg := v.origins.Pkg(id)
+		if pkg == "" && sym.Kind != obj.SymText {
+			pkg = goPackage(sym.Name)
+		}
+		if isGoLinkerSym(sym.Name) {
+			g = g.kid("(Go linker)")
+		} else if pkg != "" {
+			for _, elt := range strings.Split(pkg, "/") {
+				g = g.kid(elt)
+			}
+			leaf = strings.TrimPrefix(sym.Name, pkg+".")
+		} else {
+			sect := "(no section)"
+			if sym.Section >= 0 && sym.Section < len(sects) {
+				sect = sects[sym.Section].Name
+			}
+			g = g.kid("(non-Go)").kid(sect)
+		}
+		if sym.Size < min {
+			g.nSmall++
+			g.small += sym.Size
+			continue
+		}
+		g.syms = append(g.syms, &SizeNodeJS{Name: leaf, Value: sym.Size, Sym: sym.Name})
+	}
+	return root.finish()
+}
+
+// finish computes the sizes of g and its descendants, sorts them, and
+// returns the finished node. Chains of groups with a single child are
+// collapsed into one node, so "github.com/user/repo" is one node.
+func (g *sizeGroup) finish() *SizeNodeJS {
+	n := &g.node
+	for _, k := range g.kids {
+		n.Children = append(n.Children, k.finish())
+	}
+	n.Children = append(n.Children, g.syms...)
+	if g.nSmall > 0 {
+		n.Children = append(n.Children, &SizeNodeJS{Name: fmt.Sprintf("(%d smaller)", g.nSmall), Value: g.small})
+	}
+	for _, k := range n.Children {
+		n.Value += k.Value
+	}
+	sort.Slice(n.Children, func(i, j int) bool {
+		return n.Children[i].Value > n.Children[j].Value
+	})
+	if len(n.Children) == 1 && n.Children[0].Sym == "" && len(n.Children[0].Children) > 0 && n.Name != "all" {
+		k := n.Children[0]
+		k.Name = n.Name + "/" + k.Name
+		return k
+	}
+	return n
+}
+
+// isGoLinkerSym reports whether name is a symbol generated by the Go
+// linker, such as type descriptors and function metadata.
+func isGoLinkerSym(name string) bool {
+	for _, prefix := range []string{"type:", "type.", "go:", "go."} {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// httpSizeTree serves the size rollup tree as JSON. The "min" query
+// parameter gives the size below which symbols are combined.
+func (s *state) httpSizeTree(w http.ResponseWriter, r *http.Request) {
+	min, _ := strconv.ParseUint(r.FormValue("min"), 0, 64)
+	serveJSON(w, s.symView.SizeTree(min))
+}
+
+// httpTreemap serves the size treemap page.
+func (s *state) httpTreemap(w http.ResponseWriter, r *http.Request) {
+	if err := tmplTreemap.Execute(w, nil); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+var tmplTreemap = template.Must(template.New("").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>Objbrowse: size treemap</title>
+<link rel="stylesheet" type="text/css" href="/objbrowse.css" />
+</head>
+<body>
+<script src="https://code.jquery.com/jquery-3.3.1.min.js"></script>
+<script src="/objbrowse.js"></script>
+<script src="/palette.js"></script>
+<script src="/sizeview.js"></script>
+<script src="/treemap.js"></script>
+<script>new Treemap(document.body)</script>
+<script>new CommandPalette({})</script>
+</body>
+</html>
+`))
@@ -0,0 +1,105 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+"use strict";
+
+// SizeView lists the largest symbols of each kind and in each
+// section.
+class SizeView {
+    constructor(container) {
+        const self = this;
+        const details = $("<details>").addClass("sizeview").appendTo(container);
+        $("<summary>").text("Largest symbols").appendTo(details);
+        $("<div>").append($("<a>").attr("href", "/treemap").text("Size treemap")).
+            append(" · ").append($("<a>").attr("href", "/instchart").text("Instruction histogram")).
+            appendTo(details);
+        exportLinks("Export sizes as ", {what: "sizes"}).appendTo(details);
+        this._overlays = $("<div>").appendTo(details);
+        const form = $("<form>").addClass("search").appendTo(details);
+        $("<label>").text("top ").append(
+            this._n = $('<input type="number" min="1" value="20" style="width: 5em">')
+        ).appendTo(form);
+        this._list = $("<div>").appendTo(details);
+        form.submit((ev) => {
+            ev.preventDefault();
+            self._load();
+        });
+        this._n.change(() => { self._load(); });
+
+        // Only compute the report when opened.
+        details.one("toggle", () => {
+            self._load();
+            self._loadOverlays();
+        });
+    }
+
+    // _loadOverlays adds export links for each overlay, such as perf
+    // samples.
+    _loadOverlays() {
+        const div = this._overlays;
+        $.getJSON("/overlay").done((list) => {
+            div.empty();
+            for (let o of list)
+                exportLinks("Export overlay " + o.Name + " as ", {what: "overlay", name: o.Name}).appendTo(div);
+        }).fail((xhr) => {
+            showError("Overlays", xhr, div.empty());
+        });
+    }
+
+    _load() {
+        const list = this._list;
+        list.text("Loading…");
+        $.getJSON("/largest", {n: this._n.val()}).done((data) => {
+            list.empty();
+            const kindNames = {T: "text", D: "data", R: "read-only data", B: "bss", A: "absolute", "?": "unknown"};
+            $("<h4>").text("By kind").appendTo(list);
+            for (let g of data.ByKind || [])
+                this._group(list, kindNames[g.Name] || g.Name, g);
+            $("<h4>").text("By section").appendTo(list);
+            for (let g of data.BySection || [])
+                this._group(list, g.Name, g);
+        }).fail((xhr) => {
+            showError("Largest symbols", xhr, list.empty());
+        });
+    }
+
+    // _group adds the table for size group g to list.
+    _group(list, label, g) {
+        const details = $("<details>").appendTo(list);
+        $("<summary>").text(label + ": " + formatSize(g.Total) + " in " + g.Count + " symbols").appendTo(details);
+        const table = $("<table>").appendTo(details);
+        for (let sym of g.Syms) {
+            $("<tr>").
+                append($("<td>").addClass("pos").text(sym[3])).
+                append($("<td>").addClass("pos").text((100 * sym[3] / g.Total).toFixed(1) + "%")).
+                append($("<td>").append($("<a>").attr("href", symURL(sym[0])).text(sym[0]))).
+                appendTo(table);
+        }
+    }
+}
+
+// exportLinks returns a line of links to download the /export data
+// selected by params in each export format.
+function exportLinks(label, params) {
+    const div = $("<div>").text(label);
+    const formats = [["pprof", "pprof"], ["folded", "folded stacks"], ["perfetto", "Perfetto trace"]];
+    formats.forEach(([format, text], i) => {
+        if (i > 0)
+            div.append(" · ");
+        const q = $.param(Object.assign({format: format}, params));
+        $("<a>").attr("href", "/export?" + q).text(text).appendTo(div);
+    });
+    return div;
+}
+
+// formatSize formats a byte count with a binary unit suffix.
+function formatSize(n) {
+    const units = ["bytes", "KiB", "MiB", "GiB"];
+    let i = 0;
+    while (n >= 1024 && i < units.length - 1) {
+        n /= 1024;
+        i++;
+    }
+    return (i == 0 ? n : n.toFixed(1)) + " " + units[i];
+}
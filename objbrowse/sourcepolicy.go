@@ -0,0 +1,134 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// errSourceDenied is returned when the source policy refuses to
+// open a file.
+var errSourceDenied = errors.New("access denied by source policy (see -source-root)")
+
+// A sourcePolicy decides which source files named by the object
+// file's debug info the server may read. Debug info can name any
+// path, so a binary from an untrusted source could otherwise read
+// arbitrary files on the server.
+type sourcePolicy struct {
+	// roots are the directories under which source files may be
+	// read, with symlinks resolved.
+	roots []string
+	// denyAll, if there are no roots, refuses all files instead
+	// of permitting them.
+	denyAll bool
+	// substs rewrite path prefixes in debug info before files are
+	// opened, for sources that have moved since the build.
+	substs []pathSubst
+}
+
+// A pathSubst replaces the path prefix from with to.
+type pathSubst struct {
+	from, to string
+}
+
+// parsePathSubst parses a "from=to" path substitution.
+func parsePathSubst(s string) (pathSubst, error) {
+	i := strings.IndexByte(s, '=')
+	if i <= 0 {
+		return pathSubst{}, fmt.Errorf("path substitution %q must be from=to", s)
+	}
+	return pathSubst{filepath.Clean(s[:i]), filepath.Clean(s[i+1:])}, nil
+}
+
+// rewrite applies the first matching substitution to path.
+func (p *sourcePolicy) rewrite(path string) string {
+	for _, s := range p.substs {
+		if path == s.from {
+			return s.to
+		}
+		if strings.HasPrefix(path, s.from+string(filepath.Separator)) {
+			return s.to + path[len(s.from):]
+		}
+	}
+	return path
+}
+
+// readSourceRoots reads a file of source roots, one per line. Blank
+// lines and lines starting with "#" are ignored.
+func readSourceRoots(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var roots []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		roots = append(roots, line)
+	}
+	return roots, s.Err()
+}
+
+// newSourcePolicy returns a policy permitting files under roots. If
+// roots is empty, the policy permits all files unless denyAll is
+// set.
+func newSourcePolicy(roots []string, denyAll bool) (*sourcePolicy, error) {
+	p := &sourcePolicy{denyAll: denyAll}
+	for _, root := range roots {
+		abs, err := filepath.Abs(root)
+		if err != nil {
+			return nil, err
+		}
+		abs, err = filepath.EvalSymlinks(abs)
+		if err != nil {
+			return nil, fmt.Errorf("source root: %v", err)
+		}
+		p.roots = append(p.roots, abs)
+	}
+	return p, nil
+}
+
+// allowed reports whether path may be read. Symlinks are resolved so
+// a link inside a root can't escape it.
+func (p *sourcePolicy) allowed(path string) bool {
+	if len(p.roots) == 0 {
+		return !p.denyAll
+	}
+	if !filepath.IsAbs(path) {
+		return false
+	}
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		// Let open report the error, as long as the path
+		// is lexically within a root.
+		real = filepath.Clean(path)
+	}
+	for _, root := range p.roots {
+		if real == root || strings.HasPrefix(real, root+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// open opens the source file at path, after substitutions, if the
+// policy permits it and logs denied accesses.
+func (p *sourcePolicy) open(path string) (*os.File, error) {
+	path = p.rewrite(path)
+	if !p.allowed(path) {
+		logger.Warn("denied access to source file", "path", path)
+		return nil, errSourceDenied
+	}
+	return os.Open(path)
+}
@@ -11,75 +11,31 @@ import (
 	"io"
 	"os"
 	"sort"
+	"unicode/utf16"
 
-	"github.com/aclements/objbrowse/internal/obj"
+	"github.com/aclements/objbrowse/internal/functab"
+	"github.com/aclements/objbrowse/internal/highlight"
+	"github.com/aclements/objbrowse/obj"
 )
 
+// SourceView shows the source lines of a function, attributed to PCs.
+// It uses the DWARF line table if there is one, and otherwise falls
+// back to the Go function table's pcfile and pcln tables, which
+// survive stripping.
 type SourceView struct {
-	dw     *dwarf.Data
-	ranges []CURange
+	fi     *FileInfo
+	policy *sourcePolicy
 }
 
-type CURange struct {
-	Low, High uint64
-	CU        *dwarf.Entry
-}
-
-func NewSourceView(fi *FileInfo) (*SourceView, error) {
-	// Load the DWARF.
-	dw, err := fi.Obj.DWARF()
-	if err != nil {
-		return nil, err
-	}
-
-	// Create an address index for the CUs.
-	var ranges []CURange
-	dr := dw.Reader()
-	for {
-		ent, err := dr.Next()
-		if ent == nil || err != nil {
-			break
-		}
-
-		if ent.Tag != dwarf.TagCompileUnit {
-			dr.SkipChildren()
-			continue
-		}
-
-		rs, err := dw.Ranges(ent)
-		if err != nil {
-			continue
-		}
-
-		for _, r := range rs {
-			ranges = append(ranges, CURange{r[0], r[1], ent})
-		}
-	}
-
-	// Sort address index.
-	sort.Slice(ranges, func(i, j int) bool {
-		return ranges[i].Low < ranges[j].Low
-	})
-
-	return &SourceView{dw, ranges}, nil
-}
-
-func (v *SourceView) addrToCU(addr uint64) *dwarf.Entry {
-	i := sort.Search(len(v.ranges), func(i int) bool {
-		return addr < v.ranges[i].Low
-	}) - 1
-	if i < 0 {
-		return nil
-	}
-	cu := v.ranges[i]
-	if cu.Low <= addr && addr < cu.High {
-		return cu.CU
-	}
-	return nil
+func NewSourceView(fi *FileInfo, policy *sourcePolicy) *SourceView {
+	return &SourceView{fi, policy}
 }
 
 type SourceViewJS struct {
 	Blocks []SourceViewBlock
+	// Positions is where the PC to line mapping comes from:
+	// "dwarf" or "pclntab".
+	Positions string
 }
 
 type SourceViewBlock struct {
@@ -88,6 +44,42 @@ type SourceViewBlock struct {
 	Text  []string // Excludes trailing \n
 	PCs   [][][2]AddrJS
 	Error string `json:",omitempty"`
+
+	// Tokens gives the syntax highlighting spans of each line in
+	// Text, or is nil if the language isn't known.
+	Tokens [][]SourceViewToken `json:",omitempty"`
+}
+
+// SourceViewToken is a highlighted span of a source line. Offsets are
+// in UTF-16 code units to match JavaScript string indexing.
+type SourceViewToken struct {
+	Start int    `json:"S"`
+	End   int    `json:"E"`
+	Class string `json:"C"`
+}
+
+// highlightLine tokenizes line using lex and returns its spans.
+func highlightLine(lex *highlight.Lexer, line string) []SourceViewToken {
+	spans := lex.Line(line)
+	if len(spans) == 0 {
+		return nil
+	}
+	// Convert byte offsets to UTF-16 offsets.
+	toks := make([]SourceViewToken, len(spans))
+	pos, pos16 := 0, 0
+	advance := func(to int) int {
+		for _, r := range line[pos:to] {
+			pos16 += utf16.RuneLen(r)
+		}
+		pos = to
+		return pos16
+	}
+	for i, span := range spans {
+		toks[i].Start = advance(span.Start)
+		toks[i].End = advance(span.End)
+		toks[i].Class = span.Class.String()
+	}
+	return toks
 }
 
 func (v *SourceView) DecodeSym(fi *FileInfo, sym obj.Sym) (interface{}, error) {
@@ -104,28 +96,24 @@ func (v *SourceView) DecodeSym(fi *FileInfo, sym obj.Sym) (interface{}, error) {
 		return nil, nil
 	}
 
-	// Find sym.
-	cu := v.addrToCU(sym.Value)
-	if cu == nil {
-		return nil, fmt.Errorf("no DWARF data for symbol %s", sym.Name)
+	// Get the line rows for sym.
+	var rows []sourceRow
+	var err error
+	positions := "dwarf"
+	if v.fi.hasCU(sym.Value) {
+		rows, err = v.dwarfRows(sym)
+	} else {
+		rows, err = v.goRows(sym)
+		positions = "pclntab"
 	}
-
-	// Get line table.
-	lr, err := v.dw.LineReader(cu)
 	if err != nil {
 		return nil, err
 	}
-
-	// Decode the line table for this PC range.
-	var line, nextLine dwarf.LineEntry
-	if err = lr.SeekPC(sym.Value, &line); err == dwarf.ErrUnknownPC {
+	if len(rows) == 0 {
 		return nil, fmt.Errorf("no line table for symbol %s", sym.Name)
-	} else if err != nil {
-		return nil, err
 	}
 
 	// Collect line ranges and PCs.
-	end := sym.Value + sym.Size
 	type rang struct {
 		file     string
 		from, to int // [from, to)
@@ -136,26 +124,21 @@ func (v *SourceView) DecodeSym(fi *FileInfo, sym obj.Sym) (interface{}, error) {
 		line int
 	}
 	pcMap := map[pcKey][][2]uint64{}
-	for line.Address < end {
-		ranges = append(ranges, rang{line.File.Name, line.Line - contextLines, line.Line + contextLines + 1})
-
-		if err = lr.Next(&nextLine); err == io.EOF {
-			break
-		} else if err != nil {
-			return nil, err
+	for _, row := range rows {
+		ranges = append(ranges, rang{row.file, row.line - contextLines, row.line + contextLines + 1})
+		if row.low == row.high {
+			continue
 		}
 
-		pck := pcKey{line.File.Name, line.Line}
+		pck := pcKey{row.file, row.line}
 		pcRanges := pcMap[pck]
-		if len(pcRanges) > 0 && pcRanges[len(pcRanges)-1][1] == line.Address {
+		if len(pcRanges) > 0 && pcRanges[len(pcRanges)-1][1] == row.low {
 			// Extend existing range.
-			pcRanges[len(pcRanges)-1][1] = nextLine.Address
+			pcRanges[len(pcRanges)-1][1] = row.high
 		} else {
 			// Add a new PC range.
-			pcMap[pck] = append(pcRanges, [2]uint64{line.Address, nextLine.Address})
+			pcMap[pck] = append(pcRanges, [2]uint64{row.low, row.high})
 		}
-
-		line = nextLine
 	}
 
 	// Sort and merge lines ranges.
@@ -200,35 +183,57 @@ func (v *SourceView) DecodeSym(fi *FileInfo, sym obj.Sym) (interface{}, error) {
 	// TODO: Check mtimes and warn if file differs.
 	var blocks []SourceViewBlock
 	var f *os.File
-	var s *bufio.Scanner
+	var idx *sourceIndex
 	var fName string
-	var lineNo int
 	for _, r := range ranges {
-		if f == nil || r.file != fName {
+		if r.file != fName {
 			f.Close()
 
 			fName = r.file
-			f, err = os.Open(fName)
+			f, err = v.policy.open(fName)
+			if err == nil {
+				idx, err = v.index(f, fName)
+			}
 			if err != nil {
-				if r.file != fName {
-					blocks = append(blocks, SourceViewBlock{Path: r.file, Error: err.Error()})
-				}
-				f, s = nil, nil
+				blocks = append(blocks, SourceViewBlock{Path: r.file, Error: err.Error()})
+				f.Close()
+				f = nil
 				continue
 			}
-			s, lineNo = bufio.NewScanner(f), 1
+		} else if f == nil {
+			// We already failed to open this file.
+			continue
 		}
 
-		// Skip to the block.
-		for ; lineNo < r.from && s.Scan(); lineNo++ {
+		// Seek to the block, and restore the lexer state at
+		// its first line.
+		start := r.from
+		if start < 1 {
+			start = 1
+		}
+		if start > len(idx.offs) {
+			continue
+		}
+		if _, err := f.Seek(idx.offs[start-1], io.SeekStart); err != nil {
+			blocks = append(blocks, SourceViewBlock{Path: r.file, Error: err.Error()})
+			continue
+		}
+		s := bufio.NewScanner(f)
+		var lex *highlight.Lexer
+		if idx.lex != nil {
+			l := idx.lex[start-1]
+			lex = &l
 		}
 
 		// Read the block.
 		var text []string
 		var lineRanges [][][2]AddrJS
-		start := lineNo
-		for ; lineNo < r.to && s.Scan(); lineNo++ {
+		var tokens [][]SourceViewToken
+		for lineNo := start; lineNo < r.to && s.Scan(); lineNo++ {
 			text = append(text, s.Text())
+			if lex != nil {
+				tokens = append(tokens, highlightLine(lex, s.Text()))
+			}
 
 			var pcRanges [][2]AddrJS
 			for _, pcr := range pcMap[pcKey{fName, lineNo}] {
@@ -240,10 +245,167 @@ func (v *SourceView) DecodeSym(fi *FileInfo, sym obj.Sym) (interface{}, error) {
 		if err := s.Err(); err != nil {
 			blocks = append(blocks, SourceViewBlock{Path: r.file, Error: err.Error()})
 		} else if len(text) > 0 {
-			blocks = append(blocks, SourceViewBlock{Path: r.file, Start: start, Text: text, PCs: lineRanges})
+			blocks = append(blocks, SourceViewBlock{Path: r.file, Start: start, Text: text, PCs: lineRanges, Tokens: tokens})
 		}
 	}
 	f.Close()
 
-	return SourceViewJS{Blocks: blocks}, nil
+	return SourceViewJS{Blocks: blocks, Positions: positions}, nil
+}
+
+// A sourceIndex records where each line of a source file starts and
+// the lexer state at the start of each line, so DecodeSym can read a
+// block of lines without scanning the lines before it.
+type sourceIndex struct {
+	// offs[i] is the file offset of line i+1.
+	offs []int64
+	// lex[i] is the lexer state before line i+1, or lex is nil
+	// if the language isn't known.
+	lex []highlight.Lexer
+}
+
+// A sourceKey identifies a version of a source file in the
+// source lines cache.
+type sourceKey struct {
+	path    string
+	size    int64
+	modTime int64
+}
+
+// index returns the sourceIndex of f, which was opened from path,
+// building it if it isn't cached.
+func (v *SourceView) index(f *os.File, path string) (*sourceIndex, error) {
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	key := sourceKey{path, st.Size(), st.ModTime().UnixNano()}
+	caches := v.fi.caches
+	if caches != nil {
+		if idx, ok := caches.srcLines.Get(key); ok {
+			return idx.(*sourceIndex), nil
+		}
+	}
+
+	idx := new(sourceIndex)
+	lex := highlight.NewLexer(path)
+	s := bufio.NewScanner(f)
+	// Track the offset of the line each Scan returns.
+	var pos, lineStart int64
+	s.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := bufio.ScanLines(data, atEOF)
+		if token != nil {
+			lineStart = pos
+		}
+		pos += int64(advance)
+		return advance, token, err
+	})
+	for s.Scan() {
+		idx.offs = append(idx.offs, lineStart)
+		if lex != nil {
+			idx.lex = append(idx.lex, *lex)
+			lex.Line(s.Text())
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if caches != nil {
+		caches.srcLines.Add(key, idx, int64(len(idx.offs))*8+int64(len(idx.lex))*16)
+	}
+	return idx, nil
+}
+
+// A sourceRow attributes the PCs [low, high) to a source line. If low
+// == high, the row contributes only context lines.
+type sourceRow struct {
+	file      string
+	line      int
+	low, high uint64
+}
+
+// dwarfRows returns the DWARF line table rows covering sym.
+func (v *SourceView) dwarfRows(sym obj.Sym) ([]sourceRow, error) {
+	dw, err := v.fi.DWARF()
+	if err != nil {
+		return nil, err
+	}
+	cu := v.fi.AddrToCU(sym.Value)
+	if cu == nil {
+		return nil, fmt.Errorf("no DWARF data for symbol %s", sym.Name)
+	}
+
+	// Get line table.
+	lr, err := dw.LineReader(cu)
+	if err != nil {
+		return nil, err
+	}
+	if lr == nil {
+		return nil, fmt.Errorf("no line table for symbol %s", sym.Name)
+	}
+
+	// Decode the line table for this PC range.
+	var line, nextLine dwarf.LineEntry
+	if err = lr.SeekPC(sym.Value, &line); err == dwarf.ErrUnknownPC {
+		return nil, fmt.Errorf("no line table for symbol %s", sym.Name)
+	} else if err != nil {
+		return nil, err
+	}
+
+	end := sym.Value + sym.Size
+	var rows []sourceRow
+	for line.Address < end {
+		if err = lr.Next(&nextLine); err == io.EOF {
+			rows = append(rows, sourceRow{line.File.Name, line.Line, line.Address, line.Address})
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		rows = append(rows, sourceRow{line.File.Name, line.Line, line.Address, nextLine.Address})
+		line = nextLine
+	}
+	return rows, nil
+}
+
+// goRows returns rows covering sym from the Go function table's
+// pcfile and pcln tables.
+func (v *SourceView) goRows(sym obj.Sym) ([]sourceRow, error) {
+	fn := v.fi.Func(sym.Value)
+	if fn == nil {
+		return nil, fmt.Errorf("no DWARF or Go function table entry for symbol %s", sym.Name)
+	}
+	files, lines := fn.PCFile.Decode(), fn.PCLn.Decode()
+
+	// Walk the PCs where either table changes.
+	end := sym.Value + sym.Size
+	var rows []sourceRow
+	for pc := sym.Value; pc < end; {
+		next := end
+		for _, t := range []functab.PCTable{files, lines} {
+			if n := nextPC(t, pc); n < next {
+				next = n
+			}
+		}
+		file, ok1 := files.Lookup(pc)
+		line, ok2 := lines.Lookup(pc)
+		if ok1 && ok2 {
+			if name := fn.FileName(file); name != "" {
+				rows = append(rows, sourceRow{name, int(line), pc, next})
+			}
+		}
+		pc = next
+	}
+	return rows, nil
+}
+
+// nextPC returns the first PC after pc at which t's value may change,
+// or ^0 if there is none.
+func nextPC(t functab.PCTable, pc uint64) uint64 {
+	i := sort.Search(len(t.PCs), func(i int) bool {
+		return t.PCs[i] > pc
+	})
+	if i < len(t.PCs) {
+		return t.PCs[i]
+	}
+	return ^uint64(0)
 }
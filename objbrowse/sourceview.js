@@ -8,6 +8,8 @@ class SourceView {
     constructor(data, container) {
         this._container = container;
         const view = this;
+        if (data.Positions == "pclntab")
+            $("<div>").addClass("sv-note").text("no DWARF: lines from the Go function table").appendTo(container);
         const table = $("<table>").css({borderCollapse: "collapse"}).appendTo(container);
         this._table = table;
 
@@ -29,11 +31,12 @@ class SourceView {
             }
 
             let lineNo = block.Start;
-            for (let i = 0; i < block.Text.length; i++) {
+            for (let i = 0; i < (block.Text || []).length; i++) {
+                const tokens = block.Tokens ? block.Tokens[i] : null;
                 const tr = $('<tr>').append(
                     $('<td>').addClass('pos').text(lineNo)
                 ).append(
-                    $('<td>').addClass('sv-src').text(block.Text[i])
+                    $('<td>').addClass('sv-src').append(SourceView._formatLine(block.Text[i], tokens))
                 );
                 table.append(tr);
                 let pcs = block.PCs[i];
@@ -56,6 +59,42 @@ class SourceView {
         this._pcRanges = new IntervalMap(pcRanges);
     }
 
+    // _formatLine returns DOM nodes for line, with syntax highlighting
+    // from tokens, which may be null.
+    static _formatLine(line, tokens) {
+        if (!tokens)
+            return document.createTextNode(line);
+        const elts = [];
+        let pos = 0;
+        for (let tok of tokens) {
+            if (pos < tok.S)
+                elts.push(document.createTextNode(line.substring(pos, tok.S)));
+            const span = document.createElement("span");
+            span.setAttribute("class", "sv-tok-" + tok.C);
+            span.textContent = line.substring(tok.S, tok.E);
+            elts.push(span);
+            pos = tok.E;
+        }
+        if (pos < line.length)
+            elts.push(document.createTextNode(line.substring(pos)));
+        return elts;
+    }
+
+    // markRanges adds CSS class cls to the lines that overlap ranges
+    // and appends title to their tooltips. If color is given, it also
+    // sets the lines' background color.
+    markRanges(ranges, cls, title, color) {
+        ranges = ranges.slice().sort((a, b) => a.start.compare(b.start));
+        for (let match of this._pcRanges.intersect(ranges)) {
+            const old = match.tr.attr("title") || "";
+            match.tr.addClass(cls);
+            if (color)
+                match.tr.css("background-color", color);
+            if (!old.split("\n").includes(title))
+                match.tr.attr("title", old ? old + "\n" + title : title);
+        }
+    }
+
     highlightRanges(ranges, scroll) {
         // Clear highlights.
         $(".highlight", this._table).removeClass("highlight");
@@ -69,4 +108,14 @@ class SourceView {
             first = false;
         }
     }
+
+    // markPeers marks the lines selected by the other members of the
+    // shared session, like AsmView.markPeers.
+    markPeers(peers) {
+        $(".peer-sel", this._table).removeClass("peer-sel").css("box-shadow", "");
+        for (let p of peers) {
+            for (let match of this._pcRanges.intersect(p.ranges))
+                match.tr.addClass("peer-sel").css("box-shadow", "inset 4px 0 " + p.color);
+        }
+    }
 }
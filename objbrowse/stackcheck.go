@@ -0,0 +1,313 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aclements/objbrowse/arch"
+	"github.com/aclements/objbrowse/internal/asm"
+	"github.com/aclements/objbrowse/obj"
+)
+
+// StackAnalysis finds the stack growth checks in Go function
+// prologues and computes the stack depth of chains of nosplit
+// functions, much like the linker's nosplit overflow check.
+type StackAnalysis struct {
+	fi *FileInfo
+
+	once  sync.Once
+	funcs map[obj.SymID]*stackFunc
+}
+
+// StackFuncJS describes the stack frame of one function.
+type StackFuncJS struct {
+	// Frame is the size of the function's frame in bytes, not
+	// including the return address, or -1 if it is unknown.
+	Frame int64
+	// NoSplit indicates the function has no stack growth check.
+	// It's false for functions that aren't Go functions.
+	NoSplit bool
+	// Unchecked indicates the function isn't a Go function, so
+	// it has no stack growth check to look for and isn't part of
+	// nosplit chains.
+	Unchecked bool `json:",omitempty"`
+	// CheckPC is the PC of the stack bound comparison, if found.
+	CheckPC AddrJS `json:",omitempty"`
+	// MorestackPC is the PC of the call to runtime.morestack.
+	MorestackPC AddrJS `json:",omitempty"`
+}
+
+type stackFunc struct {
+	StackFuncJS
+	callees []obj.SymID
+
+	// depth is the maximum stack depth of nosplit chains
+	// starting at this function, or -1 if not yet computed.
+	depth    int64
+	next     obj.SymID // Callee on the deepest chain, or -1
+	visiting bool
+}
+
+func NewStackAnalysis(fi *FileInfo) *StackAnalysis {
+	return &StackAnalysis{fi: fi}
+}
+
+// analyzeFunc finds the stack check and frame size of the function
+// sym, whose instructions are insts. It also returns the direct
+// callees of sym.
+func (a *StackAnalysis) analyzeFunc(sym obj.Sym, insts asm.Seq) (StackFuncJS, []obj.SymID) {
+	symTab := a.fi.SymTab
+	info := StackFuncJS{Frame: -1, NoSplit: true}
+
+	var callees []obj.SymID
+	var condJumps []int
+	sawAdjust := false
+	for i := 0; i < insts.Len(); i++ {
+		inst := insts.Get(i)
+		c := inst.Control()
+		switch c.Type {
+		case asm.ControlJump:
+			if c.Conditional {
+				condJumps = append(condJumps, i)
+				break
+			}
+			// Unconditional jumps out of the function
+			// are tail calls.
+			if c.TargetPC >= sym.Value && c.TargetPC < sym.Value+sym.Size {
+				break
+			}
+			fallthrough
+		case asm.ControlCall, asm.ControlExit:
+			if c.TargetPC == 0 {
+				break
+			}
+			id, ok := symTab.Addr(c.TargetPC)
+			if !ok || symTab.Syms()[id].Value != c.TargetPC {
+				break
+			}
+			if strings.HasPrefix(symTab.Syms()[id].Name, "runtime.morestack") {
+				if info.NoSplit {
+					info.NoSplit = false
+					info.MorestackPC = AddrJS(inst.PC())
+				}
+				break
+			}
+			callees = append(callees, id)
+		}
+
+		// Find the frame size from the prologue, which makes
+		// the first adjustment to SP.
+		if !sawAdjust {
+			info.Frame, sawAdjust = parseFrameAdjust(inst.GoSyntax(nil))
+		}
+	}
+
+	// Find the stack bound check. This is the comparison just
+	// before a conditional jump to the morestack call.
+	if !info.NoSplit {
+		for _, i := range condJumps {
+			target := insts.Get(i).Control().TargetPC
+			if target <= uint64(info.MorestackPC) && uint64(info.MorestackPC)-target <= 64 && i > 0 {
+				info.CheckPC = AddrJS(insts.Get(i - 1).PC())
+				break
+			}
+		}
+	}
+
+	// Prefer the frame size from the runtime's SP table.
+	if fn := a.fi.Func(sym.Value); fn != nil {
+		frame := int64(0)
+		for _, v := range fn.PCSP.Decode().Values {
+			if int64(v) > frame {
+				frame = int64(v)
+			}
+		}
+		info.Frame = frame
+	} else {
+		info.NoSplit, info.Unchecked = false, true
+	}
+
+	return info, callees
+}
+
+// parseFrameAdjust parses a Go syntax instruction that adds a
+// constant to SP. If it allocates a stack frame, such as
+// "SUBQ $0x28, SP", it returns the frame size. Otherwise, such as for
+// an epilogue's ADDQ, the frame size is -1. ok reports whether inst
+// adjusts SP at all.
+func parseFrameAdjust(inst string) (frame int64, ok bool) {
+	op, args := parseAsm(inst)
+	if len(args) != 2 || args[1] != "SP" || !strings.HasPrefix(args[0], "$") {
+		return -1, false
+	}
+	val, err := strconv.ParseInt(args[0][1:], 0, 64)
+	if err != nil {
+		return -1, false
+	}
+	switch op {
+	case "SUBQ", "SUBL":
+		if val > 0 {
+			return val, true
+		}
+		return -1, true
+	case "ADDQ", "ADDL":
+		return -1, true
+	}
+	return -1, false
+}
+
+// prepare analyzes all functions and computes the depths of their
+// nosplit chains if they haven't been already, reporting progress to
+// progress, which may be nil. After prepare, a.funcs is read-only.
+func (a *StackAnalysis) prepare(progress progressFunc) {
+	a.once.Do(func() { a.analyzeAll(progress) })
+}
+
+func (a *StackAnalysis) analyzeAll(progress progressFunc) {
+	a.funcs = make(map[obj.SymID]*stackFunc)
+	a.fi.ForEachText(progress, func(id obj.SymID, sym obj.Sym, insts asm.Seq) {
+		info, callees := a.analyzeFunc(sym, insts)
+		a.funcs[id] = &stackFunc{info, callees, -1, -1, false}
+	})
+	for id := range a.funcs {
+		a.depth(id)
+	}
+}
+
+// depth returns the maximum stack depth of nosplit call chains
+// starting at function id, including id's own frame and return
+// address. It must only be called by analyzeAll.
+func (a *StackAnalysis) depth(id obj.SymID) int64 {
+	f := a.funcs[id]
+	if f == nil {
+		return 0
+	}
+	if f.depth >= 0 {
+		return f.depth
+	}
+	if f.visiting {
+		// Recursive nosplit chain. The linker would reject
+		// this, so don't try to be precise.
+		return 0
+	}
+	f.visiting = true
+	frame := f.Frame
+	if frame < 0 {
+		frame = 0
+	}
+	var max int64
+	for _, callee := range f.callees {
+		if g := a.funcs[callee]; g == nil || !g.NoSplit {
+			continue
+		}
+		if d := a.depth(callee); d > max {
+			max, f.next = d, callee
+		}
+	}
+	f.visiting = false
+	f.depth = retAddrSize(a.fi.Obj.Info().Arch) + frame + max
+	return f.depth
+}
+
+// retAddrSize returns the stack space a call uses for the return
+// address outside the callee's frame. Only x86 pushes it; on
+// link-register architectures, the frame has a slot for it.
+func retAddrSize(a *arch.Arch) int64 {
+	if a == nil || a.MinFrameSize != 0 {
+		return 0
+	}
+	return int64(a.PtrSize)
+}
+
+// stackLimit returns the stack space the Go runtime guarantees to
+// nosplit chains below a stack check, _StackLimit, or 0 if it's
+// unknown for a. _StackLimit is _StackGuard - _StackSystem -
+// _StackSmall, and _StackGuard includes _StackSystem, so this is the
+// same on every OS. Race builds multiply the guard by 2. This is the
+// value in recent releases; older releases had a smaller guard.
+func stackLimit(a *arch.Arch, race bool) int64 {
+	if a == nil {
+		return 0
+	}
+	mult := int64(1)
+	if race {
+		mult = 2
+	}
+	return 928*mult - 128
+}
+
+type NosplitReportJS struct {
+	// Limit is the approximate stack space available to nosplit
+	// chains below a stack check (_StackLimit), or 0 if it's
+	// unknown.
+	Limit  int64
+	Chains []NosplitChainJS
+}
+
+type NosplitChainJS struct {
+	Depth int64
+	Funcs []NosplitFrameJS
+}
+
+type NosplitFrameJS struct {
+	Name    string
+	Frame   int64
+	NoSplit bool
+}
+
+// NosplitReport returns the n deepest nosplit chains in the binary.
+// Each chain starts at a function that has a stack check (or at a
+// nosplit function that isn't called by any other analyzed function)
+// and continues through nosplit callees.
+func (a *StackAnalysis) NosplitReport(n int) *NosplitReportJS {
+	a.prepare(nil)
+
+	// Chains start at calls from a splittable function to a
+	// nosplit function, which is limited by _StackLimit.
+	roots := make(map[obj.SymID]bool)
+	for _, f := range a.funcs {
+		if f.NoSplit || f.Unchecked {
+			continue
+		}
+		for _, callee := range f.callees {
+			if g := a.funcs[callee]; g != nil && g.NoSplit {
+				roots[callee] = true
+			}
+		}
+	}
+	var ids []obj.SymID
+	for id := range roots {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		di, dj := a.funcs[ids[i]].depth, a.funcs[ids[j]].depth
+		if di != dj {
+			return di > dj
+		}
+		return ids[i] < ids[j]
+	})
+	if len(ids) > n {
+		ids = ids[:n]
+	}
+
+	info := a.fi.Obj.Info()
+	limit := stackLimit(info.Arch, a.fi.Fingerprint().Race)
+	report := &NosplitReportJS{Limit: limit, Chains: []NosplitChainJS{}}
+	syms := a.fi.SymTab.Syms()
+	for _, id := range ids {
+		chain := NosplitChainJS{Depth: a.funcs[id].depth}
+		for seen := 0; id >= 0 && seen < 100; seen++ {
+			f := a.funcs[id]
+			chain.Funcs = append(chain.Funcs, NosplitFrameJS{syms[id].Name, f.Frame, f.NoSplit})
+			id = f.next
+		}
+		report.Chains = append(report.Chains, chain)
+	}
+	return report
+}
@@ -0,0 +1,286 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aclements/objbrowse/obj"
+)
+
+// SymDetailJS describes everything known about a single symbol.
+type SymDetailJS struct {
+	ID         obj.SymID
+	Name       string
+	Kind       string
+	Value      AddrJS
+	Size       uint64
+	Binding    string // "local", "global", or "weak"
+	Visibility string
+	Version    string `json:",omitempty"`
+	// VersionHidden indicates Version isn't the default version
+	// of the symbol.
+	VersionHidden bool `json:",omitempty"`
+	// Library is the library expected to define an undefined
+	// versioned symbol.
+	Library string `json:",omitempty"`
+	Table   string // "static", "dynamic", or "synthetic"
+
+	// Info and Other are the raw ELF st_info and st_other
+	// fields.
+	Info, Other uint8
+
+	// Section is the name of the section containing the symbol,
+	// or "" if none.
+	Section string `json:",omitempty"`
+	// Align is the alignment of the symbol's address, bounded by
+	// its section's alignment, or 0 if unknown.
+	Align uint64 `json:",omitempty"`
+
+	// BothTables indicates the symbol appears in both the static
+	// and dynamic symbol tables.
+	BothTables bool `json:",omitempty"`
+
+	// DIE is the offset of the symbol's DWARF debugging
+	// information entry, or nil if there is none.
+	DIE *dwarf.Offset `json:",omitempty"`
+	// CU is the name of the DWARF compile unit containing the
+	// symbol, or "" if unknown.
+	CU string `json:",omitempty"`
+
+	// Aliases are the other symbols at the same address.
+	Aliases []SymAliasJS `json:",omitempty"`
+	// SameName are the other symbols with the same name, other
+	// than this symbol's entry in the other symbol table.
+	SameName []SymAliasJS `json:",omitempty"`
+
+	// Views lists which symbol views are available.
+	Views []ViewCapJS
+}
+
+type SymAliasJS struct {
+	ID   obj.SymID
+	Name string
+}
+
+// symDIE locates the DWARF entry describing a symbol.
+type symDIE struct {
+	off dwarf.Offset
+	cu  string
+}
+
+// symDetail returns the detailed attributes of symbol id.
+func (s *state) symDetail(id obj.SymID) *SymDetailJS {
+	syms := s.symTab.Syms()
+	sym := syms[id]
+	d := &SymDetailJS{
+		ID:            id,
+		Name:          sym.Name,
+		Kind:          string(rune(sym.Kind)),
+		Value:         AddrJS(sym.Value),
+		Size:          sym.Size,
+		Binding:       "global",
+		Visibility:    sym.Visibility.String(),
+		Version:       sym.Version,
+		VersionHidden: sym.VersionHidden,
+		Library:       sym.Library,
+		Table:         "static",
+		Info:          sym.Info,
+		Other:         sym.Other,
+	}
+	if sym.Local {
+		d.Binding = "local"
+	} else if sym.Weak {
+		d.Binding = "weak"
+	}
+	if sym.Dynamic {
+		d.Table = "dynamic"
+	} else if sym.Synthetic {
+		d.Table = "synthetic"
+	}
+
+	d.Views = s.fi.SymCapsDetail(sym)
+
+	sects := s.bin.Sections()
+	if 0 <= sym.Section && sym.Section < len(sects) {
+		sect := sects[sym.Section]
+		d.Section = sect.Name
+		if sym.HasAddr && sect.Align != 0 {
+			// The largest power of two dividing the address,
+			// up to the section alignment.
+			d.Align = sect.Align
+			for d.Align > 1 && sym.Value%d.Align != 0 {
+				d.Align /= 2
+			}
+		}
+	}
+
+	for _, other := range s.symTab.Name(sym.Name) {
+		o := &syms[other]
+		switch {
+		case other == id:
+		case o.Value == sym.Value && o.Dynamic != sym.Dynamic:
+			d.BothTables = true
+		default:
+			d.SameName = append(d.SameName, SymAliasJS{other, o.Name})
+		}
+	}
+
+	if sym.HasAddr {
+		for _, alias := range s.symTab.AtAddr(sym.Value) {
+			if alias == id || syms[alias].Name == sym.Name {
+				continue
+			}
+			d.Aliases = append(d.Aliases, SymAliasJS{alias, syms[alias].Name})
+		}
+
+		if die, ok := s.fi.SymDIE(sym.Name, sym.Value); ok {
+			d.DIE = &die.off
+			d.CU = die.cu
+		} else if cu := s.fi.AddrToCU(sym.Value); cu != nil {
+			d.CU, _ = cu.Val(dwarf.AttrName).(string)
+		}
+	}
+	return d
+}
+
+// SymDIE returns the DWARF subprogram or variable entry for the
+// symbol name that starts at addr.
+func (fi *FileInfo) SymDIE(name string, addr uint64) (symDIE, bool) {
+	// Try the name index first, since it avoids walking all of
+	// the DWARF.
+	if x := fi.DWIndex(); x != nil {
+		dw, _ := fi.DWARF()
+		for _, e := range x.Lookup(name) {
+			if e.DIE == 0 {
+				continue
+			}
+			ent := entryAt(dw, e.DIE)
+			if ent == nil {
+				continue
+			}
+			if a, ok := fi.dieAddrOf(ent); ok && a == addr {
+				var cu string
+				if cuEnt := entryAt(dw, e.CU); cuEnt != nil {
+					cu, _ = cuEnt.Val(dwarf.AttrName).(string)
+				}
+				return symDIE{e.DIE, cu}, true
+			}
+		}
+	}
+
+	fi.dieOnce.Do(fi.indexDIEs)
+	die, ok := fi.dieAddr[addr]
+	return die, ok
+}
+
+// dieAddrOf returns the starting address of a subprogram or global
+// variable DIE.
+func (fi *FileInfo) dieAddrOf(ent *dwarf.Entry) (uint64, bool) {
+	switch ent.Tag {
+	case dwarf.TagSubprogram:
+		lowpc, ok := ent.Val(dwarf.AttrLowpc).(uint64)
+		return lowpc, ok
+
+	case dwarf.TagVariable:
+		// Only global variables with a static address (a
+		// single DW_OP_addr) correspond to symbols.
+		const opAddr = 0x03
+		arch := fi.Obj.Info().Arch
+		loc, ok := ent.Val(dwarf.AttrLocation).([]byte)
+		if !ok || arch == nil || len(loc) != 1+arch.PtrSize || loc[0] != opAddr {
+			return 0, false
+		}
+		if arch.PtrSize == 8 {
+			return arch.ByteOrder.Uint64(loc[1:]), true
+		}
+		return uint64(arch.ByteOrder.Uint32(loc[1:])), true
+	}
+	return 0, false
+}
+
+// indexDIEs creates an address index of subprogram and global
+// variable DIEs.
+func (fi *FileInfo) indexDIEs() {
+	fi.dieAddr = make(map[uint64]symDIE)
+	dw, err := fi.DWARF()
+	if err != nil {
+		return
+	}
+
+	var cu string
+	dr := dw.Reader()
+	for {
+		ent, err := dr.Next()
+		if ent == nil || err != nil {
+			break
+		}
+
+		switch ent.Tag {
+		case dwarf.TagCompileUnit:
+			cu, _ = ent.Val(dwarf.AttrName).(string)
+			continue
+
+		case dwarf.TagSubprogram, dwarf.TagVariable:
+			// Don't descend into local variables and
+			// inlined subroutines.
+			dr.SkipChildren()
+
+		default:
+			// Descend into namespaces and the like, but
+			// not types.
+			if ent.Tag != dwarf.TagNamespace && ent.Tag != dwarf.TagModule {
+				dr.SkipChildren()
+			}
+			continue
+		}
+		addr, ok := fi.dieAddrOf(ent)
+		if !ok {
+			continue
+		}
+		// Prefer the first DIE at an address.
+		if _, ok := fi.dieAddr[addr]; !ok {
+			fi.dieAddr[addr] = symDIE{ent.Offset, cu}
+		}
+	}
+}
+
+// httpSymInfo serves information about a symbol:
+//
+//	/sym/<id>/info    the details of the symbol as JSON
+//	/sym/<id>/asm     an assembly listing of a function as a .s file
+//	/sym/<id>/bin     the raw bytes of the symbol as a .bin file
+//	/sym/<id>/obj     a function as a relocatable object file
+//	/sym/<id>/annotations  the operand notes of a function as JSON
+func (s *state) httpSymInfo(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/sym/"), "/")
+	if len(parts) != 2 {
+		http.NotFound(w, r)
+		return
+	}
+	id, err := strconv.Atoi(parts[0])
+	if err != nil || id < 0 || id >= len(s.symTab.Syms()) {
+		http.Error(w, fmt.Sprintf("bad symbol ID %q", parts[0]), http.StatusNotFound)
+		return
+	}
+	switch parts[1] {
+	case "info":
+		serveJSON(w, s.symDetail(obj.SymID(id)))
+	case "asm":
+		s.serveSymAsm(w, obj.SymID(id))
+	case "bin":
+		s.serveSymBin(w, obj.SymID(id))
+	case "obj":
+		s.serveSymObj(w, obj.SymID(id))
+	case "annotations":
+		s.serveSymAnnotations(w, r, obj.SymID(id))
+	default:
+		http.NotFound(w, r)
+	}
+}
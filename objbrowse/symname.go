@@ -0,0 +1,28 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "strings"
+
+// goPackage returns the Go package path of symbol name, or "" if name
+// doesn't look like a Go symbol in a package.
+func goPackage(name string) string {
+	// Drop type arguments, which may contain package paths.
+	if i := strings.IndexByte(name, '['); i >= 0 {
+		name = name[:i]
+	}
+	slash := strings.LastIndexByte(name, '/')
+	dot := strings.IndexByte(name[slash+1:], '.')
+	if dot < 0 {
+		return ""
+	}
+	pkg := name[:slash+1+dot]
+	switch pkg {
+	case "", "type", "go":
+		// Linker-generated symbols.
+		return ""
+	}
+	return pkg
+}
@@ -7,31 +7,45 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 
-	"github.com/aclements/objbrowse/internal/obj"
 	"github.com/aclements/objbrowse/internal/symtab"
+	"github.com/aclements/objbrowse/obj"
 )
 
 type SymView struct {
-	fi     *FileInfo
-	symTab *symtab.Table
+	fi      *FileInfo
+	symTab  *symtab.Table
+	origins *SymOrigins
 }
 
-func NewSymView(fi *FileInfo, symTab *symtab.Table) *SymView {
-	return &SymView{fi, symTab}
+func NewSymView(fi *FileInfo, symTab *symtab.Table, origins *SymOrigins) *SymView {
+	return &SymView{fi, symTab, origins}
 }
 
 type SymViewJS struct {
 	Syms SymViewSymsJS
+	// Origins gives the compile unit, package, and file of each
+	// symbol in Syms.
+	Origins *SymOriginsJS
 }
 
 type SymViewSymsJS struct {
 	Syms []obj.Sym
+	fi   *FileInfo
 }
 
 func (s *SymViewSymsJS) MarshalJSON() ([]byte, error) {
 	// Because symbol tables can be very large, we encode SymJS
-	// more compactly than the default encoding.
+	// more compactly than the default encoding. Each symbol is
+	// an array of [name, kind, value, size, local, attrs,
+	// version, views], where attrs is a string of symAttrs
+	// letters and views is a string of viewCaps letters.
 	//
 	// TODO: This still allocates a lot more than necessary,
 	// mostly just to write JSON strings. Maybe we should just do
@@ -50,13 +64,257 @@ func (s *SymViewSymsJS) MarshalJSON() ([]byte, error) {
 		buf.WriteByte(byte(sym.Kind))
 		buf.WriteString("\",")
 		AddrJS(sym.Value).MarshalJSONTo(buf)
-		buf.WriteByte(']')
+		buf.WriteByte(',')
+		buf.WriteString(strconv.FormatUint(sym.Size, 10))
+		if sym.Local {
+			buf.WriteString(",1")
+		} else {
+			buf.WriteString(",0")
+		}
+		buf.WriteString(",\"")
+		buf.WriteString(symAttrs(sym))
+		buf.WriteString("\",")
+		enc.Encode(sym.Version)
+		buf.WriteString(",\"")
+		if s.fi != nil {
+			buf.WriteString(s.fi.SymCaps(sym).String())
+		}
+		buf.WriteString("\"]")
 	}
 	buf.WriteByte(']')
 
 	return buf.Bytes(), nil
 }
 
+// symAttrs returns a compact encoding of sym's binding, visibility,
+// and symbol table: "w" for weak, "p", "h", or "i" for protected,
+// hidden, or internal visibility, "d" for the dynamic symbol table,
+// "s" for synthesized symbols, and "v" for symbols whose version
+// isn't the default.
+func symAttrs(sym obj.Sym) string {
+	var attrs []byte
+	if sym.Weak {
+		attrs = append(attrs, 'w')
+	}
+	switch sym.Visibility {
+	case obj.SymProtected:
+		attrs = append(attrs, 'p')
+	case obj.SymHidden:
+		attrs = append(attrs, 'h')
+	case obj.SymInternal:
+		attrs = append(attrs, 'i')
+	}
+	if sym.Dynamic {
+		attrs = append(attrs, 'd')
+	}
+	if sym.Synthetic {
+		attrs = append(attrs, 's')
+	}
+	if sym.VersionHidden {
+		attrs = append(attrs, 'v')
+	}
+	return string(attrs)
+}
+
 func (v *SymView) Decode() (interface{}, error) {
-	return &SymViewJS{SymViewSymsJS{v.symTab.Syms()}}, nil
+	return &SymViewJS{SymViewSymsJS{v.symTab.Syms(), v.fi}, v.origins.Decode()}, nil
+}
+
+// A SymQuery selects and orders symbols from the symbol table.
+type SymQuery struct {
+	// Sort is a list of sort keys, each "name", "addr", "size",
+	// or "kind", optionally prefixed with "-" to sort in
+	// descending order. Later keys break ties in earlier keys.
+	Sort []string
+
+	// Kinds, if non-empty, is the set of symbol kinds to include,
+	// as kind letters (for example, "TR").
+	Kinds string
+	// MinSize and MaxSize bound symbol sizes. MaxSize < 0 means
+	// no bound.
+	MinSize, MaxSize int64
+	// Defined, Local, Weak, and Dynamic, if non-nil, select
+	// defined or undefined symbols, local or global symbols, weak
+	// or non-weak symbols, and symbols from the dynamic or static
+	// symbol table.
+	Defined, Local, Weak, Dynamic *bool
+	// Name, if non-nil, selects symbols whose names match.
+	Name *regexp.Regexp
+	// Pkg, if non-empty, selects text symbols from this Go
+	// package, according to SymOrigins.
+	Pkg string
+
+	// Offset and Limit select a page of the results. Limit < 0
+	// means no limit.
+	Offset, Limit int
+}
+
+// SymQueryJS is the result of a SymQuery.
+type SymQueryJS struct {
+	// Total is the number of symbols that matched, before
+	// applying Offset and Limit.
+	Total int
+	Syms  SymViewSymsJS
+}
+
+// parseSymQuery parses a SymQuery from query parameters:
+//
+//	sort     comma-separated sort keys (default "name")
+//	kind     kind letters to include
+//	minsize  minimum symbol size
+//	maxsize  maximum symbol size
+//	defined  "1" or "0" for defined or undefined symbols
+//	local    "1" or "0" for local or global symbols
+//	weak     "1" or "0" for weak or non-weak symbols
+//	dynamic  "1" or "0" for dynamic or static symbol table entries
+//	re       regexp matching symbol names
+//	pkg      Go package path
+//	offset   index of the first result
+//	limit    maximum number of results
+func parseSymQuery(vals url.Values) (SymQuery, error) {
+	q := SymQuery{Sort: []string{"name"}, MaxSize: -1, Limit: -1}
+	if s := vals.Get("sort"); s != "" {
+		q.Sort = strings.Split(s, ",")
+		for _, key := range q.Sort {
+			switch strings.TrimPrefix(key, "-") {
+			case "name", "addr", "size", "kind":
+			default:
+				return q, fmt.Errorf("bad sort key %q", key)
+			}
+		}
+	}
+	q.Kinds = vals.Get("kind")
+	q.Pkg = vals.Get("pkg")
+	intParam := func(name string, dst *int64) error {
+		if s := vals.Get(name); s != "" {
+			v, err := strconv.ParseInt(s, 0, 64)
+			if err != nil || v < 0 {
+				return fmt.Errorf("bad %s %q", name, s)
+			}
+			*dst = v
+		}
+		return nil
+	}
+	var offset, limit int64 = 0, -1
+	for _, p := range []struct {
+		name string
+		dst  *int64
+	}{{"minsize", &q.MinSize}, {"maxsize", &q.MaxSize}, {"offset", &offset}, {"limit", &limit}} {
+		if err := intParam(p.name, p.dst); err != nil {
+			return q, err
+		}
+	}
+	q.Offset, q.Limit = int(offset), int(limit)
+	boolParam := func(name string) (*bool, error) {
+		switch s := vals.Get(name); s {
+		case "":
+			return nil, nil
+		case "1", "true":
+			b := true
+			return &b, nil
+		case "0", "false":
+			b := false
+			return &b, nil
+		default:
+			return nil, fmt.Errorf("bad %s %q", name, s)
+		}
+	}
+	var err error
+	if q.Defined, err = boolParam("defined"); err != nil {
+		return q, err
+	}
+	if q.Local, err = boolParam("local"); err != nil {
+		return q, err
+	}
+	if q.Weak, err = boolParam("weak"); err != nil {
+		return q, err
+	}
+	if q.Dynamic, err = boolParam("dynamic"); err != nil {
+		return q, err
+	}
+	if s := vals.Get("re"); s != "" {
+		if q.Name, err = regexp.Compile(s); err != nil {
+			return q, err
+		}
+	}
+	return q, nil
+}
+
+// Query returns the symbols selected by q.
+func (v *SymView) Query(q SymQuery) *SymQueryJS {
+	var syms []obj.Sym
+	for id, sym := range v.symTab.Syms() {
+		if q.Pkg != "" && v.origins.Pkg(obj.SymID(id)) != q.Pkg {
+			continue
+		}
+		if q.Kinds != "" && !strings.ContainsRune(q.Kinds, rune(sym.Kind)) {
+			continue
+		}
+		if int64(sym.Size) < q.MinSize || q.MaxSize >= 0 && int64(sym.Size) > q.MaxSize {
+			continue
+		}
+		if q.Defined != nil && *q.Defined == (sym.Kind == obj.SymUndef) {
+			continue
+		}
+		if q.Local != nil && *q.Local != sym.Local {
+			continue
+		}
+		if q.Weak != nil && *q.Weak != sym.Weak {
+			continue
+		}
+		if q.Dynamic != nil && *q.Dynamic != sym.Dynamic {
+			continue
+		}
+		if q.Name != nil && !q.Name.MatchString(sym.Name) {
+			continue
+		}
+		syms = append(syms, sym)
+	}
+
+	sort.SliceStable(syms, func(i, j int) bool {
+		a, b := &syms[i], &syms[j]
+		for _, key := range q.Sort {
+			desc := strings.HasPrefix(key, "-")
+			var c int
+			switch strings.TrimPrefix(key, "-") {
+			case "name":
+				c = strings.Compare(a.Name, b.Name)
+			case "addr":
+				c = compareUint64(a.Value, b.Value)
+			case "size":
+				c = compareUint64(a.Size, b.Size)
+			case "kind":
+				c = compareUint64(uint64(a.Kind), uint64(b.Kind))
+			}
+			if desc {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+
+	out := &SymQueryJS{Total: len(syms)}
+	if q.Offset > len(syms) {
+		syms = nil
+	} else {
+		syms = syms[q.Offset:]
+	}
+	if q.Limit >= 0 && q.Limit < len(syms) {
+		syms = syms[:q.Limit]
+	}
+	out.Syms = SymViewSymsJS{syms, v.fi}
+	return out
+}
+
+func compareUint64(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
 }
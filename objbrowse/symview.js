@@ -11,15 +11,27 @@ class SymView {
         this._sort = "name";
         $(container).addClass("symview");
 
-        // Parse symbol addresses.
-        for (let sym of data.Syms) {
+        // Parse symbol addresses and record each symbol's ID before
+        // sorting. Symbols with duplicate names link by ID.
+        const counts = new Map();
+        data.Syms.forEach((sym, i) => {
             sym[2] = new AddrJS(sym[2]);
+            sym.id = i;
+            counts.set(sym[0], (counts.get(sym[0]) || 0) + 1);
+        });
+        for (let sym of data.Syms)
+            sym.dup = counts.get(sym[0]) > 1;
+        // Record each symbol's compile unit, package, and file.
+        this._origins = data.Origins;
+        if (data.Origins) {
+            for (let sym of data.Syms)
+                sym.origin = data.Origins.Syms[sym.id];
         }
 
         // Add search box.
         //
         // TODO: Also accept an address to search for.
-        const search = $('<input type="text" size="40" autofocus="true" placeholder="filter regexp">').appendTo(container);
+        const search = $('<input type="text" size="40" autofocus="true" placeholder="filter regexp">').addClass("symview-filter").appendTo(container);
         let searchDelay = null;
         self._filterRe = null;
         function onSearch(now) {
@@ -53,6 +65,49 @@ class SymView {
         // the browser show the validation message.
         search.change(() => { onSearch(true); search[0].reportValidity(); });
 
+        // Add size range filter.
+        self._minSize = self._maxSize = null;
+        const sizeInput = (placeholder) =>
+              $('<input type="text" size="8">').attr("placeholder", placeholder).
+              attr("title", "size in bytes, e.g. \"512\", \"0x200\", or \"4k\"").
+              addClass("symview-size").appendTo(container);
+        const minSize = sizeInput("min size"), maxSize = sizeInput("max size");
+        function onSize() {
+            for (let [input, field] of [[minSize, "_minSize"], [maxSize, "_maxSize"]]) {
+                const v = parseSize(input.val());
+                if (Number.isNaN(v)) {
+                    input[0].setCustomValidity("bad size");
+                    return;
+                }
+                input[0].setCustomValidity("");
+                self[field] = v;
+            }
+            self._updateFilter();
+        }
+        minSize.on("input", onSize);
+        maxSize.on("input", onSize);
+
+        // Add package filter.
+        self._pkg = null;
+        if (data.Origins && data.Origins.Pkgs.length > 1) {
+            const pkgs = data.Origins.Pkgs.map((name, i) => [name, i]).slice(1);
+            pkgs.sort((a, b) => a[0] < b[0] ? -1 : +(a[0] > b[0]));
+            const select = $("<select>").addClass("symview-pkg").
+                  attr("title", data.Origins.ExactPkgs ? "Go package, from DWARF" : "Go package, guessed from symbol names").
+                  appendTo(container);
+            $('<option value="">').text("all packages").appendTo(select);
+            for (let [name, i] of pkgs)
+                $("<option>").attr("value", i).text(name).appendTo(select);
+            select.change(() => {
+                self._pkg = select.val() === "" ? null : Number(select.val());
+                self._updateFilter();
+            });
+        }
+
+        // Add a link to download the filtered symbols.
+        this._csv = $('<a download="">').text("CSV").attr("title", "download the listed symbols").
+            addClass("symview-csv").appendTo(container);
+
         // Keyboard shortcuts for search box.
         //
         // TODO: If this becomes one panel in a bigger UI, only
@@ -80,8 +135,19 @@ class SymView {
     }
 
     _updateFilter() {
+        const params = new URLSearchParams({format: "csv"});
+        if (this._filterRe !== null)
+            params.set("re", this._filterRe.source);
+        if (this._minSize !== null)
+            params.set("minsize", this._minSize);
+        if (this._maxSize !== null)
+            params.set("maxsize", this._maxSize);
+        if (this._pkg !== null)
+            params.set("pkg", this._origins.Pkgs[this._pkg]);
+        this._csv.attr("href", "/syms?" + params);
+
         // Create a filtered copy of the syms list.
-        if (this._filterRe == null) {
+        if (this._filterRe == null && this._minSize === null && this._maxSize === null && this._pkg === null) {
             this._syms = this._allSyms;
             this._populate();
             return;
@@ -89,9 +155,15 @@ class SymView {
 
         const syms = [];
         for (let sym of this._allSyms) {
-            if (this._filterRe.test(sym[0])) {
-                syms.push(sym);
-            }
+            if (this._filterRe !== null && !this._filterRe.test(sym[0]))
+                continue;
+            if (this._minSize !== null && sym[3] < this._minSize)
+                continue;
+            if (this._maxSize !== null && sym[3] > this._maxSize)
+                continue;
+            if (this._pkg !== null && !(sym.origin && sym.origin[1] == this._pkg))
+                continue;
+            syms.push(sym);
         }
         this._syms = syms;
 
@@ -105,6 +177,10 @@ class SymView {
         const NAME = 0;
         const TYPE = 1;
         const VALUE = 2;
+        const SIZE = 3;
+        const ATTRS = 5;
+        const VERSION = 6;
+        const VIEWS = 7;
 
         // Crete table header.
         const t = this._table;
@@ -112,13 +188,18 @@ class SymView {
         const colName = $('<td width="30em">Name</td>');
         const colType = $('<td width="3em">Type</td>');
         const colValue = $('<td width="10em">Value</td>');
-        t.css({"width": (30+3+10)+"em"});
+        const colSize = $('<td width="6em">Size</td>');
+        const colAttrs = $('<td width="8em">Attrs</td>');
+        const colViews = $('<td width="10em">Views</td>');
+        t.css({"width": (30+3+10+6+8+10)+"em"});
         t.append(
-            $('<thead>').append(colName).append(colType).append(colValue)
+            $('<thead>').append(colName).append(colType).append(colValue).append(colSize).append(colAttrs).append(colViews)
         );
         colName.click(() => { self._sort = "name"; self._populate(); });
+        colType.click(() => { self._sort = "type"; self._populate(); });
         colValue.click(() => { self._sort = "value"; self._populate(); });
-        $([colName[0], colValue[0]]).css({"cursor": "pointer"});
+        colSize.click(() => { self._sort = "size"; self._populate(); });
+        $([colName[0], colType[0], colValue[0], colSize[0]]).css({"cursor": "pointer"});
 
         // Sort symbols.
         const syms = this._syms;
@@ -126,9 +207,17 @@ class SymView {
         if (this._sort == "name") {
             syms.sort((a, b) => a[NAME] < b[NAME] ? -1 : +(a[NAME] > b[NAME]));
             sortCol = colName;
+        } else if (this._sort == "type") {
+            syms.sort((a, b) => a[TYPE] < b[TYPE] ? -1 : +(a[TYPE] > b[TYPE]) ||
+                      (a[NAME] < b[NAME] ? -1 : +(a[NAME] > b[NAME])));
+            sortCol = colType;
         } else if (this._sort == "value") {
             syms.sort((a, b) => a[VALUE].compare(b[VALUE]));
             sortCol = colValue;
+        } else if (this._sort == "size") {
+            // Largest first.
+            syms.sort((a, b) => b[SIZE] - a[SIZE]);
+            sortCol = colSize;
         } else {
             throw("bad sort " + this._sort);
         }
@@ -140,15 +229,68 @@ class SymView {
             const rows = [];
             for (let i = start; i < start + n; i++) {
                 const sym = self._syms[i];
+                const name = $('<td>').addClass('symview-name').text(sym[NAME]);
+                if (sym[VERSION]) {
+                    // Like readelf, "@@" marks the default version of
+                    // a definition.
+                    const sep = sym[TYPE] != 'U' && !sym[ATTRS].includes('v') ? '@@' : '@';
+                    name.append($('<span>').addClass('symview-version').text(sep + sym[VERSION]));
+                }
                 const tr = $('<tr>').append([
-                    $('<td>').addClass('symview-name').text(sym[NAME]),
+                    name,
                     $('<td>').text(sym[TYPE]),
                     $('<td>').text(sym[VALUE]),
+                    $('<td>').addClass('pos').text(sym[SIZE]),
+                    $('<td>').addClass('symview-attrs').text(symAttrNames(sym[ATTRS]).join(' ')),
+                    $('<td>').addClass('symview-views').text(symViewNames(sym[VIEWS]).join(' ')),
                 ]);
-                tr.click(() => { window.location.href = '/s/' + sym[NAME]; })
+                if (sym.origin)
+                    tr.attr("title", self._originTitle(sym.origin));
+                tr.click(() => { window.location.href = symURL(sym[NAME], sym.dup ? sym.id : undefined); })
                 rows.push(tr[0]);
             }
             return rows;
         });
     }
+
+    // _originTitle describes where a symbol comes from, given its
+    // origin indexes.
+    _originTitle(origin) {
+        const o = this._origins;
+        const lines = [];
+        if (origin[1])
+            lines.push("package " + o.Pkgs[origin[1]]);
+        if (origin[0] && o.CUs[origin[0]] != o.Pkgs[origin[1]])
+            lines.push("compile unit " + o.CUs[origin[0]]);
+        if (origin[2])
+            lines.push("file " + o.Files[origin[2]]);
+        return lines.join("\n");
+    }
+}
+
+// symAttrNames expands a compact symbol attribute string from the
+// server into a list of words.
+function symAttrNames(attrs) {
+    const names = {w: "weak", p: "protected", h: "hidden", i: "internal", d: "dyn", s: "synthetic", v: "hidden-version"};
+    return Array.from(attrs || "", (c) => names[c] || c);
+}
+
+// symViewNames expands a compact string of available symbol views
+// from the server into a list of view names.
+function symViewNames(views) {
+    const names = {h: "hex", a: "asm", s: "src", l: "lines", g: "go"};
+    return Array.from(views || "", (c) => names[c] || c);
+}
+
+// parseSize parses a size such as "512", "0x200", "4k", or "1M". It
+// returns null if s is empty and NaN if it's malformed.
+function parseSize(s) {
+    s = s.trim();
+    if (s == "")
+        return null;
+    const m = /^(0x[0-9a-f]+|[0-9]+(?:\.[0-9]+)?)\s*([kmg]?)i?b?$/i.exec(s);
+    if (!m)
+        return NaN;
+    const scale = {"": 1, k: 1024, m: 1024 * 1024, g: 1024 * 1024 * 1024}[m[2].toLowerCase()];
+    return Math.floor(Number(m[1]) * scale);
 }
@@ -0,0 +1,42 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"html/template"
+	"net/http"
+)
+
+// httpTabs serves the tabbed symbol browser. The page keeps its open
+// tabs, the active view and scroll positions of each, and the active
+// tab in its URL fragment, so the whole state can be bookmarked:
+//
+//	t=SYM  a tab showing the symbol page /s/SYM, which may include
+//	       a query and fragment, like "main.f?id=3#+10-14"
+//	v=VIEW the view last used in the preceding tab
+//	s=POS  the scroll positions of the preceding tab's views, as
+//	       comma-separated VIEW:OFFSET pairs
+//	a=N    the index of the active tab
+func (s *state) httpTabs(w http.ResponseWriter, r *http.Request) {
+	if err := tmplTabs.Execute(w, nil); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+var tmplTabs = template.Must(template.New("").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>Objbrowse: tabs</title>
+<link rel="stylesheet" type="text/css" href="/objbrowse.css" />
+</head>
+<body>
+<script src="https://code.jquery.com/jquery-3.3.1.min.js"></script>
+<script src="/objbrowse.js"></script>
+<script src="/palette.js"></script>
+<script src="/tabs.js"></script>
+<script>new TabView(document.body)</script>
+</body>
+</html>
+`))
@@ -0,0 +1,211 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+"use strict";
+
+// TabView shows several symbol pages as tabs in one page. The tabs,
+// each tab's active view and scroll positions, and the active tab are
+// kept in the URL fragment, as described by httpTabs.
+class TabView {
+    constructor(container) {
+        const self = this;
+        $(container).addClass("tabs-page");
+        this._bar = $("<div>").addClass("tabs-bar").appendTo(container);
+        this._frames = $("<div>").addClass("tabs-frames").appendTo(container);
+        this._tabs = [];
+        this._active = -1;
+        this._hash = null;
+
+        this._palette = new CommandPalette({});
+        this._palette.onGoto = (url) => {
+            self._select(self._add(url.replace(/^\/s\//, ""), "", {}));
+            self._save();
+        };
+        this._newTab = $("<a>").attr({href: "#", title: "open a symbol in a new tab"}).
+            addClass("tabs-new").text("+").appendTo(this._bar);
+        this._newTab.click((ev) => {
+            ev.preventDefault();
+            self._palette.open("symbol");
+        });
+
+        this._load();
+        window.addEventListener("hashchange", () => {
+            // Ignore our own updates.
+            if (window.location.hash !== self._hash)
+                self._load();
+        });
+    }
+
+    // _load opens the tabs in the URL fragment, replacing any open
+    // tabs.
+    _load() {
+        for (let t of this._tabs) {
+            t.tab.remove();
+            t.frame.remove();
+        }
+        this._tabs = [];
+        this._active = -1;
+
+        const params = new URLSearchParams(window.location.hash.substr(1));
+        const syms = params.getAll("t"), views = params.getAll("v"), scrolls = params.getAll("s");
+        syms.forEach((sym, i) => {
+            const scroll = {};
+            for (let pos of (scrolls[i] || "").split(",")) {
+                const [view, off] = pos.split(":");
+                if (view && off)
+                    scroll[view] = Number(off);
+            }
+            this._add(sym, views[i] || "", scroll);
+        });
+        if (this._tabs.length === 0) {
+            $("<div>").addClass("tabs-empty").
+                text("No open tabs. Press + or Ctrl-P to open a symbol.").appendTo(this._frames);
+            return;
+        }
+        this._frames.children(".tabs-empty").remove();
+        const active = Number(params.get("a")) || 0;
+        this._select(Math.min(Math.max(active, 0), this._tabs.length - 1));
+        this._hash = window.location.hash;
+    }
+
+    // _add opens a tab for the symbol page /s/sym and returns its
+    // index. view and scroll are the tab's active view and the
+    // scroll position of each view to restore once it loads.
+    _add(sym, view, scroll) {
+        const self = this;
+        this._frames.children(".tabs-empty").remove();
+        const t = {sym: sym, view: view, scroll: scroll, restored: false};
+        t.tab = $("<span>").addClass("tabs-tab").insertBefore(this._newTab);
+        t.label = $("<span>").text(tabTitle(sym)).appendTo(t.tab);
+        $("<a>").attr({href: "#", title: "close tab"}).addClass("tabs-close").text("×").appendTo(t.tab).
+            click((ev) => {
+                ev.preventDefault();
+                ev.stopPropagation();
+                self._close(self._tabs.indexOf(t));
+            });
+        t.tab.click(() => {
+            self._select(self._tabs.indexOf(t));
+            self._save();
+        });
+        t.frame = $("<iframe>").addClass("tabs-frame").attr("src", "/s/" + sym).appendTo(this._frames);
+        t.frame.on("load", () => { self._loaded(t); });
+        this._tabs.push(t);
+        return this._tabs.length - 1;
+    }
+
+    // _loaded hooks into tab t's page when it loads, including when
+    // the user follows a link in it.
+    _loaded(t) {
+        const self = this;
+        const win = t.frame[0].contentWindow;
+        const loc = win.location;
+        if (loc.pathname.startsWith("/s/"))
+            t.sym = loc.pathname.substr(3) + loc.search + loc.hash;
+        t.label.text(tabTitle(t.sym));
+        t.tab.attr("title", decodeURIComponent(t.sym));
+
+        if (!t.restored) {
+            // Restore the state from the URL, but only in the
+            // first page the tab loads.
+            t.restored = true;
+            this._restore(t);
+        } else {
+            t.view = "";
+            t.scroll = {};
+        }
+
+        // Save the state as the user works in the tab.
+        let timer = null;
+        const changed = () => {
+            if (timer === null) {
+                timer = setTimeout(() => {
+                    timer = null;
+                    self._capture(t);
+                    self._save();
+                }, 200);
+            }
+        };
+        win.document.addEventListener("scroll", changed, true);
+        win.document.addEventListener("mousedown", changed, true);
+        win.addEventListener("hashchange", changed);
+        this._save();
+    }
+
+    // _cols returns the named view columns of tab t's page.
+    _cols(t) {
+        const win = t.frame[0].contentWindow;
+        if (!win.$)
+            return [];
+        return win.$(".panel-col").toArray().
+            map((col) => ({view: win.$(col).data("view"), col: col})).
+            filter((c) => c.view);
+    }
+
+    // _restore applies tab t's saved view and scroll positions.
+    _restore(t) {
+        for (let c of this._cols(t)) {
+            if (c.view in t.scroll)
+                c.col.scrollTop = t.scroll[c.view];
+            if (c.view === t.view)
+                $(c.col).addClass("panel-active");
+        }
+    }
+
+    // _capture records tab t's active view and scroll positions.
+    _capture(t) {
+        t.scroll = {};
+        for (let c of this._cols(t)) {
+            if (c.col.scrollTop > 0)
+                t.scroll[c.view] = Math.round(c.col.scrollTop);
+            if (c.col.classList.contains("panel-active"))
+                t.view = c.view;
+        }
+        const loc = t.frame[0].contentWindow.location;
+        if (loc.pathname.startsWith("/s/"))
+            t.sym = loc.pathname.substr(3) + loc.search + loc.hash;
+    }
+
+    _select(i) {
+        this._active = i;
+        this._tabs.forEach((t, j) => {
+            t.tab.toggleClass("tabs-active", i === j);
+            t.frame.toggleClass("tabs-frame-active", i === j);
+        });
+    }
+
+    _close(i) {
+        const t = this._tabs[i];
+        t.tab.remove();
+        t.frame.remove();
+        this._tabs.splice(i, 1);
+        if (this._active >= this._tabs.length)
+            this._active = this._tabs.length - 1;
+        else if (this._active > i)
+            this._active--;
+        if (this._active >= 0)
+            this._select(this._active);
+        this._save();
+    }
+
+    // _save writes the state of the tabs to the URL fragment.
+    _save() {
+        const params = new URLSearchParams();
+        for (let t of this._tabs) {
+            params.append("t", t.sym);
+            params.append("v", t.view);
+            params.append("s", Object.keys(t.scroll).map((v) => v + ":" + t.scroll[v]).join(","));
+        }
+        if (this._active > 0)
+            params.set("a", this._active);
+        this._hash = "#" + params.toString();
+        history.replaceState(null, "", this._hash);
+        const t = this._tabs[this._active];
+        document.title = "Objbrowse: " + (t ? tabTitle(t.sym) : "tabs");
+    }
+}
+
+// tabTitle returns the title of the tab for symbol page /s/sym.
+function tabTitle(sym) {
+    return decodeURIComponent(sym.replace(/[?#].*/, ""));
+}
@@ -0,0 +1,158 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/aclements/objbrowse/internal/perfscript"
+)
+
+// A Trace is an executed path through the program, reconstructed from
+// a sequence of taken branches. The path is a sequence of segments,
+// each of which is a run of straight-line code in one symbol.
+type Trace struct {
+	segs []TraceSegJS
+}
+
+// TraceSegJS is the straight-line code [Start, End] executed between
+// two taken branches. End is the address of the segment's last
+// instruction, which is usually a branch.
+type TraceSegJS struct {
+	// I is the index of the segment in the trace.
+	I     int
+	Sym   string
+	Start AddrJS
+	End   AddrJS
+}
+
+// TraceJS is the part of the trace in one symbol.
+type TraceJS struct {
+	// Total is the number of segments in the whole trace.
+	Total int
+	// Segs are the segments in the symbol, in trace order.
+	Segs []TraceSegJS
+	// Prev and Next give the symbols of the segments before and
+	// after each segment in Segs, or "" at the ends of the trace.
+	Prev, Next []string
+}
+
+// traceBranchJS is a branch in a JSON trace file. Addresses are in
+// the object file's address space.
+type traceBranchJS struct {
+	From, To AddrJS
+}
+
+// loadTrace reads a branch trace from path. The trace may be the
+// output of "perf script --itrace=b" (or a perf.data file with an
+// Intel PT trace, if perf is installed) or a JSON list of objects with
+// From and To addresses.
+func loadTrace(fi *FileInfo, objPath, path string) (*Trace, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var branches []perfscript.Branch
+	if trimmed := bytes.TrimSpace(data); bytes.HasPrefix(trimmed, []byte("[")) {
+		var tbs []traceBranchJS
+		if err := json.Unmarshal(trimmed, &tbs); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		for _, tb := range tbs {
+			branches = append(branches, perfscript.Branch{
+				From: perfscript.Loc{Addr: uint64(tb.From), HasAddr: true},
+				To:   perfscript.Loc{Addr: uint64(tb.To), HasAddr: true},
+			})
+		}
+		return newTrace(&perfResolver{fi: fi}, branches), nil
+	}
+
+	if bytes.HasPrefix(data, []byte("PERFILE2")) {
+		data, err = runPerfScript(path, "--itrace=b", "-F", "comm,tid,time,ip,sym,symoff,dso,addr")
+		if err != nil {
+			return nil, err
+		}
+	}
+	samples, err := perfscript.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	for _, s := range samples {
+		if s.Target != nil {
+			branches = append(branches, perfscript.Branch{From: s.IP, To: *s.Target})
+		}
+	}
+	if len(branches) == 0 {
+		return nil, fmt.Errorf("%s: no branch events (use perf script --itrace=b)", path)
+	}
+	return newTrace(newPerfResolver(fi, objPath, samples), branches), nil
+}
+
+func newTrace(r *perfResolver, branches []perfscript.Branch) *Trace {
+	t := new(Trace)
+	symOf := func(pc uint64) string {
+		id, _ := r.fi.SymTab.Addr(pc)
+		return r.fi.SymTab.Syms()[id].Name
+	}
+	var cur uint64
+	var curSym string
+	have := false
+	add := func(start, end uint64, sym string) {
+		t.segs = append(t.segs, TraceSegJS{len(t.segs), sym, AddrJS(start), AddrJS(end)})
+	}
+	for _, br := range branches {
+		if from, ok := r.resolve(br.From); ok {
+			sym := symOf(from)
+			start := from
+			if have && curSym == sym && cur <= from {
+				start = cur
+			}
+			add(start, from, sym)
+		}
+		cur, have = r.resolve(br.To)
+		if have {
+			curSym = symOf(cur)
+		}
+	}
+	if have {
+		add(cur, cur, curSym)
+	}
+	return t
+}
+
+// forSym returns the segments of the trace in symbol sym.
+func (t *Trace) forSym(sym string) *TraceJS {
+	out := &TraceJS{Total: len(t.segs), Segs: []TraceSegJS{}, Prev: []string{}, Next: []string{}}
+	for i, seg := range t.segs {
+		if seg.Sym != sym {
+			continue
+		}
+		prev, next := "", ""
+		if i > 0 {
+			prev = t.segs[i-1].Sym
+		}
+		if i+1 < len(t.segs) {
+			next = t.segs[i+1].Sym
+		}
+		out.Segs = append(out.Segs, seg)
+		out.Prev = append(out.Prev, prev)
+		out.Next = append(out.Next, next)
+	}
+	return out
+}
+
+// httpTrace serves the segments of the trace in the symbol given by
+// the "sym" query parameter as JSON.
+func (s *state) httpTrace(w http.ResponseWriter, r *http.Request) {
+	if s.trace == nil {
+		http.Error(w, "no trace loaded (see -trace)", http.StatusNotFound)
+		return
+	}
+	serveJSON(w, s.trace.forSym(r.FormValue("sym")))
+}
@@ -0,0 +1,116 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+"use strict";
+
+// TraceView plays back the executed path through a symbol from a
+// branch trace, one instruction at a time, highlighting the current
+// instruction and the rest of its straight-line segment in asmView.
+class TraceView {
+    constructor(symName, asmView, container) {
+        const self = this;
+        this._symName = symName;
+        this._asmView = asmView;
+        this._timer = null;
+
+        const div = $("<div>").addClass("traceview").appendTo(container);
+        const controls = $("<div>").appendTo(div);
+        const button = (text, title, fn) =>
+              $('<button type="button">').text(text).attr("title", title).click(fn).appendTo(controls);
+        button("⏮", "previous segment", () => self._seekSeg(-1));
+        button("◀", "previous instruction", () => self._seek(self._pos - 1));
+        this._play = button("▶", "play", () => self._toggle());
+        button("▶|", "next instruction", () => self._seek(self._pos + 1));
+        button("⏭", "next segment", () => self._seekSeg(1));
+        this._scrubber = $('<input type="range" min="0" value="0">').
+            on("input", () => self._seek(parseInt(self._scrubber.val()))).
+            appendTo(div);
+        this._status = $("<div>").addClass("trace-status").text("Loading trace…").appendTo(div);
+
+        $.getJSON("/trace", {sym: symName}).done((data) => {
+            self._load(data);
+        }).fail((xhr) => {
+            self._status.text(xhr.responseText.trim());
+        });
+    }
+
+    _load(data) {
+        this._data = data;
+        // Expand the segments into instruction steps.
+        this._steps = [];
+        data.Segs.forEach((seg, k) => {
+            const end = new AddrJS(seg.End).add(new AddrJS(1));
+            const rows = this._asmView.rowsInRange({start: new AddrJS(seg.Start), end: end});
+            for (let j = 0; j < rows.length; j++)
+                this._steps.push({seg: k, j: j, n: rows.length, row: rows[j], rows: rows});
+        });
+        if (this._steps.length == 0) {
+            this._status.text("The trace never executes this symbol.");
+            return;
+        }
+        this._scrubber.attr("max", this._steps.length - 1);
+
+        // Start at the segment given by ?trace=N, if any.
+        let pos = 0;
+        const want = parseInt(new URLSearchParams(window.location.search).get("trace"));
+        if (!isNaN(want)) {
+            const i = this._steps.findIndex((st) => this._data.Segs[st.seg].I >= want);
+            if (i >= 0)
+                pos = i;
+        }
+        this._seek(pos);
+    }
+
+    _seek(pos) {
+        if (!this._steps || pos < 0 || pos >= this._steps.length) {
+            this._stop();
+            return;
+        }
+        this._pos = pos;
+        this._scrubber.val(pos);
+        const step = this._steps[pos];
+        this._asmView.markTrace(step.rows, step.row);
+
+        // Describe the position and link to neighboring symbols
+        // at segment boundaries.
+        const seg = this._data.Segs[step.seg];
+        this._status.empty().text("segment " + (seg.I + 1) + " of " + this._data.Total +
+                                  ", instruction " + (step.j + 1) + " of " + step.n);
+        const link = (sym, i, text) => {
+            if (sym && sym != this._symName)
+                this._status.append(" ").append(
+                    $("<a>").attr("href", "/s/" + sym + "?trace=" + i).text(text + sym));
+        };
+        if (step.j == 0)
+            link(this._data.Prev[step.seg], seg.I - 1, "from ");
+        if (step.j == step.n - 1)
+            link(this._data.Next[step.seg], seg.I + 1, "next: ");
+    }
+
+    // _seekSeg moves to the start of the segment delta segments away.
+    _seekSeg(delta) {
+        if (!this._steps)
+            return;
+        const seg = this._steps[this._pos].seg + delta;
+        const i = this._steps.findIndex((st) => st.seg == seg);
+        if (i >= 0)
+            this._seek(i);
+    }
+
+    _toggle() {
+        if (this._timer !== null) {
+            this._stop();
+            return;
+        }
+        this._play.text("⏸").attr("title", "pause");
+        this._timer = setInterval(() => this._seek(this._pos + 1), 300);
+    }
+
+    _stop() {
+        if (this._timer !== null)
+            clearInterval(this._timer);
+        this._timer = null;
+        this._play.text("▶").attr("title", "play");
+    }
+}
@@ -0,0 +1,154 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+"use strict";
+
+// Treemap draws the binary's size rollup from /sizes as a zoomable
+// treemap.
+class Treemap {
+    constructor(container) {
+        const self = this;
+        $(container).addClass("treemap-page");
+        this._crumbs = $("<div>").addClass("treemap-crumbs").appendTo(container);
+        this._map = $("<div>").addClass("treemap").appendTo(container);
+        this._map.text("Loading…");
+        this._path = [];
+
+        $.getJSON("/sizes").done((root) => {
+            self._path = [root];
+            self._draw();
+            $(window).resize(() => { self._draw(); });
+        }).fail((xhr) => {
+            showError("Size map", xhr, self._map.empty());
+        });
+    }
+
+    // _draw draws the node at the end of the zoom path.
+    _draw() {
+        const self = this;
+        const node = this._path[this._path.length - 1];
+
+        // Breadcrumbs to zoom back out.
+        this._crumbs.empty();
+        this._path.forEach((n, i) => {
+            if (i > 0)
+                self._crumbs.append(" / ");
+            const crumb = $("<a>").attr("href", "#").text(n.Name).appendTo(self._crumbs);
+            crumb.click((ev) => {
+                ev.preventDefault();
+                self._path.length = i + 1;
+                self._draw();
+            });
+        });
+        this._crumbs.append(" (" + formatSize(node.Value) + ")");
+
+        this._map.empty();
+        const w = this._map.width(), h = this._map.height();
+        this._drawKids(this._map[0], node, {x: 0, y: 0, w: w, h: h}, 0, this._path.map((n) => n.Name));
+    }
+
+    // _drawKids draws the children of node into rect r of parent.
+    _drawKids(parent, node, r, depth, path) {
+        const self = this;
+        const kids = node.Children || [];
+        const rects = squarify(kids.map((k) => k.Value), r);
+        kids.forEach((k, i) => {
+            const kr = rects[i];
+            if (kr.w < 3 || kr.h < 3)
+                return;
+            const kpath = path.concat([k.Name]);
+            const div = document.createElement("div");
+            div.className = k.Children ? "treemap-group" : "treemap-leaf";
+            Object.assign(div.style, {
+                left: kr.x + "px", top: kr.y + "px",
+                width: (kr.w - 1) + "px", height: (kr.h - 1) + "px",
+                backgroundColor: treemapColor(depth, i),
+            });
+            div.title = kpath.slice(1).join(" / ") + "\n" + formatSize(k.Value);
+            parent.appendChild(div);
+
+            const labelHeight = 14;
+            if (kr.w > 30 && kr.h > labelHeight) {
+                const label = document.createElement("div");
+                label.className = "treemap-label";
+                label.textContent = k.Name + " " + formatSize(k.Value);
+                div.appendChild(label);
+            }
+
+            div.addEventListener("click", (ev) => {
+                ev.stopPropagation();
+                if (k.Children) {
+                    self._path.push(k);
+                    self._draw();
+                } else if (k.Sym) {
+                    window.location.href = symURL(k.Sym);
+                }
+            });
+
+            // Show two levels at a time.
+            if (k.Children && depth < 1 && kr.h > 2 * labelHeight)
+                self._drawKids(div, k, {x: 1, y: labelHeight, w: kr.w - 3, h: kr.h - labelHeight - 2}, depth + 1, kpath);
+        });
+    }
+}
+
+// treemapColor returns the background color of the i'th box at the
+// given depth.
+function treemapColor(depth, i) {
+    const hue = (i * 47) % 360;
+    return "hsl(" + hue + ", 50%, " + (depth == 0 ? 80 : 90) + "%)";
+}
+
+// squarify lays out boxes with areas proportional to values (sorted in
+// decreasing order) in rectangle r, keeping the boxes close to square.
+// It returns a rectangle for each value.
+//
+// See Bruls, Huizing, and van Wijk, "Squarified Treemaps".
+function squarify(values, r) {
+    const total = values.reduce((a, b) => a + b, 0);
+    if (total <= 0)
+        return values.map(() => ({x: r.x, y: r.y, w: 0, h: 0}));
+    const scale = r.w * r.h / total;
+    let {x, y, w, h} = r;
+    const out = [];
+    // worst returns the worst aspect ratio of a row with the given
+    // largest area, smallest area, and total area along side.
+    const worst = (max, min, sum, side) =>
+          Math.max(side * side * max / (sum * sum), (sum * sum) / (side * side * min));
+    for (let i = 0; i < values.length;) {
+        // Add boxes to this row while that improves its worst
+        // aspect ratio.
+        const side = Math.min(w, h);
+        const max = values[i] * scale;
+        let sum = max, j = i + 1;
+        while (j < values.length) {
+            const a = values[j] * scale;
+            if (a <= 0 || worst(max, a, sum + a, side) > worst(max, values[j-1] * scale, sum, side))
+                break;
+            sum += a;
+            j++;
+        }
+
+        // Lay out the row along the shorter side.
+        const thick = side > 0 ? sum / side : 0;
+        let off = 0;
+        for (let k = i; k < j; k++) {
+            const len = thick > 0 ? values[k] * scale / thick : 0;
+            if (w >= h)
+                out.push({x: x, y: y + off, w: thick, h: len});
+            else
+                out.push({x: x + off, y: y, w: len, h: thick});
+            off += len;
+        }
+        if (w >= h) {
+            x += thick;
+            w -= thick;
+        } else {
+            y += thick;
+            h -= thick;
+        }
+        i = j;
+    }
+    return out;
+}
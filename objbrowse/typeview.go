@@ -0,0 +1,358 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aclements/objbrowse/internal/btf"
+	"github.com/aclements/objbrowse/obj"
+)
+
+// A typeSource is type information the type browser and ValueView
+// can display. Types are named as dwarf.Type.String names them, such
+// as "struct task_struct".
+type typeSource interface {
+	// TypeNames returns the sorted names of the named types.
+	TypeNames() ([]string, error)
+	// Type returns the type called name, or nil if there is none.
+	Type(name string) (dwarf.Type, error)
+	// SymType returns the type of the variable of data symbol sym,
+	// or nil if there is none.
+	SymType(sym obj.Sym) (dwarf.Type, error)
+}
+
+// typeSourceNames are the type sources, in the order ValueView
+// consults them.
+var typeSourceNames = []string{"dwarf", "btf"}
+
+// typePrefix returns the keyword dwarf.Type.String puts before the
+// names of types with DWARF tag tag.
+func typePrefix(tag dwarf.Tag) string {
+	switch tag {
+	case dwarf.TagStructType:
+		return "struct "
+	case dwarf.TagUnionType:
+		return "union "
+	case dwarf.TagClassType:
+		return "class "
+	case dwarf.TagEnumerationType:
+		return "enum "
+	}
+	return ""
+}
+
+// dwarfTypes is the type source for Obj's DWARF.
+type dwarfTypes struct {
+	fi *FileInfo
+
+	once   sync.Once
+	names  []string
+	offs   map[string]dwarf.Offset
+	err    error
+	dwData *dwarf.Data
+}
+
+func (t *dwarfTypes) index() {
+	t.dwData, t.err = t.fi.DWARF()
+	if t.err != nil {
+		return
+	}
+	t.offs = make(map[string]dwarf.Offset)
+	r := t.dwData.Reader()
+	for {
+		ent, err := r.Next()
+		if err != nil {
+			t.err = err
+			return
+		}
+		if ent == nil {
+			break
+		}
+		switch ent.Tag {
+		case dwarf.TagStructType, dwarf.TagUnionType, dwarf.TagClassType, dwarf.TagEnumerationType, dwarf.TagTypedef, dwarf.TagBaseType:
+		default:
+			continue
+		}
+		name, _ := ent.Val(dwarf.AttrName).(string)
+		if decl, _ := ent.Val(dwarf.AttrDeclaration).(bool); name == "" || decl {
+			continue
+		}
+		name = typePrefix(ent.Tag) + name
+		if _, ok := t.offs[name]; !ok {
+			t.offs[name] = ent.Offset
+			t.names = append(t.names, name)
+		}
+	}
+	sort.Strings(t.names)
+}
+
+func (t *dwarfTypes) TypeNames() ([]string, error) {
+	t.once.Do(t.index)
+	return t.names, t.err
+}
+
+func (t *dwarfTypes) Type(name string) (dwarf.Type, error) {
+	t.once.Do(t.index)
+	if t.err != nil {
+		return nil, t.err
+	}
+	off, ok := t.offs[name]
+	if !ok {
+		return nil, nil
+	}
+	return t.dwData.Type(off)
+}
+
+func (t *dwarfTypes) SymType(sym obj.Sym) (dwarf.Type, error) {
+	die, ok := t.fi.SymDIE(sym.Name, sym.Value)
+	if !ok {
+		return nil, nil
+	}
+	dw, err := t.fi.DWARF()
+	if err != nil {
+		return nil, err
+	}
+	ent := entryAt(dw, die.off)
+	if ent == nil || ent.Tag != dwarf.TagVariable {
+		return nil, nil
+	}
+	typOff, ok := ent.Val(dwarf.AttrType).(dwarf.Offset)
+	if !ok {
+		return nil, nil
+	}
+	return dw.Type(typOff)
+}
+
+// btfTypes is the type source for BTF, from the -btf file or Obj's
+// .BTF section.
+type btfTypes struct {
+	fi *FileInfo
+
+	once  sync.Once
+	names []string
+	ids   map[string]btf.TypeID
+	vars  map[string]btf.Var
+	spec  *btf.Spec
+	err   error
+}
+
+func (t *btfTypes) index() {
+	t.spec, t.err = t.fi.BTF()
+	if t.err != nil {
+		return
+	}
+	t.ids = make(map[string]btf.TypeID)
+	for id := btf.TypeID(1); int(id) < t.spec.NumTypes(); id++ {
+		name := t.spec.Name(id)
+		if name == "" {
+			continue
+		}
+		switch t.spec.Kind(id) {
+		case btf.KindStruct:
+			name = "struct " + name
+		case btf.KindUnion:
+			name = "union " + name
+		case btf.KindEnum, btf.KindEnum64:
+			name = "enum " + name
+		case btf.KindInt, btf.KindFloat, btf.KindTypedef:
+		default:
+			continue
+		}
+		if _, ok := t.ids[name]; !ok {
+			t.ids[name] = id
+			t.names = append(t.names, name)
+		}
+	}
+	sort.Strings(t.names)
+	t.vars = make(map[string]btf.Var)
+	for _, v := range t.spec.Vars() {
+		t.vars[v.Name] = v
+	}
+}
+
+func (t *btfTypes) TypeNames() ([]string, error) {
+	t.once.Do(t.index)
+	return t.names, t.err
+}
+
+func (t *btfTypes) Type(name string) (dwarf.Type, error) {
+	t.once.Do(t.index)
+	if t.err != nil {
+		return nil, t.err
+	}
+	id, ok := t.ids[name]
+	if !ok {
+		return nil, nil
+	}
+	return t.spec.Type(id)
+}
+
+func (t *btfTypes) SymType(sym obj.Sym) (dwarf.Type, error) {
+	t.once.Do(t.index)
+	if t.err != nil {
+		// Most objects have no BTF.
+		return nil, nil
+	}
+	v, ok := t.vars[sym.Name]
+	if !ok {
+		return nil, nil
+	}
+	return t.spec.Type(v.Type)
+}
+
+// Sources returns the names of the type sources the object has.
+func (v *ValueView) Sources() []string {
+	var out []string
+	if _, err := v.fi.DWARF(); err == nil {
+		out = append(out, "dwarf")
+	}
+	if _, err := v.fi.BTF(); err == nil {
+		out = append(out, "btf")
+	}
+	return out
+}
+
+// maxTypeNames limits how many type names /types lists.
+const maxTypeNames = 500
+
+// TypeListJS lists the types whose names match a query.
+type TypeListJS struct {
+	Names []string
+	// More is the number of matches left out of Names.
+	More int `json:",omitempty"`
+}
+
+// TypeLayoutJS is the layout of a type in memory, in the style of
+// pahole.
+type TypeLayoutJS struct {
+	Name string
+	// Defn is the definition of the type, with typedefs resolved.
+	Defn string
+	Size int64
+	// Fields are the fields of a struct or union, with holes
+	// listed as fields named "" between them.
+	Fields []TypeFieldJS `json:",omitempty"`
+	// Holes is the total size of the holes, including trailing
+	// padding.
+	Holes int64 `json:",omitempty"`
+	// Values are the values of an enum.
+	Values []string `json:",omitempty"`
+}
+
+type TypeFieldJS struct {
+	Name string
+	Type string `json:",omitempty"`
+	// Offset and Size are in bytes. BitSize is non-zero for
+	// bitfields.
+	Offset  int64
+	Size    int64
+	BitSize int64 `json:",omitempty"`
+}
+
+// typeLayout returns the layout of typ.
+func typeLayout(name string, typ dwarf.Type) *TypeLayoutJS {
+	l := &TypeLayoutJS{Name: name, Size: typ.Size()}
+	switch t := stripTypedefs(typ).(type) {
+	case *dwarf.StructType:
+		l.Defn = t.Kind + " " + t.StructName
+		end := int64(0)
+		hole := func(to int64) {
+			if t.Kind != "union" && to > end {
+				l.Fields = append(l.Fields, TypeFieldJS{Offset: end, Size: to - end})
+				l.Holes += to - end
+			}
+		}
+		for _, f := range t.Field {
+			hole(f.ByteOffset)
+			size := f.Type.Size()
+			l.Fields = append(l.Fields, TypeFieldJS{f.Name, f.Type.String(), f.ByteOffset, size, f.BitSize})
+			if f.BitSize != 0 {
+				// Bitfields share their storage unit, so
+				// only count the bytes they cover.
+				size = (f.BitSize + 7) / 8
+			}
+			if e := f.ByteOffset + size; e > end {
+				end = e
+			}
+		}
+		hole(t.ByteSize)
+	case *dwarf.EnumType:
+		l.Defn = "enum " + t.EnumName
+		for _, v := range t.Val {
+			l.Values = append(l.Values, fmt.Sprintf("%s = %d", v.Name, v.Val))
+		}
+	default:
+		l.Defn = t.String()
+	}
+	return l
+}
+
+// httpTypes serves the types of the type source named by the "source"
+// parameter. With a "name" parameter, it serves the TypeLayoutJS of
+// that type; otherwise it serves a TypeListJS of the types whose names
+// contain the "q" parameter.
+func (s *state) httpTypes(w http.ResponseWriter, r *http.Request) {
+	src, ok := s.valueView.sources[r.FormValue("source")]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown type source %q", r.FormValue("source")), http.StatusBadRequest)
+		return
+	}
+	if name := r.FormValue("name"); name != "" {
+		typ, err := src.Type(name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if typ == nil {
+			http.Error(w, fmt.Sprintf("no type %q", name), http.StatusNotFound)
+			return
+		}
+		serveJSON(w, typeLayout(name, typ))
+		return
+	}
+
+	names, err := src.TypeNames()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	q := r.FormValue("q")
+	out := TypeListJS{Names: []string{}}
+	for _, name := range names {
+		if !strings.Contains(name, q) {
+			continue
+		}
+		if len(out.Names) < maxTypeNames {
+			out.Names = append(out.Names, name)
+		} else {
+			out.More++
+		}
+	}
+	serveJSON(w, out)
+}
+
+// httpValue serves the value at the hex address in the "a" parameter
+// decoded as the type named by the "type" parameter from the type
+// source named by the "source" parameter, as a ValueViewJS.
+func (s *state) httpValue(w http.ResponseWriter, r *http.Request) {
+	addr, err := strconv.ParseUint(strings.TrimPrefix(r.FormValue("a"), "0x"), 16, 64)
+	if err != nil {
+		http.Error(w, "bad address", http.StatusBadRequest)
+		return
+	}
+	vv, err := s.valueView.DecodeAt(r.FormValue("source"), r.FormValue("type"), addr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	serveJSON(w, vv)
+}
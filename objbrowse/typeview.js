@@ -0,0 +1,125 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+"use strict";
+
+// sourceSelect returns a <select> of type sources.
+function sourceSelect(sources) {
+    const sel = $("<select>");
+    for (let s of sources)
+        $("<option>").attr("value", s).text(s.toUpperCase()).appendTo(sel);
+    return sel;
+}
+
+// TypeView lists the types from DWARF or BTF and shows the memory
+// layout of the selected type, including holes, like pahole.
+class TypeView {
+    constructor(sources, container) {
+        const details = $("<details>").addClass("typeview").appendTo(container);
+        $("<summary>").text("Type layouts").appendTo(details);
+        const form = $("<form>").appendTo(details);
+        this._source = sourceSelect(sources).appendTo(form);
+        this._filter = $('<input type="text" size="30" placeholder="filter types">').appendTo(form);
+        this._list = $("<div>").addClass("tv-list").appendTo(details);
+        this._layout = $("<div>").addClass("tv-layout").appendTo(details);
+
+        form.submit((ev) => {
+            ev.preventDefault();
+            this._load();
+        });
+        this._source.change(() => this._load());
+        details.one("toggle", () => this._load());
+    }
+
+    _load() {
+        const list = this._list.text("Loading…");
+        $.getJSON("/types", {source: this._source.val(), q: this._filter.val()}).done((data) => {
+            list.empty();
+            for (let name of data.Names)
+                $("<div>").addClass("tv-name").text(name).click(() => this._show(name)).appendTo(list);
+            if (data.More)
+                $("<div>").addClass("vv-more").text("… " + data.More + " more").appendTo(list);
+        }).fail((xhr) => {
+            list.empty();
+            showError("Types", xhr, list);
+        });
+    }
+
+    _show(name) {
+        const div = this._layout.text("Loading…");
+        $.getJSON("/types", {source: this._source.val(), name: name}).done((data) => {
+            div.empty();
+            $("<div>").addClass("tv-defn").text(data.Defn + " (" + data.Size + " bytes)").appendTo(div);
+            if (data.Fields) {
+                const table = $("<table>").addClass("audit-table").appendTo(div);
+                $("<tr>").append(["offset", "size", "name", "type"].map((h) => $("<th>").text(h))).appendTo(table);
+                for (let f of data.Fields) {
+                    const tr = $("<tr>").append(
+                        $("<td>").addClass("pos").text(f.Offset),
+                        $("<td>").addClass("pos").text(f.Size + (f.BitSize ? ":" + f.BitSize + " bits" : "")),
+                        $("<td>").text(f.Name),
+                        $("<td>").text(f.Type || "")).appendTo(table);
+                    if (f.Type === undefined) {
+                        tr.addClass("tv-hole");
+                        tr.children().eq(2).text("hole");
+                    }
+                }
+                if (data.Holes)
+                    $("<div>").text(data.Holes + " bytes of holes and padding").appendTo(div);
+            }
+            for (let v of data.Values || [])
+                $("<div>").text(v).appendTo(div);
+        }).fail((xhr) => {
+            div.empty();
+            showError("Type " + name, xhr, div);
+        });
+    }
+}
+
+// TypeDecoder decodes the data at an address in the hex view as a
+// type from DWARF or BTF, such as a kernel structure described by
+// /sys/kernel/btf/vmlinux.
+class TypeDecoder {
+    constructor(sources, base, container) {
+        const form = $("<form>").addClass("search typedecoder").appendTo(container);
+        this._source = sourceSelect(sources).appendTo(form);
+        this._type = $('<input type="text" size="24" placeholder="decode as type">').
+            attr("list", "typedecoder-types").appendTo(form);
+        this._names = $("<datalist>").attr("id", "typedecoder-types").appendTo(form);
+        form.append(" at ");
+        this._addr = $('<input type="text" size="16">').val(base.toString()).appendTo(form);
+        $('<button type="submit">').text("Decode").appendTo(form);
+        this._out = $("<div>").appendTo(container);
+
+        form.submit((ev) => {
+            ev.preventDefault();
+            this._decode();
+        });
+        this._type.on("input", () => this._complete());
+    }
+
+    // _complete suggests type names matching the type input.
+    _complete() {
+        const q = this._type.val();
+        if (q.length < 3)
+            return;
+        $.getJSON("/types", {source: this._source.val(), q: q}).done((data) => {
+            this._names.empty();
+            for (let name of data.Names)
+                $("<option>").attr("value", name).appendTo(this._names);
+        });
+    }
+
+    _decode() {
+        const out = this._out.empty();
+        const params = {source: this._source.val(), type: this._type.val(), a: this._addr.val().replace(/^0x/, "")};
+        $.getJSON("/value", params).done((data) => {
+            // Selections in the hex view highlight the decoded
+            // value like a symbol's own value.
+            valueView = new ValueView(data, out);
+        }).fail((xhr) => {
+            showError("Decode", xhr, out);
+        });
+    }
+}
@@ -0,0 +1,493 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/aclements/objbrowse/arch"
+	"github.com/aclements/objbrowse/obj"
+)
+
+// ValueView decodes the value of a data symbol using the type of its
+// variable from DWARF or BTF.
+type ValueView struct {
+	fi      *FileInfo
+	sources map[string]typeSource
+}
+
+func NewValueView(fi *FileInfo) *ValueView {
+	return &ValueView{fi, map[string]typeSource{
+		"dwarf": &dwarfTypes{fi: fi},
+		"btf":   &btfTypes{fi: fi},
+	}}
+}
+
+type ValueViewJS struct {
+	Root *ValueJS
+	// Truncated indicates decoding stopped after maxValueNodes
+	// values.
+	Truncated bool `json:",omitempty"`
+}
+
+// ValueJS is one node in a decoded value tree.
+type ValueJS struct {
+	// Name is the variable name, field name, element index, or
+	// "*" for the target of a pointer.
+	Name string
+	Type string
+	Addr AddrJS
+	Size int64
+	// Value is the rendered value of a scalar, or a summary of a
+	// composite value, such as the length of a slice.
+	Value string `json:",omitempty"`
+	// Ptr is the symbolized target of a pointer.
+	Ptr  *PtrJS     `json:",omitempty"`
+	Kids []*ValueJS `json:",omitempty"`
+	// More is the number of elements left out of Kids.
+	More int64 `json:",omitempty"`
+}
+
+// Limits on how much of a value to decode. Depth is consumed by both
+// nesting and following pointers.
+const (
+	maxValueDepth  = 6
+	maxValueElems  = 16
+	maxValueNodes  = 2000
+	maxValueString = 64
+)
+
+// DecodeSym decodes the value of data symbol sym. It returns nil if
+// neither DWARF nor BTF has a variable for sym.
+func (v *ValueView) DecodeSym(sym obj.Sym, data obj.Data) (*ValueViewJS, error) {
+	a := v.fi.Obj.Info().Arch
+	if a == nil || !sym.HasAddr {
+		return nil, nil
+	}
+	for _, name := range typeSourceNames {
+		typ, err := v.sources[name].SymType(sym)
+		if err != nil {
+			return nil, fmt.Errorf("reading type of %s: %v", sym.Name, err)
+		}
+		if typ != nil {
+			d := &valueDecoder{fi: v.fi, arch: a, data: data}
+			root := d.decode(sym.Name, typ, sym.Value, maxValueDepth)
+			return &ValueViewJS{root, d.truncated}, nil
+		}
+	}
+	return nil, nil
+}
+
+// DecodeAt decodes the value at addr as the type named typeName in
+// the named type source.
+func (v *ValueView) DecodeAt(source, typeName string, addr uint64) (*ValueViewJS, error) {
+	a := v.fi.Obj.Info().Arch
+	if a == nil {
+		return nil, fmt.Errorf("unknown architecture")
+	}
+	src, ok := v.sources[source]
+	if !ok {
+		return nil, fmt.Errorf("unknown type source %q", source)
+	}
+	typ, err := src.Type(typeName)
+	if err != nil {
+		return nil, err
+	}
+	if typ == nil {
+		return nil, fmt.Errorf("no type %q in %s", typeName, source)
+	}
+	d := &valueDecoder{fi: v.fi, arch: a}
+	root := d.decode(fmt.Sprintf("%#x", addr), typ, addr, maxValueDepth)
+	return &ValueViewJS{root, d.truncated}, nil
+}
+
+type valueDecoder struct {
+	fi   *FileInfo
+	arch *arch.Arch
+	// data is the data of the symbol being decoded.
+	data obj.Data
+
+	nodes     int
+	truncated bool
+}
+
+// mem returns the size bytes at addr, or nil if they aren't all in
+// the object.
+func (d *valueDecoder) mem(addr uint64, size int64) []byte {
+	if size < 0 {
+		return nil
+	}
+	if off := addr - d.data.Addr; addr >= d.data.Addr && off+uint64(size) <= uint64(len(d.data.P)) {
+		return d.data.P[off : off+uint64(size)]
+	}
+	data, err := d.fi.Obj.Data(addr, uint64(size))
+	if err != nil || int64(len(data.P)) < size {
+		return nil
+	}
+	return data.P
+}
+
+func (d *valueDecoder) uint(b []byte) uint64 {
+	switch len(b) {
+	case 1:
+		return uint64(b[0])
+	case 2:
+		return uint64(d.arch.ByteOrder.Uint16(b))
+	case 4:
+		return uint64(d.arch.ByteOrder.Uint32(b))
+	case 8:
+		return d.arch.ByteOrder.Uint64(b)
+	}
+	return 0
+}
+
+func (d *valueDecoder) int(b []byte) int64 {
+	shift := uint(64 - 8*len(b))
+	return int64(d.uint(b)<<shift) >> shift
+}
+
+// decode decodes the value of type t at addr.
+func (d *valueDecoder) decode(name string, t dwarf.Type, addr uint64, depth int) *ValueJS {
+	v := &ValueJS{Name: name, Type: t.String(), Addr: AddrJS(addr), Size: t.Size()}
+	if d.nodes++; d.nodes > maxValueNodes {
+		d.truncated = true
+		return v
+	}
+	b := d.mem(addr, t.Size())
+	if b == nil {
+		v.Value = "<unavailable>"
+		return v
+	}
+
+	switch t := stripTypedefs(t).(type) {
+	case *dwarf.BoolType:
+		v.Value = strconv.FormatBool(b[0] != 0)
+
+	case *dwarf.IntType, *dwarf.CharType:
+		v.Value = strconv.FormatInt(d.int(b), 10)
+
+	case *dwarf.UintType, *dwarf.UcharType:
+		x := d.uint(b)
+		v.Value = strconv.FormatUint(x, 10)
+		if x >= 10 {
+			v.Value += fmt.Sprintf(" (%#x)", x)
+		}
+
+	case *dwarf.FloatType:
+		switch len(b) {
+		case 4:
+			v.Value = strconv.FormatFloat(float64(math.Float32frombits(uint32(d.uint(b)))), 'g', -1, 32)
+		case 8:
+			v.Value = strconv.FormatFloat(math.Float64frombits(d.uint(b)), 'g', -1, 64)
+		}
+
+	case *dwarf.ComplexType:
+		switch len(b) {
+		case 8:
+			re := math.Float32frombits(uint32(d.uint(b[:4])))
+			im := math.Float32frombits(uint32(d.uint(b[4:])))
+			v.Value = fmt.Sprint(complex(re, im))
+		case 16:
+			re := math.Float64frombits(d.uint(b[:8]))
+			im := math.Float64frombits(d.uint(b[8:]))
+			v.Value = fmt.Sprint(complex(re, im))
+		}
+
+	case *dwarf.EnumType:
+		x := d.int(b)
+		v.Value = strconv.FormatInt(x, 10)
+		for _, ev := range t.Val {
+			if ev.Val == x {
+				v.Value = ev.Name + " (" + v.Value + ")"
+				break
+			}
+		}
+
+	case *dwarf.PtrType:
+		d.decodePtr(v, t, d.uint(b), depth)
+
+	case *dwarf.FuncType:
+		// Function values are pointers to code or closures.
+		if len(b) == d.arch.PtrSize {
+			d.setPtr(v, d.uint(b))
+		}
+
+	case *dwarf.ArrayType:
+		d.decodeArray(v, t, addr, depth)
+
+	case *dwarf.StructType:
+		d.decodeStruct(v, t, b, addr, depth)
+
+	default:
+		if len(b) <= 16 {
+			v.Value = fmt.Sprintf("%x", b)
+		}
+	}
+	return v
+}
+
+// stripTypedefs returns the type underlying typedefs and qualifiers
+// of t.
+func stripTypedefs(t dwarf.Type) dwarf.Type {
+	for {
+		switch tt := t.(type) {
+		case *dwarf.TypedefType:
+			t = tt.Type
+		case *dwarf.QualType:
+			t = tt.Type
+		default:
+			return t
+		}
+	}
+}
+
+// setPtr sets v to pointer value p.
+func (d *valueDecoder) setPtr(v *ValueJS, p uint64) {
+	if p == 0 {
+		v.Value = "nil"
+		return
+	}
+	v.Value = fmt.Sprintf("%#x", p)
+	ptr := d.fi.ResolvePtr(p, 0)
+	v.Ptr = &ptr
+}
+
+func (d *valueDecoder) decodePtr(v *ValueJS, t *dwarf.PtrType, p uint64, depth int) {
+	d.setPtr(v, p)
+	if p == 0 || depth == 0 {
+		return
+	}
+	elem := stripTypedefs(t.Type)
+	if _, ok := elem.(*dwarf.VoidType); ok || elem.Size() <= 0 {
+		return
+	}
+	// Only follow pointers into the object's data.
+	if v.Ptr.Section == "" {
+		return
+	}
+	kid := d.decode("*", t.Type, p, depth-1)
+	v.Kids = []*ValueJS{kid}
+
+	// Go maps and channels are pointers to runtime headers.
+	// Summarize their length.
+	if st, ok := elem.(*dwarf.StructType); ok {
+		switch {
+		case strings.HasPrefix(st.StructName, "map<"), strings.HasPrefix(st.StructName, "hash<"):
+			// Swiss maps count in "used", older maps in
+			// "count".
+			if n := findValue(kid, "used"); n != "" {
+				v.Value = "len " + n
+			} else if n := findValue(kid, "count"); n != "" {
+				v.Value = "len " + n
+			}
+		case strings.HasPrefix(st.StructName, "hchan<"):
+			if n := findValue(kid, "qcount"); n != "" {
+				v.Value = "len " + n + " cap " + findValue(kid, "dataqsiz")
+			}
+		}
+	}
+}
+
+func (d *valueDecoder) decodeArray(v *ValueJS, t *dwarf.ArrayType, addr uint64, depth int) {
+	n := t.Count
+	if n <= 0 {
+		return
+	}
+	elem := stripTypedefs(t.Type)
+	switch elem.(type) {
+	case *dwarf.CharType, *dwarf.UcharType:
+		// Show C character arrays as strings.
+		v.Value = d.cString(addr, n)
+	}
+	d.decodeElems(v, t.Type, addr, n, depth)
+}
+
+// decodeElems decodes the first maxValueElems elements of an array
+// of n elements of type elem at addr into v.Kids.
+func (d *valueDecoder) decodeElems(v *ValueJS, elem dwarf.Type, addr uint64, n int64, depth int) {
+	if depth == 0 {
+		return
+	}
+	size := elem.Size()
+	if size <= 0 {
+		return
+	}
+	shown := n
+	if shown > maxValueElems {
+		shown = maxValueElems
+	}
+	for i := int64(0); i < shown; i++ {
+		v.Kids = append(v.Kids, d.decode(strconv.FormatInt(i, 10), elem, addr+uint64(i*size), depth-1))
+	}
+	v.More = n - shown
+}
+
+// cString returns the quoted NUL-terminated string in the n bytes at
+// addr.
+func (d *valueDecoder) cString(addr uint64, n int64) string {
+	if n > maxValueString {
+		n = maxValueString
+	}
+	b := d.mem(addr, n)
+	if i := strings.IndexByte(string(b), 0); i >= 0 {
+		return strconv.Quote(string(b[:i]))
+	}
+	return strconv.Quote(string(b)) + "…"
+}
+
+func (d *valueDecoder) decodeStruct(v *ValueJS, t *dwarf.StructType, b []byte, addr uint64, depth int) {
+	field := func(name string) *dwarf.StructField {
+		for _, f := range t.Field {
+			if f.Name == name {
+				return f
+			}
+		}
+		return nil
+	}
+	word := func(f *dwarf.StructField) uint64 {
+		size := f.Type.Size()
+		if f.ByteOffset < 0 || size <= 0 || f.ByteOffset+size > int64(len(b)) {
+			return 0
+		}
+		return d.uint(b[f.ByteOffset : f.ByteOffset+size])
+	}
+
+	// Recognize Go strings and slices by their DWARF names and
+	// fields.
+	if t.StructName == "string" {
+		if str, ln := field("str"), field("len"); str != nil && ln != nil {
+			p, n := word(str), int64(word(ln))
+			v.Value = d.goString(p, n)
+			if n > 0 {
+				ptr := d.fi.ResolvePtr(p, 0)
+				v.Ptr = &ptr
+			}
+			return
+		}
+	}
+	if strings.HasPrefix(t.StructName, "[]") {
+		array, ln, cp := field("array"), field("len"), field("cap")
+		if array != nil && ln != nil && cp != nil {
+			p, n := word(array), int64(word(ln))
+			v.Value = fmt.Sprintf("len %d cap %d", n, int64(word(cp)))
+			if p != 0 {
+				ptr := d.fi.ResolvePtr(p, 0)
+				v.Ptr = &ptr
+				if pt, ok := stripTypedefs(array.Type).(*dwarf.PtrType); ok && ptr.Section != "" {
+					d.decodeElems(v, pt.Type, p, n, depth)
+				}
+			}
+			return
+		}
+	}
+
+	if depth == 0 {
+		v.Value = "{…}"
+		return
+	}
+	for _, f := range t.Field {
+		if f.BitSize != 0 {
+			v.Kids = append(v.Kids, &ValueJS{Name: f.Name, Type: f.Type.String(), Addr: AddrJS(addr + uint64(f.ByteOffset)), Value: "<bitfield>"})
+			continue
+		}
+		v.Kids = append(v.Kids, d.decode(f.Name, f.Type, addr+uint64(f.ByteOffset), depth-1))
+	}
+
+	// Summarize Go interfaces and common sync types.
+	switch t.StructName {
+	case "runtime.eface", "runtime.iface":
+		if len(v.Kids) > 0 {
+			v.Value = ifaceType(v.Kids[0])
+		}
+	case "sync.Mutex":
+		if state := findValue(v, "state"); state != "" {
+			if x, err := strconv.ParseInt(strings.Fields(state)[0], 10, 64); err == nil && x&1 != 0 {
+				v.Value = "locked"
+			} else {
+				v.Value = "unlocked"
+			}
+		}
+	case "sync.Once":
+		if done := findValue(v, "done"); done != "" {
+			if done == "0" || done == "false" {
+				v.Value = "not done"
+			} else {
+				v.Value = "done"
+			}
+		}
+	}
+}
+
+// goString returns the quoted contents of the Go string of n bytes
+// at p.
+func (d *valueDecoder) goString(p uint64, n int64) string {
+	if n == 0 {
+		return `""`
+	}
+	if n < 0 || p == 0 {
+		return fmt.Sprintf("<bad string %#x len %d>", p, n)
+	}
+	shown := n
+	if shown > maxValueString {
+		shown = maxValueString
+	}
+	b := d.mem(p, shown)
+	if b == nil {
+		return fmt.Sprintf("<unavailable, len %d>", n)
+	}
+	s := strconv.Quote(string(b))
+	if shown < n {
+		s += fmt.Sprintf("… (len %d)", n)
+	}
+	return s
+}
+
+// ifaceType returns the dynamic type of a Go interface value from its
+// type or itab word.
+func ifaceType(tab *ValueJS) string {
+	if tab.Value == "nil" {
+		return "nil"
+	}
+	if tab.Ptr == nil || tab.Ptr.Sym == "" {
+		return ""
+	}
+	name := tab.Ptr.Sym
+	for _, prefix := range []string{"type:", "type.", "go:itab.", "go.itab."} {
+		if strings.HasPrefix(name, prefix) {
+			name = name[len(prefix):]
+			if strings.HasPrefix(prefix, "go") {
+				// Itabs are named for the concrete
+				// and interface types.
+				if i := strings.LastIndexByte(name, ','); i >= 0 {
+					name = name[:i]
+				}
+			}
+			return name
+		}
+	}
+	return ""
+}
+
+// findValue returns the value of the first scalar in the tree v named
+// name, or of its first scalar descendant if it's a struct (as are
+// the sync/atomic types).
+func findValue(v *ValueJS, name string) string {
+	for _, k := range v.Kids {
+		if k.Name == name {
+			for len(k.Kids) > 0 && k.Value == "" {
+				k = k.Kids[len(k.Kids)-1]
+			}
+			return k.Value
+		}
+		if s := findValue(k, name); s != "" {
+			return s
+		}
+	}
+	return ""
+}
@@ -0,0 +1,73 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+"use strict";
+
+// ValueView shows the value of a data symbol decoded using its DWARF
+// or BTF type.
+class ValueView {
+    constructor(data, container) {
+        this._container = container;
+        this._ranges = [];
+        const div = $("<div>").addClass("valueview").appendTo(container);
+        if (data.Truncated)
+            $("<div>").addClass("sv-note").text("value truncated").appendTo(div);
+        div.append(this._node(data.Root, 0));
+    }
+
+    // _node returns the DOM for value v, which is nested depth deep.
+    _node(v, depth) {
+        const view = this;
+        const line = $("<span>").addClass("vv-line");
+        $("<span>").addClass("vv-name").text(v.Name).appendTo(line);
+        if (v.Value !== undefined)
+            line.append(" ").append($("<span>").addClass("vv-value").text(v.Value));
+        if (v.Ptr)
+            line.append(" ").append(formatPtr(v.Ptr));
+        line.append(" ").append($("<span>").addClass("vv-type").text(v.Type));
+
+        // Values within the symbol can be highlighted.
+        const start = new AddrJS(v.Addr);
+        const range = {start: start, end: start.add(new AddrJS(v.Size || 1))};
+        line.click((ev) => {
+            if (ev.target.tagName == "A")
+                return;
+            highlightRanges([range], view);
+        });
+        if (!v.Kids) {
+            range.elt = line;
+            this._ranges.push(range);
+            return $("<div>").addClass("vv-leaf").append(line);
+        }
+
+        const details = $("<details>").append($("<summary>").append(line));
+        if (depth < 2)
+            details.attr("open", "");
+        const kids = $("<div>").addClass("vv-kids").appendTo(details);
+        for (let k of v.Kids)
+            kids.append(this._node(k, depth + 1));
+        if (v.More)
+            $("<div>").addClass("vv-more").text("… " + v.More + " more").appendTo(kids);
+        return details;
+    }
+
+    highlightRanges(ranges, scroll) {
+        $(".highlight", this._container).removeClass("highlight");
+        let first = null;
+        for (let r of this._ranges) {
+            for (let h of ranges) {
+                if (IntervalMap.overlap(r, h)) {
+                    r.elt.addClass("highlight");
+                    if (!first)
+                        first = r.elt;
+                    break;
+                }
+            }
+        }
+        if (first && scroll) {
+            first.parents("details").attr("open", "");
+            scrollTo(this._container, first);
+        }
+    }
+}
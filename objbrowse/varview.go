@@ -0,0 +1,505 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"debug/dwarf"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aclements/objbrowse/arch"
+	"github.com/aclements/objbrowse/internal/dwexpr"
+	"github.com/aclements/objbrowse/obj"
+)
+
+// VarView shows the parameters and local variables of a function
+// with their DWARF locations, and evaluates those locations in a
+// frame snapshot.
+type VarView struct {
+	fi *FileInfo
+
+	once sync.Once
+	// locs holds the location list sections. Its encoding
+	// depends on the compile unit, so funcVars copies it.
+	locs *dwexpr.LocReader
+	info []byte
+}
+
+func NewVarView(fi *FileInfo) *VarView {
+	return &VarView{fi: fi}
+}
+
+type VarViewJS struct {
+	// FrameBase is the function's DW_AT_frame_base.
+	FrameBase []VarLocJS `json:",omitempty"`
+	Vars      []VarJS
+}
+
+type VarJS struct {
+	Name  string
+	Type  string `json:",omitempty"`
+	Param bool   `json:",omitempty"`
+	// Scope is the inlined function that declares this variable,
+	// or "" if it's declared by the function itself.
+	Scope string `json:",omitempty"`
+	// Depth is the nesting depth of the variable's lexical block
+	// or inlined call.
+	Depth int `json:",omitempty"`
+	// Const is the variable's DW_AT_const_value.
+	Const string `json:",omitempty"`
+	// Locs is the variable's location. A location that isn't
+	// from a location list has no PC range.
+	Locs []VarLocJS `json:",omitempty"`
+}
+
+// VarLocJS is a location expression, which applies to PCs in [Start,
+// End) if it's from a location list.
+type VarLocJS struct {
+	Start   AddrJS `json:",omitempty"`
+	End     AddrJS `json:",omitempty"`
+	Default bool   `json:",omitempty"`
+	Expr    string
+}
+
+// funcVars is the decoded variables of a function.
+type funcVars struct {
+	enc       dwexpr.Encoding
+	unit      dwexpr.Unit
+	locs      dwexpr.LocReader
+	frameBase varLoc
+	vars      []funcVar
+}
+
+type funcVar struct {
+	js   VarJS
+	size int64
+	loc  varLoc
+}
+
+// varLoc is a location attribute, which is either a single
+// expression or a location list.
+type varLoc struct {
+	ok     bool
+	expr   []byte
+	list   []dwexpr.LocEntry
+	isList bool
+}
+
+// at returns the location expression that applies at pc.
+func (l *varLoc) at(pc uint64) ([]byte, bool) {
+	if !l.isList {
+		return l.expr, l.ok
+	}
+	var def []byte
+	haveDef := false
+	for _, e := range l.list {
+		if e.Default {
+			def, haveDef = e.Expr, true
+		} else if e.Low <= pc && pc < e.High {
+			return e.Expr, true
+		}
+	}
+	return def, haveDef
+}
+
+func (v *VarView) init() {
+	v.once.Do(func() {
+		loc, _, _ := obj.DWARFSection(v.fi.Obj, ".debug_loc")
+		loclists, _, _ := obj.DWARFSection(v.fi.Obj, ".debug_loclists")
+		addr, _, _ := obj.DWARFSection(v.fi.Obj, ".debug_addr")
+		v.info, _, _ = obj.DWARFSection(v.fi.Obj, ".debug_info")
+		v.locs = &dwexpr.LocReader{Loc: loc, LocLists: loclists, Addr: addr}
+	})
+}
+
+// funcVars decodes the variables of the function containing pc.
+func (v *VarView) funcVars(pc uint64) (*funcVars, error) {
+	dw, err := v.fi.DWARF()
+	if err != nil {
+		return nil, err
+	}
+	sub, err := v.fi.AddrToSubprogram(pc)
+	if sub == nil || err != nil {
+		return nil, err
+	}
+	cu := v.fi.AddrToCU(pc)
+	if cu == nil {
+		return nil, fmt.Errorf("no compile unit for %#x", pc)
+	}
+
+	v.init()
+	fv := &funcVars{}
+	fv.enc.Order = dw.Reader().ByteOrder()
+	fv.enc.PtrSize = dw.Reader().AddressSize()
+	fv.enc.OffSize = 4
+	fv.unit.Version = 4
+	if vers, offSize, ok := dwexpr.UnitHeader(v.info, fv.enc, uint64(cu.Offset)); ok {
+		fv.unit.Version, fv.enc.OffSize = vers, offSize
+	}
+	fv.unit.Base, _ = cu.Val(dwarf.AttrLowpc).(uint64)
+	if b, ok := cu.Val(dwarf.AttrAddrBase).(int64); ok {
+		fv.unit.AddrBase = uint64(b)
+	}
+	if b, ok := cu.Val(dwarf.AttrLoclistsBase).(int64); ok {
+		fv.unit.LocListsBase = uint64(b)
+	}
+	fv.locs = *v.locs
+	fv.locs.Enc = fv.enc
+	locs := &fv.locs
+	readLoc := func(ent *dwarf.Entry, attr dwarf.Attr) varLoc {
+		f := ent.AttrField(attr)
+		if f == nil {
+			return varLoc{}
+		}
+		switch f.Class {
+		case dwarf.ClassExprLoc, dwarf.ClassBlock:
+			expr, _ := f.Val.([]byte)
+			return varLoc{ok: true, expr: expr}
+		case dwarf.ClassLocListPtr, dwarf.ClassLocList:
+			off := uint64(f.Val.(int64))
+			if f.Class == dwarf.ClassLocList {
+				var err error
+				off, err = locs.Offset(&fv.unit, off)
+				if err != nil {
+					return varLoc{}
+				}
+			}
+			list, _ := locs.Read(&fv.unit, off)
+			return varLoc{ok: true, list: list, isList: true}
+		}
+		return varLoc{}
+	}
+	fv.frameBase = readLoc(sub, dwarf.AttrFrameBase)
+
+	dr := dw.Reader()
+	dr.Seek(sub.Offset)
+	if _, err := dr.Next(); err != nil || !sub.Children {
+		return fv, err
+	}
+	// scopes is the stack of enclosing scopes. Each is the
+	// inlined function name, or "" for a lexical block.
+	var scopes []string
+	scope := func() string {
+		for i := len(scopes) - 1; i >= 0; i-- {
+			if scopes[i] != "" {
+				return scopes[i]
+			}
+		}
+		return ""
+	}
+	for {
+		ent, err := dr.Next()
+		if err != nil {
+			return nil, err
+		}
+		if ent == nil {
+			break
+		}
+		if ent.Tag == 0 {
+			if len(scopes) == 0 {
+				break
+			}
+			scopes = scopes[:len(scopes)-1]
+			continue
+		}
+		switch ent.Tag {
+		case dwarf.TagFormalParameter, dwarf.TagVariable:
+			fv.vars = append(fv.vars, v.readVar(dw, ent, scope(), len(scopes), readLoc))
+		case dwarf.TagLexDwarfBlock, dwarf.TagInlinedSubroutine:
+			if ent.Children {
+				name := ""
+				if ent.Tag == dwarf.TagInlinedSubroutine {
+					name = v.fi.abstractName(dw, ent)
+				}
+				scopes = append(scopes, name)
+			}
+			continue
+		}
+		// Don't descend into nested functions, types, and the
+		// like.
+		dr.SkipChildren()
+	}
+	return fv, nil
+}
+
+func (v *VarView) readVar(dw *dwarf.Data, ent *dwarf.Entry, scope string, depth int, readLoc func(*dwarf.Entry, dwarf.Attr) varLoc) funcVar {
+	fv := funcVar{js: VarJS{
+		Name:  v.fi.abstractName(dw, ent),
+		Param: ent.Tag == dwarf.TagFormalParameter,
+		Scope: scope,
+		Depth: depth,
+	}}
+	if off, ok := abstractVal(dw, ent, dwarf.AttrType).(dwarf.Offset); ok {
+		if t, err := dw.Type(off); err == nil {
+			fv.js.Type, fv.size = t.String(), t.Size()
+		}
+	}
+	switch c := abstractVal(dw, ent, dwarf.AttrConstValue).(type) {
+	case int64:
+		fv.js.Const = fmt.Sprint(c)
+	case []byte:
+		fv.js.Const = fmt.Sprintf("%#x", c)
+	case string:
+		fv.js.Const = strconv.Quote(c)
+	}
+	fv.loc = readLoc(ent, dwarf.AttrLocation)
+	return fv
+}
+
+// abstractVal returns the value of attribute attr of ent, following
+// DW_AT_abstract_origin if ent doesn't have attr itself.
+func abstractVal(dw *dwarf.Data, ent *dwarf.Entry, attr dwarf.Attr) interface{} {
+	for i := 0; i < 4 && ent != nil; i++ {
+		if val := ent.Val(attr); val != nil {
+			return val
+		}
+		off, ok := ent.Val(dwarf.AttrAbstractOrigin).(dwarf.Offset)
+		if !ok {
+			break
+		}
+		ent = entryAt(dw, off)
+	}
+	return nil
+}
+
+// formatter returns a formatter for expressions using encoding enc.
+func (v *VarView) formatter(enc dwexpr.Encoding) *dwexpr.Formatter {
+	f := &dwexpr.Formatter{Enc: enc, AddrName: v.fi.addrName}
+	if a := v.fi.Obj.Info().Arch; a != nil {
+		f.RegName = a.DWARFRegName
+	}
+	return f
+}
+
+// addrName returns addr as "sym+0x10", or "" if it isn't in a symbol.
+func (fi *FileInfo) addrName(addr uint64) string {
+	name, base := fi.SymTab.SymName(addr)
+	if name == "" || addr == base {
+		return name
+	}
+	return fmt.Sprintf("%s+%#x", name, addr-base)
+}
+
+func (v *VarView) DecodeSym(sym obj.Sym) (*VarViewJS, error) {
+	if sym.Kind != obj.SymText || v.fi.Obj.Info().Arch == nil {
+		return nil, nil
+	}
+	fv, err := v.funcVars(sym.Value)
+	if fv == nil || err != nil {
+		return nil, err
+	}
+	f := v.formatter(fv.enc)
+	locsJS := func(l varLoc) []VarLocJS {
+		if !l.isList {
+			if !l.ok {
+				return nil
+			}
+			return []VarLocJS{{Expr: f.Format(l.expr)}}
+		}
+		out := []VarLocJS{}
+		for _, e := range l.list {
+			out = append(out, VarLocJS{AddrJS(e.Low), AddrJS(e.High), e.Default, f.Format(e.Expr)})
+		}
+		return out
+	}
+	out := &VarViewJS{FrameBase: locsJS(fv.frameBase), Vars: []VarJS{}}
+	for _, fvar := range fv.vars {
+		js := fvar.js
+		js.Locs = locsJS(fvar.loc)
+		out.Vars = append(out.Vars, js)
+	}
+	return out, nil
+}
+
+// VarValueJS is the result of evaluating a variable's location in a
+// frame snapshot.
+type VarValueJS struct {
+	// Loc describes the variable's location, such as "RAX" or
+	// "memory 0x7ffc1000".
+	Loc string `json:",omitempty"`
+	// Value is the variable's value in hex, if it's known.
+	Value string `json:",omitempty"`
+	// Error explains why the location couldn't be evaluated.
+	Error string `json:",omitempty"`
+}
+
+// maxVarValue limits the size of variable values read from memory.
+const maxVarValue = 64
+
+// Eval evaluates the locations of the variables of the function
+// containing pc in the frame snapshot fr.
+func (v *VarView) Eval(pc uint64, fr *dwexpr.Frame) ([]VarValueJS, error) {
+	fv, err := v.funcVars(pc)
+	if err != nil {
+		return nil, err
+	}
+	if fv == nil {
+		return nil, fmt.Errorf("no DWARF for function at %#x", pc)
+	}
+	a := v.fi.Obj.Info().Arch
+	fr.ReadMem = func(addr uint64, size int) ([]byte, bool) {
+		data, err := v.fi.Obj.Data(addr, uint64(size))
+		if err != nil || len(data.P) < size {
+			return nil, false
+		}
+		return data.P, true
+	}
+	fr.Addrx = func(i uint64) (uint64, bool) {
+		return fv.locs.AddrIndex(&fv.unit, i)
+	}
+	regName := func(n uint64) string {
+		if name := a.DWARFRegName(n); name != "" {
+			return name
+		}
+		return fmt.Sprintf("r%d", n)
+	}
+	fv.setFrameBase(pc, fr)
+
+	// hex formats bytes p as an integer in the target byte order,
+	// or as a byte string if they're too long.
+	hex := func(p []byte) string {
+		if len(p) > 8 {
+			return fmt.Sprintf("%x", p)
+		}
+		var b [8]byte
+		if fv.enc.Order == binary.BigEndian {
+			copy(b[8-len(p):], p)
+		} else {
+			copy(b[:], p)
+		}
+		return fmt.Sprintf("%#x", fv.enc.Order.Uint64(b[:]))
+	}
+	out := make([]VarValueJS, len(fv.vars))
+	for i, fvar := range fv.vars {
+		expr, ok := fvar.loc.at(pc)
+		if !ok {
+			if fvar.js.Const == "" {
+				out[i].Error = "no location at this PC"
+			}
+			continue
+		}
+		l, err := dwexpr.Eval(expr, fv.enc, fr)
+		if err != nil {
+			out[i].Error = err.Error()
+			continue
+		}
+		out[i].Loc = formatLocation(l, regName)
+		size := int(fvar.size)
+		if size <= 0 || size > maxVarValue {
+			size = 0
+		}
+		switch l.Kind {
+		case dwexpr.LocMem:
+			if size == 0 {
+				break
+			}
+			if p, ok := fr.ReadMem(l.Addr, size); ok {
+				out[i].Value = hex(p)
+			} else {
+				out[i].Error = "memory not in object file"
+			}
+		case dwexpr.LocReg:
+			if val, ok := fr.Regs[l.Reg]; ok {
+				out[i].Value = fmt.Sprintf("%#x", val)
+			}
+		case dwexpr.LocValue:
+			out[i].Value = fmt.Sprintf("%#x", l.Value)
+		case dwexpr.LocImplicit:
+			out[i].Value = hex(l.Bytes)
+		}
+	}
+	return out, nil
+}
+
+// setFrameBase evaluates the function's frame base at pc in fr, if fr
+// doesn't already have one.
+func (fv *funcVars) setFrameBase(pc uint64, fr *dwexpr.Frame) {
+	if expr, ok := fv.frameBase.at(pc); ok && !fr.HasFrameBase {
+		if l, err := dwexpr.Eval(expr, fv.enc, fr); err == nil {
+			if fb, err := fr.Addr(l); err == nil {
+				fr.FrameBase, fr.HasFrameBase = fb, true
+			}
+		}
+	}
+}
+
+// formatLocation formats an evaluated location using regName to name
+// registers.
+func formatLocation(l dwexpr.Location, regName func(uint64) string) string {
+	switch l.Kind {
+	case dwexpr.LocReg:
+		return regName(l.Reg)
+	case dwexpr.LocPieces:
+		var parts []string
+		for _, p := range l.Pieces {
+			parts = append(parts, fmt.Sprintf("%s (%d bits)", formatLocation(p.Location, regName), p.BitSize))
+		}
+		return strings.Join(parts, ", ")
+	}
+	return l.String()
+}
+
+// parseFrame parses a frame snapshot of the form
+// "rsp=0x7ffc1000 rbp=0x7ffc1040 cfa=0x7ffc1050". Register names are
+// as in the psABI, and "cfa" and "fb" give the canonical frame
+// address and frame base.
+func parseFrame(s string, a *arch.Arch) (*dwexpr.Frame, error) {
+	fr := &dwexpr.Frame{Regs: make(map[uint64]uint64)}
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool { return r == ' ' || r == ',' }) {
+		i := strings.Index(f, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("expected name=value, got %q", f)
+		}
+		name := f[:i]
+		val, err := strconv.ParseUint(f[i+1:], 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad value for %s: %v", name, err)
+		}
+		switch strings.ToLower(name) {
+		case "cfa":
+			fr.CFA, fr.HasCFA = val, true
+		case "fb":
+			fr.FrameBase, fr.HasFrameBase = val, true
+		default:
+			reg, ok := a.DWARFReg(name)
+			if !ok {
+				return nil, fmt.Errorf("unknown register %q", name)
+			}
+			fr.Regs[reg] = val
+		}
+	}
+	return fr, nil
+}
+
+// httpVars evaluates the variables of the function containing the
+// "pc" query parameter in the frame snapshot given by the "frame"
+// query parameter.
+func (s *state) httpVars(w http.ResponseWriter, r *http.Request) {
+	a := s.fi.Obj.Info().Arch
+	if a == nil {
+		http.Error(w, "unknown architecture", http.StatusBadRequest)
+		return
+	}
+	pc, err := strconv.ParseUint(r.FormValue("pc"), 16, 64)
+	if err != nil {
+		http.Error(w, "bad pc: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	fr, err := parseFrame(r.FormValue("frame"), a)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	vals, err := s.varView.Eval(pc, fr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	serveJSON(w, vals)
+}
@@ -0,0 +1,119 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+"use strict";
+
+// VarView shows the parameters and local variables of a function with
+// their DWARF locations, and evaluates them in a frame snapshot.
+class VarView {
+    constructor(data, container) {
+        const view = this;
+        this._container = container;
+        this._ranges = [];
+        const div = $("<div>").addClass("varview").appendTo(container);
+
+        if (data.FrameBase)
+            $("<div>").addClass("sv-note").text("frame base: ").
+                append(this._locs(data.FrameBase)).appendTo(div);
+
+        // Frame snapshot form.
+        const form = $("<form>").addClass("var-frame").appendTo(div);
+        this._pc = $("<input>").attr({size: 14, placeholder: "pc"});
+        this._frame = $("<input>").attr({size: 40, placeholder: "rsp=0x7ffc1000 cfa=0x7ffc1010"});
+        form.append("pc ").append(this._pc).append(" ").append(this._frame).
+            append(" ").append($("<button>").text("Evaluate"));
+        form.submit((ev) => {
+            ev.preventDefault();
+            view._eval();
+        });
+        this._status = $("<div>").addClass("sv-note").appendTo(div);
+
+        const table = $("<table>").appendTo(div);
+        this._values = [];
+        if (data.Vars.length == 0)
+            this._status.text("no variables");
+        for (let v of data.Vars) {
+            const name = $("<td>").addClass("var-name").
+                  css("padding-left", (v.Depth || 0) * 1.5 + "em").text(v.Name);
+            if (v.Param)
+                name.addClass("var-param");
+            if (v.Scope)
+                name.attr("title", "inlined from " + v.Scope);
+            const loc = $("<td>");
+            if (v.Const !== undefined)
+                loc.append($("<span>").text("const " + v.Const));
+            else if (v.Locs)
+                loc.append(this._locs(v.Locs));
+            else
+                loc.append($("<span>").addClass("var-none").text("optimized out"));
+            const value = $("<td>").addClass("var-value");
+            this._values.push(value);
+            $("<tr>").append(name).
+                append($("<td>").addClass("var-type").text(v.Type || "")).
+                append(loc).append(value).appendTo(table);
+        }
+    }
+
+    // _locs returns the DOM for a list of location expressions. Entries
+    // of location lists highlight their PC range when clicked.
+    _locs(locs) {
+        const view = this;
+        const out = $("<span>");
+        for (let l of locs) {
+            const elt = $("<div>").addClass("var-loc");
+            if (l.Start === undefined && !l.Default) {
+                elt.text(l.Expr);
+            } else if (l.Default) {
+                elt.text("default: " + l.Expr);
+            } else {
+                const range = {start: new AddrJS(l.Start), end: new AddrJS(l.End), elt: elt};
+                this._ranges.push(range);
+                elt.addClass("var-range").text("[0x" + range.start + ", 0x" + range.end + ") " + l.Expr);
+                elt.click(() => {
+                    highlightRanges([{start: range.start, end: range.end}], view);
+                });
+            }
+            out.append(elt);
+        }
+        return out;
+    }
+
+    _eval() {
+        const pc = this._pc.val().replace(/^0x/, "");
+        this._status.text("Evaluating…");
+        $.getJSON("/vars", {pc: pc, frame: this._frame.val()}).done((vals) => {
+            this._status.text("");
+            vals.forEach((v, i) => {
+                const td = this._values[i].empty();
+                if (v.Loc)
+                    td.append($("<span>").addClass("var-type").text(v.Loc + " "));
+                if (v.Value)
+                    td.append($("<span>").text(v.Value));
+                if (v.Error)
+                    td.append($("<span>").addClass("var-none").text(v.Error));
+            });
+        }).fail((xhr) => {
+            showError("Variables", xhr, this._status.empty());
+        });
+    }
+
+    highlightRanges(ranges, scroll) {
+        $(".highlight", this._container).removeClass("highlight");
+        if (ranges.length > 0)
+            this._pc.val("0x" + ranges[0].start);
+        let first = null;
+        for (let r of this._ranges) {
+            for (let h of ranges) {
+                if (IntervalMap.overlap(r, h)) {
+                    r.elt.addClass("highlight");
+                    if (!first)
+                        first = r.elt;
+                    break;
+                }
+            }
+        }
+        if (first && scroll)
+            scrollTo(this._container, first);
+    }
+}
@@ -0,0 +1,178 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// A server serves the current state, which is replaced when the
+// object file is reloaded.
+type server struct {
+	path string
+	auth authPolicy
+
+	mu    sync.RWMutex
+	state *state
+
+	// pkg is the -pkg build, or nil.
+	pkg *pkgBuild
+
+	// buildMu serializes runs of the build command.
+	buildMu sync.Mutex
+	// openMu serializes opening other object files from the web
+	// UI.
+	openMu sync.Mutex
+}
+
+// cur returns the current state. The result may be closed at any
+// time, so it's only good for reading fields like path. To use the
+// object file, call acquire instead.
+func (srv *server) cur() *state {
+	srv.mu.RLock()
+	defer srv.mu.RUnlock()
+	return srv.state
+}
+
+// acquire returns the current state with a reference that keeps it
+// open. The caller must release it.
+func (srv *server) acquire() *state {
+	srv.mu.RLock()
+	defer srv.mu.RUnlock()
+	srv.state.retain()
+	return srv.state
+}
+
+// replace makes st the current state. It releases the server's
+// reference to the old state, which closes once the requests and jobs
+// using it finish. srv.mu must be held.
+func (srv *server) replace(st *state) {
+	old := srv.state
+	srv.state = st
+	old.release()
+}
+
+// handle registers h to handle path using the current state.
+func (srv *server) handle(path string, h func(*state, http.ResponseWriter, *http.Request)) {
+	http.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		r, lg := withReqLog(r)
+		st := srv.acquire()
+		h(st, w, r)
+		st.release()
+		d := time.Since(start)
+		requestDuration.Observe(d.Seconds(), path)
+		lg.Debug("request", "method", r.Method, "path", r.URL.Path, "dur", d)
+	})
+}
+
+// fileKey identifies a version of a file.
+type fileKey struct {
+	size    int64
+	modTime time.Time
+}
+
+func statKey(path string) (fileKey, bool) {
+	st, err := os.Stat(path)
+	if err != nil {
+		return fileKey{}, false
+	}
+	return fileKey{st.Size(), st.ModTime()}, true
+}
+
+// watch polls the object file and reloads it when it changes,
+// notifying open pages with a "reload" event. If the web UI opens
+// another file, watch follows it. It never returns.
+func (srv *server) watch() {
+	path := srv.path
+	last, _ := statKey(path)
+	var pending fileKey
+	for range time.Tick(time.Second) {
+		if p := srv.cur().path; p != path {
+			path = p
+			last, _ = statKey(path)
+			pending = fileKey{}
+			continue
+		}
+		key, ok := statKey(path)
+		if !ok || key == last {
+			pending = fileKey{}
+			continue
+		}
+		// Wait for the file to stop changing, since it may
+		// still be being written.
+		if key != pending {
+			pending = key
+			continue
+		}
+		last, pending = key, fileKey{}
+
+		st, err := open(path)
+		if err != nil {
+			logger.Error("reloading", "path", path, "err", err)
+			events.publish("reload-error", err.Error())
+			continue
+		}
+		srv.mu.Lock()
+		old := srv.state
+		if old.path != path {
+			// The web UI opened another file meanwhile.
+			srv.mu.Unlock()
+			st.release()
+			continue
+		}
+		st.diffWith(old)
+		srv.replace(st)
+		srv.mu.Unlock()
+		logger.Info("reloaded", "path", path)
+		events.publish("reload", key.modTime.Format(time.RFC3339))
+	}
+}
+
+// canBuild reports whether the server has a build command.
+func (srv *server) canBuild() bool {
+	return *flagBuild != "" || srv.pkg != nil
+}
+
+// build runs the -build command or builds the -pkg package. If
+// watching, the watcher will notice the rebuilt object.
+func (srv *server) build() ([]byte, error) {
+	srv.buildMu.Lock()
+	defer srv.buildMu.Unlock()
+	events.publish("build", "started")
+	cmd := exec.Command("sh", "-c", *flagBuild)
+	if srv.pkg != nil {
+		cmd = srv.pkg.command()
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		events.publish("build", "failed: "+err.Error())
+	} else {
+		events.publish("build", "done")
+	}
+	return out, err
+}
+
+// httpRebuild runs the build command and responds with its output.
+func (srv *server) httpRebuild(w http.ResponseWriter, r *http.Request) {
+	if !srv.canBuild() {
+		http.Error(w, "no -build command", http.StatusNotFound)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "rebuild requires POST", http.StatusMethodNotAllowed)
+		return
+	}
+	out, err := srv.build()
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	w.Write(out)
+}
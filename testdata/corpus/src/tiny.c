@@ -0,0 +1,20 @@
+// tiny is the C program of the corpus. It has a call, a loop, and
+// initialized, read-only, and pointer data, so it has relocations and
+// several kinds of symbols without needing a C library.
+
+static const char msg[] = "hello";
+
+int counter = 1;
+const char *ptr = msg;
+int zero;
+
+__attribute__((noinline)) int add(int a, int b) {
+	return a + b + counter;
+}
+
+void _start(void) {
+	for (int i = 0; i < 3; i++)
+		zero += add(i, msg[i]);
+	for (;;)
+		;
+}
@@ -0,0 +1,154 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build ignore
+// +build ignore
+
+// mkcorpus writes the files of the object file corpus that don't
+// need a C toolchain. mkcorpus.sh runs it.
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/aclements/objbrowse/internal/elfobj"
+)
+
+var outDir = flag.String("o", "corpus", "write the corpus to `dir`")
+
+// A synthArch describes the code of a synthetic relocatable object
+// for one architecture: a function f that calls an undefined g and
+// returns, and a pointer to a string.
+type synthArch struct {
+	name    string
+	class   elf.Class
+	data    elf.Data
+	machine elf.Machine
+	// text is f's code. call is the offset of its call to g,
+	// relocated with callType and callAddend.
+	text       []uint32
+	textBytes  []byte // Used instead of text if non-nil
+	call       uint64
+	callType   uint32
+	callAddend int64
+	// ptrType relocates the pointer.
+	ptrType uint32
+}
+
+var synthArchs = []synthArch{
+	{
+		name: "arm64", class: elf.ELFCLASS64, data: elf.ELFDATA2LSB, machine: elf.EM_AARCH64,
+		// BL g; RET
+		text:     []uint32{0x94000000, 0xd65f03c0},
+		callType: uint32(elf.R_AARCH64_CALL26), ptrType: uint32(elf.R_AARCH64_ABS64),
+	},
+	{
+		name: "arm", class: elf.ELFCLASS32, data: elf.ELFDATA2LSB, machine: elf.EM_ARM,
+		// BL g (with the -8 addend in place); BX LR
+		text:     []uint32{0xebfffffe, 0xe12fff1e},
+		callType: uint32(elf.R_ARM_CALL), ptrType: uint32(elf.R_ARM_ABS32),
+	},
+	{
+		name: "ppc64", class: elf.ELFCLASS64, data: elf.ELFDATA2MSB, machine: elf.EM_PPC64,
+		// BL g; NOP; BLR
+		text:     []uint32{0x48000001, 0x60000000, 0x4e800020},
+		callType: uint32(elf.R_PPC64_REL24), ptrType: uint32(elf.R_PPC64_ADDR64),
+	},
+	{
+		name: "s390x", class: elf.ELFCLASS64, data: elf.ELFDATA2MSB, machine: elf.EM_S390,
+		// BRASL %r14, g; BR %r14
+		textBytes: []byte{0xc0, 0xe5, 0, 0, 0, 0, 0x07, 0xfe},
+		call:      2, callAddend: 2,
+		callType: uint32(elf.R_390_PLT32DBL), ptrType: uint32(elf.R_390_64),
+	},
+	{
+		name: "mips", class: elf.ELFCLASS32, data: elf.ELFDATA2MSB, machine: elf.EM_MIPS,
+		// JAL g; NOP; JR RA; NOP
+		text:     []uint32{0x0c000000, 0, 0x03e00008, 0},
+		callType: uint32(elf.R_MIPS_26), ptrType: uint32(elf.R_MIPS_32),
+	},
+}
+
+func (a synthArch) file() *elfobj.File {
+	var order binary.ByteOrder = binary.LittleEndian
+	if a.data == elf.ELFDATA2MSB {
+		order = binary.BigEndian
+	}
+	code := a.textBytes
+	for _, inst := range a.text {
+		var buf [4]byte
+		order.PutUint32(buf[:], inst)
+		code = append(code, buf[:]...)
+	}
+	ptrSize := 8
+	if a.class == elf.ELFCLASS32 {
+		ptrSize = 4
+	}
+
+	text := &elfobj.Section{Name: ".text", Type: elf.SHT_PROGBITS, Flags: elf.SHF_ALLOC | elf.SHF_EXECINSTR, Align: 4, Data: code}
+	rodata := &elfobj.Section{Name: ".rodata", Type: elf.SHT_PROGBITS, Flags: elf.SHF_ALLOC, Align: 1, Data: []byte("hello\x00")}
+	data := &elfobj.Section{Name: ".data", Type: elf.SHT_PROGBITS, Flags: elf.SHF_ALLOC | elf.SHF_WRITE, Align: uint64(ptrSize), Data: make([]byte, ptrSize)}
+	f := &elfobj.Symbol{Name: "f", Bind: elf.STB_GLOBAL, Type: elf.STT_FUNC, Section: text, Size: uint64(len(code))}
+	g := &elfobj.Symbol{Name: "g", Bind: elf.STB_GLOBAL}
+	msg := &elfobj.Symbol{Name: "msg", Bind: elf.STB_LOCAL, Type: elf.STT_OBJECT, Section: rodata, Size: 6}
+	ptr := &elfobj.Symbol{Name: "ptr", Bind: elf.STB_GLOBAL, Type: elf.STT_OBJECT, Section: data, Size: uint64(ptrSize)}
+	text.Relocs = []elfobj.Reloc{{Offset: a.call, Type: a.callType, Sym: g, Addend: a.callAddend}}
+	data.Relocs = []elfobj.Reloc{{Offset: 0, Type: a.ptrType, Sym: msg}}
+	return &elfobj.File{
+		Class: a.class, Data: a.data, Machine: a.machine,
+		Sections: []*elfobj.Section{text, rodata, data},
+		Symbols:  []*elfobj.Symbol{f, g, msg, ptr},
+	}
+}
+
+// fuzzSeed returns the input of a Go fuzzing corpus file holding one
+// []byte.
+func fuzzSeed(path string) []byte {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	lines := strings.SplitN(string(buf), "\n", 3)
+	if len(lines) < 2 || lines[0] != "go test fuzz v1" || !strings.HasPrefix(lines[1], "[]byte(") {
+		log.Fatalf("%s: not a []byte fuzz input", path)
+	}
+	s, err := strconv.Unquote(strings.TrimSuffix(strings.TrimPrefix(lines[1], "[]byte("), ")"))
+	if err != nil {
+		log.Fatalf("%s: %v", path, err)
+	}
+	return []byte(s)
+}
+
+func write(name string, data []byte) {
+	if err := ioutil.WriteFile(filepath.Join(*outDir, name), data, 0666); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func main() {
+	log.SetFlags(0)
+	flag.Parse()
+	for _, a := range synthArchs {
+		var buf bytes.Buffer
+		if _, err := a.file().WriteTo(&buf); err != nil {
+			log.Fatalf("%s: %v", a.name, err)
+		}
+		write(fmt.Sprintf("elf-%s-synth", a.name), buf.Bytes())
+	}
+
+	// There's no toolchain for PE and TE here, so reuse the seeds
+	// of obj's fuzz test.
+	seeds := filepath.Join("..", "obj", "testdata", "fuzz", "FuzzOpen")
+	write("pe-amd64", fuzzSeed(filepath.Join(seeds, "pe")))
+	write("te-amd64", fuzzSeed(filepath.Join(seeds, "te")))
+}
@@ -0,0 +1,54 @@
+#!/bin/sh
+# Copyright 2020 The Go Authors. All rights reserved.
+# Use of this source code is governed by a BSD-style
+# license that can be found in the LICENSE file.
+
+# mkcorpus.sh regenerates the object file corpus in corpus/, which the
+# golden tests of obj and objbrowse run over.
+#
+# It builds corpus/src/tiny.c for each architecture that has a C
+# compiler here, as a static executable, a PIE, and a relocatable
+# object. mkcorpus.go then writes the files that don't need a
+# toolchain: relocatable objects for other architectures and PE and
+# TE images. obj doesn't read Mach-O files or archives, so the corpus
+# has none.
+#
+# The corpus is checked in, since compilers differ, so only run this
+# to change it. Then update the golden files with
+#
+#	go test ./obj ./objbrowse -update
+#
+# and review the differences.
+
+set -e
+cd "$(dirname "$0")"
+out=corpus
+src=$out/src/tiny.c
+
+# Keep the files small: no C library, unwind tables, or build IDs,
+# and no page alignment between code and data.
+CFLAGS="-Os -g -nostdlib -fno-asynchronous-unwind-tables -fdebug-prefix-map=$PWD=."
+LDFLAGS="-Wl,--build-id=none -Wl,-z,noseparate-code"
+
+# build arch cc [flags...] builds the corpus files of arch with C
+# compiler cc, if it exists.
+build() {
+	arch=$1 cc=$2
+	shift 2
+	if ! command -v "$cc" >/dev/null 2>&1 || ! echo 'int x;' | "$cc" "$@" -x c -c -o /dev/null - 2>/dev/null; then
+		echo "skipping $arch: $cc doesn't work" >&2
+		return
+	fi
+	"$cc" "$@" $CFLAGS -c -o $out/elf-$arch-rel $src
+	"$cc" "$@" $CFLAGS $LDFLAGS -static -no-pie -o $out/elf-$arch-exec $src
+	"$cc" "$@" $CFLAGS $LDFLAGS -fPIE -pie -o $out/elf-$arch-pie $src
+}
+
+build amd64 ${CC_amd64:-gcc}
+build 386 ${CC_386:-gcc} -m32
+build arm64 ${CC_arm64:-aarch64-linux-gnu-gcc}
+build arm ${CC_arm:-arm-linux-gnueabihf-gcc}
+build ppc64le ${CC_ppc64le:-powerpc64le-linux-gnu-gcc}
+build s390x ${CC_s390x:-s390x-linux-gnu-gcc}
+
+go run mkcorpus.go -o $out